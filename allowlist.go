@@ -0,0 +1,105 @@
+package pubsub
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// AuthorAllowList is a set of peers allowed to author messages in a topic.
+// It is safe for concurrent use and can be updated at runtime.
+type AuthorAllowList struct {
+	mx  sync.RWMutex
+	ids map[peer.ID]struct{}
+}
+
+// NewAuthorAllowList creates an AuthorAllowList with the given peers.
+func NewAuthorAllowList(ids ...peer.ID) *AuthorAllowList {
+	al := &AuthorAllowList{ids: make(map[peer.ID]struct{})}
+	al.Add(ids...)
+	return al
+}
+
+// Add allows the given peers to author messages.
+func (al *AuthorAllowList) Add(ids ...peer.ID) {
+	al.mx.Lock()
+	defer al.mx.Unlock()
+
+	for _, id := range ids {
+		al.ids[id] = struct{}{}
+	}
+}
+
+// Remove disallows the given peers to author messages.
+func (al *AuthorAllowList) Remove(ids ...peer.ID) {
+	al.mx.Lock()
+	defer al.mx.Unlock()
+
+	for _, id := range ids {
+		delete(al.ids, id)
+	}
+}
+
+// Allowed returns whether the peer is allowed to author messages.
+func (al *AuthorAllowList) Allowed(id peer.ID) bool {
+	al.mx.RLock()
+	defer al.mx.RUnlock()
+
+	_, ok := al.ids[id]
+	return ok
+}
+
+// topicAllowList is the allow list of a topic, as registered with the pubsub instance
+type topicAllowList struct {
+	*AuthorAllowList
+	penalize bool
+}
+
+// WithAuthorAllowList restricts the authors of messages in a Topic to the peers in the allow list.
+// Messages from other authors are rejected with RejectUnauthorizedAuthor before they enter the
+// validation pipeline, so that they don't consume validation resources; if penalize is true, the
+// peer that propagated the message is penalized by peer scoring like for an invalid message.
+// Publishing is also refused if the local peer is not in the allow list.
+//
+// The author is only authenticated by the message signature, so the topic should use a strict
+// signing policy.
+func WithAuthorAllowList(al *AuthorAllowList, penalize bool) TopicOpt {
+	return func(t *Topic) error {
+		if al == nil {
+			return fmt.Errorf("nil author allow list")
+		}
+		t.allowList = &topicAllowList{AuthorAllowList: al, penalize: penalize}
+		return nil
+	}
+}
+
+func (p *PubSub) setTopicAllowList(topic string, al *topicAllowList) {
+	p.topicOptsMx.Lock()
+	defer p.topicOptsMx.Unlock()
+
+	if al == nil {
+		delete(p.allowLists, topic)
+		return
+	}
+	p.allowLists[topic] = al
+}
+
+func (p *PubSub) topicAllowList(topic string) *topicAllowList {
+	p.topicOptsMx.RLock()
+	defer p.topicOptsMx.RUnlock()
+
+	return p.allowLists[topic]
+}
+
+// checkAuthorAllowed checks the author of a message against the allow list of its topic
+func (p *PubSub) checkAuthorAllowed(msg *Message) bool {
+	al := p.topicAllowList(msg.GetTopic())
+	return al == nil || al.Allowed(msg.GetFrom())
+}
+
+// penalizeUnauthorizedAuthor returns whether unauthorized authors are penalized in the topic
+func (p *PubSub) penalizeUnauthorizedAuthor(topic string) bool {
+	al := p.topicAllowList(topic)
+	return al != nil && al.penalize
+}
@@ -0,0 +1,113 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestAuthorAllowList(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const topic = "permissioned"
+
+	hosts := getNetHosts(t, ctx, 3)
+	scorer := getGossipsub(ctx, hosts[0],
+		WithPeerScore(
+			&PeerScoreParams{
+				Topics: map[string]*TopicScoreParams{
+					topic: {
+						TopicWeight:                    1,
+						TimeInMeshQuantum:              time.Second,
+						InvalidMessageDeliveriesWeight: -1,
+						InvalidMessageDeliveriesDecay:  0.9999,
+					},
+				},
+				AppSpecificScore: func(peer.ID) float64 { return 0 },
+				DecayInterval:    time.Second,
+				DecayToZero:      0.01,
+			},
+			&PeerScoreThresholds{
+				GossipThreshold:   -10,
+				PublishThreshold:  -100,
+				GraylistThreshold: -1000,
+			}))
+	psubs := append([]*PubSub{scorer}, getGossipsubs(ctx, hosts[1:])...)
+
+	// 0 only allows 1 to publish, 2 doesn't enforce an allow list
+	al := NewAuthorAllowList(hosts[1].ID())
+	allowed, err := psubs[0].Join(topic, WithAuthorAllowList(al, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := allowed.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var topics []*Topic
+	for _, ps := range psubs[1:] {
+		tp, err := ps.Join(topic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tp.Subscribe(); err != nil {
+			t.Fatal(err)
+		}
+		topics = append(topics, tp)
+	}
+
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[0], hosts[2])
+	time.Sleep(time.Second)
+
+	// the local peer isn't allowed to publish
+	var verr ValidationError
+	if err := allowed.Publish(ctx, []byte("local")); !errors.As(err, &verr) || verr.Reason != RejectUnauthorizedAuthor {
+		t.Fatalf("expected an unauthorized author error, got %v", err)
+	}
+
+	if err := topics[0].Publish(ctx, []byte("allowed")); err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, sub, []byte("allowed"))
+
+	if err := topics[1].Publish(ctx, []byte("unauthorized")); err != nil {
+		t.Fatal(err)
+	}
+	assertNeverReceives(t, sub, time.Second)
+
+	if score := scorer.rt.(*GossipSubRouter).score.Score(hosts[2].ID()); score >= 0 {
+		t.Fatalf("expected the propagating peer to be penalized, got score %f", score)
+	}
+
+	// the allow list can be updated at runtime
+	al.Remove(hosts[1].ID())
+	if err := topics[0].Publish(ctx, []byte("revoked")); err != nil {
+		t.Fatal(err)
+	}
+	assertNeverReceives(t, sub, time.Second)
+
+	al.Add(hosts[2].ID())
+	if err := topics[1].Publish(ctx, []byte("authorized")); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the rejected message may still arrive through gossip now that its author is allowed
+		if string(msg.Data) == "unauthorized" {
+			continue
+		}
+		if string(msg.Data) != "authorized" {
+			t.Fatalf("unexpected message: %s", msg.Data)
+		}
+		break
+	}
+}
@@ -0,0 +1,33 @@
+package pubsub
+
+import (
+	"fmt"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+// DefaultAnnounceWindow is the default window over which the subscription changes are batched
+// before they are announced to the peers.
+const DefaultAnnounceWindow = 5 * time.Millisecond
+
+// WithAnnounceWindow sets the window over which the subscription changes are batched into a
+// single RPC per peer, so that joining many topics at once, at startup for instance, doesn't
+// send a burst of RPCs announcing them one at a time. The announcements are delayed by up to
+// the window; 0 announces every change immediately. The default is DefaultAnnounceWindow.
+// The window is timed on the clock set with WithClock.
+func WithAnnounceWindow(window time.Duration) Option {
+	return func(p *PubSub) error {
+		if window < 0 {
+			return fmt.Errorf("invalid announce window: %s", window)
+		}
+		p.announceWindow = window
+		return nil
+	}
+}
+
+// subscriptionRPCs returns the RPCs announcing subscription changes, fragmented so that none
+// exceeds the message size limit
+func (p *PubSub) subscriptionRPCs(subs []*pb.RPC_SubOpts) []*RPC {
+	return appendOrMergeRPC(nil, p.maxMessageSize, *rpcWithSubs(subs...))
+}
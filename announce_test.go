@@ -0,0 +1,162 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// announceTracer records the sizes of the subscription announcements received from each peer
+type announceTracer struct {
+	noopRawTracer
+
+	mx   sync.Mutex
+	rpcs map[peer.ID][]int
+}
+
+func (t *announceTracer) RecvRPC(rpc *RPC) {
+	if len(rpc.GetSubscriptions()) == 0 {
+		return
+	}
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	if t.rpcs == nil {
+		t.rpcs = make(map[peer.ID][]int)
+	}
+	t.rpcs[rpc.from] = append(t.rpcs[rpc.from], rpc.Size())
+}
+
+func (t *announceTracer) received(p peer.ID) []int {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return append([]int(nil), t.rpcs[p]...)
+}
+
+func TestAnnounceBatching(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	ps := getPubsub(ctx, hosts[0], WithAnnounceWindow(50*time.Millisecond))
+	tracers := []*announceTracer{{}, {}}
+	psubs := []*PubSub{
+		getPubsub(ctx, hosts[1], WithRawTracer(tracers[0])),
+		getPubsub(ctx, hosts[2], WithRawTracer(tracers[1])),
+	}
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(100 * time.Millisecond)
+
+	const topics = 200
+	for i := 0; i < topics; i++ {
+		mustSubscribe(t, ps, fmt.Sprintf("topic-%03d", i))
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if rpcs := tracers[0].received(hosts[0].ID()); len(rpcs) > 5 {
+		t.Fatalf("expected the subscriptions to be announced in a few RPCs, got %d", len(rpcs))
+	}
+	for i := 0; i < topics; i++ {
+		topic := fmt.Sprintf("topic-%03d", i)
+		if peers := psubs[0].ListPeers(topic); len(peers) != 1 {
+			t.Fatalf("expected the subscription to %s to be announced, got %v", topic, peers)
+		}
+	}
+
+	// a new peer gets all the subscriptions at once
+	connect(t, hosts[0], hosts[2])
+	time.Sleep(100 * time.Millisecond)
+	if rpcs := tracers[1].received(hosts[0].ID()); len(rpcs) != 1 {
+		t.Fatalf("expected the subscriptions to be sent in one RPC to the new peer, got %d", len(rpcs))
+	}
+	if peers := psubs[1].ListPeers("topic-000"); len(peers) != 1 {
+		t.Fatalf("expected the new peer to know the subscriptions, got %v", peers)
+	}
+}
+
+func TestAnnounceAfterHello(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	clk := newMockClock()
+	ps := getPubsub(ctx, hosts[0], WithAnnounceWindow(time.Second), WithClock(clk))
+	psubs := getPubsubs(ctx, hosts[1:])
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(100 * time.Millisecond)
+
+	// the new peer gets the pending subscription in its hello packets, then the changes made
+	// within the window after them with the flush
+	subA := mustSubscribe(t, ps, "a")
+	connect(t, hosts[0], hosts[2])
+	time.Sleep(100 * time.Millisecond)
+	if peers := psubs[1].ListPeers("a"); len(peers) != 1 {
+		t.Fatalf("expected the new peer to get the subscription in the hello packets, got %v", peers)
+	}
+	mustSubscribe(t, ps, "b")
+	subA.Cancel()
+	time.Sleep(100 * time.Millisecond)
+	if peers := psubs[0].ListPeers("b"); len(peers) != 0 {
+		t.Fatalf("expected the subscription to be held until the end of the window, got %v", peers)
+	}
+	clk.Add(time.Second)
+	time.Sleep(100 * time.Millisecond)
+
+	for i, p := range psubs {
+		if peers := p.ListPeers("b"); len(peers) != 1 || peers[0] != hosts[0].ID() {
+			t.Fatalf("expected peer %d to know the subscription made after the hello, got %v", i, peers)
+		}
+		if peers := p.ListPeers("a"); len(peers) != 0 {
+			t.Fatalf("expected peer %d to know the unsubscription made after the hello, got %v", i, peers)
+		}
+	}
+}
+
+func TestAnnounceFragmentation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const limit = 1000
+	hosts := getNetHosts(t, ctx, 2)
+	tracer := &announceTracer{}
+	ps := getPubsub(ctx, hosts[0], WithMaxMessageSize(limit))
+	sub := getPubsub(ctx, hosts[1], WithRawTracer(tracer))
+
+	const topics = 200
+	for i := 0; i < topics; i++ {
+		mustSubscribe(t, ps, fmt.Sprintf("topic-%03d", i))
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(100 * time.Millisecond)
+
+	rpcs := tracer.received(hosts[0].ID())
+	if len(rpcs) < 2 {
+		t.Fatalf("expected the subscriptions to be fragmented, got %d RPCs", len(rpcs))
+	}
+	for _, size := range rpcs {
+		if size > limit {
+			t.Fatalf("expected RPCs within the message size limit, got %d bytes", size)
+		}
+	}
+	for i := 0; i < topics; i++ {
+		topic := fmt.Sprintf("topic-%03d", i)
+		if peers := sub.ListPeers(topic); len(peers) != 1 {
+			t.Fatalf("expected the subscription to %s to be announced, got %v", topic, peers)
+		}
+	}
+}
+
+func TestAnnounceWindowValidation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	if _, err := NewFloodSub(ctx, hosts[0], WithAnnounceWindow(-time.Second)); err == nil {
+		t.Fatal("expected an error for a negative announce window")
+	}
+}
@@ -0,0 +1,192 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// autoBlacklistQueueSize is the number of rejections buffered for rule evaluation; rejections
+// beyond it are dropped.
+const autoBlacklistQueueSize = 1024
+
+// BlacklistRule blacklists a peer for Duration once Count of its messages have been rejected
+// with Reason within Window.
+type BlacklistRule struct {
+	// Reason is the rejection reason, one of the named strings Reject*.
+	Reason string
+	// Count is the number of rejections that trips the rule.
+	Count int
+	// Window is the interval in which the rejections are counted.
+	Window time.Duration
+	// Duration is how long the peer is blacklisted for.
+	Duration time.Duration
+}
+
+// WithAutoBlacklist blacklists the peers whose messages are repeatedly rejected, according to
+// the given rules. The rules are evaluated in the background, off the validation path; trips
+// are reported to raw tracers implementing AutoBlacklistTracer.
+func WithAutoBlacklist(rules ...BlacklistRule) Option {
+	return func(p *PubSub) error {
+		if len(rules) == 0 {
+			return fmt.Errorf("no auto blacklist rules")
+		}
+		for _, r := range rules {
+			if r.Reason == "" {
+				return fmt.Errorf("auto blacklist rule without reason")
+			}
+			if r.Count <= 0 || r.Window <= 0 || r.Duration <= 0 {
+				return fmt.Errorf("invalid auto blacklist rule for %q", r.Reason)
+			}
+		}
+		p.autoBlacklist = &autoBlacklister{
+			rules:   rules,
+			rejects: make(chan autoBlacklistReject, autoBlacklistQueueSize),
+		}
+		return nil
+	}
+}
+
+// AutoBlacklistTracer is an optional interface for RawTracers, which is invoked when a peer is
+// blacklisted by an auto blacklist rule.
+type AutoBlacklistTracer interface {
+	AutoBlacklisted(p peer.ID, rule BlacklistRule)
+}
+
+// AutoBlacklistTrips returns the number of times an auto blacklist rule has tripped.
+func (p *PubSub) AutoBlacklistTrips() uint64 {
+	if p.autoBlacklist == nil {
+		return 0
+	}
+	return p.autoBlacklist.trips.Load()
+}
+
+type autoBlacklistReject struct {
+	peer   peer.ID
+	reason string
+	time   time.Time
+}
+
+// autoBlacklister is an internal tracer that evaluates the auto blacklist rules
+type autoBlacklister struct {
+	p       *PubSub
+	rules   []BlacklistRule
+	rejects chan autoBlacklistReject
+
+	// rejections within the window, per rule and peer; owned by the evaluation goroutine
+	history []map[peer.ID][]time.Time
+
+	trips atomic.Uint64
+}
+
+var _ RawTracer = (*autoBlacklister)(nil)
+
+func (ab *autoBlacklister) Start(ctx context.Context, p *PubSub) {
+	ab.p = p
+	ab.history = make([]map[peer.ID][]time.Time, len(ab.rules))
+	for i := range ab.history {
+		ab.history[i] = make(map[peer.ID][]time.Time)
+	}
+
+	go ab.loop(ctx)
+}
+
+func (ab *autoBlacklister) loop(ctx context.Context) {
+	var maxWindow time.Duration
+	for _, r := range ab.rules {
+		if r.Window > maxWindow {
+			maxWindow = r.Window
+		}
+	}
+
+	sweep := ab.p.clock.NewTicker(maxWindow)
+	defer sweep.Stop()
+
+	for {
+		select {
+		case rej := <-ab.rejects:
+			ab.evaluate(rej)
+		case <-sweep.C():
+			ab.sweep(ab.p.clock.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (ab *autoBlacklister) evaluate(rej autoBlacklistReject) {
+	for i, r := range ab.rules {
+		if r.Reason != rej.reason {
+			continue
+		}
+
+		times := append(prune(ab.history[i][rej.peer], rej.time.Add(-r.Window)), rej.time)
+		if len(times) < r.Count {
+			ab.history[i][rej.peer] = times
+			continue
+		}
+
+		for _, h := range ab.history {
+			delete(h, rej.peer)
+		}
+		ab.trips.Add(1)
+		log.Infof("auto blacklisting peer %s for %s: %d messages rejected with %q", rej.peer, r.Duration, len(times), r.Reason)
+		ab.p.tracer.AutoBlacklisted(rej.peer, r)
+		ab.p.blacklistPeerFor(rej.peer, r.Duration, BlacklistReasonAuto+": "+r.Reason)
+		return
+	}
+}
+
+// sweep forgets the peers without rejections in the window
+func (ab *autoBlacklister) sweep(now time.Time) {
+	for i, r := range ab.rules {
+		for pid, times := range ab.history[i] {
+			times = prune(times, now.Add(-r.Window))
+			if len(times) == 0 {
+				delete(ab.history[i], pid)
+			} else {
+				ab.history[i][pid] = times
+			}
+		}
+	}
+}
+
+// prune drops the times before the cutoff from a sorted slice
+func prune(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+func (ab *autoBlacklister) RejectMessage(msg *Message, reason string) {
+	if msg.ReceivedFrom == "" {
+		return
+	}
+
+	select {
+	case ab.rejects <- autoBlacklistReject{peer: msg.ReceivedFrom, reason: reason, time: ab.p.clock.Now()}:
+	default:
+		log.Debugf("auto blacklist queue full; dropping rejection from %s", msg.ReceivedFrom)
+	}
+}
+
+func (ab *autoBlacklister) AddPeer(p peer.ID, proto protocol.ID) {}
+func (ab *autoBlacklister) RemovePeer(p peer.ID)                 {}
+func (ab *autoBlacklister) Join(topic string)                    {}
+func (ab *autoBlacklister) Leave(topic string)                   {}
+func (ab *autoBlacklister) Graft(p peer.ID, topic string)        {}
+func (ab *autoBlacklister) Prune(p peer.ID, topic string)        {}
+func (ab *autoBlacklister) ValidateMessage(msg *Message)         {}
+func (ab *autoBlacklister) DeliverMessage(msg *Message)          {}
+func (ab *autoBlacklister) DuplicateMessage(msg *Message)        {}
+func (ab *autoBlacklister) ThrottlePeer(p peer.ID)               {}
+func (ab *autoBlacklister) RecvRPC(rpc *RPC)                     {}
+func (ab *autoBlacklister) SendRPC(rpc *RPC, p peer.ID)          {}
+func (ab *autoBlacklister) DropRPC(rpc *RPC, p peer.ID)          {}
+func (ab *autoBlacklister) UndeliverableMessage(msg *Message)    {}
@@ -0,0 +1,103 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+type autoBlacklistTracer struct {
+	noopRawTracer
+
+	mx      sync.Mutex
+	tripped map[peer.ID]BlacklistRule
+}
+
+func (t *autoBlacklistTracer) AutoBlacklisted(p peer.ID, rule BlacklistRule) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.tripped[p] = rule
+}
+
+func TestAutoBlacklist(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rule := BlacklistRule{
+		Reason:   RejectValidationFailed,
+		Count:    3,
+		Window:   10 * time.Minute,
+		Duration: time.Hour,
+	}
+	tracer := &autoBlacklistTracer{tripped: make(map[peer.ID]BlacklistRule)}
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := []*PubSub{
+		getPubsub(ctx, hosts[0]),
+		getPubsub(ctx, hosts[1], WithAutoBlacklist(rule), WithRawTracer(tracer)),
+	}
+	connect(t, hosts[0], hosts[1])
+
+	err := psubs[1].RegisterTopicValidator("test", func(ctx context.Context, p peer.ID, msg *Message) bool {
+		return string(msg.Data) != "invalid"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := psubs[1].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	for i := 0; i < rule.Count-1; i++ {
+		psubs[0].Publish("test", []byte("invalid"))
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	if _, ok := psubs[1].BlacklistTimeRemaining(hosts[0].ID()); ok {
+		t.Fatal("expected the peer not to be blacklisted below the rule count")
+	}
+	psubs[0].Publish("test", []byte("valid"))
+	assertReceive(t, sub, []byte("valid"))
+
+	psubs[0].Publish("test", []byte("invalid"))
+	time.Sleep(time.Millisecond * 100)
+
+	if remaining, ok := psubs[1].BlacklistTimeRemaining(hosts[0].ID()); !ok || remaining < rule.Duration-time.Minute {
+		t.Fatalf("expected the peer to be blacklisted for an hour, got %s", remaining)
+	}
+	if trips := psubs[1].AutoBlacklistTrips(); trips != 1 {
+		t.Fatalf("expected one trip, got %d", trips)
+	}
+	tracer.mx.Lock()
+	tripped, ok := tracer.tripped[hosts[0].ID()]
+	tracer.mx.Unlock()
+	if !ok || tripped != rule {
+		t.Fatal("expected the trip to be traced")
+	}
+
+	psubs[0].Publish("test", []byte("valid"))
+	assertNeverReceives(t, sub, time.Second)
+}
+
+func TestAutoBlacklistInvalidRules(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	for _, rules := range [][]BlacklistRule{
+		nil,
+		{{Count: 1, Window: time.Minute, Duration: time.Minute}},
+		{{Reason: RejectInvalidSignature, Window: time.Minute, Duration: time.Minute}},
+		{{Reason: RejectInvalidSignature, Count: 1, Duration: time.Minute}},
+		{{Reason: RejectInvalidSignature, Count: 1, Window: time.Minute}},
+	} {
+		if _, err := NewFloodSub(ctx, hosts[0], WithAutoBlacklist(rules...)); err == nil {
+			t.Fatalf("expected an error for rules %v", rules)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package pubsub
+
+import (
+	"fmt"
+	"time"
+)
+
+// AutoJoinParams are the parameters of the automatic join of a topic we publish to.
+type AutoJoinParams struct {
+	// Rate is the local publish rate, in messages per second, above which the topic is joined.
+	Rate float64
+	// Sustain is how long the publish rate must stay above Rate before the topic is joined; 0
+	// joins as soon as the rate is measured above Rate.
+	Sustain time.Duration
+	// Idle is how long without publishing before the topic joined automatically is left.
+	Idle time.Duration
+	// Interval is the period the publish rate is measured over; defaults to a second.
+	Interval time.Duration
+}
+
+// WithAutoJoin joins the mesh of a Topic automatically once we sustain a publish rate in it,
+// and leaves it after an idle period, so that the nodes publishing a lot without subscribing
+// get the delivery of the mesh rather than rely on their fanout peers. The topic is joined like
+// with Relay, without a local Subscription, and only if it is neither subscribed to nor relayed.
+// The event handlers of the topic created WithMeshAutoEvents receive a MeshAutoJoin and a
+// MeshAutoLeave event when the topic is joined and left.
+func WithAutoJoin(params AutoJoinParams) TopicOpt {
+	return func(t *Topic) error {
+		if params.Rate <= 0 {
+			return fmt.Errorf("invalid auto join rate: %f", params.Rate)
+		}
+		if params.Sustain < 0 {
+			return fmt.Errorf("invalid auto join sustain period: %s", params.Sustain)
+		}
+		if params.Idle <= 0 {
+			return fmt.Errorf("invalid auto join idle period: %s", params.Idle)
+		}
+		if params.Interval < 0 {
+			return fmt.Errorf("invalid auto join interval: %s", params.Interval)
+		}
+		if params.Interval == 0 {
+			params.Interval = time.Second
+		}
+		t.autoJoin = &autoJoiner{params: params}
+		return nil
+	}
+}
+
+// WithMeshAutoEvents delivers the MeshAutoJoin and MeshAutoLeave events of a topic joined
+// WithAutoJoin to a TopicEventHandler; the other handlers only receive the peer events.
+func WithMeshAutoEvents() TopicEventHandlerOpt {
+	return func(h *TopicEventHandler) error {
+		h.autoEvents = true
+		return nil
+	}
+}
+
+// sendAutoNotification sends an automatic join event to the event handlers that opted in
+func (t *Topic) sendAutoNotification(evt PeerEvent) {
+	t.evtHandlerMux.RLock()
+	defer t.evtHandlerMux.RUnlock()
+
+	for h := range t.evtHandlers {
+		if h.autoEvents {
+			h.sendNotification(evt)
+		}
+	}
+}
+
+// autoJoiner measures the publish rate of a topic; its state is only accessed from the event
+// loop
+type autoJoiner struct {
+	params AutoJoinParams
+	stop   chan struct{}
+
+	// published is the number of messages published in the current interval
+	published int
+	// above is how long the publish rate has been above the threshold
+	above time.Duration
+	// lastPublish is the time of the last message published
+	lastPublish time.Time
+	// joined is set while the topic is joined automatically
+	joined bool
+}
+
+// startAutoJoin starts measuring the publish rate of a topic joined with WithAutoJoin.
+// Only called from processLoop.
+func (p *PubSub) startAutoJoin(t *Topic) {
+	aj := t.autoJoin
+	aj.stop = make(chan struct{})
+
+	go func() {
+		ticker := p.clock.NewTicker(aj.params.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C():
+				select {
+				case p.eval <- func() { p.autoJoinTick(t) }:
+				case <-aj.stop:
+					return
+				case <-p.ctx.Done():
+					return
+				}
+			case <-aj.stop:
+				return
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stopAutoJoin stops measuring the publish rate of a topic handle being removed, leaving the
+// topic if it was joined automatically.
+// Only called from processLoop.
+func (p *PubSub) stopAutoJoin(t *Topic) {
+	aj := t.autoJoin
+	close(aj.stop)
+	if aj.joined {
+		aj.joined = false
+		p.handleRemoveRelay(t.topic)
+	}
+}
+
+// autoJoinRelays returns the relay reference taken by the automatic join of a topic, if any.
+// Only called from processLoop.
+func (p *PubSub) autoJoinRelays(topic string) int {
+	t, ok := p.myTopics[topic]
+	if ok && t.autoJoin != nil && t.autoJoin.joined {
+		return 1
+	}
+	return 0
+}
+
+// autoJoinPublished counts a message we published.
+// Only called from processLoop.
+func (p *PubSub) autoJoinPublished(topic string) {
+	t, ok := p.myTopics[topic]
+	if !ok || t.autoJoin == nil {
+		return
+	}
+	t.autoJoin.published++
+	t.autoJoin.lastPublish = p.clock.Now()
+}
+
+// autoJoinTick measures the publish rate of a topic over the last interval, joining the topic
+// once the rate is sustained and leaving it once idle.
+// Only called from processLoop.
+func (p *PubSub) autoJoinTick(t *Topic) {
+	if p.myTopics[t.topic] != t {
+		// removed in the meantime
+		return
+	}
+
+	aj := t.autoJoin
+	rate := float64(aj.published) / aj.params.Interval.Seconds()
+	aj.published = 0
+	if rate > aj.params.Rate {
+		aj.above += aj.params.Interval
+	} else {
+		aj.above = 0
+	}
+
+	switch {
+	case !aj.joined && aj.above > 0 && aj.above >= aj.params.Sustain:
+		if len(p.mySubs[t.topic]) > 0 || p.myRelays[t.topic] > 0 {
+			// in the mesh already
+			return
+		}
+		log.Debugf("joining topic %s for its publish rate of %.1f/s", t.topic, rate)
+		aj.joined = true
+		p.addRelayRef(t.topic)
+		t.sendAutoNotification(PeerEvent{MeshAutoJoin, p.host.ID()})
+	case aj.joined && p.clock.Now().Sub(aj.lastPublish) >= aj.params.Idle:
+		log.Debugf("leaving topic %s idle for %s", t.topic, aj.params.Idle)
+		aj.joined = false
+		p.handleRemoveRelay(t.topic)
+		t.sendAutoNotification(PeerEvent{MeshAutoLeave, p.host.ID()})
+	}
+}
@@ -0,0 +1,156 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAutoJoin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getGossipsubs(ctx, hosts)
+	connect(t, hosts[0], hosts[1])
+
+	sub := mustSubscribe(t, psubs[1], "test")
+	topic, err := psubs[0].Join("test", WithAutoJoin(AutoJoinParams{
+		Rate:     10,
+		Sustain:  300 * time.Millisecond,
+		Idle:     500 * time.Millisecond,
+		Interval: 100 * time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	evts, err := topic.EventHandler(WithMeshAutoEvents())
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerEvts, err := topic.EventHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	nextEvent := func(exp EventType) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		for {
+			evt, err := evts.NextPeerEvent(ctx)
+			if err != nil {
+				t.Fatalf("expected event %d: %s", exp, err)
+			}
+			if evt.Type == PeerJoin {
+				continue
+			}
+			if evt.Type != exp || evt.Peer != hosts[0].ID() {
+				t.Fatalf("expected event %d of ourselves, got %d of %s", exp, evt.Type, evt.Peer)
+			}
+			return
+		}
+	}
+
+	// a short burst doesn't join
+	for i := 0; i < 3; i++ {
+		if err := topic.Publish(ctx, []byte("burst")); err != nil {
+			t.Fatal(err)
+		}
+		assertReceive(t, sub, []byte("burst"))
+	}
+	time.Sleep(300 * time.Millisecond)
+	if len(psubs[0].meshPeers("test")) != 0 {
+		t.Fatal("expected the topic not to be joined after a burst")
+	}
+
+	// a sustained rate joins
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 40; i++ {
+			if err := topic.Publish(ctx, []byte("sustained")); err != nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	nextEvent(MeshAutoJoin)
+	time.Sleep(100 * time.Millisecond)
+	if peers := psubs[0].meshPeers("test"); len(peers) != 1 || peers[0] != hosts[1].ID() {
+		t.Fatalf("expected the topic to be joined with the subscriber, got mesh %v", peers)
+	}
+	<-done
+
+	// and idling leaves
+	nextEvent(MeshAutoLeave)
+	time.Sleep(100 * time.Millisecond)
+	if len(psubs[0].meshPeers("test")) != 0 {
+		t.Fatal("expected the topic to be left once idle")
+	}
+
+	// the handlers that didn't opt in only receive the peer events
+	for {
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		evt, err := peerEvts.NextPeerEvent(ctx)
+		cancel()
+		if err != nil {
+			break
+		}
+		if evt.Type != PeerJoin {
+			t.Fatalf("expected only peer events, got event %d", evt.Type)
+		}
+	}
+
+	evts.Cancel()
+	peerEvts.Cancel()
+	if err := topic.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAutoJoinClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getGossipsub(ctx, hosts[0])
+
+	topic, err := ps.Join("test", WithAutoJoin(AutoJoinParams{Rate: 1, Idle: time.Minute, Interval: 50 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := topic.Publish(ctx, []byte("message")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	// the topic joined automatically doesn't keep the handle from closing, and is left with it
+	if err := topic.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan bool, 1)
+	ps.eval <- func() {
+		_, joined := ps.rt.(*GossipSubRouter).mesh["test"]
+		out <- joined || ps.myRelays["test"] > 0
+	}
+	if <-out {
+		t.Fatal("expected the topic to be left")
+	}
+}
+
+func TestAutoJoinParamsValidation(t *testing.T) {
+	for _, params := range []AutoJoinParams{
+		{Rate: 0, Idle: time.Second},
+		{Rate: 1, Idle: 0},
+		{Rate: 1, Idle: time.Second, Sustain: -1},
+		{Rate: 1, Idle: time.Second, Interval: -1},
+	} {
+		if err := WithAutoJoin(params)(&Topic{}); err == nil {
+			t.Fatalf("expected params %+v to be refused", params)
+		}
+	}
+}
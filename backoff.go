@@ -26,21 +26,66 @@ type backoffHistory struct {
 	attempts  int
 }
 
+// WithStreamBackoff sets the backoff of the stream re-establishment with peers whose stream died
+// while still connected. The first retry is immediate, then the delay starts at base and doubles
+// with every consecutive failure, up to max. After maxAttempts consecutive failures the peer is
+// left dead until it connects again, which resets its backoff.
+// The defaults are MinBackoffDelay, MaxBackoffDelay and MaxBackoffAttempts.
+func WithStreamBackoff(base, max time.Duration, maxAttempts int) Option {
+	return func(p *PubSub) error {
+		if base <= 0 || max < base {
+			return fmt.Errorf("invalid stream backoff delays")
+		}
+		if maxAttempts <= 0 {
+			return fmt.Errorf("invalid stream backoff attempts")
+		}
+		p.streamBackoffBase = base
+		p.streamBackoffMax = max
+		p.streamBackoffAttempts = maxAttempts
+		return nil
+	}
+}
+
+// PeerBackoffState is the stream re-establishment backoff state of a peer.
+type PeerBackoffState struct {
+	// Attempts is the number of consecutive stream re-establishments.
+	Attempts int
+	// Delay is the delay of the last re-establishment.
+	Delay time.Duration
+	// LastTried is the time of the last re-establishment.
+	LastTried time.Time
+	// Exhausted is whether the peer reached the attempt limit, and is left dead until it
+	// connects again.
+	Exhausted bool
+}
+
+// PeerBackoff returns the stream re-establishment backoff state of a peer, and false if the
+// peer has none.
+func (p *PubSub) PeerBackoff(pid peer.ID) (PeerBackoffState, bool) {
+	return p.deadPeerBackoff.state(pid)
+}
+
 type backoff struct {
 	mu          sync.Mutex
 	info        map[peer.ID]*backoffHistory
 	ct          int           // size threshold that kicks off the cleaner
 	ci          time.Duration // cleanup intervals
+	minDelay    time.Duration // delay of the first backoff
+	maxDelay    time.Duration // cap of the backoff delay
 	maxAttempts int           // maximum backoff attempts prior to ejection
+	clock       Clock
 }
 
-func newBackoff(ctx context.Context, sizeThreshold int, cleanupInterval time.Duration, maxAttempts int) *backoff {
+func newBackoff(ctx context.Context, sizeThreshold int, cleanupInterval, minDelay, maxDelay time.Duration, maxAttempts int, clock Clock) *backoff {
 	b := &backoff{
 		mu:          sync.Mutex{},
 		ct:          sizeThreshold,
 		ci:          cleanupInterval,
+		minDelay:    minDelay,
+		maxDelay:    maxDelay,
 		maxAttempts: maxAttempts,
 		info:        make(map[peer.ID]*backoffHistory),
+		clock:       clock,
 	}
 
 	rand.Seed(time.Now().UnixNano()) // used for jitter
@@ -55,7 +100,7 @@ func (b *backoff) updateAndGet(id peer.ID) (time.Duration, error) {
 
 	h, ok := b.info[id]
 	switch {
-	case !ok || time.Since(h.lastTried) > TimeToLive:
+	case !ok || b.clock.Now().Sub(h.lastTried) > TimeToLive:
 		// first request goes immediately.
 		h = &backoffHistory{
 			duration: time.Duration(0),
@@ -64,43 +109,68 @@ func (b *backoff) updateAndGet(id peer.ID) (time.Duration, error) {
 	case h.attempts >= b.maxAttempts:
 		return 0, fmt.Errorf("peer %s has reached its maximum backoff attempts", id)
 
-	case h.duration < MinBackoffDelay:
-		h.duration = MinBackoffDelay
+	case h.duration < b.minDelay:
+		h.duration = b.minDelay
 
-	case h.duration < MaxBackoffDelay:
+	case h.duration < b.maxDelay:
 		jitter := rand.Intn(MaxBackoffJitterCoff)
 		h.duration = (BackoffMultiplier * h.duration) + time.Duration(jitter)*time.Millisecond
-		if h.duration > MaxBackoffDelay || h.duration < 0 {
-			h.duration = MaxBackoffDelay
+		if h.duration > b.maxDelay || h.duration < 0 {
+			h.duration = b.maxDelay
 		}
 	}
 
 	h.attempts += 1
-	h.lastTried = time.Now()
+	h.lastTried = b.clock.Now()
 	b.info[id] = h
 	return h.duration, nil
 }
 
+// reset forgets the backoff history of a peer
+func (b *backoff) reset(id peer.ID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.info, id)
+}
+
+func (b *backoff) state(id peer.ID) (PeerBackoffState, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h, ok := b.info[id]
+	if !ok || b.clock.Now().Sub(h.lastTried) > TimeToLive {
+		return PeerBackoffState{}, false
+	}
+	return PeerBackoffState{
+		Attempts:  h.attempts,
+		Delay:     h.duration,
+		LastTried: h.lastTried,
+		Exhausted: h.attempts >= b.maxAttempts,
+	}, true
+}
+
 func (b *backoff) cleanup() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	now := b.clock.Now()
 	for id, h := range b.info {
-		if time.Since(h.lastTried) > TimeToLive {
+		if now.Sub(h.lastTried) > TimeToLive {
 			delete(b.info, id)
 		}
 	}
 }
 
 func (b *backoff) cleanupLoop(ctx context.Context) {
-	ticker := time.NewTicker(b.ci)
+	ticker := b.clock.NewTicker(b.ci)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return // pubsub shutting down
-		case <-ticker.C:
+		case <-ticker.C():
 			b.cleanup()
 		}
 	}
@@ -21,7 +21,7 @@ func TestBackoff_Update(t *testing.T) {
 	cleanupInterval := 5 * time.Second
 	maxBackoffAttempts := 10
 
-	b := newBackoff(ctx, size, cleanupInterval, maxBackoffAttempts)
+	b := newBackoff(ctx, size, cleanupInterval, MinBackoffDelay, MaxBackoffDelay, maxBackoffAttempts, realClock{})
 
 	if len(b.info) > 0 {
 		t.Fatal("non-empty info map for backoff")
@@ -88,7 +88,7 @@ func TestBackoff_Clean(t *testing.T) {
 	size := 10
 	cleanupInterval := 2 * time.Second
 	maxBackoffAttempts := 100 // setting attempts to a high number hence testing cleanup logic.
-	b := newBackoff(ctx, size, cleanupInterval, maxBackoffAttempts)
+	b := newBackoff(ctx, size, cleanupInterval, MinBackoffDelay, MaxBackoffDelay, maxBackoffAttempts, realClock{})
 
 	for i := 0; i < size; i++ {
 		id := peer.ID(fmt.Sprintf("peer-%d", i))
@@ -120,3 +120,49 @@ func TestBackoff_Clean(t *testing.T) {
 		t.Fatalf("info map size mismatch, expected: %d, got: %d", 1, len(b.info))
 	}
 }
+
+func TestStreamBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getGossipsubs(ctx, hosts, WithStreamBackoff(10*time.Millisecond, 20*time.Millisecond, 2))
+	for _, ps := range psubs {
+		mustSubscribe(t, ps, "test")
+	}
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(time.Second)
+
+	if _, ok := psubs[0].PeerBackoff(hosts[1].ID()); ok {
+		t.Fatal("expected no backoff state before the stream failures")
+	}
+
+	// the streams die while the peers stay connected, until the attempts are exhausted
+	for i := 0; i < 3; i++ {
+		for _, s := range pubsubStreams(hosts[0], hosts[1].ID()) {
+			s.Reset()
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	state, ok := psubs[0].PeerBackoff(hosts[1].ID())
+	if !ok || !state.Exhausted || state.Attempts != 2 {
+		t.Fatalf("expected an exhausted backoff, got %+v", state)
+	}
+	if peers := psubs[0].ListPeers("test"); len(peers) != 0 {
+		t.Fatalf("expected the peer to be left dead, got %v", peers)
+	}
+
+	// a new connection resets the backoff
+	hosts[0].Network().ClosePeer(hosts[1].ID())
+	time.Sleep(100 * time.Millisecond)
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(time.Second)
+
+	if _, ok := psubs[0].PeerBackoff(hosts[1].ID()); ok {
+		t.Fatal("expected the backoff to be reset by the new connection")
+	}
+	if peers := psubs[0].ListPeers("test"); len(peers) != 1 {
+		t.Fatalf("expected the peer to be back, got %v", peers)
+	}
+}
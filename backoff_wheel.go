@@ -0,0 +1,98 @@
+package pubsub
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// backoffBucketWidth is the span of expirations grouped in a bucket of the backoff wheel
+const backoffBucketWidth = time.Second
+
+// backoffWheel indexes the prune backoffs by expiration, in buckets of backoffBucketWidth, so that
+// the heartbeat clears the expired backoffs without scanning all of them
+type backoffWheel struct {
+	buckets map[int64][]backoffEntry
+	// next is the first bucket not cleared yet
+	next int64
+
+	// peak is the largest size of the backoff map of each topic since last reallocated, to
+	// reclaim its memory once it shrinks
+	peak map[string]int
+}
+
+type backoffEntry struct {
+	topic string
+	p     peer.ID
+}
+
+func newBackoffWheel() *backoffWheel {
+	return &backoffWheel{
+		buckets: make(map[int64][]backoffEntry),
+		peak:    make(map[string]int),
+	}
+}
+
+func bucketOf(t time.Time) int64 {
+	return t.UnixNano() / int64(backoffBucketWidth)
+}
+
+// add indexes a backoff of a peer in a topic to be cleared after the deadline; a backoff that
+// is refreshed is indexed again, and the stale entry is ignored once expired.
+func (w *backoffWheel) add(topic string, p peer.ID, deadline time.Time) {
+	b := bucketOf(deadline)
+	w.buckets[b] = append(w.buckets[b], backoffEntry{topic: topic, p: p})
+}
+
+// expire removes the buckets whose deadlines are all past now, calling f on their entries
+func (w *backoffWheel) expire(now time.Time, f func(backoffEntry)) {
+	last := bucketOf(now)
+	if last <= w.next {
+		return
+	}
+
+	if last-w.next > int64(len(w.buckets)) {
+		// a jump in time, or the first run: it's cheaper to walk the buckets
+		for b, entries := range w.buckets {
+			if b < last {
+				w.expireBucket(b, entries, f)
+			}
+		}
+	} else {
+		for b := w.next; b < last; b++ {
+			if entries, ok := w.buckets[b]; ok {
+				w.expireBucket(b, entries, f)
+			}
+		}
+	}
+	w.next = last
+}
+
+func (w *backoffWheel) expireBucket(b int64, entries []backoffEntry, f func(backoffEntry)) {
+	for _, e := range entries {
+		f(e)
+	}
+	delete(w.buckets, b)
+}
+
+// grown records the size of the backoff map of a topic as it grows
+func (w *backoffWheel) grown(topic string, size int) {
+	if size > w.peak[topic] {
+		w.peak[topic] = size
+	}
+}
+
+// shrunk returns whether the backoff map of a topic has shrunk enough since its peak to be
+// reallocated, or dropped if empty
+func (w *backoffWheel) shrunk(topic string, size int) bool {
+	switch peak := w.peak[topic]; {
+	case size == 0:
+		delete(w.peak, topic)
+		return true
+	case peak >= 128 && size < peak/4:
+		w.peak[topic] = size
+		return true
+	default:
+		return false
+	}
+}
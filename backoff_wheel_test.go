@@ -0,0 +1,144 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestBackoffExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := newMockClock()
+	clk.Set(time.Unix(1000, 0))
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getGossipsub(ctx, hosts[0], WithManualHeartbeat(), WithClock(clk))
+	gs := ps.rt.(*GossipSubRouter)
+
+	eval := func(f func()) {
+		done := make(chan struct{})
+		ps.eval <- func() {
+			f()
+			close(done)
+		}
+		<-done
+	}
+	advance := func(d time.Duration) {
+		clk.Add(d)
+		eval(gs.clearBackoff)
+	}
+	backedOff := func(topic string, p peer.ID) (ok bool) {
+		eval(func() { _, ok = gs.backoff[topic][p] })
+		return ok
+	}
+
+	eval(func() {
+		for i := 0; i < 200; i++ {
+			gs.doAddBackoff(peer.ID(fmt.Sprint("short-", i)), "test", 10*time.Second)
+		}
+		for i := 0; i < 10; i++ {
+			gs.doAddBackoff(peer.ID(fmt.Sprint("long-", i)), "test", time.Minute)
+		}
+		gs.doAddBackoff("refreshed", "test", 10*time.Second)
+		gs.doAddBackoff("other", "other", 10*time.Second)
+	})
+
+	advance(5 * time.Second)
+	eval(func() { gs.doAddBackoff("refreshed", "test", 10*time.Second) })
+
+	// backoffs are kept for the slack time after their expiration
+	advance(5 * time.Second)
+	if !backedOff("test", "short-0") {
+		t.Fatal("expected the backoff to be kept for the slack time")
+	}
+
+	advance(backoffSlack() + 2*backoffBucketWidth)
+	if backedOff("test", "short-0") || backedOff("other", "other") {
+		t.Fatal("expected the backoffs to be cleared")
+	}
+	if !backedOff("test", "refreshed") || !backedOff("test", "long-0") {
+		t.Fatal("expected the refreshed and longer backoffs to be kept")
+	}
+	eval(func() {
+		if _, ok := gs.backoff["other"]; ok {
+			t.Error("expected the emptied topic to be dropped")
+		}
+		if len(gs.backoff["test"]) != 11 || gs.expiry.peak["test"] >= 128 {
+			t.Errorf("expected the shrunk backoffs to be reallocated, got %d with a peak of %d",
+				len(gs.backoff["test"]), gs.expiry.peak["test"])
+		}
+	})
+
+	advance(time.Minute)
+	eval(func() {
+		if len(gs.backoff) != 0 || len(gs.expiry.buckets) != 0 || len(gs.expiry.peak) != 0 {
+			t.Errorf("expected all the backoffs to be cleared, got %v", gs.backoff)
+		}
+	})
+}
+
+// BenchmarkBackoffExpiry measures the cleanup of expired backoffs by a heartbeat, on 100k
+// backoffs across 100 topics expiring over a minute, each cleared backoff being added again.
+// The previous full scan of the backoffs took about 1.7ms here, every 15 heartbeats.
+func BenchmarkBackoffExpiry(b *testing.B) {
+	const entries, topics = 100000, 100
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := newMockClock()
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer h.Close()
+	ps := getGossipsub(ctx, h, WithManualHeartbeat(), WithClock(clk))
+	gs := ps.rt.(*GossipSubRouter)
+
+	eval := func(f func()) {
+		done := make(chan struct{})
+		ps.eval <- func() {
+			f()
+			close(done)
+		}
+		<-done
+	}
+
+	eval(func() {
+		for i := 0; i < entries; i++ {
+			topic := fmt.Sprint("topic-", i%topics)
+			gs.doAddBackoff(peer.ID(fmt.Sprint("peer-", i)), topic, time.Duration(i%60)*time.Second)
+		}
+		gs.clearBackoff()
+	})
+
+	names := make([]string, topics)
+	for i := range names {
+		names[i] = fmt.Sprint("topic-", i)
+	}
+
+	// the churn dominates, so the cleanup is timed apart
+	var cleanup time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clk.Add(time.Second)
+		eval(func() {
+			start := time.Now()
+			gs.clearBackoff()
+			cleanup += time.Since(start)
+
+			// churn: the cleared backoffs are added again
+			for _, topic := range names {
+				for j := len(gs.backoff[topic]); j < entries/topics; j++ {
+					gs.doAddBackoff(peer.ID(fmt.Sprint("peer-", i, "-", j)), topic, time.Minute)
+				}
+			}
+		})
+	}
+	b.ReportMetric(float64(cleanup.Nanoseconds())/float64(b.N), "ns/cleanup")
+}
@@ -0,0 +1,216 @@
+package pubsub
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+// BandwidthRateWindow is the window over which the byte rates of PeerBandwidth are measured.
+var BandwidthRateWindow = time.Second
+
+// WithPeerOutboundBandwidthCap caps the bytes per second sent to each peer, allowing bursts of up
+// to a second worth of bytes. Once a peer exceeds the cap, the messages forwarded to it are skipped
+// until the bucket refills; control messages, subscriptions and the messages we author always go
+// through, and count towards the cap. Skipped messages are reported to raw tracers implementing
+// BandwidthCapTracer.
+func WithPeerOutboundBandwidthCap(bytesPerSecond int) Option {
+	return func(p *PubSub) error {
+		if bytesPerSecond <= 0 {
+			return fmt.Errorf("invalid outbound bandwidth cap")
+		}
+		p.peerOutboundCap = bytesPerSecond
+		return nil
+	}
+}
+
+// BandwidthCapTracer is an optional interface for RawTracers, which is invoked when messages
+// forwarded to a peer are skipped for exceeding the outbound bandwidth cap.
+// It is invoked from the stream writing goroutine of the peer.
+type BandwidthCapTracer interface {
+	BandwidthCapExceeded(p peer.ID, skipped []*pb.Message)
+}
+
+// PeerBandwidth is the recent traffic with a peer, in bytes per second on the wire.
+type PeerBandwidth struct {
+	In  float64
+	Out float64
+}
+
+// PeerBandwidth returns the recent traffic with a peer, over the last BandwidthRateWindow or two.
+// It is zero for peers without a stream.
+func (p *PubSub) PeerBandwidth(pid peer.ID) PeerBandwidth {
+	p.bandwidthMx.Lock()
+	bw, ok := p.bandwidth[pid]
+	p.bandwidthMx.Unlock()
+	if !ok {
+		return PeerBandwidth{}
+	}
+
+	bw.mx.Lock()
+	defer bw.mx.Unlock()
+
+	now := p.clock.Now()
+	return PeerBandwidth{In: bw.in.rate(now), Out: bw.out.rate(now)}
+}
+
+// peerBandwidth is the traffic accounting of a peer, shared by its stream goroutines
+type peerBandwidth struct {
+	mx   sync.Mutex
+	refs int
+	in   byteRate
+	out  byteRate
+
+	// outbound token bucket, if capped
+	tokens float64
+	last   time.Time
+}
+
+// acquireBandwidth returns the traffic accounting of a peer, for a stream goroutine of the peer
+// which must release it once done
+func (p *PubSub) acquireBandwidth(pid peer.ID) *peerBandwidth {
+	p.bandwidthMx.Lock()
+	defer p.bandwidthMx.Unlock()
+
+	bw, ok := p.bandwidth[pid]
+	if !ok {
+		bw = &peerBandwidth{tokens: float64(p.peerOutboundCap), last: p.clock.Now()}
+		p.bandwidth[pid] = bw
+	}
+	bw.refs++
+	return bw
+}
+
+func (p *PubSub) releaseBandwidth(pid peer.ID, bw *peerBandwidth) {
+	p.bandwidthMx.Lock()
+	defer p.bandwidthMx.Unlock()
+
+	bw.refs--
+	if bw.refs == 0 && p.bandwidth[pid] == bw {
+		delete(p.bandwidth, pid)
+	}
+}
+
+func (p *PubSub) accountIn(bw *peerBandwidth, size int) {
+	p.stats.rpcsIn.Add(1)
+	p.stats.bytesIn.Add(uint64(size))
+
+	bw.mx.Lock()
+	defer bw.mx.Unlock()
+
+	bw.in.add(p.clock.Now(), size)
+}
+
+func (p *PubSub) accountOut(bw *peerBandwidth, size int) {
+	p.stats.rpcsOut.Add(1)
+	p.stats.bytesOut.Add(uint64(size))
+
+	bw.mx.Lock()
+	defer bw.mx.Unlock()
+
+	bw.out.add(p.clock.Now(), size)
+	if p.peerOutboundCap > 0 {
+		bw.tokens -= float64(size)
+	}
+}
+
+// overCap returns whether the peer exceeded the outbound bandwidth cap
+func (p *PubSub) overCap(bw *peerBandwidth) bool {
+	if p.peerOutboundCap == 0 {
+		return false
+	}
+
+	bw.mx.Lock()
+	defer bw.mx.Unlock()
+
+	now := p.clock.Now()
+	rate := float64(p.peerOutboundCap)
+	bw.tokens += now.Sub(bw.last).Seconds() * rate
+	if bw.tokens > rate {
+		bw.tokens = rate
+	}
+	bw.last = now
+
+	return bw.tokens <= 0
+}
+
+// capOutbound returns the RPC to send to a peer over the outbound bandwidth cap, without the
+// messages we forward; it returns nil if nothing is left to send
+func (p *PubSub) capOutbound(pid peer.ID, rpc *RPC) *RPC {
+	var kept, skipped []*pb.Message
+	for i, msg := range rpc.GetPublish() {
+		if p.ownMessage(rpc, i) {
+			kept = append(kept, msg)
+		} else {
+			skipped = append(skipped, msg)
+		}
+	}
+	if len(skipped) == 0 {
+		return rpc
+	}
+
+	log.Debugf("skipping %d messages to %s over the outbound bandwidth cap", len(skipped), pid)
+	p.tracer.BandwidthCapExceeded(pid, skipped)
+
+	// the RPC may be shared with other peers
+	out := &RPC{RPC: pb.RPC{
+		Subscriptions: rpc.Subscriptions,
+		Publish:       kept,
+		Control:       rpc.Control,
+	}, wire: rpc.wire}
+	if len(out.Subscriptions) == 0 && len(out.Publish) == 0 && out.Control == nil {
+		return nil
+	}
+	return out
+}
+
+// ownMessage returns whether the i-th message of an RPC was published by us, which is known
+// from the message it is sent from even if the messages are unsigned
+func (p *PubSub) ownMessage(rpc *RPC, i int) bool {
+	if len(rpc.origins) == len(rpc.Publish) && rpc.origins[i].ReceivedFrom == p.host.ID() {
+		return true
+	}
+	return p.signID != "" && peer.ID(rpc.Publish[i].GetFrom()) == p.signID
+}
+
+// byteRate measures a byte rate over the current and previous windows
+type byteRate struct {
+	start     time.Time
+	cur, prev int
+}
+
+func (r *byteRate) advance(now time.Time) {
+	if r.start.IsZero() {
+		r.start = now
+		return
+	}
+	elapsed := now.Sub(r.start)
+	if elapsed < BandwidthRateWindow {
+		return
+	}
+	if elapsed < 2*BandwidthRateWindow {
+		r.prev = r.cur
+	} else {
+		r.prev = 0
+	}
+	r.cur = 0
+	r.start = r.start.Add(elapsed.Truncate(BandwidthRateWindow))
+}
+
+func (r *byteRate) add(now time.Time, n int) {
+	r.advance(now)
+	r.cur += n
+}
+
+func (r *byteRate) rate(now time.Time) float64 {
+	r.advance(now)
+	if r.start.IsZero() {
+		return 0
+	}
+	d := BandwidthRateWindow + now.Sub(r.start)
+	return float64(r.prev+r.cur) / d.Seconds()
+}
@@ -0,0 +1,112 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+type bandwidthCapTracer struct {
+	noopRawTracer
+	skipped atomic.Int64
+}
+
+func (t *bandwidthCapTracer) BandwidthCapExceeded(p peer.ID, skipped []*pb.Message) {
+	t.skipped.Add(int64(len(skipped)))
+}
+
+func TestPeerOutboundBandwidthCap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	tracer := &bandwidthCapTracer{}
+	psubs := []*PubSub{
+		getGossipsub(ctx, hosts[0]),
+		getGossipsub(ctx, hosts[1], WithPeerOutboundBandwidthCap(4096), WithRawTracer(tracer)),
+		getGossipsub(ctx, hosts[2]),
+	}
+
+	var subs []*Subscription
+	for _, ps := range psubs {
+		subs = append(subs, mustSubscribe(t, ps, "test"))
+	}
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[1], hosts[2])
+	time.Sleep(2 * time.Second)
+
+	// the messages forwarded by the capped peer are skipped once the cap is exceeded
+	const count = 20
+	for i := 0; i < count; i++ {
+		msg := append(bytes.Repeat([]byte{'x'}, 1024), byte(i))
+		if err := psubs[0].Publish("test", msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < count; i++ {
+		if _, err := subs[1].Next(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	received := 0
+	for {
+		rctx, rcancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		_, err := subs[2].Next(rctx)
+		rcancel()
+		if err != nil {
+			break
+		}
+		received++
+	}
+	if received == 0 || received >= count {
+		t.Fatalf("expected some of the messages to be skipped, got %d of %d", received, count)
+	}
+	if tracer.skipped.Load() == 0 {
+		t.Fatal("expected the skipped messages to be traced")
+	}
+
+	// the messages of the capped peer go through
+	if err := psubs[1].Publish("test", []byte("own")); err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, subs[2], []byte("own"))
+
+	out := psubs[1].PeerBandwidth(hosts[2].ID())
+	if out.Out == 0 {
+		t.Fatal("expected outbound traffic to be measured")
+	}
+	in := psubs[2].PeerBandwidth(hosts[1].ID())
+	if in.In == 0 {
+		t.Fatal("expected inbound traffic to be measured")
+	}
+	if bw := psubs[1].PeerBandwidth(peer.ID("unknown")); bw != (PeerBandwidth{}) {
+		t.Fatalf("expected no traffic for an unknown peer, got %+v", bw)
+	}
+}
+
+func TestCapOutboundUnsigned(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getGossipsub(ctx, hosts[0], WithNoAuthor(), WithPeerOutboundBandwidthCap(4096))
+
+	// without an author, our own messages are known from the messages they are sent from
+	own := &Message{Message: &pb.Message{Data: []byte("own")}, ReceivedFrom: hosts[0].ID()}
+	forwarded := &Message{Message: &pb.Message{Data: []byte("forwarded")}, ReceivedFrom: peer.ID("other")}
+	rpc := rpcWithMessages(own.Message, forwarded.Message)
+	rpc.origins = []*Message{own, forwarded}
+
+	out := ps.capOutbound(peer.ID("peer"), rpc)
+	if out == nil || len(out.Publish) != 1 || string(out.Publish[0].Data) != "own" {
+		t.Fatalf("expected only our own message to be kept, got %v", out)
+	}
+}
@@ -0,0 +1,46 @@
+package pubsub
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// WithBestEffort makes the delivery of the messages of a Topic best effort, for low value
+// traffic that is better dropped than queued: the messages are not sent to the peers with more
+// than watermark RPCs waiting in their outbound queue, neither pushed nor in answer to IWANT
+// requests, and they are not gossiped to those peers. The skipped sends are counted in the
+// BestEffortSkipped stats of the topic.
+func WithBestEffort(watermark int) TopicOpt {
+	return func(t *Topic) error {
+		if watermark < 0 {
+			return fmt.Errorf("invalid best effort watermark: %d", watermark)
+		}
+		t.bestEffort = true
+		t.bestEffortWatermark = watermark
+		return nil
+	}
+}
+
+// bestEffortBusy returns whether the topic is best effort and the outbound queue of the peer is
+// above the watermark.
+// Only called from processLoop.
+func (p *PubSub) bestEffortBusy(pid peer.ID, topic string) bool {
+	t, ok := p.myTopics[topic]
+	if !ok || !t.bestEffort {
+		return false
+	}
+	return p.outboundBacklog(pid) > t.bestEffortWatermark
+}
+
+// skipsBestEffort returns whether a message of a topic is not to be sent to a peer, for the
+// topic is best effort and the outbound queue of the peer is above the watermark, counting the
+// skipped send.
+// Only called from processLoop.
+func (p *PubSub) skipsBestEffort(pid peer.ID, topic string) bool {
+	if !p.bestEffortBusy(pid, topic) {
+		return false
+	}
+	p.stats.topic(topic).bestEffortSkipped.Add(1)
+	return true
+}
@@ -0,0 +1,102 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestBestEffort(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	busy, idle := peer.ID("busy"), peer.ID("idle")
+	ps, gs, eval := chokeTestRouter(t, ctx, DefaultGossipSubParams(), map[peer.ID]protocol.ID{
+		busy: GossipSubID_v11,
+		idle: GossipSubID_v11,
+	})
+
+	topic, err := ps.Join("test", WithBestEffort(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	eval(func() {
+		for i := 0; i < 3; i++ {
+			ps.peers[busy] <- &RPC{}
+		}
+	})
+
+	if err := topic.Publish(ctx, []byte("telemetry")); err != nil {
+		t.Fatal(err)
+	}
+	var busyQueued, idleQueued int
+	for start := time.Now(); idleQueued == 0 && time.Since(start) < time.Second; {
+		time.Sleep(10 * time.Millisecond)
+		eval(func() {
+			busyQueued, idleQueued = len(ps.peers[busy]), len(ps.peers[idle])
+		})
+	}
+	if busyQueued != 3 || idleQueued != 1 {
+		t.Fatalf("expected the message sent to the idle peer only, got %d and %d RPCs queued", busyQueued, idleQueued)
+	}
+	if skipped := ps.Stats().Topics["test"].BestEffortSkipped; skipped != 1 {
+		t.Fatalf("expected 1 skipped send, got %d", skipped)
+	}
+
+	// the IWANTs for the messages of the topic are answered below the watermark only
+	var mids []string
+	var busyAnswer, idleAnswer []*Message
+	eval(func() {
+		mids = gs.mcache.GetGossipIDs("test")
+		iwant := &pb.ControlMessage{Iwant: []*pb.ControlIWant{{MessageIDs: mids}}}
+		busyAnswer = gs.handleIWant(busy, iwant)
+		idleAnswer = gs.handleIWant(idle, iwant)
+	})
+	if len(mids) != 1 {
+		t.Fatalf("expected the message in the cache, got %d", len(mids))
+	}
+	if len(busyAnswer) != 0 || len(idleAnswer) != 1 {
+		t.Fatalf("expected the IWANT of the idle peer only answered, got %d and %d messages", len(busyAnswer), len(idleAnswer))
+	}
+
+	// and the busy peers get no gossip, as their IWANTs would not be answered
+	eval(func() {
+		gs.emitGossip("test", nil, func(peer.ID) float64 { return 0 })
+		if _, ok := gs.gossip[busy]; ok {
+			t.Error("expected no gossip for the busy peer")
+		}
+		if _, ok := gs.gossip[idle]; !ok {
+			t.Error("expected gossip for the idle peer")
+		}
+	})
+
+	// the priority lanes count in the backlog of a peer
+	eval(func() {
+		for len(ps.peers[busy]) > 0 {
+			<-ps.peers[busy]
+		}
+		lanes := &outboundLanes{high: make(chan *RPC, 8), low: make(chan *RPC, 8)}
+		ps.lanes[busy] = lanes
+		for i := 0; i < 3; i++ {
+			lanes.low <- &RPC{}
+		}
+		if !ps.bestEffortBusy(busy, "test") {
+			t.Error("expected the RPCs in the lanes to count in the backlog")
+		}
+	})
+}
+
+func TestBestEffortValidation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ps := getPubsub(ctx, getNetHosts(t, ctx, 1)[0])
+	if _, err := ps.Join("test", WithBestEffort(-1)); err == nil {
+		t.Fatal("expected an error for a negative watermark")
+	}
+}
@@ -0,0 +1,183 @@
+package pubsub
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// BidiProtocolSuffix is appended to the router protocol IDs to negotiate bidirectional streams.
+const BidiProtocolSuffix = "/bidi"
+
+// BidiStreamWaitTimeout is how long a peer waits for the bidirectional stream of a peer expected to
+// open it, before falling back to opening its own stream.
+var BidiStreamWaitTimeout = 5 * time.Second
+
+// WithBidirectionalStreams makes the pubsub instance use a single bidirectional stream with the
+// peers that support it, instead of a stream in each direction, halving the number of streams.
+// The stream is opened by the peer with the lowest ID; the other peer writes to it once received.
+// Peers that don't support bidirectional streams keep using a stream in each direction.
+func WithBidirectionalStreams() Option {
+	return func(p *PubSub) error {
+		p.bidi = &bidiStreams{offers: make(map[peer.ID]*bidiOffer)}
+		return nil
+	}
+}
+
+// bidiStreams matches the inbound bidirectional streams with the writers waiting for them
+type bidiStreams struct {
+	mx     sync.Mutex
+	offers map[peer.ID]*bidiOffer
+}
+
+// bidiOffer is an inbound bidirectional stream of a peer, or the wait for one
+type bidiOffer struct {
+	ch chan *bidiStream
+}
+
+// bidiStream is an inbound bidirectional stream, which is claimed by the writer of the peer
+type bidiStream struct {
+	s       network.Stream
+	claimed atomic.Bool
+}
+
+func (b *bidiStreams) getOffer(pid peer.ID) *bidiOffer {
+	o, ok := b.offers[pid]
+	if !ok {
+		o = &bidiOffer{ch: make(chan *bidiStream, 1)}
+		b.offers[pid] = o
+	}
+	return o
+}
+
+// offer makes an inbound bidirectional stream available to the writer of the peer
+func (b *bidiStreams) offer(pid peer.ID, bs *bidiStream) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	o := b.getOffer(pid)
+	// replace a stale stream that was never claimed
+	select {
+	case <-o.ch:
+	default:
+	}
+	o.ch <- bs
+}
+
+// decline notifies the writer of the peer, waiting or about to wait for a bidirectional stream,
+// that the peer opened a unidirectional stream instead
+func (b *bidiStreams) decline(pid peer.ID) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	o := b.getOffer(pid)
+	select {
+	case <-o.ch:
+	default:
+	}
+	o.ch <- nil
+}
+
+// withdraw drops the offer of a stream that was never claimed, or the decline if bs is nil
+func (b *bidiStreams) withdraw(pid peer.ID, bs *bidiStream) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	o, ok := b.offers[pid]
+	if !ok {
+		return
+	}
+	select {
+	case other := <-o.ch:
+		if other != bs {
+			o.ch <- other
+			return
+		}
+	default:
+	}
+	delete(b.offers, pid)
+}
+
+// claim waits for an inbound bidirectional stream of the peer, returning nil if none arrives
+// before the timeout or the peer opens a unidirectional stream
+func (b *bidiStreams) claim(ctx context.Context, pid peer.ID, clock Clock) network.Stream {
+	b.mx.Lock()
+	o := b.getOffer(pid)
+	b.mx.Unlock()
+
+	defer func() {
+		b.mx.Lock()
+		if b.offers[pid] == o {
+			delete(b.offers, pid)
+		}
+		b.mx.Unlock()
+	}()
+
+	timeout := clock.After(BidiStreamWaitTimeout)
+	for {
+		select {
+		case bs := <-o.ch:
+			if bs == nil {
+				return nil
+			}
+			if bs.claimed.CompareAndSwap(false, true) {
+				return bs.s
+			}
+		case <-timeout:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// isBidiProtocol returns whether a protocol ID negotiates a bidirectional stream
+func isBidiProtocol(id protocol.ID) bool {
+	return strings.HasSuffix(string(trimCompression(id)), BidiProtocolSuffix)
+}
+
+// routerProtocol returns the router protocol ID of a stream protocol ID
+func routerProtocol(id protocol.ID) protocol.ID {
+	id = protocol.ID(strings.TrimSuffix(string(id), ControlProtocolSuffix))
+	return protocol.ID(strings.TrimSuffix(string(trimCompression(id)), BidiProtocolSuffix))
+}
+
+// dialsBidi returns whether we open the bidirectional stream with a peer, rather than waiting
+// for the peer to open it
+func (p *PubSub) dialsBidi(pid peer.ID) bool {
+	return p.host.ID() < pid
+}
+
+// expectsBidi returns whether a peer is expected to open a bidirectional stream with us; peers
+// whose protocols aren't known yet may, until they open a unidirectional stream
+func (p *PubSub) expectsBidi(pid peer.ID) bool {
+	if p.dialsBidi(pid) {
+		return false
+	}
+	known, err := p.host.Peerstore().GetProtocols(pid)
+	if err != nil || len(known) == 0 {
+		return true
+	}
+	var bidiProtos []protocol.ID
+	for _, id := range p.streamProtocols(true) {
+		if isBidiProtocol(id) {
+			bidiProtos = append(bidiProtos, id)
+		}
+	}
+	protos, err := p.host.Peerstore().SupportsProtocols(pid, bidiProtos...)
+	return err == nil && len(protos) > 0
+}
+
+// handleBidiStream reads the RPCs of a bidirectional stream that is also written to, declaring
+// the peer dead once the stream is closed or reset in either direction
+func (p *PubSub) handleBidiStream(s network.Stream) {
+	p.readRPCs(s)
+	s.Reset()
+	p.notifyPeerDead(s.Conn().RemotePeer())
+}
@@ -0,0 +1,115 @@
+package pubsub
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// pubsubStreams returns the pubsub streams between a host and a peer
+func pubsubStreams(h host.Host, p peer.ID) []network.Stream {
+	var res []network.Stream
+	for _, c := range h.Network().ConnsToPeer(p) {
+		for _, s := range c.GetStreams() {
+			if strings.HasPrefix(string(s.Protocol()), "/meshsub/") {
+				res = append(res, s)
+			}
+		}
+	}
+	return res
+}
+
+func TestBidirectionalStreams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getGossipsubs(ctx, hosts, WithBidirectionalStreams())
+
+	var subs []*Subscription
+	for _, ps := range psubs {
+		subs = append(subs, mustSubscribe(t, ps, "test"))
+	}
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(2 * time.Second)
+
+	for i := range hosts {
+		streams := pubsubStreams(hosts[i], hosts[1-i].ID())
+		if len(streams) != 1 || !isBidiProtocol(streams[0].Protocol()) {
+			t.Fatalf("expected a single bidirectional stream, got %d", len(streams))
+		}
+	}
+
+	// messages flow in both directions
+	for i, ps := range psubs {
+		if err := ps.Publish("test", []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		assertReceive(t, subs[1-i], []byte("hello"))
+		assertReceive(t, subs[i], []byte("hello"))
+	}
+
+	// resetting the stream declares the peer dead on both sides, and a new stream is opened
+	pubsubStreams(hosts[0], hosts[1].ID())[0].Reset()
+	time.Sleep(3 * time.Second)
+
+	for i := range hosts {
+		if streams := pubsubStreams(hosts[i], hosts[1-i].ID()); len(streams) != 1 {
+			t.Fatalf("expected a single stream after the reset, got %d", len(streams))
+		}
+	}
+	for i, ps := range psubs {
+		if err := ps.Publish("test", []byte("again")); err != nil {
+			t.Fatal(err)
+		}
+		assertReceive(t, subs[1-i], []byte("again"))
+		assertReceive(t, subs[i], []byte("again"))
+	}
+}
+
+func TestBidirectionalStreamsFallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	psubs := []*PubSub{
+		getGossipsub(ctx, hosts[0], WithBidirectionalStreams()),
+		getGossipsub(ctx, hosts[1]),
+		getGossipsub(ctx, hosts[2]),
+	}
+
+	var subs []*Subscription
+	for _, ps := range psubs {
+		subs = append(subs, mustSubscribe(t, ps, "test"))
+	}
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[2], hosts[0])
+	time.Sleep(2 * time.Second)
+
+	// peers without bidirectional streams keep a stream in each direction
+	for _, h := range hosts[1:] {
+		streams := pubsubStreams(hosts[0], h.ID())
+		if len(streams) != 2 {
+			t.Fatalf("expected two streams, got %d", len(streams))
+		}
+		for _, s := range streams {
+			if isBidiProtocol(s.Protocol()) {
+				t.Fatal("unexpected bidirectional stream")
+			}
+		}
+	}
+
+	for _, ps := range psubs {
+		if err := ps.Publish("test", []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		for _, sub := range subs {
+			assertReceive(t, sub, []byte("hello"))
+		}
+	}
+}
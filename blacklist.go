@@ -14,6 +14,28 @@ type Blacklist interface {
 	Contains(peer.ID) bool
 }
 
+// RemovableBlacklist is an optional interface for blacklists that support removing peers,
+// which is required by PubSub.UnblacklistPeer.
+type RemovableBlacklist interface {
+	Blacklist
+	Remove(peer.ID)
+}
+
+// EnumerableBlacklist is an optional interface for blacklists that can list their peers,
+// which is required by PubSub.BlacklistedPeers.
+type EnumerableBlacklist interface {
+	Blacklist
+	List() []peer.ID
+}
+
+// TTLBlacklist is an optional interface for blacklists that support entries with an expiry.
+// The peers blacklisted with PubSub.BlacklistPeerFor, including the automatic blacklistings, are
+// also added to such a blacklist, so that a persistent one keeps them across restarts.
+type TTLBlacklist interface {
+	Blacklist
+	AddWithTTL(p peer.ID, ttl time.Duration) bool
+}
+
 // MapBlacklist is a blacklist implementation using a perfect map
 type MapBlacklist map[peer.ID]struct{}
 
@@ -32,15 +54,31 @@ func (b MapBlacklist) Contains(p peer.ID) bool {
 	return ok
 }
 
+func (b MapBlacklist) Remove(p peer.ID) {
+	delete(b, p)
+}
+
+func (b MapBlacklist) List() []peer.ID {
+	peers := make([]peer.ID, 0, len(b))
+	for p := range b {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
 // TimeCachedBlacklist is a blacklist implementation using a time cache
 type TimeCachedBlacklist struct {
-	tc timecache.TimeCache
+	tc  *timecache.FirstSeenCache
+	now func() time.Time
 }
 
 // NewTimeCachedBlacklist creates a new TimeCachedBlacklist with the given expiry duration
 func NewTimeCachedBlacklist(expiry time.Duration) (Blacklist, error) {
-	b := &TimeCachedBlacklist{tc: timecache.NewTimeCache(expiry)}
-	return b, nil
+	return newTimeCachedBlacklist(expiry, time.Now), nil
+}
+
+func newTimeCachedBlacklist(expiry time.Duration, now func() time.Time) *TimeCachedBlacklist {
+	return &TimeCachedBlacklist{tc: timecache.NewFirstSeenCache(expiry, now), now: now}
 }
 
 // Add returns a bool saying whether Add of peer was successful
@@ -56,3 +94,53 @@ func (b *TimeCachedBlacklist) Add(p peer.ID) bool {
 func (b *TimeCachedBlacklist) Contains(p peer.ID) bool {
 	return b.tc.Has(p.String())
 }
+
+func (b *TimeCachedBlacklist) Remove(p peer.ID) {
+	b.tc.Remove(p.String())
+}
+
+func (b *TimeCachedBlacklist) List() []peer.ID {
+	keys := b.tc.Keys()
+	peers := make([]peer.ID, 0, len(keys))
+	for _, s := range keys {
+		p, err := peer.Decode(s)
+		if err != nil {
+			continue
+		}
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// AddWithTTL blacklists a peer for the given duration in place of the blacklist expiry,
+// extending its entry if it expires earlier. Returns whether the peer was newly added.
+func (b *TimeCachedBlacklist) AddWithTTL(p peer.ID, ttl time.Duration) bool {
+	return b.tc.AddWithTTL(p.String(), ttl)
+}
+
+// Remaining returns how long the peer remains blacklisted; 0 if it isn't blacklisted.
+func (b *TimeCachedBlacklist) Remaining(p peer.ID) time.Duration {
+	expiry, ok := b.tc.Expiry(p.String())
+	if !ok {
+		return 0
+	}
+	return expiry.Sub(b.now())
+}
+
+// OnExpire registers a callback, which is invoked with the peers whose blacklisting expired.
+// Expired entries are swept periodically, so the callback may be invoked some time after the
+// expiry.
+func (b *TimeCachedBlacklist) OnExpire(fn func(p peer.ID)) {
+	b.tc.OnExpire(func(s string) {
+		p, err := peer.Decode(s)
+		if err != nil {
+			return
+		}
+		fn(p)
+	})
+}
+
+// sweep removes the expired entries, invoking the expiry callbacks
+func (b *TimeCachedBlacklist) sweep() {
+	b.tc.Sweep()
+}
@@ -0,0 +1,93 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// BlacklistEventType is the type of a blacklist event.
+type BlacklistEventType int
+
+const (
+	// PeerBlacklisted is emitted when a peer is added to the blacklist.
+	PeerBlacklisted BlacklistEventType = iota
+	// PeerUnblacklisted is emitted when a peer is removed from the blacklist with UnblacklistPeer.
+	PeerUnblacklisted
+	// PeerBlacklistExpired is emitted when the blacklisting of a peer expires.
+	PeerBlacklistExpired
+)
+
+// Reasons of blacklist events.
+const (
+	BlacklistReasonManual  = "manual"
+	BlacklistReasonAuto    = "auto blacklist rule"
+	BlacklistReasonRemoved = "unblacklisted"
+	BlacklistReasonExpired = "expired"
+)
+
+// BlacklistEvent describes a change in the blacklist.
+type BlacklistEvent struct {
+	Type BlacklistEventType
+	Peer peer.ID
+	// Reason is one of the named strings BlacklistReason*, followed by the reject reason of the
+	// tripped rule for auto blacklisting.
+	Reason string
+	// Expiry is when the blacklisting expires; it is zero for permanent blacklisting and for
+	// events other than PeerBlacklisted.
+	Expiry time.Time
+}
+
+// BlacklistTracer is an optional interface for RawTracers, which is invoked when a peer is
+// added to, removed from, or expires from the blacklist.
+type BlacklistTracer interface {
+	BlacklistChanged(evt BlacklistEvent)
+}
+
+// blacklistEventSubs holds the channels of BlacklistEvents
+type blacklistEventSubs struct {
+	mx   sync.Mutex
+	subs map[chan BlacklistEvent]struct{}
+}
+
+// BlacklistEvents returns a channel of blacklist events with the given buffer size, which is
+// closed when the context is done. Events are dropped when the buffer is full, so that a slow
+// consumer doesn't hold up the pubsub instance.
+func (p *PubSub) BlacklistEvents(ctx context.Context, size int) <-chan BlacklistEvent {
+	ch := make(chan BlacklistEvent, size)
+
+	p.blacklistEvts.mx.Lock()
+	p.blacklistEvts.subs[ch] = struct{}{}
+	p.blacklistEvts.mx.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-p.ctx.Done():
+		}
+
+		p.blacklistEvts.mx.Lock()
+		delete(p.blacklistEvts.subs, ch)
+		close(ch)
+		p.blacklistEvts.mx.Unlock()
+	}()
+
+	return ch
+}
+
+func (p *PubSub) notifyBlacklistEvent(evt BlacklistEvent) {
+	p.tracer.BlacklistChanged(evt)
+
+	p.blacklistEvts.mx.Lock()
+	defer p.blacklistEvts.mx.Unlock()
+
+	for ch := range p.blacklistEvts.subs {
+		select {
+		case ch <- evt:
+		default:
+			log.Debugf("blacklist event channel full; dropping event for %s", evt.Peer)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package pubsub
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
@@ -123,3 +124,204 @@ func TestBlacklist3(t *testing.T) {
 		t.Fatal("got message from blacklisted peer")
 	}
 }
+
+func TestBlacklistPeerFor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := newMockClock()
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := []*PubSub{
+		getPubsub(ctx, hosts[0]),
+		getPubsub(ctx, hosts[1], WithClock(clk)),
+	}
+	connect(t, hosts[0], hosts[1])
+
+	sub, err := psubs[1].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	psubs[1].BlacklistPeerFor(hosts[0].ID(), time.Minute)
+	if remaining, ok := psubs[1].BlacklistTimeRemaining(hosts[0].ID()); !ok || remaining != time.Minute {
+		t.Fatalf("expected the peer to be blacklisted for a minute, got %s", remaining)
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	psubs[0].Publish("test", []byte("blacklisted"))
+	assertNeverReceives(t, sub, time.Second)
+
+	// the peer is accepted again once the blacklisting expires
+	clk.Add(2 * time.Minute)
+	if _, ok := psubs[1].BlacklistTimeRemaining(hosts[0].ID()); ok {
+		t.Fatal("expected the blacklisting to expire")
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	psubs[0].Publish("test", []byte("forgiven"))
+	assertReceive(t, sub, []byte("forgiven"))
+
+	psubs[1].BlacklistPeer(hosts[0].ID())
+	if remaining, ok := psubs[1].BlacklistTimeRemaining(hosts[0].ID()); !ok || remaining != 0 {
+		t.Fatalf("expected the peer to be blacklisted permanently, got %s", remaining)
+	}
+}
+
+// addOnlyBlacklist hides the optional methods of the wrapped blacklist
+type addOnlyBlacklist struct {
+	Blacklist
+}
+
+func TestUnblacklistPeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	psubs := getPubsubs(ctx, hosts)
+	connectAll(t, hosts)
+
+	sub, err := psubs[0].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	psubs[0].BlacklistPeer(hosts[1].ID())
+	psubs[0].BlacklistPeerFor(hosts[2].ID(), time.Hour)
+	if peers := psubs[0].BlacklistedPeers(); len(peers) != 2 {
+		t.Fatalf("expected 2 blacklisted peers, got %v", peers)
+	}
+
+	graylisted := make(chan bool, 1)
+	psubs[0].eval <- func() { psubs[0].subLimits.Graylist(hosts[1].ID()) }
+
+	if err := psubs[0].UnblacklistPeer(hosts[1].ID(), WithClearPeerState()); err != nil {
+		t.Fatal(err)
+	}
+	psubs[0].eval <- func() { graylisted <- psubs[0].subLimits.Graylisted(hosts[1].ID()) }
+	if <-graylisted {
+		t.Fatal("expected the graylisting to be cleared")
+	}
+
+	peers := psubs[0].BlacklistedPeers()
+	if len(peers) != 1 || peers[0] != hosts[2].ID() {
+		t.Fatalf("expected only the timed blacklisting to remain, got %v", peers)
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	psubs[1].Publish("test", []byte("unblacklisted"))
+	assertReceive(t, sub, []byte("unblacklisted"))
+
+	psubs[2].Publish("test", []byte("blacklisted"))
+	assertNeverReceives(t, sub, time.Second)
+
+	if err := psubs[0].UnblacklistPeer(hosts[2].ID()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 100)
+	psubs[2].Publish("test", []byte("also unblacklisted"))
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the earlier message may be relayed by the other peer
+		if string(msg.Data) == "blacklisted" {
+			continue
+		}
+		if string(msg.Data) != "also unblacklisted" {
+			t.Fatalf("unexpected message: %s", msg.Data)
+		}
+		break
+	}
+
+	// the peers in a blacklist without removal can't be unblacklisted
+	ps := getPubsub(ctx, getNetHosts(t, ctx, 1)[0], WithBlacklist(addOnlyBlacklist{NewMapBlacklist()}))
+	ps.BlacklistPeer(hosts[0].ID())
+	if err := ps.UnblacklistPeer(hosts[0].ID()); err != ErrBlacklistNotRemovable {
+		t.Fatalf("expected ErrBlacklistNotRemovable, got %v", err)
+	}
+}
+
+type blacklistTracer struct {
+	noopRawTracer
+
+	mx     sync.Mutex
+	events []BlacklistEvent
+}
+
+func (t *blacklistTracer) BlacklistChanged(evt BlacklistEvent) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.events = append(t.events, evt)
+}
+
+func TestBlacklistEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := newMockClock()
+	tracer := &blacklistTracer{}
+	hosts := getNetHosts(t, ctx, 3)
+	ps := getPubsub(ctx, hosts[0], WithClock(clk), WithRawTracer(tracer))
+	evts := ps.BlacklistEvents(ctx, 10)
+
+	nextEvent := func() BlacklistEvent {
+		t.Helper()
+		select {
+		case evt := <-evts:
+			return evt
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for a blacklist event")
+			return BlacklistEvent{}
+		}
+	}
+
+	ps.BlacklistPeer(hosts[1].ID())
+	evt := nextEvent()
+	if evt.Type != PeerBlacklisted || evt.Peer != hosts[1].ID() || evt.Reason != BlacklistReasonManual || !evt.Expiry.IsZero() {
+		t.Fatalf("unexpected event: %+v", evt)
+	}
+
+	ps.BlacklistPeerFor(hosts[2].ID(), time.Minute)
+	evt = nextEvent()
+	if evt.Type != PeerBlacklisted || evt.Peer != hosts[2].ID() || !evt.Expiry.Equal(clk.Now().Add(time.Minute)) {
+		t.Fatalf("unexpected event: %+v", evt)
+	}
+
+	if err := ps.UnblacklistPeer(hosts[1].ID()); err != nil {
+		t.Fatal(err)
+	}
+	evt = nextEvent()
+	if evt.Type != PeerUnblacklisted || evt.Peer != hosts[1].ID() || evt.Reason != BlacklistReasonRemoved {
+		t.Fatalf("unexpected event: %+v", evt)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	clk.Add(2 * time.Minute)
+	evt = nextEvent()
+	if evt.Type != PeerBlacklistExpired || evt.Peer != hosts[2].ID() || evt.Reason != BlacklistReasonExpired {
+		t.Fatalf("unexpected event: %+v", evt)
+	}
+
+	tracer.mx.Lock()
+	traced := len(tracer.events)
+	tracer.mx.Unlock()
+	if traced != 4 {
+		t.Fatalf("expected 4 traced events, got %d", traced)
+	}
+
+	// the channel is closed with its context
+	evtCtx, evtCancel := context.WithCancel(ctx)
+	closed := ps.BlacklistEvents(evtCtx, 1)
+	evtCancel()
+	select {
+	case _, ok := <-closed:
+		if ok {
+			t.Fatal("unexpected event")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the channel to be closed")
+	}
+}
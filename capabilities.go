@@ -0,0 +1,90 @@
+package pubsub
+
+import (
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// PeerCapabilities are the protocol negotiated with a peer and the optional features active with
+// it, as set up with our outgoing stream, for debugging interoperability.
+type PeerCapabilities struct {
+	// Protocol is the router protocol negotiated with the peer.
+	Protocol protocol.ID
+	// StreamProtocol is the protocol of the stream, with the suffixes of its variant.
+	StreamProtocol protocol.ID
+	// Compression is the compression of the stream; empty if it is uncompressed.
+	Compression Compression
+	// Bidirectional is whether the stream carries the RPCs of both directions.
+	Bidirectional bool
+	// ControlStream is whether the subscriptions and control messages are sent on a control
+	// stream, set with WithControlStreams.
+	ControlStream bool
+	// Mesh is whether the peer takes part in the gossipsub meshes.
+	Mesh bool
+	// PX is whether peer exchange is active with the peer: enabled with WithPeerExchange and
+	// supported by its protocol.
+	PX bool
+	// Choke is whether mesh links with the peer may be choked: enabled with the choke
+	// parameters and supported by its protocol.
+	Choke bool
+}
+
+// peerStream is a new outgoing stream to a peer, with whether a control stream was opened
+// alongside it
+type peerStream struct {
+	s       network.Stream
+	control bool
+}
+
+// capabilityRouter is implemented by routers with optional features depending on the protocol of
+// the peers
+type capabilityRouter interface {
+	// peerCapabilities fills in the features of the router active with a peer
+	peerCapabilities(p peer.ID, caps *PeerCapabilities)
+}
+
+// PeerCapabilities returns the protocol and the optional features active with a connected peer,
+// and false if we have no stream to the peer.
+func (p *PubSub) PeerCapabilities(pid peer.ID) (PeerCapabilities, bool) {
+	out := make(chan *PeerCapabilities, 1)
+	select {
+	case p.eval <- func() { out <- p.capabilities[pid] }:
+	case <-p.ctx.Done():
+		return PeerCapabilities{}, false
+	}
+
+	caps := <-out
+	if caps == nil {
+		return PeerCapabilities{}, false
+	}
+	return *caps, true
+}
+
+// recordCapabilities records the capabilities of a peer once its outgoing stream is set up and
+// the router knows the peer.
+// Only called from processLoop.
+func (p *PubSub) recordCapabilities(pid peer.ID, ps peerStream) {
+	id := ps.s.Protocol()
+	caps := &PeerCapabilities{
+		Protocol:       routerProtocol(id),
+		StreamProtocol: id,
+		Compression:    compressionOf(id),
+		Bidirectional:  isBidiProtocol(id),
+		ControlStream:  ps.control,
+	}
+	if cr, ok := p.rt.(capabilityRouter); ok {
+		cr.peerCapabilities(pid, caps)
+	}
+	p.capabilities[pid] = caps
+}
+
+func (gs *GossipSubRouter) peerCapabilities(p peer.ID, caps *PeerCapabilities) {
+	proto, ok := gs.peers[p]
+	if !ok {
+		return
+	}
+	caps.Mesh = gs.feature(GossipSubFeatureMesh, proto)
+	caps.PX = gs.doPX && gs.feature(GossipSubFeaturePX, proto)
+	caps.Choke = gs.params.ChokeThreshold > 0 && gs.feature(GossipSubFeatureChoke, proto)
+}
@@ -0,0 +1,69 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestPeerCapabilities(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	psubs := []*PubSub{
+		getGossipsub(ctx, hosts[0], WithCompression(CompressionSnappy, 256), WithControlStreams(), WithPeerExchange(true)),
+		getGossipsub(ctx, hosts[1], WithCompression(CompressionSnappy, 256), WithControlStreams()),
+		getPubsub(ctx, hosts[2]),
+	}
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[0], hosts[2])
+	time.Sleep(time.Second)
+
+	caps, ok := psubs[0].PeerCapabilities(hosts[1].ID())
+	if !ok {
+		t.Fatal("expected the capabilities of the gossipsub peer")
+	}
+	if caps.Protocol != GossipSubID_choke || caps.Compression != CompressionSnappy || !caps.ControlStream || caps.Bidirectional {
+		t.Fatalf("unexpected stream capabilities of the gossipsub peer: %+v", caps)
+	}
+	if routerProtocol(caps.StreamProtocol) != caps.Protocol {
+		t.Fatalf("expected the stream protocol to be a variant of %s, got %s", caps.Protocol, caps.StreamProtocol)
+	}
+	if !caps.Mesh || !caps.PX {
+		t.Fatalf("expected the mesh and PX to be active with the gossipsub peer: %+v", caps)
+	}
+
+	caps, ok = psubs[0].PeerCapabilities(hosts[2].ID())
+	if !ok {
+		t.Fatal("expected the capabilities of the floodsub peer")
+	}
+	if caps.Protocol != FloodSubID || caps.Compression != "" || caps.ControlStream || caps.Mesh || caps.PX || caps.Choke {
+		t.Fatalf("expected no optional feature with the floodsub peer: %+v", caps)
+	}
+
+	if _, ok := psubs[0].PeerCapabilities(peer.ID("unknown")); ok {
+		t.Fatal("expected no capabilities for an unknown peer")
+	}
+
+	dump, err := psubs[0].DumpState(ctx, WithDumpPeer(hosts[1].ID()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pd := dump.Peers[hosts[1].ID()]; pd == nil || pd.Capabilities == nil || pd.Capabilities.Compression != CompressionSnappy {
+		t.Fatalf("expected the capabilities in the dump of the peer, got %+v", pd)
+	}
+
+	// the capabilities are forgotten with the peer
+	hosts[0].Network().ClosePeer(hosts[1].ID())
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, ok := psubs[0].PeerCapabilities(hosts[1].ID()); !ok {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("expected the capabilities to be forgotten once the peer is gone")
+		}
+	}
+}
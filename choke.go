@@ -0,0 +1,343 @@
+package pubsub
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// meshLink is the state of a mesh peer speaking GossipSubID_choke, for the choking decisions
+type meshLink struct {
+	// choked is whether we choked the peer, so that it sends us IHAVE gossip instead of messages
+	choked bool
+	// since is the heartbeat of the last change
+	since uint64
+	// the deliveries since the last decision
+	chokeStats
+}
+
+// chokeStats are the deliveries of a mesh peer in a topic
+type chokeStats struct {
+	// first and dups count the messages the peer delivered first and after another peer
+	first, dups int
+	// advertised counts the messages advertised by the peer while choked, and lead sums the
+	// time the ones we didn't have yet took to arrive after their advertisement
+	advertised int
+	lead       time.Duration
+}
+
+func (s *chokeStats) add(o chokeStats) {
+	s.first += o.first
+	s.dups += o.dups
+	s.advertised += o.advertised
+	s.lead += o.lead
+}
+
+// dupRatio returns the ratio of duplicates among the messages delivered
+func (s *chokeStats) dupRatio() float64 {
+	return float64(s.dups) / float64(s.first+s.dups)
+}
+
+// chokeTracer is an internal tracer that follows how the peers deliver the messages, for the
+// heartbeat to choke the redundant mesh peers and unchoke the ones which would deliver faster.
+type chokeTracer struct {
+	sync.Mutex
+
+	idGen *msgIDGenerator
+	clock Clock
+	self  peer.ID
+
+	// the deliveries by topic and peer since the last heartbeat
+	stats map[string]map[peer.ID]*chokeStats
+	// the advertisements of messages we didn't have yet by choked peers, by message ID
+	adverts map[string][]chokeAdvert
+}
+
+type chokeAdvert struct {
+	p     peer.ID
+	topic string
+	at    time.Time
+}
+
+func newChokeTracer(p *PubSub) *chokeTracer {
+	return &chokeTracer{
+		idGen:   p.idGen,
+		clock:   p.clock,
+		self:    p.host.ID(),
+		stats:   make(map[string]map[peer.ID]*chokeStats),
+		adverts: make(map[string][]chokeAdvert),
+	}
+}
+
+// peerStats returns the stats of a peer in a topic, adding them if needed
+func (ct *chokeTracer) peerStats(topic string, p peer.ID) *chokeStats {
+	peers, ok := ct.stats[topic]
+	if !ok {
+		peers = make(map[peer.ID]*chokeStats)
+		ct.stats[topic] = peers
+	}
+	s, ok := peers[p]
+	if !ok {
+		s = new(chokeStats)
+		peers[p] = s
+	}
+	return s
+}
+
+// advertise records the advertisement of messages by a choked peer, among which the ones we
+// don't have yet
+func (ct *chokeTracer) advertise(p peer.ID, topic string, count int, unseen []string) {
+	if ct == nil {
+		return
+	}
+
+	ct.Lock()
+	defer ct.Unlock()
+
+	ct.peerStats(topic, p).advertised += count
+	now := ct.clock.Now()
+	for _, mid := range unseen {
+		ct.adverts[mid] = append(ct.adverts[mid], chokeAdvert{p: p, topic: topic, at: now})
+	}
+}
+
+// drain returns the deliveries since the last call, and forgets the advertisements of messages
+// which didn't arrive within maxLead
+func (ct *chokeTracer) drain(maxLead time.Duration) map[string]map[peer.ID]*chokeStats {
+	if ct == nil {
+		return nil
+	}
+
+	ct.Lock()
+	defer ct.Unlock()
+
+	stats := ct.stats
+	ct.stats = make(map[string]map[peer.ID]*chokeStats)
+
+	now := ct.clock.Now()
+	for mid, adverts := range ct.adverts {
+		if now.Sub(adverts[0].at) > maxLead {
+			delete(ct.adverts, mid)
+		}
+	}
+	return stats
+}
+
+var _ RawTracer = (*chokeTracer)(nil)
+
+func (ct *chokeTracer) ValidateMessage(msg *Message) {
+	ct.Lock()
+	defer ct.Unlock()
+
+	if msg.ReceivedFrom != ct.self {
+		ct.peerStats(msg.GetTopic(), msg.ReceivedFrom).first++
+	}
+
+	if len(ct.adverts) == 0 {
+		return
+	}
+	mid := ct.idGen.ID(msg)
+	adverts, ok := ct.adverts[mid]
+	if !ok {
+		return
+	}
+	now := ct.clock.Now()
+	for _, a := range adverts {
+		ct.peerStats(a.topic, a.p).lead += now.Sub(a.at)
+	}
+	delete(ct.adverts, mid)
+}
+
+func (ct *chokeTracer) DuplicateMessage(msg *Message) {
+	ct.Lock()
+	defer ct.Unlock()
+
+	ct.peerStats(msg.GetTopic(), msg.ReceivedFrom).dups++
+}
+
+func (ct *chokeTracer) AddPeer(p peer.ID, proto protocol.ID)      {}
+func (ct *chokeTracer) RemovePeer(p peer.ID)                      {}
+func (ct *chokeTracer) Join(topic string)                         {}
+func (ct *chokeTracer) Leave(topic string)                        {}
+func (ct *chokeTracer) Graft(p peer.ID, topic string)             {}
+func (ct *chokeTracer) Prune(p peer.ID, topic string)             {}
+func (ct *chokeTracer) DeliverMessage(msg *Message)               {}
+func (ct *chokeTracer) RejectMessage(msg *Message, reason string) {}
+func (ct *chokeTracer) ThrottlePeer(p peer.ID)                    {}
+func (ct *chokeTracer) RecvRPC(rpc *RPC)                          {}
+func (ct *chokeTracer) SendRPC(rpc *RPC, p peer.ID)               {}
+func (ct *chokeTracer) DropRPC(rpc *RPC, p peer.ID)               {}
+func (ct *chokeTracer) UndeliverableMessage(msg *Message)         {}
+
+// updateChokes chokes the mesh peers of a topic delivering mostly duplicates, and unchokes the
+// choked ones whose advertisements lead the mesh deliveries, keeping ChokeMinEagerPeers peers
+// unchoked. A peer stays in a state for ChokeHoldTicks heartbeats after a change.
+// Only called from processLoop.
+func (gs *GossipSubRouter) updateChokes(topic string, peers map[peer.ID]struct{}, stats map[peer.ID]*chokeStats) {
+	links, ok := gs.links[topic]
+	if !ok {
+		links = make(map[peer.ID]*meshLink)
+		gs.links[topic] = links
+	}
+
+	// follow the mesh; the links of the peers which left it are dropped with clearChoke
+	eager := 0
+	for p := range peers {
+		if !gs.feature(GossipSubFeatureChoke, gs.peers[p]) {
+			eager++
+			continue
+		}
+		link, ok := links[p]
+		if !ok {
+			link = &meshLink{since: gs.heartbeatTicks}
+			links[p] = link
+		}
+		if s, ok := stats[p]; ok {
+			link.add(*s)
+		}
+		if !link.choked {
+			eager++
+		}
+	}
+
+	held := func(link *meshLink) bool {
+		return gs.heartbeatTicks-link.since < gs.params.ChokeHoldTicks
+	}
+
+	var tochoke []peer.ID
+	for p, link := range links {
+		switch {
+		case link.choked && eager < gs.params.ChokeMinEagerPeers:
+			// the mesh shrank, we need eager peers again
+			gs.unchoke(p, topic, link)
+			eager++
+
+		case link.choked && !held(link) && link.advertised >= gs.params.ChokeMinMessages:
+			if link.lead/time.Duration(link.advertised) >= gs.params.UnchokeLatency {
+				gs.unchoke(p, topic, link)
+				eager++
+			} else {
+				link.chokeStats = chokeStats{}
+			}
+
+		case !link.choked && !held(link) && link.first+link.dups >= gs.params.ChokeMinMessages:
+			if link.dupRatio() >= gs.params.ChokeThreshold {
+				tochoke = append(tochoke, p)
+			} else {
+				link.chokeStats = chokeStats{}
+			}
+		}
+	}
+
+	// choke the most redundant peers first
+	sort.Slice(tochoke, func(i, j int) bool {
+		return links[tochoke[i]].dupRatio() > links[tochoke[j]].dupRatio()
+	})
+	for _, p := range tochoke {
+		link := links[p]
+		if eager <= gs.params.ChokeMinEagerPeers {
+			link.chokeStats = chokeStats{}
+			continue
+		}
+		log.Debugf("HEARTBEAT: Choke peer %s in %s [duplicates = %.2f]", p, topic, link.dupRatio())
+		link.choked = true
+		link.since = gs.heartbeatTicks
+		link.chokeStats = chokeStats{}
+		eager--
+		gs.sendChoke(p, topic, true)
+	}
+}
+
+func (gs *GossipSubRouter) unchoke(p peer.ID, topic string, link *meshLink) {
+	log.Debugf("HEARTBEAT: Unchoke peer %s in %s", p, topic)
+	link.choked = false
+	link.since = gs.heartbeatTicks
+	link.chokeStats = chokeStats{}
+	gs.sendChoke(p, topic, false)
+}
+
+func (gs *GossipSubRouter) sendChoke(p peer.ID, topic string, choke bool) {
+	out := rpcWithControl(nil, nil, nil, nil, nil)
+	if choke {
+		out.Control.Choke = []*pb.ControlChoke{{TopicID: &topic}}
+	} else {
+		out.Control.Unchoke = []*pb.ControlUnchoke{{TopicID: &topic}}
+	}
+	gs.sendRPC(p, out)
+}
+
+// handleChoke honors the CHOKE and UNCHOKE of the mesh peers, sending them IHAVE gossip instead
+// of the messages of the topic while choked.
+func (gs *GossipSubRouter) handleChoke(p peer.ID, ctl *pb.ControlMessage) {
+	if len(ctl.GetChoke()) == 0 && len(ctl.GetUnchoke()) == 0 {
+		return
+	}
+	if !gs.feature(GossipSubFeatureChoke, gs.peers[p]) {
+		log.Debugf("CHOKE: ignoring peer %s not supporting it", p)
+		return
+	}
+
+	for _, choke := range ctl.GetChoke() {
+		topic := choke.GetTopicID()
+		if _, inMesh := gs.mesh[topic][p]; !inMesh {
+			continue
+		}
+
+		log.Debugf("CHOKE: peer %s in %s", p, topic)
+		lazy, ok := gs.lazy[topic]
+		if !ok {
+			lazy = make(map[peer.ID]struct{})
+			gs.lazy[topic] = lazy
+		}
+		lazy[p] = struct{}{}
+		gs.meshChanged(topic)
+	}
+
+	for _, unchoke := range ctl.GetUnchoke() {
+		topic := unchoke.GetTopicID()
+		if _, ok := gs.lazy[topic][p]; !ok {
+			continue
+		}
+
+		log.Debugf("UNCHOKE: peer %s in %s", p, topic)
+		gs.clearLazy(topic, p)
+		gs.meshChanged(topic)
+	}
+}
+
+// isLazy returns whether a mesh peer choked us in a topic
+func (gs *GossipSubRouter) isLazy(topic string, p peer.ID) bool {
+	_, ok := gs.lazy[topic][p]
+	return ok
+}
+
+// clearChoke drops the choking state of a peer leaving the mesh of a topic
+func (gs *GossipSubRouter) clearChoke(topic string, p peer.ID) {
+	gs.clearLazy(topic, p)
+	if links, ok := gs.links[topic]; ok {
+		delete(links, p)
+		if len(links) == 0 {
+			delete(gs.links, topic)
+		}
+	}
+}
+
+func (gs *GossipSubRouter) clearLazy(topic string, p peer.ID) {
+	if lazy, ok := gs.lazy[topic]; ok {
+		delete(lazy, p)
+		if len(lazy) == 0 {
+			delete(gs.lazy, topic)
+		}
+	}
+}
+
+// isChoked returns whether we choked a mesh peer in a topic
+func (gs *GossipSubRouter) isChoked(topic string, p peer.ID) bool {
+	link, ok := gs.links[topic][p]
+	return ok && link.choked
+}
@@ -0,0 +1,306 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+// chokeTestRouter returns a gossipsub router with fabricated peers joined in a topic
+func chokeTestRouter(t *testing.T, ctx context.Context, params GossipSubParams, peers map[peer.ID]protocol.ID) (*PubSub, *GossipSubRouter, func(func())) {
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getGossipsub(ctx, hosts[0], WithGossipSubParams(params), WithManualHeartbeat())
+	gs := ps.rt.(*GossipSubRouter)
+
+	eval := func(f func()) {
+		done := make(chan struct{})
+		ps.eval <- func() {
+			f()
+			close(done)
+		}
+		<-done
+	}
+
+	eval(func() {
+		ps.topics["test"] = make(map[peer.ID]struct{})
+		for pid, proto := range peers {
+			ps.peers[pid] = make(chan *RPC, 16)
+			ps.stats.addPeer(pid)
+			gs.peers[pid] = proto
+			ps.topics["test"][pid] = struct{}{}
+			ps.notifyJoin("test", pid)
+		}
+		gs.Join("test")
+		drainRPCs(ps)
+	})
+	return ps, gs, eval
+}
+
+// drainRPCs returns the chokes and unchokes sent to the peers, dropping the other RPCs
+func drainRPCs(ps *PubSub) (choked, unchoked []peer.ID) {
+	for pid, ch := range ps.peers {
+		for len(ch) > 0 {
+			rpc := <-ch
+			if len(rpc.GetControl().GetChoke()) > 0 {
+				choked = append(choked, pid)
+			}
+			if len(rpc.GetControl().GetUnchoke()) > 0 {
+				unchoked = append(unchoked, pid)
+			}
+		}
+	}
+	return choked, unchoked
+}
+
+func TestChokeDecisions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	params := DefaultGossipSubParams()
+	params.ChokeThreshold = 0.5
+	params.ChokeMinMessages = 10
+	params.ChokeMinEagerPeers = 2
+	params.ChokeHoldTicks = 2
+	params.UnchokeLatency = 50 * time.Millisecond
+
+	ps, gs, eval := chokeTestRouter(t, ctx, params, map[peer.ID]protocol.ID{
+		"p0":  GossipSubID_choke,
+		"p1":  GossipSubID_choke,
+		"p2":  GossipSubID_choke,
+		"p3":  GossipSubID_choke,
+		"old": GossipSubID_v11,
+	})
+
+	update := func(ticks uint64, stats map[peer.ID]*chokeStats) (choked, unchoked []peer.ID) {
+		eval(func() {
+			gs.heartbeatTicks += ticks
+			gs.updateChokes("test", gs.mesh["test"], stats)
+			choked, unchoked = drainRPCs(ps)
+		})
+		return choked, unchoked
+	}
+	redundant := func() map[peer.ID]*chokeStats {
+		return map[peer.ID]*chokeStats{
+			"p0":  {first: 1, dups: 9},
+			"p1":  {first: 2, dups: 8},
+			"p2":  {first: 9, dups: 1},
+			"old": {first: 0, dups: 10},
+		}
+	}
+
+	// the new mesh peers are held unchoked
+	if choked, _ := update(0, redundant()); len(choked) != 0 {
+		t.Fatalf("expected no choke while held, got %v", choked)
+	}
+
+	// then the redundant ones are choked, down to the minimum of eager peers, but never the
+	// peers of older versions
+	choked, _ := update(2, redundant())
+	if len(choked) != 2 {
+		t.Fatalf("expected 2 chokes, got %v", choked)
+	}
+	eval(func() {
+		if !gs.isChoked("test", "p0") || !gs.isChoked("test", "p1") || gs.isChoked("test", "p2") {
+			t.Error("expected p0 and p1 to be choked")
+		}
+		if _, ok := gs.links["test"]["old"]; ok {
+			t.Error("expected no link state for an older peer")
+		}
+	})
+
+	// a choked peer advertising messages well before the mesh delivers them is unchoked
+	_, unchoked := update(2, map[peer.ID]*chokeStats{
+		"p0": {advertised: 10, lead: time.Second},
+		"p1": {advertised: 10},
+	})
+	if len(unchoked) != 1 || unchoked[0] != "p0" {
+		t.Fatalf("expected p0 to be unchoked, got %v", unchoked)
+	}
+
+	// and the choked peers are unchoked when the mesh shrinks, hold or not
+	eval(func() {
+		for _, p := range []peer.ID{"p0", "p2", "p3", "old"} {
+			gs.handlePrune(p, &pb.ControlMessage{Prune: []*pb.ControlPrune{{TopicID: stringPtr("test")}}})
+		}
+		drainRPCs(ps)
+	})
+	if _, unchoked := update(0, nil); len(unchoked) != 1 || unchoked[0] != "p1" {
+		t.Fatalf("expected p1 to be unchoked, got %v", unchoked)
+	}
+}
+
+func TestHonorChoke(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ps, gs, eval := chokeTestRouter(t, ctx, DefaultGossipSubParams(), map[peer.ID]protocol.ID{
+		"p0":  GossipSubID_choke,
+		"p1":  GossipSubID_choke,
+		"old": GossipSubID_v11,
+	})
+
+	topic := "test"
+	choke := &pb.ControlMessage{Choke: []*pb.ControlChoke{{TopicID: &topic}}}
+	unchoke := &pb.ControlMessage{Unchoke: []*pb.ControlUnchoke{{TopicID: &topic}}}
+
+	var seqno int
+	publish := func() (pushed, gossiped map[peer.ID]bool) {
+		pushed, gossiped = make(map[peer.ID]bool), make(map[peer.ID]bool)
+		eval(func() {
+			seqno++
+			gs.Publish(&Message{
+				Message: &pb.Message{
+					From:  []byte("author"),
+					Seqno: []byte(fmt.Sprint(seqno)),
+					Topic: &topic,
+				},
+				ReceivedFrom: "relay",
+			})
+			gs.emitGossip(topic, gs.mesh[topic], func(peer.ID) float64 { return 0 })
+			gs.flush()
+			for pid, ch := range ps.peers {
+				for len(ch) > 0 {
+					rpc := <-ch
+					if len(rpc.GetPublish()) > 0 {
+						pushed[pid] = true
+					}
+					if len(rpc.GetControl().GetIhave()) > 0 {
+						gossiped[pid] = true
+					}
+				}
+			}
+		})
+		return pushed, gossiped
+	}
+
+	if pushed, gossiped := publish(); len(pushed) != 3 || len(gossiped) != 0 {
+		t.Fatalf("expected to push to the mesh, got %v and %v", pushed, gossiped)
+	}
+
+	// the chokes of mesh peers speaking the choke protocol are honored
+	eval(func() {
+		gs.handleChoke("p0", choke)
+		gs.handleChoke("old", choke)
+	})
+	pushed, gossiped := publish()
+	if len(pushed) != 2 || pushed["p0"] || !gossiped["p0"] || len(gossiped) != 1 {
+		t.Fatalf("expected to gossip to p0 only, got %v and %v", pushed, gossiped)
+	}
+
+	eval(func() { gs.handleChoke("p0", unchoke) })
+	if pushed, gossiped := publish(); len(pushed) != 3 || len(gossiped) != 0 {
+		t.Fatalf("expected to push to the mesh again, got %v and %v", pushed, gossiped)
+	}
+
+	// leaving the mesh drops the choke
+	eval(func() {
+		gs.handleChoke("p1", choke)
+		gs.handlePrune("p1", &pb.ControlMessage{Prune: []*pb.ControlPrune{{TopicID: &topic}}})
+		if gs.isLazy(topic, "p1") {
+			t.Error("expected the choke to be dropped with the mesh link")
+		}
+	})
+}
+
+func TestGossipsubChoke(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	params := DefaultGossipSubParams()
+	params.ChokeThreshold = 0.5
+	params.ChokeMinMessages = 5
+	params.ChokeMinEagerPeers = 2
+	params.ChokeHoldTicks = 1
+
+	hosts := getNetHosts(t, ctx, 6)
+	psubs := getGossipsubs(ctx, hosts[:5], WithGossipSubParams(params))
+	// a peer of an older version, which is never choked
+	psubs = append(psubs, getGossipsub(ctx, hosts[5], WithGossipSubParams(params),
+		WithGossipSubProtocols([]protocol.ID{GossipSubID_v11}, GossipSubDefaultFeatures)))
+
+	var subs []*Subscription
+	for _, ps := range psubs {
+		subs = append(subs, mustSubscribe(t, ps, "test"))
+	}
+	connectAll(t, hosts)
+	time.Sleep(2 * time.Second)
+
+	for i := 0; i < 60; i++ {
+		data := []byte(fmt.Sprintf("message %d", i))
+		if err := psubs[i%len(psubs)].Publish("test", data); err != nil {
+			t.Fatal(err)
+		}
+		for _, sub := range subs {
+			assertReceive(t, sub, data)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	chokes := 0
+	for i, ps := range psubs {
+		gs := ps.rt.(*GossipSubRouter)
+		done := make(chan struct{})
+		ps.eval <- func() {
+			for p, link := range gs.links["test"] {
+				if p == hosts[5].ID() {
+					t.Errorf("node %d has link state for the older peer", i)
+				}
+				if link.choked {
+					chokes++
+				}
+			}
+			close(done)
+		}
+		<-done
+	}
+	if chokes == 0 {
+		t.Fatal("expected redundant mesh links to be choked")
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestChokeWireFormat(t *testing.T) {
+	ctl := &pb.ControlMessage{
+		Choke:   []*pb.ControlChoke{{TopicID: stringPtr("a")}},
+		Unchoke: []*pb.ControlUnchoke{{TopicID: stringPtr("b")}},
+	}
+	buf, err := ctl.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != ctl.Size() {
+		t.Fatalf("expected %d bytes, got %d", ctl.Size(), len(buf))
+	}
+
+	// the fields are numbered apart from the control messages of the gossipsub specs, which
+	// older peers skip as unknown fields
+	var decoded pb.ControlMessage
+	if err := decoded.Unmarshal(buf); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.GetChoke()[0].GetTopicID() != "a" || decoded.GetUnchoke()[0].GetTopicID() != "b" {
+		t.Fatalf("unexpected decoded message %v", &decoded)
+	}
+	if buf[0] != 0xca || buf[1] != 0x3e {
+		t.Fatalf("expected choke to be field 1001, got tag %x", buf[:2])
+	}
+
+	// a message of the specs with the former field numbers isn't taken as a choke
+	spec := []byte{0x2a, 0x03, 0x0a, 0x01, 'a'}
+	var other pb.ControlMessage
+	if err := other.Unmarshal(spec); err != nil {
+		t.Fatal(err)
+	}
+	if len(other.GetChoke()) != 0 {
+		t.Fatal("expected field 5 not to be decoded as a choke")
+	}
+}
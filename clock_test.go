@@ -0,0 +1,205 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// mockClock adapts a benbjohnson mock clock to the pubsub Clock interface
+type mockClock struct {
+	*clock.Mock
+}
+
+func newMockClock() mockClock {
+	return mockClock{clock.NewMock()}
+}
+
+func (c mockClock) NewTicker(d time.Duration) Ticker {
+	return mockTicker{c.Mock.Ticker(d)}
+}
+
+type mockTicker struct {
+	*clock.Ticker
+}
+
+func (t mockTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+func TestManualHeartbeatFanoutExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := newMockClock()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getGossipsubs(ctx, hosts, WithManualHeartbeat(), WithClock(clk))
+	connect(t, hosts[0], hosts[1])
+
+	sub, err := psubs[1].Subscribe("foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the subscription to propagate
+	time.Sleep(100 * time.Millisecond)
+
+	if err := psubs[0].Publish("foobar", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, sub, []byte("hello"))
+
+	gs := psubs[0].rt.(*GossipSubRouter)
+	fanoutSize := func() int {
+		res := make(chan int, 1)
+		psubs[0].eval <- func() {
+			res <- len(gs.fanout["foobar"])
+		}
+		return <-res
+	}
+
+	if err := psubs[0].TriggerHeartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	if fanoutSize() != 1 {
+		t.Fatal("expected the fanout to be retained")
+	}
+
+	clk.Add(GossipSubFanoutTTL + time.Second)
+	if err := psubs[0].TriggerHeartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	if fanoutSize() != 0 {
+		t.Fatal("expected the fanout to be expired")
+	}
+
+	// the ticker is disabled, so nothing else touches the heartbeat count
+	res := make(chan uint64, 1)
+	psubs[0].eval <- func() {
+		res <- gs.heartbeatTicks
+	}
+	if ticks := <-res; ticks != 2 {
+		t.Fatalf("expected 2 heartbeats, got %d", ticks)
+	}
+}
+
+func TestManualHeartbeatRequiresGossipsub(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0])
+
+	if err := ps.TriggerHeartbeat(); err == nil {
+		t.Fatal("expected an error for a floodsub router")
+	}
+}
+
+func TestClockFastForward(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := newMockClock()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getGossipsubs(ctx, hosts,
+		WithClock(clk),
+		WithManualHeartbeat(),
+		WithPeerScore(
+			&PeerScoreParams{
+				AppSpecificScore:  func(peer.ID) float64 { return 0 },
+				AppSpecificWeight: 1,
+				DecayInterval:     time.Second,
+				DecayToZero:       0.01,
+				RetainScore:       time.Minute,
+			},
+			&PeerScoreThresholds{
+				GossipThreshold:   -10,
+				PublishThreshold:  -100,
+				GraylistThreshold: -1000,
+			}))
+
+	ps := psubs[0]
+	gs := ps.rt.(*GossipSubRouter)
+
+	onLoop := func(f func()) {
+		done := make(chan struct{})
+		ps.eval <- func() {
+			f()
+			close(done)
+		}
+		<-done
+	}
+
+	// seen cache entries expire with the clock
+	var seen bool
+	onLoop(func() {
+		ps.markSeen("foobar", "msg")
+		seen = ps.seenMessage("foobar", "msg")
+	})
+	if !seen {
+		t.Fatal("expected the message to be seen")
+	}
+
+	clk.Add(TimeCacheDuration + time.Second)
+	onLoop(func() { seen = ps.seenMessage("foobar", "msg") })
+	if seen {
+		t.Fatal("expected the seen cache entry to be expired")
+	}
+
+	// score retention expires with the clock
+	tracked := func() bool {
+		gs.score.Lock()
+		defer gs.score.Unlock()
+		_, ok := gs.score.peerStats[hosts[1].ID()]
+		return ok
+	}
+
+	connect(t, hosts[0], hosts[1])
+	for i := 0; !tracked(); i++ {
+		if i == 100 {
+			t.Fatal("peer was never tracked by the score")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	hosts[0].Network().ClosePeer(hosts[1].ID())
+	time.Sleep(100 * time.Millisecond)
+	if !tracked() {
+		t.Fatal("peer score should be retained after disconnection")
+	}
+
+	for i := 0; tracked(); i++ {
+		if i == 100 {
+			t.Fatal("peer score was never expired")
+		}
+		// ticks the score refresh past the retention period
+		clk.Add(time.Minute)
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestManualHeartbeatAfterShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	pctx, pcancel := context.WithCancel(ctx)
+	ps := getGossipsub(pctx, hosts[0], WithManualHeartbeat())
+	pcancel()
+
+	done := make(chan error, 1)
+	go func() { done <- ps.TriggerHeartbeat() }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected an error after shutdown")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the heartbeat trigger to return after shutdown")
+	}
+}
@@ -1,9 +1,13 @@
 package pubsub
 
 import (
+	"bufio"
 	"context"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
@@ -12,15 +16,13 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
-	"github.com/libp2p/go-msgio"
 
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 )
 
-// get the initial RPC containing all of our subscriptions to send to new peers
-func (p *PubSub) getHelloPacket() *RPC {
-	var rpc RPC
-
+// get the initial RPCs containing all of our subscriptions to send to new peers, fragmented
+// if they exceed the message size limit
+func (p *PubSub) getHelloPackets() []*RPC {
 	subscriptions := make(map[string]bool)
 
 	for t := range p.mySubs {
@@ -31,19 +33,46 @@ func (p *PubSub) getHelloPacket() *RPC {
 		subscriptions[t] = true
 	}
 
+	subs := make([]*pb.RPC_SubOpts, 0, len(subscriptions))
 	for t := range subscriptions {
 		as := &pb.RPC_SubOpts{
 			Topicid:   proto.String(t),
 			Subscribe: proto.Bool(true),
 		}
-		rpc.Subscriptions = append(rpc.Subscriptions, as)
+		subs = append(subs, as)
+	}
+	return p.subscriptionRPCs(subs)
+}
+
+// sendHelloPackets sends our subscriptions to a new peer, which then only needs the
+// announcements made after them
+func (p *PubSub) sendHelloPackets(pid peer.ID, messages chan *RPC) {
+	for _, hello := range p.getHelloPackets() {
+		p.enqueueRPC(pid, messages, hello)
+	}
+	if len(p.announcing) > 0 {
+		if p.greeted == nil {
+			p.greeted = make(map[peer.ID]int)
+		}
+		p.greeted[pid] = len(p.announcing)
+		p.greetedMark = len(p.announcing)
 	}
-	return &rpc
 }
 
 func (p *PubSub) handleNewStream(s network.Stream) {
 	peer := s.Conn().RemotePeer()
 
+	if p.ipBlocked(peer, s.Conn().RemoteMultiaddr()) || p.denyPeer(peer) {
+		s.Reset()
+		return
+	}
+
+	// control streams carry part of the RPCs of the peer, alongside its stream
+	if isControlProtocol(s.Protocol()) {
+		p.readRPCs(s)
+		return
+	}
+
 	p.inboundStreamsMx.Lock()
 	other, dup := p.inboundStreams[peer]
 	if dup {
@@ -61,9 +90,55 @@ func (p *PubSub) handleNewStream(s network.Stream) {
 		p.inboundStreamsMx.Unlock()
 	}()
 
-	r := msgio.NewVarintReaderSize(s, p.maxMessageSize)
+	// offer a bidirectional stream to our writer for the peer
+	var bs *bidiStream
+	if p.bidi != nil && isBidiProtocol(s.Protocol()) {
+		bs = &bidiStream{s: s}
+		p.bidi.offer(peer, bs)
+	} else if p.bidi != nil {
+		p.bidi.decline(peer)
+	}
+
+	p.readRPCs(s)
+
+	if p.bidi != nil {
+		p.bidi.withdraw(peer, bs)
+	}
+	if bs != nil {
+		if !bs.claimed.CompareAndSwap(false, true) {
+			// the stream is also written to; tear down both directions
+			s.Reset()
+			p.notifyPeerDead(peer)
+		}
+	}
+}
+
+// readRPCs reads the RPCs of a peer from a stream until it is closed or reset
+func (p *PubSub) readRPCs(s network.Stream) {
+	peer := s.Conn().RemotePeer()
+	rl := p.newRPCRateLimiter(peer)
+	bw := p.acquireBandwidth(peer)
+	defer p.releaseBandwidth(peer, bw)
+	codec := compressionOf(s.Protocol())
+	maxSize := p.maxRPCSize()
+	if codec != "" {
+		// frames carry a flag byte and may not shrink when compressed
+		maxSize++
+	}
+	r := newRPCReader(s, maxSize, !p.noPooling)
+	oversized := 0
 	for {
 		msgbytes, err := r.ReadMsg()
+		var oe *oversizedRPCError
+		if errors.As(err, &oe) && p.skipsOversizedRPC(oe.size, oversized) {
+			// discard the RPC, keeping the stream alive
+			if err = r.Skip(oe.size); err == nil {
+				oversized++
+				p.accountIn(bw, varint.UvarintSize(oe.size)+int(oe.size))
+				p.rpcLimitExceeded(peer, int(oe.size), RPCSizeExceeded)
+				continue
+			}
+		}
 		if err != nil {
 			r.ReleaseMsg(msgbytes)
 			if err != io.EOF {
@@ -81,8 +156,31 @@ func (p *PubSub) handleNewStream(s network.Stream) {
 			continue
 		}
 
-		rpc := new(RPC)
-		err = rpc.Unmarshal(msgbytes)
+		size := len(msgbytes)
+		p.accountIn(bw, varint.UvarintSize(uint64(size))+size)
+		if !rl.Allow(size) {
+			r.ReleaseMsg(msgbytes)
+			p.rpcLimitExceeded(peer, size, RPCRateExceeded)
+			continue
+		}
+
+		data := msgbytes
+		if codec != "" {
+			data, err = p.compression.decode(codec, msgbytes, p.maxRPCSize())
+			if err != nil {
+				r.ReleaseMsg(msgbytes)
+				s.Reset()
+				log.Warnf("bogus rpc frame from %s: %s", peer, err)
+				return
+			}
+		}
+
+		rpc := p.newIncomingRPC()
+		err = rpc.Unmarshal(data)
+		if err == nil {
+			// the bytes may not match the messages once rewritten by the hooks
+			rpc.scanPublish(data, len(p.inboundHooks) == 0)
+		}
 		r.ReleaseMsg(msgbytes)
 		if err != nil {
 			s.Reset()
@@ -90,10 +188,25 @@ func (p *PubSub) handleNewStream(s network.Stream) {
 			return
 		}
 
+		if !p.inspectRPC(peer, rpc) {
+			p.releaseRPC(rpc)
+			continue
+		}
+
+		if len(p.inboundHooks) > 0 {
+			if rpc = p.hookInbound(peer, rpc); rpc == nil {
+				continue
+			}
+		}
+
+		if p.tooManyMessages(peer, rpc) {
+			p.releaseRPC(rpc)
+			p.rpcLimitExceeded(peer, size, RPCMessagesExceeded)
+			continue
+		}
+
 		rpc.from = peer
-		select {
-		case p.incoming <- rpc:
-		case <-p.ctx.Done():
+		if !p.sendIncoming(rpc) {
 			// Close is useless because the other side isn't reading.
 			s.Reset()
 			return
@@ -101,6 +214,68 @@ func (p *PubSub) handleNewStream(s network.Stream) {
 	}
 }
 
+// oversizedRPCError is returned by rpcReader for an RPC larger than the maximum size, whose
+// payload is left unread
+type oversizedRPCError struct {
+	size uint64
+}
+
+func (e *oversizedRPCError) Error() string {
+	return fmt.Sprintf("rpc of %d bytes exceeds the maximum size", e.size)
+}
+
+// rpcReader reads varint length-prefixed RPCs, and can skip the payload of oversized RPCs
+type rpcReader struct {
+	r      *bufio.Reader
+	max    int
+	pooled bool
+}
+
+func newRPCReader(r io.Reader, max int, pooled bool) *rpcReader {
+	return &rpcReader{r: bufio.NewReader(r), max: max, pooled: pooled}
+}
+
+// ReadMsg reads an RPC into a buffer, pooled if enabled, which must be released with ReleaseMsg
+func (r *rpcReader) ReadMsg() ([]byte, error) {
+	size, err := varint.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(r.max) {
+		return nil, &oversizedRPCError{size: size}
+	}
+
+	var buf []byte
+	if r.pooled {
+		buf = pool.Get(int(size))
+	} else {
+		buf = make([]byte, size)
+	}
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		r.ReleaseMsg(buf)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Skip discards the payload of an oversized RPC
+func (r *rpcReader) Skip(size uint64) error {
+	n, err := io.CopyN(io.Discard, r.r, int64(size))
+	if err == io.EOF && uint64(n) < size {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (r *rpcReader) ReleaseMsg(msg []byte) {
+	if r.pooled && msg != nil {
+		pool.Put(msg)
+	}
+}
+
 func (p *PubSub) notifyPeerDead(pid peer.ID) {
 	p.peerDeadPrioLk.RLock()
 	p.peerDeadMx.Lock()
@@ -115,7 +290,21 @@ func (p *PubSub) notifyPeerDead(pid peer.ID) {
 }
 
 func (p *PubSub) handleNewPeer(ctx context.Context, pid peer.ID, outgoing <-chan *RPC) {
-	s, err := p.host.NewStream(p.ctx, pid, p.rt.Protocols()...)
+	// write to the bidirectional stream opened by the peer, if it supports them
+	if p.bidi != nil && p.expectsBidi(pid) {
+		if s := p.bidi.claim(ctx, pid, p.clock); s != nil {
+			ps := p.startSending(ctx, s, outgoing)
+			select {
+			case p.newPeerStream <- ps:
+			case <-ctx.Done():
+			}
+			return
+		}
+		log.Debugf("no bidirectional stream from %s; opening a stream", pid)
+	}
+
+	protos := p.streamProtocols(p.bidi != nil && p.dialsBidi(pid))
+	s, err := p.host.NewStream(p.ctx, pid, protos...)
 	if err != nil {
 		log.Debug("opening new stream to peer: ", err, pid)
 
@@ -127,17 +316,32 @@ func (p *PubSub) handleNewPeer(ctx context.Context, pid peer.ID, outgoing <-chan
 		return
 	}
 
-	go p.handleSendingMessages(ctx, s, outgoing)
-	go p.handlePeerDead(s)
+	if p.ipBlocked(pid, s.Conn().RemoteMultiaddr()) {
+		s.Reset()
+
+		select {
+		case p.newPeerError <- pid:
+		case <-ctx.Done():
+		}
+
+		return
+	}
+
+	ps := p.startSending(ctx, s, outgoing)
+	if isBidiProtocol(s.Protocol()) {
+		go p.handleBidiStream(s)
+	} else {
+		go p.handlePeerDead(s)
+	}
 	select {
-	case p.newPeerStream <- s:
+	case p.newPeerStream <- ps:
 	case <-ctx.Done():
 	}
 }
 
 func (p *PubSub) handleNewPeerWithBackoff(ctx context.Context, pid peer.ID, backoff time.Duration, outgoing <-chan *RPC) {
 	select {
-	case <-time.After(backoff):
+	case <-p.clock.After(backoff):
 		p.handleNewPeer(ctx, pid, outgoing)
 	case <-ctx.Done():
 		return
@@ -157,20 +361,44 @@ func (p *PubSub) handlePeerDead(s network.Stream) {
 }
 
 func (p *PubSub) handleSendingMessages(ctx context.Context, s network.Stream, outgoing <-chan *RPC) {
-	writeRpc := func(rpc *RPC) error {
-		size := uint64(rpc.Size())
+	pid := s.Conn().RemotePeer()
+	bw := p.acquireBandwidth(pid)
+	defer p.releaseBandwidth(pid, bw)
 
-		buf := pool.Get(varint.UvarintSize(size) + int(size))
-		defer pool.Put(buf)
+	codec := compressionOf(s.Protocol())
+	writeRpc := func(rpc *RPC) error {
+		if codec != "" {
+			size, err := rpc.frameSize()
+			if err != nil {
+				return err
+			}
+			raw := p.getBuffer(size)
+			defer p.putBuffer(raw)
+			if err := rpc.marshalFrame(raw); err != nil {
+				return err
+			}
+			frame, err := p.compression.encode(codec, raw)
+			if err != nil {
+				return err
+			}
+			p.accountOut(bw, varint.UvarintSize(uint64(len(frame)))+len(frame))
+			return p.writeFrame(s, frame)
+		}
 
-		n := binary.PutUvarint(buf, size)
-		_, err := rpc.MarshalTo(buf[n:])
+		buf, pooled, err := p.delimitedRPC(rpc)
 		if err != nil {
 			return err
 		}
+		if pooled {
+			defer p.putBuffer(buf)
+		}
 
-		_, err = s.Write(buf)
-		return err
+		p.accountOut(bw, len(buf))
+		if p.writeTimeout == 0 {
+			_, err = s.Write(buf)
+			return err
+		}
+		return p.writeWithTimeout(s, buf)
 	}
 
 	defer s.Close()
@@ -180,19 +408,84 @@ func (p *PubSub) handleSendingMessages(ctx context.Context, s network.Stream, ou
 			if !ok {
 				return
 			}
+			p.dequeuedRPC(pid, rpc)
+
+			if len(rpc.GetPublish()) > 0 && p.overCap(bw) {
+				rpc = p.capOutbound(pid, rpc)
+				if rpc == nil {
+					continue
+				}
+			}
 
+			if len(p.outboundHooks) > 0 {
+				if rpc = p.hookOutbound(pid, rpc); rpc == nil {
+					continue
+				}
+			}
+
+			start := time.Now()
 			err := writeRpc(rpc)
 			if err != nil {
 				s.Reset()
 				log.Debugf("writing message to %s: %s", s.Conn().RemotePeer(), err)
 				return
 			}
+			p.stats.wrote(pid, time.Since(start))
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// writeFrame writes a length-prefixed frame of the compressed protocol variant
+func (p *PubSub) writeFrame(s network.Stream, frame []byte) error {
+	size := uint64(len(frame))
+	buf := p.getBuffer(varint.UvarintSize(size) + len(frame))
+	defer p.putBuffer(buf)
+
+	n := binary.PutUvarint(buf, size)
+	copy(buf[n:], frame)
+
+	if p.writeTimeout == 0 {
+		_, err := s.Write(buf)
+		return err
+	}
+	return p.writeWithTimeout(s, buf)
+}
+
+// writeWithTimeout writes an RPC with a deadline, resuming the write after a deadline expiration
+// until the peer fails to read any of it for maxWriteTimeouts consecutive deadlines
+func (p *PubSub) writeWithTimeout(s network.Stream, buf []byte) error {
+	timeouts := 0
+	for len(buf) > 0 {
+		if err := s.SetWriteDeadline(time.Now().Add(p.writeTimeout)); err != nil {
+			return err
+		}
+
+		n, err := s.Write(buf)
+		buf = buf[n:]
+		if err == nil {
+			break
+		}
+
+		var nerr net.Error
+		if !errors.As(err, &nerr) || !nerr.Timeout() {
+			return err
+		}
+		if n > 0 {
+			timeouts = 0
+			continue
+		}
+		timeouts++
+		if timeouts >= p.maxWriteTimeouts {
+			return fmt.Errorf("peer stopped reading: %w", err)
+		}
+		log.Debugf("write deadline expired for %s; retrying", s.Conn().RemotePeer())
+	}
+
+	return s.SetWriteDeadline(time.Time{})
+}
+
 func rpcWithSubs(subs ...*pb.RPC_SubOpts) *RPC {
 	return &RPC{
 		RPC: pb.RPC{
@@ -226,6 +519,8 @@ func rpcWithControl(msgs []*pb.Message,
 func copyRPC(rpc *RPC) *RPC {
 	res := new(RPC)
 	*res = *rpc
+	// the copy is to be changed, and attributed on its own
+	res.loads = nil
 	if rpc.Control != nil {
 		res.Control = new(pb.ControlMessage)
 		*res.Control = *rpc.Control
@@ -0,0 +1,293 @@
+package pubsub
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/snappy"
+
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// Compression is an algorithm compressing the RPC frames on the wire
+type Compression string
+
+const (
+	CompressionSnappy Compression = "snappy"
+	CompressionGzip   Compression = "gzip"
+)
+
+// compressions are the supported compression algorithms
+var compressions = []Compression{CompressionSnappy, CompressionGzip}
+
+// frame flags of the compressed protocol variants, prefixed to every RPC frame
+const (
+	frameUncompressed byte = 0
+	frameCompressed   byte = 1
+)
+
+// ErrDecompressedTooLarge is returned when a compressed RPC frame decompresses beyond the maximum
+// RPC size; the stream of the peer is reset.
+var ErrDecompressedTooLarge = errors.New("decompressed rpc too large")
+
+// WithCompression enables a compressed variant of the router protocols, negotiated with the peers
+// enabling the same compression, whose protocol IDs carry the compression name as suffix (e.g.
+// /meshsub/1.1.0/snappy). Peers that don't enable it keep using the plain protocols.
+// RPC frames smaller than minSize bytes, or that don't shrink, are sent uncompressed.
+// Inbound frames are rejected if they decompress beyond the maximum RPC size.
+func WithCompression(c Compression, minSize int) Option {
+	return func(p *PubSub) error {
+		if !c.valid() {
+			return fmt.Errorf("unknown compression %q", c)
+		}
+		if minSize < 0 {
+			return fmt.Errorf("negative compression threshold")
+		}
+		p.compression = &rpcCompression{codec: c, minSize: minSize}
+		return nil
+	}
+}
+
+func (c Compression) valid() bool {
+	for _, other := range compressions {
+		if c == other {
+			return true
+		}
+	}
+	return false
+}
+
+// suffix returns the protocol ID suffix of the compressed protocol variant
+func (c Compression) suffix() string {
+	return "/" + string(c)
+}
+
+// compressionOf returns the compression negotiated by a stream protocol ID, or "" if none
+func compressionOf(id protocol.ID) Compression {
+	for _, c := range compressions {
+		if strings.HasSuffix(string(id), c.suffix()) {
+			return c
+		}
+	}
+	return ""
+}
+
+// trimCompression strips the compression suffix of a stream protocol ID
+func trimCompression(id protocol.ID) protocol.ID {
+	if c := compressionOf(id); c != "" {
+		return protocol.ID(strings.TrimSuffix(string(id), c.suffix()))
+	}
+	return id
+}
+
+// CompressionStats are the counters of the RPC frames of the compressed protocol variants.
+type CompressionStats struct {
+	// FramesCompressed is the number of outbound frames sent compressed.
+	FramesCompressed uint64
+	// FramesUncompressed is the number of outbound frames sent uncompressed, because they were
+	// smaller than the threshold or didn't shrink.
+	FramesUncompressed uint64
+	// BytesOut is the size of the outbound RPCs before compression.
+	BytesOut uint64
+	// WireBytesOut is the size of the outbound frames on the wire.
+	WireBytesOut uint64
+	// BytesIn is the size of the inbound RPCs after decompression.
+	BytesIn uint64
+	// WireBytesIn is the size of the inbound frames on the wire.
+	WireBytesIn uint64
+	// Rejected is the number of inbound frames rejected for decompressing beyond the maximum RPC
+	// size, or failing to decompress.
+	Rejected uint64
+}
+
+// OutboundRatio returns the compression ratio of the outbound frames, as the size before
+// compression over the size on the wire; 0 if none was sent.
+func (s CompressionStats) OutboundRatio() float64 {
+	if s.WireBytesOut == 0 {
+		return 0
+	}
+	return float64(s.BytesOut) / float64(s.WireBytesOut)
+}
+
+// InboundRatio returns the compression ratio of the inbound frames, as the size after
+// decompression over the size on the wire; 0 if none was received.
+func (s CompressionStats) InboundRatio() float64 {
+	if s.WireBytesIn == 0 {
+		return 0
+	}
+	return float64(s.BytesIn) / float64(s.WireBytesIn)
+}
+
+// CompressionStats returns the counters of the compressed protocol variants; all zero unless
+// WithCompression is set.
+func (p *PubSub) CompressionStats() CompressionStats {
+	c := p.compression
+	if c == nil {
+		return CompressionStats{}
+	}
+	return CompressionStats{
+		FramesCompressed:   c.framesCompressed.Load(),
+		FramesUncompressed: c.framesUncompressed.Load(),
+		BytesOut:           c.bytesOut.Load(),
+		WireBytesOut:       c.wireBytesOut.Load(),
+		BytesIn:            c.bytesIn.Load(),
+		WireBytesIn:        c.wireBytesIn.Load(),
+		Rejected:           c.rejected.Load(),
+	}
+}
+
+// rpcCompression is the configuration and counters of the compressed protocol variant
+type rpcCompression struct {
+	codec   Compression
+	minSize int
+
+	framesCompressed   atomic.Uint64
+	framesUncompressed atomic.Uint64
+	bytesOut           atomic.Uint64
+	wireBytesOut       atomic.Uint64
+	bytesIn            atomic.Uint64
+	wireBytesIn        atomic.Uint64
+	rejected           atomic.Uint64
+}
+
+// encode returns the frame of a marshalled RPC for the given compression
+func (c *rpcCompression) encode(codec Compression, raw []byte) ([]byte, error) {
+	var frame []byte
+	if len(raw) >= c.minSize {
+		compressed, err := compress(codec, raw)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed) < len(raw) {
+			frame = append([]byte{frameCompressed}, compressed...)
+		}
+	}
+
+	if frame == nil {
+		frame = append([]byte{frameUncompressed}, raw...)
+		c.framesUncompressed.Add(1)
+	} else {
+		c.framesCompressed.Add(1)
+	}
+	c.bytesOut.Add(uint64(len(raw)))
+	c.wireBytesOut.Add(uint64(len(frame)))
+	return frame, nil
+}
+
+// decode returns the marshalled RPC of a frame for the given compression, failing with
+// ErrDecompressedTooLarge if it exceeds limit bytes
+func (c *rpcCompression) decode(codec Compression, frame []byte, limit int) ([]byte, error) {
+	if len(frame) == 0 {
+		return nil, fmt.Errorf("empty rpc frame")
+	}
+
+	var raw []byte
+	switch frame[0] {
+	case frameUncompressed:
+		raw = frame[1:]
+		if len(raw) > limit {
+			return nil, ErrDecompressedTooLarge
+		}
+	case frameCompressed:
+		var err error
+		raw, err = decompress(codec, frame[1:], limit)
+		if err != nil {
+			c.rejected.Add(1)
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown rpc frame flag %d", frame[0])
+	}
+
+	c.bytesIn.Add(uint64(len(raw)))
+	c.wireBytesIn.Add(uint64(len(frame)))
+	return raw, nil
+}
+
+func compress(codec Compression, raw []byte) ([]byte, error) {
+	switch codec {
+	case CompressionSnappy:
+		return snappy.Encode(nil, raw), nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(raw); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q", codec)
+	}
+}
+
+// decompress decompresses data without ever allocating more than limit bytes
+func decompress(codec Compression, data []byte, limit int) ([]byte, error) {
+	switch codec {
+	case CompressionSnappy:
+		n, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if n > limit {
+			return nil, ErrDecompressedTooLarge
+		}
+		return snappy.Decode(nil, data)
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		raw, err := io.ReadAll(io.LimitReader(zr, int64(limit)+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) > limit {
+			return nil, ErrDecompressedTooLarge
+		}
+		return raw, nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q", codec)
+	}
+}
+
+// streamProtocols returns the stream protocol IDs of the router protocols, with their
+// compressed and, if bidi, bidirectional variants, in order of preference
+func (p *PubSub) streamProtocols(bidi bool) []protocol.ID {
+	suffixes := []string{""}
+	if p.compression != nil {
+		suffixes = []string{p.compression.codec.suffix(), ""}
+	}
+	if bidi {
+		variants := make([]string, 0, 2*len(suffixes))
+		for _, s := range suffixes {
+			variants = append(variants, BidiProtocolSuffix+s)
+		}
+		suffixes = append(variants, suffixes...)
+	}
+
+	ids := p.rt.Protocols()
+	res := make([]protocol.ID, 0, len(suffixes)*len(ids))
+	for _, s := range suffixes {
+		for _, id := range ids {
+			res = append(res, id+protocol.ID(s))
+		}
+	}
+	return res
+}
+
+// variantMatchFunc adapts a protocol match function of a router protocol to a variant of the
+// protocol with the given suffix
+func variantMatchFunc(suffix string, match func(protocol.ID) bool) func(protocol.ID) bool {
+	return func(id protocol.ID) bool {
+		return strings.HasSuffix(string(id), suffix) && match(id[:len(id)-len(suffix)])
+	}
+}
@@ -0,0 +1,94 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCompression(t *testing.T) {
+	for _, c := range []Compression{CompressionSnappy, CompressionGzip} {
+		t.Run(string(c), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			hosts := getNetHosts(t, ctx, 3)
+			psubs := []*PubSub{
+				getGossipsub(ctx, hosts[0], WithCompression(c, 256)),
+				getGossipsub(ctx, hosts[1], WithCompression(c, 256), WithBidirectionalStreams()),
+				getGossipsub(ctx, hosts[2]),
+			}
+
+			var subs []*Subscription
+			for _, ps := range psubs {
+				subs = append(subs, mustSubscribe(t, ps, "test"))
+			}
+			connect(t, hosts[0], hosts[1])
+			connect(t, hosts[0], hosts[2])
+			time.Sleep(2 * time.Second)
+
+			// the compressed variant is negotiated only with the peer enabling it
+			for _, s := range pubsubStreams(hosts[0], hosts[1].ID()) {
+				if compressionOf(s.Protocol()) != c {
+					t.Fatalf("expected a compressed stream, got %s", s.Protocol())
+				}
+			}
+			for _, s := range pubsubStreams(hosts[0], hosts[2].ID()) {
+				if compressionOf(s.Protocol()) != "" {
+					t.Fatalf("expected a plain stream, got %s", s.Protocol())
+				}
+			}
+
+			large := bytes.Repeat([]byte(`{"key":"value"},`), 1000)
+			for _, msg := range [][]byte{[]byte("small"), large} {
+				if err := psubs[1].Publish("test", msg); err != nil {
+					t.Fatal(err)
+				}
+				for _, sub := range subs {
+					assertReceive(t, sub, msg)
+				}
+			}
+
+			stats := psubs[1].CompressionStats()
+			if stats.FramesCompressed == 0 || stats.FramesUncompressed == 0 {
+				t.Fatalf("expected both compressed and uncompressed frames, got %+v", stats)
+			}
+			if ratio := stats.OutboundRatio(); ratio < 2 {
+				t.Fatalf("expected a high compression ratio, got %f", ratio)
+			}
+			if ratio := psubs[0].CompressionStats().InboundRatio(); ratio < 2 {
+				t.Fatalf("expected a high inbound compression ratio, got %f", ratio)
+			}
+			if stats := psubs[2].CompressionStats(); stats != (CompressionStats{}) {
+				t.Fatalf("expected no compression stats, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestDecompressionBomb(t *testing.T) {
+	for _, c := range []Compression{CompressionSnappy, CompressionGzip} {
+		t.Run(string(c), func(t *testing.T) {
+			rc := &rpcCompression{codec: c}
+			frame, err := rc.encode(c, make([]byte, 1<<20))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frame[0] != frameCompressed || len(frame) > 1<<16 {
+				t.Fatalf("expected a small compressed frame, got %d bytes", len(frame))
+			}
+
+			if _, err := rc.decode(c, frame, 1<<16); err != ErrDecompressedTooLarge {
+				t.Fatalf("expected the frame to be rejected, got %v", err)
+			}
+			raw, err := rc.decode(c, frame, 1<<20)
+			if err != nil || len(raw) != 1<<20 {
+				t.Fatalf("expected the frame to decompress within the limit: %v", err)
+			}
+			if rc.rejected.Load() != 1 {
+				t.Fatalf("expected a rejected frame, got %d", rc.rejected.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package pubsub
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// CongestionTracer is an optional interface for RawTracers, which is invoked at the heartbeat for
+// the peers deemed congested, having dropped at least CongestionThreshold RPCs since the previous
+// one because their outbound queue was full.
+type CongestionTracer interface {
+	PeerCongested(p peer.ID, drops int)
+}
+
+// congestedPeers returns the peers which dropped at least CongestionThreshold RPCs since the last
+// heartbeat, with their number of drops, tracing them, and starts a new window.
+func (gs *GossipSubRouter) congestedPeers() map[peer.ID]int {
+	if len(gs.drops) == 0 {
+		return nil
+	}
+
+	var congested map[peer.ID]int
+	if gs.params.CongestionThreshold > 0 {
+		for p, drops := range gs.drops {
+			if drops < gs.params.CongestionThreshold {
+				continue
+			}
+			if congested == nil {
+				congested = make(map[peer.ID]int)
+			}
+			congested[p] = drops
+			gs.tracer.PeerCongested(p, drops)
+		}
+	}
+
+	clear(gs.drops)
+	return congested
+}
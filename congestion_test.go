@@ -0,0 +1,141 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+type congestionTracer struct {
+	noopRawTracer
+
+	mx        sync.Mutex
+	congested map[peer.ID]int
+}
+
+func (ct *congestionTracer) PeerCongested(p peer.ID, drops int) {
+	ct.mx.Lock()
+	defer ct.mx.Unlock()
+	ct.congested[p] = drops
+}
+
+func (ct *congestionTracer) take() map[peer.ID]int {
+	ct.mx.Lock()
+	defer ct.mx.Unlock()
+	congested := ct.congested
+	ct.congested = make(map[peer.ID]int)
+	return congested
+}
+
+func TestCongestedPeersPruned(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	params := DefaultGossipSubParams()
+	params.D = 4
+	params.Dlo = 2
+	params.Dhi = 6
+	params.Dscore = 2
+	params.Dout = 1
+	params.CongestionThreshold = 5
+
+	tracer := &congestionTracer{congested: make(map[peer.ID]int)}
+	hosts := getNetHosts(t, ctx, 5)
+	psubs := []*PubSub{getGossipsub(ctx, hosts[0], WithGossipSubParams(params), WithManualHeartbeat(), WithRawTracer(tracer))}
+	psubs = append(psubs, getGossipsubs(ctx, hosts[1:])...)
+
+	for _, h := range hosts[1:] {
+		connect(t, hosts[0], h)
+	}
+	time.Sleep(100 * time.Millisecond)
+	for _, ps := range psubs {
+		mustSubscribe(t, ps, "test")
+	}
+	// let the peers graft us at their heartbeat
+	time.Sleep(2 * time.Second)
+
+	if n := len(psubs[0].meshPeers("test")); n != 4 {
+		t.Fatalf("expected 4 mesh peers, got %d", n)
+	}
+
+	// three peers are congested, and one is just below the threshold
+	gs := psubs[0].rt.(*GossipSubRouter)
+	done := make(chan struct{})
+	psubs[0].eval <- func() {
+		for i, h := range hosts[1:] {
+			gs.drops[h.ID()] = 5
+			if i == 3 {
+				gs.drops[h.ID()] = 4
+			}
+		}
+		close(done)
+	}
+	<-done
+
+	if err := psubs[0].TriggerHeartbeat(); err != nil {
+		t.Fatal(err)
+	}
+
+	congested := tracer.take()
+	if len(congested) != 3 {
+		t.Fatalf("expected 3 congested peers, got %d", len(congested))
+	}
+	for _, h := range hosts[1:4] {
+		if congested[h.ID()] != 5 {
+			t.Fatalf("expected peer %s to be congested with 5 drops", h.ID())
+		}
+	}
+
+	// the mesh is pruned down to Dlo, keeping the uncongested peer
+	mesh := psubs[0].meshPeers("test")
+	if len(mesh) != 2 {
+		t.Fatalf("expected the mesh to be pruned down to 2 peers, got %d", len(mesh))
+	}
+	found := false
+	for _, p := range mesh {
+		if p == hosts[4].ID() {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("expected the uncongested peer to stay in the mesh")
+	}
+
+	// the drops are counted anew at every heartbeat
+	if err := psubs[0].TriggerHeartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	if congested := tracer.take(); len(congested) != 0 {
+		t.Fatalf("expected no congested peer, got %d", len(congested))
+	}
+}
+
+func TestPeerDropStats(t *testing.T) {
+	s := newPubSubStats()
+	s.outboundDropped("a")
+	s.outboundDropped("a")
+	s.outboundDropped("b")
+
+	drops := s.snapshot(true).Drops
+	if drops.OutboundQueueFull != 3 {
+		t.Fatalf("expected 3 drops, got %d", drops.OutboundQueueFull)
+	}
+	if drops.OutboundQueueFullByPeer["a"] != 2 || drops.OutboundQueueFullByPeer["b"] != 1 {
+		t.Fatalf("unexpected drops by peer: %v", drops.OutboundQueueFullByPeer)
+	}
+
+	// reset counters are left out, and the peers gone are forgotten
+	s.outboundDropped("a")
+	s.removePeer("b")
+	drops = s.snapshot(false).Drops
+	if len(drops.OutboundQueueFullByPeer) != 1 || drops.OutboundQueueFullByPeer["a"] != 1 {
+		t.Fatalf("unexpected drops by peer: %v", drops.OutboundQueueFullByPeer)
+	}
+	s.removePeer("a")
+	if drops := s.snapshot(false).Drops; drops.OutboundQueueFullByPeer != nil {
+		t.Fatalf("expected no drops by peer, got %v", drops.OutboundQueueFullByPeer)
+	}
+}
@@ -0,0 +1,127 @@
+package pubsub
+
+import (
+	"context"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+// ControlProtocolSuffix is appended to the router protocol IDs to negotiate control streams.
+const ControlProtocolSuffix = "/control"
+
+// WithControlStreams makes the pubsub instance open a second stream to the peers that support
+// it, carrying the subscriptions and control messages, so that they don't queue behind large
+// data messages. Peers that don't support control streams get everything on a single stream.
+// Both streams of a peer are torn down together when the peer dies.
+func WithControlStreams() Option {
+	return func(p *PubSub) error {
+		p.controlStreams = true
+		return nil
+	}
+}
+
+// isControlProtocol returns whether a protocol ID negotiates a control stream
+func isControlProtocol(id protocol.ID) bool {
+	return strings.HasSuffix(string(id), ControlProtocolSuffix)
+}
+
+// controlProtocols returns the control stream protocol IDs of the router protocols
+func (p *PubSub) controlProtocols() []protocol.ID {
+	ids := p.rt.Protocols()
+	res := make([]protocol.ID, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, id+ControlProtocolSuffix)
+	}
+	return res
+}
+
+// openControlStream opens a control stream with the peer of a stream, for the same router
+// protocol; it returns nil if the peer doesn't support control streams. The protocols of the
+// peer may not be identified yet, so the negotiation is always attempted.
+func (p *PubSub) openControlStream(s network.Stream) network.Stream {
+	pid := s.Conn().RemotePeer()
+	id := routerProtocol(s.Protocol()) + ControlProtocolSuffix
+
+	cs, err := p.host.NewStream(p.ctx, pid, id)
+	if err != nil {
+		log.Debugf("opening control stream to %s: %s", pid, err)
+		return nil
+	}
+	return cs
+}
+
+// startSending starts writing the outgoing RPCs of a peer to a stream, with the subscriptions
+// and control messages split off to a control stream if enabled and supported by the peer
+func (p *PubSub) startSending(ctx context.Context, s network.Stream, outgoing <-chan *RPC) peerStream {
+	var cs network.Stream
+	if p.controlStreams {
+		cs = p.openControlStream(s)
+	}
+	if cs == nil {
+		go p.handleSendingMessages(ctx, s, outgoing)
+		return peerStream{s: s}
+	}
+
+	// the split is unbuffered, so that the RPCs wait in the outbound queue of the peer, where
+	// its congestion is measured
+	data := make(chan *RPC)
+	control := make(chan *RPC)
+	go p.splitControl(ctx, s.Conn().RemotePeer(), outgoing, data, control)
+	go p.handleSendingMessages(ctx, s, data)
+	go p.handleSendingMessages(ctx, cs, control)
+	go p.handleControlStreamDead(s, cs)
+	return peerStream{s: s, control: true}
+}
+
+// splitControl dispatches the outgoing RPCs of a peer to its data and control streams, closing
+// both once the peer is gone
+func (p *PubSub) splitControl(ctx context.Context, pid peer.ID, outgoing <-chan *RPC, data, control chan<- *RPC) {
+	defer close(data)
+	defer close(control)
+
+	for {
+		select {
+		case rpc, ok := <-outgoing:
+			if !ok {
+				return
+			}
+			if len(rpc.Subscriptions) > 0 || rpc.Control != nil {
+				ctl := &RPC{RPC: pb.RPC{Subscriptions: rpc.Subscriptions, Control: rpc.Control}}
+				select {
+				case control <- ctl:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if len(rpc.Publish) > 0 {
+				msgs := &RPC{RPC: pb.RPC{Publish: rpc.Publish}, wire: rpc.wire, origins: rpc.origins}
+				select {
+				case data <- msgs:
+				case <-ctx.Done():
+					return
+				}
+			}
+			// the RPC is queued until the writers take it
+			p.dequeuedRPC(pid, rpc)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleControlStreamDead tears down the data stream of a peer once its control stream is reset,
+// which declares the peer dead
+func (p *PubSub) handleControlStreamDead(s, cs network.Stream) {
+	_, err := cs.Read([]byte{0})
+	if err == nil {
+		log.Debugf("unexpected message on control stream from %s", cs.Conn().RemotePeer())
+	}
+
+	cs.Reset()
+	s.Reset()
+}
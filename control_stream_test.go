@@ -0,0 +1,104 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// countControlStreams counts the data and control streams among pubsub streams
+func countControlStreams(streams []network.Stream) (data, control int) {
+	for _, s := range streams {
+		if isControlProtocol(s.Protocol()) {
+			control++
+		} else {
+			data++
+		}
+	}
+	return data, control
+}
+
+func TestControlStreams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getGossipsubs(ctx, hosts, WithControlStreams())
+
+	var subs []*Subscription
+	for _, ps := range psubs {
+		subs = append(subs, mustSubscribe(t, ps, "test"))
+	}
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(2 * time.Second)
+
+	for i := range hosts {
+		data, control := countControlStreams(pubsubStreams(hosts[i], hosts[1-i].ID()))
+		if data != 2 || control != 2 {
+			t.Fatalf("expected a data and a control stream in each direction, got %d and %d", data, control)
+		}
+	}
+
+	// the peers are grafted through the control streams, and messages flow
+	for i, ps := range psubs {
+		if peers := ps.ListPeers("test"); len(peers) != 1 {
+			t.Fatalf("expected the peer to be subscribed, got %v", peers)
+		}
+		if err := ps.Publish("test", []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		assertReceive(t, subs[1-i], []byte("hello"))
+		assertReceive(t, subs[i], []byte("hello"))
+	}
+
+	// resetting the control stream tears down both streams of the writer, which reopens them
+	for _, s := range pubsubStreams(hosts[0], hosts[1].ID()) {
+		if isControlProtocol(s.Protocol()) && s.Stat().Direction == network.DirOutbound {
+			s.Reset()
+		}
+	}
+	time.Sleep(2 * time.Second)
+
+	for i := range hosts {
+		data, control := countControlStreams(pubsubStreams(hosts[i], hosts[1-i].ID()))
+		if data != 2 || control != 2 {
+			t.Fatalf("expected the streams to be reopened, got %d and %d", data, control)
+		}
+	}
+	if err := psubs[1].Publish("test", []byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, subs[0], []byte("again"))
+}
+
+func TestControlStreamsFallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := []*PubSub{
+		getGossipsub(ctx, hosts[0], WithControlStreams()),
+		getGossipsub(ctx, hosts[1]),
+	}
+
+	var subs []*Subscription
+	for _, ps := range psubs {
+		subs = append(subs, mustSubscribe(t, ps, "test"))
+	}
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(2 * time.Second)
+
+	data, control := countControlStreams(pubsubStreams(hosts[0], hosts[1].ID()))
+	if data != 2 || control != 0 {
+		t.Fatalf("expected only data streams, got %d and %d", data, control)
+	}
+
+	for i, ps := range psubs {
+		if err := ps.Publish("test", []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		assertReceive(t, subs[1-i], []byte("hello"))
+	}
+}
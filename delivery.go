@@ -0,0 +1,199 @@
+package pubsub
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithTopicDelivery delivers the messages of each topic to its subscriptions from a goroutine of
+// the topic, through a queue of up to queueSize messages, instead of from the event loop. This
+// isolates the topics from each other: delivery waits up to maxWait for a slow subscription to
+// make room for a message before dropping it for that subscription, which only holds up the
+// delivery of its own topic. Messages are dropped when the queue of their topic is full.
+// The messages of a topic are delivered in order.
+func WithTopicDelivery(queueSize int, maxWait time.Duration) Option {
+	return func(p *PubSub) error {
+		if queueSize <= 0 {
+			return fmt.Errorf("invalid topic delivery queue size %d", queueSize)
+		}
+		if maxWait < 0 {
+			return fmt.Errorf("invalid topic delivery wait %s", maxWait)
+		}
+		p.deliveryQueueSize = queueSize
+		p.deliveryMaxWait = maxWait
+		return nil
+	}
+}
+
+// topicDelivery delivers the messages of a topic to its subscriptions
+type topicDelivery struct {
+	p     *PubSub
+	topic string
+	queue chan *Message
+
+	// the subscription changes to apply before delivering the next message
+	mx      sync.Mutex
+	pending []deliveryOp
+	wake    chan struct{}
+
+	// subs are the subscriptions of the topic, owned by the delivery goroutine
+	subs map[*Subscription]struct{}
+}
+
+type deliveryOp struct {
+	sub    *Subscription
+	remove bool
+	stop   bool
+}
+
+// topicDelivery returns the delivery of a topic, starting it if needed.
+// Only called from processLoop.
+func (p *PubSub) topicDelivery(topic string) *topicDelivery {
+	td, ok := p.deliveries[topic]
+	if !ok {
+		td = &topicDelivery{
+			p:     p,
+			topic: topic,
+			queue: make(chan *Message, p.deliveryQueueSize),
+			wake:  make(chan struct{}, 1),
+			subs:  make(map[*Subscription]struct{}),
+		}
+		p.deliveries[topic] = td
+		go td.loop()
+	}
+	return td
+}
+
+// addDeliverySubscription starts delivering messages to a subscription from the goroutine of its
+// topic, if enabled.
+// Only called from processLoop.
+func (p *PubSub) addDeliverySubscription(sub *Subscription) {
+	if p.deliveryQueueSize > 0 {
+		p.topicDelivery(sub.topic).push(deliveryOp{sub: sub})
+	}
+}
+
+// closeSubscription stops delivering messages to a subscription and closes it, which is left to
+// the delivery goroutine of its topic if any, as it may be delivering a message to it.
+// Only called from processLoop.
+func (p *PubSub) closeSubscription(sub *Subscription) {
+	td, ok := p.deliveries[sub.topic]
+	if !ok {
+		sub.close()
+		return
+	}
+
+	td.push(deliveryOp{sub: sub, remove: true})
+}
+
+// stopDelivery stops the delivery goroutine of a topic without subscriptions left, if any.
+// Only called from processLoop.
+func (p *PubSub) stopDelivery(topic string) {
+	td, ok := p.deliveries[topic]
+	if !ok {
+		return
+	}
+
+	td.push(deliveryOp{stop: true})
+	delete(p.deliveries, topic)
+}
+
+// deliver queues a message for delivery to the subscriptions of its topic.
+// Only called from processLoop.
+func (td *topicDelivery) deliver(msg *Message) {
+	select {
+	case td.queue <- msg:
+	default:
+		td.p.stats.subscriptionQueueFull.Add(1)
+		td.p.tracer.UndeliverableMessage(msg)
+		log.Infof("Can't deliver message to subscriptions for topic %s; delivery queue full", td.topic)
+	}
+}
+
+func (td *topicDelivery) push(op deliveryOp) {
+	td.mx.Lock()
+	td.pending = append(td.pending, op)
+	td.mx.Unlock()
+
+	select {
+	case td.wake <- struct{}{}:
+	default:
+	}
+}
+
+// apply applies the pending subscription changes, returning false once stopped
+func (td *topicDelivery) apply() bool {
+	td.mx.Lock()
+	ops := td.pending
+	td.pending = nil
+	td.mx.Unlock()
+
+	for _, op := range ops {
+		switch {
+		case op.stop:
+			return false
+		case op.remove:
+			delete(td.subs, op.sub)
+			op.sub.close()
+		default:
+			td.subs[op.sub] = struct{}{}
+		}
+	}
+	return true
+}
+
+func (td *topicDelivery) loop() {
+	var timer *time.Timer
+	for {
+		select {
+		case msg := <-td.queue:
+			if !td.apply() {
+				return
+			}
+			for sub := range td.subs {
+				if !td.send(sub, msg, &timer) {
+					return
+				}
+			}
+		case <-td.wake:
+			if !td.apply() {
+				return
+			}
+		case <-td.p.ctx.Done():
+			return
+		}
+	}
+}
+
+// send delivers a message to a subscription, waiting up to the maximum delivery wait for room;
+// it returns false if the pubsub instance is shutting down
+func (td *topicDelivery) send(sub *Subscription, msg *Message, timer **time.Timer) bool {
+	if td.p.offerMessage(sub, msg) {
+		return true
+	}
+
+	if td.p.deliveryMaxWait > 0 {
+		if *timer == nil {
+			*timer = time.NewTimer(td.p.deliveryMaxWait)
+		} else {
+			(*timer).Reset(td.p.deliveryMaxWait)
+		}
+
+		select {
+		case sub.ch <- msg:
+			if !(*timer).Stop() {
+				<-(*timer).C
+			}
+			return true
+		case <-(*timer).C:
+		case <-td.p.ctx.Done():
+			return false
+		}
+	}
+
+	td.p.stats.subscriptionQueueFull.Add(1)
+	td.p.tracer.UndeliverableMessage(msg)
+	log.Infof("Can't deliver message to subscription for topic %s; subscriber too slow", td.topic)
+	return true
+}
@@ -0,0 +1,112 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTopicDelivery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0], WithTopicDelivery(64, time.Second))
+
+	fast := mustSubscribe(t, ps, "fast")
+	slow := mustSubscribe(t, ps, "slow")
+
+	// the slow subscriber doesn't read until the end, filling its subscription, so that the
+	// delivery of its topic waits on it for every message
+	const count = 100
+	var latencies []time.Duration
+	for i := 0; i < count; i++ {
+		if err := ps.Publish("slow", []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+
+		data := binary.AppendVarint(nil, time.Now().UnixNano())
+		if err := ps.Publish("fast", data); err != nil {
+			t.Fatal(err)
+		}
+		rctx, rcancel := context.WithTimeout(ctx, 5*time.Second)
+		msg, err := fast.Next(rctx)
+		rcancel()
+		if err != nil {
+			t.Fatalf("message %d of the fast topic not received: %s", i, err)
+		}
+		sent, _ := binary.Varint(msg.Data)
+		latencies = append(latencies, time.Since(time.Unix(0, sent)))
+	}
+
+	slices.Sort(latencies)
+	p99 := latencies[count*99/100-1]
+	t.Logf("fast topic delivery latency: p50 %s, p99 %s", latencies[count/2], p99)
+	if p99 > 250*time.Millisecond {
+		t.Fatalf("fast topic held up by the slow topic: p99 latency %s", p99)
+	}
+
+	// the slow subscription gets its messages in order, missing those that didn't fit
+	last := -1
+	for {
+		rctx, rcancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		msg, err := slow.Next(rctx)
+		rcancel()
+		if err != nil {
+			break
+		}
+		var i int
+		fmt.Sscan(string(msg.Data), &i)
+		if i <= last {
+			t.Fatalf("slow topic message %d delivered after %d", i, last)
+		}
+		last = i
+	}
+	if last < 0 {
+		t.Fatal("no message delivered to the slow subscription")
+	}
+}
+
+func TestTopicDeliveryCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0], WithTopicDelivery(16, 10*time.Millisecond))
+
+	// subscriptions come and go while messages are being delivered to them
+	for round := 0; round < 10; round++ {
+		var subs []*Subscription
+		for i := 0; i < 3; i++ {
+			subs = append(subs, mustSubscribe(t, ps, "test"))
+		}
+		for i := 0; i < 50; i++ {
+			if err := ps.Publish("test", []byte(fmt.Sprint(i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, sub := range subs {
+			sub.Cancel()
+		}
+	}
+
+	// a new subscription still gets messages after the topic delivery was stopped
+	sub := mustSubscribe(t, ps, "test")
+	if err := ps.Publish("test", []byte("last")); err != nil {
+		t.Fatal(err)
+	}
+	rctx, rcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer rcancel()
+	for {
+		msg, err := sub.Next(rctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg.Data) == "last" {
+			break
+		}
+	}
+}
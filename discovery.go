@@ -2,7 +2,11 @@ package pubsub
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math/rand"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/discovery"
@@ -29,6 +33,16 @@ type DiscoverOpt func(*discoverOptions) error
 type discoverOptions struct {
 	connFactory BackoffConnectorFactory
 	opts        []discovery.Option
+	tag         func(topic string) string
+
+	pollInterval time.Duration
+	jitter       float64
+	backoff      discimpl.BackoffFactory
+
+	breakerThreshold int
+	breakerInterval  time.Duration
+
+	dialParams *DiscoveryDialParams
 }
 
 func defaultDiscoverOptions() *discoverOptions {
@@ -54,6 +68,9 @@ type discover struct {
 	// discovery assists in discovering and advertising peers for a topic
 	discovery discovery.Discovery
 
+	// peerSource provides candidate peers for a topic alongside discovery
+	peerSource PeerSource
+
 	// advertising tracks which topics are being advertised
 	advertising map[string]context.CancelFunc
 
@@ -69,22 +86,96 @@ type discover struct {
 	// connector handles connecting to new peers found via discovery
 	connector *discimpl.BackoffConnector
 
+	// dialer connects to new peers found via discovery in place of the connector, if dial limits
+	// are set
+	dialer *discoveryDialer
+
 	// options are the set of options to be used to complete struct construction in Start
 	options *discoverOptions
+
+	// topicState tracks the discovery of topics; only accessed from the event loop
+	topicState map[string]*topicDiscoveryState
+
+	// pollInterval is the interval at which topics are checked for missing peers
+	pollInterval time.Duration
+}
+
+// TopicDiscoveryParams configures peer discovery for a Topic.
+type TopicDiscoveryParams struct {
+	// MinPeers is the minimum number of peers the topic should have; discovery searches for more
+	// peers while the topic has fewer.
+	MinPeers int
+	// ReadvertiseInterval is the interval at which the topic is advertised; if 0, the TTL
+	// returned by the discovery service is used.
+	ReadvertiseInterval time.Duration
+	// SearchInterval is the initial interval between searches while the topic is below MinPeers;
+	// it is doubled after each search up to MaxSearchInterval, and reset once the topic reaches
+	// MinPeers. If 0, DiscoveryPollInterval is used.
+	SearchInterval time.Duration
+	// MaxSearchInterval is the maximum interval between searches.
+	MaxSearchInterval time.Duration
+	// BelowMinimumTimeout is how long the topic may stay below MinPeers before OnBelowMinimum
+	// is invoked.
+	BelowMinimumTimeout time.Duration
+	// OnBelowMinimum is invoked, in its own goroutine, once each time the topic stays below
+	// MinPeers for longer than BelowMinimumTimeout, with the current number of peers.
+	OnBelowMinimum func(topic string, peers int)
+}
+
+// WithTopicDiscovery sets the discovery parameters of a Topic.
+// Topics are searched in order of how far below their minimum number of peers they are.
+func WithTopicDiscovery(params TopicDiscoveryParams) TopicOpt {
+	return func(t *Topic) error {
+		if params.MinPeers <= 0 {
+			return fmt.Errorf("invalid minimum number of peers: %d", params.MinPeers)
+		}
+		if params.SearchInterval == 0 {
+			params.SearchInterval = DiscoveryPollInterval
+		}
+		if params.MaxSearchInterval < params.SearchInterval {
+			params.MaxSearchInterval = params.SearchInterval
+		}
+		t.discovery = &params
+		return nil
+	}
+}
+
+type topicDiscoveryState struct {
+	belowSince     time.Time
+	notified       bool
+	searchInterval time.Duration
+	nextSearch     time.Time
+
+	// backoff spaces the searches of topics without TopicDiscoveryParams, if configured
+	backoff discimpl.BackoffStrategy
+
+	// emptyResults counts the consecutive searches that found no peers; the topic is paused until
+	// pausedUntil once it reaches the circuit breaker threshold
+	emptyResults int
+	pausedUntil  time.Time
 }
 
 // MinTopicSize returns a function that checks if a router is ready for publishing based on the topic size.
 // The router ultimately decides the whether it is ready or not, the given size is just a suggestion. Note
-// that the topic size does not include the router in the count.
+// that the topic size does not include the router in the count. While not ready, the error is an
+// ErrNotEnoughPeers reporting the size needed.
 func MinTopicSize(size int) RouterReady {
 	return func(rt PubSubRouter, topic string) (bool, error) {
-		return rt.EnoughPeers(topic, size), nil
+		if rt.EnoughPeers(topic, size) {
+			return true, nil
+		}
+		return false, ErrNotEnoughPeers{Topic: topic, Needed: size}
 	}
 }
 
+// enabled returns whether peers are searched for, with a discovery service or a peer source
+func (d *discover) enabled() bool {
+	return d.discovery != nil || d.peerSource != nil
+}
+
 // Start attaches the discovery pipeline to a pubsub instance, initializes discovery and starts event loop
 func (d *discover) Start(p *PubSub, opts ...DiscoverOpt) error {
-	if d.discovery == nil || p == nil {
+	if !d.enabled() || p == nil {
 		return nil
 	}
 
@@ -93,12 +184,22 @@ func (d *discover) Start(p *PubSub, opts ...DiscoverOpt) error {
 	d.discoverQ = make(chan *discoverReq, 32)
 	d.ongoing = make(map[string]struct{})
 	d.done = make(chan string)
+	d.topicState = make(map[string]*topicDiscoveryState)
 
-	conn, err := d.options.connFactory(p.host)
-	if err != nil {
-		return err
+	d.pollInterval = d.options.pollInterval
+	if d.pollInterval == 0 {
+		d.pollInterval = DiscoveryPollInterval
+	}
+
+	if d.options.dialParams != nil {
+		d.dialer = newDiscoveryDialer(p.host, *d.options.dialParams, p.clock)
+	} else {
+		conn, err := d.options.connFactory(p.host)
+		if err != nil {
+			return err
+		}
+		d.connector = conn
 	}
-	d.connector = conn
 
 	go d.discoverLoop()
 	go d.pollTimer()
@@ -108,7 +209,7 @@ func (d *discover) Start(p *PubSub, opts ...DiscoverOpt) error {
 
 func (d *discover) pollTimer() {
 	select {
-	case <-time.After(DiscoveryPollInitialDelay):
+	case <-d.p.clock.After(DiscoveryPollInitialDelay):
 	case <-d.p.ctx.Done():
 		return
 	}
@@ -119,12 +220,9 @@ func (d *discover) pollTimer() {
 		return
 	}
 
-	ticker := time.NewTicker(DiscoveryPollInterval)
-	defer ticker.Stop()
-
 	for {
 		select {
-		case <-ticker.C:
+		case <-d.p.clock.After(d.pollDelay()):
 			select {
 			case d.p.eval <- d.requestDiscovery:
 			case <-d.p.ctx.Done():
@@ -136,12 +234,155 @@ func (d *discover) pollTimer() {
 	}
 }
 
+// pollDelay returns the poll interval, randomized by the configured jitter so that nodes started
+// together don't poll the discovery service in lockstep.
+func (d *discover) pollDelay() time.Duration {
+	if d.options.jitter == 0 {
+		return d.pollInterval
+	}
+	jitter := time.Duration((2*rand.Float64() - 1) * d.options.jitter * float64(d.pollInterval))
+	return d.pollInterval + jitter
+}
+
 func (d *discover) requestDiscovery() {
-	for t := range d.p.myTopics {
-		if !d.p.rt.EnoughPeers(t, 0) {
-			d.discoverQ <- &discoverReq{topic: t, done: make(chan struct{}, 1)}
+	type candidate struct {
+		topic   string
+		deficit int
+	}
+
+	var candidates []candidate
+	for t, topic := range d.p.myTopics {
+		if topic.noDiscovery {
+			continue
+		}
+		if topic.discovery == nil {
+			if d.p.rt.EnoughPeers(t, 0) {
+				d.resetSearch(t)
+			} else if d.searchDue(t) {
+				candidates = append(candidates, candidate{topic: t})
+			}
+			continue
+		}
+
+		if deficit := d.checkTopic(t, topic.discovery); deficit > 0 {
+			candidates = append(candidates, candidate{topic: t, deficit: deficit})
 		}
 	}
+
+	for t := range d.topicState {
+		if _, ok := d.p.myTopics[t]; !ok {
+			delete(d.topicState, t)
+		}
+	}
+
+	// search for the topics furthest below their minimum first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].deficit > candidates[j].deficit
+	})
+	for _, c := range candidates {
+		d.discoverQ <- &discoverReq{topic: c.topic, done: make(chan struct{}, 1)}
+	}
+}
+
+// getTopicState returns the discovery state of a topic, creating it if needed
+func (d *discover) getTopicState(topic string) *topicDiscoveryState {
+	state, ok := d.topicState[topic]
+	if !ok {
+		state = &topicDiscoveryState{}
+		if t, ok := d.p.myTopics[topic]; ok && t.discovery != nil {
+			state.searchInterval = t.discovery.SearchInterval
+		} else if d.options.backoff != nil {
+			state.backoff = d.options.backoff()
+		}
+		d.topicState[topic] = state
+	}
+	return state
+}
+
+// searchDue returns whether a topic without TopicDiscoveryParams, which lacks peers, is due for
+// a search according to the discovery backoff and circuit breaker.
+func (d *discover) searchDue(topic string) bool {
+	now := d.p.clock.Now()
+	state := d.getTopicState(topic)
+
+	if now.Before(state.pausedUntil) {
+		return false
+	}
+	if state.backoff == nil {
+		return true
+	}
+	if now.Before(state.nextSearch) {
+		return false
+	}
+	state.nextSearch = now.Add(state.backoff.Delay())
+	return true
+}
+
+// resetSearch resets the backoff of a topic without TopicDiscoveryParams once it has enough peers
+func (d *discover) resetSearch(topic string) {
+	state, ok := d.topicState[topic]
+	if !ok || state.backoff == nil {
+		return
+	}
+	state.backoff.Reset()
+	state.nextSearch = time.Time{}
+}
+
+// handleResult accounts for the number of peers found by a search, tripping the circuit breaker
+// of the topic after too many consecutive empty results.
+func (d *discover) handleResult(topic string, found int) {
+	if _, ok := d.p.myTopics[topic]; !ok {
+		return
+	}
+	state := d.getTopicState(topic)
+
+	if found > 0 {
+		state.emptyResults = 0
+		state.pausedUntil = time.Time{}
+		return
+	}
+
+	state.emptyResults++
+	if d.options.breakerThreshold > 0 && state.emptyResults >= d.options.breakerThreshold {
+		log.Debugf("pausing discovery for topic %s after %d empty results", topic, state.emptyResults)
+		state.pausedUntil = d.p.clock.Now().Add(d.options.breakerInterval)
+	}
+}
+
+// checkTopic updates the discovery state of a topic with TopicDiscoveryParams, returning the
+// number of peers it is missing if it is due for a search.
+func (d *discover) checkTopic(topic string, params *TopicDiscoveryParams) int {
+	now := d.p.clock.Now()
+	peers := len(d.p.topics[topic])
+
+	state := d.getTopicState(topic)
+
+	if peers >= params.MinPeers {
+		state.belowSince = time.Time{}
+		state.notified = false
+		state.searchInterval = params.SearchInterval
+		state.nextSearch = time.Time{}
+		return 0
+	}
+
+	if state.belowSince.IsZero() {
+		state.belowSince = now
+	}
+	if !state.notified && params.OnBelowMinimum != nil && now.Sub(state.belowSince) > params.BelowMinimumTimeout {
+		state.notified = true
+		go params.OnBelowMinimum(topic, peers)
+	}
+
+	if now.Before(state.nextSearch) || now.Before(state.pausedUntil) {
+		return 0
+	}
+	state.nextSearch = now.Add(state.searchInterval)
+	state.searchInterval *= 2
+	if state.searchInterval > params.MaxSearchInterval {
+		state.searchInterval = params.MaxSearchInterval
+	}
+
+	return params.MinPeers - peers
 }
 
 func (d *discover) discoverLoop() {
@@ -158,7 +399,11 @@ func (d *discover) discoverLoop() {
 			d.ongoing[topic] = struct{}{}
 
 			go func() {
-				d.handleDiscovery(d.p.ctx, topic, discover.opts)
+				found := d.handleDiscovery(d.p.ctx, topic, discover.opts)
+				select {
+				case d.p.eval <- func() { d.handleResult(topic, found) }:
+				case <-d.p.ctx.Done():
+				}
 				select {
 				case d.done <- topic:
 				case <-d.p.ctx.Done():
@@ -179,6 +424,10 @@ func (d *discover) Advertise(topic string) {
 		return
 	}
 
+	if t, ok := d.p.myTopics[topic]; ok && t.noDiscovery {
+		return
+	}
+
 	advertisingCtx, cancel := context.WithCancel(d.p.ctx)
 
 	if _, ok := d.advertising[topic]; ok {
@@ -187,6 +436,11 @@ func (d *discover) Advertise(topic string) {
 	}
 	d.advertising[topic] = cancel
 
+	var readvertise time.Duration
+	if t, ok := d.p.myTopics[topic]; ok && t.discovery != nil {
+		readvertise = t.discovery.ReadvertiseInterval
+	}
+
 	go func() {
 		next, err := d.discovery.Advertise(advertisingCtx, topic)
 		if err != nil {
@@ -194,22 +448,22 @@ func (d *discover) Advertise(topic string) {
 			if next == 0 {
 				next = discoveryAdvertiseRetryInterval
 			}
+		} else if readvertise > 0 {
+			next = readvertise
 		}
 
-		t := time.NewTimer(next)
-		defer t.Stop()
-
 		for advertisingCtx.Err() == nil {
 			select {
-			case <-t.C:
+			case <-d.p.clock.After(next):
 				next, err = d.discovery.Advertise(advertisingCtx, topic)
 				if err != nil {
 					log.Warnf("bootstrap: error providing rendezvous for %s: %s", topic, err.Error())
 					if next == 0 {
 						next = discoveryAdvertiseRetryInterval
 					}
+				} else if readvertise > 0 {
+					next = readvertise
 				}
-				t.Reset(next)
 			case <-advertisingCtx.Done():
 				return
 			}
@@ -231,7 +485,7 @@ func (d *discover) StopAdvertise(topic string) {
 
 // Discover searches for additional peers interested in a given topic
 func (d *discover) Discover(topic string, opts ...discovery.Option) {
-	if d.discovery == nil {
+	if !d.enabled() {
 		return
 	}
 
@@ -240,16 +494,10 @@ func (d *discover) Discover(topic string, opts ...discovery.Option) {
 
 // Bootstrap attempts to bootstrap to a given topic. Returns true if bootstrapped successfully, false otherwise.
 func (d *discover) Bootstrap(ctx context.Context, topic string, ready RouterReady, opts ...discovery.Option) bool {
-	if d.discovery == nil {
+	if !d.enabled() {
 		return true
 	}
 
-	t := time.NewTimer(time.Hour)
-	if !t.Stop() {
-		<-t.C
-	}
-	defer t.Stop()
-
 	for {
 		// Check if ready for publishing
 		bootstrapped := make(chan bool, 1)
@@ -285,9 +533,8 @@ func (d *discover) Bootstrap(ctx context.Context, topic string, ready RouterRead
 			return false
 		}
 
-		t.Reset(time.Millisecond * 100)
 		select {
-		case <-t.C:
+		case <-d.p.clock.After(time.Millisecond * 100):
 		case <-d.p.ctx.Done():
 			return false
 		case <-ctx.Done():
@@ -296,17 +543,110 @@ func (d *discover) Bootstrap(ctx context.Context, topic string, ready RouterRead
 	}
 }
 
-func (d *discover) handleDiscovery(ctx context.Context, topic string, opts []discovery.Option) {
+// handleDiscovery searches for peers in a topic and connects to them, returning the number of
+// peers found.
+func (d *discover) handleDiscovery(ctx context.Context, topic string, opts []discovery.Option) int {
 	discoverCtx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
 
-	peerCh, err := d.discovery.FindPeers(discoverCtx, topic, opts...)
+	d.p.tracer.DiscoveryAttempt(topic)
+
+	peerCh, err := d.findPeers(discoverCtx, topic, opts)
 	if err != nil {
 		log.Debugf("error finding peers for topic %s: %v", topic, err)
-		return
+		d.p.tracer.DiscoveryResult(topic, 0, err)
+		return 0
+	}
+
+	var found atomic.Int32
+	counted := make(chan peer.AddrInfo)
+	go func() {
+		defer close(counted)
+		for pi := range peerCh {
+			if pi.ID != d.p.host.ID() {
+				found.Add(1)
+			}
+			select {
+			case counted <- pi:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if d.dialer != nil {
+		d.dialer.Connect(ctx, counted)
+	} else {
+		d.connector.Connect(ctx, counted)
+	}
+	n := int(found.Load())
+	d.p.tracer.DiscoveryResult(topic, n, nil)
+	return n
+}
+
+// findPeers searches for peers in a topic with the discovery service and the peer source,
+// merging their results without duplicates.
+func (d *discover) findPeers(ctx context.Context, topic string, opts []discovery.Option) (<-chan peer.AddrInfo, error) {
+	var sources []<-chan peer.AddrInfo
+	var errs []error
+
+	if d.peerSource != nil {
+		var options discovery.Options
+		if err := options.Apply(append(opts, d.options.opts...)...); err != nil {
+			return nil, err
+		}
+
+		peers, err := d.peerSource(ctx, topic, options.Limit)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			ch := make(chan peer.AddrInfo, len(peers))
+			for _, pi := range peers {
+				ch <- pi
+			}
+			close(ch)
+			sources = append(sources, ch)
+		}
+	}
+
+	if d.discovery != nil {
+		ch, err := d.discovery.FindPeers(ctx, topic, opts...)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			sources = append(sources, ch)
+		}
 	}
 
-	d.connector.Connect(ctx, peerCh)
+	switch len(sources) {
+	case 0:
+		return nil, errors.Join(errs...)
+	case 1:
+		return sources[0], nil
+	}
+
+	merged := make(chan peer.AddrInfo)
+	go func() {
+		defer close(merged)
+
+		seen := make(map[peer.ID]struct{})
+		for _, ch := range sources {
+			for pi := range ch {
+				if _, ok := seen[pi.ID]; ok {
+					continue
+				}
+				seen[pi.ID] = struct{}{}
+
+				select {
+				case merged <- pi:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return merged, nil
 }
 
 type discoverReq struct {
@@ -317,15 +657,23 @@ type discoverReq struct {
 
 type pubSubDiscovery struct {
 	discovery.Discovery
-	opts []discovery.Option
+	options *discoverOptions
+}
+
+// namespace returns the discovery namespace of a topic
+func (d *pubSubDiscovery) namespace(topic string) string {
+	if d.options.tag != nil {
+		topic = d.options.tag(topic)
+	}
+	return "floodsub:" + topic
 }
 
 func (d *pubSubDiscovery) Advertise(ctx context.Context, ns string, opts ...discovery.Option) (time.Duration, error) {
-	return d.Discovery.Advertise(ctx, "floodsub:"+ns, append(opts, d.opts...)...)
+	return d.Discovery.Advertise(ctx, d.namespace(ns), append(opts, d.options.opts...)...)
 }
 
 func (d *pubSubDiscovery) FindPeers(ctx context.Context, ns string, opts ...discovery.Option) (<-chan peer.AddrInfo, error) {
-	return d.Discovery.FindPeers(ctx, "floodsub:"+ns, append(opts, d.opts...)...)
+	return d.Discovery.FindPeers(ctx, d.namespace(ns), append(opts, d.options.opts...)...)
 }
 
 // WithDiscoveryOpts passes libp2p Discovery options into the PubSub discovery subsystem
@@ -336,6 +684,113 @@ func WithDiscoveryOpts(opts ...discovery.Option) DiscoverOpt {
 	}
 }
 
+// WithDiscoveryTag maps topic names to the tag that is advertised and searched for in their
+// place, e.g. to hash topic names for privacy. The tag is still prefixed with the pubsub
+// namespace, and the mapping must be the same for all peers of a topic.
+func WithDiscoveryTag(tag func(topic string) string) DiscoverOpt {
+	return func(d *discoverOptions) error {
+		d.tag = tag
+		return nil
+	}
+}
+
+// PeerSource provides up to limit candidate peers for a topic, e.g. from an external registry;
+// a limit of 0 means no limit.
+type PeerSource func(ctx context.Context, topic string, limit int) ([]peer.AddrInfo, error)
+
+// WithPeerSource provides candidate peers for topics without or alongside a discovery service.
+// The peer source is consulted whenever discovery searches for peers, and its candidates are
+// merged with those of the discovery service, if any; topics are not advertised to it.
+// The options configure the discovery subsystem like with WithDiscovery, and are shared with it.
+func WithPeerSource(src PeerSource, opts ...DiscoverOpt) Option {
+	return func(p *PubSub) error {
+		if src == nil {
+			return fmt.Errorf("nil peer source")
+		}
+		if p.disc.options == nil {
+			p.disc.options = defaultDiscoverOptions()
+		}
+		for _, opt := range opts {
+			if err := opt(p.disc.options); err != nil {
+				return err
+			}
+		}
+
+		p.disc.peerSource = src
+		return nil
+	}
+}
+
+// WithNoDiscovery excludes a Topic from discovery: it is neither advertised nor searched for,
+// even when publishing with WithReadiness.
+func WithNoDiscovery() TopicOpt {
+	return func(t *Topic) error {
+		t.noDiscovery = true
+		return nil
+	}
+}
+
+// WithDiscoveryPollInterval sets how often topics are checked for missing peers; the default
+// is DiscoveryPollInterval.
+func WithDiscoveryPollInterval(interval time.Duration) DiscoverOpt {
+	return func(d *discoverOptions) error {
+		if interval <= 0 {
+			return fmt.Errorf("invalid discovery poll interval: %s", interval)
+		}
+		d.pollInterval = interval
+		return nil
+	}
+}
+
+// WithDiscoveryJitter randomizes each poll interval by up to the given fraction of it, in
+// either direction, so that nodes started simultaneously spread their searches.
+func WithDiscoveryJitter(jitter float64) DiscoverOpt {
+	return func(d *discoverOptions) error {
+		if jitter < 0 || jitter >= 1 {
+			return fmt.Errorf("invalid discovery jitter: %f", jitter)
+		}
+		d.jitter = jitter
+		return nil
+	}
+}
+
+// WithDiscoveryBackoff sets the backoff strategy between the searches of a topic that has too
+// few peers; the backoff is reset once the topic has enough peers. By default a topic is
+// searched at every poll. Topics with TopicDiscoveryParams use their own search intervals.
+func WithDiscoveryBackoff(backoff discimpl.BackoffFactory) DiscoverOpt {
+	return func(d *discoverOptions) error {
+		d.backoff = backoff
+		return nil
+	}
+}
+
+// WithDiscoveryCircuitBreaker pauses the discovery of a topic for the given interval after
+// threshold consecutive searches found no peers. The topic is searched again once the interval
+// elapses, and is paused again as long as searches stay empty.
+func WithDiscoveryCircuitBreaker(threshold int, interval time.Duration) DiscoverOpt {
+	return func(d *discoverOptions) error {
+		if threshold <= 0 {
+			return fmt.Errorf("invalid circuit breaker threshold: %d", threshold)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("invalid circuit breaker interval: %s", interval)
+		}
+		d.breakerThreshold = threshold
+		d.breakerInterval = interval
+		return nil
+	}
+}
+
+// DiscoveryTracer is an optional interface for RawTracers, which is invoked for the peer
+// searches of the discovery subsystem. It is invoked from the discovery goroutines, so it
+// must be safe for concurrent use.
+type DiscoveryTracer interface {
+	// DiscoveryAttempt is invoked when a search for peers in a topic starts.
+	DiscoveryAttempt(topic string)
+	// DiscoveryResult is invoked when a search completes, with the number of peers found.
+	DiscoveryResult(topic string, found int, err error)
+}
+
 // BackoffConnectorFactory creates a BackoffConnector that is attached to a given host
 type BackoffConnectorFactory func(host host.Host) (*discimpl.BackoffConnector, error)
 
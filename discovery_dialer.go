@@ -0,0 +1,263 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// DiscoveryDialParams bounds the connections initiated by the discovery subsystem.
+type DiscoveryDialParams struct {
+	// MaxConcurrentDials is the maximum number of discovery dials in flight; 0 disables the limit.
+	MaxConcurrentDials int
+	// DialBudget is the maximum number of discovery dials per BudgetInterval; 0 disables the limit.
+	DialBudget int
+	// BudgetInterval is the interval over which DialBudget applies.
+	BudgetInterval time.Duration
+	// DialTimeout is the timeout of each dial.
+	DialTimeout time.Duration
+	// FailureBackoff is how long a candidate is skipped after a failed dial.
+	FailureBackoff time.Duration
+	// MaxFailures is the number of consecutive failed dials after which a candidate is skipped
+	// for FailureCooldown instead.
+	MaxFailures int
+	// FailureCooldown is how long a persistently unreachable candidate is skipped.
+	FailureCooldown time.Duration
+}
+
+// DefaultDiscoveryDialParams returns the default discovery dial parameters.
+func DefaultDiscoveryDialParams() DiscoveryDialParams {
+	return DiscoveryDialParams{
+		MaxConcurrentDials: 8,
+		DialBudget:         64,
+		BudgetInterval:     time.Minute,
+		DialTimeout:        time.Minute,
+		FailureBackoff:     10 * time.Second,
+		MaxFailures:        3,
+		FailureCooldown:    10 * time.Minute,
+	}
+}
+
+// WithDiscoveryDialLimits bounds the dials to the peers found by discovery, in place of the
+// connector. Candidates that are already connected, being dialed or recently failed are skipped.
+func WithDiscoveryDialLimits(params DiscoveryDialParams) DiscoverOpt {
+	return func(d *discoverOptions) error {
+		if params.MaxConcurrentDials < 0 || params.DialBudget < 0 || params.MaxFailures < 0 {
+			return fmt.Errorf("invalid discovery dial limits")
+		}
+		if params.BudgetInterval <= 0 || params.DialTimeout <= 0 {
+			return fmt.Errorf("invalid discovery dial intervals")
+		}
+		d.dialParams = &params
+		return nil
+	}
+}
+
+// DiscoveryStats are the counters of the dials initiated by discovery; they are only tracked
+// with WithDiscoveryDialLimits. Dials aborted because pubsub shuts down are neither counted as
+// succeeded nor as failed.
+type DiscoveryStats struct {
+	DialsAttempted uint64 `json:"dialsAttempted"`
+	DialsSucceeded uint64 `json:"dialsSucceeded"`
+	DialsFailed    uint64 `json:"dialsFailed"`
+}
+
+// DiscoveryStats returns the counters of the dials initiated by discovery; they are also
+// included in Stats.
+func (p *PubSub) DiscoveryStats() DiscoveryStats {
+	return p.disc.dialer.stats(false)
+}
+
+// stats returns the dial counters, resetting them if asked to
+func (dd *discoveryDialer) stats(reset bool) DiscoveryStats {
+	if dd == nil {
+		return DiscoveryStats{}
+	}
+
+	load := func(c *atomic.Uint64) uint64 {
+		if reset {
+			return c.Swap(0)
+		}
+		return c.Load()
+	}
+	return DiscoveryStats{
+		DialsAttempted: load(&dd.attempted),
+		DialsSucceeded: load(&dd.succeeded),
+		DialsFailed:    load(&dd.failed),
+	}
+}
+
+// discoveryDialer connects to the peers found by discovery within the dial limits
+type discoveryDialer struct {
+	host   host.Host
+	params DiscoveryDialParams
+	clock  Clock
+
+	// sem bounds the concurrent dials, if limited
+	sem chan struct{}
+
+	mx          sync.Mutex
+	budgetStart time.Time
+	budgetUsed  int
+	dialing     map[peer.ID]struct{}
+	failures    map[peer.ID]*dialFailures
+
+	attempted, succeeded, failed atomic.Uint64
+}
+
+type dialFailures struct {
+	count     int
+	last      time.Time
+	skipUntil time.Time
+}
+
+func newDiscoveryDialer(h host.Host, params DiscoveryDialParams, clock Clock) *discoveryDialer {
+	dd := &discoveryDialer{
+		host:        h,
+		params:      params,
+		clock:       clock,
+		budgetStart: clock.Now(),
+		dialing:     make(map[peer.ID]struct{}),
+		failures:    make(map[peer.ID]*dialFailures),
+	}
+	if params.MaxConcurrentDials > 0 {
+		dd.sem = make(chan struct{}, params.MaxConcurrentDials)
+	}
+	return dd
+}
+
+// Connect dials the candidates received from the channel until it is closed; it blocks while
+// the concurrent dial limit is reached.
+func (dd *discoveryDialer) Connect(ctx context.Context, peerCh <-chan peer.AddrInfo) {
+	for {
+		select {
+		case pi, ok := <-peerCh:
+			if !ok {
+				return
+			}
+			if !dd.admit(pi.ID) {
+				continue
+			}
+
+			if dd.sem != nil {
+				select {
+				case dd.sem <- struct{}{}:
+				case <-ctx.Done():
+					dd.abort(pi.ID)
+					return
+				}
+			}
+
+			go func(pi peer.AddrInfo) {
+				if dd.sem != nil {
+					defer func() { <-dd.sem }()
+				}
+				dd.dial(ctx, pi)
+			}(pi)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// admit checks whether a candidate should be dialed, charging it to the dial budget
+func (dd *discoveryDialer) admit(p peer.ID) bool {
+	if p == "" || p == dd.host.ID() || dd.host.Network().Connectedness(p) == network.Connected {
+		return false
+	}
+
+	dd.mx.Lock()
+	defer dd.mx.Unlock()
+
+	now := dd.clock.Now()
+	if now.Sub(dd.budgetStart) >= dd.params.BudgetInterval {
+		dd.budgetStart = now
+		dd.budgetUsed = 0
+		dd.sweep(now)
+	}
+
+	if _, ok := dd.dialing[p]; ok {
+		return false
+	}
+	if f, ok := dd.failures[p]; ok && now.Before(f.skipUntil) {
+		return false
+	}
+	if dd.params.DialBudget > 0 && dd.budgetUsed >= dd.params.DialBudget {
+		log.Debugf("discovery dial budget exhausted; skipping %s", p)
+		return false
+	}
+
+	dd.budgetUsed++
+	dd.dialing[p] = struct{}{}
+	return true
+}
+
+func (dd *discoveryDialer) dial(ctx context.Context, pi peer.AddrInfo) {
+	dd.attempted.Add(1)
+
+	dialCtx, cancel := context.WithTimeout(ctx, dd.params.DialTimeout)
+	defer cancel()
+
+	err := dd.host.Connect(dialCtx, pi)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// the dial was cut short on our side, which says nothing about the candidate
+		dd.abort(pi.ID)
+		return
+	case err != nil:
+		log.Debugf("error connecting to discovered peer %s: %s", pi.ID, err)
+		dd.failed.Add(1)
+	default:
+		dd.succeeded.Add(1)
+	}
+	dd.done(pi.ID, err)
+}
+
+// abort forgets a dial that didn't complete because we stopped it
+func (dd *discoveryDialer) abort(p peer.ID) {
+	dd.mx.Lock()
+	defer dd.mx.Unlock()
+
+	delete(dd.dialing, p)
+}
+
+// done records the outcome of a dial
+func (dd *discoveryDialer) done(p peer.ID, err error) {
+	dd.mx.Lock()
+	defer dd.mx.Unlock()
+
+	delete(dd.dialing, p)
+	if err == nil {
+		delete(dd.failures, p)
+		return
+	}
+
+	now := dd.clock.Now()
+	f, ok := dd.failures[p]
+	if !ok {
+		f = &dialFailures{}
+		dd.failures[p] = f
+	}
+	f.count++
+	f.last = now
+	if dd.params.MaxFailures > 0 && f.count >= dd.params.MaxFailures {
+		f.skipUntil = now.Add(dd.params.FailureCooldown)
+	} else {
+		f.skipUntil = now.Add(dd.params.FailureBackoff)
+	}
+}
+
+// sweep forgets the failures of candidates that haven't been dialed for a cooldown period
+func (dd *discoveryDialer) sweep(now time.Time) {
+	for p, f := range dd.failures {
+		if now.Sub(f.last) > dd.params.FailureCooldown && now.After(f.skipUntil) {
+			delete(dd.failures, p)
+		}
+	}
+}
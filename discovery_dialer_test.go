@@ -0,0 +1,110 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/discovery"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+func TestDiscoveryDialLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const ns = "floodsub:foobar"
+
+	hosts := getNetHosts(t, ctx, 7)
+	dead := hosts[6]
+	deadInfo := *host.InfoFromHost(dead)
+	dead.Close()
+
+	params := DefaultDiscoveryDialParams()
+	params.MaxConcurrentDials = 1
+	params.BudgetInterval = time.Hour
+	params.DialTimeout = time.Second
+	params.MaxFailures = 1
+	params.FailureCooldown = time.Hour
+
+	// the first peer may only dial 2 of the 4 discovered peers
+	budgeted := newDiscoveryServer()
+	for _, h := range hosts[2:6] {
+		budgeted.Advertise(ns, *host.InfoFromHost(h), time.Hour)
+	}
+	limited := params
+	limited.DialBudget = 2
+	ps0 := getPubsub(ctx, hosts[0], WithDiscovery(&mockDiscoveryClient{hosts[0], budgeted},
+		WithDiscoveryOpts(discovery.Limit(10)),
+		WithDiscoveryPollInterval(50*time.Millisecond),
+		WithDiscoveryDialLimits(limited)))
+
+	// the second peer doesn't redial a connected peer, nor an unreachable one during its cooldown
+	unreachable := newDiscoveryServer()
+	unreachable.Advertise(ns, *host.InfoFromHost(hosts[2]), time.Hour)
+	unreachable.Advertise(ns, deadInfo, time.Hour)
+	unlimited := params
+	unlimited.DialBudget = 0
+	ps1 := getPubsub(ctx, hosts[1], WithDiscovery(&mockDiscoveryClient{hosts[1], unreachable},
+		WithDiscoveryOpts(discovery.Limit(10)),
+		WithDiscoveryPollInterval(50*time.Millisecond),
+		WithDiscoveryDialLimits(unlimited)))
+
+	for _, ps := range []*PubSub{ps0, ps1} {
+		if _, err := ps.Subscribe("foobar"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(2 * time.Second)
+
+	stats := ps0.DiscoveryStats()
+	if stats.DialsAttempted != 2 || stats.DialsSucceeded != 2 || stats.DialsFailed != 0 {
+		t.Fatalf("expected 2 successful dials within the budget, got %+v", stats)
+	}
+	connected := 0
+	for _, h := range hosts[2:6] {
+		if hosts[0].Network().Connectedness(h.ID()) == network.Connected {
+			connected++
+		}
+	}
+	if connected != 2 {
+		t.Fatalf("expected 2 connected peers, got %d", connected)
+	}
+
+	stats = ps1.DiscoveryStats()
+	if stats.DialsAttempted != 2 || stats.DialsSucceeded != 1 || stats.DialsFailed != 1 {
+		t.Fatalf("expected a single dial to each candidate, got %+v", stats)
+	}
+	if s := ps1.Stats(WithStatsReset()).Discovery; s != stats {
+		t.Fatalf("expected the discovery counters in the stats, got %+v", s)
+	}
+	if s := ps1.DiscoveryStats(); s != (DiscoveryStats{}) {
+		t.Fatalf("expected the discovery counters to be reset, got %+v", s)
+	}
+}
+
+func TestDiscoveryDialAborted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	target := *host.InfoFromHost(hosts[1])
+	hosts[1].Close()
+
+	dd := newDiscoveryDialer(hosts[0], DefaultDiscoveryDialParams(), realClock{})
+	if !dd.admit(target.ID) {
+		t.Fatal("expected the candidate to be admitted")
+	}
+
+	// a dial cut short by our own shutdown is not a failure of the candidate
+	dialCtx, dialCancel := context.WithCancel(ctx)
+	dialCancel()
+	dd.dial(dialCtx, target)
+	if stats := dd.stats(false); stats.DialsFailed != 0 || stats.DialsSucceeded != 0 {
+		t.Fatalf("expected the aborted dial not to be counted, got %+v", stats)
+	}
+	if !dd.admit(target.ID) {
+		t.Fatal("expected the candidate to be admitted again after an aborted dial")
+	}
+}
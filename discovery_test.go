@@ -3,6 +3,7 @@ package pubsub
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"math/rand"
 	"sync"
@@ -307,3 +308,311 @@ func waitUntilGossipsubMeshCount(ps *PubSub, topic string, count int) {
 		}
 	}
 }
+
+func TestTopicDiscoveryMinPeers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const topic = "foobar"
+
+	server := newDiscoveryServer()
+	discOpts := []discovery.Option{discovery.Limit(10), discovery.TTL(time.Minute)}
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := make([]*PubSub, 2)
+	for i, h := range hosts {
+		disc := &mockDiscoveryClient{h, server}
+		psubs[i] = getPubsub(ctx, h, WithDiscovery(disc, WithDiscoveryOpts(discOpts...)))
+	}
+
+	below := make(chan int, 1)
+	tp, err := psubs[0].Join(topic, WithTopicDiscovery(TopicDiscoveryParams{
+		MinPeers:            1,
+		SearchInterval:      100 * time.Millisecond,
+		MaxSearchInterval:   time.Second,
+		BelowMinimumTimeout: 500 * time.Millisecond,
+		OnBelowMinimum: func(topic string, peers int) {
+			below <- peers
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.Subscribe(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case peers := <-below:
+		if peers != 0 {
+			t.Fatalf("expected no peers, got %d", peers)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected to be notified of the topic being below its minimum")
+	}
+
+	// the other peer is discovered once it advertises the topic
+	if _, err := psubs[1].Subscribe(topic); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; len(psubs[0].ListPeers(topic)) == 0; i++ {
+		if i == 100 {
+			t.Fatal("the peer was never discovered")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if _, err := psubs[1].Join("other", WithTopicDiscovery(TopicDiscoveryParams{})); err == nil {
+		t.Fatal("expected an error without a minimum number of peers")
+	}
+}
+
+func TestDiscoveryTagAndOptOut(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := newDiscoveryServer()
+	discOpts := []discovery.Option{discovery.Limit(10), discovery.TTL(time.Minute)}
+	tag := func(topic string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(topic)))
+	}
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := make([]*PubSub, 2)
+	for i, h := range hosts {
+		disc := &mockDiscoveryClient{h, server}
+		psubs[i] = getPubsub(ctx, h, WithDiscovery(disc, WithDiscoveryOpts(discOpts...), WithDiscoveryTag(tag)))
+	}
+
+	internal, err := psubs[0].Join("internal", WithNoDiscovery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := internal.Subscribe(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := psubs[0].Subscribe("public"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the public topic is discovered under its tag
+	if _, err := psubs[1].Subscribe("public"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; len(psubs[1].ListPeers("public")) == 0; i++ {
+		if i == 100 {
+			t.Fatal("the peer was never discovered")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if !server.hasPeerRecord("floodsub:"+tag("public"), hosts[0].ID()) {
+		t.Fatal("expected the public topic to be advertised under its tag")
+	}
+	if server.hasPeerRecord("floodsub:public", hosts[0].ID()) {
+		t.Fatal("expected the topic name not to be advertised")
+	}
+	if server.hasPeerRecord("floodsub:"+tag("internal"), hosts[0].ID()) || server.hasPeerRecord("floodsub:internal", hosts[0].ID()) {
+		t.Fatal("expected the internal topic not to be advertised")
+	}
+}
+
+type discoveryTracer struct {
+	noopRawTracer
+
+	mx       sync.Mutex
+	attempts int
+	results  int
+	found    int
+}
+
+func (t *discoveryTracer) DiscoveryAttempt(topic string) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.attempts++
+}
+
+func (t *discoveryTracer) DiscoveryResult(topic string, found int, err error) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.results++
+	t.found += found
+}
+
+func (t *discoveryTracer) counts() (attempts, results, found int) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return t.attempts, t.results, t.found
+}
+
+func TestDiscoveryCircuitBreaker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := newDiscoveryServer()
+	clk := newMockClock()
+	tracer := &discoveryTracer{}
+
+	hosts := getNetHosts(t, ctx, 1)
+	disc := &mockDiscoveryClient{hosts[0], server}
+	ps := getPubsub(ctx, hosts[0],
+		WithClock(clk),
+		WithRawTracer(tracer),
+		WithDiscovery(disc,
+			WithDiscoveryOpts(discovery.Limit(10), discovery.TTL(time.Minute)),
+			WithDiscoveryPollInterval(20*time.Millisecond),
+			WithDiscoveryJitter(0.5),
+			WithDiscoveryCircuitBreaker(3, time.Minute)))
+
+	if _, err := ps.Subscribe("lonely"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the breaker trips after 3 empty searches, with the polls driven by the clock
+	for i := 0; i < 10; i++ {
+		time.Sleep(50 * time.Millisecond)
+		clk.Add(30 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	attempts, results, found := tracer.counts()
+	if attempts != 3 || results != 3 || found != 0 {
+		t.Fatalf("expected 3 empty searches, got %d attempts and %d results with %d peers", attempts, results, found)
+	}
+
+	// and discovery resumes once the breaker interval elapses, pausing again after an empty result
+	clk.Add(time.Minute + time.Second)
+	time.Sleep(500 * time.Millisecond)
+	if attempts, _, _ := tracer.counts(); attempts != 4 {
+		t.Fatalf("expected a single search after the breaker interval, got %d attempts", attempts)
+	}
+
+	if _, err := NewFloodSub(ctx, hosts[0], WithDiscovery(disc, WithDiscoveryJitter(1))); err == nil {
+		t.Fatal("expected an error for an invalid jitter")
+	}
+}
+
+func TestTopicBootstrap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const topic = "foobar"
+
+	server := newDiscoveryServer()
+	discOpts := []discovery.Option{discovery.Limit(10), discovery.TTL(time.Minute)}
+
+	hosts := getNetHosts(t, ctx, 3)
+	psubs := make([]*PubSub, 3)
+	for i, h := range hosts {
+		disc := &mockDiscoveryClient{h, server}
+		psubs[i] = getPubsub(ctx, h, WithDiscovery(disc, WithDiscoveryOpts(discOpts...)))
+	}
+	for _, ps := range psubs[1:] {
+		if _, err := ps.Subscribe(topic); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tp, err := psubs[0].Join(topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bctx, bcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer bcancel()
+	peers, err := tp.Bootstrap(bctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peers != 2 {
+		t.Fatalf("expected 2 peers, got %d", peers)
+	}
+
+	// there are no more peers to reach
+	bctx, bcancel = context.WithTimeout(ctx, 500*time.Millisecond)
+	defer bcancel()
+	peers, err = tp.Bootstrap(bctx, 3)
+	if err != context.DeadlineExceeded || peers != 2 {
+		t.Fatalf("expected to time out with 2 peers, got %d peers and error %v", peers, err)
+	}
+
+	// closing the topic doesn't wait for a bootstrap, which then fails
+	res := make(chan error, 1)
+	go func() {
+		_, err := tp.Bootstrap(ctx, 3)
+		res <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	closed := make(chan error, 1)
+	go func() { closed <- tp.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the topic to close during the bootstrap")
+	}
+	select {
+	case err := <-res:
+		if err != ErrTopicClosed {
+			t.Fatalf("expected ErrTopicClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the bootstrap to end with the topic")
+	}
+
+	internal, err := psubs[0].Join("internal", WithNoDiscovery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := internal.Bootstrap(ctx, 1); err != ErrNoDiscovery {
+		t.Fatalf("expected ErrNoDiscovery, got %v", err)
+	}
+}
+
+func TestPeerSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const topic = "foobar"
+
+	server := newDiscoveryServer()
+	discOpts := []discovery.Option{discovery.Limit(10), discovery.TTL(time.Minute)}
+
+	hosts := getNetHosts(t, ctx, 4)
+	registry := func(ctx context.Context, topic string, limit int) ([]peer.AddrInfo, error) {
+		if limit != 10 {
+			return nil, fmt.Errorf("unexpected limit %d", limit)
+		}
+		return []peer.AddrInfo{*host.InfoFromHost(hosts[1]), *host.InfoFromHost(hosts[2])}, nil
+	}
+
+	// 0 merges the registry with the discovery service, 3 only uses the registry
+	psubs := []*PubSub{
+		getPubsub(ctx, hosts[0], WithDiscovery(&mockDiscoveryClient{hosts[0], server}, WithDiscoveryOpts(discOpts...)), WithPeerSource(registry)),
+		getPubsub(ctx, hosts[1]),
+		getPubsub(ctx, hosts[2], WithDiscovery(&mockDiscoveryClient{hosts[2], server}, WithDiscoveryOpts(discOpts...))),
+		getPubsub(ctx, hosts[3], WithPeerSource(registry, WithDiscoveryOpts(discOpts...))),
+	}
+	for _, ps := range psubs[1:3] {
+		if _, err := ps.Subscribe(topic); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, i := range []int{0, 3} {
+		tp, err := psubs[i].Join(topic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bctx, bcancel := context.WithTimeout(ctx, 5*time.Second)
+		peers, err := tp.Bootstrap(bctx, 2)
+		bcancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if peers != 2 {
+			t.Fatalf("expected 2 peers, got %d", peers)
+		}
+	}
+}
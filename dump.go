@@ -0,0 +1,220 @@
+package pubsub
+
+import (
+	"context"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// StateDump is a copy of the state of pubsub and its router, for debugging. It shares nothing
+// with the live state, so it can be kept and serialized, e.g. as JSON.
+type StateDump struct {
+	// Topics is the state of the known topics, keyed by topic.
+	Topics map[string]*TopicDump
+	// Peers is the state of the connected peers.
+	Peers map[peer.ID]*PeerDump
+	// Direct are the direct peers of gossipsub, connected or not.
+	Direct []peer.ID
+	// Gater is the state of the peer gater, if enabled.
+	Gater *PeerGaterSnapshot
+}
+
+// TopicDump is the state of a topic.
+type TopicDump struct {
+	// Subscribed is whether we are subscribed to the topic.
+	Subscribed bool
+	// Peers are the peers subscribed to the topic.
+	Peers []peer.ID
+	// Mesh are the gossipsub mesh peers of the topic, if we joined it.
+	Mesh []peer.ID
+	// Fanout are the gossipsub fanout peers of the topic, if we publish to it without joining.
+	Fanout []peer.ID
+	// Backoffs are the expirations of the prune backoffs of the topic, keyed by peer.
+	Backoffs map[peer.ID]time.Time
+}
+
+// PeerDump is the state of a peer.
+type PeerDump struct {
+	// Protocol is the pubsub protocol of the peer.
+	Protocol protocol.ID
+	// Direct is whether the peer is a direct peer.
+	Direct bool
+	// Outbound is whether we have an outbound connection to the peer.
+	Outbound bool
+	// Score are the score components of the peer, if scoring is enabled.
+	Score *PeerScoreSnapshot
+	// Promises is the number of messages the peer promised in gossip and hasn't delivered yet.
+	Promises int
+	// QueueLen and QueueCap are the occupancy and the capacity of the outbound queue of the peer.
+	QueueLen, QueueCap int
+	// Capabilities are the protocol and the optional features active with the peer, if our
+	// stream to the peer is set up.
+	Capabilities *PeerCapabilities
+}
+
+// DumpOpt is an option for DumpState.
+type DumpOpt func(*dumpOptions)
+
+type dumpOptions struct {
+	topic string
+	peer  peer.ID
+}
+
+// WithDumpTopic restricts the dump to a topic, and to the peers subscribed to it.
+func WithDumpTopic(topic string) DumpOpt {
+	return func(opts *dumpOptions) {
+		opts.topic = topic
+	}
+}
+
+// WithDumpPeer restricts the dump to a peer, and to the topics it is part of.
+func WithDumpPeer(p peer.ID) DumpOpt {
+	return func(opts *dumpOptions) {
+		opts.peer = p
+	}
+}
+
+// DumpState returns a copy of the state of pubsub and its router, taken on the event loop, with
+// the peer scores and the peer gater copied under their locks. The dump of large deployments can
+// be restricted to a topic or a peer with WithDumpTopic and WithDumpPeer.
+func (p *PubSub) DumpState(ctx context.Context, opts ...DumpOpt) (*StateDump, error) {
+	var options dumpOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	out := make(chan *StateDump, 1)
+	select {
+	case p.eval <- func() { out <- p.dumpState(options) }:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.ctx.Done():
+		return nil, p.ctx.Err()
+	}
+
+	select {
+	case dump := <-out:
+		return dump, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// dumpState copies the state matching the options.
+// Only called from processLoop.
+func (p *PubSub) dumpState(opts dumpOptions) *StateDump {
+	gs, _ := p.rt.(*GossipSubRouter)
+
+	keepPeer := func(pid peer.ID) bool {
+		if opts.peer != "" && pid != opts.peer {
+			return false
+		}
+		if opts.topic != "" {
+			_, ok := p.topics[opts.topic][pid]
+			return ok
+		}
+		return true
+	}
+	filterPeers := func(peers map[peer.ID]struct{}) []peer.ID {
+		var res []peer.ID
+		for pid := range peers {
+			if keepPeer(pid) {
+				res = append(res, pid)
+			}
+		}
+		return res
+	}
+
+	dump := &StateDump{
+		Topics: make(map[string]*TopicDump),
+		Peers:  make(map[peer.ID]*PeerDump),
+	}
+
+	// the topics we know of: subscribed by us or our peers, or where we publish
+	topics := make(map[string]struct{})
+	for topic := range p.topics {
+		topics[topic] = struct{}{}
+	}
+	for topic := range p.mySubs {
+		topics[topic] = struct{}{}
+	}
+	if gs != nil {
+		for topic := range gs.mesh {
+			topics[topic] = struct{}{}
+		}
+		for topic := range gs.fanout {
+			topics[topic] = struct{}{}
+		}
+	}
+
+	for topic := range topics {
+		if opts.topic != "" && topic != opts.topic {
+			continue
+		}
+
+		td := &TopicDump{
+			Subscribed: len(p.mySubs[topic]) > 0,
+			Peers:      filterPeers(p.topics[topic]),
+		}
+		if gs != nil {
+			td.Mesh = filterPeers(gs.mesh[topic])
+			td.Fanout = filterPeers(gs.fanout[topic])
+			for pid, expire := range gs.backoff[topic] {
+				if keepPeer(pid) {
+					if td.Backoffs == nil {
+						td.Backoffs = make(map[peer.ID]time.Time)
+					}
+					td.Backoffs[pid] = expire
+				}
+			}
+		}
+
+		// a peer restricted dump only has the topics the peer is part of
+		if opts.peer != "" && len(td.Peers)+len(td.Mesh)+len(td.Fanout)+len(td.Backoffs) == 0 {
+			continue
+		}
+		dump.Topics[topic] = td
+	}
+
+	for pid, q := range p.peers {
+		if !keepPeer(pid) {
+			continue
+		}
+
+		pd := &PeerDump{QueueLen: len(q), QueueCap: cap(q)}
+		if caps, ok := p.capabilities[pid]; ok {
+			caps := *caps
+			pd.Capabilities = &caps
+		}
+		if gs != nil {
+			_, pd.Direct = gs.direct[pid]
+			pd.Protocol = gs.peers[pid]
+			pd.Outbound = gs.outbound[pid]
+			pd.Score = gs.score.Snapshot(pid)
+			pd.Promises = gs.gossipTracer.PendingPromises(pid)
+		}
+		dump.Peers[pid] = pd
+	}
+
+	if gs != nil {
+		for pid := range gs.direct {
+			if opts.peer == "" || pid == opts.peer {
+				dump.Direct = append(dump.Direct, pid)
+			}
+		}
+
+		if gs.gate != nil {
+			snap := gs.gate.snapshot()
+			for pid := range snap.Peers {
+				if !keepPeer(pid) {
+					delete(snap.Peers, pid)
+				}
+			}
+			dump.Gater = &snap
+		}
+	}
+
+	return dump
+}
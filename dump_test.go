@@ -0,0 +1,74 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestDumpState(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	psubs := getGossipsubs(ctx, hosts, WithPeerScore(
+		&PeerScoreParams{
+			AppSpecificScore:  func(peer.ID) float64 { return 0 },
+			AppSpecificWeight: 1,
+			DecayInterval:     time.Second,
+			DecayToZero:       0.01,
+		},
+		&PeerScoreThresholds{
+			GossipThreshold:   -10,
+			PublishThreshold:  -100,
+			GraylistThreshold: -1000,
+		}))
+
+	for _, ps := range psubs {
+		mustSubscribe(t, ps, "a")
+	}
+	mustSubscribe(t, psubs[0], "b")
+	mustSubscribe(t, psubs[1], "b")
+	connectAll(t, hosts)
+	time.Sleep(time.Second)
+
+	dump, err := psubs[0].DumpState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if td := dump.Topics["a"]; td == nil || !td.Subscribed || len(td.Peers) != 2 || len(td.Mesh) != 2 {
+		t.Fatalf("unexpected topic dump %+v", td)
+	}
+	if len(dump.Topics) != 2 || len(dump.Peers) != 2 {
+		t.Fatalf("expected 2 topics and 2 peers, got %d and %d", len(dump.Topics), len(dump.Peers))
+	}
+	for pid, pd := range dump.Peers {
+		if pd.Score == nil || pd.QueueCap == 0 || pd.Protocol == "" {
+			t.Fatalf("unexpected dump of peer %s: %+v", pid, pd)
+		}
+	}
+	if _, err := json.Marshal(dump); err != nil {
+		t.Fatal(err)
+	}
+
+	// restricted to a topic, and the peers in it
+	dump, err = psubs[0].DumpState(ctx, WithDumpTopic("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dump.Topics) != 1 || dump.Topics["b"] == nil || len(dump.Peers) != 1 || dump.Peers[hosts[1].ID()] == nil {
+		t.Fatalf("unexpected topic restricted dump %+v", dump)
+	}
+
+	// restricted to a peer, and the topics it is part of
+	dump, err = psubs[0].DumpState(ctx, WithDumpPeer(hosts[2].ID()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dump.Topics) != 1 || len(dump.Topics["a"].Mesh) != 1 || len(dump.Peers) != 1 || dump.Peers[hosts[2].ID()] == nil {
+		t.Fatalf("unexpected peer restricted dump %+v", dump)
+	}
+}
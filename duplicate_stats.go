@@ -0,0 +1,268 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// duplicateStatsBuckets is the number of buckets the duplicate statistics window is divided in
+const duplicateStatsBuckets = 10
+
+// DuplicateStatsParams configures the tracking of duplicate messages per peer and topic.
+type DuplicateStatsParams struct {
+	// Window is the sliding window over which the messages are counted.
+	Window time.Duration
+	// Threshold is the ratio of duplicates among the messages of a peer in a topic above which
+	// raw tracers implementing DuplicateStatsTracer are notified, once per window; 0 disables
+	// the notifications.
+	Threshold float64
+	// MinMessages is the number of messages a peer must have sent in a topic within the window
+	// before its duplicate ratio is checked against the threshold.
+	MinMessages int
+}
+
+// WithDuplicateStats tracks the duplicate messages received from each peer in each topic,
+// which can be queried with TopDuplicateSources.
+func WithDuplicateStats(params DuplicateStatsParams) Option {
+	return func(p *PubSub) error {
+		if params.Window < duplicateStatsBuckets {
+			return fmt.Errorf("invalid duplicate statistics window: %s", params.Window)
+		}
+		if params.Threshold < 0 || params.Threshold > 1 {
+			return fmt.Errorf("invalid duplicate ratio threshold: %f", params.Threshold)
+		}
+		if params.MinMessages < 0 {
+			return fmt.Errorf("invalid duplicate statistics minimum messages: %d", params.MinMessages)
+		}
+		p.dupStats = &duplicateStats{
+			params: params,
+			stats:  make(map[duplicateSourceKey]*duplicateSourceStats),
+		}
+		return nil
+	}
+}
+
+// DuplicateStatsTracer is an optional interface for RawTracers, which is invoked when the duplicate
+// ratio of a peer in a topic exceeds DuplicateStatsParams.Threshold.
+type DuplicateStatsTracer interface {
+	DuplicateRatioExceeded(p peer.ID, topic string, ratio float64)
+}
+
+// DuplicateSource is the duplicate statistics of a peer in a topic over the window.
+type DuplicateSource struct {
+	Peer  peer.ID
+	Topic string
+	// Duplicates is the number of duplicate messages received from the peer.
+	Duplicates int
+	// Delivered is the number of messages first received from the peer.
+	Delivered int
+	// Ratio is the ratio of duplicates among the messages received from the peer.
+	Ratio float64
+}
+
+// TopDuplicateSources returns the n peer and topic pairs with the most duplicate messages within
+// the window, in decreasing order; it returns nil unless duplicate statistics are enabled.
+func (p *PubSub) TopDuplicateSources(n int) []DuplicateSource {
+	if p.dupStats == nil {
+		return nil
+	}
+	return p.dupStats.top(n)
+}
+
+type duplicateSourceKey struct {
+	peer  peer.ID
+	topic string
+}
+
+type duplicateBucket struct {
+	epoch      int64
+	duplicates int
+	delivered  int
+}
+
+type duplicateSourceStats struct {
+	buckets [duplicateStatsBuckets]duplicateBucket
+	// epoch of the last notification, to notify at most once per window
+	reported int64
+}
+
+// duplicateStats is an internal tracer that counts duplicates per peer and topic
+type duplicateStats struct {
+	sync.Mutex
+
+	p      *PubSub
+	params DuplicateStatsParams
+	stats  map[duplicateSourceKey]*duplicateSourceStats
+}
+
+var _ RawTracer = (*duplicateStats)(nil)
+
+func (ds *duplicateStats) Start(ctx context.Context, p *PubSub) {
+	ds.p = p
+	go ds.background(ctx)
+}
+
+func (ds *duplicateStats) background(ctx context.Context) {
+	ticker := ds.p.clock.NewTicker(ds.params.Window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			ds.sweep()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// epoch returns the index of the current bucket since the beginning of time
+func (ds *duplicateStats) epoch() int64 {
+	return ds.p.clock.Now().UnixNano() / int64(ds.params.Window/duplicateStatsBuckets)
+}
+
+// sweep forgets the sources without messages in the window
+func (ds *duplicateStats) sweep() {
+	ds.Lock()
+	defer ds.Unlock()
+
+	epoch := ds.epoch()
+	for k, st := range ds.stats {
+		if dups, delivered := st.count(epoch); dups == 0 && delivered == 0 {
+			delete(ds.stats, k)
+		}
+	}
+}
+
+// count sums the buckets within the window ending at epoch
+func (st *duplicateSourceStats) count(epoch int64) (duplicates, delivered int) {
+	for _, b := range st.buckets {
+		if b.epoch > epoch-duplicateStatsBuckets {
+			duplicates += b.duplicates
+			delivered += b.delivered
+		}
+	}
+	return duplicates, delivered
+}
+
+func (ds *duplicateStats) record(msg *Message, duplicate bool) {
+	if msg.ReceivedFrom == "" || msg.ReceivedFrom == ds.p.host.ID() {
+		return
+	}
+
+	ds.Lock()
+
+	k := duplicateSourceKey{peer: msg.ReceivedFrom, topic: msg.GetTopic()}
+	st, ok := ds.stats[k]
+	if !ok {
+		st = &duplicateSourceStats{reported: math.MinInt64}
+		ds.stats[k] = st
+	}
+
+	epoch := ds.epoch()
+	b := &st.buckets[epoch%duplicateStatsBuckets]
+	if b.epoch != epoch {
+		*b = duplicateBucket{epoch: epoch}
+	}
+	if duplicate {
+		b.duplicates++
+	} else {
+		b.delivered++
+	}
+	ratio, exceeded := ds.exceeded(st, epoch, duplicate)
+	ds.Unlock()
+
+	// notify outside the lock, so that tracers may query the statistics
+	if exceeded {
+		ds.p.tracer.DuplicateRatioExceeded(k.peer, k.topic, ratio)
+	}
+}
+
+// exceeded returns whether a duplicate takes the ratio of a source over the threshold, marking
+// the source as reported for the window
+func (ds *duplicateStats) exceeded(st *duplicateSourceStats, epoch int64, duplicate bool) (float64, bool) {
+	if !duplicate || ds.params.Threshold == 0 || st.reported > epoch-duplicateStatsBuckets {
+		return 0, false
+	}
+	dups, delivered := st.count(epoch)
+	if dups+delivered < ds.params.MinMessages {
+		return 0, false
+	}
+	ratio := float64(dups) / float64(dups+delivered)
+	if ratio <= ds.params.Threshold {
+		return 0, false
+	}
+	st.reported = epoch
+	return ratio, true
+}
+
+func (ds *duplicateStats) top(n int) []DuplicateSource {
+	ds.Lock()
+	defer ds.Unlock()
+
+	epoch := ds.epoch()
+	res := make([]DuplicateSource, 0, len(ds.stats))
+	for k, st := range ds.stats {
+		dups, delivered := st.count(epoch)
+		if dups == 0 {
+			continue
+		}
+		res = append(res, DuplicateSource{
+			Peer:       k.peer,
+			Topic:      k.topic,
+			Duplicates: dups,
+			Delivered:  delivered,
+			Ratio:      float64(dups) / float64(dups+delivered),
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Duplicates != res[j].Duplicates {
+			return res[i].Duplicates > res[j].Duplicates
+		}
+		return res[i].Ratio > res[j].Ratio
+	})
+	if n >= 0 && len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+func (ds *duplicateStats) DeliverMessage(msg *Message) {
+	ds.record(msg, false)
+}
+
+func (ds *duplicateStats) DuplicateMessage(msg *Message) {
+	ds.record(msg, true)
+}
+
+func (ds *duplicateStats) RemovePeer(p peer.ID) {
+	ds.Lock()
+	defer ds.Unlock()
+
+	for k := range ds.stats {
+		if k.peer == p {
+			delete(ds.stats, k)
+		}
+	}
+}
+
+func (ds *duplicateStats) AddPeer(p peer.ID, proto protocol.ID)      {}
+func (ds *duplicateStats) Join(topic string)                         {}
+func (ds *duplicateStats) Leave(topic string)                        {}
+func (ds *duplicateStats) Graft(p peer.ID, topic string)             {}
+func (ds *duplicateStats) Prune(p peer.ID, topic string)             {}
+func (ds *duplicateStats) ValidateMessage(msg *Message)              {}
+func (ds *duplicateStats) RejectMessage(msg *Message, reason string) {}
+func (ds *duplicateStats) ThrottlePeer(p peer.ID)                    {}
+func (ds *duplicateStats) RecvRPC(rpc *RPC)                          {}
+func (ds *duplicateStats) SendRPC(rpc *RPC, p peer.ID)               {}
+func (ds *duplicateStats) DropRPC(rpc *RPC, p peer.ID)               {}
+func (ds *duplicateStats) UndeliverableMessage(msg *Message)         {}
@@ -0,0 +1,93 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+type duplicateStatsTracer struct {
+	noopRawTracer
+
+	mx       sync.Mutex
+	exceeded map[peer.ID]int
+}
+
+func (t *duplicateStatsTracer) DuplicateRatioExceeded(p peer.ID, topic string, ratio float64) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.exceeded[p]++
+}
+
+func TestDuplicateStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := newMockClock()
+	tracer := &duplicateStatsTracer{exceeded: make(map[peer.ID]int)}
+
+	hosts := getNetHosts(t, ctx, 3)
+	psubs := []*PubSub{
+		getPubsub(ctx, hosts[0], WithClock(clk), WithAnnounceWindow(0), WithRawTracer(tracer),
+			WithDuplicateStats(DuplicateStatsParams{Window: time.Minute, Threshold: .5, MinMessages: 10})),
+		getPubsub(ctx, hosts[1]),
+		getPubsub(ctx, hosts[2]),
+	}
+	connectAll(t, hosts)
+
+	var subs []*Subscription
+	for _, ps := range psubs {
+		subs = append(subs, mustSubscribe(t, ps, "test"))
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	// every message reaches the first peer from the publisher and again through the relay
+	for i := 0; i < 20; i++ {
+		if err := psubs[1].Publish("test", []byte(fmt.Sprintf("message %d", i))); err != nil {
+			t.Fatal(err)
+		}
+		for _, sub := range subs {
+			if _, err := sub.Next(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	sources := psubs[0].TopDuplicateSources(-1)
+	dups, delivered := 0, 0
+	for _, src := range sources {
+		if src.Topic != "test" {
+			t.Fatalf("unexpected topic %s", src.Topic)
+		}
+		dups += src.Duplicates
+		delivered += src.Delivered
+	}
+	if dups != 20 || delivered > 20 {
+		t.Fatalf("expected 20 duplicates, got %d with %d delivered", dups, delivered)
+	}
+	if top := psubs[0].TopDuplicateSources(1); len(top) != 1 || top[0] != sources[0] {
+		t.Fatalf("unexpected top source: %+v", top)
+	}
+
+	tracer.mx.Lock()
+	exceeded := tracer.exceeded[sources[0].Peer]
+	tracer.mx.Unlock()
+	if sources[0].Ratio > .5 && exceeded != 1 {
+		t.Fatalf("expected a single notification for %s, got %d", sources[0].Peer, exceeded)
+	}
+
+	// the statistics are forgotten after the window
+	clk.Add(2 * time.Minute)
+	if sources := psubs[0].TopDuplicateSources(-1); len(sources) != 0 {
+		t.Fatalf("expected no duplicate sources after the window, got %+v", sources)
+	}
+
+	if psubs[1].TopDuplicateSources(1) != nil {
+		t.Fatal("expected no statistics without duplicate tracking")
+	}
+}
@@ -0,0 +1,203 @@
+package pubsub
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// EventKind is a kind of event processed by the event loop
+type EventKind int
+
+const (
+	// EventRPC is the processing of an inbound RPC.
+	EventRPC EventKind = iota
+	// EventPublish is the publishing of a validated message.
+	EventPublish
+	// EventEval is the evaluation of a function in the event loop, such as a router heartbeat.
+	EventEval
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventRPC:
+		return "rpc"
+	case EventPublish:
+		return "publish"
+	case EventEval:
+		return "eval"
+	default:
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+}
+
+// ShedKind is a kind of work shed by the event loop in overload
+type ShedKind int
+
+const (
+	// ShedIHave is the processing of the IHAVE gossip of an inbound RPC.
+	ShedIHave ShedKind = iota
+	// ShedDuplicate is the trace event of a duplicate message; the raw tracers, which feed
+	// scoring and receipts, still see the duplicate.
+	ShedDuplicate
+)
+
+func (k ShedKind) String() string {
+	switch k {
+	case ShedIHave:
+		return "ihave"
+	case ShedDuplicate:
+		return "duplicate"
+	default:
+		return fmt.Sprintf("ShedKind(%d)", int(k))
+	}
+}
+
+// WithOverloadShedding makes the event loop shed low priority work while more than depth inbound
+// RPCs and validated messages queue up for it: the IHAVE gossip of inbound RPCs first, then
+// beyond twice the depth the trace events of duplicate messages as well. Subscriptions, the other
+// control messages, new messages and the raw tracing of duplicates are never shed.
+// The option also enables the accounting of the event loop, see EventLoopStats and
+// EventLoopTracer.
+func WithOverloadShedding(depth int) Option {
+	return func(p *PubSub) error {
+		if depth <= 0 {
+			return fmt.Errorf("invalid overload shedding depth %d", depth)
+		}
+		p.shedDepth = depth
+		return nil
+	}
+}
+
+// EventLoopTracer is an optional interface for RawTracers, which is invoked as the event loop
+// processes inbound RPCs, validated messages and evaluations, and sheds work in overload; only
+// with overload shedding enabled.
+type EventLoopTracer interface {
+	// EventProcessed is invoked once an event is processed, with the number of events queued
+	// behind it.
+	EventProcessed(kind EventKind, depth int, took time.Duration)
+	// WorkShed is invoked when the event loop sheds work received from a peer.
+	WorkShed(kind ShedKind, from peer.ID, count int)
+}
+
+// EventLoopStats are the counters of the event loop.
+type EventLoopStats struct {
+	// QueueDepth is the number of inbound RPCs and validated messages queued for the event loop.
+	QueueDepth int
+	// MaxQueueDepth is the largest number of events seen queued behind an event.
+	MaxQueueDepth int
+	// Events is the number of inbound RPCs, validated messages and evaluations processed.
+	Events uint64
+	// BusyTime is the total processing time of the events.
+	BusyTime time.Duration
+	// MaxEventTime is the longest processing time of an event.
+	MaxEventTime time.Duration
+	// ShedIHave is the number of IHAVE messages ignored in overload.
+	ShedIHave uint64
+	// ShedDuplicates is the number of duplicate messages whose trace event was dropped in overload.
+	ShedDuplicates uint64
+}
+
+// MeanEventTime returns the mean processing time of the events; 0 if none was processed.
+func (s EventLoopStats) MeanEventTime() time.Duration {
+	if s.Events == 0 {
+		return 0
+	}
+	return s.BusyTime / time.Duration(s.Events)
+}
+
+// EventLoopStats returns the counters of the event loop, which are only kept with overload
+// shedding enabled; the queue depth is always reported.
+func (p *PubSub) EventLoopStats() EventLoopStats {
+	s := &p.loopStats
+	return EventLoopStats{
+		QueueDepth:     len(p.incoming) + len(p.sendMsg),
+		MaxQueueDepth:  int(s.maxDepth.Load()),
+		Events:         s.events.Load(),
+		BusyTime:       time.Duration(s.busy.Load()),
+		MaxEventTime:   time.Duration(s.maxEvent.Load()),
+		ShedIHave:      s.shedIHave.Load(),
+		ShedDuplicates: s.shedDuplicates.Load(),
+	}
+}
+
+// eventLoopStats are the counters of the event loop, written by it and read by EventLoopStats
+type eventLoopStats struct {
+	maxDepth       atomic.Int64
+	events         atomic.Uint64
+	busy           atomic.Int64
+	maxEvent       atomic.Int64
+	shedIHave      atomic.Uint64
+	shedDuplicates atomic.Uint64
+
+	// depth is the number of events queued behind the current one
+	depth int
+}
+
+// beginEvent records the queue depth behind an event about to be processed, returning its start;
+// a no-op without overload shedding.
+// Only called from processLoop.
+func (p *PubSub) beginEvent() time.Time {
+	if p.shedDepth == 0 {
+		return time.Time{}
+	}
+
+	s := &p.loopStats
+	s.depth = len(p.incoming) + len(p.sendMsg)
+	if int64(s.depth) > s.maxDepth.Load() {
+		s.maxDepth.Store(int64(s.depth))
+	}
+	return time.Now()
+}
+
+// endEvent accounts an event processed since start; a no-op without overload shedding.
+// Only called from processLoop.
+func (p *PubSub) endEvent(kind EventKind, start time.Time) {
+	if p.shedDepth == 0 {
+		return
+	}
+
+	took := time.Since(start)
+	s := &p.loopStats
+	s.events.Add(1)
+	s.busy.Add(int64(took))
+	if int64(took) > s.maxEvent.Load() {
+		s.maxEvent.Store(int64(took))
+	}
+	p.tracer.EventProcessed(kind, s.depth, took)
+}
+
+// overloaded returns whether the event loop is to shed work at the given level of overload,
+// 1 shedding gossip and 2 duplicates as well.
+// Only called from processLoop.
+func (p *PubSub) overloaded(level int) bool {
+	return p.shedDepth > 0 && p.loopStats.depth > level*p.shedDepth
+}
+
+// shedGossip drops the IHAVE gossip of an inbound RPC in overload, before the router sees it.
+// Only called from processLoop.
+func (p *PubSub) shedGossip(rpc *RPC) {
+	if rpc.Control == nil || len(rpc.Control.Ihave) == 0 || !p.overloaded(1) {
+		return
+	}
+
+	n := len(rpc.Control.Ihave)
+	rpc.Control.Ihave = nil
+	p.loopStats.shedIHave.Add(uint64(n))
+	p.tracer.WorkShed(ShedIHave, rpc.from, n)
+	log.Debugf("event loop overloaded; ignoring %d IHAVE messages from %s", n, rpc.from)
+}
+
+// shedDuplicate returns whether to drop the trace event of a duplicate message in overload.
+// Only called from processLoop.
+func (p *PubSub) shedDuplicate(msg *Message) bool {
+	if !p.overloaded(2) {
+		return false
+	}
+
+	p.loopStats.shedDuplicates.Add(1)
+	p.tracer.WorkShed(ShedDuplicate, msg.ReceivedFrom, 1)
+	return true
+}
@@ -0,0 +1,149 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+type eventLoopTracer struct {
+	noopRawTracer
+
+	mx         sync.Mutex
+	events     map[EventKind]int
+	shed       map[ShedKind]int
+	duplicates int
+}
+
+func newEventLoopTracer() *eventLoopTracer {
+	return &eventLoopTracer{events: make(map[EventKind]int), shed: make(map[ShedKind]int)}
+}
+
+func (t *eventLoopTracer) EventProcessed(kind EventKind, depth int, took time.Duration) {
+	t.mx.Lock()
+	t.events[kind]++
+	t.mx.Unlock()
+}
+
+func (t *eventLoopTracer) WorkShed(kind ShedKind, from peer.ID, count int) {
+	t.mx.Lock()
+	t.shed[kind] += count
+	t.mx.Unlock()
+}
+
+func (t *eventLoopTracer) DuplicateMessage(msg *Message) {
+	t.mx.Lock()
+	t.duplicates++
+	t.mx.Unlock()
+}
+
+func TestEventLoopStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracer := newEventLoopTracer()
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getPubsubs(ctx, hosts, WithRawTracer(tracer), WithOverloadShedding(1000))
+	sub := mustSubscribe(t, psubs[1], "test")
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		if err := psubs[0].Publish("test", []byte("message")); err != nil {
+			t.Fatal(err)
+		}
+		assertReceive(t, sub, []byte("message"))
+	}
+
+	stats := psubs[1].EventLoopStats()
+	if stats.Events < 10 || stats.BusyTime <= 0 || stats.MaxEventTime < stats.MeanEventTime() {
+		t.Fatalf("unexpected event loop stats %+v", stats)
+	}
+
+	tracer.mx.Lock()
+	defer tracer.mx.Unlock()
+	if tracer.events[EventRPC] < 10 || tracer.events[EventPublish] < 10 {
+		t.Fatalf("expected the events to be traced, got %v", tracer.events)
+	}
+
+	// the event loop is not accounted without overload shedding
+	ps := getPubsub(ctx, getNetHosts(t, ctx, 1)[0])
+	done := make(chan struct{})
+	ps.eval <- func() { close(done) }
+	<-done
+	if stats := ps.EventLoopStats(); stats.Events != 0 {
+		t.Fatalf("expected no accounting without overload shedding, got %+v", stats)
+	}
+}
+
+func TestOverloadShedding(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracer := newEventLoopTracer()
+	events := &collectingEventTracer{}
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0],
+		WithRawTracer(tracer),
+		WithEventTracer(events),
+		WithOverloadShedding(1),
+		WithMessageSignaturePolicy(StrictNoSign),
+		WithMessageIdFn(func(pmsg *pb.Message) string { return string(pmsg.GetData()) }))
+	mustSubscribe(t, ps, "test")
+
+	if err := ps.Publish("test", []byte("message")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// queue up RPCs carrying gossip and the message again behind a blocked event loop
+	release := make(chan struct{})
+	ps.eval <- func() { <-release }
+
+	topic := "test"
+	for i := 0; i < 5; i++ {
+		ps.incoming <- &RPC{
+			RPC: pb.RPC{
+				Publish: []*pb.Message{{Data: []byte("message"), Topic: &topic}},
+				Control: &pb.ControlMessage{Ihave: []*pb.ControlIHave{{TopicID: &topic}}},
+			},
+			from: peer.ID("peer"),
+		}
+	}
+	close(release)
+
+	done := make(chan struct{})
+	ps.eval <- func() { close(done) }
+	<-done
+
+	// with 4, 3, 2, 1 and 0 RPCs queued behind them, the first three RPCs shed their gossip
+	// and the first two the trace event of their duplicate as well
+	stats := ps.EventLoopStats()
+	if stats.ShedIHave != 3 || stats.ShedDuplicates != 2 || stats.MaxQueueDepth < 4 {
+		t.Fatalf("unexpected event loop stats %+v", stats)
+	}
+
+	// while the raw tracers, which feed scoring, still see every duplicate
+	tracer.mx.Lock()
+	defer tracer.mx.Unlock()
+	if tracer.shed[ShedIHave] != 3 || tracer.shed[ShedDuplicate] != 2 || tracer.duplicates != 5 {
+		t.Fatalf("unexpected traces: shed %v, %d duplicates", tracer.shed, tracer.duplicates)
+	}
+
+	events.mx.Lock()
+	defer events.mx.Unlock()
+	traced := 0
+	for _, evt := range events.events {
+		if evt.GetType() == pb.TraceEvent_DUPLICATE_MESSAGE {
+			traced++
+		}
+	}
+	if traced != 3 {
+		t.Fatalf("expected 3 duplicate trace events, got %d", traced)
+	}
+}
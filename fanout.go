@@ -0,0 +1,75 @@
+package pubsub
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// WithScoredFanout is a gossipsub router option that selects the fanout peers of the topics we
+// publish to without joining them by descending score, with ties broken randomly, instead of
+// randomly among the peers above the publish threshold. The fanout is refreshed at every
+// heartbeat, replacing its peers with better scoring ones as they become available.
+func WithScoredFanout(scoredFanout bool) Option {
+	return func(ps *PubSub) error {
+		gs, ok := ps.rt.(*GossipSubRouter)
+		if !ok {
+			return fmt.Errorf("pubsub router is not gossipsub")
+		}
+
+		gs.scoredFanout = scoredFanout
+
+		return nil
+	}
+}
+
+// getFanoutPeers picks up to count fanout peers in a topic among the ones passing filter; the
+// best scoring ones with scored fanout and random ones otherwise
+func (gs *GossipSubRouter) getFanoutPeers(topic string, count int, filter func(peer.ID) bool, score func(peer.ID) float64) []peer.ID {
+	if !gs.scoredFanout {
+		return gs.getPeers(topic, count, filter)
+	}
+
+	// getPeers shuffles the candidates, which breaks the ties
+	peers := gs.getPeers(topic, 0, filter)
+	sort.SliceStable(peers, func(i, j int) bool {
+		return score(peers[i]) > score(peers[j])
+	})
+	if len(peers) > count {
+		peers = peers[:count]
+	}
+	return peers
+}
+
+// upgradeFanout replaces the fanout peers of a topic with the better scoring peers outside of it,
+// returning whether the fanout changed.
+// Only called from processLoop.
+func (gs *GossipSubRouter) upgradeFanout(topic string, peers map[peer.ID]struct{}, score func(peer.ID) float64) bool {
+	if !gs.scoredFanout || len(peers) == 0 {
+		return false
+	}
+
+	better := gs.getFanoutPeers(topic, len(peers), func(p peer.ID) bool {
+		_, inFanout := peers[p]
+		_, direct := gs.direct[p]
+		return !inFanout && !direct && score(p) >= gs.topicPublishThreshold(topic)
+	}, score)
+	if len(better) == 0 {
+		return false
+	}
+
+	worse := peerMapToList(peers)
+	shufflePeers(worse)
+	sort.SliceStable(worse, func(i, j int) bool {
+		return score(worse[i]) < score(worse[j])
+	})
+
+	changed := false
+	for i := 0; i < len(better) && score(better[i]) > score(worse[i]); i++ {
+		delete(peers, worse[i])
+		peers[better[i]] = struct{}{}
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,145 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestScoredFanout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mx sync.Mutex
+	scores := make(map[peer.ID]float64)
+	score := func(p peer.ID) float64 {
+		mx.Lock()
+		defer mx.Unlock()
+		return scores[p]
+	}
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getGossipsub(ctx, hosts[0],
+		WithManualHeartbeat(),
+		WithScoredFanout(true),
+		WithPeerScore(
+			&PeerScoreParams{
+				AppSpecificScore:  score,
+				AppSpecificWeight: 1,
+				DecayInterval:     time.Second,
+				DecayToZero:       0.01,
+			},
+			&PeerScoreThresholds{
+				GossipThreshold:   -10,
+				PublishThreshold:  -100,
+				GraylistThreshold: -1000,
+			}))
+	gs := ps.rt.(*GossipSubRouter)
+
+	eval := func(f func()) {
+		done := make(chan struct{})
+		ps.eval <- func() {
+			f()
+			close(done)
+		}
+		<-done
+	}
+
+	var peers []peer.ID
+	eval(func() {
+		for i := 0; i < 3*gs.params.D; i++ {
+			pid := peer.ID(fmt.Sprint("p", i))
+			peers = append(peers, pid)
+			ps.peers[pid] = make(chan *RPC, 16)
+			gs.peers[pid] = GossipSubID_v11
+			gs.score.AddPeer(pid, GossipSubID_v11)
+			for _, topic := range []string{"test", "fresh"} {
+				if ps.topics[topic] == nil {
+					ps.topics[topic] = make(map[peer.ID]struct{})
+				}
+				ps.topics[topic][pid] = struct{}{}
+				ps.notifyJoin(topic, pid)
+			}
+		}
+	})
+
+	var seqno int
+	publish := func(topic string) {
+		eval(func() {
+			seqno++
+			gs.Publish(&Message{
+				Message: &pb.Message{
+					From:  []byte("author"),
+					Seqno: []byte(fmt.Sprint(seqno)),
+					Topic: &topic,
+				},
+				ReceivedFrom: "relay",
+			})
+			for _, ch := range ps.peers {
+				for len(ch) > 0 {
+					<-ch
+				}
+			}
+		})
+	}
+	// good returns the number of fanout peers among the best scoring ones
+	good := func(topic string) (n int) {
+		eval(func() {
+			for p := range gs.fanout[topic] {
+				if score(p) > 0 {
+					n++
+				}
+			}
+		})
+		return n
+	}
+
+	// with the same scores the fanout is random
+	publish("test")
+	eval(func() {
+		if len(gs.fanout["test"]) != gs.params.D {
+			t.Fatalf("expected %d fanout peers, got %d", gs.params.D, len(gs.fanout["test"]))
+		}
+		mx.Lock()
+		defer mx.Unlock()
+		// the best scoring peers are outside of the fanout
+		n := 0
+		for _, p := range peers {
+			if _, ok := gs.fanout["test"][p]; !ok && n < gs.params.D {
+				scores[p] = float64(10 + n)
+				n++
+			}
+		}
+	})
+	if n := good("test"); n != 0 {
+		t.Fatalf("expected no good peer in the fanout yet, got %d", n)
+	}
+
+	// a new fanout is made of the best scoring peers
+	publish("fresh")
+	if n := good("fresh"); n != gs.params.D {
+		t.Fatalf("expected the fanout to pick the %d good peers, got %d", gs.params.D, n)
+	}
+
+	// the fanout converges to them as the heartbeat refreshes it
+	if err := ps.TriggerHeartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	if n := good("test"); n != gs.params.D {
+		t.Fatalf("expected the fanout to converge to the %d good peers, got %d", gs.params.D, n)
+	}
+	publish("test")
+	eval(func() {
+		for _, p := range gs.publishPeers["test"].peers {
+			if score(p) <= 0 {
+				t.Fatalf("expected to publish to the good peers, got %s", p)
+			}
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package pubsub
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// WithFloodsubPushLimit is a gossipsub router option that limits the floodsub peers of a topic
+// each message is pushed to, as the other gossipsub peers of the topic push it to them as well.
+// The peers are picked anew for every message, at random or, with byScore, with odds weighted by
+// their score. By default the messages are pushed to all the floodsub peers, which legacy only
+// topologies rely on.
+func WithFloodsubPushLimit(limit int, byScore bool) Option {
+	return func(ps *PubSub) error {
+		gs, ok := ps.rt.(*GossipSubRouter)
+		if !ok {
+			return fmt.Errorf("pubsub router is not gossipsub")
+		}
+		if limit <= 0 {
+			return fmt.Errorf("invalid floodsub push limit: %d", limit)
+		}
+
+		gs.floodPushLimit = limit
+		gs.floodPushByScore = byScore
+
+		return nil
+	}
+}
+
+// floodPushPeers returns the floodsub peers of a topic to push a message to, among the ones with
+// a score above the publish threshold.
+// Only called from processLoop.
+func (gs *GossipSubRouter) floodPushPeers(topic string, flood []peer.ID) []peer.ID {
+	threshold := gs.topicPublishThreshold(topic)
+
+	peers := gs.floodScratch[:0]
+	for _, p := range flood {
+		if gs.score.Score(p) >= threshold {
+			peers = append(peers, p)
+		}
+	}
+	gs.floodScratch = peers
+
+	if gs.floodPushLimit == 0 || len(peers) <= gs.floodPushLimit {
+		return peers
+	}
+
+	if !gs.floodPushByScore {
+		shufflePeers(peers)
+		return peers[:gs.floodPushLimit]
+	}
+
+	// weighted sampling without replacement, keeping the peers with the largest u^(1/w) keys; the
+	// weights are shifted so that the peers at the threshold keep a chance
+	keys := make(map[peer.ID]float64, len(peers))
+	for _, p := range peers {
+		w := gs.score.Score(p) - threshold + 1
+		keys[p] = math.Pow(rand.Float64(), 1/w)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return keys[peers[i]] > keys[peers[j]]
+	})
+	return peers[:gs.floodPushLimit]
+}
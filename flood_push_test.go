@@ -0,0 +1,110 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestFloodsubPushLimit(t *testing.T) {
+	test := func(t *testing.T, byScore bool) map[peer.ID]int {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		hosts := getNetHosts(t, ctx, 1)
+		ps := getGossipsub(ctx, hosts[0],
+			WithManualHeartbeat(),
+			WithFloodsubPushLimit(3, byScore),
+			WithPeerScore(
+				&PeerScoreParams{
+					AppSpecificScore: func(p peer.ID) float64 {
+						if p == "f0" {
+							return 100
+						}
+						return 0
+					},
+					AppSpecificWeight: 1,
+					DecayInterval:     time.Second,
+					DecayToZero:       0.01,
+				},
+				&PeerScoreThresholds{
+					GossipThreshold:   -10,
+					PublishThreshold:  -20,
+					GraylistThreshold: -30,
+				}))
+		gs := ps.rt.(*GossipSubRouter)
+
+		topic := "test"
+		pushes := make(map[peer.ID]int)
+		done := make(chan struct{})
+		ps.eval <- func() {
+			defer close(done)
+
+			ps.topics[topic] = make(map[peer.ID]struct{})
+			for i := 0; i < 10; i++ {
+				pid := peer.ID(fmt.Sprint("f", i))
+				ps.peers[pid] = make(chan *RPC, 1)
+				gs.peers[pid] = FloodSubID
+				gs.score.AddPeer(pid, FloodSubID)
+				ps.topics[topic][pid] = struct{}{}
+				ps.notifyJoin(topic, pid)
+			}
+
+			for seqno := 0; seqno < 200; seqno++ {
+				gs.Publish(&Message{
+					Message: &pb.Message{
+						From:  []byte("author"),
+						Seqno: []byte(fmt.Sprint(seqno)),
+						Topic: &topic,
+					},
+					ReceivedFrom: "relay",
+				})
+
+				recipients := 0
+				for pid, ch := range ps.peers {
+					if len(ch) > 0 {
+						<-ch
+						pushes[pid]++
+						recipients++
+					}
+				}
+				if recipients != 3 {
+					t.Errorf("expected to push to 3 floodsub peers, got %d", recipients)
+					return
+				}
+			}
+		}
+		<-done
+		return pushes
+	}
+
+	t.Run("random", func(t *testing.T) {
+		pushes := test(t, false)
+		if len(pushes) != 10 {
+			t.Fatalf("expected to push to all the floodsub peers in turn, got %v", pushes)
+		}
+	})
+
+	t.Run("by score", func(t *testing.T) {
+		pushes := test(t, true)
+		// the odds follow the distance of the scores to the publish threshold, 121 for the best
+		// scoring peer against 21 for the others
+		others := 0
+		for pid, n := range pushes {
+			if pid != "f0" {
+				others += n
+			}
+		}
+		if pushes["f0"] < 2*others/9 {
+			t.Fatalf("expected to push to the best scoring peer more often, got %v", pushes)
+		}
+		if len(pushes) != 10 {
+			t.Fatalf("expected to push to the other peers in turn, got %v", pushes)
+		}
+	})
+}
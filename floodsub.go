@@ -77,7 +77,7 @@ func (fs *FloodSubRouter) Publish(msg *Message) {
 	from := msg.ReceivedFrom
 	topic := msg.GetTopic()
 
-	out := rpcWithMessages(msg.Message)
+	out := fs.p.outgoingRPC(msg)
 	for pid := range fs.p.topics[topic] {
 		if pid == from || pid == peer.ID(msg.GetFrom()) {
 			continue
@@ -88,11 +88,15 @@ func (fs *FloodSubRouter) Publish(msg *Message) {
 			continue
 		}
 
-		select {
-		case mch <- out:
+		if fs.p.skipsBestEffort(pid, topic) {
+			continue
+		}
+
+		if fs.p.enqueueRPC(pid, mch, out) {
 			fs.tracer.SendRPC(out, pid)
-		default:
+		} else {
 			log.Infof("dropping message to peer %s: queue full", pid)
+			fs.p.stats.outboundDropped(pid)
 			fs.tracer.DropRPC(out, pid)
 			// Drop it. The peer is too slow.
 		}
@@ -1060,7 +1060,8 @@ func TestAnnounceRetry(t *testing.T) {
 
 	// wait a bit for the first subscription to be emitted and trigger announce retry
 	time.Sleep(100 * time.Millisecond)
-	go ps.announceRetry(hosts[1].ID(), "test", true)
+	topic, sub := "test", true
+	go ps.announceRetry(hosts[1].ID(), []*pb.RPC_SubOpts{{Topicid: &topic, Subscribe: &sub}})
 
 	// wait a bit for the subscription to propagate and ensure it was received twice
 	time.Sleep(time.Second + 100*time.Millisecond)
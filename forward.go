@@ -0,0 +1,201 @@
+package pubsub
+
+import (
+	"encoding/binary"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/multiformats/go-varint"
+)
+
+// publishTag is the protobuf key of the payload messages of an RPC: field 2, length delimited
+const publishTag = 2<<3 | 2
+
+// wirePublish holds the wire bytes of the payload messages of an RPC
+type wirePublish struct {
+	// msgs are the payload messages the bytes belong to
+	msgs []*pb.Message
+	// raw are the bytes of each message, nil for messages to be marshaled
+	raw [][]byte
+}
+
+// matches returns whether the payload messages of an RPC are still the encoded ones
+func (w *wirePublish) matches(pmsgs []*pb.Message) bool {
+	if w == nil || len(w.msgs) != len(pmsgs) {
+		return false
+	}
+	for i := range pmsgs {
+		if w.msgs[i] != pmsgs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// scanPublish scans the wire bytes of the payload messages of an RPC unmarshaled from data,
+// flagging the messages listing several topics, and retaining the bytes if keepRaw is set so
+// that they are forwarded without marshaling them again. The bytes are copied, as data is
+// returned to the buffer pool.
+func (rpc *RPC) scanPublish(data []byte, keepRaw bool) {
+	if len(rpc.Publish) == 0 {
+		return
+	}
+
+	var raw [][]byte
+	i := 0
+	for len(data) > 0 {
+		key, n, err := varint.FromUvarint(data)
+		if err != nil {
+			return
+		}
+		data = data[n:]
+
+		var size uint64
+		switch key & 7 {
+		case 0:
+			_, n, err = varint.FromUvarint(data)
+			if err != nil {
+				return
+			}
+		case 1:
+			n = 8
+		case 2:
+			size, n, err = varint.FromUvarint(data)
+			if err != nil {
+				return
+			}
+		case 5:
+			n = 4
+		default:
+			return
+		}
+		if uint64(len(data)) < uint64(n)+size {
+			return
+		}
+		if key == publishTag {
+			msg := data[n : n+int(size)]
+			if multipleTopics(msg) && i < len(rpc.Publish) {
+				rpc.multiTopic = append(rpc.multiTopic, rpc.Publish[i])
+			}
+			if keepRaw {
+				raw = append(raw, append([]byte(nil), msg...))
+			}
+			i++
+		}
+		data = data[n+int(size):]
+	}
+
+	if keepRaw && len(raw) == len(rpc.Publish) {
+		rpc.wire = &wirePublish{msgs: rpc.Publish, raw: raw}
+	}
+}
+
+// listsTopics returns whether a payload message of a received RPC listed several topics on the
+// wire
+func (rpc *RPC) listsTopics(pmsg *pb.Message) bool {
+	for _, m := range rpc.multiTopic {
+		if m == pmsg {
+			return true
+		}
+	}
+	return false
+}
+
+// rawMessage returns the wire bytes of the ith payload message of a received RPC, or nil
+func (rpc *RPC) rawMessage(i int) []byte {
+	if !rpc.wire.matches(rpc.Publish) {
+		return nil
+	}
+	return rpc.wire.raw[i]
+}
+
+// forwardRaw returns the wire bytes of a message as received if it is sent out unaltered as m,
+// or nil if it must be marshaled. Duplicate fields and overlong varints only make the encoding
+// longer, so bytes of the marshaled size encode the same message, if in another field order.
+func (msg *Message) forwardRaw(m *pb.Message) []byte {
+	if msg.raw == nil || m != msg.wireMessage() || len(msg.raw) != m.Size() {
+		return nil
+	}
+	return msg.raw
+}
+
+// outgoingRPC returns an RPC carrying a message as it is sent to peers, reusing its wire bytes
+// if it is forwarded unaltered
+func (p *PubSub) outgoingRPC(msg *Message) *RPC {
+	m := p.outgoingMessage(msg)
+	out := rpcWithMessages(m)
+	out.origins = []*Message{msg}
+	out.shareFrame()
+	if raw := msg.forwardRaw(m); raw != nil {
+		out.wire = &wirePublish{msgs: out.Publish, raw: [][]byte{raw}}
+	}
+	return out
+}
+
+// envelope returns the RPC without its payload messages, or nil if that is empty
+func (rpc *RPC) envelope() *pb.RPC {
+	if len(rpc.Subscriptions) == 0 && rpc.Control == nil && rpc.XXX_unrecognized == nil {
+		return nil
+	}
+	env := rpc.RPC
+	env.Publish = nil
+	return &env
+}
+
+// wireSize returns the size of the marshaled RPC, accounting for the reused wire bytes
+func (rpc *RPC) wireSize() int {
+	if !rpc.wire.matches(rpc.Publish) {
+		return rpc.Size()
+	}
+
+	size := 0
+	if env := rpc.envelope(); env != nil {
+		size = env.Size()
+	}
+	for i, pmsg := range rpc.Publish {
+		n := len(rpc.wire.raw[i])
+		if rpc.wire.raw[i] == nil {
+			n = pmsg.Size()
+		}
+		size += 1 + varint.UvarintSize(uint64(n)) + n
+	}
+	return size
+}
+
+// marshalWire marshals the RPC into buf, which must be wireSize bytes long, splicing in the
+// reused wire bytes. The payload messages follow the rest of the RPC, which is valid as
+// protobuf fields may come in any order.
+func (rpc *RPC) marshalWire(buf []byte) error {
+	if !rpc.wire.matches(rpc.Publish) {
+		_, err := rpc.MarshalTo(buf)
+		return err
+	}
+
+	n := 0
+	if env := rpc.envelope(); env != nil {
+		var err error
+		if n, err = env.MarshalTo(buf); err != nil {
+			return err
+		}
+	}
+	for i, pmsg := range rpc.Publish {
+		raw := rpc.wire.raw[i]
+		size := len(raw)
+		if raw == nil {
+			size = pmsg.Size()
+		}
+
+		buf[n] = publishTag
+		n++
+		n += binary.PutUvarint(buf[n:], uint64(size))
+		if raw != nil {
+			n += copy(buf[n:], raw)
+			continue
+		}
+		if _, err := pmsg.MarshalTo(buf[n : n+size]); err != nil {
+			return err
+		}
+		n += size
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package pubsub
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	pool "github.com/libp2p/go-buffer-pool"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func receivedRPC(t testing.TB, rpc *pb.RPC) *RPC {
+	data, err := rpc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := new(RPC)
+	if err := res.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	res.scanPublish(data, true)
+	return res
+}
+
+func wireBytes(rpc *RPC) ([]byte, error) {
+	buf := make([]byte, rpc.wireSize())
+	if err := rpc.marshalWire(buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func TestForwardRaw(t *testing.T) {
+	topic := "test"
+	subscribe := true
+	in := receivedRPC(t, &pb.RPC{
+		Subscriptions: []*pb.RPC_SubOpts{{Subscribe: &subscribe, Topicid: &topic}},
+		Publish: []*pb.Message{
+			{From: []byte("author"), Data: []byte("first"), Seqno: []byte("1"), Topic: &topic, Key: []byte("key")},
+			{From: []byte("author"), Data: []byte("second"), Seqno: []byte("2"), Topic: &topic},
+		},
+		Control: &pb.ControlMessage{Graft: []*pb.ControlGraft{{TopicID: &topic}}},
+	})
+
+	for i, pmsg := range in.Publish {
+		expected, err := pmsg.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(in.rawMessage(i), expected) {
+			t.Fatal("expected the wire bytes of the message to be retained")
+		}
+	}
+
+	// the forwarded message is marshaled from its wire bytes, along with piggybacked control
+	msg := &Message{Message: in.Publish[0], raw: in.rawMessage(0)}
+	out := copyRPC((&PubSub{}).outgoingRPC(msg))
+	if !out.wire.matches(out.Publish) {
+		t.Fatal("expected the wire bytes to be reused")
+	}
+	out.Subscriptions = in.Subscriptions
+	out.Control = in.Control
+	buf, err := wireBytes(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != out.Size() {
+		t.Fatalf("expected %d bytes, got %d", out.Size(), len(buf))
+	}
+	res := new(RPC)
+	if err := res.Unmarshal(buf); err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := out.RPC.Marshal()
+	actual, _ := res.RPC.Marshal()
+	if !bytes.Equal(expected, actual) {
+		t.Fatal("expected the forwarded RPC to decode to the marshaled one")
+	}
+
+	// RPCs whose messages changed are marshaled
+	out.Publish = append(out.Publish, &pb.Message{Data: []byte("local"), Topic: &topic})
+	if out.wire.matches(out.Publish) {
+		t.Fatal("expected the wire bytes to be discarded")
+	}
+	buf, err = wireBytes(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = new(RPC)
+	if err := res.Unmarshal(buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Publish) != 2 || string(res.Publish[1].Data) != "local" {
+		t.Fatal("expected the local message to be marshaled")
+	}
+
+	// the wire bytes are only reused for unaltered messages
+	stripped := *msg.Message
+	stripped.Key = nil
+	if msg.forwardRaw(&stripped) != nil {
+		t.Fatal("expected an altered copy to be marshaled")
+	}
+	msg.Data = []byte("changed")
+	if msg.forwardRaw(msg.Message) != nil {
+		t.Fatal("expected a modified message to be marshaled")
+	}
+}
+
+// BenchmarkForwarding measures the CPU cost of forwarding a received message to a mesh of D=8
+// peers, marshaling it for each peer or reusing its wire bytes.
+func BenchmarkForwarding(b *testing.B) {
+	const D = 8
+
+	topic := "test"
+	in := receivedRPC(b, &pb.RPC{Publish: []*pb.Message{{
+		From:      []byte(peer.ID("author")),
+		Data:      bytes.Repeat([]byte{'x'}, 1024),
+		Seqno:     []byte("12345678"),
+		Topic:     &topic,
+		Signature: bytes.Repeat([]byte{'s'}, 64),
+		Key:       bytes.Repeat([]byte{'k'}, 36),
+	}}})
+
+	for _, reuse := range []bool{false, true} {
+		b.Run(fmt.Sprintf("Raw=%t", reuse), func(b *testing.B) {
+			msg := &Message{Message: in.Publish[0]}
+			if reuse {
+				msg.raw = in.rawMessage(0)
+			}
+			ps := &PubSub{}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				out := ps.outgoingRPC(msg)
+				for j := 0; j < D; j++ {
+					buf := pool.Get(out.wireSize())
+					if err := out.marshalWire(buf); err != nil {
+						b.Fatal(err)
+					}
+					pool.Put(buf)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package pubsub
+
+import (
+	"encoding/binary"
+	"slices"
+	"sync"
+
+	"github.com/multiformats/go-varint"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+// sharedFrame is the length delimited marshaled form of an RPC sent to several peers, marshaled
+// once by the first peer writer that needs it and written as is by all of them, so the RPC must
+// not be modified once queued
+type sharedFrame struct {
+	rpc *RPC
+
+	once sync.Once
+	data []byte
+	body int
+	err  error
+}
+
+// shareFrame makes the peers an RPC is sent to share its marshaled form
+func (rpc *RPC) shareFrame() {
+	rpc.frame = &sharedFrame{rpc: rpc}
+}
+
+// bytes returns the length delimited frame
+func (f *sharedFrame) bytes() ([]byte, error) {
+	f.once.Do(func() {
+		size := uint64(f.rpc.wireSize())
+		f.data = make([]byte, varint.UvarintSize(size)+int(size))
+		f.body = binary.PutUvarint(f.data, size)
+		f.err = f.rpc.marshalWire(f.data[f.body:])
+	})
+	return f.data, f.err
+}
+
+// withControl returns a copy of an RPC with control messages for a single peer merged in, leaving
+// the RPC intact. The control messages of a shared RPC are marshaled after its shared frame, as
+// concatenated protobuf encodings decode as the merged message.
+func (rpc *RPC) withControl(ctl *pb.ControlMessage) *RPC {
+	res := copyRPC(rpc)
+	if res.Control == nil {
+		res.Control = &pb.ControlMessage{}
+	}
+	res.Control.Ihave = append(slices.Clip(res.Control.Ihave), ctl.Ihave...)
+	res.Control.Iwant = append(slices.Clip(res.Control.Iwant), ctl.Iwant...)
+	res.Control.Graft = append(slices.Clip(res.Control.Graft), ctl.Graft...)
+	res.Control.Prune = append(slices.Clip(res.Control.Prune), ctl.Prune...)
+	res.Control.Choke = append(slices.Clip(res.Control.Choke), ctl.Choke...)
+	res.Control.Unchoke = append(slices.Clip(res.Control.Unchoke), ctl.Unchoke...)
+
+	if rpc.frame != nil {
+		res.extra = &pb.RPC{Control: ctl}
+	}
+	return res
+}
+
+// frameSize returns the size of the marshaled RPC, marshaling its shared frame if needed
+func (rpc *RPC) frameSize() (int, error) {
+	if rpc.frame == nil {
+		return rpc.wireSize(), nil
+	}
+
+	data, err := rpc.frame.bytes()
+	if err != nil {
+		return 0, err
+	}
+	return len(data) - rpc.frame.body + rpc.extra.Size(), nil
+}
+
+// marshalFrame marshals the RPC into buf, which must be frameSize bytes long, copying its shared
+// frame if any
+func (rpc *RPC) marshalFrame(buf []byte) error {
+	if rpc.frame == nil {
+		return rpc.marshalWire(buf)
+	}
+
+	n := copy(buf, rpc.frame.data[rpc.frame.body:])
+	if rpc.extra == nil {
+		return nil
+	}
+	_, err := rpc.extra.MarshalTo(buf[n:])
+	return err
+}
+
+// delimitedRPC returns the length delimited marshaled RPC, which is the shared frame as is unless
+// control messages are piggybacked, or else a buffer to release with putBuffer
+func (p *PubSub) delimitedRPC(rpc *RPC) (buf []byte, pooled bool, err error) {
+	if rpc.frame != nil && rpc.extra == nil {
+		buf, err = rpc.frame.bytes()
+		return buf, false, err
+	}
+
+	size, err := rpc.frameSize()
+	if err != nil {
+		return nil, false, err
+	}
+
+	buf = p.getBuffer(varint.UvarintSize(uint64(size)) + size)
+	n := binary.PutUvarint(buf, uint64(size))
+	if err := rpc.marshalFrame(buf[n:]); err != nil {
+		p.putBuffer(buf)
+		return nil, false, err
+	}
+	return buf, true, nil
+}
@@ -0,0 +1,100 @@
+package pubsub
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestSharedFrame(t *testing.T) {
+	topic := "test"
+	p := &PubSub{}
+	out := p.outgoingRPC(&Message{Message: &pb.Message{Data: []byte("data"), Topic: &topic}})
+
+	marshal := func(rpc *RPC) []byte {
+		t.Helper()
+		size, err := rpc.frameSize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, size)
+		if err := rpc.marshalFrame(buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf
+	}
+
+	data := marshal(out)
+	expected, _ := out.RPC.Marshal()
+	if !bytes.Equal(data, expected) {
+		t.Fatal("expected the shared frame to be the marshaled RPC")
+	}
+	if shared, _ := out.frame.bytes(); &shared[0] != &out.frame.data[0] {
+		t.Fatal("expected the shared frame to be marshaled once")
+	}
+
+	// control messages piggybacked for a peer follow the shared frame
+	ctl := &pb.ControlMessage{
+		Ihave: []*pb.ControlIHave{{TopicID: &topic, MessageIDs: []string{"id"}}},
+		Graft: []*pb.ControlGraft{{TopicID: &topic}},
+	}
+	pig := out.withControl(ctl)
+	if out.Control != nil {
+		t.Fatal("expected the shared RPC to be left intact")
+	}
+	if pig.frame != out.frame || pig.extra == nil {
+		t.Fatal("expected the piggybacked RPC to reuse the shared frame")
+	}
+
+	var decoded pb.RPC
+	if err := decoded.Unmarshal(marshal(pig)); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Publish) != 1 || string(decoded.Publish[0].Data) != "data" ||
+		len(decoded.GetControl().GetIhave()) != 1 || len(decoded.GetControl().GetGraft()) != 1 {
+		t.Fatalf("expected the payload and the piggybacked control messages, got %+v", &decoded)
+	}
+	if pig.Size() != len(marshal(pig)) {
+		t.Fatal("expected the piggybacked RPC to hold the merged messages")
+	}
+}
+
+// BenchmarkFanout measures the framing of a locally published message sent to a mesh of D=8
+// peers, marshaled by each peer writer or shared across them. Run with -benchmem.
+func BenchmarkFanout(b *testing.B) {
+	const D = 8
+
+	topic := "test"
+	msg := &Message{Message: &pb.Message{
+		From:      []byte("author"),
+		Data:      bytes.Repeat([]byte{'x'}, 1024),
+		Seqno:     []byte("12345678"),
+		Topic:     &topic,
+		Signature: bytes.Repeat([]byte{'s'}, 64),
+	}}
+
+	for _, shared := range []bool{false, true} {
+		b.Run(fmt.Sprintf("Shared=%t", shared), func(b *testing.B) {
+			p := &PubSub{}
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				out := p.outgoingRPC(msg)
+				if !shared {
+					out.frame = nil
+				}
+				for j := 0; j < D; j++ {
+					buf, pooled, err := p.delimitedRPC(out)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if pooled {
+						p.putBuffer(buf)
+					}
+				}
+			}
+		})
+	}
+}
@@ -16,6 +16,7 @@ type gossipTracer struct {
 	sync.Mutex
 
 	idGen *msgIDGenerator
+	clock Clock
 
 	followUpTime time.Duration
 
@@ -30,6 +31,7 @@ type gossipTracer struct {
 func newGossipTracer() *gossipTracer {
 	return &gossipTracer{
 		idGen:        newMsgIdGenerator(),
+		clock:        realClock{},
 		promises:     make(map[string]map[peer.ID]time.Time),
 		peerPromises: make(map[peer.ID]map[string]struct{}),
 	}
@@ -41,6 +43,7 @@ func (gt *gossipTracer) Start(gs *GossipSubRouter) {
 	}
 
 	gt.idGen = gs.p.idGen
+	gt.clock = gs.p.clock
 	gt.followUpTime = gs.params.IWantFollowupTime
 }
 
@@ -64,7 +67,7 @@ func (gt *gossipTracer) AddPromise(p peer.ID, msgIDs []string) {
 
 	_, ok = promises[p]
 	if !ok {
-		promises[p] = time.Now().Add(gt.followUpTime)
+		promises[p] = gt.clock.Now().Add(gt.followUpTime)
 		peerPromises, ok := gt.peerPromises[p]
 		if !ok {
 			peerPromises = make(map[string]struct{})
@@ -85,7 +88,7 @@ func (gt *gossipTracer) GetBrokenPromises() map[peer.ID]int {
 	defer gt.Unlock()
 
 	var res map[peer.ID]int
-	now := time.Now()
+	now := gt.clock.Now()
 
 	// find broken promises from peers
 	for mid, promises := range gt.promises {
@@ -114,6 +117,19 @@ func (gt *gossipTracer) GetBrokenPromises() map[peer.ID]int {
 	return res
 }
 
+// PendingPromises returns the number of messages a peer promised to deliver that are still
+// outstanding
+func (gt *gossipTracer) PendingPromises(p peer.ID) int {
+	if gt == nil {
+		return 0
+	}
+
+	gt.Lock()
+	defer gt.Unlock()
+
+	return len(gt.peerPromises[p])
+}
+
 var _ RawTracer = (*gossipTracer)(nil)
 
 func (gt *gossipTracer) fulfillPromise(msg *Message) {
@@ -28,6 +28,12 @@ const (
 	// See the spec for details about how v1.1.0 compares to v1.0.0:
 	// https://github.com/libp2p/specs/blob/master/pubsub/gossipsub/gossipsub-v1.1.md
 	GossipSubID_v11 = protocol.ID("/meshsub/1.1.0")
+
+	// GossipSubID_choke is the protocol ID of a private extension of version 1.1.0 of the
+	// GossipSub protocol, which adds CHOKE and UNCHOKE control messages for peers to turn their
+	// mesh links lazy, exchanging IHAVE gossip instead of messages. It is not a version of the
+	// GossipSub specs, so that it can't be mistaken for one by other implementations.
+	GossipSubID_choke = protocol.ID("/meshsub/1.1.0-choke")
 )
 
 // Defines the default gossipsub parameters.
@@ -39,6 +45,8 @@ var (
 	GossipSubDout                             = 2
 	GossipSubHistoryLength                    = 5
 	GossipSubHistoryGossip                    = 3
+	GossipSubMessageCacheMaxBytes             = 0
+	GossipSubHistoryShiftInterval             = 1 * time.Second
 	GossipSubDlazy                            = 6
 	GossipSubGossipFactor                     = 0.25
 	GossipSubGossipRetransmission             = 3
@@ -59,6 +67,11 @@ var (
 	GossipSubMaxIHaveLength                   = 5000
 	GossipSubMaxIHaveMessages                 = 10
 	GossipSubIWantFollowupTime                = 3 * time.Second
+	GossipSubMaxPendingRequests               = 16
+	GossipSubChokeMinMessages                 = 20
+	GossipSubChokeMinEagerPeers               = 3
+	GossipSubChokeHoldTicks            uint64 = 10
+	GossipSubUnchokeLatency                   = 100 * time.Millisecond
 )
 
 // GossipSubParams defines all the gossipsub specific parameters.
@@ -108,6 +121,11 @@ type GossipSubParams struct {
 	// avoid a runtime panic.
 	HistoryGossip int
 
+	// MessageCacheMaxBytes bounds the total size of the messages in the message cache;
+	// the oldest messages are evicted early when it is exceeded, and are no longer available for
+	// IWANT requests. A value of 0 disables the bound.
+	MessageCacheMaxBytes int
+
 	// Dlazy affects how many peers we will emit gossip to at each heartbeat.
 	// We will send gossip to at least Dlazy peers outside our mesh. The actual
 	// number may be more, depending on GossipFactor and how many peers we're
@@ -204,6 +222,47 @@ type GossipSubParams struct {
 	// If the message is not received within this window, a broken promise is declared and
 	// the router may apply bahavioural penalties.
 	IWantFollowupTime time.Duration
+
+	// MaxPendingRequests is the maximum number of messages requested from a peer with
+	// RequestMessage at a time.
+	MaxPendingRequests int
+
+	// CongestionThreshold is the number of RPCs dropped within a heartbeat because the outbound
+	// queue of a peer was full, beyond which the peer is deemed congested. Congested peers are
+	// traced, and pruned from the meshes holding more than Dlo peers. 0 disables the detection.
+	CongestionThreshold int
+
+	// SlowPeerThreshold is the 95th percentile of the time spent writing RPCs to a peer, over its
+	// latest writes, beyond which the peer is deemed slow to consume them. Slow peers are traced,
+	// and pruned from the meshes holding more than Dlo peers with PruneSlowPeers. 0 disables the
+	// detection.
+	SlowPeerThreshold time.Duration
+
+	// PruneSlowPeers prunes the slow peers from the meshes holding more than Dlo peers.
+	PruneSlowPeers bool
+
+	// ChokeThreshold is the ratio of duplicates among the messages delivered by a mesh peer,
+	// between 0 and 1, beyond which we choke it: the peer then sends us IHAVE gossip instead of
+	// the messages of the topic. Only peers speaking GossipSubID_choke are choked; 0 disables
+	// choking, while the chokes of our peers are always honored.
+	ChokeThreshold float64
+
+	// ChokeMinMessages is the number of messages a mesh peer must deliver, or advertise while
+	// choked, before we decide whether to choke or unchoke it.
+	ChokeMinMessages int
+
+	// ChokeMinEagerPeers is the number of unchoked mesh peers of a topic below which we don't
+	// choke peers, and unchoke them if the mesh shrinks.
+	ChokeMinEagerPeers int
+
+	// ChokeHoldTicks is the number of heartbeats a mesh peer stays choked or unchoked after a
+	// change, or after joining the mesh, so that the links don't flap.
+	ChokeHoldTicks uint64
+
+	// UnchokeLatency is the average delay between the advertisement of messages by a choked peer
+	// and their arrival from the mesh, counting the ones we already had as none, beyond which we
+	// unchoke the peer.
+	UnchokeLatency time.Duration
 }
 
 // NewGossipSub returns a new PubSub object using the default GossipSubRouter as the router.
@@ -222,23 +281,34 @@ func NewGossipSubWithRouter(ctx context.Context, h host.Host, rt PubSubRouter, o
 func DefaultGossipSubRouter(h host.Host) *GossipSubRouter {
 	params := DefaultGossipSubParams()
 	return &GossipSubRouter{
-		peers:     make(map[peer.ID]protocol.ID),
-		mesh:      make(map[string]map[peer.ID]struct{}),
-		fanout:    make(map[string]map[peer.ID]struct{}),
-		lastpub:   make(map[string]int64),
-		gossip:    make(map[peer.ID][]*pb.ControlIHave),
-		control:   make(map[peer.ID]*pb.ControlMessage),
-		backoff:   make(map[string]map[peer.ID]time.Time),
-		peerhave:  make(map[peer.ID]int),
-		iasked:    make(map[peer.ID]int),
-		outbound:  make(map[peer.ID]bool),
-		connect:   make(chan connectInfo, params.MaxPendingConnections),
-		cab:       pstoremem.NewAddrBook(),
-		mcache:    NewMessageCache(params.HistoryGossip, params.HistoryLength),
-		protos:    GossipSubDefaultProtocols,
-		feature:   GossipSubDefaultFeatures,
-		tagTracer: newTagTracer(h.ConnManager()),
-		params:    params,
+		peers:    make(map[peer.ID]protocol.ID),
+		mesh:     make(map[string]map[peer.ID]struct{}),
+		fanout:   make(map[string]map[peer.ID]struct{}),
+		lastpub:  make(map[string]int64),
+		gossip:   make(map[peer.ID][]*pb.ControlIHave),
+		control:  make(map[peer.ID]*pb.ControlMessage),
+		backoff:  make(map[string]map[peer.ID]time.Time),
+		expiry:   newBackoffWheel(),
+		peerhave: make(map[peer.ID]int),
+		iasked:   make(map[peer.ID]int),
+		outbound: make(map[peer.ID]bool),
+		drops:    make(map[peer.ID]int),
+		links:    make(map[string]map[peer.ID]*meshLink),
+		lazy:     make(map[string]map[peer.ID]struct{}),
+		connect:  make(chan connectInfo, params.MaxPendingConnections),
+
+		topicPeers:   make(map[string]*peerList),
+		hbScores:     make(map[peer.ID]float64),
+		hbGraft:      make(map[peer.ID][]string),
+		hbPrune:      make(map[peer.ID][]string),
+		hbNoPX:       make(map[peer.ID]bool),
+		publishPeers: make(map[string]*publishPeers),
+		cab:          pstoremem.NewAddrBook(),
+		mcache:       newMessageCache(params),
+		protos:       GossipSubDefaultProtocols,
+		feature:      GossipSubDefaultFeatures,
+		tagTracer:    newTagTracer(h.ConnManager()),
+		params:       params,
 	}
 }
 
@@ -253,6 +323,7 @@ func DefaultGossipSubParams() GossipSubParams {
 		Dout:                      GossipSubDout,
 		HistoryLength:             GossipSubHistoryLength,
 		HistoryGossip:             GossipSubHistoryGossip,
+		MessageCacheMaxBytes:      GossipSubMessageCacheMaxBytes,
 		Dlazy:                     GossipSubDlazy,
 		GossipFactor:              GossipSubGossipFactor,
 		GossipRetransmission:      GossipSubGossipRetransmission,
@@ -273,6 +344,11 @@ func DefaultGossipSubParams() GossipSubParams {
 		MaxIHaveLength:            GossipSubMaxIHaveLength,
 		MaxIHaveMessages:          GossipSubMaxIHaveMessages,
 		IWantFollowupTime:         GossipSubIWantFollowupTime,
+		MaxPendingRequests:        GossipSubMaxPendingRequests,
+		ChokeMinMessages:          GossipSubChokeMinMessages,
+		ChokeMinEagerPeers:        GossipSubChokeMinEagerPeers,
+		ChokeHoldTicks:            GossipSubChokeHoldTicks,
+		UnchokeLatency:            GossipSubUnchokeLatency,
 		SlowHeartbeatWarning:      0.1,
 	}
 }
@@ -303,19 +379,19 @@ func WithPeerScore(params *PeerScoreParams, thresholds *PeerScoreThresholds) Opt
 		gs.graylistThreshold = thresholds.GraylistThreshold
 		gs.acceptPXThreshold = thresholds.AcceptPXThreshold
 		gs.opportunisticGraftThreshold = thresholds.OpportunisticGraftThreshold
+		gs.topicThresholds = make(map[string]*TopicScoreThresholds, len(thresholds.Topics))
+		for topic, tp := range thresholds.Topics {
+			tp := *tp
+			gs.topicThresholds[topic] = &tp
+		}
 
 		gs.gossipTracer = newGossipTracer()
 
 		// hook the tracer
-		if ps.tracer != nil {
-			ps.tracer.raw = append(ps.tracer.raw, gs.score, gs.gossipTracer)
-		} else {
-			ps.tracer = &pubsubTracer{
-				raw:   []RawTracer{gs.score, gs.gossipTracer},
-				pid:   ps.host.ID(),
-				idGen: ps.idGen,
-			}
+		if ps.tracer == nil {
+			ps.tracer = &pubsubTracer{pid: ps.host.ID(), idGen: ps.idGen}
 		}
+		ps.tracer.addRaw(gs.score, gs.gossipTracer)
 
 		return nil
 	}
@@ -407,12 +483,46 @@ func WithGossipSubParams(cfg GossipSubParams) Option {
 		// Overwrite current config and associated variables in the router.
 		gs.params = cfg
 		gs.connect = make(chan connectInfo, cfg.MaxPendingConnections)
-		gs.mcache = NewMessageCache(cfg.HistoryGossip, cfg.HistoryLength)
+		gs.mcache = newMessageCache(cfg)
 
 		return nil
 	}
 }
 
+// WithMessageCacheRetention is a gossipsub router option that defines the message cache history in
+// wall-clock time, instead of heartbeats: message IDs are advertised in IHAVE gossip for gossip,
+// and messages are retained for IWANT requests for history, independently of the heartbeat interval.
+// The message cache is then shifted by its own timer, every GossipSubHistoryShiftInterval, and the
+// HistoryGossip and HistoryLength parameters are overridden.
+func WithMessageCacheRetention(gossip, history time.Duration) Option {
+	return func(ps *PubSub) error {
+		gs, ok := ps.rt.(*GossipSubRouter)
+		if !ok {
+			return fmt.Errorf("pubsub router is not gossipsub")
+		}
+		if gossip <= 0 || history < gossip {
+			return fmt.Errorf("invalid message cache retention; gossip (%s) must be positive and no longer than history (%s)", gossip, history)
+		}
+		gs.mcacheGossip = gossip
+		gs.mcacheHistory = history
+		return nil
+	}
+}
+
+// WithManualHeartbeat is a gossipsub router option that disables the heartbeat ticker.
+// The heartbeat then only runs when triggered with PubSub.TriggerHeartbeat, which allows
+// tests to step the router deterministically.
+func WithManualHeartbeat() Option {
+	return func(ps *PubSub) error {
+		gs, ok := ps.rt.(*GossipSubRouter)
+		if !ok {
+			return fmt.Errorf("pubsub router is not gossipsub")
+		}
+		gs.manualHeartbeat = true
+		return nil
+	}
+}
+
 // GossipSubRouter is a router that implements the gossipsub protocol.
 // For each topic we have joined, we maintain an overlay through which
 // messages flow; this is the mesh map.
@@ -433,16 +543,39 @@ type GossipSubRouter struct {
 	iasked   map[peer.ID]int                  // number of messages we have asked from peer in the last heartbeat
 	outbound map[peer.ID]bool                 // connection direction cache, marks peers with outbound connections
 	backoff  map[string]map[peer.ID]time.Time // prune backoff
+	expiry   *backoffWheel                    // prune backoffs by expiration
 	connect  chan connectInfo                 // px connection requests
 	cab      peerstore.AddrBook
 
 	protos  []protocol.ID
 	feature GossipSubFeatureTest
 
-	mcache       *MessageCache
-	tracer       *pubsubTracer
+	mcache *MessageCache
+	tracer *pubsubTracer
+
+	// the pending requests of RequestMessage by topic and message ID, and their number by peer
+	// asked
+	requests        map[messageRequestKey]*messageRequest
+	pendingRequests map[peer.ID]int
+
+	// number of RPCs dropped in the last heartbeat because the queue of the peer was full
+	drops map[peer.ID]int
+
+	// the expiration of the IWANT requests we sent, tracked with WithLocalMetadata
+	iwantsSent map[iwantSent]time.Time
+
+	// the application policy for inbound GRAFTs; nil if none
+	graftAuth *graftAuthorizer
+
+	// the mesh peers we may choke by topic, the mesh peers which choked us by topic, and the
+	// tracer following their deliveries when choking is enabled
+	links       map[string]map[peer.ID]*meshLink
+	lazy        map[string]map[peer.ID]struct{}
+	chokeTracer *chokeTracer
+
 	score        *peerScore
 	gossipTracer *gossipTracer
+	iwantBudget  *iwantBudget
 	tagTracer    *tagTracer
 	gate         *peerGater
 
@@ -469,15 +602,49 @@ type GossipSubRouter struct {
 	// threshold for peer score before we graylist the peer and silently ignore its RPCs
 	graylistThreshold float64
 
+	// the gossip, publish and accept PX thresholds overriding the global ones in some topics
+	topicThresholds map[string]*TopicScoreThresholds
+
 	// threshold for median peer score before triggering opportunistic grafting
 	opportunisticGraftThreshold float64
 
 	// whether to use flood publishing
 	floodPublish bool
 
+	// whether to select the fanout peers by score rather than randomly
+	scoredFanout bool
+
+	// the number of floodsub peers of a topic each message is pushed to, picked by score with
+	// floodPushByScore and at random otherwise; 0 pushes to all of them
+	floodPushLimit   int
+	floodPushByScore bool
+
 	// number of heartbeats since the beginning of time; this allows us to amortize some resource
 	// clean up -- eg backoff clean up.
 	heartbeatTicks uint64
+
+	// whether the heartbeat is triggered manually instead of by a ticker
+	manualHeartbeat bool
+
+	// message cache retention in wall-clock time set with WithMessageCacheRetention; when set,
+	// the message cache is shifted every GossipSubHistoryShiftInterval instead of every heartbeat
+	mcacheGossip, mcacheHistory time.Duration
+	lastShift                   time.Time
+
+	// the peers subscribed to each topic, maintained as they join and leave
+	topicPeers map[string]*peerList
+
+	// scratch state reused across heartbeats, to avoid allocating at every run
+	scratch          []peer.ID
+	meshScratch      []peer.ID
+	hbScores         map[peer.ID]float64
+	hbGraft, hbPrune map[peer.ID][]string
+	hbNoPX           map[peer.ID]bool
+
+	// the recipients of the messages published in each topic, cached between mesh changes
+	publishPeers map[string]*publishPeers
+	// the floodsub peers a message is pushed to, reused across messages
+	floodScratch []peer.ID
 }
 
 type connectInfo struct {
@@ -499,14 +666,34 @@ func (gs *GossipSubRouter) Attach(p *PubSub) {
 	// and the gossip tracing
 	gs.gossipTracer.Start(gs)
 
+	// and the budget of the IWANT requests
+	gs.iwantBudget.Start(gs)
+
 	// and the tracer for connmgr tags
 	gs.tagTracer.Start(gs)
 
+	// and the tracer for the choking decisions
+	if gs.params.ChokeThreshold > 0 {
+		gs.chokeTracer = newChokeTracer(p)
+		p.tracer.addRaw(gs.chokeTracer)
+	}
+
+	// size the message cache in shift intervals, when its retention is set in wall-clock time
+	if gs.mcacheHistory > 0 {
+		gs.params.HistoryGossip = shiftSlots(gs.mcacheGossip)
+		gs.params.HistoryLength = shiftSlots(gs.mcacheHistory)
+		gs.mcache = newMessageCache(gs.params)
+		gs.lastShift = p.clock.Now()
+		go gs.mcacheShiftTimer()
+	}
+
 	// start using the same msg ID function as PubSub for caching messages.
 	gs.mcache.SetMsgIdFn(p.idGen.ID)
 
-	// start the heartbeat
-	go gs.heartbeatTimer()
+	// start the heartbeat, unless the application drives it with TriggerHeartbeat
+	if !gs.manualHeartbeat {
+		go gs.heartbeatTimer()
+	}
 
 	// start the PX connectors
 	for i := 0; i < gs.params.Connectors; i++ {
@@ -520,7 +707,7 @@ func (gs *GossipSubRouter) Attach(p *PubSub) {
 	if len(gs.direct) > 0 {
 		go func() {
 			if gs.params.DirectConnectInitialDelay > 0 {
-				time.Sleep(gs.params.DirectConnectInitialDelay)
+				<-gs.p.clock.After(gs.params.DirectConnectInitialDelay)
 			}
 			for p := range gs.direct {
 				gs.connect <- connectInfo{p: p}
@@ -573,6 +760,7 @@ func (gs *GossipSubRouter) AddPeer(p peer.ID, proto protocol.ID) {
 	log.Debugf("PEERUP: Add new peer %s using %s", p, proto)
 	gs.tracer.AddPeer(p, proto)
 	gs.peers[p] = proto
+	clear(gs.publishPeers)
 
 	// track the connection direction
 	outbound := false
@@ -588,7 +776,7 @@ loop:
 		if stat.Direction == network.DirOutbound {
 			// only count the connection if it has a pubsub stream
 			for _, s := range c.GetStreams() {
-				if s.Protocol() == proto {
+				if routerProtocol(s.Protocol()) == proto {
 					outbound = true
 					break loop
 				}
@@ -602,15 +790,31 @@ func (gs *GossipSubRouter) RemovePeer(p peer.ID) {
 	log.Debugf("PEERDOWN: Remove disconnected peer %s", p)
 	gs.tracer.RemovePeer(p)
 	delete(gs.peers, p)
-	for _, peers := range gs.mesh {
+	for topic, peers := range gs.mesh {
 		delete(peers, p)
+		gs.clearChoke(topic, p)
 	}
 	for _, peers := range gs.fanout {
 		delete(peers, p)
 	}
+	clear(gs.publishPeers)
 	delete(gs.gossip, p)
 	delete(gs.control, p)
 	delete(gs.outbound, p)
+	delete(gs.drops, p)
+	gs.clearGraftAuth(p)
+}
+
+func (gs *GossipSubRouter) clearPeerState(p peer.ID) {
+	if _, ok := gs.peers[p]; ok {
+		return
+	}
+	gs.score.ClearRetained(p)
+}
+
+func (gs *GossipSubRouter) isDirectPeer(p peer.ID) bool {
+	_, direct := gs.direct[p]
+	return direct
 }
 
 func (gs *GossipSubRouter) EnoughPeers(topic string, suggested int) bool {
@@ -655,6 +859,39 @@ func (gs *GossipSubRouter) AcceptFrom(p peer.ID) AcceptStatus {
 	return gs.gate.AcceptFrom(p)
 }
 
+// topicGossipThreshold returns the score threshold for emitting gossip to a peer in a topic
+func (gs *GossipSubRouter) topicGossipThreshold(topic string) float64 {
+	if tp, ok := gs.topicThresholds[topic]; ok {
+		return tp.GossipThreshold
+	}
+	return gs.gossipThreshold
+}
+
+// topicPublishThreshold returns the score threshold for publishing to a fanout, floodsub or
+// flood publishing peer in a topic
+func (gs *GossipSubRouter) topicPublishThreshold(topic string) float64 {
+	if tp, ok := gs.topicThresholds[topic]; ok {
+		return tp.PublishThreshold
+	}
+	return gs.publishThreshold
+}
+
+// topicAcceptPXThreshold returns the score threshold for accepting the PX of a PRUNE in a topic
+func (gs *GossipSubRouter) topicAcceptPXThreshold(topic string) float64 {
+	if tp, ok := gs.topicThresholds[topic]; ok {
+		return tp.AcceptPXThreshold
+	}
+	return gs.acceptPXThreshold
+}
+
+func (gs *GossipSubRouter) gateExempt(topic string) bool {
+	return gs.gate.exemptTopic(topic)
+}
+
+func (gs *GossipSubRouter) gatedMessage(p peer.ID) bool {
+	return gs.gate.gatedMessage(p)
+}
+
 func (gs *GossipSubRouter) HandleRPC(rpc *RPC) {
 	ctl := rpc.GetControl()
 	if ctl == nil {
@@ -665,22 +902,28 @@ func (gs *GossipSubRouter) HandleRPC(rpc *RPC) {
 	ihave := gs.handleIWant(rpc.from, ctl)
 	prune := gs.handleGraft(rpc.from, ctl)
 	gs.handlePrune(rpc.from, ctl)
+	gs.handleChoke(rpc.from, ctl)
 
-	if len(iwant) == 0 && len(ihave) == 0 && len(prune) == 0 {
+	// the gossip replayed to grafting peers goes out now rather than at the next heartbeat
+	_, replay := gs.gossip[rpc.from]
+	if len(iwant) == 0 && len(ihave) == 0 && len(prune) == 0 && !replay {
 		return
 	}
 
-	out := rpcWithControl(ihave, nil, iwant, nil, prune)
+	var msgs []*pb.Message
+	for _, msg := range ihave {
+		msgs = append(msgs, gs.p.outgoingMessage(msg))
+	}
+	out := rpcWithControl(msgs, nil, iwant, nil, prune)
+	if len(ihave) > 0 {
+		out.origins = ihave
+	}
 	gs.sendRPC(rpc.from, out)
 }
 
 func (gs *GossipSubRouter) handleIHave(p peer.ID, ctl *pb.ControlMessage) []*pb.ControlIWant {
-	// we ignore IHAVE gossip from any peer whose score is below the gossip threshold
+	// we ignore IHAVE gossip from any peer whose score is below the gossip threshold of the topic
 	score := gs.score.Score(p)
-	if score < gs.gossipThreshold {
-		log.Debugf("IHAVE: ignoring peer %s with score below threshold [score = %f]", p, score)
-		return nil
-	}
 
 	// IHAVE flood protection
 	gs.peerhave[p]++
@@ -694,7 +937,8 @@ func (gs *GossipSubRouter) handleIHave(p peer.ID, ctl *pb.ControlMessage) []*pb.
 		return nil
 	}
 
-	iwant := make(map[string]struct{})
+	// the messages to request, with their topic
+	iwant := make(map[string]string)
 	for _, ihave := range ctl.GetIhave() {
 		topic := ihave.GetTopicID()
 		_, ok := gs.mesh[topic]
@@ -702,15 +946,29 @@ func (gs *GossipSubRouter) handleIHave(p peer.ID, ctl *pb.ControlMessage) []*pb.
 			continue
 		}
 
+		if score < gs.topicGossipThreshold(topic) {
+			log.Debugf("IHAVE: ignoring peer %s with score below threshold in topic %s [score = %f]", p, topic, score)
+			continue
+		}
+
 		if !gs.p.peerFilter(p, topic) {
 			continue
 		}
 
+		// follow the advertisements of the peers we choked, for their unchoking
+		choked := gs.isChoked(topic, p)
+		var unseen []string
 		for _, mid := range ihave.GetMessageIDs() {
-			if gs.p.seenMessage(mid) {
+			if gs.p.seenMessage(topic, mid) {
 				continue
 			}
-			iwant[mid] = struct{}{}
+			iwant[mid] = topic
+			if choked {
+				unseen = append(unseen, mid)
+			}
+		}
+		if choked {
+			gs.chokeTracer.advertise(p, topic, len(ihave.GetMessageIDs()), unseen)
 		}
 	}
 
@@ -733,24 +991,28 @@ func (gs *GossipSubRouter) handleIHave(p peer.ID, ctl *pb.ControlMessage) []*pb.
 	// ask in random order
 	shuffleStrings(iwantlst)
 
-	// truncate to the messages we are actually asking for and update the iasked counter
-	iwantlst = iwantlst[:iask]
-	gs.iasked[p] += iask
+	// truncate to the messages we are actually asking for, within the IWANT budget, and update
+	// the iasked counter
+	iwantlst = gs.iwantBudget.reserve(iwantlst[:iask], iwant)
+	if len(iwantlst) == 0 {
+		return nil
+	}
+	gs.iasked[p] += len(iwantlst)
 
 	gs.gossipTracer.AddPromise(p, iwantlst)
+	gs.trackIWants(p, iwantlst)
 
 	return []*pb.ControlIWant{{MessageIDs: iwantlst}}
 }
 
-func (gs *GossipSubRouter) handleIWant(p peer.ID, ctl *pb.ControlMessage) []*pb.Message {
+// handleIWant returns the cached messages requested by a peer, which keep their priority in the
+// outbound queue of the peer
+func (gs *GossipSubRouter) handleIWant(p peer.ID, ctl *pb.ControlMessage) []*Message {
 	// we don't respond to IWANT requests from any peer whose score is below the gossip threshold
+	// of the topic of the message
 	score := gs.score.Score(p)
-	if score < gs.gossipThreshold {
-		log.Debugf("IWANT: ignoring peer %s with score below threshold [score = %f]", p, score)
-		return nil
-	}
 
-	ihave := make(map[string]*pb.Message)
+	ihave := make(map[string]*Message)
 	for _, iwant := range ctl.GetIwant() {
 		for _, mid := range iwant.GetMessageIDs() {
 			msg, count, ok := gs.mcache.GetForPeer(mid, p)
@@ -758,16 +1020,25 @@ func (gs *GossipSubRouter) handleIWant(p peer.ID, ctl *pb.ControlMessage) []*pb.
 				continue
 			}
 
+			if score < gs.topicGossipThreshold(msg.GetTopic()) {
+				log.Debugf("IWANT: ignoring peer %s with score below threshold in topic %s [score = %f]", p, msg.GetTopic(), score)
+				continue
+			}
+
 			if !gs.p.peerFilter(p, msg.GetTopic()) {
 				continue
 			}
 
+			if gs.p.skipsBestEffort(p, msg.GetTopic()) {
+				continue
+			}
+
 			if count > gs.params.GossipRetransmission {
 				log.Debugf("IWANT: Peer %s has asked for message %s too many times; ignoring request", p, mid)
 				continue
 			}
 
-			ihave[mid] = msg.Message
+			ihave[mid] = msg
 		}
 	}
 
@@ -777,7 +1048,7 @@ func (gs *GossipSubRouter) handleIWant(p peer.ID, ctl *pb.ControlMessage) []*pb.
 
 	log.Debugf("IWANT: Sending %d messages to %s", len(ihave), p)
 
-	msgs := make([]*pb.Message, 0, len(ihave))
+	msgs := make([]*Message, 0, len(ihave))
 	for _, msg := range ihave {
 		msgs = append(msgs, msg)
 	}
@@ -786,11 +1057,11 @@ func (gs *GossipSubRouter) handleIWant(p peer.ID, ctl *pb.ControlMessage) []*pb.
 }
 
 func (gs *GossipSubRouter) handleGraft(p peer.ID, ctl *pb.ControlMessage) []*pb.ControlPrune {
-	var prune []string
+	var prune, provisionalPrune []string
 
 	doPX := gs.doPX
 	score := gs.score.Score(p)
-	now := time.Now()
+	now := gs.p.clock.Now()
 
 	for _, graft := range ctl.GetGraft() {
 		topic := graft.GetTopicID()
@@ -857,6 +1128,18 @@ func (gs *GossipSubRouter) handleGraft(p peer.ID, ctl *pb.ControlMessage) []*pb.
 			continue
 		}
 
+		// apply the application policy
+		if ok, provisional := gs.authorizeGraft(p, topic); !ok {
+			doPX = false
+			if provisional {
+				provisionalPrune = append(provisionalPrune, topic)
+			} else {
+				prune = append(prune, topic)
+				gs.addBackoff(p, topic, false)
+			}
+			continue
+		}
+
 		// check the number of mesh peers; if it is at (or over) Dhi, we only accept grafts
 		// from peers with outbound connections; this is a defensive check to restrict potential
 		// mesh takeover attacks combined with love bombing
@@ -869,16 +1152,21 @@ func (gs *GossipSubRouter) handleGraft(p peer.ID, ctl *pb.ControlMessage) []*pb.
 		log.Debugf("GRAFT: add mesh link from %s in %s", p, topic)
 		gs.tracer.Graft(p, topic)
 		peers[p] = struct{}{}
+		gs.meshChanged(topic)
+		gs.replayGossip(p, topic)
 	}
 
-	if len(prune) == 0 {
+	if len(prune) == 0 && len(provisionalPrune) == 0 {
 		return nil
 	}
 
-	cprune := make([]*pb.ControlPrune, 0, len(prune))
+	cprune := make([]*pb.ControlPrune, 0, len(prune)+len(provisionalPrune))
 	for _, topic := range prune {
 		cprune = append(cprune, gs.makePrune(p, topic, doPX, false))
 	}
+	for _, topic := range provisionalPrune {
+		cprune = append(cprune, gs.makeProvisionalPrune(p, topic))
+	}
 
 	return cprune
 }
@@ -896,6 +1184,8 @@ func (gs *GossipSubRouter) handlePrune(p peer.ID, ctl *pb.ControlMessage) {
 		log.Debugf("PRUNE: Remove mesh link to %s in %s", p, topic)
 		gs.tracer.Prune(p, topic)
 		delete(peers, p)
+		gs.clearChoke(topic, p)
+		gs.meshChanged(topic)
 		// is there a backoff specified by the peer? if so obey it.
 		backoff := prune.GetBackoff()
 		if backoff > 0 {
@@ -907,7 +1197,7 @@ func (gs *GossipSubRouter) handlePrune(p peer.ID, ctl *pb.ControlMessage) {
 		px := prune.GetPeers()
 		if len(px) > 0 {
 			// we ignore PX from peers with insufficient score
-			if score < gs.acceptPXThreshold {
+			if score < gs.topicAcceptPXThreshold(topic) {
 				log.Debugf("PRUNE: ignoring PX from peer %s with insufficient score [score = %f, topic = %s]", p, score, topic)
 				continue
 			}
@@ -931,9 +1221,11 @@ func (gs *GossipSubRouter) doAddBackoff(p peer.ID, topic string, interval time.D
 		backoff = make(map[peer.ID]time.Time)
 		gs.backoff[topic] = backoff
 	}
-	expire := time.Now().Add(interval)
+	expire := gs.p.clock.Now().Add(interval)
 	if backoff[p].Before(expire) {
 		backoff[p] = expire
+		gs.expiry.add(topic, p, expire.Add(backoffSlack()))
+		gs.expiry.grown(topic, len(backoff))
 	}
 }
 
@@ -997,6 +1289,10 @@ func (gs *GossipSubRouter) connector() {
 				continue
 			}
 
+			if gs.p.denyPeer(ci.p) {
+				continue
+			}
+
 			log.Debugf("connecting to %s", ci.p)
 			cab, ok := peerstore.GetCertifiedAddrBook(gs.cab)
 			if ok && ci.spr != nil {
@@ -1006,8 +1302,14 @@ func (gs *GossipSubRouter) connector() {
 				}
 			}
 
+			addrs := gs.p.filterBlockedAddrs(ci.p, gs.cab.Addrs(ci.p))
+			if len(addrs) == 0 {
+				log.Debugf("not connecting to %s: no unblocked addresses", ci.p)
+				continue
+			}
+
 			ctx, cancel := context.WithTimeout(gs.p.ctx, gs.params.ConnectionTimeout)
-			err := gs.p.host.Connect(ctx, peer.AddrInfo{ID: ci.p, Addrs: gs.cab.Addrs(ci.p)})
+			err := gs.p.host.Connect(ctx, peer.AddrInfo{ID: ci.p, Addrs: addrs})
 			cancel()
 			if err != nil {
 				log.Debugf("error connecting to %s: %s", ci.p, err)
@@ -1021,74 +1323,55 @@ func (gs *GossipSubRouter) connector() {
 
 func (gs *GossipSubRouter) Publish(msg *Message) {
 	gs.mcache.Put(msg)
+	gs.fulfillRequest(msg)
 
 	from := msg.ReceivedFrom
 	topic := msg.GetTopic()
 
-	tosend := make(map[peer.ID]struct{})
-
 	// any peers in the topic?
 	tmap, ok := gs.p.topics[topic]
 	if !ok {
 		return
 	}
 
+	out := gs.p.outgoingRPC(msg)
+
 	if gs.floodPublish && from == gs.p.host.ID() {
-		for p := range tmap {
+		for _, p := range gs.topicCandidates(topic) {
 			_, direct := gs.direct[p]
-			if direct || gs.score.Score(p) >= gs.publishThreshold {
-				tosend[p] = struct{}{}
-			}
-		}
-	} else {
-		// direct peers
-		for p := range gs.direct {
-			_, inTopic := tmap[p]
-			if inTopic {
-				tosend[p] = struct{}{}
-			}
-		}
-
-		// floodsub peers
-		for p := range tmap {
-			if !gs.feature(GossipSubFeatureMesh, gs.peers[p]) && gs.score.Score(p) >= gs.publishThreshold {
-				tosend[p] = struct{}{}
+			if direct || gs.score.Score(p) >= gs.topicPublishThreshold(topic) {
+				gs.publishTo(p, msg, out)
 			}
 		}
+		return
+	}
 
-		// gossipsub peers
-		gmap, ok := gs.mesh[topic]
-		if !ok {
-			// we are not in the mesh for topic, use fanout peers
-			gmap, ok = gs.fanout[topic]
-			if !ok || len(gmap) == 0 {
-				// we don't have any, pick some with score above the publish threshold
-				peers := gs.getPeers(topic, gs.params.D, func(p peer.ID) bool {
-					_, direct := gs.direct[p]
-					return !direct && gs.score.Score(p) >= gs.publishThreshold
-				})
-
-				if len(peers) > 0 {
-					gmap = peerListToMap(peers)
-					gs.fanout[topic] = gmap
-				}
-			}
-			gs.lastpub[topic] = time.Now().UnixNano()
-		}
+	// direct, mesh or fanout peers
+	pp := gs.getPublishPeers(topic, tmap)
+	for _, p := range pp.peers {
+		gs.publishTo(p, msg, out)
+	}
 
-		for p := range gmap {
-			tosend[p] = struct{}{}
-		}
+	// floodsub peers
+	for _, p := range gs.floodPushPeers(topic, pp.flood) {
+		gs.publishTo(p, msg, out)
 	}
 
-	out := rpcWithMessages(msg.Message)
-	for pid := range tosend {
-		if pid == from || pid == peer.ID(msg.GetFrom()) {
-			continue
-		}
+	if _, joined := gs.mesh[topic]; !joined {
+		gs.lastpub[topic] = gs.p.clock.Now().UnixNano()
+	}
+}
 
-		gs.sendRPC(pid, out)
+// publishTo sends a published message to a peer, unless it's the one we received it from or
+// its author, or the peer is too busy for a best effort message
+func (gs *GossipSubRouter) publishTo(p peer.ID, msg *Message, out *RPC) {
+	if p == msg.ReceivedFrom || p == peer.ID(msg.GetFrom()) {
+		return
+	}
+	if gs.p.skipsBestEffort(p, msg.GetTopic()) {
+		return
 	}
+	gs.sendRPC(p, out)
 }
 
 func (gs *GossipSubRouter) Join(topic string) {
@@ -1129,6 +1412,7 @@ func (gs *GossipSubRouter) Join(topic string) {
 		gs.mesh[topic] = gmap
 		delete(gs.fanout, topic)
 		delete(gs.lastpub, topic)
+		gs.meshChanged(topic)
 	} else {
 		backoff := gs.backoff[topic]
 		peers := gs.getPeers(topic, gs.params.D, func(p peer.ID) bool {
@@ -1139,6 +1423,7 @@ func (gs *GossipSubRouter) Join(topic string) {
 		})
 		gmap = peerListToMap(peers)
 		gs.mesh[topic] = gmap
+		gs.meshChanged(topic)
 	}
 
 	for p := range gmap {
@@ -1158,6 +1443,9 @@ func (gs *GossipSubRouter) Leave(topic string) {
 	gs.tracer.Leave(topic)
 
 	delete(gs.mesh, topic)
+	delete(gs.links, topic)
+	delete(gs.lazy, topic)
+	gs.meshChanged(topic)
 
 	for p := range gmap {
 		log.Debugf("LEAVE: Remove mesh link to %s in %s", p, topic)
@@ -1183,29 +1471,31 @@ func (gs *GossipSubRouter) sendPrune(p peer.ID, topic string, isUnsubscribe bool
 }
 
 func (gs *GossipSubRouter) sendRPC(p peer.ID, out *RPC) {
-	// do we own the RPC?
-	own := false
+	// the RPC may be shared with other peers, so the piggybacked messages are collected apart
+	var pig *RPC
 
 	// piggyback control message retries
 	ctl, ok := gs.control[p]
 	if ok {
-		out = copyRPC(out)
-		own = true
-		gs.piggybackControl(p, out, ctl)
+		pig = new(RPC)
+		gs.piggybackControl(p, pig, ctl)
 		delete(gs.control, p)
 	}
 
 	// piggyback gossip
 	ihave, ok := gs.gossip[p]
 	if ok {
-		if !own {
-			out = copyRPC(out)
-			own = true
+		if pig == nil {
+			pig = new(RPC)
 		}
-		gs.piggybackGossip(p, out, ihave)
+		gs.piggybackGossip(p, pig, ihave)
 		delete(gs.gossip, p)
 	}
 
+	if pig != nil && pig.Control != nil {
+		out = out.withControl(pig.Control)
+	}
+
 	mch, ok := gs.p.peers[p]
 	if !ok {
 		return
@@ -1240,10 +1530,11 @@ func (gs *GossipSubRouter) doDropRPC(rpc *RPC, p peer.ID, reason string) {
 }
 
 func (gs *GossipSubRouter) doSendRPC(rpc *RPC, p peer.ID, mch chan *RPC) {
-	select {
-	case mch <- rpc:
+	if gs.p.enqueueRPC(p, mch, rpc) {
 		gs.tracer.SendRPC(rpc, p)
-	default:
+	} else {
+		gs.p.stats.outboundDropped(p)
+		gs.drops[p]++
 		gs.doDropRPC(rpc, p, "queue full")
 	}
 }
@@ -1276,13 +1567,18 @@ func appendOrMergeRPC(slice []*RPC, limit int, elems ...RPC) []*RPC {
 		// TODO: Never merge messages. The current behavior is the same as the
 		// old behavior. In the future let's not merge messages. Since,
 		// it may increase message latency.
-		for _, msg := range elem.GetPublish() {
+		// the origins follow the messages, for their priority
+		withOrigins := len(elem.origins) == len(elem.Publish)
+		for i, msg := range elem.GetPublish() {
 			if lastRPC.Publish = append(lastRPC.Publish, msg); lastRPC.Size() > limit {
 				lastRPC.Publish = lastRPC.Publish[:len(lastRPC.Publish)-1]
 				lastRPC = &RPC{RPC: pb.RPC{}, from: elem.from}
 				lastRPC.Publish = append(lastRPC.Publish, msg)
 				out = append(out, lastRPC)
 			}
+			if withOrigins {
+				lastRPC.origins = append(lastRPC.origins, elem.origins[i])
+			}
 		}
 
 		// Merge/Append Subscriptions
@@ -1324,6 +1620,24 @@ func appendOrMergeRPC(slice []*RPC, limit int, elems ...RPC) []*RPC {
 				}
 			}
 
+			for _, choke := range ctl.GetChoke() {
+				if lastRPC.Control.Choke = append(lastRPC.Control.Choke, choke); lastRPC.Size() > limit {
+					lastRPC.Control.Choke = lastRPC.Control.Choke[:len(lastRPC.Control.Choke)-1]
+					lastRPC = &RPC{RPC: pb.RPC{Control: &pb.ControlMessage{}}, from: elem.from}
+					lastRPC.Control.Choke = append(lastRPC.Control.Choke, choke)
+					out = append(out, lastRPC)
+				}
+			}
+
+			for _, unchoke := range ctl.GetUnchoke() {
+				if lastRPC.Control.Unchoke = append(lastRPC.Control.Unchoke, unchoke); lastRPC.Size() > limit {
+					lastRPC.Control.Unchoke = lastRPC.Control.Unchoke[:len(lastRPC.Control.Unchoke)-1]
+					lastRPC = &RPC{RPC: pb.RPC{Control: &pb.ControlMessage{}}, from: elem.from}
+					lastRPC.Control.Unchoke = append(lastRPC.Control.Unchoke, unchoke)
+					out = append(out, lastRPC)
+				}
+			}
+
 			for _, iwant := range ctl.GetIwant() {
 				if len(lastRPC.Control.Iwant) == 0 {
 					// Initialize with a single IWANT.
@@ -1380,19 +1694,24 @@ func appendOrMergeRPC(slice []*RPC, limit int, elems ...RPC) []*RPC {
 }
 
 func (gs *GossipSubRouter) heartbeatTimer() {
-	time.Sleep(gs.params.HeartbeatInitialDelay)
+	select {
+	case <-gs.p.clock.After(gs.params.HeartbeatInitialDelay):
+	case <-gs.p.ctx.Done():
+		return
+	}
+
 	select {
 	case gs.p.eval <- gs.heartbeat:
 	case <-gs.p.ctx.Done():
 		return
 	}
 
-	ticker := time.NewTicker(gs.params.HeartbeatInterval)
+	ticker := gs.p.clock.NewTicker(gs.params.HeartbeatInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			select {
 			case gs.p.eval <- gs.heartbeat:
 			case <-gs.p.ctx.Done():
@@ -1404,6 +1723,118 @@ func (gs *GossipSubRouter) heartbeatTimer() {
 	}
 }
 
+// shiftSlots returns the number of message cache slots covering a retention duration
+func shiftSlots(d time.Duration) int {
+	return int((d + GossipSubHistoryShiftInterval - 1) / GossipSubHistoryShiftInterval)
+}
+
+func (gs *GossipSubRouter) mcacheShiftTimer() {
+	ticker := gs.p.clock.NewTicker(GossipSubHistoryShiftInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			select {
+			case gs.p.eval <- gs.shiftMessageCache:
+			case <-gs.p.ctx.Done():
+				return
+			}
+		case <-gs.p.ctx.Done():
+			return
+		}
+	}
+}
+
+// shiftMessageCache shifts the message cache once for every shift interval elapsed since the last
+// shift, so that delayed or dropped ticks don't extend the retention
+func (gs *GossipSubRouter) shiftMessageCache() {
+	shifts := int(gs.p.clock.Now().Sub(gs.lastShift) / GossipSubHistoryShiftInterval)
+	gs.lastShift = gs.lastShift.Add(time.Duration(shifts) * GossipSubHistoryShiftInterval)
+
+	// the cache is empty after HistoryLength shifts
+	if shifts > gs.params.HistoryLength {
+		shifts = gs.params.HistoryLength
+	}
+	for i := 0; i < shifts; i++ {
+		gs.mcache.Shift()
+	}
+}
+
+// TriggerHeartbeat runs a single gossipsub heartbeat on the event loop and returns
+// once it has completed. It is meant for tests that step the router deterministically,
+// in conjunction with WithManualHeartbeat.
+func (p *PubSub) TriggerHeartbeat() error {
+	gs, ok := p.rt.(*GossipSubRouter)
+	if !ok {
+		return fmt.Errorf("pubsub router is not gossipsub")
+	}
+
+	done := make(chan struct{})
+	select {
+	case p.eval <- func() {
+		gs.heartbeat()
+		close(done)
+	}:
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+func (gs *GossipSubRouter) addBehaviourPenalty(p peer.ID, count int) {
+	gs.score.AddPenalty(p, count)
+}
+
+// MessageCacheEvictions returns the number of messages evicted early from the gossipsub message
+// cache to stay within GossipSubParams.MessageCacheMaxBytes.
+func (p *PubSub) MessageCacheEvictions() uint64 {
+	gs, ok := p.rt.(*GossipSubRouter)
+	if !ok {
+		return 0
+	}
+	return gs.mcache.Evictions()
+}
+
+// GetCachedMessage looks up a message in the gossipsub message cache, so that applications learning
+// out of band of a missed message can check whether it is still available locally before requesting
+// it from the network. The returned message is a copy, which the caller may modify.
+func (p *PubSub) GetCachedMessage(msgID string) (*Message, bool) {
+	return p.getCachedMessage(msgID, "")
+}
+
+// getCachedMessage looks up a message in the gossipsub message cache on the event loop, restricted
+// to a topic unless empty
+func (p *PubSub) getCachedMessage(msgID, topic string) (*Message, bool) {
+	gs, ok := p.rt.(*GossipSubRouter)
+	if !ok {
+		return nil, false
+	}
+
+	out := make(chan *Message, 1)
+	select {
+	case p.eval <- func() {
+		msg, ok := gs.mcache.Get(msgID)
+		if !ok || (topic != "" && msg.GetTopic() != topic) {
+			out <- nil
+			return
+		}
+		out <- copyMessage(msg)
+	}:
+	case <-p.ctx.Done():
+		return nil, false
+	}
+
+	msg := <-out
+	return msg, msg != nil
+}
+
 func (gs *GossipSubRouter) heartbeat() {
 	start := time.Now()
 	defer func() {
@@ -1417,9 +1848,10 @@ func (gs *GossipSubRouter) heartbeat() {
 
 	gs.heartbeatTicks++
 
-	tograft := make(map[peer.ID][]string)
-	toprune := make(map[peer.ID][]string)
-	noPX := make(map[peer.ID]bool)
+	tograft, toprune, noPX := gs.hbGraft, gs.hbPrune, gs.hbNoPX
+	clear(tograft)
+	clear(toprune)
+	clear(noPX)
 
 	// clean up expired backoffs
 	gs.clearBackoff()
@@ -1427,14 +1859,34 @@ func (gs *GossipSubRouter) heartbeat() {
 	// clean up iasked counters
 	gs.clearIHaveCounters()
 
+	// forget the IWANT requests that were not answered in time
+	gs.expireIWants()
+	gs.iwantBudget.expire()
+
+	// forget the expired GRAFT authorizations
+	gs.expireGraftAuth()
+
 	// apply IWANT request penalties
 	gs.applyIwantPenalties()
 
 	// ensure direct peers are connected
 	gs.directConnect()
 
+	// find the peers congested since the last heartbeat
+	congested := gs.congestedPeers()
+
+	// find the peers slow to consume our writes
+	slow := gs.slowPeers()
+	if !gs.params.PruneSlowPeers {
+		slow = nil
+	}
+
+	// collect the deliveries of the peers since the last heartbeat, for the choking decisions
+	chokeStats := gs.chokeTracer.drain(gs.params.IWantFollowupTime)
+
 	// cache scores throughout the heartbeat
-	scores := make(map[peer.ID]float64)
+	scores := gs.hbScores
+	clear(scores)
 	score := func(p peer.ID) float64 {
 		s, ok := scores[p]
 		if !ok {
@@ -1449,6 +1901,8 @@ func (gs *GossipSubRouter) heartbeat() {
 		prunePeer := func(p peer.ID) {
 			gs.tracer.Prune(p, topic)
 			delete(peers, p)
+			gs.clearChoke(topic, p)
+			gs.meshChanged(topic)
 			gs.addBackoff(p, topic, false)
 			topics := toprune[p]
 			toprune[p] = append(topics, topic)
@@ -1458,6 +1912,7 @@ func (gs *GossipSubRouter) heartbeat() {
 			log.Debugf("HEARTBEAT: Add mesh link to %s in %s", p, topic)
 			gs.tracer.Graft(p, topic)
 			peers[p] = struct{}{}
+			gs.meshChanged(topic)
 			topics := tograft[p]
 			tograft[p] = append(topics, topic)
 		}
@@ -1471,6 +1926,22 @@ func (gs *GossipSubRouter) heartbeat() {
 			}
 		}
 
+		// drop congested peers, as long as the mesh stays above Dlo
+		for p := range congested {
+			if _, ok := peers[p]; ok && len(peers) > gs.params.Dlo {
+				log.Debugf("HEARTBEAT: Prune congested peer %s [drops = %d, topic = %s]", p, congested[p], topic)
+				prunePeer(p)
+			}
+		}
+
+		// drop slow peers, as long as the mesh stays above Dlo
+		for p := range slow {
+			if _, ok := peers[p]; ok && len(peers) > gs.params.Dlo {
+				log.Debugf("HEARTBEAT: Prune slow peer %s [p95 = %s, topic = %s]", p, slow[p], topic)
+				prunePeer(p)
+			}
+		}
+
 		// do we have enough peers?
 		if l := len(peers); l < gs.params.Dlo {
 			backoff := gs.backoff[topic]
@@ -1490,7 +1961,8 @@ func (gs *GossipSubRouter) heartbeat() {
 
 		// do we have too many peers?
 		if len(peers) > gs.params.Dhi {
-			plst := peerMapToList(peers)
+			gs.meshScratch = appendPeers(gs.meshScratch[:0], peers)
+			plst := gs.meshScratch
 
 			// sort by score (but shuffle first for the case we don't use the score)
 			shufflePeers(plst)
@@ -1589,7 +2061,8 @@ func (gs *GossipSubRouter) heartbeat() {
 			// situations where we are stuck with poor peers and also recover from churn of good peers.
 
 			// now compute the median peer score in the mesh
-			plst := peerMapToList(peers)
+			gs.meshScratch = appendPeers(gs.meshScratch[:0], peers)
+			plst := gs.meshScratch
 			sort.Slice(plst, func(i, j int) bool {
 				return score(plst[i]) < score(plst[j])
 			})
@@ -1613,17 +2086,23 @@ func (gs *GossipSubRouter) heartbeat() {
 			}
 		}
 
+		// choke the redundant mesh peers, and unchoke the ones we need
+		if gs.chokeTracer != nil {
+			gs.updateChokes(topic, peers, chokeStats[topic])
+		}
+
 		// 2nd arg are mesh peers excluded from gossip. We already push
 		// messages to them, so its redundant to gossip IHAVEs.
-		gs.emitGossip(topic, peers)
+		gs.emitGossip(topic, peers, score)
 	}
 
 	// expire fanout for topics we haven't published to in a while
-	now := time.Now().UnixNano()
+	now := gs.p.clock.Now().UnixNano()
 	for topic, lastpub := range gs.lastpub {
 		if lastpub+int64(gs.params.FanoutTTL) < now {
 			delete(gs.fanout, topic)
 			delete(gs.lastpub, topic)
+			gs.meshChanged(topic)
 		}
 	}
 
@@ -1632,29 +2111,38 @@ func (gs *GossipSubRouter) heartbeat() {
 		// check whether our peers are still in the topic and have a score above the publish threshold
 		for p := range peers {
 			_, ok := gs.p.topics[topic][p]
-			if !ok || score(p) < gs.publishThreshold {
+			if !ok || score(p) < gs.topicPublishThreshold(topic) {
 				delete(peers, p)
+				gs.meshChanged(topic)
 			}
 		}
 
 		// do we need more peers?
 		if len(peers) < gs.params.D {
 			ineed := gs.params.D - len(peers)
-			plst := gs.getPeers(topic, ineed, func(p peer.ID) bool {
+			plst := gs.getFanoutPeers(topic, ineed, func(p peer.ID) bool {
 				// filter our current and direct peers and peers with score above the publish threshold
 				_, inFanout := peers[p]
 				_, direct := gs.direct[p]
-				return !inFanout && !direct && score(p) >= gs.publishThreshold
-			})
+				return !inFanout && !direct && score(p) >= gs.topicPublishThreshold(topic)
+			}, score)
 
 			for _, p := range plst {
 				peers[p] = struct{}{}
 			}
+			if len(plst) > 0 {
+				gs.meshChanged(topic)
+			}
+		}
+
+		// are there better scoring peers to publish to?
+		if gs.upgradeFanout(topic, peers, score) {
+			gs.meshChanged(topic)
 		}
 
 		// 2nd arg are fanout peers excluded from gossip. We already push
 		// messages to them, so its redundant to gossip IHAVEs.
-		gs.emitGossip(topic, peers)
+		gs.emitGossip(topic, peers, score)
 	}
 
 	// send coalesced GRAFT/PRUNE messages (will piggyback gossip)
@@ -1663,8 +2151,10 @@ func (gs *GossipSubRouter) heartbeat() {
 	// flush all pending gossip that wasn't piggybacked above
 	gs.flush()
 
-	// advance the message history window
-	gs.mcache.Shift()
+	// advance the message history window, unless it is shifted by its own timer
+	if gs.mcacheHistory == 0 {
+		gs.mcache.Shift()
+	}
 }
 
 func (gs *GossipSubRouter) clearIHaveCounters() {
@@ -1686,25 +2176,39 @@ func (gs *GossipSubRouter) applyIwantPenalties() {
 	}
 }
 
+// backoffSlack is the slack time added to the expiration of backoffs before clearing them
+// https://github.com/libp2p/specs/pull/289
+func backoffSlack() time.Duration {
+	return 2 * GossipSubHeartbeatInterval
+}
+
 func (gs *GossipSubRouter) clearBackoff() {
-	// we only clear once every 15 ticks to avoid iterating over the map(s) too much
-	if gs.heartbeatTicks%15 != 0 {
-		return
-	}
+	now := gs.p.clock.Now()
+	gs.expiry.expire(now, func(e backoffEntry) {
+		backoff, ok := gs.backoff[e.topic]
+		if !ok {
+			return
+		}
+		// the backoff may have been refreshed since, and indexed again
+		expire, ok := backoff[e.p]
+		if !ok || !expire.Add(backoffSlack()).Before(now) {
+			return
+		}
 
-	now := time.Now()
-	for topic, backoff := range gs.backoff {
-		for p, expire := range backoff {
-			// add some slack time to the expiration
-			// https://github.com/libp2p/specs/pull/289
-			if expire.Add(2 * GossipSubHeartbeatInterval).Before(now) {
-				delete(backoff, p)
+		delete(backoff, e.p)
+		if gs.expiry.shrunk(e.topic, len(backoff)) {
+			if len(backoff) == 0 {
+				delete(gs.backoff, e.topic)
+			} else {
+				// maps don't shrink, so reallocate it
+				shrunk := make(map[peer.ID]time.Time, len(backoff))
+				for p, expire := range backoff {
+					shrunk[p] = expire
+				}
+				gs.backoff[e.topic] = shrunk
 			}
 		}
-		if len(backoff) == 0 {
-			delete(gs.backoff, topic)
-		}
-	}
+	})
 }
 
 func (gs *GossipSubRouter) directConnect() {
@@ -1770,7 +2274,7 @@ func (gs *GossipSubRouter) sendGraftPrune(tograft, toprune map[peer.ID][]string,
 
 // emitGossip emits IHAVE gossip advertising items in the message cache window
 // of this topic.
-func (gs *GossipSubRouter) emitGossip(topic string, exclude map[peer.ID]struct{}) {
+func (gs *GossipSubRouter) emitGossip(topic string, exclude map[peer.ID]struct{}, score func(peer.ID) float64) {
 	mids := gs.mcache.GetGossipIDs(topic)
 	if len(mids) == 0 {
 		return
@@ -1789,14 +2293,16 @@ func (gs *GossipSubRouter) emitGossip(topic string, exclude map[peer.ID]struct{}
 	// First we collect the peers above gossipThreshold that are not in the exclude set
 	// and then randomly select from that set.
 	// We also exclude direct peers, as there is no reason to emit gossip to them.
-	peers := make([]peer.ID, 0, len(gs.p.topics[topic]))
-	for p := range gs.p.topics[topic] {
+	threshold := gs.topicGossipThreshold(topic)
+	peers := gs.scratch[:0]
+	for _, p := range gs.topicCandidates(topic) {
 		_, inExclude := exclude[p]
 		_, direct := gs.direct[p]
-		if !inExclude && !direct && gs.feature(GossipSubFeatureMesh, gs.peers[p]) && gs.score.Score(p) >= gs.gossipThreshold {
+		if !inExclude && !direct && gs.feature(GossipSubFeatureMesh, gs.peers[p]) && score(p) >= threshold {
 			peers = append(peers, p)
 		}
 	}
+	gs.scratch = peers
 
 	target := gs.params.Dlazy
 	factor := int(gs.params.GossipFactor * float64(len(peers)))
@@ -1811,8 +2317,20 @@ func (gs *GossipSubRouter) emitGossip(topic string, exclude map[peer.ID]struct{}
 	}
 	peers = peers[:target]
 
+	// the mesh peers which choked us get the gossip we don't push to them
+	for p := range gs.lazy[topic] {
+		if score(p) >= threshold {
+			peers = append(peers, p)
+		}
+	}
+
 	// Emit the IHAVE gossip to the selected peers.
 	for _, p := range peers {
+		// we wouldn't answer their IWANTs
+		if gs.p.bestEffortBusy(p, topic) {
+			continue
+		}
+
 		peerMids := mids
 		if len(mids) > gs.params.MaxIHaveLength {
 			// we do this per peer so that we emit a different set for each peer.
@@ -1838,6 +2356,8 @@ func (gs *GossipSubRouter) flush() {
 	for p, ctl := range gs.control {
 		delete(gs.control, p)
 		out := rpcWithControl(nil, nil, nil, ctl.Graft, ctl.Prune)
+		out.Control.Choke = ctl.Choke
+		out.Control.Unchoke = ctl.Unchoke
 		gs.sendRPC(p, out)
 	}
 }
@@ -1862,7 +2382,7 @@ func (gs *GossipSubRouter) pushControl(p peer.ID, ctl *pb.ControlMessage) {
 	// remove IHAVE/IWANT from control message, gossip is not retried
 	ctl.Ihave = nil
 	ctl.Iwant = nil
-	if ctl.Graft != nil || ctl.Prune != nil {
+	if ctl.Graft != nil || ctl.Prune != nil || ctl.Choke != nil || ctl.Unchoke != nil {
 		gs.control[p] = ctl
 	}
 }
@@ -1897,7 +2417,24 @@ func (gs *GossipSubRouter) piggybackControl(p peer.ID, out *RPC, ctl *pb.Control
 		}
 	}
 
-	if len(tograft) == 0 && len(toprune) == 0 {
+	// the chokes still in effect
+	var tochoke []*pb.ControlChoke
+	var tounchoke []*pb.ControlUnchoke
+
+	for _, choke := range ctl.GetChoke() {
+		if gs.isChoked(choke.GetTopicID(), p) {
+			tochoke = append(tochoke, choke)
+		}
+	}
+
+	for _, unchoke := range ctl.GetUnchoke() {
+		topic := unchoke.GetTopicID()
+		if _, inMesh := gs.mesh[topic][p]; inMesh && !gs.isChoked(topic, p) {
+			tounchoke = append(tounchoke, unchoke)
+		}
+	}
+
+	if len(tograft) == 0 && len(toprune) == 0 && len(tochoke) == 0 && len(tounchoke) == 0 {
 		return
 	}
 
@@ -1913,6 +2450,12 @@ func (gs *GossipSubRouter) piggybackControl(p peer.ID, out *RPC, ctl *pb.Control
 	if len(toprune) > 0 {
 		xctl.Prune = append(xctl.Prune, toprune...)
 	}
+	if len(tochoke) > 0 {
+		xctl.Choke = append(xctl.Choke, tochoke...)
+	}
+	if len(tounchoke) > 0 {
+		xctl.Unchoke = append(xctl.Unchoke, tounchoke...)
+	}
 }
 
 func (gs *GossipSubRouter) makePrune(p peer.ID, topic string, doPX bool, isUnsubscribe bool) *pb.ControlPrune {
@@ -1957,25 +2500,25 @@ func (gs *GossipSubRouter) makePrune(p peer.ID, topic string, doPX bool, isUnsub
 	return &pb.ControlPrune{TopicID: &topic, Peers: px, Backoff: &backoff}
 }
 
+// getPeers returns up to count random peers of a topic passing the filter, or all of them if
+// count is not positive. The candidates are shuffled as they are filtered, so that picking a few
+// peers out of many stops shuffling once enough peers are found.
 func (gs *GossipSubRouter) getPeers(topic string, count int, filter func(peer.ID) bool) []peer.ID {
-	tmap, ok := gs.p.topics[topic]
-	if !ok {
-		return nil
-	}
+	var peers []peer.ID
+	candidates := gs.candidateScratch(topic)
+	for i := range candidates {
+		j := i + rand.Intn(len(candidates)-i)
+		candidates[i], candidates[j] = candidates[j], candidates[i]
 
-	peers := make([]peer.ID, 0, len(tmap))
-	for p := range tmap {
+		p := candidates[i]
 		if gs.feature(GossipSubFeatureMesh, gs.peers[p]) && filter(p) && gs.p.peerFilter(p, topic) {
 			peers = append(peers, p)
+			if count > 0 && len(peers) == count {
+				break
+			}
 		}
 	}
 
-	shufflePeers(peers)
-
-	if count > 0 && len(peers) > count {
-		peers = peers[:count]
-	}
-
 	return peers
 }
 
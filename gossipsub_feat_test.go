@@ -31,6 +31,16 @@ func TestDefaultGossipSubFeatures(t *testing.T) {
 	if !GossipSubDefaultFeatures(GossipSubFeatureMesh, GossipSubID_v11) {
 		t.Fatal("gossipsub-v1.1 should support PX")
 	}
+	if !GossipSubDefaultFeatures(GossipSubFeaturePX, GossipSubID_choke) {
+		t.Fatal("gossipsub with chokes should support PX")
+	}
+
+	if GossipSubDefaultFeatures(GossipSubFeatureChoke, GossipSubID_v11) {
+		t.Fatal("gossipsub-v1.1 should not support Choke")
+	}
+	if !GossipSubDefaultFeatures(GossipSubFeatureChoke, GossipSubID_choke) {
+		t.Fatal("gossipsub with chokes should support Choke")
+	}
 }
 
 func TestGossipSubCustomProtocols(t *testing.T) {
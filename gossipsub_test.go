@@ -11,6 +11,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gogo/protobuf/proto"
+
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 
 	"github.com/libp2p/go-libp2p"
@@ -2605,3 +2607,334 @@ func TestGossipsubManagesAnAddressBook(t *testing.T) {
 		t.Fatalf("expected no addrs, got %d addrs", len(addrs))
 	}
 }
+
+func TestGossipsubGetCachedMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	psubs := getGossipsubs(ctx, hosts[:2])
+	fsub := getPubsub(ctx, hosts[2])
+	connect(t, hosts[0], hosts[1])
+
+	topic, err := psubs[1].Join("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := topic.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := psubs[1].Join("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	if err := psubs[0].Publish("test", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached, ok := psubs[1].GetCachedMessage(msg.ID)
+	if !ok {
+		t.Fatal("expected the message to be cached")
+	}
+	if !bytes.Equal(cached.Data, []byte("hello")) || cached.GetTopic() != "test" || cached.ReceivedFrom != hosts[0].ID() {
+		t.Fatalf("unexpected cached message: %+v", cached)
+	}
+
+	// the returned message is a copy
+	cached.Data[0] = 'j'
+	*cached.Topic = "other"
+	cached, _ = psubs[1].GetCachedMessage(msg.ID)
+	if !bytes.Equal(cached.Data, []byte("hello")) || cached.GetTopic() != "test" {
+		t.Fatal("expected the cached message to be unchanged")
+	}
+
+	if _, ok := topic.GetCachedMessage(msg.ID); !ok {
+		t.Fatal("expected the message to be cached in its topic")
+	}
+	if _, ok := other.GetCachedMessage(msg.ID); ok {
+		t.Fatal("expected no message in another topic")
+	}
+	if _, ok := psubs[1].GetCachedMessage("unknown"); ok {
+		t.Fatal("expected no message for an unknown id")
+	}
+	if _, ok := fsub.GetCachedMessage(msg.ID); ok {
+		t.Fatal("expected no message cache with floodsub")
+	}
+}
+
+func TestGossipsubMessageCacheRetention(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	for i, interval := range []time.Duration{100 * time.Millisecond, 3 * time.Second} {
+		clk := newMockClock()
+		params := DefaultGossipSubParams()
+		params.HeartbeatInterval = interval
+		ps := getGossipsub(ctx, hosts[i], WithClock(clk), WithGossipSubParams(params),
+			WithMessageCacheRetention(3*time.Second, 10*time.Second))
+		gs := ps.rt.(*GossipSubRouter)
+
+		sub, err := ps.Subscribe("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ps.Publish("test", []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		advance := func(d time.Duration) {
+			for elapsed := time.Duration(0); elapsed < d; elapsed += interval / 2 {
+				clk.Add(interval / 2)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		gossiped := func() bool {
+			res := make(chan bool, 1)
+			ps.eval <- func() { res <- len(gs.mcache.GetGossipIDs("test")) > 0 }
+			return <-res
+		}
+		cached := func() bool {
+			_, ok := ps.GetCachedMessage(msg.ID)
+			return ok
+		}
+
+		advance(1500 * time.Millisecond)
+		if !gossiped() || !cached() {
+			t.Fatalf("expected the message to be gossiped after 1.5s with a %s heartbeat", interval)
+		}
+
+		advance(3 * time.Second)
+		if gossiped() || !cached() {
+			t.Fatalf("expected the message to be cached but not gossiped after 4.5s with a %s heartbeat", interval)
+		}
+
+		advance(4500 * time.Millisecond)
+		if !cached() {
+			t.Fatalf("expected the message to be cached after 9s with a %s heartbeat", interval)
+		}
+
+		advance(1500 * time.Millisecond)
+		if cached() {
+			t.Fatalf("expected the message to be dropped after 10.5s with a %s heartbeat", interval)
+		}
+	}
+
+	if _, err := NewGossipSub(ctx, hosts[0], WithMessageCacheRetention(time.Minute, time.Second)); err == nil {
+		t.Fatal("expected an error for a gossip retention longer than the history")
+	}
+}
+
+type removePeerTracer struct {
+	noopRawTracer
+	removed chan peer.ID
+}
+
+func (t *removePeerTracer) RemovePeer(p peer.ID) {
+	select {
+	case t.removed <- p:
+	default:
+	}
+}
+
+func TestGossipsubWriteTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	removed := make(chan peer.ID, 10)
+	tracer := &removePeerTracer{removed: removed}
+
+	hosts := getNetHosts(t, ctx, 3)
+	psubs := []*PubSub{
+		getGossipsub(ctx, hosts[0], WithWriteTimeout(100*time.Millisecond, 3), WithRawTracer(tracer)),
+		getGossipsub(ctx, hosts[1]),
+	}
+
+	// the last peer subscribes and grafts once, then stops reading
+	stalled := hosts[2].ID()
+	var once sync.Once
+	newMockGS(ctx, t, hosts[2], func(writeMsg func(*pb.RPC), irpc *pb.RPC) {
+		once.Do(func() {
+			writeMsg(&pb.RPC{
+				Subscriptions: []*pb.RPC_SubOpts{{Subscribe: proto.Bool(true), Topicid: proto.String("test")}},
+				Control:       &pb.ControlMessage{Graft: []*pb.ControlGraft{{TopicID: proto.String("test")}}},
+			})
+		})
+		<-ctx.Done()
+	})
+
+	sub := mustSubscribe(t, psubs[1], "test")
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[0], hosts[2])
+	time.Sleep(2 * time.Second)
+
+	inTopic := func(p peer.ID) bool {
+		for _, pid := range psubs[0].ListPeers("test") {
+			if pid == p {
+				return true
+			}
+		}
+		return false
+	}
+	if !inTopic(stalled) {
+		t.Fatal("expected the stalled peer to be subscribed")
+	}
+
+	// fill the stream window of the stalled peer
+	data := make([]byte, 64*1024)
+	for i := 0; i < 64; i++ {
+		if err := psubs[0].Publish("test", data); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case p := <-removed:
+		if p != stalled {
+			t.Fatalf("expected the stalled peer to be removed, got %s", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the stalled peer to be declared dead")
+	}
+	if inTopic(stalled) {
+		t.Fatal("expected the stalled peer to leave the topic")
+	}
+
+	// the mesh no longer includes the stalled peer, and the other peer still receives messages
+	gs := psubs[0].rt.(*GossipSubRouter)
+	res := make(chan bool, 1)
+	psubs[0].eval <- func() {
+		_, ok := gs.mesh["test"][stalled]
+		res <- ok
+	}
+	if <-res {
+		t.Fatal("expected the stalled peer to be removed from the mesh")
+	}
+
+	if err := psubs[0].Publish("test", []byte("healed")); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg.Data) == "healed" {
+			break
+		}
+	}
+}
+
+func TestGossipsubTopicScoreThresholds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getGossipsub(ctx, hosts[0],
+		WithManualHeartbeat(),
+		WithPeerScore(
+			&PeerScoreParams{
+				AppSpecificScore: func(p peer.ID) float64 {
+					if p == "low" {
+						return -5
+					}
+					return 0
+				},
+				AppSpecificWeight: 1,
+				DecayInterval:     time.Second,
+				DecayToZero:       0.01,
+			},
+			&PeerScoreThresholds{
+				GossipThreshold:   -10,
+				PublishThreshold:  -20,
+				GraylistThreshold: -30,
+				AcceptPXThreshold: 0,
+				Topics: map[string]*TopicScoreThresholds{
+					"strict": {GossipThreshold: -1, PublishThreshold: -2, AcceptPXThreshold: 10},
+				},
+			}))
+	gs := ps.rt.(*GossipSubRouter)
+
+	done := make(chan struct{})
+	ps.eval <- func() {
+		defer close(done)
+
+		mids := make(map[string]string)
+		for _, topic := range []string{"strict", "lax"} {
+			ps.topics[topic] = make(map[peer.ID]struct{})
+			for _, pid := range []peer.ID{"low", "high"} {
+				ps.peers[pid] = make(chan *RPC, 16)
+				gs.peers[pid] = GossipSubID_v11
+				gs.score.AddPeer(pid, GossipSubID_v11)
+				ps.topics[topic][pid] = struct{}{}
+				ps.notifyJoin(topic, pid)
+			}
+			gs.mesh[topic] = make(map[peer.ID]struct{})
+			msg := &Message{Message: &pb.Message{
+				From:  []byte("author"),
+				Seqno: []byte(topic),
+				Topic: stringPtr(topic),
+			}}
+			msg.ID = gs.p.idGen.ID(msg)
+			gs.mcache.Put(msg)
+			mids[topic] = msg.ID
+			gs.emitGossip(topic, nil, gs.score.Score)
+		}
+
+		gossip := make(map[peer.ID][]string)
+		for pid, ihave := range gs.gossip {
+			for _, ih := range ihave {
+				gossip[pid] = append(gossip[pid], ih.GetTopicID())
+			}
+		}
+		if len(gossip["high"]) != 2 {
+			t.Errorf("expected to gossip both topics to the high scoring peer, got %v", gossip["high"])
+		}
+		if len(gossip["low"]) != 1 || gossip["low"][0] != "lax" {
+			t.Errorf("expected to only gossip the lax topic to the low scoring peer, got %v", gossip["low"])
+		}
+
+		// the IHAVEs and IWANTs of the low scoring peer are only followed in the lax topic
+		iwant := gs.handleIHave("low", &pb.ControlMessage{Ihave: []*pb.ControlIHave{
+			{TopicID: stringPtr("strict"), MessageIDs: []string{"strict-ihave"}},
+			{TopicID: stringPtr("lax"), MessageIDs: []string{"lax-ihave"}},
+		}})
+		if len(iwant) != 1 || len(iwant[0].GetMessageIDs()) != 1 || iwant[0].GetMessageIDs()[0] != "lax-ihave" {
+			t.Errorf("expected to only request the IHAVE of the lax topic, got %v", iwant)
+		}
+		msgs := gs.handleIWant("low", &pb.ControlMessage{Iwant: []*pb.ControlIWant{
+			{MessageIDs: []string{mids["strict"], mids["lax"]}},
+		}})
+		if len(msgs) != 1 || msgs[0].GetTopic() != "lax" {
+			t.Errorf("expected to only answer the IWANT of the lax topic, got %d messages", len(msgs))
+		}
+		if msgs := gs.handleIWant("high", &pb.ControlMessage{Iwant: []*pb.ControlIWant{
+			{MessageIDs: []string{mids["strict"], mids["lax"]}},
+		}}); len(msgs) != 2 {
+			t.Errorf("expected to answer both IWANTs of the high scoring peer, got %d messages", len(msgs))
+		}
+
+		if th := gs.topicPublishThreshold("strict"); th != -2 {
+			t.Errorf("expected the strict publish threshold, got %f", th)
+		}
+		if th := gs.topicPublishThreshold("lax"); th != -20 {
+			t.Errorf("expected the global publish threshold, got %f", th)
+		}
+		if th := gs.topicAcceptPXThreshold("strict"); th != 10 {
+			t.Errorf("expected the strict accept PX threshold, got %f", th)
+		}
+	}
+	<-done
+}
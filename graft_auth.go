@@ -0,0 +1,238 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// GossipSubProvisionalPruneBackoff is the backoff of the PRUNE answering a GRAFT while its
+// authorization with WithAsyncGraftAuthorizer is pending, after which we GRAFT the peer back if
+// it is authorized, with a heartbeat of slack so that the backoff expired on its side too.
+var GossipSubProvisionalPruneBackoff = time.Second
+
+// GraftAuthorizerTracer is an optional interface for RawTracers, which is invoked when an inbound
+// GRAFT is refused by the authorizer set with WithGraftAuthorizer or WithAsyncGraftAuthorizer,
+// with the error string of the authorizer.
+type GraftAuthorizerTracer interface {
+	RejectGraft(p peer.ID, topic string, reason string)
+}
+
+// WithGraftAuthorizer is a gossipsub router option that applies an application policy to the
+// inbound GRAFTs, beyond the score thresholds: a GRAFT for which the authorizer returns an error
+// is answered with a PRUNE with backoff, and reported to the raw tracers implementing
+// GraftAuthorizerTracer.
+//
+// The authorizer is invoked from the event loop, so it must be fast and must not block; use
+// WithAsyncGraftAuthorizer for policies that need I/O.
+func WithGraftAuthorizer(authorize func(p peer.ID, topic string) error) Option {
+	return func(ps *PubSub) error {
+		gs, ok := ps.rt.(*GossipSubRouter)
+		if !ok {
+			return fmt.Errorf("pubsub router is not gossipsub")
+		}
+
+		gs.graftAuth = &graftAuthorizer{authorize: authorize}
+
+		return nil
+	}
+}
+
+// WithAsyncGraftAuthorizer is a gossipsub router option like WithGraftAuthorizer, for policies
+// that cannot decide without blocking. The authorizer is invoked in its own goroutine, with a
+// context cancelled when the pubsub shuts down. Meanwhile the GRAFT is provisionally answered
+// with a PRUNE with GossipSubProvisionalPruneBackoff, and the peer is grafted back a heartbeat
+// after the backoff expires if it is authorized.
+//
+// The decisions are remembered for the prune backoff of the router, so that the GRAFTs of a peer
+// in a topic are authorized at most once per backoff period.
+func WithAsyncGraftAuthorizer(authorize func(ctx context.Context, p peer.ID, topic string) error) Option {
+	return func(ps *PubSub) error {
+		gs, ok := ps.rt.(*GossipSubRouter)
+		if !ok {
+			return fmt.Errorf("pubsub router is not gossipsub")
+		}
+
+		gs.graftAuth = &graftAuthorizer{
+			authorizeAsync: authorize,
+			decisions:      make(map[graftAuthKey]graftDecision),
+		}
+
+		return nil
+	}
+}
+
+type graftAuthKey struct {
+	peer  peer.ID
+	topic string
+}
+
+// graftDecision is the outcome of the asynchronous authorization of a GRAFT; expire is zero while
+// the authorization is pending
+type graftDecision struct {
+	err    error
+	expire time.Time
+	// regraft is when the provisional backoff of the peer expired, with slack
+	regraft time.Time
+}
+
+// graftAuthorizer holds the application policy for inbound GRAFTs.
+// It is only accessed from processLoop.
+type graftAuthorizer struct {
+	authorize      func(peer.ID, string) error
+	authorizeAsync func(context.Context, peer.ID, string) error
+	decisions      map[graftAuthKey]graftDecision
+}
+
+// authorizeGraft applies the application policy to an inbound GRAFT, returning whether it is
+// authorized, and if not whether the refusal is provisional pending an asynchronous authorization
+func (gs *GossipSubRouter) authorizeGraft(p peer.ID, topic string) (ok bool, provisional bool) {
+	ga := gs.graftAuth
+	if ga == nil {
+		return true, false
+	}
+
+	if ga.authorize != nil {
+		if err := ga.authorize(p, topic); err != nil {
+			gs.rejectGraft(p, topic, err)
+			return false, false
+		}
+		return true, false
+	}
+
+	key := graftAuthKey{peer: p, topic: topic}
+	decision, known := ga.decisions[key]
+	switch {
+	case known && decision.expire.IsZero():
+		return false, true
+	case known && gs.p.clock.Now().Before(decision.expire):
+		if decision.err != nil {
+			return false, false
+		}
+		return true, false
+	}
+
+	// the peer backs off from the PRUNE once received, so it is grafted back with slack
+	regraft := gs.p.clock.Now().Add(GossipSubProvisionalPruneBackoff + gs.params.HeartbeatInterval)
+	ga.decisions[key] = graftDecision{regraft: regraft}
+	go func() {
+		err := ga.authorizeAsync(gs.p.ctx, p, topic)
+		select {
+		case gs.p.eval <- func() { gs.graftAuthorized(p, topic, err) }:
+		case <-gs.p.ctx.Done():
+		}
+	}()
+	return false, true
+}
+
+// graftAuthorized records the outcome of an asynchronous GRAFT authorization, grafting the peer
+// back once its provisional backoff expires if it is authorized
+func (gs *GossipSubRouter) graftAuthorized(p peer.ID, topic string, err error) {
+	ga := gs.graftAuth
+	key := graftAuthKey{peer: p, topic: topic}
+	decision, ok := ga.decisions[key]
+	if !ok {
+		// the peer is gone
+		return
+	}
+	decision.err = err
+	decision.expire = gs.p.clock.Now().Add(gs.params.PruneBackoff)
+	ga.decisions[key] = decision
+
+	if err != nil {
+		gs.rejectGraft(p, topic, err)
+		gs.addBackoff(p, topic, false)
+		return
+	}
+
+	if wait := decision.regraft.Sub(gs.p.clock.Now()); wait > 0 {
+		go func() {
+			select {
+			case <-gs.p.clock.After(wait):
+			case <-gs.p.ctx.Done():
+				return
+			}
+			select {
+			case gs.p.eval <- func() { gs.regraft(p, topic) }:
+			case <-gs.p.ctx.Done():
+			}
+		}()
+		return
+	}
+	gs.regraft(p, topic)
+}
+
+// regraft grafts back an authorized peer provisionally pruned, if the mesh still has room for it
+func (gs *GossipSubRouter) regraft(p peer.ID, topic string) {
+	peers, ok := gs.mesh[topic]
+	if !ok {
+		return
+	}
+	if _, ok := gs.peers[p]; !ok {
+		return
+	}
+	if _, inMesh := peers[p]; inMesh {
+		return
+	}
+	if _, direct := gs.direct[p]; direct {
+		return
+	}
+	if expire, backoff := gs.backoff[topic][p]; backoff && gs.p.clock.Now().Before(expire) {
+		return
+	}
+	if len(peers) >= gs.params.Dhi || gs.score.Score(p) < 0 {
+		return
+	}
+
+	log.Debugf("GRAFT: add authorized mesh link to %s in %s", p, topic)
+	gs.tracer.Graft(p, topic)
+	peers[p] = struct{}{}
+	gs.meshChanged(topic)
+	gs.sendGraft(p, topic)
+}
+
+// rejectGraft reports a GRAFT refused by the authorizer
+func (gs *GossipSubRouter) rejectGraft(p peer.ID, topic string, err error) {
+	log.Debugf("GRAFT: peer %s not authorized in %s: %s", p, topic, err)
+	gs.tracer.RejectGraft(p, topic, err.Error())
+}
+
+// makeProvisionalPrune returns the PRUNE answering a GRAFT pending authorization, which backs off
+// the peer until we graft it back
+func (gs *GossipSubRouter) makeProvisionalPrune(p peer.ID, topic string) *pb.ControlPrune {
+	prune := gs.makePrune(p, topic, false, false)
+	if prune.Backoff != nil {
+		backoff := uint64(GossipSubProvisionalPruneBackoff / time.Second)
+		prune.Backoff = &backoff
+	}
+	return prune
+}
+
+// clearGraftAuth forgets the GRAFT authorizations of a peer
+func (gs *GossipSubRouter) clearGraftAuth(p peer.ID) {
+	if gs.graftAuth == nil {
+		return
+	}
+	for key := range gs.graftAuth.decisions {
+		if key.peer == p {
+			delete(gs.graftAuth.decisions, key)
+		}
+	}
+}
+
+// expireGraftAuth forgets the expired GRAFT authorizations
+func (gs *GossipSubRouter) expireGraftAuth() {
+	if gs.graftAuth == nil {
+		return
+	}
+	now := gs.p.clock.Now()
+	for key, decision := range gs.graftAuth.decisions {
+		if !decision.expire.IsZero() && !now.Before(decision.expire) {
+			delete(gs.graftAuth.decisions, key)
+		}
+	}
+}
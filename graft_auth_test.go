@@ -0,0 +1,209 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+type graftAuthTracer struct {
+	noopRawTracer
+
+	mx       sync.Mutex
+	rejected map[peer.ID]string
+}
+
+func (t *graftAuthTracer) RejectGraft(p peer.ID, topic string, reason string) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.rejected[p] = reason
+}
+
+func (t *graftAuthTracer) reason(p peer.ID) string {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return t.rejected[p]
+}
+
+// graftAuthTestRouter returns a gossipsub router joined to the test topic with the given peers
+// subscribed but out of the mesh, and a function evaluating in the event loop
+func graftAuthTestRouter(t *testing.T, ctx context.Context, peers []peer.ID, opts ...Option) (*PubSub, *GossipSubRouter, func(func())) {
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getGossipsub(ctx, hosts[0], append(opts, WithManualHeartbeat())...)
+	gs := ps.rt.(*GossipSubRouter)
+
+	eval := func(f func()) {
+		done := make(chan struct{})
+		ps.eval <- func() {
+			f()
+			close(done)
+		}
+		<-done
+	}
+
+	eval(func() {
+		gs.Join("test")
+		ps.topics["test"] = make(map[peer.ID]struct{})
+		for _, pid := range peers {
+			ps.peers[pid] = make(chan *RPC, 16)
+			ps.stats.addPeer(pid)
+			gs.peers[pid] = GossipSubID_v11
+			ps.topics["test"][pid] = struct{}{}
+		}
+	})
+	return ps, gs, eval
+}
+
+func graftTest() *pb.ControlMessage {
+	return &pb.ControlMessage{Graft: []*pb.ControlGraft{{TopicID: stringPtr("test")}}}
+}
+
+func TestGraftAuthorizer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	staker, other := peer.ID("staker"), peer.ID("other")
+	errNoStake := errors.New("no stake")
+	tracer := &graftAuthTracer{rejected: make(map[peer.ID]string)}
+	_, gs, eval := graftAuthTestRouter(t, ctx, []peer.ID{staker, other},
+		WithRawTracer(tracer),
+		WithGraftAuthorizer(func(p peer.ID, topic string) error {
+			if p != staker {
+				return errNoStake
+			}
+			return nil
+		}))
+
+	eval(func() {
+		if prune := gs.handleGraft(staker, graftTest()); len(prune) != 0 {
+			t.Errorf("expected the authorized peer to be grafted, got %v", prune)
+		}
+		if _, ok := gs.mesh["test"][staker]; !ok {
+			t.Error("expected the authorized peer in the mesh")
+		}
+
+		prune := gs.handleGraft(other, graftTest())
+		if len(prune) != 1 || prune[0].GetBackoff() != uint64(gs.params.PruneBackoff/time.Second) {
+			t.Errorf("expected a PRUNE with backoff for the unauthorized peer, got %v", prune)
+		}
+		if _, ok := gs.mesh["test"][other]; ok {
+			t.Error("expected the unauthorized peer out of the mesh")
+		}
+		if _, ok := gs.backoff["test"][other]; !ok {
+			t.Error("expected the unauthorized peer to be backed off")
+		}
+	})
+	if reason := tracer.reason(other); reason != errNoStake.Error() {
+		t.Fatalf("expected the refusal to be traced with the error, got %q", reason)
+	}
+	if reason := tracer.reason(staker); reason != "" {
+		t.Fatalf("expected no refusal for the authorized peer, got %q", reason)
+	}
+}
+
+func TestAsyncGraftAuthorizer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	staker, other := peer.ID("staker"), peer.ID("other")
+	errNoStake := errors.New("no stake")
+	clk := newMockClock()
+	tracer := &graftAuthTracer{rejected: make(map[peer.ID]string)}
+	release := make(chan struct{})
+	var calls atomic.Int32
+	ps, gs, eval := graftAuthTestRouter(t, ctx, []peer.ID{staker, other},
+		WithClock(clk),
+		WithRawTracer(tracer),
+		WithAsyncGraftAuthorizer(func(ctx context.Context, p peer.ID, topic string) error {
+			calls.Add(1)
+			<-release
+			if p != staker {
+				return errNoStake
+			}
+			return nil
+		}))
+
+	// the GRAFTs are provisionally pruned while the authorization is pending
+	for i := 0; i < 2; i++ {
+		eval(func() {
+			for _, p := range []peer.ID{staker, other} {
+				prune := gs.handleGraft(p, graftTest())
+				if len(prune) != 1 || prune[0].GetBackoff() != uint64(GossipSubProvisionalPruneBackoff/time.Second) {
+					t.Errorf("expected a provisional PRUNE for %s, got %v", p, prune)
+				}
+			}
+		})
+	}
+	close(release)
+
+	decided := func(p peer.ID) bool {
+		var ok bool
+		eval(func() {
+			ok = !gs.graftAuth.decisions[graftAuthKey{peer: p, topic: "test"}].expire.IsZero()
+		})
+		return ok
+	}
+	for start := time.Now(); !decided(staker) || !decided(other); {
+		if time.Since(start) > time.Second {
+			t.Fatal("expected the authorizations to complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("expected one authorization per peer, got %d", n)
+	}
+	if reason := tracer.reason(other); reason != errNoStake.Error() {
+		t.Fatalf("expected the refusal to be traced with the error, got %q", reason)
+	}
+
+	// the authorized peer is grafted back a heartbeat after its provisional backoff expires
+	eval(func() { drainRPCs(ps) })
+	var inMesh bool
+	time.Sleep(50 * time.Millisecond)
+	clk.Add(GossipSubProvisionalPruneBackoff)
+	time.Sleep(50 * time.Millisecond)
+	eval(func() { _, inMesh = gs.mesh["test"][staker] })
+	if inMesh {
+		t.Fatal("expected the authorized peer to be grafted back only after the slack")
+	}
+	for start := time.Now(); !inMesh && time.Since(start) < time.Second; {
+		// the timer of the graft may not be set yet
+		clk.Add(gs.params.HeartbeatInterval)
+		time.Sleep(10 * time.Millisecond)
+		eval(func() { _, inMesh = gs.mesh["test"][staker] })
+	}
+	if !inMesh {
+		t.Fatal("expected the authorized peer to be grafted back")
+	}
+	eval(func() {
+		grafted := false
+		for len(ps.peers[staker]) > 0 {
+			rpc := <-ps.peers[staker]
+			grafted = grafted || len(rpc.GetControl().GetGraft()) > 0
+		}
+		if !grafted {
+			t.Error("expected a GRAFT sent to the authorized peer")
+		}
+
+		// the decisions are remembered
+		if prune := gs.handleGraft(staker, graftTest()); len(prune) != 0 {
+			t.Errorf("expected no PRUNE for the grafted peer, got %v", prune)
+		}
+		if _, ok := gs.mesh["test"][other]; ok {
+			t.Error("expected the unauthorized peer out of the mesh")
+		}
+		if prune := gs.handleGraft(other, graftTest()); len(prune) != 1 || prune[0].GetBackoff() == uint64(GossipSubProvisionalPruneBackoff/time.Second) {
+			t.Errorf("expected a PRUNE with backoff for the unauthorized peer, got %v", prune)
+		}
+	})
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("expected the decisions to be remembered, got %d authorizations", n)
+	}
+}
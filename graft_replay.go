@@ -0,0 +1,44 @@
+package pubsub
+
+import (
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// WithGraftReplay makes the gossipsub router announce the messages of the gossip window of a
+// Topic to the peers it accepts a GRAFT from, right away rather than at the next heartbeat, so
+// that a peer joining the mesh mid-burst can IWANT the messages it missed. The announcement is
+// capped at MaxIHaveLength message IDs like the heartbeat gossip.
+func WithGraftReplay() TopicOpt {
+	return func(t *Topic) error {
+		t.graftReplay = true
+		return nil
+	}
+}
+
+// replaysOnGraft returns whether the topic is joined with WithGraftReplay.
+// Only called from processLoop.
+func (p *PubSub) replaysOnGraft(topic string) bool {
+	t, ok := p.myTopics[topic]
+	return ok && t.graftReplay
+}
+
+// replayGossip queues an IHAVE with the gossip window of a topic for a peer that grafted into
+// its mesh, if the topic replays on graft; it is sent with the response to the GRAFT.
+func (gs *GossipSubRouter) replayGossip(p peer.ID, topic string) {
+	if !gs.p.replaysOnGraft(topic) || gs.p.bestEffortBusy(p, topic) {
+		return
+	}
+
+	mids := gs.mcache.GetGossipIDs(topic)
+	if len(mids) == 0 {
+		return
+	}
+	if len(mids) > gs.params.MaxIHaveLength {
+		shuffleStrings(mids)
+		mids = mids[:gs.params.MaxIHaveLength]
+	}
+
+	gs.enqueueGossip(p, &pb.ControlIHave{TopicID: &topic, MessageIDs: mids})
+}
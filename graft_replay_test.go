@@ -0,0 +1,109 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestGraftReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	params := DefaultGossipSubParams()
+	params.MaxIHaveLength = 5
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getGossipsub(ctx, hosts[0], WithGossipSubParams(params), WithManualHeartbeat())
+	gs := ps.rt.(*GossipSubRouter)
+
+	eval := func(f func()) {
+		done := make(chan struct{})
+		ps.eval <- func() {
+			f()
+			close(done)
+		}
+		<-done
+	}
+
+	for topic, opts := range map[string][]TopicOpt{
+		"replay": {WithGraftReplay()},
+		"plain":  nil,
+	} {
+		tp, err := ps.Join(topic, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tp.Subscribe(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	eval(func() {
+		for _, topic := range []string{"replay", "plain"} {
+			for i := 0; i < 8; i++ {
+				gs.mcache.Put(&Message{Message: &pb.Message{
+					From:  []byte("author"),
+					Seqno: []byte(fmt.Sprint(i)),
+					Topic: stringPtr(topic),
+				}})
+			}
+		}
+		for _, pid := range []peer.ID{"a", "b"} {
+			ps.peers[pid] = make(chan *RPC, 16)
+			gs.peers[pid] = GossipSubID_v11
+			for _, topic := range []string{"replay", "plain"} {
+				if ps.topics[topic] == nil {
+					ps.topics[topic] = make(map[peer.ID]struct{})
+				}
+				ps.topics[topic][pid] = struct{}{}
+				ps.notifyJoin(topic, pid)
+			}
+		}
+	})
+
+	graft := func(pid peer.ID, topic string) (ihave []*pb.ControlIHave) {
+		eval(func() {
+			gs.HandleRPC(&RPC{
+				RPC: pb.RPC{Control: &pb.ControlMessage{
+					Graft: []*pb.ControlGraft{{TopicID: &topic}},
+				}},
+				from: pid,
+			})
+			if _, ok := gs.mesh[topic][pid]; !ok {
+				t.Errorf("expected %s to be grafted in %s", pid, topic)
+			}
+			for ch := ps.peers[pid]; len(ch) > 0; {
+				rpc := <-ch
+				ihave = append(ihave, rpc.GetControl().GetIhave()...)
+			}
+		})
+		return ihave
+	}
+
+	// the gossip window is announced right away, within the IHAVE limits
+	ihave := graft("a", "replay")
+	if len(ihave) != 1 {
+		t.Fatalf("expected one IHAVE replayed on graft, got %d", len(ihave))
+	}
+	if ihave[0].GetTopicID() != "replay" || len(ihave[0].GetMessageIDs()) != params.MaxIHaveLength {
+		t.Fatalf("expected %d message IDs of the replay topic, got %d of %s",
+			params.MaxIHaveLength, len(ihave[0].GetMessageIDs()), ihave[0].GetTopicID())
+	}
+	eval(func() {
+		for _, mid := range ihave[0].GetMessageIDs() {
+			if _, ok := gs.mcache.Get(mid); !ok {
+				t.Errorf("replayed message %s is not in the cache", mid)
+			}
+		}
+	})
+
+	// the other topics wait for the heartbeat gossip
+	if ihave := graft("b", "plain"); len(ihave) != 0 {
+		t.Fatalf("expected no IHAVE without replay, got %d", len(ihave))
+	}
+}
@@ -0,0 +1,215 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// HealthTracerWindow is the period over which the events dropped by the tracers are counted by
+// Health: the drops since the start of the previous window fail the tracer check.
+var HealthTracerWindow = time.Minute
+
+const (
+	// DefaultHealthMaxLatency is the longest the event loop may take to answer a health check.
+	DefaultHealthMaxLatency = time.Second
+	// DefaultHealthQueueThreshold is the fill ratio of the validation queues beyond which they
+	// are deemed saturated.
+	DefaultHealthQueueThreshold = 0.9
+)
+
+// HealthReport is the outcome of a health check; it is JSON serializable, to be returned as is
+// by probe handlers.
+type HealthReport struct {
+	// Healthy is whether all the checks passed.
+	Healthy bool `json:"healthy"`
+	// EventLoopLatency is the round trip time of an evaluation in the event loop; 0 if it
+	// didn't answer.
+	EventLoopLatency time.Duration `json:"eventLoopLatency"`
+	// Checks are the individual checks, in a stable order.
+	Checks []HealthCheck `json:"checks"`
+}
+
+// HealthCheck is the outcome of an individual check.
+type HealthCheck struct {
+	// Name identifies the check: "event-loop", "validation-queue", "tracer" or "topic:" followed
+	// by a critical topic.
+	Name string `json:"name"`
+	// Healthy is whether the check passed.
+	Healthy bool `json:"healthy"`
+	// Detail describes the observed state.
+	Detail string `json:"detail"`
+}
+
+// HealthOpt is an option for Health.
+type HealthOpt func(*healthOptions)
+
+type healthOptions struct {
+	topics         map[string]int
+	order          []string
+	maxLatency     time.Duration
+	queueThreshold float64
+}
+
+// WithHealthTopic declares a critical topic, which must have at least minPeers peers subscribed
+// to it for pubsub to be healthy.
+func WithHealthTopic(topic string, minPeers int) HealthOpt {
+	return func(opts *healthOptions) {
+		if _, ok := opts.topics[topic]; !ok {
+			opts.order = append(opts.order, topic)
+		}
+		opts.topics[topic] = minPeers
+	}
+}
+
+// WithHealthMaxLatency sets the longest the event loop may take to answer; it defaults to
+// DefaultHealthMaxLatency.
+func WithHealthMaxLatency(d time.Duration) HealthOpt {
+	return func(opts *healthOptions) {
+		opts.maxLatency = d
+	}
+}
+
+// WithHealthQueueThreshold sets the fill ratio of the validation queues, between 0 and 1, beyond
+// which they are deemed saturated; it defaults to DefaultHealthQueueThreshold.
+func WithHealthQueueThreshold(ratio float64) HealthOpt {
+	return func(opts *healthOptions) {
+		opts.queueThreshold = ratio
+	}
+}
+
+// Health checks that pubsub is healthy: the event loop answers an evaluation within the maximum
+// latency, the critical topics have enough peers, the validation queues are not saturated and
+// the tracers did not drop events recently, as measured over HealthTracerWindow. Checking
+// doesn't reset anything, so concurrent probes get consistent reports. The checks are cheap enough to back
+// liveness and readiness probes; an event loop that doesn't answer before ctx is done fails its
+// check, and the error is only returned once pubsub has shut down.
+func (p *PubSub) Health(ctx context.Context, opts ...HealthOpt) (HealthReport, error) {
+	options := healthOptions{
+		topics:         make(map[string]int),
+		maxLatency:     DefaultHealthMaxLatency,
+		queueThreshold: DefaultHealthQueueThreshold,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var report HealthReport
+
+	// round trip an evaluation, counting the peers of the critical topics on the way
+	start := time.Now()
+	out := make(chan map[string]int, 1)
+	eval := func() {
+		peers := make(map[string]int, len(options.topics))
+		for topic := range options.topics {
+			peers[topic] = len(p.topics[topic])
+		}
+		out <- peers
+	}
+
+	var peers map[string]int
+	var loopErr error
+	select {
+	case p.eval <- eval:
+		select {
+		case peers = <-out:
+		case <-ctx.Done():
+			loopErr = ctx.Err()
+		}
+	case <-ctx.Done():
+		loopErr = ctx.Err()
+	case <-p.ctx.Done():
+		return report, p.ctx.Err()
+	}
+
+	if loopErr != nil {
+		report.add("event-loop", false, fmt.Sprintf("no answer: %s", loopErr))
+	} else {
+		report.EventLoopLatency = time.Since(start)
+		report.add("event-loop", report.EventLoopLatency <= options.maxLatency,
+			fmt.Sprintf("answered in %s, at most %s", report.EventLoopLatency, options.maxLatency))
+	}
+
+	depth := len(p.val.verifyQ) + len(p.val.validateQ)
+	capacity := cap(p.val.verifyQ) + cap(p.val.validateQ)
+	report.add("validation-queue", float64(depth) < options.queueThreshold*float64(capacity),
+		fmt.Sprintf("%d of %d queued", depth, capacity))
+
+	drops := p.tracerDrops.since(p.clock.Now(), p.tracerDropped())
+	report.add("tracer", drops == 0,
+		fmt.Sprintf("%d events dropped in the last %s", drops, HealthTracerWindow))
+
+	for _, topic := range options.order {
+		minPeers := options.topics[topic]
+		name := "topic:" + topic
+		if peers == nil {
+			report.add(name, false, "unknown: the event loop didn't answer")
+			continue
+		}
+		report.add(name, peers[topic] >= minPeers,
+			fmt.Sprintf("%d peers, at least %d", peers[topic], minPeers))
+	}
+
+	return report, nil
+}
+
+// Healthy returns whether all the checks of Health pass, for probe handlers.
+func (p *PubSub) Healthy(ctx context.Context, opts ...HealthOpt) bool {
+	report, err := p.Health(ctx, opts...)
+	return err == nil && report.Healthy
+}
+
+// add appends a check to the report, which stays healthy while all the checks pass
+func (r *HealthReport) add(name string, healthy bool, detail string) {
+	if len(r.Checks) == 0 {
+		r.Healthy = true
+	}
+	r.Checks = append(r.Checks, HealthCheck{Name: name, Healthy: healthy, Detail: detail})
+	r.Healthy = r.Healthy && healthy
+}
+
+// tracerDropped returns the number of events dropped by the lossy tracers so far
+func (p *PubSub) tracerDropped() uint64 {
+	t := p.tracer
+	if t == nil {
+		return 0
+	}
+
+	var dropped uint64
+	if lt, ok := t.tracer.(LossyTracer); ok {
+		dropped += lt.Dropped()
+	}
+	for _, tr := range t.rawTracers() {
+		if lt, ok := tr.(LossyTracer); ok {
+			dropped += lt.Dropped()
+		}
+	}
+	return dropped
+}
+
+// dropWindow counts the events dropped by the tracers over time windows, which are advanced as
+// the drops are read
+type dropWindow struct {
+	mx sync.Mutex
+	// start is the start of the current window, and base and prev the drop counts at the start
+	// of the current and previous windows
+	start      time.Time
+	base, prev uint64
+}
+
+// since returns the drops since the start of the previous window, given the current count
+func (w *dropWindow) since(now time.Time, dropped uint64) uint64 {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	if w.start.IsZero() {
+		w.start = now
+	}
+	if now.Sub(w.start) >= HealthTracerWindow {
+		w.start = now
+		w.prev = w.base
+		w.base = dropped
+	}
+	return dropped - min(dropped, w.prev)
+}
@@ -0,0 +1,89 @@
+package pubsub
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type lossyRawTracer struct {
+	noopRawTracer
+	dropped atomic.Uint64
+}
+
+func (t *lossyRawTracer) Dropped() uint64 {
+	return t.dropped.Load()
+}
+
+func TestHealth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracer := &lossyRawTracer{}
+	hosts := getNetHosts(t, ctx, 2)
+	clk := newMockClock()
+	psubs := getGossipsubs(ctx, hosts, WithRawTracer(tracer), WithClock(clk))
+	mustSubscribe(t, psubs[0], "test")
+
+	check := func(expected map[string]bool) {
+		t.Helper()
+		report, err := psubs[0].Health(ctx, WithHealthTopic("test", 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		healthy := true
+		for _, c := range report.Checks {
+			if c.Healthy != expected[c.Name] {
+				t.Fatalf("expected check %s to be healthy: %v, got %+v", c.Name, expected[c.Name], c)
+			}
+			healthy = healthy && c.Healthy
+		}
+		if len(report.Checks) != len(expected) || report.Healthy != healthy {
+			t.Fatalf("unexpected report %+v", report)
+		}
+	}
+
+	// the critical topic has no peer yet
+	check(map[string]bool{"event-loop": true, "validation-queue": true, "tracer": true, "topic:test": false})
+
+	connect(t, hosts[0], hosts[1])
+	mustSubscribe(t, psubs[1], "test")
+	time.Sleep(100 * time.Millisecond)
+	check(map[string]bool{"event-loop": true, "validation-queue": true, "tracer": true, "topic:test": true})
+	if !psubs[0].Healthy(ctx, WithHealthTopic("test", 1)) {
+		t.Fatal("expected pubsub to be healthy")
+	}
+
+	// the tracer check fails for every check while the drops are recent
+	tracer.dropped.Add(3)
+	check(map[string]bool{"event-loop": true, "validation-queue": true, "tracer": false, "topic:test": true})
+	check(map[string]bool{"event-loop": true, "validation-queue": true, "tracer": false, "topic:test": true})
+	clk.Add(HealthTracerWindow)
+	check(map[string]bool{"event-loop": true, "validation-queue": true, "tracer": false, "topic:test": true})
+	clk.Add(HealthTracerWindow)
+	check(map[string]bool{"event-loop": true, "validation-queue": true, "tracer": true, "topic:test": true})
+
+	// a blocked event loop fails its check and the topic checks
+	release := make(chan struct{})
+	psubs[0].eval <- func() { <-release }
+	tctx, tcancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	report, err := psubs[0].Health(tctx, WithHealthTopic("test", 1))
+	tcancel()
+	close(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Healthy || report.Checks[0].Healthy || !report.Checks[1].Healthy || report.Checks[3].Healthy {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	// and the latency is checked
+	report, err = psubs[0].Health(ctx, WithHealthMaxLatency(time.Nanosecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Healthy || report.Checks[0].Healthy || report.EventLoopLatency <= 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,109 @@
+package pubsub
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// IngressQueueSize is the size of the queue of each ingress worker.
+var IngressQueueSize = 32
+
+// WithIngressWorkers pre-processes the inbound RPCs in a pool of n workers before handing them
+// to the event loop: the message IDs are computed, the signature policy is checked and the seen
+// messages cache is looked up off the event loop, which only has to act on the results.
+// The RPCs of a peer are always handled by the same worker, preserving their order.
+func WithIngressWorkers(n int) Option {
+	return func(p *PubSub) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid number of ingress workers")
+		}
+		p.ingressWorkers = n
+		return nil
+	}
+}
+
+// ingressCheck is the pre-processing of a payload message by the ingress workers
+type ingressCheck struct {
+	// msg is the message, with its ID computed
+	msg *Message
+	// reject is the reason for rejecting the message under the signature policy, if any
+	reject string
+	// seen is whether the message had already been seen
+	seen bool
+}
+
+// ingressCheck returns the ingress worker checks of the ith payload message, or nil
+func (rpc *RPC) ingressCheck(i int) *ingressCheck {
+	if i >= len(rpc.checks) || rpc.checks[i].msg.Message != rpc.Publish[i] {
+		return nil
+	}
+	return &rpc.checks[i]
+}
+
+func (p *PubSub) startIngressWorkers() {
+	for i := 0; i < p.ingressWorkers; i++ {
+		ch := make(chan *RPC, IngressQueueSize)
+		p.ingress = append(p.ingress, ch)
+		go p.ingressWorker(ch)
+	}
+}
+
+// sendIncoming hands an inbound RPC to the event loop, through the ingress worker of its peer if
+// enabled; it returns false if the pubsub instance is shutting down
+func (p *PubSub) sendIncoming(rpc *RPC) bool {
+	ch := p.incoming
+	if len(p.ingress) > 0 {
+		ch = p.ingress[ingressShard(rpc.from, len(p.ingress))]
+	}
+
+	select {
+	case ch <- rpc:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+func ingressShard(pid peer.ID, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(pid))
+	return int(h.Sum32() % uint32(n))
+}
+
+func (p *PubSub) ingressWorker(ch <-chan *RPC) {
+	for {
+		select {
+		case rpc := <-ch:
+			p.checkIncoming(rpc)
+			select {
+			case p.incoming <- rpc:
+			case <-p.ctx.Done():
+				return
+			}
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// checkIncoming pre-processes the payload messages of an inbound RPC, without touching the event
+// loop state
+func (p *PubSub) checkIncoming(rpc *RPC) {
+	pmsgs := rpc.GetPublish()
+	if len(pmsgs) == 0 {
+		return
+	}
+
+	rpc.checks = slices.Grow(rpc.checks[:0], len(pmsgs))[:len(pmsgs)]
+	for i, pmsg := range pmsgs {
+		check := &rpc.checks[i]
+		*check = ingressCheck{msg: &Message{Message: pmsg, ReceivedFrom: rpc.from}}
+		if check.reject = p.signingPolicyReject(check.msg); check.reject != "" {
+			continue
+		}
+		check.seen = p.seenMessage(pmsg.GetTopic(), p.idGen.ID(check.msg))
+	}
+}
@@ -0,0 +1,169 @@
+package pubsub
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestIngressWorkers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	psubs := []*PubSub{
+		getGossipsub(ctx, hosts[0], WithIngressWorkers(4)),
+		getGossipsub(ctx, hosts[1]),
+		getGossipsub(ctx, hosts[2]),
+	}
+
+	sub, err := psubs[0].Subscribe("test", WithBufferSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ps := range psubs[1:] {
+		mustSubscribe(t, ps, "test")
+	}
+	connect(t, hosts[1], hosts[0])
+	connect(t, hosts[2], hosts[0])
+	time.Sleep(2 * time.Second)
+
+	// the messages of each peer are delivered in order, and once
+	for i := 0; i < 50; i++ {
+		for _, ps := range psubs[1:] {
+			if err := ps.Publish("test", []byte(fmt.Sprintf("%s-%d", ps.host.ID(), i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	nctx, ncancel := context.WithTimeout(ctx, 10*time.Second)
+	defer ncancel()
+	next := make(map[peer.ID]int)
+	for i := 0; i < 100; i++ {
+		msg, err := sub.Next(nctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		from := msg.GetFrom()
+		if expected := fmt.Sprintf("%s-%d", peer.ID(from), next[peer.ID(from)]); string(msg.Data) != expected {
+			t.Fatalf("expected message %s, got %s", expected, msg.Data)
+		}
+		next[peer.ID(from)]++
+	}
+
+	rctx, rcancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer rcancel()
+	if msg, err := sub.Next(rctx); err == nil {
+		t.Fatalf("unexpected duplicate message %s", msg.Data)
+	}
+}
+
+func TestIngressChecks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0], WithIngressWorkers(1))
+
+	topic := "test"
+	seen := &pb.Message{From: []byte("author"), Seqno: []byte("1"), Topic: &topic, Signature: []byte("sig")}
+	fresh := &pb.Message{From: []byte("author"), Seqno: []byte("2"), Topic: &topic, Signature: []byte("sig")}
+	unsigned := &pb.Message{From: []byte("author"), Seqno: []byte("3"), Topic: &topic}
+	ps.markSeen(topic, DefaultMsgIdFn(seen))
+
+	rpc := &RPC{RPC: pb.RPC{Publish: []*pb.Message{seen, fresh, unsigned}}, from: peer.ID("sender")}
+	ps.checkIncoming(rpc)
+
+	if c := rpc.ingressCheck(0); c == nil || !c.seen || c.msg.ID != DefaultMsgIdFn(seen) {
+		t.Fatal("expected the message to be seen, with its id computed")
+	}
+	if c := rpc.ingressCheck(1); c == nil || c.seen || c.reject != "" {
+		t.Fatal("expected the message to be accepted")
+	}
+	if c := rpc.ingressCheck(2); c == nil || c.reject != RejectMissingSignature {
+		t.Fatal("expected the unsigned message to be rejected")
+	}
+
+	// checks no longer matching the payload are ignored
+	rpc.Publish = rpc.Publish[1:]
+	if rpc.ingressCheck(0) != nil {
+		t.Fatal("expected the stale check to be ignored")
+	}
+}
+
+type recvRPCCounter struct {
+	noopRawTracer
+	count atomic.Int64
+}
+
+func (t *recvRPCCounter) RecvRPC(rpc *RPC) {
+	t.count.Add(1)
+}
+
+// BenchmarkIngress compares the event loop throughput of inbound RPCs, mostly carrying duplicate
+// messages with an expensive message id function, with and without ingress workers.
+func BenchmarkIngress(b *testing.B) {
+	msgID := func(pmsg *pb.Message) string {
+		h := sha256.Sum256(pmsg.Data)
+		for i := 0; i < 64; i++ {
+			h = sha256.Sum256(h[:])
+		}
+		return string(h[:])
+	}
+
+	for _, workers := range []int{0, 1, 4} {
+		b.Run(fmt.Sprintf("Workers%d", workers), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			tracer := &recvRPCCounter{}
+			opts := []Option{
+				WithMessageIdFn(msgID),
+				WithMessageSignaturePolicy(StrictNoSign),
+				WithNoAuthor(),
+				WithRawTracer(tracer),
+			}
+			if workers > 0 {
+				opts = append(opts, WithIngressWorkers(workers))
+			}
+			h, err := libp2p.New(libp2p.NoListenAddrs)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer h.Close()
+			ps := getPubsub(ctx, h, opts...)
+			if _, err := ps.Subscribe("test"); err != nil {
+				b.Fatal(err)
+			}
+
+			topic := "test"
+			payloads := make([]*pb.Message, 64)
+			for i := range payloads {
+				payloads[i] = &pb.Message{Data: []byte(fmt.Sprintf("payload-%d", i)), Topic: &topic}
+			}
+			senders := make([]peer.ID, 16)
+			for i := range senders {
+				senders[i] = peer.ID(fmt.Sprintf("sender-%d", i))
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				rpc := &RPC{RPC: pb.RPC{Publish: []*pb.Message{payloads[i%len(payloads)]}}, from: senders[i%len(senders)]}
+				ps.sendIncoming(rpc)
+			}
+			for tracer.count.Load() < int64(b.N) {
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package pubsub
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// WithAppSpecificRPCInspector sets an inspector of the inbound RPCs, to drop the RPCs violating
+// an application policy before any of their messages or subscriptions are processed.
+//
+// The inspector is invoked right after an RPC is decoded, from the goroutine reading the stream
+// of the peer, so it is invoked concurrently for different peers and must be fast: it is on the
+// hot path of every RPC. If it returns an error, the RPC is dropped, reported with the error
+// string to the raw tracers implementing RPCInspectorTracer, and penalized per
+// WithRPCInspectorPenalty.
+//
+// The inspector must treat the RPC as read-only and must not retain it: the RPC is processed
+// after the inspection, and recycled afterwards unless WithoutPooling is set.
+func WithAppSpecificRPCInspector(inspector func(peer.ID, *RPC) error) Option {
+	return func(ps *PubSub) error {
+		ps.rpcInspector = inspector
+		return nil
+	}
+}
+
+// WithRPCInspectorPenalty sets the number of behaviour penalties applied to the score of a peer
+// for every RPC dropped by the inspector set with WithAppSpecificRPCInspector, with gossipsub
+// peer scoring; 0, the default, disables the penalty.
+func WithRPCInspectorPenalty(count int) Option {
+	return func(ps *PubSub) error {
+		if count < 0 {
+			return fmt.Errorf("invalid rpc inspector penalty: %d", count)
+		}
+		ps.rpcInspectorPenalty = count
+		return nil
+	}
+}
+
+// RPCInspectorTracer is an optional interface for RawTracers, which is invoked when an inbound
+// RPC is dropped by the inspector set with WithAppSpecificRPCInspector, with the error string
+// of the inspector.
+type RPCInspectorTracer interface {
+	RejectRPC(p peer.ID, reason string)
+}
+
+// inspectRPC passes a decoded RPC to the application inspector, if any, returning false if it
+// must be dropped
+func (p *PubSub) inspectRPC(pid peer.ID, rpc *RPC) bool {
+	if p.rpcInspector == nil {
+		return true
+	}
+
+	err := p.rpcInspector(pid, rpc)
+	if err == nil {
+		return true
+	}
+
+	log.Debugf("dropping rpc from %s rejected by the inspector: %s", pid, err)
+	p.tracer.RejectRPC(pid, err.Error())
+	if p.rpcInspectorPenalty > 0 {
+		if pr, ok := p.rt.(penaltyRouter); ok {
+			pr.addBehaviourPenalty(pid, p.rpcInspectorPenalty)
+		}
+	}
+	return false
+}
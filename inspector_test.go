@@ -0,0 +1,154 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+type rpcInspectorTracer struct {
+	noopRawTracer
+
+	mx       sync.Mutex
+	rejected map[peer.ID][]string
+}
+
+func (t *rpcInspectorTracer) RejectRPC(p peer.ID, reason string) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.rejected[p] = append(t.rejected[p], reason)
+}
+
+// penaltyRecorder is a floodsub router recording the behaviour penalties
+type penaltyRecorder struct {
+	*FloodSubRouter
+
+	mx        sync.Mutex
+	penalties map[peer.ID]int
+}
+
+func (r *penaltyRecorder) addBehaviourPenalty(p peer.ID, count int) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.penalties[p] += count
+}
+
+func TestAppSpecificRPCInspector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	banned := hosts[1].ID()
+	errBanned := errors.New("banned")
+	tracer := &rpcInspectorTracer{rejected: make(map[peer.ID][]string)}
+	rt := &penaltyRecorder{
+		FloodSubRouter: &FloodSubRouter{protocols: []protocol.ID{FloodSubID}},
+		penalties:      make(map[peer.ID]int),
+	}
+	ps, err := NewPubSub(ctx, hosts[0], rt,
+		WithRawTracer(tracer),
+		WithRPCInspectorPenalty(2),
+		WithAppSpecificRPCInspector(func(p peer.ID, rpc *RPC) error {
+			if p == banned {
+				return errBanned
+			}
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	senders := getPubsubs(ctx, hosts[1:])
+
+	sub := mustSubscribe(t, ps, "test")
+	for _, sender := range senders {
+		mustSubscribe(t, sender, "test")
+	}
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[0], hosts[2])
+	time.Sleep(100 * time.Millisecond)
+
+	// the subscriptions of the banned peer are not processed either
+	if peers := ps.ListPeers("test"); len(peers) != 1 || peers[0] != hosts[2].ID() {
+		t.Fatalf("expected only the allowed peer in the topic, got %v", peers)
+	}
+
+	if err := senders[0].Publish("test", []byte("banned")); err != nil {
+		t.Fatal(err)
+	}
+	if err := senders[1].Publish("test", []byte("allowed")); err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, sub, []byte("allowed"))
+	assertNeverReceives(t, sub, 100*time.Millisecond)
+
+	tracer.mx.Lock()
+	reasons := tracer.rejected[banned]
+	others := len(tracer.rejected) - 1
+	tracer.mx.Unlock()
+	if len(reasons) < 2 || others != 0 {
+		t.Fatalf("expected the RPCs of the banned peer only to be rejected, got %v", tracer.rejected)
+	}
+	for _, reason := range reasons {
+		if reason != errBanned.Error() {
+			t.Fatalf("expected the rejections to be traced with the error, got %q", reason)
+		}
+	}
+
+	rt.mx.Lock()
+	defer rt.mx.Unlock()
+	if rt.penalties[banned] != 2*len(reasons) || len(rt.penalties) != 1 {
+		t.Fatalf("expected 2 penalties per rejected RPC of the banned peer, got %v", rt.penalties)
+	}
+}
+
+// BenchmarkAppSpecificRPCInspector measures the decoding of an RPC with and without an inspector
+// checking a ban list.
+func BenchmarkAppSpecificRPCInspector(b *testing.B) {
+	topic := "test"
+	data := make([]byte, 256)
+	rpc := &pb.RPC{Publish: []*pb.Message{{From: []byte("author"), Data: data, Seqno: []byte("12345678"), Topic: &topic}}}
+	raw, err := rpc.Marshal()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	banned := make(map[peer.ID]struct{})
+	for i := 0; i < 1000; i++ {
+		banned[peer.ID(rune(i))] = struct{}{}
+	}
+	inspector := func(p peer.ID, rpc *RPC) error {
+		if _, ok := banned[p]; ok {
+			return errors.New("banned")
+		}
+		return nil
+	}
+
+	for _, bc := range []struct {
+		name      string
+		inspector func(peer.ID, *RPC) error
+	}{
+		{"none", nil},
+		{"banlist", inspector},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			p := &PubSub{rpcInspector: bc.inspector, noPooling: true}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				rpc := new(RPC)
+				if err := rpc.Unmarshal(raw); err != nil {
+					b.Fatal(err)
+				}
+				if !p.inspectRPC("sender", rpc) {
+					b.Fatal("unexpected rejection")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package pubsub
+
+import (
+	"fmt"
+	"net/netip"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// IPBlockList is a list of blocked IPv4 and IPv6 subnets.
+// It is safe for concurrent use and can be updated at runtime.
+type IPBlockList struct {
+	mx       sync.RWMutex
+	prefixes map[netip.Prefix]struct{}
+}
+
+// NewIPBlockList creates an IPBlockList with the given subnets in CIDR notation.
+func NewIPBlockList(cidrs ...string) (*IPBlockList, error) {
+	bl := &IPBlockList{prefixes: make(map[netip.Prefix]struct{})}
+	for _, cidr := range cidrs {
+		if err := bl.Add(cidr); err != nil {
+			return nil, err
+		}
+	}
+	return bl, nil
+}
+
+// Add blocks a subnet in CIDR notation, e.g. "192.0.2.0/24" or "2001:db8::/32".
+func (bl *IPBlockList) Add(cidr string) error {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+	}
+
+	bl.mx.Lock()
+	defer bl.mx.Unlock()
+
+	bl.prefixes[prefix.Masked()] = struct{}{}
+	return nil
+}
+
+// Remove unblocks a subnet previously added in CIDR notation.
+func (bl *IPBlockList) Remove(cidr string) error {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+	}
+
+	bl.mx.Lock()
+	defer bl.mx.Unlock()
+
+	delete(bl.prefixes, prefix.Masked())
+	return nil
+}
+
+// Blocked returns whether the IP address of a multiaddr is in a blocked subnet; multiaddrs
+// without an IP address are never blocked.
+func (bl *IPBlockList) Blocked(addr ma.Multiaddr) bool {
+	ip, err := manet.ToIP(addr)
+	if err != nil {
+		return false
+	}
+	ipAddr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	ipAddr = ipAddr.Unmap()
+
+	bl.mx.RLock()
+	defer bl.mx.RUnlock()
+
+	for prefix := range bl.prefixes {
+		if prefix.Contains(ipAddr) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithIPBlockList rejects the pubsub streams of peers connected from a blocked subnet, and
+// doesn't connect to the addresses in a blocked subnet of the peers exchanged in gossipsub
+// PX. Blocked attempts are reported to raw tracers implementing IPBlockListTracer.
+func WithIPBlockList(bl *IPBlockList) Option {
+	return func(p *PubSub) error {
+		if bl == nil {
+			return fmt.Errorf("nil IP block list")
+		}
+		p.ipBlockList = bl
+		return nil
+	}
+}
+
+// IPBlockListTracer is an optional interface for RawTracers, which is invoked when a stream or
+// a PX connection attempt is blocked by the IP block list. It is invoked from the stream
+// handlers, so it must be safe for concurrent use.
+type IPBlockListTracer interface {
+	IPBlocked(p peer.ID, addr ma.Multiaddr)
+}
+
+// ipBlocked checks the address of a peer against the IP block list, tracing blocked attempts
+func (p *PubSub) ipBlocked(pid peer.ID, addr ma.Multiaddr) bool {
+	if p.ipBlockList == nil || !p.ipBlockList.Blocked(addr) {
+		return false
+	}
+
+	log.Debugf("blocked address %s of peer %s", addr, pid)
+	p.tracer.IPBlocked(pid, addr)
+	return true
+}
+
+// filterBlockedAddrs returns the addresses of a peer that are not blocked by the IP block list
+func (p *PubSub) filterBlockedAddrs(pid peer.ID, addrs []ma.Multiaddr) []ma.Multiaddr {
+	if p.ipBlockList == nil {
+		return addrs
+	}
+
+	allowed := make([]ma.Multiaddr, 0, len(addrs))
+	for _, addr := range addrs {
+		if !p.ipBlocked(pid, addr) {
+			allowed = append(allowed, addr)
+		}
+	}
+	return allowed
+}
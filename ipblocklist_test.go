@@ -0,0 +1,108 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+type ipBlockTracer struct {
+	noopRawTracer
+
+	mx      sync.Mutex
+	blocked map[peer.ID]int
+}
+
+func (t *ipBlockTracer) IPBlocked(p peer.ID, addr ma.Multiaddr) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.blocked[p]++
+}
+
+func (t *ipBlockTracer) count(p peer.ID) int {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return t.blocked[p]
+}
+
+func TestIPBlockList(t *testing.T) {
+	bl, err := NewIPBlockList("192.0.2.0/24", "2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for addr, blocked := range map[string]bool{
+		"/ip4/192.0.2.17/tcp/4001":               true,
+		"/ip4/198.51.100.1/tcp/4001":             false,
+		"/ip6/2001:db8::1/tcp/4001":              true,
+		"/ip6/2001:db9::1/tcp/4001":              false,
+		"/ip6/::ffff:192.0.2.1/udp/4001/quic-v1": true,
+		"/dns4/example.com/tcp/4001":             false,
+	} {
+		if bl.Blocked(ma.StringCast(addr)) != blocked {
+			t.Fatalf("expected %s to be blocked: %t", addr, blocked)
+		}
+	}
+
+	if err := bl.Remove("192.0.2.0/24"); err != nil {
+		t.Fatal(err)
+	}
+	if bl.Blocked(ma.StringCast("/ip4/192.0.2.17/tcp/4001")) {
+		t.Fatal("expected the subnet to be unblocked")
+	}
+
+	if err := bl.Add("192.0.2.0"); err == nil {
+		t.Fatal("expected an error for an invalid CIDR")
+	}
+}
+
+func TestIPBlockListStreams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bl, err := NewIPBlockList("127.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := &ipBlockTracer{blocked: make(map[peer.ID]int)}
+
+	hosts := getNetHosts(t, ctx, 2)
+	ps := getPubsub(ctx, hosts[0], WithIPBlockList(bl), WithRawTracer(tracer))
+	other := getPubsub(ctx, hosts[1])
+
+	sub, err := ps.Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Subscribe("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(100 * time.Millisecond)
+
+	if peers := ps.ListPeers("test"); len(peers) != 0 {
+		t.Fatalf("expected the blocked peer not to be attached, got %v", peers)
+	}
+	if tracer.count(hosts[1].ID()) == 0 {
+		t.Fatal("expected the blocked attempts to be traced")
+	}
+
+	// the block list can be updated at runtime
+	if err := bl.Remove("127.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	hosts[0].Network().ClosePeer(hosts[1].ID())
+	time.Sleep(100 * time.Millisecond)
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(100 * time.Millisecond)
+
+	if err := other.Publish("test", []byte("unblocked")); err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, sub, []byte("unblocked"))
+}
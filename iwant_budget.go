@@ -0,0 +1,250 @@
+package pubsub
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// GossipSubIWantDefaultMessageSize is the estimated size of the messages of a topic requested with
+// IWANT, for the budget set with WithIWantBudget, until the size of the messages of the topic is
+// known.
+var GossipSubIWantDefaultMessageSize = 1024
+
+// IWantStats are the counters of the messages requested with IWANT under the budget set with
+// WithIWantBudget.
+type IWantStats struct {
+	// Outstanding is the number of IWANT requests for messages still awaiting a response.
+	Outstanding int `json:"outstanding"`
+	// Bytes is the estimated size of the messages of the outstanding requests.
+	Bytes int `json:"bytes"`
+	// Deferred is the number of messages advertised with IHAVE that we didn't request because
+	// the budget was exhausted.
+	Deferred uint64 `json:"deferred"`
+}
+
+// WithIWantBudget is a gossipsub router option capping the memory of the messages we requested
+// with IWANT and are waiting for, as they can arrive in a burst. The size of each requested
+// message is estimated with the average size of the messages received in its topic, or
+// GossipSubIWantDefaultMessageSize at first. Once the budget is exhausted, the messages advertised
+// with IHAVE are not requested until responses arrive, or the requests time out after the IWANT
+// followup time.
+//
+// The outstanding requests are reported in the IWants field of Stats.
+func WithIWantBudget(bytes int) Option {
+	return func(ps *PubSub) error {
+		gs, ok := ps.rt.(*GossipSubRouter)
+		if !ok {
+			return fmt.Errorf("pubsub router is not gossipsub")
+		}
+		if bytes <= 0 {
+			return fmt.Errorf("invalid IWANT budget: %d", bytes)
+		}
+
+		gs.iwantBudget = newIWantBudget(ps, bytes)
+
+		// hook the tracer
+		if ps.tracer == nil {
+			ps.tracer = &pubsubTracer{pid: ps.host.ID(), idGen: ps.idGen}
+		}
+		ps.tracer.addRaw(gs.iwantBudget)
+
+		return nil
+	}
+}
+
+// iwantBudget is an internal tracer that accounts for the messages requested with IWANT until they
+// arrive, within a byte budget.
+type iwantBudget struct {
+	sync.Mutex
+
+	idGen *msgIDGenerator
+	clock Clock
+	limit int
+
+	followUpTime time.Duration
+
+	// the outstanding requests by message ID
+	pending map[string]*pendingIWant
+	// the number and estimated size of the outstanding requests
+	outstanding, used int
+	// the average message size by topic
+	sizes map[string]float64
+
+	deferred atomic.Uint64
+}
+
+// pendingIWant are the requests for a message, from one or more peers
+type pendingIWant struct {
+	requests int
+	reserved int
+	expire   time.Time
+}
+
+func newIWantBudget(p *PubSub, limit int) *iwantBudget {
+	return &iwantBudget{
+		idGen:        p.idGen,
+		clock:        p.clock,
+		limit:        limit,
+		followUpTime: GossipSubIWantFollowupTime,
+		pending:      make(map[string]*pendingIWant),
+		sizes:        make(map[string]float64),
+	}
+}
+
+func (ib *iwantBudget) Start(gs *GossipSubRouter) {
+	if ib == nil {
+		return
+	}
+
+	ib.idGen = gs.p.idGen
+	ib.clock = gs.p.clock
+	ib.followUpTime = gs.params.IWantFollowupTime
+}
+
+// estimate returns the estimated size of a message of a topic
+func (ib *iwantBudget) estimate(topic string) int {
+	if size, ok := ib.sizes[topic]; ok {
+		return int(size)
+	}
+	return GossipSubIWantDefaultMessageSize
+}
+
+// reserve reserves the budget for the messages to request, by message ID with their topic,
+// returning the ones within the budget
+func (ib *iwantBudget) reserve(mids []string, topics map[string]string) []string {
+	if ib == nil {
+		return mids
+	}
+
+	ib.Lock()
+	defer ib.Unlock()
+
+	expire := ib.clock.Now().Add(ib.followUpTime)
+	for i, mid := range mids {
+		size := ib.estimate(topics[mid])
+		// a message larger than the budget is still requested when nothing is outstanding
+		if ib.used+size > ib.limit && ib.outstanding > 0 {
+			ib.deferred.Add(uint64(len(mids) - i))
+			return mids[:i]
+		}
+
+		req, ok := ib.pending[mid]
+		if !ok {
+			req = new(pendingIWant)
+			ib.pending[mid] = req
+		}
+		req.requests++
+		req.reserved += size
+		req.expire = expire
+		ib.outstanding++
+		ib.used += size
+	}
+	return mids
+}
+
+// release frees the budget reserved for a message, as it arrived
+func (ib *iwantBudget) release(msg *Message) {
+	if len(ib.pending) == 0 {
+		return
+	}
+	mid := ib.idGen.ID(msg)
+	if req, ok := ib.pending[mid]; ok {
+		ib.free(mid, req)
+	}
+}
+
+func (ib *iwantBudget) free(mid string, req *pendingIWant) {
+	ib.outstanding -= req.requests
+	ib.used -= req.reserved
+	delete(ib.pending, mid)
+}
+
+// expire frees the budget reserved for the requests that were not answered in time
+func (ib *iwantBudget) expire() {
+	if ib == nil {
+		return
+	}
+
+	ib.Lock()
+	defer ib.Unlock()
+
+	now := ib.clock.Now()
+	for mid, req := range ib.pending {
+		if now.After(req.expire) {
+			ib.free(mid, req)
+		}
+	}
+}
+
+// stats returns the outstanding requests, resetting the deferred counter if asked
+func (ib *iwantBudget) stats(reset bool) IWantStats {
+	if ib == nil {
+		return IWantStats{}
+	}
+
+	ib.Lock()
+	defer ib.Unlock()
+
+	s := IWantStats{Outstanding: ib.outstanding, Bytes: ib.used}
+	if reset {
+		s.Deferred = ib.deferred.Swap(0)
+	} else {
+		s.Deferred = ib.deferred.Load()
+	}
+	return s
+}
+
+var _ RawTracer = (*iwantBudget)(nil)
+
+func (ib *iwantBudget) ValidateMessage(msg *Message) {
+	ib.Lock()
+	defer ib.Unlock()
+
+	// the average size of the messages of the topic, weighing the recent ones
+	size := float64(msg.Size())
+	if avg, ok := ib.sizes[msg.GetTopic()]; ok {
+		ib.sizes[msg.GetTopic()] = avg + (size-avg)/8
+	} else {
+		ib.sizes[msg.GetTopic()] = size
+	}
+
+	ib.release(msg)
+}
+
+func (ib *iwantBudget) RejectMessage(msg *Message, reason string) {
+	ib.Lock()
+	defer ib.Unlock()
+
+	ib.release(msg)
+}
+
+func (ib *iwantBudget) DuplicateMessage(msg *Message) {
+	ib.Lock()
+	defer ib.Unlock()
+
+	ib.release(msg)
+}
+
+func (ib *iwantBudget) Leave(topic string) {
+	ib.Lock()
+	defer ib.Unlock()
+
+	delete(ib.sizes, topic)
+}
+
+func (ib *iwantBudget) AddPeer(p peer.ID, proto protocol.ID) {}
+func (ib *iwantBudget) RemovePeer(p peer.ID)                 {}
+func (ib *iwantBudget) Join(topic string)                    {}
+func (ib *iwantBudget) Graft(p peer.ID, topic string)        {}
+func (ib *iwantBudget) Prune(p peer.ID, topic string)        {}
+func (ib *iwantBudget) DeliverMessage(msg *Message)          {}
+func (ib *iwantBudget) ThrottlePeer(p peer.ID)               {}
+func (ib *iwantBudget) RecvRPC(rpc *RPC)                     {}
+func (ib *iwantBudget) SendRPC(rpc *RPC, p peer.ID)          {}
+func (ib *iwantBudget) DropRPC(rpc *RPC, p peer.ID)          {}
+func (ib *iwantBudget) UndeliverableMessage(msg *Message)    {}
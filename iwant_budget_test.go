@@ -0,0 +1,114 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestIWantBudget(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// room for two messages of the default size
+	budget := 2*GossipSubIWantDefaultMessageSize + GossipSubIWantDefaultMessageSize/2
+	clk := newMockClock()
+	a, b := peer.ID("a"), peer.ID("b")
+	ps, gs, eval := graftAuthTestRouter(t, ctx, []peer.ID{a, b}, WithClock(clk), WithIWantBudget(budget))
+
+	msgs := make([]*Message, 5)
+	mids := make([]string, len(msgs))
+	for i := range msgs {
+		msgs[i] = &Message{
+			Message: &pb.Message{
+				From:  []byte(a),
+				Seqno: []byte(fmt.Sprintf("%d", i)),
+				Data:  make([]byte, 100),
+				Topic: stringPtr("test"),
+			},
+			ReceivedFrom: a,
+		}
+		mids[i] = ps.idGen.ID(msgs[i])
+	}
+	ihave := func(mids ...string) *pb.ControlMessage {
+		return &pb.ControlMessage{Ihave: []*pb.ControlIHave{{TopicID: stringPtr("test"), MessageIDs: mids}}}
+	}
+	requested := func(iwant []*pb.ControlIWant) int {
+		if len(iwant) == 0 {
+			return 0
+		}
+		return len(iwant[0].GetMessageIDs())
+	}
+
+	var n int
+	eval(func() { n = requested(gs.handleIHave(a, ihave(mids...))) })
+	if n != 2 {
+		t.Fatalf("expected 2 messages requested within the budget, got %d", n)
+	}
+	stats := ps.Stats().IWants
+	if stats.Outstanding != 2 || stats.Bytes != 2*GossipSubIWantDefaultMessageSize || stats.Deferred != 3 {
+		t.Fatalf("expected 2 outstanding requests and 3 deferred, got %+v", stats)
+	}
+
+	// the budget is exhausted until a response arrives
+	eval(func() { n = requested(gs.handleIHave(b, ihave(mids...))) })
+	if n != 0 {
+		t.Fatalf("expected no request with the budget exhausted, got %d", n)
+	}
+	stats = ps.Stats(WithStatsReset()).IWants
+	if stats.Outstanding != 2 || stats.Deferred != 8 {
+		t.Fatalf("expected 2 outstanding requests and 8 deferred, got %+v", stats)
+	}
+
+	var arrived *Message
+	var rest []string
+	gs.iwantBudget.Lock()
+	for i, msg := range msgs {
+		if _, ok := gs.iwantBudget.pending[mids[i]]; ok && arrived == nil {
+			arrived = msg
+		} else {
+			rest = append(rest, mids[i])
+		}
+	}
+	gs.iwantBudget.Unlock()
+	ps.tracer.ValidateMessage(arrived)
+	stats = ps.Stats().IWants
+	if stats.Outstanding != 1 || stats.Deferred != 0 {
+		t.Fatalf("expected 1 outstanding request after the response, got %+v", stats)
+	}
+
+	// the messages of the topic are now estimated with the size of the received one, so the
+	// rest of the budget fits the remaining messages
+	eval(func() { n = requested(gs.handleIHave(b, ihave(rest...))) })
+	if n != 4 {
+		t.Fatalf("expected the 4 messages not received requested, got %d", n)
+	}
+	stats = ps.Stats().IWants
+	if want := GossipSubIWantDefaultMessageSize + 4*arrived.Size(); stats.Outstanding != 5 || stats.Bytes != want {
+		t.Fatalf("expected 5 outstanding requests of %d bytes, got %+v", want, stats)
+	}
+
+	// the requests time out with the IWANT followup time
+	clk.Add(GossipSubIWantFollowupTime + 1)
+	eval(func() { gs.iwantBudget.expire() })
+	if stats = ps.Stats().IWants; stats.Outstanding != 0 || stats.Bytes != 0 {
+		t.Fatalf("expected no outstanding request after the followup time, got %+v", stats)
+	}
+}
+
+func TestIWantBudgetValidation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	if _, err := NewGossipSub(ctx, hosts[0], WithIWantBudget(0)); err == nil {
+		t.Fatal("expected an error for an empty budget")
+	}
+	if _, err := NewFloodSub(ctx, hosts[0], WithIWantBudget(1024)); err == nil {
+		t.Fatal("expected an error for floodsub")
+	}
+}
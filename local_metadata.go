@@ -0,0 +1,165 @@
+package pubsub
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// WithLocalMetadata annotates the messages delivered to the local subscribers with their
+// LocalMetadata: whether they were recovered with an IWANT request, how many duplicates of them
+// we received, and how long their validation took. The bookkeeping is off by default.
+func WithLocalMetadata() Option {
+	return func(p *PubSub) error {
+		p.localMeta = &localMetadataTracker{meta: make(map[string]*LocalMetadata)}
+		return nil
+	}
+}
+
+// LocalMetadata is how a message arrived at the local node, as observed by the router and the
+// validation pipeline. It is never sent to the network.
+type LocalMetadata struct {
+	recovered  bool
+	validation time.Duration
+	duplicates atomic.Int64
+}
+
+// Recovered returns whether the message was received in response to an IWANT request for it,
+// rather than eagerly pushed by a mesh or fanout peer.
+func (m *LocalMetadata) Recovered() bool {
+	return m.recovered
+}
+
+// Duplicates returns the number of duplicates of the message received so far, including those
+// received while it was validated; it keeps counting after the delivery of the message, for the
+// TTL of the seen messages cache.
+func (m *LocalMetadata) Duplicates() int {
+	return int(m.duplicates.Load())
+}
+
+// ValidationLatency returns the time from the arrival of the message in the validation pipeline
+// to its acceptance, queueing included.
+func (m *LocalMetadata) ValidationLatency() time.Duration {
+	return m.validation
+}
+
+// LocalMetadata returns the local metadata of a delivered message, or nil unless the PubSub was
+// created with WithLocalMetadata.
+func (m *Message) LocalMetadata() *LocalMetadata {
+	return m.meta
+}
+
+// recoveryRouter is implemented by routers that request messages from their peers
+type recoveryRouter interface {
+	// recovered returns whether a message arriving from a peer was requested from it
+	recovered(p peer.ID, mid string) bool
+}
+
+// localMetadataTracker keeps the metadata of the messages for the TTL of the seen messages
+// cache, to count their duplicates. The duplicates arriving while the first copy of a message
+// is still being validated are counted ahead of its delivery, as they may be detected by the
+// validation workers.
+type localMetadataTracker struct {
+	mx     sync.Mutex
+	meta   map[string]*LocalMetadata
+	expiry []localMetadataExpiry
+}
+
+type localMetadataExpiry struct {
+	id     string
+	expire time.Time
+}
+
+// annotateMessage attaches the local metadata to a message about to be delivered
+func (p *PubSub) annotateMessage(msg *Message) {
+	lm := p.localMeta
+	if lm == nil {
+		return
+	}
+
+	meta := lm.get(msg.ID, p.clock.Now(), p.seenMsgTTL)
+	if !msg.arrival.IsZero() {
+		meta.validation = p.clock.Now().Sub(msg.arrival)
+	}
+	if rr, ok := p.rt.(recoveryRouter); ok && msg.ReceivedFrom != p.host.ID() {
+		meta.recovered = rr.recovered(msg.ReceivedFrom, msg.ID)
+	}
+	msg.meta = meta
+}
+
+// duplicate counts the arrival of a duplicate of a message
+func (p *PubSub) duplicate(id string) {
+	lm := p.localMeta
+	if lm == nil {
+		return
+	}
+	lm.get(id, p.clock.Now(), p.seenMsgTTL).duplicates.Add(1)
+}
+
+// get returns the metadata of a message, tracking it for a TTL if it is new
+func (lm *localMetadataTracker) get(id string, now time.Time, ttl time.Duration) *LocalMetadata {
+	lm.mx.Lock()
+	defer lm.mx.Unlock()
+
+	lm.expire(now)
+	meta, ok := lm.meta[id]
+	if !ok {
+		meta = new(LocalMetadata)
+		lm.meta[id] = meta
+		lm.expiry = append(lm.expiry, localMetadataExpiry{id: id, expire: now.Add(ttl)})
+	}
+	return meta
+}
+
+// expire forgets the metadata of the messages tracked more than a TTL ago
+func (lm *localMetadataTracker) expire(now time.Time) {
+	i := 0
+	for ; i < len(lm.expiry) && !now.Before(lm.expiry[i].expire); i++ {
+		delete(lm.meta, lm.expiry[i].id)
+	}
+	if i > 0 {
+		lm.expiry = append(lm.expiry[:0], lm.expiry[i:]...)
+	}
+}
+
+// iwantSent is a message requested from a peer with IWANT
+type iwantSent struct {
+	peer peer.ID
+	mid  string
+}
+
+// trackIWants remembers the messages requested from a peer, to flag them as recovered when they
+// arrive
+func (gs *GossipSubRouter) trackIWants(p peer.ID, mids []string) {
+	if gs.p.localMeta == nil {
+		return
+	}
+	if gs.iwantsSent == nil {
+		gs.iwantsSent = make(map[iwantSent]time.Time)
+	}
+	expire := gs.p.clock.Now().Add(gs.params.IWantFollowupTime)
+	for _, mid := range mids {
+		gs.iwantsSent[iwantSent{peer: p, mid: mid}] = expire
+	}
+}
+
+// expireIWants forgets the IWANT requests not answered within the follow up time
+func (gs *GossipSubRouter) expireIWants() {
+	now := gs.p.clock.Now()
+	for req, expire := range gs.iwantsSent {
+		if now.After(expire) {
+			delete(gs.iwantsSent, req)
+		}
+	}
+}
+
+func (gs *GossipSubRouter) recovered(p peer.ID, mid string) bool {
+	req := iwantSent{peer: p, mid: mid}
+	if _, ok := gs.iwantsSent[req]; !ok {
+		return false
+	}
+	delete(gs.iwantsSent, req)
+	return true
+}
@@ -0,0 +1,157 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+func TestLocalMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	gossiper, pusher := peer.ID("gossiper"), peer.ID("pusher")
+	ps, gs, eval := chokeTestRouter(t, ctx, DefaultGossipSubParams(), map[peer.ID]protocol.ID{
+		gossiper: GossipSubID_v11,
+		pusher:   GossipSubID_v11,
+	})
+	eval(func() {
+		if err := WithLocalMetadata()(ps); err != nil {
+			t.Error(err)
+		}
+	})
+	topic, err := ps.Join("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := topic.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	author, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newMsg := func(data string) *pb.Message {
+		topic := "test"
+		m := &pb.Message{Data: []byte(data), Topic: &topic, From: []byte(author), Seqno: []byte(data)}
+		if err := signMessage(author, key, m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	next := func() *Message {
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.LocalMetadata() == nil {
+			t.Fatalf("expected local metadata for message %q", msg.Data)
+		}
+		return msg
+	}
+
+	// the gossiped message is requested with IWANT, the other one pushed
+	gossiped, pushed := newMsg("gossiped"), newMsg("pushed")
+	eval(func() {
+		mid := ps.idGen.RawID(gossiped)
+		iwant := gs.handleIHave(gossiper, &pb.ControlMessage{Ihave: []*pb.ControlIHave{{TopicID: stringPtr("test"), MessageIDs: []string{mid}}}})
+		if len(iwant) != 1 {
+			t.Errorf("expected an IWANT for the gossiped message, got %v", iwant)
+		}
+		ps.pushMsg(&Message{Message: pushed, ReceivedFrom: gossiper})
+	})
+	if msg := next(); msg.LocalMetadata().Recovered() {
+		t.Fatal("expected the pushed message not to be flagged as recovered")
+	}
+	eval(func() {
+		ps.pushMsg(&Message{Message: gossiped, ReceivedFrom: gossiper})
+	})
+	msg := next()
+	meta := msg.LocalMetadata()
+	if !meta.Recovered() {
+		t.Fatal("expected the requested message to be flagged as recovered")
+	}
+	if meta.ValidationLatency() <= 0 {
+		t.Fatalf("expected the validation latency of the message, got %s", meta.ValidationLatency())
+	}
+
+	// the duplicates are counted after the delivery
+	for i := 0; i < 2; i++ {
+		eval(func() {
+			ps.pushMsg(&Message{Message: copyPbMessage(gossiped), ReceivedFrom: pusher})
+		})
+	}
+	if meta.Duplicates() != 2 {
+		t.Fatalf("expected 2 duplicates, got %d", meta.Duplicates())
+	}
+
+	// the duplicates arriving while the message is validated are counted as well
+	racing := newMsg("racing")
+	eval(func() {
+		ps.pushMsg(&Message{Message: racing, ReceivedFrom: pusher})
+		ps.pushMsg(&Message{Message: copyPbMessage(racing), ReceivedFrom: pusher})
+	})
+	if msg := next(); msg.LocalMetadata().Duplicates() != 1 {
+		t.Fatalf("expected 1 duplicate of a message received twice at once, got %d", msg.LocalMetadata().Duplicates())
+	}
+
+	// the messages requested with RequestMessage are recovered
+	requested := newMsg("requested")
+	eval(func() {
+		if err := gs.requestMessage("test", ps.idGen.RawID(requested), make(chan *Message, 1)); err != nil {
+			t.Error(err)
+		}
+		ps.pushMsg(&Message{Message: requested, ReceivedFrom: pusher})
+	})
+	if msg := next(); !msg.LocalMetadata().Recovered() {
+		t.Fatal("expected the message requested with RequestMessage to be flagged as recovered")
+	}
+
+	// the local messages are annotated too
+	if err := topic.Publish(ctx, []byte("local")); err != nil {
+		t.Fatal(err)
+	}
+	if msg := next(); msg.LocalMetadata().Recovered() || msg.LocalMetadata().Duplicates() != 0 {
+		t.Fatalf("expected a local message not recovered without duplicates, got %+v", msg.LocalMetadata())
+	}
+}
+
+func TestLocalMetadataDisabled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getGossipsubs(ctx, hosts)
+	connect(t, hosts[0], hosts[1])
+
+	sub := mustSubscribe(t, psubs[1], "test")
+	mustSubscribe(t, psubs[0], "test")
+	time.Sleep(time.Second)
+
+	if err := psubs[0].Publish("test", []byte("message")); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	msg, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.LocalMetadata() != nil {
+		t.Fatalf("expected no local metadata without WithLocalMetadata, got %+v", msg.LocalMetadata())
+	}
+}
@@ -2,6 +2,7 @@ package pubsub
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"github.com/libp2p/go-libp2p/core/peer"
 )
@@ -35,18 +36,43 @@ func NewMessageCache(gossip, history int) *MessageCache {
 	}
 }
 
+// newMessageCache creates the message cache of a gossipsub router
+func newMessageCache(params GossipSubParams) *MessageCache {
+	mc := NewMessageCache(params.HistoryGossip, params.HistoryLength)
+	mc.SetMaxBytes(params.MessageCacheMaxBytes)
+	return mc
+}
+
 type MessageCache struct {
 	msgs    map[string]*Message
 	peertx  map[string]map[peer.ID]int
 	history [][]CacheEntry
 	gossip  int
 	msgID   func(*Message) string
+
+	// total size of the cached messages, and its bound; 0 is unbounded
+	bytes, maxBytes int
+	// number of messages evicted before leaving the history window
+	evictions atomic.Uint64
 }
 
 func (mc *MessageCache) SetMsgIdFn(msgID func(*Message) string) {
 	mc.msgID = msgID
 }
 
+// SetMaxBytes bounds the total size of the cached messages; the oldest messages are
+// evicted early when the bound is exceeded. A value of 0 disables the bound.
+func (mc *MessageCache) SetMaxBytes(maxBytes int) {
+	mc.maxBytes = maxBytes
+	mc.evictOverBudget()
+}
+
+// Evictions returns the number of messages evicted early to stay within the size bound.
+// It is safe for concurrent use.
+func (mc *MessageCache) Evictions() uint64 {
+	return mc.evictions.Load()
+}
+
 type CacheEntry struct {
 	mid   string
 	topic string
@@ -54,8 +80,48 @@ type CacheEntry struct {
 
 func (mc *MessageCache) Put(msg *Message) {
 	mid := mc.msgID(msg)
+	if old, ok := mc.msgs[mid]; ok {
+		mc.bytes -= old.Size()
+	}
 	mc.msgs[mid] = msg
+	mc.bytes += msg.Size()
 	mc.history[0] = append(mc.history[0], CacheEntry{mid: mid, topic: msg.GetTopic()})
+	mc.evictOverBudget()
+}
+
+// evictOverBudget evicts the oldest messages until the cache is within its size bound, always
+// keeping the newest message. The entries are removed from the history too, so that evicted
+// messages are no longer advertised.
+func (mc *MessageCache) evictOverBudget() {
+	if mc.maxBytes <= 0 {
+		return
+	}
+
+	for i := len(mc.history) - 1; i >= 0 && mc.bytes > mc.maxBytes && len(mc.msgs) > 1; {
+		if len(mc.history[i]) == 0 {
+			i--
+			continue
+		}
+
+		entry := mc.history[i][0]
+		mc.history[i] = mc.history[i][1:]
+		if mc.remove(entry.mid) {
+			mc.evictions.Add(1)
+		}
+	}
+}
+
+// remove removes a message, returning whether it was cached
+func (mc *MessageCache) remove(mid string) bool {
+	msg, ok := mc.msgs[mid]
+	if !ok {
+		return false
+	}
+
+	mc.bytes -= msg.Size()
+	delete(mc.msgs, mid)
+	delete(mc.peertx, mid)
+	return true
 }
 
 func (mc *MessageCache) Get(mid string) (*Message, bool) {
@@ -83,7 +149,11 @@ func (mc *MessageCache) GetGossipIDs(topic string) []string {
 	var mids []string
 	for _, entries := range mc.history[:mc.gossip] {
 		for _, entry := range entries {
-			if entry.topic == topic {
+			if entry.topic != topic {
+				continue
+			}
+			// skip the messages evicted through a later entry with the same id
+			if _, ok := mc.msgs[entry.mid]; ok {
 				mids = append(mids, entry.mid)
 			}
 		}
@@ -94,8 +164,7 @@ func (mc *MessageCache) GetGossipIDs(topic string) []string {
 func (mc *MessageCache) Shift() {
 	last := mc.history[len(mc.history)-1]
 	for _, entry := range last {
-		delete(mc.msgs, entry.mid)
-		delete(mc.peertx, entry.mid)
+		mc.remove(entry.mid)
 	}
 	for i := len(mc.history) - 2; i >= 0; i-- {
 		mc.history[i+1] = mc.history[i]
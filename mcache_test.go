@@ -165,3 +165,64 @@ func makeTestMessage(n int) *pb.Message {
 		Seqno: seqno,
 	}
 }
+
+func TestMessageCacheMaxBytes(t *testing.T) {
+	msgs := make([]*pb.Message, 10)
+	for i := range msgs {
+		msgs[i] = makeTestMessage(i)
+	}
+	size := msgs[0].Size()
+
+	mcache := NewMessageCache(3, 5)
+	mcache.SetMaxBytes(4 * size)
+	msgID := DefaultMsgIdFn
+
+	for i := 0; i < 3; i++ {
+		mcache.Put(&Message{Message: msgs[i]})
+	}
+	mcache.Shift()
+	for i := 3; i < 6; i++ {
+		mcache.Put(&Message{Message: msgs[i]})
+	}
+
+	// the two oldest messages are evicted to stay within the budget
+	if evictions := mcache.Evictions(); evictions != 2 {
+		t.Fatalf("expected 2 evictions; got %d", evictions)
+	}
+	for i := 0; i < 6; i++ {
+		_, ok := mcache.Get(msgID(msgs[i]))
+		if ok != (i >= 2) {
+			t.Fatalf("unexpected presence of message %d: %t", i, ok)
+		}
+	}
+
+	// the evicted messages are no longer advertised
+	gids := mcache.GetGossipIDs("test")
+	if len(gids) != 4 {
+		t.Fatalf("expected 4 gossip IDs; got %d", len(gids))
+	}
+	for _, mid := range gids {
+		if mid == msgID(msgs[0]) || mid == msgID(msgs[1]) {
+			t.Fatal("evicted message advertised")
+		}
+	}
+
+	// shifting out the remaining old entries keeps the accounting consistent
+	for i := 0; i < 5; i++ {
+		mcache.Shift()
+	}
+	if mcache.bytes != 0 || len(mcache.msgs) != 0 {
+		t.Fatalf("expected an empty cache; got %d bytes in %d messages", mcache.bytes, len(mcache.msgs))
+	}
+
+	// the newest message is kept even if it exceeds the budget
+	mcache.SetMaxBytes(size / 2)
+	mcache.Put(&Message{Message: msgs[6]})
+	if _, ok := mcache.Get(msgID(msgs[6])); !ok {
+		t.Fatal("expected the newest message to be kept")
+	}
+	mcache.Put(&Message{Message: msgs[7]})
+	if _, ok := mcache.Get(msgID(msgs[6])); ok {
+		t.Fatal("expected the older message to be evicted")
+	}
+}
@@ -9,44 +9,76 @@ import (
 // msgIDGenerator handles computing IDs for msgs
 // It allows setting custom generators(MsgIdFunction) per topic
 type msgIDGenerator struct {
-	Default MsgIdFunction
+	def *msgIDFn
 
 	topicGensLk sync.RWMutex
-	topicGens   map[string]MsgIdFunction
+	topicGens   map[string]*msgIDFn
+}
+
+// msgIDFn wraps a MsgIdFunction, so that the ID cached on a message is tied to the function that
+// computed it: a message ID function set for its topic later on invalidates it.
+type msgIDFn struct {
+	fn MsgIdFunction
 }
 
 func newMsgIdGenerator() *msgIDGenerator {
 	return &msgIDGenerator{
-		Default:   DefaultMsgIdFn,
-		topicGens: make(map[string]MsgIdFunction),
+		def:       &msgIDFn{fn: DefaultMsgIdFn},
+		topicGens: make(map[string]*msgIDFn),
 	}
 }
 
+// SetDefault sets the id generator(MsgIdFunction) for topics without a custom one.
+func (m *msgIDGenerator) SetDefault(gen MsgIdFunction) {
+	m.topicGensLk.Lock()
+	m.def = &msgIDFn{fn: gen}
+	m.topicGensLk.Unlock()
+}
+
 // Set sets custom id generator(MsgIdFunction) for topic.
 func (m *msgIDGenerator) Set(topic string, gen MsgIdFunction) {
 	m.topicGensLk.Lock()
-	m.topicGens[topic] = gen
+	m.topicGens[topic] = &msgIDFn{fn: gen}
 	m.topicGensLk.Unlock()
 }
 
-// ID computes ID for the msg or short-circuits with the cached value.
+// ID computes ID for the msg, on its wire format, or short-circuits with the value cached by the
+// ID function of its topic. An ID set on the msg by other means is kept as is.
 func (m *msgIDGenerator) ID(msg *Message) string {
-	if msg.ID != "" {
+	gen := m.gen(msg.GetTopic())
+	if msg.ID != "" && (msg.idFn == gen || msg.idFn == nil) {
 		return msg.ID
 	}
 
-	msg.ID = m.RawID(msg.Message)
+	msg.ID = gen.fn(msg.wireMessage())
+	msg.idFn = gen
 	return msg.ID
 }
 
 // RawID computes ID for the proto 'msg'.
 func (m *msgIDGenerator) RawID(msg *pb.Message) string {
+	return m.gen(msg.GetTopic()).fn(msg)
+}
+
+// RPCMessageID returns the ID of the ith payload message of an RPC, short-circuiting with the
+// value cached on the msg it was received or published as, if any.
+func (m *msgIDGenerator) RPCMessageID(rpc *RPC, i int) string {
+	pmsg := rpc.Publish[i]
+	if i < len(rpc.checks) && rpc.checks[i].msg.wireMessage() == pmsg {
+		return m.ID(rpc.checks[i].msg)
+	}
+	if i < len(rpc.origins) && rpc.origins[i].wireMessage() == pmsg {
+		return m.ID(rpc.origins[i])
+	}
+	return m.RawID(pmsg)
+}
+
+func (m *msgIDGenerator) gen(topic string) *msgIDFn {
 	m.topicGensLk.RLock()
-	gen, ok := m.topicGens[msg.GetTopic()]
-	m.topicGensLk.RUnlock()
+	gen, ok := m.topicGens[topic]
 	if !ok {
-		gen = m.Default
+		gen = m.def
 	}
-
-	return gen(msg)
+	m.topicGensLk.RUnlock()
+	return gen
 }
@@ -0,0 +1,106 @@
+package pubsub
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestMsgIDCache(t *testing.T) {
+	calls := 0
+	counting := func(prefix string) MsgIdFunction {
+		return func(pmsg *pb.Message) string {
+			calls++
+			return prefix + string(pmsg.GetData())
+		}
+	}
+
+	topic := "test"
+	gen := newMsgIdGenerator()
+	gen.SetDefault(counting("default-"))
+	msg := &Message{Message: &pb.Message{Data: []byte("data"), Topic: &topic}}
+
+	for i := 0; i < 3; i++ {
+		if id := gen.ID(msg); id != "default-data" {
+			t.Fatalf("unexpected ID %q", id)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected the ID to be computed once, got %d calls", calls)
+	}
+
+	// the payload messages of an RPC forwarded from the message reuse its ID
+	rpc := &RPC{RPC: pb.RPC{Publish: []*pb.Message{msg.Message, {Data: []byte("other"), Topic: &topic}}}}
+	rpc.origins = []*Message{msg, msg}
+	if id := gen.RPCMessageID(rpc, 0); id != "default-data" || calls != 1 {
+		t.Fatalf("expected the cached ID, got %q after %d calls", id, calls)
+	}
+	if id := gen.RPCMessageID(rpc, 1); id != "default-other" || calls != 2 {
+		t.Fatalf("expected the ID to be computed, got %q after %d calls", id, calls)
+	}
+
+	// a message ID function set for the topic invalidates the cached ID
+	gen.Set(topic, counting("topic-"))
+	if id := gen.ID(msg); id != "topic-data" || calls != 3 {
+		t.Fatalf("expected the ID to be recomputed, got %q after %d calls", id, calls)
+	}
+	if id := gen.ID(msg); id != "topic-data" || calls != 3 {
+		t.Fatalf("expected the cached ID, got %q after %d calls", id, calls)
+	}
+
+	// an ID set by other means is kept
+	msg = &Message{Message: &pb.Message{Data: []byte("data"), Topic: &topic}, ID: "preset"}
+	if id := gen.ID(msg); id != "preset" || calls != 3 {
+		t.Fatalf("expected the preset ID, got %q after %d calls", id, calls)
+	}
+}
+
+// BenchmarkMsgID measures the ID computations of a message forwarded to a mesh of D=8 peers
+// with a SHA256 message ID function: the seen check, message cache, score and gossip tracers,
+// and the tracing of each sent RPC, recomputing the ID at every call site or using the ID
+// cached on the message.
+func BenchmarkMsgID(b *testing.B) {
+	const D = 8
+
+	topic := "test"
+	gen := newMsgIdGenerator()
+	gen.SetDefault(func(pmsg *pb.Message) string {
+		h := sha256.Sum256(pmsg.GetData())
+		return string(h[:])
+	})
+
+	for _, size := range []int{256, 4096} {
+		data := bytes.Repeat([]byte{'x'}, size)
+
+		b.Run(fmt.Sprintf("Uncached%dB", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				pmsg := &pb.Message{Data: data, Topic: &topic}
+				for j := 0; j < 4; j++ {
+					gen.RawID(pmsg)
+				}
+				for j := 0; j < D; j++ {
+					gen.RawID(pmsg)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("Cached%dB", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				msg := &Message{Message: &pb.Message{Data: data, Topic: &topic}}
+				for j := 0; j < 4; j++ {
+					gen.ID(msg)
+				}
+				out := rpcWithMessages(msg.Message)
+				out.origins = []*Message{msg}
+				for j := 0; j < D; j++ {
+					gen.RPCMessageID(out, 0)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WithTopicValidationDeadline bounds the validation of the messages of a Topic to d from their
+// arrival in the validation pipeline, queueing included. The context of the validators expires
+// at the deadline, and messages whose validators return past it are ignored without penalty,
+// with inline and asynchronous validators alike.
+func WithTopicValidationDeadline(d time.Duration) TopicOpt {
+	return func(t *Topic) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid validation deadline: %s", d)
+		}
+		t.validationDeadline = d
+		return nil
+	}
+}
+
+// WithValidationContext makes the values of ctx, such as a trace span, visible to the validators
+// of a locally published message. Its cancellation and deadline do not apply to them.
+func WithValidationContext(ctx context.Context) PubOpt {
+	return func(pub *PublishOptions) error {
+		if ctx == nil {
+			return fmt.Errorf("nil validation context")
+		}
+		pub.values = ctx
+		return nil
+	}
+}
+
+type arrivalKey struct{}
+
+// MessageArrival returns the arrival time of a message in the validation pipeline, from the
+// context passed to its validators.
+func MessageArrival(ctx context.Context) (time.Time, bool) {
+	arrival, ok := ctx.Value(arrivalKey{}).(time.Time)
+	return arrival, ok
+}
+
+// valuesContext is a context looking values up in values before its parent, which it otherwise
+// behaves as
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c valuesContext) Value(key any) any {
+	if v := c.values.Value(key); v != nil {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+// messageContext returns the context of the validators of a message, carrying its arrival time
+// and the values of its publisher, with the validation deadline of its topic if any. The values
+// are released from the message, which outlives its validation in the caches.
+func (v *validation) messageContext(msg *Message) (context.Context, context.CancelFunc) {
+	var ctx context.Context = v.p.ctx
+	if msg.values != nil {
+		ctx = valuesContext{Context: ctx, values: msg.values}
+		msg.values = nil
+	}
+	ctx = context.WithValue(ctx, arrivalKey{}, msg.arrival)
+
+	// the arrival is on the clock of the router, the context deadline on the wall clock
+	if d := v.p.topicValidationDeadline(msg.GetTopic()); d > 0 {
+		return context.WithTimeout(ctx, msg.arrival.Add(d).Sub(v.p.clock.Now()))
+	}
+	return ctx, func() {}
+}
+
+// pastDeadline returns whether the validation deadline of a message has passed
+func pastDeadline(ctx context.Context) bool {
+	return ctx.Err() == context.DeadlineExceeded
+}
+
+func (p *PubSub) setTopicValidationDeadline(topic string, d time.Duration) {
+	p.topicOptsMx.Lock()
+	defer p.topicOptsMx.Unlock()
+
+	if d == 0 {
+		delete(p.validationDeadlines, topic)
+		return
+	}
+	p.validationDeadlines[topic] = d
+}
+
+func (p *PubSub) topicValidationDeadline(topic string) time.Duration {
+	p.topicOptsMx.RLock()
+	defer p.topicOptsMx.RUnlock()
+
+	return p.validationDeadlines[topic]
+}
@@ -0,0 +1,128 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+type rejectionTracer struct {
+	noopRawTracer
+	mx      sync.Mutex
+	reasons map[string]int
+}
+
+func (t *rejectionTracer) RejectMessage(msg *Message, reason string) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	if t.reasons == nil {
+		t.reasons = make(map[string]int)
+	}
+	t.reasons[reason]++
+}
+
+func (t *rejectionTracer) count(reason string) int {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return t.reasons[reason]
+}
+
+func TestValidationContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0])
+	topic, err := ps.Join("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type spanKey struct{}
+	seen := make(chan interface{}, 1)
+	err = ps.RegisterTopicValidator("test", func(ctx context.Context, _ peer.ID, msg *Message) bool {
+		if _, ok := MessageArrival(ctx); !ok || ctx.Err() != nil {
+			t.Errorf("expected a live context with the arrival time")
+		}
+		seen <- ctx.Value(spanKey{})
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the values are seen but not the cancellation
+	pctx, pcancel := context.WithCancel(context.WithValue(ctx, spanKey{}, "span"))
+	pcancel()
+	if err := topic.Publish(ctx, []byte("message"), WithValidationContext(pctx)); err != nil {
+		t.Fatal(err)
+	}
+	if v := <-seen; v != "span" {
+		t.Fatalf("expected the validator to see the span, got %v", v)
+	}
+
+	if err := topic.Publish(ctx, []byte("message")); err != nil {
+		t.Fatal(err)
+	}
+	if v := <-seen; v != nil {
+		t.Fatalf("expected no span without a validation context, got %v", v)
+	}
+}
+
+func TestValidationDeadline(t *testing.T) {
+	for _, inline := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tracer := &rejectionTracer{}
+		hosts := getNetHosts(t, ctx, 2)
+		sender := getPubsub(ctx, hosts[0])
+		// with a worker for each message, as the deadline includes the queueing
+		receiver := getPubsub(ctx, hosts[1], WithRawTracer(tracer), WithValidateWorkers(2))
+
+		topic, err := receiver.Join("test", WithTopicValidationDeadline(50*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = receiver.RegisterTopicValidator("test", func(ctx context.Context, _ peer.ID, msg *Message) bool {
+			arrival, _ := MessageArrival(ctx)
+			// the deadline is set on the wall clock, from the arrival on the clock of the router
+			if deadline, ok := ctx.Deadline(); !ok || deadline.Sub(arrival.Add(50*time.Millisecond)).Abs() > time.Millisecond {
+				t.Errorf("expected the deadline to follow the arrival, got %s", deadline)
+			}
+			if string(msg.Data) == "slow" {
+				// a validator ignoring its context
+				time.Sleep(100 * time.Millisecond)
+			}
+			return true
+		}, WithValidatorInline(inline))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub, err := topic.Subscribe()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		connect(t, hosts[0], hosts[1])
+		time.Sleep(100 * time.Millisecond)
+
+		for _, data := range []string{"slow", "fast"} {
+			if err := sender.Publish("test", []byte(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// the slow message is ignored past its deadline
+		assertReceive(t, sub, []byte("fast"))
+		for deadline := time.Now().Add(time.Second); tracer.count(RejectValidationDeadline) != 1; {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the slow message to miss its deadline with inline %v", inline)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package pubsub
+
+import (
+	"github.com/multiformats/go-varint"
+)
+
+// msgTopicTag is the protobuf key of the topic of a payload message: field 4, length delimited
+const msgTopicTag = 4<<3 | 2
+
+// multipleTopics returns whether the wire bytes of a payload message list more than one topic.
+//
+// The topic of a message was a repeated field in earlier versions of the protocol, and peers
+// still running them may publish a message to several topics at once. Such a message decodes
+// with the last of its topics only, yet it is forwarded with its wire bytes listing all of them,
+// so peers decoding the repeated field would deliver it to topics it was never validated for; it
+// is ignored with RejectMultipleTopics instead, without penalizing the peers forwarding it, as
+// they may be running those versions too.
+func multipleTopics(raw []byte) bool {
+	topics := 0
+	for len(raw) > 0 {
+		key, n, err := varint.FromUvarint(raw)
+		if err != nil {
+			return false
+		}
+		raw = raw[n:]
+
+		var size uint64
+		switch key & 7 {
+		case 0:
+			_, n, err = varint.FromUvarint(raw)
+			if err != nil {
+				return false
+			}
+		case 1:
+			n = 8
+		case 2:
+			size, n, err = varint.FromUvarint(raw)
+			if err != nil {
+				return false
+			}
+		case 5:
+			n = 4
+		default:
+			return false
+		}
+		if uint64(len(raw)) < uint64(n)+size {
+			return false
+		}
+		if key == msgTopicTag {
+			topics++
+			if topics > 1 {
+				return true
+			}
+		}
+		raw = raw[n+int(size):]
+	}
+	return false
+}
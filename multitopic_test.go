@@ -0,0 +1,130 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-varint"
+)
+
+func TestMultipleTopics(t *testing.T) {
+	topic := "b"
+	m := &pb.Message{Data: []byte("data"), Topic: &topic}
+	raw, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if multipleTopics(raw) {
+		t.Fatal("expected a single topic")
+	}
+	if !multipleTopics(append([]byte{msgTopicTag, 1, 'a'}, raw...)) {
+		t.Fatal("expected multiple topics")
+	}
+	if multipleTopics(append(raw, msgTopicTag, 5, 'a')) {
+		t.Fatal("expected a truncated topic not to be counted")
+	}
+}
+
+func TestRejectMultipleTopics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracer := &rejectionTracer{}
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0], WithRawTracer(tracer))
+	sub := mustSubscribe(t, ps, "b")
+
+	key, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	author, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newMsg := func(data string) []byte {
+		topic := "b"
+		m := &pb.Message{Data: []byte(data), Topic: &topic, From: []byte(author), Seqno: []byte(data)}
+		if err := signMessage(author, key, m); err != nil {
+			t.Fatal(err)
+		}
+		raw, err := m.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	// the second message also lists the topic a, which the signature over the decoded message
+	// doesn't cover
+	var data []byte
+	for _, raw := range [][]byte{newMsg("single"), append([]byte{msgTopicTag, 1, 'a'}, newMsg("multiple")...)} {
+		data = append(data, publishTag)
+		data = append(data, varint.ToUvarint(uint64(len(raw)))...)
+		data = append(data, raw...)
+	}
+
+	// the messages are checked whether their wire bytes are retained or not, as with inbound
+	// hooks
+	for i, keepRaw := range []bool{true, false} {
+		rpc := new(RPC)
+		if err := rpc.Unmarshal(data); err != nil {
+			t.Fatal(err)
+		}
+		rpc.scanPublish(data, keepRaw)
+		if (rpc.wire != nil) != keepRaw {
+			t.Fatalf("expected the wire bytes retained: %t", keepRaw)
+		}
+		rpc.from = author
+
+		done := make(chan struct{})
+		ps.eval <- func() {
+			ps.handleIncomingRPC(rpc)
+			close(done)
+		}
+		<-done
+
+		if i == 0 {
+			assertReceive(t, sub, []byte("single"))
+		}
+		assertNeverReceives(t, sub, 100*time.Millisecond)
+		if n := tracer.count(RejectMultipleTopics); n != i+1 {
+			t.Fatalf("expected the message with multiple topics to be rejected, got %d rejections", n)
+		}
+	}
+}
+
+func TestScoreMultipleTopics(t *testing.T) {
+	topic := "test"
+	params := &PeerScoreParams{
+		AppSpecificScore: func(peer.ID) float64 { return 0 },
+		Topics: map[string]*TopicScoreParams{
+			topic: {
+				TopicWeight:                    1,
+				TimeInMeshQuantum:              time.Second,
+				InvalidMessageDeliveriesWeight: -1,
+				InvalidMessageDeliveriesDecay:  1.0,
+			},
+		},
+	}
+
+	// the messages listing multiple topics are ignored, without penalty for the forwarder
+	pid := peer.ID("A")
+	ps := newPeerScore(params)
+	ps.AddPeer(pid, "myproto")
+	ps.Graft(pid, topic)
+	msg := makeTestMessage(0)
+	msg.Topic = &topic
+	ps.RejectMessage(&Message{ReceivedFrom: pid, Message: msg}, RejectMultipleTopics)
+
+	ps.refreshScores()
+	if score := ps.Score(pid); score != 0 {
+		t.Fatalf("expected no penalty, got score %f", score)
+	}
+}
@@ -22,18 +22,21 @@ func (p *PubSubNotif) Connected(n network.Network, c network.Conn) {
 		return
 	}
 
-	go func() {
-		p.newPeersPrioLk.RLock()
-		p.newPeersMx.Lock()
-		p.newPeersPend[c.RemotePeer()] = struct{}{}
-		p.newPeersMx.Unlock()
-		p.newPeersPrioLk.RUnlock()
-
-		select {
-		case p.newPeers <- struct{}{}:
-		default:
-		}
-	}()
+	go p.addPendingPeer(c.RemotePeer())
+}
+
+// addPendingPeer queues a connected peer for processing by the event loop
+func (p *PubSubNotif) addPendingPeer(pid peer.ID) {
+	p.newPeersPrioLk.RLock()
+	p.newPeersMx.Lock()
+	p.newPeersPend[pid] = struct{}{}
+	p.newPeersMx.Unlock()
+	p.newPeersPrioLk.RUnlock()
+
+	select {
+	case p.newPeers <- struct{}{}:
+	default:
+	}
 }
 
 func (p *PubSubNotif) Disconnected(n network.Network, c network.Conn) {
@@ -0,0 +1,149 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestPeerOrderingSequencing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := &PubSub{ctx: ctx, sendMsg: make(chan *Message, 16)}
+	o := newPeerOrdering(p)
+	p.ordering = o
+
+	topic := "test"
+	newMsg := func(from peer.ID, i int) *Message {
+		return &Message{Message: &pb.Message{Topic: &topic, Data: []byte(strconv.Itoa(i))}, ReceivedFrom: from}
+	}
+	var msgs []*Message
+	for i := 0; i < 5; i++ {
+		msg := newMsg("A", i)
+		o.arrived(msg)
+		msgs = append(msgs, msg)
+	}
+	other := newMsg("B", 0)
+	o.arrived(other)
+
+	expect := func(exp ...string) {
+		t.Helper()
+		for _, e := range exp {
+			select {
+			case msg := <-p.sendMsg:
+				if string(msg.Data) != e {
+					t.Fatalf("expected message %s, got %s", e, msg.Data)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("expected message %s", e)
+			}
+		}
+		select {
+		case msg := <-p.sendMsg:
+			t.Fatalf("unexpected message %s", msg.Data)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	// the other peers are not held up
+	p.ordered(msgs[2], true)
+	p.ordered(other, true)
+	expect("0")
+	// the accepted messages wait for the ones ahead, and the dropped ones don't hold them up
+	p.ordered(msgs[1], false)
+	expect()
+	p.ordered(msgs[0], true)
+	expect("0", "2")
+	p.ordered(msgs[4], true)
+	p.ordered(msgs[3], true)
+	expect("3", "4")
+
+	// the results are applied once
+	if p.ordered(msgs[3], false) {
+		t.Fatal("expected the message to be no longer sequenced")
+	}
+
+	o.mx.Lock()
+	defer o.mx.Unlock()
+	if len(o.streams) != 0 {
+		t.Fatalf("expected no stream left, got %d", len(o.streams))
+	}
+}
+
+func TestStrictPeerOrdering(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := []*PubSub{
+		getGossipsub(ctx, hosts[0]),
+		getGossipsub(ctx, hosts[1], WithStrictPeerOrdering()),
+	}
+	connect(t, hosts[0], hosts[1])
+
+	// the earlier messages take longer to validate
+	const count = 10
+	err := psubs[1].RegisterTopicValidator("test", func(_ context.Context, _ peer.ID, msg *Message) bool {
+		i, _ := strconv.Atoi(string(msg.Data))
+		time.Sleep(time.Duration(count-i) * 10 * time.Millisecond)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := mustSubscribe(t, psubs[1], "test")
+	topic, err := psubs[0].Join("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	for i := 0; i < count; i++ {
+		if err := topic.Publish(ctx, []byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < count; i++ {
+		assertReceive(t, sub, []byte(strconv.Itoa(i)))
+	}
+}
+
+// BenchmarkPeerOrdering measures the sequencing of the messages of a peer validated in reverse
+// order by batches, against applying them directly.
+func BenchmarkPeerOrdering(b *testing.B) {
+	for _, batch := range []int{1, 16} {
+		b.Run(fmt.Sprintf("batch=%d", batch), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			p := &PubSub{ctx: ctx, sendMsg: make(chan *Message, batch)}
+			p.ordering = newPeerOrdering(p)
+
+			topic := "test"
+			msgs := make([]*Message, batch)
+			for i := range msgs {
+				msgs[i] = &Message{Message: &pb.Message{Topic: &topic}, ReceivedFrom: "A"}
+			}
+
+			b.ResetTimer()
+			for n := 0; n < b.N; n += batch {
+				for _, msg := range msgs {
+					p.ordering.arrived(msg)
+				}
+				for i := len(msgs) - 1; i >= 0; i-- {
+					p.ordered(msgs[i], true)
+				}
+				for range msgs {
+					<-p.sendMsg
+				}
+			}
+		})
+	}
+}
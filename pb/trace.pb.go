@@ -38,6 +38,7 @@ const (
 	TraceEvent_LEAVE             TraceEvent_Type = 10
 	TraceEvent_GRAFT             TraceEvent_Type = 11
 	TraceEvent_PRUNE             TraceEvent_Type = 12
+	TraceEvent_THROTTLE_PEER     TraceEvent_Type = 13
 )
 
 var TraceEvent_Type_name = map[int32]string{
@@ -54,6 +55,7 @@ var TraceEvent_Type_name = map[int32]string{
 	10: "LEAVE",
 	11: "GRAFT",
 	12: "PRUNE",
+	13: "THROTTLE_PEER",
 }
 
 var TraceEvent_Type_value = map[string]int32{
@@ -70,6 +72,7 @@ var TraceEvent_Type_value = map[string]int32{
 	"LEAVE":             10,
 	"GRAFT":             11,
 	"PRUNE":             12,
+	"THROTTLE_PEER":     13,
 }
 
 func (x TraceEvent_Type) Enum() *TraceEvent_Type {
@@ -112,6 +115,7 @@ type TraceEvent struct {
 	Leave                *TraceEvent_Leave            `protobuf:"bytes,14,opt,name=leave" json:"leave,omitempty"`
 	Graft                *TraceEvent_Graft            `protobuf:"bytes,15,opt,name=graft" json:"graft,omitempty"`
 	Prune                *TraceEvent_Prune            `protobuf:"bytes,16,opt,name=prune" json:"prune,omitempty"`
+	ThrottlePeer         *TraceEvent_ThrottlePeer     `protobuf:"bytes,17,opt,name=throttlePeer" json:"throttlePeer,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}                     `json:"-"`
 	XXX_unrecognized     []byte                       `json:"-"`
 	XXX_sizecache        int32                        `json:"-"`
@@ -262,6 +266,13 @@ func (m *TraceEvent) GetPrune() *TraceEvent_Prune {
 	return nil
 }
 
+func (m *TraceEvent) GetThrottlePeer() *TraceEvent_ThrottlePeer {
+	if m != nil {
+		return m.ThrottlePeer
+	}
+	return nil
+}
+
 type TraceEvent_PublishMessage struct {
 	MessageID            []byte   `protobuf:"bytes,1,opt,name=messageID" json:"messageID,omitempty"`
 	Topic                *string  `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
@@ -729,6 +740,7 @@ func (m *TraceEvent_SendRPC) GetMeta() *TraceEvent_RPCMeta {
 type TraceEvent_DropRPC struct {
 	SendTo               []byte              `protobuf:"bytes,1,opt,name=sendTo" json:"sendTo,omitempty"`
 	Meta                 *TraceEvent_RPCMeta `protobuf:"bytes,2,opt,name=meta" json:"meta,omitempty"`
+	Topic                *string             `protobuf:"bytes,3,opt,name=topic" json:"topic,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
 	XXX_unrecognized     []byte              `json:"-"`
 	XXX_sizecache        int32               `json:"-"`
@@ -781,6 +793,13 @@ func (m *TraceEvent_DropRPC) GetMeta() *TraceEvent_RPCMeta {
 	return nil
 }
 
+func (m *TraceEvent_DropRPC) GetTopic() string {
+	if m != nil && m.Topic != nil {
+		return *m.Topic
+	}
+	return ""
+}
+
 type TraceEvent_Join struct {
 	Topic                *string  `protobuf:"bytes,1,opt,name=topic" json:"topic,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -985,6 +1004,61 @@ func (m *TraceEvent_Prune) GetTopic() string {
 	return ""
 }
 
+type TraceEvent_ThrottlePeer struct {
+	PeerID               []byte   `protobuf:"bytes,1,opt,name=peerID" json:"peerID,omitempty"`
+	Topic                *string  `protobuf:"bytes,2,opt,name=topic" json:"topic,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TraceEvent_ThrottlePeer) Reset()         { *m = TraceEvent_ThrottlePeer{} }
+func (m *TraceEvent_ThrottlePeer) String() string { return proto.CompactTextString(m) }
+func (*TraceEvent_ThrottlePeer) ProtoMessage()    {}
+func (*TraceEvent_ThrottlePeer) Descriptor() ([]byte, []int) {
+	return fileDescriptor_0571941a1d628a80, []int{0, 13}
+}
+func (m *TraceEvent_ThrottlePeer) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *TraceEvent_ThrottlePeer) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_TraceEvent_ThrottlePeer.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *TraceEvent_ThrottlePeer) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TraceEvent_ThrottlePeer.Merge(m, src)
+}
+func (m *TraceEvent_ThrottlePeer) XXX_Size() int {
+	return m.Size()
+}
+func (m *TraceEvent_ThrottlePeer) XXX_DiscardUnknown() {
+	xxx_messageInfo_TraceEvent_ThrottlePeer.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TraceEvent_ThrottlePeer proto.InternalMessageInfo
+
+func (m *TraceEvent_ThrottlePeer) GetPeerID() []byte {
+	if m != nil {
+		return m.PeerID
+	}
+	return nil
+}
+
+func (m *TraceEvent_ThrottlePeer) GetTopic() string {
+	if m != nil && m.Topic != nil {
+		return *m.Topic
+	}
+	return ""
+}
+
 type TraceEvent_RPCMeta struct {
 	Messages             []*TraceEvent_MessageMeta `protobuf:"bytes,1,rep,name=messages" json:"messages,omitempty"`
 	Subscription         []*TraceEvent_SubMeta     `protobuf:"bytes,2,rep,name=subscription" json:"subscription,omitempty"`
@@ -998,7 +1072,7 @@ func (m *TraceEvent_RPCMeta) Reset()         { *m = TraceEvent_RPCMeta{} }
 func (m *TraceEvent_RPCMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_RPCMeta) ProtoMessage()    {}
 func (*TraceEvent_RPCMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 13}
+	return fileDescriptor_0571941a1d628a80, []int{0, 14}
 }
 func (m *TraceEvent_RPCMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1060,7 +1134,7 @@ func (m *TraceEvent_MessageMeta) Reset()         { *m = TraceEvent_MessageMeta{}
 func (m *TraceEvent_MessageMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_MessageMeta) ProtoMessage()    {}
 func (*TraceEvent_MessageMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 14}
+	return fileDescriptor_0571941a1d628a80, []int{0, 15}
 }
 func (m *TraceEvent_MessageMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1115,7 +1189,7 @@ func (m *TraceEvent_SubMeta) Reset()         { *m = TraceEvent_SubMeta{} }
 func (m *TraceEvent_SubMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_SubMeta) ProtoMessage()    {}
 func (*TraceEvent_SubMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 15}
+	return fileDescriptor_0571941a1d628a80, []int{0, 16}
 }
 func (m *TraceEvent_SubMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1172,7 +1246,7 @@ func (m *TraceEvent_ControlMeta) Reset()         { *m = TraceEvent_ControlMeta{}
 func (m *TraceEvent_ControlMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_ControlMeta) ProtoMessage()    {}
 func (*TraceEvent_ControlMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 16}
+	return fileDescriptor_0571941a1d628a80, []int{0, 17}
 }
 func (m *TraceEvent_ControlMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1241,7 +1315,7 @@ func (m *TraceEvent_ControlIHaveMeta) Reset()         { *m = TraceEvent_ControlI
 func (m *TraceEvent_ControlIHaveMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_ControlIHaveMeta) ProtoMessage()    {}
 func (*TraceEvent_ControlIHaveMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 17}
+	return fileDescriptor_0571941a1d628a80, []int{0, 18}
 }
 func (m *TraceEvent_ControlIHaveMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1295,7 +1369,7 @@ func (m *TraceEvent_ControlIWantMeta) Reset()         { *m = TraceEvent_ControlI
 func (m *TraceEvent_ControlIWantMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_ControlIWantMeta) ProtoMessage()    {}
 func (*TraceEvent_ControlIWantMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 18}
+	return fileDescriptor_0571941a1d628a80, []int{0, 19}
 }
 func (m *TraceEvent_ControlIWantMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1342,7 +1416,7 @@ func (m *TraceEvent_ControlGraftMeta) Reset()         { *m = TraceEvent_ControlG
 func (m *TraceEvent_ControlGraftMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_ControlGraftMeta) ProtoMessage()    {}
 func (*TraceEvent_ControlGraftMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 19}
+	return fileDescriptor_0571941a1d628a80, []int{0, 20}
 }
 func (m *TraceEvent_ControlGraftMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1390,7 +1464,7 @@ func (m *TraceEvent_ControlPruneMeta) Reset()         { *m = TraceEvent_ControlP
 func (m *TraceEvent_ControlPruneMeta) String() string { return proto.CompactTextString(m) }
 func (*TraceEvent_ControlPruneMeta) ProtoMessage()    {}
 func (*TraceEvent_ControlPruneMeta) Descriptor() ([]byte, []int) {
-	return fileDescriptor_0571941a1d628a80, []int{0, 20}
+	return fileDescriptor_0571941a1d628a80, []int{0, 21}
 }
 func (m *TraceEvent_ControlPruneMeta) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -1496,6 +1570,7 @@ func init() {
 	proto.RegisterType((*TraceEvent_Leave)(nil), "pubsub.pb.TraceEvent.Leave")
 	proto.RegisterType((*TraceEvent_Graft)(nil), "pubsub.pb.TraceEvent.Graft")
 	proto.RegisterType((*TraceEvent_Prune)(nil), "pubsub.pb.TraceEvent.Prune")
+	proto.RegisterType((*TraceEvent_ThrottlePeer)(nil), "pubsub.pb.TraceEvent.ThrottlePeer")
 	proto.RegisterType((*TraceEvent_RPCMeta)(nil), "pubsub.pb.TraceEvent.RPCMeta")
 	proto.RegisterType((*TraceEvent_MessageMeta)(nil), "pubsub.pb.TraceEvent.MessageMeta")
 	proto.RegisterType((*TraceEvent_SubMeta)(nil), "pubsub.pb.TraceEvent.SubMeta")
@@ -1510,70 +1585,73 @@ func init() {
 func init() { proto.RegisterFile("trace.proto", fileDescriptor_0571941a1d628a80) }
 
 var fileDescriptor_0571941a1d628a80 = []byte{
-	// 999 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x96, 0x51, 0x6f, 0xda, 0x56,
-	0x14, 0xc7, 0xe7, 0x00, 0x01, 0x0e, 0x84, 0x78, 0x77, 0x6d, 0x65, 0xb1, 0x36, 0x62, 0x59, 0x55,
-	0x21, 0x4d, 0x42, 0x6a, 0xa4, 0xa9, 0x0f, 0x6b, 0xab, 0x11, 0xec, 0x26, 0x44, 0x24, 0xb1, 0x0e,
-	0x24, 0x7b, 0xcc, 0x0c, 0xdc, 0x35, 0x8e, 0xc0, 0xb6, 0xec, 0x0b, 0x53, 0x9f, 0xf6, 0xb4, 0xef,
-	0xd6, 0xb7, 0xed, 0x23, 0x54, 0xf9, 0x24, 0xd3, 0xbd, 0xd7, 0x36, 0x36, 0xd8, 0xb4, 0x8b, 0xfa,
-	0xe6, 0x73, 0xf3, 0xff, 0x9d, 0x7b, 0xce, 0xbd, 0xe7, 0x7f, 0x03, 0xd4, 0x98, 0x6f, 0x4d, 0x68,
-	0xc7, 0xf3, 0x5d, 0xe6, 0x92, 0xaa, 0xb7, 0x18, 0x07, 0x8b, 0x71, 0xc7, 0x1b, 0x1f, 0x7e, 0x7a,
-	0x02, 0x30, 0xe2, 0x7f, 0x32, 0x96, 0xd4, 0x61, 0xa4, 0x03, 0x45, 0xf6, 0xc1, 0xa3, 0x9a, 0xd2,
-	0x52, 0xda, 0x8d, 0xa3, 0x66, 0x27, 0x16, 0x76, 0x56, 0xa2, 0xce, 0xe8, 0x83, 0x47, 0x51, 0xe8,
-	0xc8, 0x13, 0xd8, 0xf5, 0x28, 0xf5, 0xfb, 0xba, 0xb6, 0xd3, 0x52, 0xda, 0x75, 0x0c, 0x23, 0xf2,
-	0x14, 0xaa, 0xcc, 0x9e, 0xd3, 0x80, 0x59, 0x73, 0x4f, 0x2b, 0xb4, 0x94, 0x76, 0x01, 0x57, 0x0b,
-	0x64, 0x00, 0x0d, 0x6f, 0x31, 0x9e, 0xd9, 0xc1, 0xed, 0x39, 0x0d, 0x02, 0xeb, 0x3d, 0xd5, 0x8a,
-	0x2d, 0xa5, 0x5d, 0x3b, 0x7a, 0x9e, 0xbd, 0x9f, 0x99, 0xd2, 0xe2, 0x1a, 0x4b, 0xfa, 0xb0, 0xe7,
-	0xd3, 0x3b, 0x3a, 0x61, 0x51, 0xb2, 0x92, 0x48, 0xf6, 0x63, 0x76, 0x32, 0x4c, 0x4a, 0x31, 0x4d,
-	0x12, 0x04, 0x75, 0xba, 0xf0, 0x66, 0xf6, 0xc4, 0x62, 0x34, 0xca, 0xb6, 0x2b, 0xb2, 0xbd, 0xc8,
-	0xce, 0xa6, 0xaf, 0xa9, 0x71, 0x83, 0xe7, 0xcd, 0x4e, 0xe9, 0xcc, 0x5e, 0x52, 0x3f, 0xca, 0x58,
-	0xde, 0xd6, 0xac, 0x9e, 0xd2, 0xe2, 0x1a, 0x4b, 0x5e, 0x41, 0xd9, 0x9a, 0x4e, 0x4d, 0x4a, 0x7d,
-	0xad, 0x22, 0xd2, 0x3c, 0xcb, 0x4e, 0xd3, 0x95, 0x22, 0x8c, 0xd4, 0xe4, 0x57, 0x00, 0x9f, 0xce,
-	0xdd, 0x25, 0x15, 0x6c, 0x55, 0xb0, 0xad, 0xbc, 0x23, 0x8a, 0x74, 0x98, 0x60, 0xf8, 0xd6, 0x3e,
-	0x9d, 0x2c, 0xd1, 0xec, 0x69, 0xb0, 0x6d, 0x6b, 0x94, 0x22, 0x8c, 0xd4, 0x1c, 0x0c, 0xa8, 0x33,
-	0xe5, 0x60, 0x6d, 0x1b, 0x38, 0x94, 0x22, 0x8c, 0xd4, 0x1c, 0x9c, 0xfa, 0xae, 0xc7, 0xc1, 0xfa,
-	0x36, 0x50, 0x97, 0x22, 0x8c, 0xd4, 0x7c, 0x8c, 0xef, 0x5c, 0xdb, 0xd1, 0xf6, 0x04, 0x95, 0x33,
-	0xc6, 0x67, 0xae, 0xed, 0xa0, 0xd0, 0x91, 0x97, 0x50, 0x9a, 0x51, 0x6b, 0x49, 0xb5, 0x86, 0x00,
-	0xbe, 0xcf, 0x06, 0x06, 0x5c, 0x82, 0x52, 0xc9, 0x91, 0xf7, 0xbe, 0xf5, 0x07, 0xd3, 0xf6, 0xb7,
-	0x21, 0x27, 0x5c, 0x82, 0x52, 0xc9, 0x11, 0xcf, 0x5f, 0x38, 0x54, 0x53, 0xb7, 0x21, 0x26, 0x97,
-	0xa0, 0x54, 0x36, 0x75, 0x68, 0xa4, 0xa7, 0x9f, 0x3b, 0x6b, 0x2e, 0x3f, 0xfb, 0xba, 0xb0, 0x69,
-	0x1d, 0x57, 0x0b, 0xe4, 0x11, 0x94, 0x98, 0xeb, 0xd9, 0x13, 0x61, 0xc7, 0x2a, 0xca, 0xa0, 0xf9,
-	0x17, 0xec, 0xa5, 0xc6, 0xfe, 0x33, 0x49, 0x0e, 0xa1, 0xee, 0xd3, 0x09, 0xb5, 0x97, 0x74, 0xfa,
-	0xce, 0x77, 0xe7, 0xa1, 0xb5, 0x53, 0x6b, 0xdc, 0xf8, 0x3e, 0xb5, 0x02, 0xd7, 0x11, 0xee, 0xae,
-	0x62, 0x18, 0xad, 0x0a, 0x28, 0x26, 0x0b, 0xb8, 0x03, 0x75, 0xdd, 0x29, 0x5f, 0xa1, 0x86, 0x78,
-	0xaf, 0x42, 0x72, 0xaf, 0x5b, 0x68, 0xa4, 0x3d, 0xf4, 0x90, 0x23, 0xdb, 0xd8, 0xbf, 0xb0, 0xb9,
-	0x7f, 0xf3, 0x15, 0x94, 0x43, 0x9b, 0x25, 0xde, 0x41, 0x25, 0xf5, 0x0e, 0x3e, 0xe2, 0x57, 0xee,
-	0x32, 0x37, 0x4a, 0x2e, 0x82, 0xe6, 0x73, 0x80, 0x95, 0xc7, 0xf2, 0xd8, 0xe6, 0xef, 0x50, 0x0e,
-	0xad, 0xb4, 0x51, 0x8d, 0x92, 0x71, 0x1a, 0x2f, 0xa1, 0x38, 0xa7, 0xcc, 0x12, 0x3b, 0xe5, 0x7b,
-	0xd3, 0xec, 0x9d, 0x53, 0x66, 0xa1, 0x90, 0x36, 0x47, 0x50, 0x0e, 0x3d, 0xc7, 0x8b, 0xe0, 0xae,
-	0x1b, 0xb9, 0x51, 0x11, 0x32, 0x7a, 0x60, 0xd6, 0xd0, 0x90, 0x5f, 0x33, 0xeb, 0x53, 0x28, 0x72,
-	0xc3, 0xae, 0xae, 0x4b, 0x49, 0x5e, 0xfa, 0x33, 0x28, 0x09, 0x77, 0xe6, 0x18, 0xe0, 0x67, 0x28,
-	0x09, 0x27, 0x6e, 0xbb, 0xa7, 0x6c, 0x4c, 0xb8, 0xf1, 0x7f, 0x62, 0x1f, 0x15, 0x28, 0x87, 0xc5,
-	0x93, 0x37, 0x50, 0x09, 0x47, 0x2d, 0xd0, 0x94, 0x56, 0xa1, 0x5d, 0x3b, 0xfa, 0x21, 0xbb, 0xdb,
-	0x70, 0x58, 0x45, 0xc7, 0x31, 0x42, 0xba, 0x50, 0x0f, 0x16, 0xe3, 0x60, 0xe2, 0xdb, 0x1e, 0xb3,
-	0x5d, 0x47, 0xdb, 0x11, 0x29, 0xf2, 0xde, 0xcf, 0xc5, 0x58, 0xe0, 0x29, 0x84, 0xfc, 0x02, 0xe5,
-	0x89, 0xeb, 0x30, 0xdf, 0x9d, 0x89, 0x21, 0xce, 0x2d, 0xa0, 0x27, 0x45, 0x22, 0x43, 0x44, 0x34,
-	0xbb, 0x50, 0x4b, 0x14, 0xf6, 0xa0, 0xc7, 0xe7, 0x0d, 0x94, 0xc3, 0xc2, 0x38, 0x1e, 0x96, 0x36,
-	0x96, 0x3f, 0x31, 0x2a, 0xb8, 0x5a, 0xc8, 0xc1, 0xff, 0xde, 0x81, 0x5a, 0xa2, 0x34, 0xf2, 0x1a,
-	0x4a, 0xf6, 0x2d, 0x7f, 0xaa, 0xe5, 0x69, 0xbe, 0xd8, 0xda, 0x4c, 0xff, 0xd4, 0x5a, 0xca, 0x23,
-	0x95, 0x90, 0xa0, 0xff, 0xb4, 0x1c, 0x16, 0x1e, 0xe4, 0x67, 0xe8, 0xdf, 0x2c, 0x87, 0x85, 0x34,
-	0x87, 0x38, 0x2d, 0xdf, 0xfc, 0xc2, 0x17, 0xd0, 0x62, 0xe0, 0x24, 0x2d, 0x9f, 0xff, 0xd7, 0xd1,
-	0xf3, 0x5f, 0xfc, 0x02, 0x5a, 0xcc, 0x9d, 0xa4, 0xe5, 0x7f, 0x82, 0x53, 0x50, 0xd7, 0x9b, 0xca,
-	0xf6, 0x02, 0x39, 0x00, 0x88, 0xef, 0x24, 0x10, 0x8d, 0xd6, 0x31, 0xb1, 0xd2, 0x3c, 0x5a, 0x65,
-	0x8a, 0x1a, 0x5c, 0x63, 0x94, 0x0d, 0xa6, 0x1d, 0x33, 0x71, 0x5b, 0x39, 0x4e, 0x7c, 0x1b, 0x2b,
-	0xe3, 0x16, 0x72, 0xea, 0xe4, 0x6f, 0x23, 0xa5, 0x7e, 0x54, 0xa2, 0x0c, 0x0e, 0xff, 0x51, 0xa0,
-	0xc8, 0x7f, 0x60, 0x92, 0xef, 0x60, 0xdf, 0xbc, 0x3a, 0x1e, 0xf4, 0x87, 0xa7, 0x37, 0xe7, 0xc6,
-	0x70, 0xd8, 0x3d, 0x31, 0xd4, 0x6f, 0x08, 0x81, 0x06, 0x1a, 0x67, 0x46, 0x6f, 0x14, 0xaf, 0x29,
-	0xe4, 0x31, 0x7c, 0xab, 0x5f, 0x99, 0x83, 0x7e, 0xaf, 0x3b, 0x32, 0xe2, 0xe5, 0x1d, 0xce, 0xeb,
-	0xc6, 0xa0, 0x7f, 0x6d, 0x60, 0xbc, 0x58, 0x20, 0x75, 0xa8, 0x74, 0x75, 0xfd, 0xc6, 0x34, 0x0c,
-	0x54, 0x8b, 0x64, 0x1f, 0x6a, 0x68, 0x9c, 0x5f, 0x5e, 0x1b, 0x72, 0xa1, 0xc4, 0xff, 0x8c, 0x46,
-	0xef, 0xfa, 0x06, 0xcd, 0x9e, 0xba, 0xcb, 0xa3, 0xa1, 0x71, 0xa1, 0x8b, 0xa8, 0xcc, 0x23, 0x1d,
-	0x2f, 0x4d, 0x11, 0x55, 0x48, 0x05, 0x8a, 0x67, 0x97, 0xfd, 0x0b, 0xb5, 0x4a, 0xaa, 0x50, 0x1a,
-	0x18, 0xdd, 0x6b, 0x43, 0x05, 0xfe, 0x79, 0x82, 0xdd, 0x77, 0x23, 0xb5, 0xc6, 0x3f, 0x4d, 0xbc,
-	0xba, 0x30, 0xd4, 0xfa, 0xe1, 0x5b, 0xd8, 0x5f, 0xdd, 0xef, 0xb1, 0xc5, 0x26, 0xb7, 0xe4, 0x27,
-	0x28, 0x8d, 0xf9, 0x47, 0x38, 0xc4, 0x8f, 0x33, 0x47, 0x01, 0xa5, 0xe6, 0xb8, 0xfe, 0xf1, 0xfe,
-	0x40, 0xf9, 0xf7, 0xfe, 0x40, 0xf9, 0x74, 0x7f, 0xa0, 0xfc, 0x17, 0x00, 0x00, 0xff, 0xff, 0xdb,
-	0x3a, 0x1c, 0xe4, 0xc9, 0x0b, 0x00, 0x00,
+	// 1041 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x96, 0xcd, 0x6e, 0xdb, 0x46,
+	0x17, 0x86, 0x3f, 0xea, 0xc7, 0x94, 0x8e, 0x68, 0x99, 0x9e, 0x2f, 0x29, 0x08, 0x36, 0x31, 0x54,
+	0x37, 0x08, 0x04, 0x14, 0x10, 0x10, 0x03, 0x45, 0x16, 0x4d, 0x82, 0xca, 0x22, 0x6d, 0xcb, 0x90,
+	0x6d, 0x62, 0x44, 0xbb, 0x4b, 0x97, 0x92, 0xa6, 0x31, 0x0d, 0x89, 0x24, 0xc8, 0x91, 0x8a, 0xac,
+	0xba, 0xea, 0xba, 0xb7, 0x95, 0x65, 0x2f, 0xa1, 0xf0, 0x95, 0x14, 0x33, 0x43, 0x4a, 0xa4, 0x44,
+	0xaa, 0x8e, 0x91, 0x1d, 0xcf, 0xe1, 0xfb, 0x9c, 0x39, 0xf3, 0xf3, 0x0e, 0x09, 0x0d, 0x1a, 0x3a,
+	0x63, 0xd2, 0x09, 0x42, 0x9f, 0xfa, 0xa8, 0x1e, 0xcc, 0x47, 0xd1, 0x7c, 0xd4, 0x09, 0x46, 0x87,
+	0x7f, 0x69, 0x00, 0x36, 0x7b, 0x65, 0x2e, 0x88, 0x47, 0x51, 0x07, 0x2a, 0xf4, 0x53, 0x40, 0x34,
+	0xa9, 0x25, 0xb5, 0x9b, 0x47, 0x7a, 0x67, 0x29, 0xec, 0xac, 0x44, 0x1d, 0xfb, 0x53, 0x40, 0x30,
+	0xd7, 0xa1, 0x6f, 0x60, 0x27, 0x20, 0x24, 0xec, 0x1b, 0x5a, 0xa9, 0x25, 0xb5, 0x15, 0x1c, 0x47,
+	0xe8, 0x05, 0xd4, 0xa9, 0x3b, 0x23, 0x11, 0x75, 0x66, 0x81, 0x56, 0x6e, 0x49, 0xed, 0x32, 0x5e,
+	0x25, 0xd0, 0x00, 0x9a, 0xc1, 0x7c, 0x34, 0x75, 0xa3, 0xbb, 0x0b, 0x12, 0x45, 0xce, 0x47, 0xa2,
+	0x55, 0x5a, 0x52, 0xbb, 0x71, 0xf4, 0x2a, 0x7f, 0x3c, 0x2b, 0xa3, 0xc5, 0x6b, 0x2c, 0xea, 0xc3,
+	0x6e, 0x48, 0xee, 0xc9, 0x98, 0x26, 0xc5, 0xaa, 0xbc, 0xd8, 0xf7, 0xf9, 0xc5, 0x70, 0x5a, 0x8a,
+	0xb3, 0x24, 0xc2, 0xa0, 0x4e, 0xe6, 0xc1, 0xd4, 0x1d, 0x3b, 0x94, 0x24, 0xd5, 0x76, 0x78, 0xb5,
+	0xd7, 0xf9, 0xd5, 0x8c, 0x35, 0x35, 0xde, 0xe0, 0xd9, 0x64, 0x27, 0x64, 0xea, 0x2e, 0x48, 0x98,
+	0x54, 0x94, 0xb7, 0x4d, 0xd6, 0xc8, 0x68, 0xf1, 0x1a, 0x8b, 0xde, 0x82, 0xec, 0x4c, 0x26, 0x16,
+	0x21, 0xa1, 0x56, 0xe3, 0x65, 0x5e, 0xe6, 0x97, 0xe9, 0x0a, 0x11, 0x4e, 0xd4, 0xe8, 0x67, 0x80,
+	0x90, 0xcc, 0xfc, 0x05, 0xe1, 0x6c, 0x9d, 0xb3, 0xad, 0xa2, 0x25, 0x4a, 0x74, 0x38, 0xc5, 0xb0,
+	0xa1, 0x43, 0x32, 0x5e, 0x60, 0xab, 0xa7, 0xc1, 0xb6, 0xa1, 0xb1, 0x10, 0xe1, 0x44, 0xcd, 0xc0,
+	0x88, 0x78, 0x13, 0x06, 0x36, 0xb6, 0x81, 0x43, 0x21, 0xc2, 0x89, 0x9a, 0x81, 0x93, 0xd0, 0x0f,
+	0x18, 0xa8, 0x6c, 0x03, 0x0d, 0x21, 0xc2, 0x89, 0x9a, 0x1d, 0xe3, 0x7b, 0xdf, 0xf5, 0xb4, 0x5d,
+	0x4e, 0x15, 0x1c, 0xe3, 0x73, 0xdf, 0xf5, 0x30, 0xd7, 0xa1, 0x37, 0x50, 0x9d, 0x12, 0x67, 0x41,
+	0xb4, 0x26, 0x07, 0xbe, 0xcd, 0x07, 0x06, 0x4c, 0x82, 0x85, 0x92, 0x21, 0x1f, 0x43, 0xe7, 0x37,
+	0xaa, 0xed, 0x6d, 0x43, 0x4e, 0x99, 0x04, 0x0b, 0x25, 0x43, 0x82, 0x70, 0xee, 0x11, 0x4d, 0xdd,
+	0x86, 0x58, 0x4c, 0x82, 0x85, 0x12, 0x9d, 0x80, 0x42, 0xef, 0x42, 0x9f, 0xd2, 0xa9, 0xd8, 0xb7,
+	0x7d, 0x4e, 0x1e, 0x16, 0xf8, 0x32, 0xa5, 0xc4, 0x19, 0x4e, 0x37, 0xa0, 0x99, 0x75, 0x11, 0x73,
+	0xe8, 0x4c, 0x3c, 0xf6, 0x0d, 0x6e, 0x77, 0x05, 0xaf, 0x12, 0xe8, 0x19, 0x54, 0xa9, 0x1f, 0xb8,
+	0x63, 0x6e, 0xeb, 0x3a, 0x16, 0x81, 0xfe, 0x07, 0xec, 0x66, 0xec, 0xf3, 0x1f, 0x45, 0x0e, 0x41,
+	0x09, 0xc9, 0x98, 0xb8, 0x0b, 0x32, 0x39, 0x09, 0xfd, 0x59, 0x7c, 0x45, 0x64, 0x72, 0xec, 0x02,
+	0x09, 0x89, 0x13, 0xf9, 0x1e, 0xbf, 0x25, 0xea, 0x38, 0x8e, 0x56, 0x0d, 0x54, 0xd2, 0x0d, 0xdc,
+	0x83, 0xba, 0xee, 0xb8, 0xaf, 0xd0, 0xc3, 0x72, 0xac, 0x72, 0x7a, 0xac, 0x3b, 0x68, 0x66, 0xbd,
+	0xf8, 0x94, 0x25, 0xdb, 0x18, 0xbf, 0xbc, 0x39, 0xbe, 0xfe, 0x16, 0xe4, 0xd8, 0xae, 0xa9, 0xfb,
+	0x54, 0xca, 0xdc, 0xa7, 0xcf, 0xd8, 0xd1, 0xf1, 0xa9, 0x9f, 0x14, 0xe7, 0x81, 0xfe, 0x0a, 0x60,
+	0xe5, 0xd5, 0x22, 0x56, 0xff, 0x15, 0xe4, 0xd8, 0x92, 0x1b, 0xdd, 0x48, 0x39, 0xab, 0xf1, 0x06,
+	0x2a, 0x33, 0x42, 0x1d, 0xad, 0xb4, 0xcd, 0x71, 0xd8, 0xea, 0x5d, 0x10, 0xea, 0x60, 0x2e, 0xd5,
+	0x6d, 0x90, 0x63, 0xef, 0xb2, 0x26, 0x98, 0x7b, 0x6d, 0x3f, 0x69, 0x42, 0x44, 0x4f, 0xa9, 0x7a,
+	0x0f, 0x72, 0x6c, 0xec, 0xaf, 0x58, 0xb5, 0x60, 0xb3, 0x5f, 0x40, 0x85, 0x5d, 0x07, 0xab, 0xb7,
+	0x52, 0xfa, 0xed, 0x4b, 0xa8, 0x72, 0xef, 0x17, 0xd8, 0xe2, 0x47, 0xa8, 0x72, 0x9f, 0x6f, 0xdb,
+	0xbd, 0x7c, 0x8c, 0x7b, 0xfd, 0x0b, 0xb1, 0x77, 0xa0, 0xa4, 0x8d, 0xfe, 0x85, 0xf4, 0x67, 0x09,
+	0xe4, 0x78, 0x41, 0xd0, 0x7b, 0xa8, 0xc5, 0xc7, 0x37, 0xd2, 0xa4, 0x56, 0xb9, 0xdd, 0x38, 0xfa,
+	0x2e, 0x7f, 0x05, 0x63, 0x03, 0xf0, 0x55, 0x5c, 0x22, 0xa8, 0x0b, 0x4a, 0x34, 0x1f, 0x45, 0xe3,
+	0xd0, 0x0d, 0xa8, 0xeb, 0x7b, 0x5a, 0xa9, 0x55, 0x2e, 0xde, 0x84, 0xe1, 0x7c, 0xc4, 0xf1, 0x0c,
+	0x82, 0x7e, 0x02, 0x79, 0xec, 0x7b, 0x34, 0xf4, 0xa7, 0x7c, 0x3b, 0x0a, 0x1b, 0xe8, 0x09, 0x11,
+	0xaf, 0x90, 0x10, 0x7a, 0x17, 0x1a, 0xa9, 0xc6, 0x9e, 0x74, 0xa1, 0xbd, 0x07, 0x39, 0x6e, 0x8c,
+	0xe1, 0x71, 0x6b, 0x23, 0xf1, 0xfb, 0x53, 0xc3, 0xab, 0x44, 0x01, 0xfe, 0x67, 0x09, 0x1a, 0xa9,
+	0xd6, 0xd0, 0x3b, 0xa8, 0xba, 0x77, 0xec, 0x33, 0x22, 0x56, 0xf3, 0xf5, 0xd6, 0xc9, 0xf4, 0xcf,
+	0x9c, 0x85, 0x58, 0x52, 0x01, 0x71, 0xfa, 0x77, 0xc7, 0xa3, 0x5a, 0xe9, 0x31, 0xf4, 0x2f, 0x8e,
+	0x47, 0x63, 0x9a, 0x41, 0x8c, 0x16, 0xdf, 0xa3, 0xf2, 0x23, 0x68, 0x7e, 0x5c, 0x05, 0xcd, 0x21,
+	0x46, 0x8b, 0x4f, 0x53, 0xe5, 0x11, 0x34, 0x3f, 0xb5, 0x82, 0xe6, 0x90, 0x7e, 0x06, 0xea, 0xfa,
+	0xa4, 0xf2, 0x9d, 0x84, 0x0e, 0x00, 0x96, 0x7b, 0x12, 0xf1, 0x89, 0x2a, 0x38, 0x95, 0xd1, 0x8f,
+	0x40, 0x5d, 0x9f, 0xe0, 0x1a, 0x23, 0x6d, 0x30, 0x6d, 0x50, 0xd7, 0xa7, 0x55, 0xe0, 0xe3, 0x0f,
+	0xa0, 0xae, 0x4f, 0xa1, 0xa0, 0x4f, 0x76, 0xdf, 0x12, 0x12, 0x26, 0x2d, 0x8a, 0xe0, 0xf0, 0x41,
+	0x82, 0x0a, 0xfb, 0xf9, 0x45, 0xff, 0x87, 0x3d, 0xeb, 0xfa, 0x78, 0xd0, 0x1f, 0x9e, 0xdd, 0x5e,
+	0x98, 0xc3, 0x61, 0xf7, 0xd4, 0x54, 0xff, 0x87, 0x10, 0x34, 0xb1, 0x79, 0x6e, 0xf6, 0xec, 0x65,
+	0x4e, 0x42, 0xcf, 0x61, 0xdf, 0xb8, 0xb6, 0x06, 0xfd, 0x5e, 0xd7, 0x36, 0x97, 0xe9, 0x12, 0xe3,
+	0x0d, 0x73, 0xd0, 0xbf, 0x31, 0xf1, 0x32, 0x59, 0x46, 0x0a, 0xd4, 0xba, 0x86, 0x71, 0x6b, 0x99,
+	0x26, 0x56, 0x2b, 0x68, 0x0f, 0x1a, 0xd8, 0xbc, 0xb8, 0xba, 0x31, 0x45, 0xa2, 0xca, 0x5e, 0x63,
+	0xb3, 0x77, 0x73, 0x8b, 0xad, 0x9e, 0xba, 0xc3, 0xa2, 0xa1, 0x79, 0x69, 0xf0, 0x48, 0x66, 0x91,
+	0x81, 0xaf, 0x2c, 0x1e, 0xd5, 0x50, 0x0d, 0x2a, 0xe7, 0x57, 0xfd, 0x4b, 0xb5, 0x8e, 0xea, 0x50,
+	0x1d, 0x98, 0xdd, 0x1b, 0x53, 0x05, 0xf6, 0x78, 0x8a, 0xbb, 0x27, 0xb6, 0xda, 0x60, 0x8f, 0x16,
+	0xbe, 0xbe, 0x34, 0x55, 0x05, 0xed, 0xc3, 0xae, 0x7d, 0x86, 0xaf, 0x6c, 0x7b, 0x10, 0x8f, 0xb3,
+	0x7b, 0xf8, 0x01, 0xf6, 0x56, 0x5b, 0x7e, 0xec, 0xd0, 0xf1, 0x1d, 0xfa, 0x01, 0xaa, 0x23, 0xf6,
+	0x10, 0x9f, 0xeb, 0xe7, 0xb9, 0xa7, 0x03, 0x0b, 0xcd, 0xb1, 0xf2, 0xf9, 0xe1, 0x40, 0xfa, 0xfb,
+	0xe1, 0x40, 0xfa, 0xe7, 0xe1, 0x40, 0xfa, 0x77, 0x00, 0xd8, 0x6c, 0xc6, 0x6a, 0x78, 0x0c, 0x00,
+	0x00,
 }
 
 func (m *TraceEvent) Marshal() (dAtA []byte, err error) {
@@ -1600,6 +1678,20 @@ func (m *TraceEvent) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		i -= len(m.XXX_unrecognized)
 		copy(dAtA[i:], m.XXX_unrecognized)
 	}
+	if m.ThrottlePeer != nil {
+		{
+			size, err := m.ThrottlePeer.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintTrace(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x8a
+	}
 	if m.Prune != nil {
 		{
 			size, err := m.Prune.MarshalToSizedBuffer(dAtA[:i])
@@ -2161,6 +2253,13 @@ func (m *TraceEvent_DropRPC) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		i -= len(m.XXX_unrecognized)
 		copy(dAtA[i:], m.XXX_unrecognized)
 	}
+	if m.Topic != nil {
+		i -= len(*m.Topic)
+		copy(dAtA[i:], *m.Topic)
+		i = encodeVarintTrace(dAtA, i, uint64(len(*m.Topic)))
+		i--
+		dAtA[i] = 0x1a
+	}
 	if m.Meta != nil {
 		{
 			size, err := m.Meta.MarshalToSizedBuffer(dAtA[:i])
@@ -2333,6 +2432,47 @@ func (m *TraceEvent_Prune) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *TraceEvent_ThrottlePeer) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *TraceEvent_ThrottlePeer) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *TraceEvent_ThrottlePeer) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.Topic != nil {
+		i -= len(*m.Topic)
+		copy(dAtA[i:], *m.Topic)
+		i = encodeVarintTrace(dAtA, i, uint64(len(*m.Topic)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if m.PeerID != nil {
+		i -= len(m.PeerID)
+		copy(dAtA[i:], m.PeerID)
+		i = encodeVarintTrace(dAtA, i, uint64(len(m.PeerID)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
 func (m *TraceEvent_RPCMeta) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -2844,6 +2984,10 @@ func (m *TraceEvent) Size() (n int) {
 		l = m.Prune.Size()
 		n += 2 + l + sovTrace(uint64(l))
 	}
+	if m.ThrottlePeer != nil {
+		l = m.ThrottlePeer.Size()
+		n += 2 + l + sovTrace(uint64(l))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -3036,6 +3180,10 @@ func (m *TraceEvent_DropRPC) Size() (n int) {
 		l = m.Meta.Size()
 		n += 1 + l + sovTrace(uint64(l))
 	}
+	if m.Topic != nil {
+		l = len(*m.Topic)
+		n += 1 + l + sovTrace(uint64(l))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -3114,6 +3262,26 @@ func (m *TraceEvent_Prune) Size() (n int) {
 	return n
 }
 
+func (m *TraceEvent_ThrottlePeer) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.PeerID != nil {
+		l = len(m.PeerID)
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	if m.Topic != nil {
+		l = len(*m.Topic)
+		n += 1 + l + sovTrace(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
 func (m *TraceEvent_RPCMeta) Size() (n int) {
 	if m == nil {
 		return 0
@@ -3890,6 +4058,42 @@ func (m *TraceEvent) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 17:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ThrottlePeer", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.ThrottlePeer == nil {
+				m.ThrottlePeer = &TraceEvent_ThrottlePeer{}
+			}
+			if err := m.ThrottlePeer.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTrace(dAtA[iNdEx:])
@@ -5063,6 +5267,39 @@ func (m *TraceEvent_DropRPC) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Topic", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			s := string(dAtA[iNdEx:postIndex])
+			m.Topic = &s
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTrace(dAtA[iNdEx:])
@@ -5489,6 +5726,124 @@ func (m *TraceEvent_Prune) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *TraceEvent_ThrottlePeer) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTrace
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ThrottlePeer: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ThrottlePeer: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PeerID", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.PeerID = append(m.PeerID[:0], dAtA[iNdEx:postIndex]...)
+			if m.PeerID == nil {
+				m.PeerID = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Topic", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTrace
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTrace
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			s := string(dAtA[iNdEx:postIndex])
+			m.Topic = &s
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTrace(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthTrace
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func (m *TraceEvent_RPCMeta) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
@@ -0,0 +1,119 @@
+package pubsub
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// allowlistLogInterval is the minimum interval between logs of denied attempts
+const allowlistLogInterval = 10 * time.Second
+
+// peerAllowlist is the set of peers allowed to establish pubsub streams
+type peerAllowlist struct {
+	mx    sync.RWMutex
+	peers map[peer.ID]struct{}
+
+	denied atomic.Uint64
+	// lastLog is the time of the last log of denied attempts, in unix nanoseconds
+	lastLog atomic.Int64
+	// loggedDenied is the denied count at the last log
+	loggedDenied atomic.Uint64
+}
+
+// WithPeerAllowlist only accepts pubsub streams from and connections to the given peers, and
+// the direct peers of the router; streams from other peers are reset and their RPCs ignored.
+// The allow list can be updated at runtime with AddAllowedPeer and RemoveAllowedPeer.
+func WithPeerAllowlist(ids []peer.ID) Option {
+	return func(p *PubSub) error {
+		al := &peerAllowlist{peers: make(map[peer.ID]struct{}, len(ids))}
+		for _, pid := range ids {
+			al.peers[pid] = struct{}{}
+		}
+		p.allowlist = al
+		return nil
+	}
+}
+
+// AddAllowedPeer adds a peer to the allow list; it has no effect without WithPeerAllowlist.
+// A connected peer is attached again, but it may have given up on its own stream after being
+// denied, in which case it has to reconnect.
+func (p *PubSub) AddAllowedPeer(pid peer.ID) {
+	al := p.allowlist
+	if al == nil {
+		return
+	}
+
+	al.mx.Lock()
+	al.peers[pid] = struct{}{}
+	al.mx.Unlock()
+
+	// attach the peer if it is already connected
+	(*PubSubNotif)(p).addPendingPeer(pid)
+}
+
+// RemoveAllowedPeer removes a peer from the allow list, detaching it unless it is a direct
+// peer; it has no effect without WithPeerAllowlist.
+func (p *PubSub) RemoveAllowedPeer(pid peer.ID) {
+	al := p.allowlist
+	if al == nil {
+		return
+	}
+
+	al.mx.Lock()
+	delete(al.peers, pid)
+	al.mx.Unlock()
+
+	select {
+	case p.eval <- func() {
+		if !p.peerAllowed(pid) {
+			p.detachPeer(pid, DetachNotAllowed)
+		}
+	}:
+	case <-p.ctx.Done():
+	}
+}
+
+// AllowlistDenied returns the number of streams, connections and RPCs denied by the allow list.
+func (p *PubSub) AllowlistDenied() uint64 {
+	if p.allowlist == nil {
+		return 0
+	}
+	return p.allowlist.denied.Load()
+}
+
+// peerAllowed returns whether a peer is accepted by the allow list.
+// Direct peers are fixed when the router is constructed, so this is safe to call from the
+// stream handlers.
+func (p *PubSub) peerAllowed(pid peer.ID) bool {
+	al := p.allowlist
+	if al == nil {
+		return true
+	}
+
+	al.mx.RLock()
+	_, ok := al.peers[pid]
+	al.mx.RUnlock()
+	return ok || p.isDirectPeer(pid)
+}
+
+// denyPeer checks a peer against the allow list, counting denied attempts and logging them at
+// most once per allowlistLogInterval
+func (p *PubSub) denyPeer(pid peer.ID) bool {
+	if p.peerAllowed(pid) {
+		return false
+	}
+
+	al := p.allowlist
+	denied := al.denied.Add(1)
+
+	now := p.clock.Now().UnixNano()
+	last := al.lastLog.Load()
+	if now-last >= int64(allowlistLogInterval) && al.lastLog.CompareAndSwap(last, now) {
+		since := denied - al.loggedDenied.Swap(denied)
+		log.Infof("denied %d pubsub attempts from peers not on the allow list, most recently %s", since, pid)
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestPeerAllowlist(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 4)
+	psubs := []*PubSub{
+		getPubsub(ctx, hosts[0], WithPeerAllowlist([]peer.ID{hosts[1].ID()})),
+		getPubsub(ctx, hosts[1]),
+		getPubsub(ctx, hosts[2]),
+		getPubsub(ctx, hosts[3]),
+	}
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[0], hosts[2])
+
+	sub, err := psubs[0].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ps := range psubs[1:] {
+		mustSubscribe(t, ps, "test")
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	peers := psubs[0].ListPeers("test")
+	if len(peers) != 1 || peers[0] != hosts[1].ID() {
+		t.Fatalf("expected only the allowed peer, got %v", peers)
+	}
+	if psubs[0].AllowlistDenied() == 0 {
+		t.Fatal("expected the denied attempts to be counted")
+	}
+
+	psubs[2].Publish("test", []byte("denied"))
+	assertNeverReceives(t, sub, time.Second)
+	psubs[1].Publish("test", []byte("allowed"))
+	assertReceive(t, sub, []byte("allowed"))
+
+	// the allow list can be updated at runtime
+	psubs[0].AddAllowedPeer(hosts[3].ID())
+	psubs[0].RemoveAllowedPeer(hosts[1].ID())
+	connect(t, hosts[0], hosts[3])
+	time.Sleep(time.Millisecond * 100)
+
+	peers = psubs[0].ListPeers("test")
+	if len(peers) != 1 || peers[0] != hosts[3].ID() {
+		t.Fatalf("expected only the newly allowed peer, got %v", peers)
+	}
+
+	psubs[1].Publish("test", []byte("removed"))
+	assertNeverReceives(t, sub, time.Second)
+	psubs[3].Publish("test", []byte("added"))
+	assertReceive(t, sub, []byte("added"))
+}
+
+func TestPeerAllowlistDirectPeers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := []*PubSub{
+		getGossipsub(ctx, hosts[0],
+			WithPeerAllowlist(nil),
+			WithDirectPeers([]peer.AddrInfo{{ID: hosts[1].ID(), Addrs: hosts[1].Addrs()}})),
+		getGossipsub(ctx, hosts[1],
+			WithDirectPeers([]peer.AddrInfo{{ID: hosts[0].ID(), Addrs: hosts[0].Addrs()}})),
+	}
+	connect(t, hosts[0], hosts[1])
+
+	sub, err := psubs[0].Subscribe("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustSubscribe(t, psubs[1], "test")
+	time.Sleep(time.Millisecond * 100)
+
+	psubs[1].Publish("test", []byte("direct"))
+	assertReceive(t, sub, []byte("direct"))
+}
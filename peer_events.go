@@ -0,0 +1,178 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+type PeerConnectivityEventType int
+
+const (
+	// PeerProtocolAttached is emitted when a pubsub stream has been established with a peer.
+	PeerProtocolAttached PeerConnectivityEventType = iota
+	// PeerDetached is emitted when a peer is no longer usable by pubsub.
+	PeerDetached
+)
+
+// PeerDetachReason explains why a peer was detached.
+type PeerDetachReason int
+
+const (
+	// DetachNone is the reason of attach events.
+	DetachNone PeerDetachReason = iota
+	// DetachStreamFailed signals that we failed to open a pubsub stream to the peer.
+	DetachStreamFailed
+	// DetachPeerDead signals that the pubsub stream to the peer was closed.
+	DetachPeerDead
+	// DetachBlacklisted signals that the peer was blacklisted.
+	DetachBlacklisted
+	// DetachNotAllowed signals that the peer was removed from the peer allow list.
+	DetachNotAllowed
+)
+
+func (r PeerDetachReason) String() string {
+	switch r {
+	case DetachNone:
+		return "none"
+	case DetachStreamFailed:
+		return "stream failed"
+	case DetachPeerDead:
+		return "peer dead"
+	case DetachBlacklisted:
+		return "blacklisted"
+	case DetachNotAllowed:
+		return "not allowed"
+	default:
+		return fmt.Sprintf("unknown reason %d", int(r))
+	}
+}
+
+// PeerConnectivityEvent describes a change in the pubsub connectivity of a peer.
+type PeerConnectivityEvent struct {
+	Type PeerConnectivityEventType
+	Peer peer.ID
+	// Protocol is the negotiated pubsub protocol; only set for PeerProtocolAttached events.
+	Protocol protocol.ID
+	// Reason is the reason the peer was detached; only set for PeerDetached events.
+	Reason PeerDetachReason
+}
+
+// PeerEventHandler is used to receive pubsub level peer connectivity events.
+type PeerEventHandler struct {
+	p *PubSub
+
+	evtLogMx sync.Mutex
+	evtLog   map[peer.ID]PeerConnectivityEvent
+	evtLogCh chan struct{}
+}
+
+// PeerEventHandler returns a handler for pubsub level peer connectivity events.
+// Contrary to the network notifications, these events track the pubsub streams: a peer is
+// attached once we have a pubsub stream with it and detached once that stream is gone.
+// Only events occurring after the handler is created are delivered.
+func (p *PubSub) PeerEventHandler() *PeerEventHandler {
+	h := &PeerEventHandler{
+		p:        p,
+		evtLog:   make(map[peer.ID]PeerConnectivityEvent),
+		evtLogCh: make(chan struct{}, 1),
+	}
+
+	p.peerEvtHandlersMx.Lock()
+	p.peerEvtHandlers[h] = struct{}{}
+	p.peerEvtHandlersMx.Unlock()
+
+	return h
+}
+
+// Cancel closes the peer event handler
+func (h *PeerEventHandler) Cancel() {
+	h.p.peerEvtHandlersMx.Lock()
+	delete(h.p.peerEvtHandlers, h)
+	h.p.peerEvtHandlersMx.Unlock()
+}
+
+func (h *PeerEventHandler) sendNotification(evt PeerConnectivityEvent) {
+	h.evtLogMx.Lock()
+	h.addToEventLog(evt)
+	h.evtLogMx.Unlock()
+}
+
+// addToEventLog assumes a lock has been taken to protect the event log
+func (h *PeerEventHandler) addToEventLog(evt PeerConnectivityEvent) {
+	e, ok := h.evtLog[evt.Peer]
+	switch {
+	case !ok:
+		h.evtLog[evt.Peer] = evt
+		// send signal that an event has been added to the event log
+		select {
+		case h.evtLogCh <- struct{}{}:
+		default:
+		}
+	case e.Type != evt.Type:
+		// a flapping peer cancels out
+		delete(h.evtLog, evt.Peer)
+	default:
+		// keep the latest details
+		h.evtLog[evt.Peer] = evt
+	}
+}
+
+// pullFromEventLog assumes a lock has been taken to protect the event log
+func (h *PeerEventHandler) pullFromEventLog() (PeerConnectivityEvent, bool) {
+	for k, v := range h.evtLog {
+		delete(h.evtLog, k)
+		return v, true
+	}
+	return PeerConnectivityEvent{}, false
+}
+
+// NextPeerEvent returns the next peer connectivity event.
+// Guarantees: attach and detach events for a given peer will fire in order.
+// If a peer attaches and detaches (or vice versa) before NextPeerEvent emits either event,
+// both events are dropped, so that rapid flapping does not flood the consumer.
+func (h *PeerEventHandler) NextPeerEvent(ctx context.Context) (PeerConnectivityEvent, error) {
+	for {
+		h.evtLogMx.Lock()
+		evt, ok := h.pullFromEventLog()
+		if ok {
+			// make sure an event log signal is available if there are events in the event log
+			if len(h.evtLog) > 0 {
+				select {
+				case h.evtLogCh <- struct{}{}:
+				default:
+				}
+			}
+			h.evtLogMx.Unlock()
+			return evt, nil
+		}
+		h.evtLogMx.Unlock()
+
+		select {
+		case <-h.evtLogCh:
+			continue
+		case <-ctx.Done():
+			return PeerConnectivityEvent{}, ctx.Err()
+		}
+	}
+}
+
+func (p *PubSub) notifyPeerAttached(pid peer.ID, proto protocol.ID) {
+	p.notifyPeerEvent(PeerConnectivityEvent{Type: PeerProtocolAttached, Peer: pid, Protocol: proto})
+}
+
+func (p *PubSub) notifyPeerDetached(pid peer.ID, reason PeerDetachReason) {
+	p.notifyPeerEvent(PeerConnectivityEvent{Type: PeerDetached, Peer: pid, Reason: reason})
+}
+
+func (p *PubSub) notifyPeerEvent(evt PeerConnectivityEvent) {
+	p.peerEvtHandlersMx.RLock()
+	defer p.peerEvtHandlersMx.RUnlock()
+
+	for h := range p.peerEvtHandlers {
+		h.sendNotification(evt)
+	}
+}
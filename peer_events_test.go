@@ -0,0 +1,76 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestPeerEventHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getGossipsubs(ctx, hosts)
+
+	evts := psubs[0].PeerEventHandler()
+	defer evts.Cancel()
+
+	connect(t, hosts[0], hosts[1])
+
+	nctx, ncancel := context.WithTimeout(ctx, 5*time.Second)
+	defer ncancel()
+
+	evt, err := evts.NextPeerEvent(nctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evt.Type != PeerProtocolAttached || evt.Peer != hosts[1].ID() {
+		t.Fatalf("unexpected event: %+v", evt)
+	}
+	if evt.Protocol != GossipSubID_choke {
+		t.Fatalf("unexpected protocol: %s", evt.Protocol)
+	}
+
+	psubs[0].BlacklistPeer(hosts[1].ID())
+
+	evt, err = evts.NextPeerEvent(nctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evt.Type != PeerDetached || evt.Peer != hosts[1].ID() || evt.Reason != DetachBlacklisted {
+		t.Fatalf("unexpected event: %+v", evt)
+	}
+}
+
+func TestPeerEventHandlerCoalescing(t *testing.T) {
+	h := &PeerEventHandler{
+		evtLog:   make(map[peer.ID]PeerConnectivityEvent),
+		evtLogCh: make(chan struct{}, 1),
+	}
+
+	a, b := peer.ID("a"), peer.ID("b")
+
+	// a flaps and cancels out, b ends up detached
+	h.sendNotification(PeerConnectivityEvent{Type: PeerProtocolAttached, Peer: a})
+	h.sendNotification(PeerConnectivityEvent{Type: PeerDetached, Peer: a, Reason: DetachPeerDead})
+	h.sendNotification(PeerConnectivityEvent{Type: PeerDetached, Peer: b, Reason: DetachStreamFailed})
+	h.sendNotification(PeerConnectivityEvent{Type: PeerDetached, Peer: b, Reason: DetachPeerDead})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	evt, err := h.NextPeerEvent(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evt.Peer != b || evt.Type != PeerDetached || evt.Reason != DetachPeerDead {
+		t.Fatalf("unexpected event: %+v", evt)
+	}
+
+	if _, err := h.NextPeerEvent(ctx); err == nil {
+		t.Fatal("expected no more events")
+	}
+}
@@ -2,8 +2,10 @@ package pubsub
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"net/netip"
 	"sort"
 	"sync"
 	"time"
@@ -27,6 +29,18 @@ var (
 	DefaultPeerGaterSourceDecay     = ScoreParameterDecay(time.Hour)
 )
 
+// PeerGaterStatsKey selects how the peer gater groups the statistics of peers.
+type PeerGaterStatsKey int
+
+const (
+	// PeerGaterKeyIP groups the statistics of the peers sharing an IP address, so that a
+	// misbehaving node can't reset its statistics by changing its peer ID.
+	PeerGaterKeyIP PeerGaterStatsKey = iota
+	// PeerGaterKeyPeer keeps separate statistics for every peer ID, so that distinct peers behind
+	// the same NAT aren't throttled for each other.
+	PeerGaterKeyPeer
+)
+
 // PeerGaterParams groups together parameters that control the operation of the peer gater
 type PeerGaterParams struct {
 	// when the ratio of throttled/validated messages exceeds this threshold, the gater turns on
@@ -52,6 +66,15 @@ type PeerGaterParams struct {
 
 	// priority topic delivery weights
 	TopicDeliveryWeights map[string]float64
+
+	// topics whose messages are never gated, even when the gater is active
+	ExemptTopics []string
+
+	// how peer statistics are grouped
+	StatsKey PeerGaterStatsKey
+	// subnets in CIDR notation whose peers have separate statistics with PeerGaterKeyIP, e.g.
+	// known NAT gateways
+	PerPeerSubnets []string
 }
 
 func (p *PeerGaterParams) validate() error {
@@ -83,6 +106,12 @@ func (p *PeerGaterParams) validate() error {
 	if p.RejectWeight < 1 {
 		return fmt.Errorf("invalud RejectWeight; must be >= 1")
 	}
+	if p.StatsKey != PeerGaterKeyIP && p.StatsKey != PeerGaterKeyPeer {
+		return fmt.Errorf("invalid StatsKey")
+	}
+	if _, err := parseSubnets(p.PerPeerSubnets); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -93,6 +122,32 @@ func (p *PeerGaterParams) WithTopicDeliveryWeights(w map[string]float64) *PeerGa
 	return p
 }
 
+// WithExemptTopics is a fluid setter for the topics exempted from gating
+func (p *PeerGaterParams) WithExemptTopics(topics ...string) *PeerGaterParams {
+	p.ExemptTopics = topics
+	return p
+}
+
+// WithStatsKey is a fluid setter for the grouping of peer statistics, with the subnets whose
+// peers have separate statistics when grouping by IP
+func (p *PeerGaterParams) WithStatsKey(key PeerGaterStatsKey, perPeerSubnets ...string) *PeerGaterParams {
+	p.StatsKey = key
+	p.PerPeerSubnets = perPeerSubnets
+	return p
+}
+
+func parseSubnets(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
 // NewPeerGaterParams creates a new PeerGaterParams struct, using the specified threshold and decay
 // parameters and default values for all other parameters.
 func NewPeerGaterParams(threshold, globalDecay, sourceDecay float64) *PeerGaterParams {
@@ -123,6 +178,12 @@ type peerGater struct {
 
 	// gater parameters
 	params *PeerGaterParams
+	// topics exempted from gating
+	exempt map[string]struct{}
+	// subnets whose peers have separate statistics
+	perPeerSubnets []netip.Prefix
+	// signals the background goroutine that the decay interval changed
+	decayIntervalCh chan time.Duration
 
 	// counters
 	validate, throttle float64
@@ -133,8 +194,10 @@ type peerGater struct {
 	// stats per peer.ID -- multiple peer IDs may share the same stats object if they are
 	// colocated in the same IP
 	peerStats map[peer.ID]*peerGaterStats
-	// stats per IP
+	// stats per IP, or per peer ID for the peers with separate statistics
 	ipStats map[string]*peerGaterStats
+	// accept decisions per connected peer
+	decisions map[peer.ID]*peerGaterDecisions
 
 	// for unit tests
 	getIP func(peer.ID) string
@@ -150,6 +213,24 @@ type peerGaterStats struct {
 	deliver, duplicate, ignore, reject float64
 }
 
+type peerGaterDecisions struct {
+	accepted, throttled uint64
+	// number of payload messages dropped while throttled
+	gated uint64
+	// time the last gated message was traced
+	lastTrace time.Time
+}
+
+// peerGaterTraceInterval is the minimum interval between traces of gated messages of a peer
+const peerGaterTraceInterval = time.Second
+
+// PeerGaterTracer is an optional interface for RawTracers, which is invoked when the payload
+// messages of a peer in a topic are dropped because the peer is throttled by the peer gater.
+// It is sampled to at most one invocation per peer per second.
+type PeerGaterTracer interface {
+	ThrottlePeerTopic(p peer.ID, topic string)
+}
+
 // WithPeerGater is a gossipsub router option that enables reactive validation queue
 // management.
 // The Gater is activated if the ratio of throttled/validated messages exceeds the specified
@@ -176,15 +257,10 @@ func WithPeerGater(params *PeerGaterParams) Option {
 		gs.gate = newPeerGater(ps.ctx, ps.host, params)
 
 		// hook the tracer
-		if ps.tracer != nil {
-			ps.tracer.raw = append(ps.tracer.raw, gs.gate)
-		} else {
-			ps.tracer = &pubsubTracer{
-				raw:   []RawTracer{gs.gate},
-				pid:   ps.host.ID(),
-				idGen: ps.idGen,
-			}
+		if ps.tracer == nil {
+			ps.tracer = &pubsubTracer{pid: ps.host.ID(), idGen: ps.idGen}
 		}
+		ps.tracer.addRaw(gs.gate)
 
 		return nil
 	}
@@ -192,17 +268,84 @@ func WithPeerGater(params *PeerGaterParams) Option {
 
 func newPeerGater(ctx context.Context, host host.Host, params *PeerGaterParams) *peerGater {
 	pg := &peerGater{
-		params:    params,
-		peerStats: make(map[peer.ID]*peerGaterStats),
-		ipStats:   make(map[string]*peerGaterStats),
-		host:      host,
+		peerStats:       make(map[peer.ID]*peerGaterStats),
+		ipStats:         make(map[string]*peerGaterStats),
+		decisions:       make(map[peer.ID]*peerGaterDecisions),
+		decayIntervalCh: make(chan time.Duration, 1),
+		host:            host,
 	}
-	go pg.background(ctx)
+	pg.setParams(params)
+	go pg.background(ctx, params.DecayInterval)
 	return pg
 }
 
-func (pg *peerGater) background(ctx context.Context) {
-	tick := time.NewTicker(pg.params.DecayInterval)
+// setParams replaces the gater parameters with a copy of the given ones.
+// The gater lock must be held if the gater is in use.
+func (pg *peerGater) setParams(params *PeerGaterParams) {
+	cp := *params
+	cp.TopicDeliveryWeights = make(map[string]float64, len(params.TopicDeliveryWeights))
+	for topic, w := range params.TopicDeliveryWeights {
+		cp.TopicDeliveryWeights[topic] = w
+	}
+	pg.params = &cp
+
+	pg.exempt = make(map[string]struct{}, len(params.ExemptTopics))
+	for _, topic := range params.ExemptTopics {
+		pg.exempt[topic] = struct{}{}
+	}
+
+	// the subnets have been validated
+	pg.perPeerSubnets, _ = parseSubnets(params.PerPeerSubnets)
+}
+
+// rekeyStats moves the connected peers to the stats of their current key, after the grouping
+// of statistics changed; the gater lock must be held
+func (pg *peerGater) rekeyStats() {
+	for p, st := range pg.peerStats {
+		key := pg.getStatsKey(p)
+		nst, ok := pg.ipStats[key]
+		if !ok {
+			nst = &peerGaterStats{}
+			pg.ipStats[key] = nst
+		}
+		if nst == st {
+			continue
+		}
+
+		st.connected--
+		if st.connected == 0 {
+			st.expire = time.Now().Add(pg.params.RetainStats)
+		}
+		nst.connected++
+		pg.peerStats[p] = nst
+	}
+}
+
+// updateParams validates and applies new parameters, which take effect atomically
+func (pg *peerGater) updateParams(params *PeerGaterParams) error {
+	if err := params.validate(); err != nil {
+		return err
+	}
+
+	pg.Lock()
+	decayInterval := pg.params.DecayInterval
+	pg.setParams(params)
+	pg.rekeyStats()
+	pg.Unlock()
+
+	if params.DecayInterval != decayInterval {
+		// replace any pending interval change
+		select {
+		case <-pg.decayIntervalCh:
+		default:
+		}
+		pg.decayIntervalCh <- params.DecayInterval
+	}
+	return nil
+}
+
+func (pg *peerGater) background(ctx context.Context, decayInterval time.Duration) {
+	tick := time.NewTicker(decayInterval)
 
 	defer tick.Stop()
 
@@ -210,6 +353,8 @@ func (pg *peerGater) background(ctx context.Context) {
 		select {
 		case <-tick.C:
 			pg.decayStats()
+		case d := <-pg.decayIntervalCh:
+			tick.Reset(d)
 		case <-ctx.Done():
 			return
 		}
@@ -268,15 +413,35 @@ func (pg *peerGater) getPeerStats(p peer.ID) *peerGaterStats {
 }
 
 func (pg *peerGater) getIPStats(p peer.ID) *peerGaterStats {
-	ip := pg.getPeerIP(p)
-	st, ok := pg.ipStats[ip]
+	key := pg.getStatsKey(p)
+	st, ok := pg.ipStats[key]
 	if !ok {
 		st = &peerGaterStats{}
-		pg.ipStats[ip] = st
+		pg.ipStats[key] = st
 	}
 	return st
 }
 
+// getStatsKey returns the key of the stats of a peer: its IP, unless it has separate stats
+func (pg *peerGater) getStatsKey(p peer.ID) string {
+	if pg.params.StatsKey == PeerGaterKeyPeer {
+		return "peer:" + p.String()
+	}
+
+	ip := pg.getPeerIP(p)
+	if len(pg.perPeerSubnets) > 0 {
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			addr = addr.Unmap()
+			for _, subnet := range pg.perPeerSubnets {
+				if subnet.Contains(addr) {
+					return "peer:" + p.String()
+				}
+			}
+		}
+	}
+	return ip
+}
+
 func (pg *peerGater) getPeerIP(p peer.ID) string {
 	if pg.getIP != nil {
 		return pg.getIP(p)
@@ -325,19 +490,42 @@ func (pg *peerGater) AcceptFrom(p peer.ID) AcceptStatus {
 	pg.Lock()
 	defer pg.Unlock()
 
+	status := pg.acceptFrom(p)
+
+	if d, ok := pg.decisions[p]; ok {
+		if status == AcceptAll {
+			d.accepted++
+		} else {
+			d.throttled++
+		}
+	}
+
+	return status
+}
+
+// active returns whether the gater is throttling; the gater lock must be held
+func (pg *peerGater) active() bool {
 	// check the quiet period; if the validation queue has not throttled for more than the Quiet
 	// interval, we turn off the circuit breaker and accept.
 	if time.Since(pg.lastThrottle) > pg.params.Quiet {
-		return AcceptAll
+		return false
 	}
 
 	// no throttle events -- or they have decayed; accept.
 	if pg.throttle == 0 {
-		return AcceptAll
+		return false
 	}
 
 	// check the throttle/validate ration; if it is below threshold we accept.
 	if pg.validate != 0 && pg.throttle/pg.validate < pg.params.Threshold {
+		return false
+	}
+
+	return true
+}
+
+func (pg *peerGater) acceptFrom(p peer.ID) AcceptStatus {
+	if !pg.active() {
 		return AcceptAll
 	}
 
@@ -362,6 +550,136 @@ func (pg *peerGater) AcceptFrom(p peer.ID) AcceptStatus {
 	return AcceptControl
 }
 
+// exemptTopic returns whether messages in the topic are never gated
+func (pg *peerGater) exemptTopic(topic string) bool {
+	if pg == nil {
+		return false
+	}
+
+	pg.Lock()
+	defer pg.Unlock()
+
+	_, ok := pg.exempt[topic]
+	return ok
+}
+
+// gatedMessage counts a payload message dropped while the peer is throttled, returning whether
+// it should be traced
+func (pg *peerGater) gatedMessage(p peer.ID) bool {
+	if pg == nil {
+		return false
+	}
+
+	pg.Lock()
+	defer pg.Unlock()
+
+	d, ok := pg.decisions[p]
+	if !ok {
+		return false
+	}
+
+	d.gated++
+	now := time.Now()
+	if now.Sub(d.lastTrace) < peerGaterTraceInterval {
+		return false
+	}
+	d.lastTrace = now
+	return true
+}
+
+// PeerGaterPeerStats are the statistics of a peer in the peer gater. The message counters are
+// those of the IP address of the peer, which are shared by all the peers in that IP.
+type PeerGaterPeerStats struct {
+	Deliver, Duplicate, Ignore, Reject float64
+	// Accepted and Throttled count the accept decisions for the peer
+	Accepted, Throttled uint64
+	// Gated counts the payload messages of the peer dropped while throttled
+	Gated uint64
+}
+
+// PeerGaterSnapshot is a snapshot of the state of the peer gater.
+type PeerGaterSnapshot struct {
+	// Active is whether the gater is currently throttling
+	Active bool
+	// Validate and Throttle are the decayed global counters of validated and throttled messages
+	Validate, Throttle float64
+	// Peers are the statistics of the connected peers
+	Peers map[peer.ID]PeerGaterPeerStats
+}
+
+func (pg *peerGater) snapshot() PeerGaterSnapshot {
+	pg.Lock()
+	defer pg.Unlock()
+
+	snap := PeerGaterSnapshot{
+		Active:   pg.active(),
+		Validate: pg.validate,
+		Throttle: pg.throttle,
+		Peers:    make(map[peer.ID]PeerGaterPeerStats, len(pg.peerStats)),
+	}
+	for p, st := range pg.peerStats {
+		ps := PeerGaterPeerStats{
+			Deliver:   st.deliver,
+			Duplicate: st.duplicate,
+			Ignore:    st.ignore,
+			Reject:    st.reject,
+		}
+		if d, ok := pg.decisions[p]; ok {
+			ps.Accepted = d.accepted
+			ps.Throttled = d.throttled
+			ps.Gated = d.gated
+		}
+		snap.Peers[p] = ps
+	}
+	return snap
+}
+
+// ErrNoPeerGater is returned when accessing the peer gater of a router without one.
+var ErrNoPeerGater = errors.New("peer gater is not enabled")
+
+// peerGater returns the peer gater of the router, if any
+func (p *PubSub) peerGater() (*peerGater, error) {
+	gs, ok := p.rt.(*GossipSubRouter)
+	if !ok || gs.gate == nil {
+		return nil, ErrNoPeerGater
+	}
+	return gs.gate, nil
+}
+
+// SetPeerGaterParams replaces the parameters of the peer gater at runtime, e.g. to loosen
+// throttling during incident response. The parameters are validated and take effect atomically;
+// the accumulated statistics are retained.
+func (p *PubSub) SetPeerGaterParams(params *PeerGaterParams) error {
+	pg, err := p.peerGater()
+	if err != nil {
+		return err
+	}
+	return pg.updateParams(params)
+}
+
+// PeerGaterParams returns a copy of the current parameters of the peer gater.
+func (p *PubSub) PeerGaterParams() (*PeerGaterParams, error) {
+	pg, err := p.peerGater()
+	if err != nil {
+		return nil, err
+	}
+
+	pg.Lock()
+	defer pg.Unlock()
+
+	params := *pg.params
+	return &params, nil
+}
+
+// PeerGaterSnapshot returns a snapshot of the state of the peer gater.
+func (p *PubSub) PeerGaterSnapshot() (PeerGaterSnapshot, error) {
+	pg, err := p.peerGater()
+	if err != nil {
+		return PeerGaterSnapshot{}, err
+	}
+	return pg.snapshot(), nil
+}
+
 // -- RawTracer interface methods
 var _ RawTracer = (*peerGater)(nil)
 
@@ -372,6 +690,8 @@ func (pg *peerGater) AddPeer(p peer.ID, proto protocol.ID) {
 
 	st := pg.getPeerStats(p)
 	st.connected++
+
+	pg.decisions[p] = &peerGaterDecisions{}
 }
 
 func (pg *peerGater) RemovePeer(p peer.ID) {
@@ -383,6 +703,7 @@ func (pg *peerGater) RemovePeer(p peer.ID) {
 	st.expire = time.Now().Add(pg.params.RetainStats)
 
 	delete(pg.peerStats, p)
+	delete(pg.decisions, p)
 }
 
 func (pg *peerGater) Join(topic string)             {}
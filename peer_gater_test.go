@@ -2,9 +2,12 @@ package pubsub
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
 	"github.com/libp2p/go-libp2p/core/peer"
 )
 
@@ -126,3 +129,264 @@ func TestPeerGater(t *testing.T) {
 		t.Fatal("still have a stat record for peerA's ip")
 	}
 }
+
+func TestPeerGaterUpdateParams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	peerA := peer.ID("A")
+
+	params := NewPeerGaterParams(.1, .9, .999).WithExemptTopics("critical")
+	pg := newPeerGater(ctx, nil, params)
+	pg.getIP = func(p peer.ID) string { return "1.2.3.4" }
+
+	pg.AddPeer(peerA, "")
+
+	// activate the gater with a peer that only sends invalid messages
+	msg := &Message{ReceivedFrom: peerA}
+	pg.ValidateMessage(msg)
+	pg.RejectMessage(msg, RejectValidationThrottled)
+	for i := 0; i < 100; i++ {
+		pg.RejectMessage(msg, RejectValidationFailed)
+	}
+
+	throttled := false
+	for i := 0; !throttled && i < 1000; i++ {
+		throttled = pg.AcceptFrom(peerA) == AcceptControl
+	}
+	if !throttled {
+		t.Fatal("expected AcceptControl")
+	}
+
+	if !pg.exemptTopic("critical") || pg.exemptTopic("other") {
+		t.Fatal("unexpected topic exemptions")
+	}
+
+	snap := pg.snapshot()
+	if !snap.Active {
+		t.Fatal("expected the gater to be active")
+	}
+	st := snap.Peers[peerA]
+	if st.Reject != 100 || st.Throttled == 0 {
+		t.Fatalf("unexpected peer stats: %+v", st)
+	}
+
+	// invalid parameters are refused
+	invalid := *params
+	invalid.Threshold = 0
+	if err := pg.updateParams(&invalid); err == nil {
+		t.Fatal("expected an error for invalid parameters")
+	}
+
+	// loosening the threshold deactivates the gater, keeping the stats
+	loose := *params
+	loose.Threshold = 10
+	loose.ExemptTopics = nil
+	if err := pg.updateParams(&loose); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if pg.AcceptFrom(peerA) != AcceptAll {
+			t.Fatal("expected AcceptAll")
+		}
+	}
+	if pg.exemptTopic("critical") {
+		t.Fatal("expected the exemption to be removed")
+	}
+
+	snap = pg.snapshot()
+	if snap.Active || snap.Peers[peerA].Reject != 100 || snap.Peers[peerA].Accepted < 100 {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+}
+
+func TestPeerGaterRuntimeAPI(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	gsubs := []*PubSub{
+		getGossipsub(ctx, hosts[0], WithPeerGater(DefaultPeerGaterParams())),
+		getGossipsub(ctx, hosts[1]),
+	}
+	fsub := getPubsub(ctx, hosts[2])
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(time.Millisecond * 100)
+
+	if err := fsub.SetPeerGaterParams(DefaultPeerGaterParams()); err != ErrNoPeerGater {
+		t.Fatalf("expected ErrNoPeerGater, got %v", err)
+	}
+	if _, err := gsubs[1].PeerGaterSnapshot(); err != ErrNoPeerGater {
+		t.Fatalf("expected ErrNoPeerGater, got %v", err)
+	}
+
+	params, err := gsubs[0].PeerGaterParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	params.Quiet = 2 * time.Minute
+	if err := gsubs[0].SetPeerGaterParams(params); err != nil {
+		t.Fatal(err)
+	}
+	params, err = gsubs[0].PeerGaterParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Quiet != 2*time.Minute {
+		t.Fatal("expected the parameters to be updated")
+	}
+
+	snap, err := gsubs[0].PeerGaterSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := snap.Peers[hosts[1].ID()]; !ok || snap.Active {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+}
+
+func TestPeerGaterStatsKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	good := []peer.ID{"good1", "good2", "good3"}
+	abusive := peer.ID("abusive")
+
+	// all the peers are behind the same NAT
+	params := NewPeerGaterParams(.1, .9, .999)
+	pg := newPeerGater(ctx, nil, params)
+	pg.getIP = func(p peer.ID) string { return "192.0.2.1" }
+
+	for _, p := range append(good, abusive) {
+		pg.AddPeer(p, "")
+	}
+
+	// activate the gater and let the peers build up their statistics
+	msg := &Message{ReceivedFrom: abusive}
+	pg.ValidateMessage(msg)
+	pg.RejectMessage(msg, RejectValidationThrottled)
+
+	feed := func() {
+		for i := 0; i < 100; i++ {
+			for _, p := range good {
+				pg.DeliverMessage(&Message{ReceivedFrom: p})
+			}
+			pg.RejectMessage(&Message{ReceivedFrom: abusive}, RejectValidationFailed)
+		}
+	}
+	feed()
+
+	throttledGood := func() bool {
+		for i := 0; i < 1000; i++ {
+			for _, p := range good {
+				if pg.AcceptFrom(p) != AcceptAll {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	throttledAbusive := func() bool {
+		for i := 0; i < 1000; i++ {
+			if pg.AcceptFrom(abusive) != AcceptAll {
+				return true
+			}
+		}
+		return false
+	}
+
+	// keyed by IP, the well-behaved peers share the statistics of the abusive peer
+	if !throttledGood() {
+		t.Fatal("expected the well-behaved peers to be throttled with per IP statistics")
+	}
+
+	for _, mode := range []*PeerGaterParams{
+		NewPeerGaterParams(.1, .9, .999).WithStatsKey(PeerGaterKeyPeer),
+		NewPeerGaterParams(.1, .9, .999).WithStatsKey(PeerGaterKeyIP, "192.0.2.0/24"),
+	} {
+		if err := pg.updateParams(mode); err != nil {
+			t.Fatal(err)
+		}
+		feed()
+
+		if throttledGood() {
+			t.Fatal("expected the well-behaved peers not to be throttled with per peer statistics")
+		}
+		if !throttledAbusive() {
+			t.Fatal("expected the abusive peer to be throttled with per peer statistics")
+		}
+	}
+
+	if err := pg.updateParams(NewPeerGaterParams(.1, .9, .999).WithStatsKey(PeerGaterKeyIP, "not a subnet")); err == nil {
+		t.Fatal("expected an error for an invalid subnet")
+	}
+}
+
+type peerGaterTracer struct {
+	noopRawTracer
+
+	mx        sync.Mutex
+	throttled map[string]int
+}
+
+func (t *peerGaterTracer) ThrottlePeerTopic(p peer.ID, topic string) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.throttled[topic]++
+}
+
+type collectingEventTracer struct {
+	mx     sync.Mutex
+	events []*pb.TraceEvent
+}
+
+func (t *collectingEventTracer) Trace(evt *pb.TraceEvent) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.events = append(t.events, evt)
+}
+
+func TestPeerGaterTracing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	peerA := peer.ID("A")
+
+	pg := newPeerGater(ctx, nil, NewPeerGaterParams(.1, .9, .999))
+	pg.getIP = func(p peer.ID) string { return "1.2.3.4" }
+	pg.AddPeer(peerA, "")
+
+	// gated messages are counted, but only traced once per interval
+	traced := 0
+	for i := 0; i < 10; i++ {
+		if pg.gatedMessage(peerA) {
+			traced++
+		}
+	}
+	if traced != 1 {
+		t.Fatalf("expected one sampled trace, got %d", traced)
+	}
+	if gated := pg.snapshot().Peers[peerA].Gated; gated != 10 {
+		t.Fatalf("expected 10 gated messages, got %d", gated)
+	}
+	if pg.gatedMessage(peer.ID("unknown")) {
+		t.Fatal("expected no trace for an unknown peer")
+	}
+
+	raw := &peerGaterTracer{throttled: make(map[string]int)}
+	evts := &collectingEventTracer{}
+	tr := &pubsubTracer{tracer: evts, pid: peer.ID("self"), clock: realClock{}}
+	tr.addRaw(raw)
+	tr.ThrottlePeerTopic(peerA, "test")
+
+	if raw.throttled["test"] != 1 {
+		t.Fatal("expected the raw tracer to be invoked")
+	}
+	if len(evts.events) != 1 {
+		t.Fatalf("expected one trace event, got %d", len(evts.events))
+	}
+	evt := evts.events[0]
+	if evt.GetType() != pb.TraceEvent_THROTTLE_PEER || peer.ID(evt.GetThrottlePeer().GetPeerID()) != peerA || evt.GetThrottlePeer().GetTopic() != "test" {
+		t.Fatalf("unexpected trace event: %s", evt)
+	}
+}
@@ -0,0 +1,266 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// BlacklistStore persists the entries of a PersistentBlacklist.
+// A zero expiry means that the entry never expires.
+type BlacklistStore interface {
+	// Put stores an entry, replacing any existing entry for the peer.
+	Put(p peer.ID, expiry time.Time) error
+	// Delete deletes the entry of a peer, if any.
+	Delete(p peer.ID) error
+	// Iterate invokes fn for every stored entry, stopping at the first error.
+	Iterate(fn func(p peer.ID, expiry time.Time) error) error
+}
+
+// PersistentBlacklist is a blacklist that writes its entries through to a BlacklistStore, so
+// that they survive restarts. It is safe for concurrent use.
+type PersistentBlacklist struct {
+	store BlacklistStore
+
+	mx      sync.RWMutex
+	entries map[peer.ID]time.Time
+}
+
+var _ RemovableBlacklist = (*PersistentBlacklist)(nil)
+var _ EnumerableBlacklist = (*PersistentBlacklist)(nil)
+var _ TTLBlacklist = (*PersistentBlacklist)(nil)
+
+// NewPersistentBlacklist creates a PersistentBlacklist with the entries of the store; the
+// expired entries are deleted from the store.
+func NewPersistentBlacklist(store BlacklistStore) (*PersistentBlacklist, error) {
+	b := &PersistentBlacklist{
+		store:   store,
+		entries: make(map[peer.ID]time.Time),
+	}
+
+	now := time.Now()
+	var expired []peer.ID
+	err := store.Iterate(func(p peer.ID, expiry time.Time) error {
+		if !expiry.IsZero() && expiry.Before(now) {
+			expired = append(expired, p)
+			return nil
+		}
+		b.entries[p] = expiry
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("loading blacklist: %w", err)
+	}
+
+	for _, p := range expired {
+		if err := store.Delete(p); err != nil {
+			return nil, fmt.Errorf("deleting expired blacklist entry: %w", err)
+		}
+	}
+
+	return b, nil
+}
+
+// Add blacklists a peer permanently.
+func (b *PersistentBlacklist) Add(p peer.ID) bool {
+	return b.put(p, time.Time{})
+}
+
+// AddWithTTL blacklists a peer for the given duration.
+func (b *PersistentBlacklist) AddWithTTL(p peer.ID, ttl time.Duration) bool {
+	return b.put(p, time.Now().Add(ttl))
+}
+
+func (b *PersistentBlacklist) put(p peer.ID, expiry time.Time) bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	// the peer is blacklisted in memory even if persisting fails
+	b.entries[p] = expiry
+	if err := b.store.Put(p, expiry); err != nil {
+		log.Warnf("error persisting blacklist entry for %s: %s", p, err)
+		return false
+	}
+	return true
+}
+
+// Contains returns whether a peer is blacklisted; its entry is deleted, from the store too, once
+// expired.
+func (b *PersistentBlacklist) Contains(p peer.ID) bool {
+	b.mx.RLock()
+	expiry, ok := b.entries[p]
+	b.mx.RUnlock()
+
+	if !ok {
+		return false
+	}
+	if expiry.IsZero() || !expiry.Before(time.Now()) {
+		return true
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.evictExpired([]peer.ID{p}, time.Now())
+	return false
+}
+
+func (b *PersistentBlacklist) Remove(p peer.ID) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	delete(b.entries, p)
+	if err := b.store.Delete(p); err != nil {
+		log.Warnf("error deleting blacklist entry for %s: %s", p, err)
+	}
+}
+
+// List returns the blacklisted peers, deleting the expired entries.
+func (b *PersistentBlacklist) List() []peer.ID {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	now := time.Now()
+	peers := make([]peer.ID, 0, len(b.entries))
+	var expired []peer.ID
+	for p, expiry := range b.entries {
+		if expiry.IsZero() || !expiry.Before(now) {
+			peers = append(peers, p)
+		} else {
+			expired = append(expired, p)
+		}
+	}
+	b.evictExpired(expired, now)
+	return peers
+}
+
+// evictExpired deletes the entries of the given peers which are expired at now, as they may have
+// been renewed meanwhile; the lock must be held
+func (b *PersistentBlacklist) evictExpired(peers []peer.ID, now time.Time) {
+	for _, p := range peers {
+		expiry, ok := b.entries[p]
+		if !ok || expiry.IsZero() || !expiry.Before(now) {
+			continue
+		}
+		delete(b.entries, p)
+		if err := b.store.Delete(p); err != nil {
+			log.Warnf("error deleting expired blacklist entry for %s: %s", p, err)
+		}
+	}
+}
+
+// FileBlacklistStore is a BlacklistStore that keeps its entries in a JSON file, which is
+// rewritten atomically on every change. It is meant as a reference implementation for small
+// blacklists.
+type FileBlacklistStore struct {
+	path string
+
+	mx      sync.Mutex
+	entries map[peer.ID]time.Time
+}
+
+var _ BlacklistStore = (*FileBlacklistStore)(nil)
+
+// NewFileBlacklistStore creates a FileBlacklistStore backed by the file at path, which is
+// created on the first change if it doesn't exist.
+func NewFileBlacklistStore(path string) (*FileBlacklistStore, error) {
+	s := &FileBlacklistStore{
+		path:    path,
+		entries: make(map[peer.ID]time.Time),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored map[string]time.Time
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("parsing blacklist file %s: %w", path, err)
+	}
+	for id, expiry := range stored {
+		p, err := peer.Decode(id)
+		if err != nil {
+			return nil, fmt.Errorf("parsing blacklist file %s: %w", path, err)
+		}
+		s.entries[p] = expiry
+	}
+
+	return s, nil
+}
+
+func (s *FileBlacklistStore) Put(p peer.ID, expiry time.Time) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.entries[p] = expiry
+	return s.write()
+}
+
+func (s *FileBlacklistStore) Delete(p peer.ID) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if _, ok := s.entries[p]; !ok {
+		return nil
+	}
+	delete(s.entries, p)
+	return s.write()
+}
+
+func (s *FileBlacklistStore) Iterate(fn func(p peer.ID, expiry time.Time) error) error {
+	s.mx.Lock()
+	entries := make(map[peer.ID]time.Time, len(s.entries))
+	for p, expiry := range s.entries {
+		entries[p] = expiry
+	}
+	s.mx.Unlock()
+
+	for p, expiry := range entries {
+		if err := fn(p, expiry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write replaces the file with the current entries
+func (s *FileBlacklistStore) write() error {
+	stored := make(map[string]time.Time, len(s.entries))
+	for p, expiry := range s.entries {
+		stored[p.String()] = expiry
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic replaces a file with data, through a temporary file so that readers never see
+// a partial write
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,170 @@
+package pubsub
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+func TestPersistentBlacklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blacklist.json")
+
+	store, err := NewFileBlacklistStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewPersistentBlacklist(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	permanent, expiring, removed := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	b.Add(permanent)
+	b.Add(removed)
+	b.AddWithTTL(expiring, 100*time.Millisecond)
+	b.Remove(removed)
+
+	if !b.Contains(permanent) || !b.Contains(expiring) || b.Contains(removed) {
+		t.Fatal("unexpected blacklist contents")
+	}
+
+	// the expired entries are deleted from the store once looked up
+	time.Sleep(200 * time.Millisecond)
+	if b.Contains(expiring) {
+		t.Fatal("expected the entry to expire")
+	}
+	stored := 0
+	store.Iterate(func(peer.ID, time.Time) error {
+		stored++
+		return nil
+	})
+	if stored != 1 {
+		t.Fatalf("expected the expired entry to be evicted from the store, got %d entries", stored)
+	}
+
+	// the entries survive a restart, except for the expired ones
+	b.AddWithTTL(expiring, 100*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+	store, err = NewFileBlacklistStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = NewPersistentBlacklist(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peers := b.List()
+	if len(peers) != 1 || peers[0] != permanent {
+		t.Fatalf("expected only the permanent entry to be loaded, got %v", peers)
+	}
+
+	stored = 0
+	store.Iterate(func(peer.ID, time.Time) error {
+		stored++
+		return nil
+	})
+	if stored != 1 {
+		t.Fatalf("expected the expired entry to be deleted from the store, got %d entries", stored)
+	}
+}
+
+func TestPersistentBlacklistPubSub(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "blacklist.json")
+	hosts := getNetHosts(t, ctx, 2)
+
+	store, err := NewFileBlacklistStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewPersistentBlacklist(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := getPubsub(ctx, hosts[0], WithBlacklist(b))
+	ps.BlacklistPeer(hosts[1].ID())
+
+	// a new instance loads the blacklisting
+	store, err = NewFileBlacklistStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = NewPersistentBlacklist(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Contains(hosts[1].ID()) {
+		t.Fatal("expected the blacklisting to be persisted")
+	}
+
+	if err := ps.UnblacklistPeer(hosts[1].ID()); err != nil {
+		t.Fatal(err)
+	}
+	store, err = NewFileBlacklistStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = NewPersistentBlacklist(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.List()) != 0 {
+		t.Fatal("expected the unblacklisting to be persisted")
+	}
+}
+
+func TestPersistentBlacklistTimed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "blacklist.json")
+	hosts := getNetHosts(t, ctx, 2)
+
+	store, err := NewFileBlacklistStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewPersistentBlacklist(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	psCtx, psCancel := context.WithCancel(ctx)
+	ps := getPubsub(psCtx, hosts[0], WithBlacklist(b))
+	ps.BlacklistPeerFor(hosts[1].ID(), time.Hour)
+	if remaining, _ := ps.BlacklistTimeRemaining(hosts[1].ID()); remaining <= 59*time.Minute {
+		t.Fatalf("expected the peer to be blacklisted for an hour, got %s", remaining)
+	}
+	psCancel()
+
+	// the timed blacklisting survives a restart, with its expiry
+	store, err = NewFileBlacklistStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expiry time.Time
+	store.Iterate(func(p peer.ID, e time.Time) error {
+		if p == hosts[1].ID() {
+			expiry = e
+		}
+		return nil
+	})
+	if remaining := time.Until(expiry); remaining <= 59*time.Minute || remaining > time.Hour {
+		t.Fatalf("expected the entry to expire in an hour, got %s", remaining)
+	}
+
+	b, err = NewPersistentBlacklist(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps = getPubsub(ctx, hosts[0], WithBlacklist(b))
+	if _, blacklisted := ps.BlacklistTimeRemaining(hosts[1].ID()); !blacklisted {
+		t.Fatal("expected the peer to be blacklisted after the restart")
+	}
+}
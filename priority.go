@@ -0,0 +1,201 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// The priority levels of the messages we publish, set with WithPriority.
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+// ErrPrioritiesDisabled is returned when publishing a message with a priority without
+// WithOutboundPriorities.
+var ErrPrioritiesDisabled = errors.New("outbound priorities are not enabled")
+
+// LowPriorityStarvationLimit is the number of RPCs of higher priority sent to a peer while its low
+// priority RPCs are waiting, after which one of them is sent anyway.
+var LowPriorityStarvationLimit = 16
+
+// WithPriority returns a publishing option setting the priority of the message in the outbound
+// queues of the peers: a high priority message is sent ahead of the normal priority RPCs already
+// waiting, which are sent ahead of the low priority ones; low priority RPCs are not starved, per
+// LowPriorityStarvationLimit. The priority is local: it isn't sent with the message, and it
+// applies whenever the router sends the message, the responses to IWANT requests included.
+// The messages of other peers we forward have the normal priority.
+// Priorities require WithOutboundPriorities; publishing fails with ErrPrioritiesDisabled otherwise.
+func WithPriority(level int) PubOpt {
+	return func(pub *PublishOptions) error {
+		if level < PriorityLow || level > PriorityHigh {
+			return fmt.Errorf("invalid message priority: %d", level)
+		}
+		pub.priority = level
+		return nil
+	}
+}
+
+// WithOutboundPriorities sets up high and low priority outbound queues for every peer, alongside
+// its normal queue, for the messages published WithPriority; a goroutine per peer hands its RPCs
+// to the writer in priority order. Without it, the RPCs are written in the order they're queued.
+func WithOutboundPriorities() Option {
+	return func(p *PubSub) error {
+		p.prioritized = true
+		return nil
+	}
+}
+
+// priority returns the priority of an RPC in the outbound queues, the highest priority of the
+// messages it carries
+func (rpc *RPC) priority() int {
+	if len(rpc.origins) == 0 {
+		return PriorityNormal
+	}
+	prio := PriorityLow
+	for _, msg := range rpc.origins {
+		prio = max(prio, msg.priority)
+	}
+	return prio
+}
+
+// outboundLanes are the high and low priority outbound queues of a peer, alongside its normal
+// priority queue in PubSub.peers
+type outboundLanes struct {
+	high chan *RPC
+	low  chan *RPC
+}
+
+// prioritize sets up the priority lanes of a peer with its normal outbound queue, returning the
+// queue of RPCs in priority order for the writer of the peer; the normal queue itself without
+// WithOutboundPriorities.
+// Only called from processLoop.
+func (p *PubSub) prioritize(pid peer.ID, messages chan *RPC) <-chan *RPC {
+	if !p.prioritized {
+		return messages
+	}
+
+	lanes := &outboundLanes{
+		high: make(chan *RPC, p.peerOutboundQueueSize),
+		low:  make(chan *RPC, p.peerOutboundQueueSize),
+	}
+	p.lanes[pid] = lanes
+
+	out := make(chan *RPC)
+	go p.scheduleOutbound(p.ctx, messages, lanes, out)
+	return out
+}
+
+// dropLanes discards the priority lanes of a peer gone, releasing the data of the RPCs left in
+// them.
+// Only called from processLoop.
+func (p *PubSub) dropLanes(pid peer.ID) {
+	lanes, ok := p.lanes[pid]
+	if !ok {
+		return
+	}
+	delete(p.lanes, pid)
+
+	for _, lane := range []chan *RPC{lanes.high, lanes.low} {
+	drain:
+		for {
+			select {
+			case rpc := <-lane:
+				p.dequeuedRPC(pid, rpc)
+			default:
+				break drain
+			}
+		}
+	}
+}
+
+// outboundBacklog returns the number of RPCs waiting in the outbound queue of a peer, across its
+// priority lanes; the writers take them one at a time, so this is its whole backlog.
+// Only called from processLoop.
+func (p *PubSub) outboundBacklog(pid peer.ID) int {
+	backlog := len(p.peers[pid])
+	if lanes, ok := p.lanes[pid]; ok {
+		backlog += len(lanes.high) + len(lanes.low)
+	}
+	return backlog
+}
+
+// outboundLane returns the outbound queue of a peer for an RPC of a given priority; messages is
+// the normal priority queue
+func (p *PubSub) outboundLane(pid peer.ID, messages chan *RPC, prio int) chan *RPC {
+	lanes, ok := p.lanes[pid]
+	if !ok {
+		return messages
+	}
+	switch prio {
+	case PriorityHigh:
+		return lanes.high
+	case PriorityLow:
+		return lanes.low
+	default:
+		return messages
+	}
+}
+
+// scheduleOutbound hands the RPCs of a peer to its writer in priority order, until its normal
+// priority queue is closed
+func (p *PubSub) scheduleOutbound(ctx context.Context, messages <-chan *RPC, lanes *outboundLanes, out chan<- *RPC) {
+	defer close(out)
+
+	// the RPCs sent while low priority RPCs are waiting
+	favoured := 0
+	for {
+		var rpc *RPC
+		ok, low := true, false
+
+		if favoured >= LowPriorityStarvationLimit {
+			select {
+			case rpc = <-lanes.low:
+				low = true
+			default:
+			}
+		}
+		if rpc == nil {
+			select {
+			case rpc = <-lanes.high:
+			default:
+				select {
+				case rpc, ok = <-messages:
+				default:
+					select {
+					case rpc = <-lanes.low:
+						low = true
+					default:
+						select {
+						case rpc = <-lanes.high:
+						case rpc, ok = <-messages:
+						case rpc = <-lanes.low:
+							low = true
+						case <-ctx.Done():
+							return
+						}
+					}
+				}
+			}
+		}
+		if !ok {
+			return
+		}
+
+		if low {
+			favoured = 0
+		} else if len(lanes.low) > 0 {
+			favoured++
+		}
+
+		select {
+		case out <- rpc:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
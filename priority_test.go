@@ -0,0 +1,257 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+func TestScheduleOutbound(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rpcOf := func(prio int, seq int) *RPC {
+		return &RPC{origins: []*Message{{priority: prio, seq: uint64(seq)}}}
+	}
+	messages := make(chan *RPC, 64)
+	lanes := &outboundLanes{high: make(chan *RPC, 64), low: make(chan *RPC, 64)}
+	for i := 0; i < 2*LowPriorityStarvationLimit; i++ {
+		messages <- rpcOf(PriorityNormal, i)
+	}
+	for i := 0; i < 2; i++ {
+		lanes.low <- rpcOf(PriorityLow, i)
+	}
+	for i := 0; i < 3; i++ {
+		lanes.high <- rpcOf(PriorityHigh, i)
+	}
+	close(messages)
+
+	out := make(chan *RPC)
+	go new(PubSub).scheduleOutbound(ctx, messages, lanes, out)
+
+	var order []int
+	for rpc := range out {
+		order = append(order, rpc.priority())
+	}
+
+	// the high priority RPCs first, then the normal ones with a low priority one every
+	// LowPriorityStarvationLimit RPCs; the last low priority RPC is dropped as the queue closes
+	var want []int
+	for i := 0; i < 3; i++ {
+		want = append(want, PriorityHigh)
+	}
+	for i := 0; i < LowPriorityStarvationLimit-3; i++ {
+		want = append(want, PriorityNormal)
+	}
+	want = append(want, PriorityLow)
+	for i := 0; i < LowPriorityStarvationLimit; i++ {
+		want = append(want, PriorityNormal)
+	}
+	want = append(want, PriorityLow)
+	for i := 0; i < 3; i++ {
+		want = append(want, PriorityNormal)
+	}
+	if len(order) != len(want) {
+		t.Fatalf("expected %d RPCs, got %d: %v", len(want), len(order), order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("expected the send order %v, got %v", want, order)
+		}
+	}
+}
+
+func TestPublishWithPriority(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0], WithOutboundPriorities())
+	topic, err := ps.Join("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eval := func(f func()) {
+		done := make(chan struct{})
+		ps.eval <- func() {
+			f()
+			close(done)
+		}
+		<-done
+	}
+
+	// a peer with bulk RPCs waiting in its queue
+	pid := peer.ID("peer")
+	var out <-chan *RPC
+	eval(func() {
+		messages := make(chan *RPC, 16)
+		ps.peers[pid] = messages
+		out = ps.prioritize(pid, messages)
+		ps.topics["test"] = map[peer.ID]struct{}{pid: {}}
+		for i := 0; i < 3; i++ {
+			messages <- rpcWithMessages(&pb.Message{Data: []byte("bulk")})
+		}
+	})
+	// the scheduler holds the first bulk RPC until the writer is ready
+	time.Sleep(10 * time.Millisecond)
+
+	if err := topic.Publish(ctx, []byte("low"), WithPriority(PriorityLow)); err != nil {
+		t.Fatal(err)
+	}
+	if err := topic.Publish(ctx, []byte("urgent"), WithPriority(PriorityHigh)); err != nil {
+		t.Fatal(err)
+	}
+	// wait for the messages to be routed
+	var queued int
+	for start := time.Now(); queued < 2 && time.Since(start) < time.Second; {
+		time.Sleep(10 * time.Millisecond)
+		eval(func() { queued = len(ps.lanes[pid].high) + len(ps.lanes[pid].low) })
+	}
+
+	var order []string
+	want := []string{"bulk", "urgent", "bulk", "bulk", "low"}
+	for range want {
+		select {
+		case rpc := <-out:
+			order = append(order, string(rpc.Publish[0].Data))
+		case <-time.After(time.Second):
+			t.Fatalf("expected %d RPCs, got %v", len(want), order)
+		}
+	}
+	for i, data := range want {
+		if order[i] != data {
+			t.Fatalf("expected the urgent message ahead of the bulk ones and the low priority one last, got %v", order)
+		}
+	}
+
+	if err := topic.Publish(ctx, []byte("invalid"), WithPriority(2)); err == nil {
+		t.Fatal("expected an error for an invalid priority")
+	}
+}
+
+func TestIWantKeepsPriority(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pid := peer.ID("peer")
+	ps, gs, eval := chokeTestRouter(t, ctx, DefaultGossipSubParams(), map[peer.ID]protocol.ID{
+		pid: GossipSubID_v11,
+	})
+	ps.prioritized = true
+	topic, err := ps.Join("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := topic.Publish(ctx, []byte("urgent"), WithPriority(PriorityHigh)); err != nil {
+		t.Fatal(err)
+	}
+
+	var mids []string
+	for start := time.Now(); len(mids) == 0 && time.Since(start) < time.Second; {
+		time.Sleep(10 * time.Millisecond)
+		eval(func() { mids = gs.mcache.GetGossipIDs("test") })
+	}
+	if len(mids) != 1 {
+		t.Fatalf("expected the message in the cache, got %d", len(mids))
+	}
+
+	// the response to the IWANT for our message goes in the high priority lane
+	eval(func() {
+		drainRPCs(ps)
+		lanes := &outboundLanes{high: make(chan *RPC, 8), low: make(chan *RPC, 8)}
+		ps.lanes[pid] = lanes
+		gs.HandleRPC(&RPC{RPC: pb.RPC{Control: &pb.ControlMessage{Iwant: []*pb.ControlIWant{{MessageIDs: mids}}}}, from: pid})
+		if len(lanes.high) != 1 || len(ps.peers[pid]) != 0 {
+			t.Errorf("expected the response in the high priority lane, got %d and %d RPCs queued", len(lanes.high), len(ps.peers[pid]))
+		}
+	})
+
+	// and it keeps its priority when split off an oversized RPC
+	out := appendOrMergeRPC(nil, 128, RPC{
+		RPC:     pb.RPC{Publish: []*pb.Message{{Data: make([]byte, 100)}, {Data: make([]byte, 100)}}},
+		origins: []*Message{{}, {priority: PriorityHigh}},
+	})
+	if len(out) != 2 || out[0].priority() != PriorityNormal || out[1].priority() != PriorityHigh {
+		t.Fatalf("expected the split RPCs to keep the priority of their messages, got %d RPCs", len(out))
+	}
+}
+
+func TestPrioritiesDisabled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ps := getPubsub(ctx, getNetHosts(t, ctx, 1)[0])
+	topic, err := ps.Join("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := topic.Publish(ctx, []byte("urgent"), WithPriority(PriorityHigh)); !errors.Is(err, ErrPrioritiesDisabled) {
+		t.Fatalf("expected ErrPrioritiesDisabled, got %v", err)
+	}
+	if err := topic.Publish(ctx, []byte("normal"), WithPriority(PriorityNormal)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the writers of the peers take their RPCs straight from their queue
+	pid := peer.ID("peer")
+	done := make(chan struct{})
+	ps.eval <- func() {
+		defer close(done)
+		messages := make(chan *RPC, 8)
+		if out := ps.prioritize(pid, messages); out != (<-chan *RPC)(messages) {
+			t.Error("expected the queue of the peer without priorities")
+		}
+		if _, ok := ps.lanes[pid]; ok {
+			t.Error("expected no lanes without priorities")
+		}
+	}
+	<-done
+}
+
+func TestLanesDroppedOnStreamFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0], WithOutboundPriorities())
+
+	eval := func(f func()) {
+		done := make(chan struct{})
+		ps.eval <- func() {
+			f()
+			close(done)
+		}
+		<-done
+	}
+
+	pid := peer.ID("peer")
+	eval(func() {
+		messages := make(chan *RPC, 8)
+		ps.peers[pid] = messages
+		ps.stats.addPeer(pid)
+		ps.prioritize(pid, messages)
+	})
+	ps.newPeerError <- pid
+
+	eval(func() {
+		if _, ok := ps.lanes[pid]; ok {
+			t.Error("expected the lanes of the peer to be dropped")
+		}
+		if _, ok := ps.peers[pid]; ok {
+			t.Error("expected the peer to be dropped")
+		}
+	})
+	ps.stats.mx.RLock()
+	_, ok := ps.stats.peerQueues[pid]
+	ps.stats.mx.RUnlock()
+	if ok {
+		t.Fatal("expected the queue stats of the peer to be dropped")
+	}
+}
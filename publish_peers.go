@@ -0,0 +1,77 @@
+package pubsub
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// publishPeers are the recipients of the messages published in a topic, cached between changes
+// of its mesh, fanout and members, so that publishing doesn't walk all the subscribers
+type publishPeers struct {
+	// peers are the direct peers in the topic and the mesh or fanout peers, except the mesh
+	// peers which choked us
+	peers []peer.ID
+	// flood are the floodsub peers in the topic, filtered by score as a message is published
+	flood []peer.ID
+	// refill is set when the fanout is empty, to look for peers again at the next publish
+	refill bool
+}
+
+// getPublishPeers returns the recipients of the messages published in a topic by other peers,
+// picking fanout peers if we haven't joined it.
+// Only called from processLoop.
+func (gs *GossipSubRouter) getPublishPeers(topic string, tmap map[peer.ID]struct{}) *publishPeers {
+	pp, ok := gs.publishPeers[topic]
+	if ok && !pp.refill {
+		return pp
+	}
+
+	gmap, joined := gs.mesh[topic]
+	if !joined {
+		gmap, ok = gs.fanout[topic]
+		if !ok || len(gmap) == 0 {
+			// we don't have any, pick some with score above the publish threshold
+			peers := gs.getFanoutPeers(topic, gs.params.D, func(p peer.ID) bool {
+				_, direct := gs.direct[p]
+				return !direct && gs.score.Score(p) >= gs.topicPublishThreshold(topic)
+			}, gs.score.Score)
+
+			if len(peers) > 0 {
+				gmap = peerListToMap(peers)
+				gs.fanout[topic] = gmap
+			}
+		}
+	}
+
+	if pp == nil {
+		pp = new(publishPeers)
+		gs.publishPeers[topic] = pp
+	}
+	pp.peers = pp.peers[:0]
+	pp.flood = pp.flood[:0]
+	pp.refill = !joined && len(gmap) == 0
+
+	for p := range gs.direct {
+		if _, inTopic := tmap[p]; inTopic {
+			pp.peers = append(pp.peers, p)
+		}
+	}
+	for p := range gmap {
+		if _, direct := gs.direct[p]; !direct && !gs.isLazy(topic, p) {
+			pp.peers = append(pp.peers, p)
+		}
+	}
+	for _, p := range gs.topicCandidates(topic) {
+		_, direct := gs.direct[p]
+		if !direct && !gs.feature(GossipSubFeatureMesh, gs.peers[p]) {
+			pp.flood = append(pp.flood, p)
+		}
+	}
+
+	return pp
+}
+
+// meshChanged drops the cached recipients of the messages published in a topic, as its mesh,
+// fanout or members change
+func (gs *GossipSubRouter) meshChanged(topic string) {
+	delete(gs.publishPeers, topic)
+}
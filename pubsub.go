@@ -1,6 +1,7 @@
 package pubsub
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"errors"
@@ -38,6 +39,16 @@ var (
 	// ErrSubscriptionCancelled may be returned when a subscription Next() is called after the
 	// subscription has been cancelled.
 	ErrSubscriptionCancelled = errors.New("subscription cancelled")
+
+	// ErrTopicExists is returned by Join when a Topic handle already exists for the topic.
+	ErrTopicExists = errors.New("topic already exists")
+
+	// ErrTopicNotAllowed is returned when joining a topic rejected by the subscription filter.
+	ErrTopicNotAllowed = errors.New("topic is not allowed by the subscription filter")
+
+	// ErrTopicInUse is returned when closing a Topic which still has event handlers,
+	// subscriptions or relays.
+	ErrTopicInUse = errors.New("cannot close topic: outstanding event handlers or subscriptions")
 )
 
 var log = logging.Logger("pubsub")
@@ -69,6 +80,56 @@ type PubSub struct {
 	// topics.
 	maxMessageSize int
 
+	// rpcLimits bounds the inbound RPCs of each peer
+	rpcLimits RPCLimits
+
+	// writeTimeout is the deadline for writing an RPC to a peer, and maxWriteTimeouts the
+	// number of consecutive expirations before the peer is declared dead
+	writeTimeout     time.Duration
+	maxWriteTimeouts int
+
+	// bidi matches the bidirectional streams with their writers, if enabled
+	bidi *bidiStreams
+
+	// compression is the compressed protocol variant, if enabled
+	compression *rpcCompression
+
+	// controlStreams splits off the control messages to a second stream, if enabled
+	controlStreams bool
+
+	// the delivery goroutines of the topics, if enabled with WithTopicDelivery
+	deliveryQueueSize int
+	deliveryMaxWait   time.Duration
+	deliveries        map[string]*topicDelivery
+
+	// the event loop instrumentation, and the queue depth beyond which it sheds work if set
+	loopStats eventLoopStats
+	shedDepth int
+
+	// the runtime counters returned by Stats
+	stats *pubsubStats
+	// the rates of the unique messages returned by Throughput
+	throughput *throughputStats
+
+	// the application middleware applied to the RPCs sent and received
+	outboundHooks, inboundHooks []RPCHook
+
+	// the events dropped by the tracers, over the windows of the health checks
+	tracerDrops dropWindow
+
+	// noPooling disables the reuse of received RPCs and buffers
+	noPooling bool
+
+	// ingress are the queues of the ingress workers, if enabled
+	ingressWorkers int
+	ingress        []chan *RPC
+
+	// bandwidth is the traffic accounting of the peers with a stream
+	bandwidthMx sync.Mutex
+	bandwidth   map[peer.ID]*peerBandwidth
+	// peerOutboundCap is the cap on the bytes per second sent to each peer; 0 if uncapped
+	peerOutboundCap int
+
 	// size of the outbound message channel that we maintain for each peer
 	peerOutboundQueueSize int
 
@@ -84,6 +145,9 @@ type PubSub struct {
 	// rmRelay is a relay cancellation channel
 	rmRelay chan string
 
+	// disallowTopics is a channel for topics that the subscription filter no longer allows
+	disallowTopics chan []string
+
 	// get list of topics we are subscribed to
 	getTopics chan *topicReq
 
@@ -106,7 +170,7 @@ type PubSub struct {
 	newPeersPend   map[peer.ID]struct{}
 
 	// a notification channel for new outoging peer streams
-	newPeerStream chan network.Stream
+	newPeerStream chan peerStream
 
 	// a notification channel for errors opening new peer streams
 	newPeerError chan peer.ID
@@ -119,6 +183,11 @@ type PubSub struct {
 	// backoff for retrying new connections to dead peers
 	deadPeerBackoff *backoff
 
+	// parameters of the dead peer backoff
+	streamBackoffBase     time.Duration
+	streamBackoffMax      time.Duration
+	streamBackoffAttempts int
+
 	// The set of topics we are subscribed to
 	mySubs map[string]map[*Subscription]struct{}
 
@@ -134,6 +203,23 @@ type PubSub struct {
 	// sendMsg handles messages that have been validated
 	sendMsg chan *Message
 
+	// ordering applies the validation results in arrival order; nil without strict peer
+	// ordering
+	ordering *peerOrdering
+
+	// announceWindow is the window over which the subscription changes are batched; the
+	// pending announcements are in announcing, indexed by topic in pendingAnnounces, and
+	// greeted are the peers that got our subscriptions in the hello packets since, with the
+	// number of pending announcements they already reflect, the last of which is greetedMark
+	announceWindow   time.Duration
+	announcing       []*pb.RPC_SubOpts
+	pendingAnnounces map[string]int
+	greeted          map[peer.ID]int
+	greetedMark      int
+
+	// localMeta tracks the local metadata of the delivered messages; nil unless enabled
+	localMeta *localMetadataTracker
+
 	// addVal handles validator registration requests
 	addVal chan *addValReq
 
@@ -146,21 +232,83 @@ type PubSub struct {
 	// peer blacklist
 	blacklist     Blacklist
 	blacklistPeer chan peer.ID
+	// timedBlacklist holds the peers blacklisted with BlacklistPeerFor
+	timedBlacklist *TimeCachedBlacklist
+	// ipBlockList holds the blocked subnets, if any
+	ipBlockList *IPBlockList
+	// autoBlacklist evaluates the auto blacklist rules, if any
+	autoBlacklist *autoBlacklister
+
+	// dupStats tracks the duplicate messages per peer and topic, if enabled
+	dupStats *duplicateStats
+	// allowlist holds the peers allowed to establish pubsub streams, if restricted
+	allowlist *peerAllowlist
+	// blacklistEvts holds the channels of blacklist events
+	blacklistEvts blacklistEventSubs
+
+	// limits on the subscriptions announced by peers
+	subLimits *subscriptionLimiter
 
 	peers map[peer.ID]chan *RPC
 
+	// lanes are the priority outbound queues of the peers, alongside their queue in peers; only
+	// set up with WithOutboundPriorities
+	lanes       map[peer.ID]*outboundLanes
+	prioritized bool
+
+	// capabilities are the protocols and features negotiated with the peers we have a stream to
+	capabilities map[peer.ID]*PeerCapabilities
+
 	inboundStreamsMx sync.Mutex
 	inboundStreams   map[peer.ID]network.Stream
 
 	seenMessages    timecache.TimeCache
 	seenMsgTTL      time.Duration
 	seenMsgStrategy timecache.Strategy
+	// seenTopicTTLs overrides seenMsgTTL per topic
+	seenTopicTTLs map[string]time.Duration
+	// seenMsgMaxEntries bounds the seen messages cache; 0 is unbounded
+	seenMsgMaxEntries int
+	// seenCache is an external seen messages cache set with WithSeenMessagesCache
+	seenCache SeenCache
+	// seenSnapshotPath is the file the seen messages cache is saved to on shutdown, if any
+	seenSnapshotPath string
 
 	// generator used to compute the ID for a message
 	idGen *msgIDGenerator
 
+	// per topic settings of joined topics that are read outside the event loop
+	topicOptsMx   sync.RWMutex
+	security      map[string]MessageSecurity
+	signPolicies  map[string]MessageSignaturePolicy
+	replayFilters map[string]*replayFilter
+	allowLists    map[string]*topicAllowList
+	// validationDeadlines are the validation deadlines of the messages of the topics
+	validationDeadlines map[string]time.Duration
+
+	peerEvtHandlersMx sync.RWMutex
+	peerEvtHandlers   map[*PeerEventHandler]struct{}
+
+	// source of time; the system clock unless overridden with WithClock
+	clock Clock
+
+	// tracks delivery receipts for locally published messages
+	receipts *receiptTracker
+	// watches the propagation of the messages published in the watched topics
+	watches *watchTracker
+
 	// key for signing messages; nil when signing is disabled
 	signKey crypto.PrivKey
+	// custom signer used instead of signKey; nil unless set with WithCustomSigner
+	signer MessageSigner
+
+	// resolver for the keys of authors that can't be extracted from messages; nil unless set
+	// with WithAuthorKeyResolver
+	resolveAuthorKey AuthorKeyResolver
+	keyResolver      *authorKeyResolver
+
+	// whether the embedded key is stripped from forwarded messages
+	stripForwardedKeys bool
 	// source ID for signed messages; corresponds to signKey, empty when signing is disabled.
 	// If empty, the author and seq-nr are completely omitted from the messages.
 	signID peer.ID
@@ -170,16 +318,22 @@ type PubSub struct {
 	// filter for tracking subscriptions in topics of interest; if nil, then we track all subscriptions
 	subFilter SubscriptionFilter
 
+	// bypassFilters is the number of joined topics that bypass the filter; only accessed from
+	// the processLoop
+	bypassFilters int
+
+	// counters of the subscriptions dropped by the filter and the subscription limits
+	subsFiltered, subsFilterErrors, subsLimitExceeded atomic.Uint64
+
 	// protoMatchFunc is a matching function for protocol selection.
 	protoMatchFunc ProtocolMatchFn
 
 	ctx context.Context
 
-	// appSpecificRpcInspector is an auxiliary that may be set by the application to inspect incoming RPCs prior to
-	// processing them. The inspector is invoked on an accepted RPC right prior to handling it.
-	// The return value of the inspector function is an error indicating whether the RPC should be processed or not.
-	// If the error is nil, the RPC is processed as usual. If the error is non-nil, the RPC is dropped.
-	appSpecificRpcInspector func(peer.ID, *RPC) error
+	// rpcInspector inspects the inbound RPCs right after decoding, and rpcInspectorPenalty is
+	// the behaviour penalty of the RPCs it drops
+	rpcInspector        func(peer.ID, *RPC) error
+	rpcInspectorPenalty int
 }
 
 // PubSubRouter is the message router component of PubSub.
@@ -232,6 +386,59 @@ type Message struct {
 	ReceivedFrom  peer.ID
 	ValidatorData interface{}
 	Local         bool
+
+	// the sealed message as seen on the wire, for topics with MessageSecurity
+	wire *pb.Message
+
+	// the wire bytes of the message as received, reused when forwarding it unaltered
+	raw []byte
+
+	// the ID function the ID was computed with
+	idFn *msgIDFn
+
+	// the arrival time in the validation pipeline, and the values of the context of a local
+	// message given with WithValidationContext
+	arrival time.Time
+	values  context.Context
+
+	// the arrival order of the message among the messages of its peer and topic, with strict
+	// peer ordering; 0 if not sequenced
+	seq uint64
+
+	// the local metadata of the message, with WithLocalMetadata
+	meta *LocalMetadata
+
+	// the priority of the message in the outbound queues, for the messages we publish
+	priority int
+}
+
+// copyMessage returns a deep copy of a message, leaving the validator data shared
+func copyMessage(msg *Message) *Message {
+	res := new(Message)
+	*res = *msg
+	if msg.Message != nil {
+		res.Message = copyPbMessage(msg.Message)
+	}
+	if msg.wire != nil {
+		res.wire = copyPbMessage(msg.wire)
+	}
+	return res
+}
+
+func copyPbMessage(msg *pb.Message) *pb.Message {
+	res := new(pb.Message)
+	*res = *msg
+	res.From = bytes.Clone(msg.From)
+	res.Data = bytes.Clone(msg.Data)
+	res.Seqno = bytes.Clone(msg.Seqno)
+	res.Signature = bytes.Clone(msg.Signature)
+	res.Key = bytes.Clone(msg.Key)
+	if msg.Topic != nil {
+		topic := *msg.Topic
+		res.Topic = &topic
+	}
+	res.XXX_unrecognized = bytes.Clone(msg.XXX_unrecognized)
+	return res
 }
 
 func (m *Message) GetFrom() peer.ID {
@@ -243,6 +450,25 @@ type RPC struct {
 
 	// unexported on purpose, not sending this over the wire
 	from peer.ID
+
+	// the checks of the payload messages by the ingress workers, if enabled
+	checks []ingressCheck
+
+	// the wire bytes of the payload messages, as received or to be forwarded
+	wire *wirePublish
+	// the received payload messages listing several topics on the wire
+	multiTopic []*pb.Message
+
+	// the messages the payload messages are forwarded from, to reuse their cached IDs
+	origins []*Message
+
+	// the marshaled form shared by the peers the RPC is sent to, and the control messages
+	// piggybacked after it for a single peer
+	frame *sharedFrame
+	extra *pb.RPC
+
+	// the breakdown by topic of the RPC, once in an outbound queue
+	loads []queueLoad
 }
 
 type Option func(*PubSub) error
@@ -254,9 +480,12 @@ func NewPubSub(ctx context.Context, h host.Host, rt PubSubRouter, opts ...Option
 		ctx:                   ctx,
 		rt:                    rt,
 		val:                   newValidation(),
+		stats:                 newPubSubStats(),
+		throughput:            newThroughputStats(),
 		peerFilter:            DefaultPeerFilter,
 		disc:                  &discover{},
 		maxMessageSize:        DefaultMaxMessageSize,
+		announceWindow:        DefaultAnnounceWindow,
 		peerOutboundQueueSize: 32,
 		signID:                h.ID(),
 		signKey:               nil,
@@ -264,16 +493,16 @@ func NewPubSub(ctx context.Context, h host.Host, rt PubSubRouter, opts ...Option
 		incoming:              make(chan *RPC, 32),
 		newPeers:              make(chan struct{}, 1),
 		newPeersPend:          make(map[peer.ID]struct{}),
-		newPeerStream:         make(chan network.Stream),
+		newPeerStream:         make(chan peerStream),
 		newPeerError:          make(chan peer.ID),
 		peerDead:              make(chan struct{}, 1),
 		peerDeadPend:          make(map[peer.ID]struct{}),
-		deadPeerBackoff:       newBackoff(ctx, 1000, BackoffCleanupInterval, MaxBackoffAttempts),
 		cancelCh:              make(chan *Subscription),
 		getPeers:              make(chan *listPeerReq),
 		addSub:                make(chan *addSubReq),
 		addRelay:              make(chan *addRelayReq),
 		rmRelay:               make(chan string),
+		disallowTopics:        make(chan []string),
 		addTopic:              make(chan *addTopicReq),
 		rmTopic:               make(chan *rmTopicReq),
 		getTopics:             make(chan *topicReq),
@@ -283,16 +512,31 @@ func NewPubSub(ctx context.Context, h host.Host, rt PubSubRouter, opts ...Option
 		eval:                  make(chan func()),
 		myTopics:              make(map[string]*Topic),
 		mySubs:                make(map[string]map[*Subscription]struct{}),
+		deliveries:            make(map[string]*topicDelivery),
 		myRelays:              make(map[string]int),
 		topics:                make(map[string]map[peer.ID]struct{}),
 		peers:                 make(map[peer.ID]chan *RPC),
+		lanes:                 make(map[peer.ID]*outboundLanes),
+		capabilities:          make(map[peer.ID]*PeerCapabilities),
 		inboundStreams:        make(map[peer.ID]network.Stream),
+		bandwidth:             make(map[peer.ID]*peerBandwidth),
+		peerEvtHandlers:       make(map[*PeerEventHandler]struct{}),
+		security:              make(map[string]MessageSecurity),
+		signPolicies:          make(map[string]MessageSignaturePolicy),
+		replayFilters:         make(map[string]*replayFilter),
+		allowLists:            make(map[string]*topicAllowList),
+		validationDeadlines:   make(map[string]time.Duration),
 		blacklist:             NewMapBlacklist(),
 		blacklistPeer:         make(chan peer.ID),
 		seenMsgTTL:            TimeCacheDuration,
 		seenMsgStrategy:       TimeCacheStrategy,
 		idGen:                 newMsgIdGenerator(),
+		clock:                 realClock{},
+		subLimits:             newSubscriptionLimiter(),
 		counter:               uint64(time.Now().UnixNano()),
+		streamBackoffBase:     MinBackoffDelay,
+		streamBackoffMax:      MaxBackoffDelay,
+		streamBackoffAttempts: MaxBackoffAttempts,
 	}
 
 	for _, opt := range opts {
@@ -306,23 +550,72 @@ func NewPubSub(ctx context.Context, h host.Host, rt PubSubRouter, opts ...Option
 		if ps.signID == "" {
 			return nil, fmt.Errorf("strict signature usage enabled but message author was disabled")
 		}
-		ps.signKey = ps.host.Peerstore().PrivKey(ps.signID)
-		if ps.signKey == nil {
-			return nil, fmt.Errorf("can't sign for peer %s: no private key", ps.signID)
+		if ps.signer != nil {
+			if !ps.signID.MatchesPublicKey(ps.signer.PublicKey()) {
+				return nil, fmt.Errorf("custom signer key doesn't match message author %s", ps.signID)
+			}
+		} else {
+			ps.signKey = ps.host.Peerstore().PrivKey(ps.signID)
+			if ps.signKey == nil {
+				return nil, fmt.Errorf("can't sign for peer %s: no private key", ps.signID)
+			}
 		}
 	}
 
-	ps.seenMessages = timecache.NewTimeCacheWithStrategy(ps.seenMsgStrategy, ps.seenMsgTTL)
+	ps.subLimits.clock = ps.clock
+	ps.timedBlacklist = newTimeCachedBlacklist(0, ps.clock.Now)
+	ps.blacklistEvts.subs = make(map[chan BlacklistEvent]struct{})
+	ps.timedBlacklist.OnExpire(ps.notifyBlacklistExpired)
+	if tb, ok := ps.blacklist.(*TimeCachedBlacklist); ok {
+		tb.OnExpire(ps.notifyBlacklistExpired)
+	}
+	if ps.seenCache != nil {
+		ps.seenMessages = &externalSeenCache{c: ps.seenCache, ttl: ps.seenMsgTTL}
+	} else if len(ps.seenTopicTTLs) > 0 || ps.seenMsgMaxEntries > 0 {
+		ps.seenMessages = timecache.NewCappedCache(ps.seenMsgStrategy, ps.seenMsgTTL, ps.seenMsgMaxEntries, ps.clock.Now)
+	} else {
+		ps.seenMessages = timecache.NewTimeCacheWithClock(ps.seenMsgStrategy, ps.seenMsgTTL, ps.clock.Now)
+	}
+	if ps.seenSnapshotPath != "" {
+		ps.restoreSeenMessages()
+	}
+	if ps.resolveAuthorKey != nil {
+		ps.keyResolver = newAuthorKeyResolver(ps.resolveAuthorKey, ps.clock)
+	}
+	ps.deadPeerBackoff = newBackoff(ctx, 1000, BackoffCleanupInterval, ps.streamBackoffBase, ps.streamBackoffMax, ps.streamBackoffAttempts, ps.clock)
+
+	ps.receipts = newReceiptTracker(ps.idGen, ps.clock)
+	if ps.tracer == nil {
+		ps.tracer = &pubsubTracer{pid: ps.host.ID(), idGen: ps.idGen}
+	}
+	ps.watches = newWatchTracker(ps.idGen, ps.tracer, ps.clock)
+	if ps.autoBlacklist != nil {
+		ps.tracer.addRaw(ps.autoBlacklist)
+	}
+	if ps.dupStats != nil {
+		ps.tracer.addRaw(ps.dupStats)
+	}
+	ps.tracer.clock = ps.clock
 
 	if err := ps.disc.Start(ps); err != nil {
 		return nil, err
 	}
 
+	ps.startIngressWorkers()
 	rt.Attach(ps)
 
-	for _, id := range rt.Protocols() {
+	protos := ps.streamProtocols(ps.bidi != nil)
+	if ps.controlStreams {
+		protos = append(protos, ps.controlProtocols()...)
+	}
+	for _, id := range protos {
 		if ps.protoMatchFunc != nil {
-			h.SetStreamHandlerMatch(id, ps.protoMatchFunc(id), ps.handleNewStream)
+			rid := routerProtocol(id)
+			match := ps.protoMatchFunc(rid)
+			if rid != id {
+				match = variantMatchFunc(string(id[len(rid):]), match)
+			}
+			h.SetStreamHandlerMatch(id, match, ps.handleNewStream)
 		} else {
 			h.SetStreamHandler(id, ps.handleNewStream)
 		}
@@ -330,6 +623,12 @@ func NewPubSub(ctx context.Context, h host.Host, rt PubSubRouter, opts ...Option
 	h.Network().Notify((*PubSubNotif)(ps))
 
 	ps.val.Start(ps)
+	if ps.autoBlacklist != nil {
+		ps.autoBlacklist.Start(ctx, ps)
+	}
+	if ps.dupStats != nil {
+		ps.dupStats.Start(ctx, ps)
+	}
 
 	go ps.processLoop(ctx)
 
@@ -347,7 +646,7 @@ type MsgIdFunction func(pmsg *pb.Message) string
 // but it can be customized to e.g. the hash of the message.
 func WithMessageIdFn(fn MsgIdFunction) Option {
 	return func(p *PubSub) error {
-		p.idGen.Default = fn
+		p.idGen.SetDefault(fn)
 		return nil
 	}
 }
@@ -379,6 +678,21 @@ func WithPeerOutboundQueueSize(size int) Option {
 	}
 }
 
+// WithWriteTimeout sets a deadline on every RPC written to a peer, so that a peer that stops reading
+// doesn't wedge its writer. The write is resumed after an expiration; once the peer hasn't read
+// anything for maxTimeouts consecutive deadlines, the stream is reset and the peer is declared
+// dead. A timeout of 0, the default, disables the deadlines.
+func WithWriteTimeout(timeout time.Duration, maxTimeouts int) Option {
+	return func(p *PubSub) error {
+		if timeout < 0 || (timeout > 0 && maxTimeouts <= 0) {
+			return fmt.Errorf("invalid write timeout: %s with %d timeouts", timeout, maxTimeouts)
+		}
+		p.writeTimeout = timeout
+		p.maxWriteTimeouts = maxTimeouts
+		return nil
+	}
+}
+
 // WithMessageSignaturePolicy sets the mode of operation for producing and verifying message signatures.
 func WithMessageSignaturePolicy(policy MessageSignaturePolicy) Option {
 	return func(p *PubSub) error {
@@ -415,6 +729,26 @@ func WithMessageAuthor(author peer.ID) Option {
 	}
 }
 
+// WithCustomSigner signs outbound messages with the given signer instead of the private key
+// of the author, which then doesn't need to be in the host's peerstore. The message author is
+// set to the peer ID of the signer's public key; the public key is embedded in messages if it
+// can't be derived from the peer ID.
+// The signer is invoked on the publishing goroutine, and signing errors are returned by Publish.
+func WithCustomSigner(signer MessageSigner) Option {
+	return func(p *PubSub) error {
+		if signer == nil {
+			return fmt.Errorf("nil message signer")
+		}
+		pid, err := peer.IDFromPublicKey(signer.PublicKey())
+		if err != nil {
+			return fmt.Errorf("invalid signer public key: %w", err)
+		}
+		p.signer = signer
+		p.signID = pid
+		return nil
+	}
+}
+
 // WithNoAuthor omits the author and seq-number data of messages, and disables the use of signatures.
 // Not recommended to use with the default message ID function, see WithMessageIdFn.
 func WithNoAuthor() Option {
@@ -452,7 +786,10 @@ func WithBlacklist(b Blacklist) Option {
 // WithDiscovery provides a discovery mechanism used to bootstrap and provide peers into PubSub
 func WithDiscovery(d discovery.Discovery, opts ...DiscoverOpt) Option {
 	return func(p *PubSub) error {
-		discoverOpts := defaultDiscoverOptions()
+		discoverOpts := p.disc.options
+		if discoverOpts == nil {
+			discoverOpts = defaultDiscoverOptions()
+		}
 		for _, opt := range opts {
 			err := opt(discoverOpts)
 			if err != nil {
@@ -460,7 +797,7 @@ func WithDiscovery(d discovery.Discovery, opts ...DiscoverOpt) Option {
 			}
 		}
 
-		p.disc.discovery = &pubSubDiscovery{Discovery: d, opts: discoverOpts.opts}
+		p.disc.discovery = &pubSubDiscovery{Discovery: d, options: discoverOpts}
 		p.disc.options = discoverOpts
 		return nil
 	}
@@ -482,11 +819,10 @@ func WithEventTracer(tracer EventTracer) Option {
 // Multiple tracers can be added using multiple invocations of the option.
 func WithRawTracer(tracer RawTracer) Option {
 	return func(p *PubSub) error {
-		if p.tracer != nil {
-			p.tracer.raw = append(p.tracer.raw, tracer)
-		} else {
-			p.tracer = &pubsubTracer{raw: []RawTracer{tracer}, pid: p.host.ID(), idGen: p.idGen}
+		if p.tracer == nil {
+			p.tracer = &pubsubTracer{pid: p.host.ID(), idGen: p.idGen}
 		}
+		p.tracer.addRaw(tracer)
 		return nil
 	}
 }
@@ -519,6 +855,15 @@ func WithMaxMessageSize(maxMessageSize int) Option {
 	}
 }
 
+// WithClock sets the clock used by pubsub for its timers and timestamps.
+// This is mostly useful for deterministic testing; the default is the system clock.
+func WithClock(c Clock) Option {
+	return func(ps *PubSub) error {
+		ps.clock = c
+		return nil
+	}
+}
+
 // WithProtocolMatchFn sets a custom matching function for protocol selection to
 // be used by the protocol handler on the Host's Mux. Should be combined with
 // WithGossipSubProtocols feature function for checking if certain protocol features
@@ -538,25 +883,60 @@ func WithSeenMessagesTTL(ttl time.Duration) Option {
 	}
 }
 
-// WithSeenMessagesStrategy configures which type of lookup/cleanup strategy is used by the seen messages cache
+// WithSeenMessagesStrategy configures which type of lookup/cleanup strategy is used by the seen messages cache.
+// With timecache.Strategy_FirstSeen, a message replayed more slowly than the seen messages TTL is
+// delivered again on every replay; timecache.Strategy_LastSeen suppresses such replays, as each
+// duplicate extends the lifetime of the entry, but retains the IDs of replayed messages for as long
+// as the replays go on.
 func WithSeenMessagesStrategy(strategy timecache.Strategy) Option {
 	return func(ps *PubSub) error {
+		switch strategy {
+		case timecache.Strategy_FirstSeen, timecache.Strategy_LastSeen:
+		default:
+			return fmt.Errorf("unknown seen messages strategy: %d", strategy)
+		}
 		ps.seenMsgStrategy = strategy
 		return nil
 	}
 }
 
-// WithAppSpecificRpcInspector sets a hook that inspect incomings RPCs prior to
-// processing them.  The inspector is invoked on an accepted RPC just before it
-// is handled.  If inspector's error is nil, the RPC is handled. Otherwise, it
-// is dropped.
-func WithAppSpecificRpcInspector(inspector func(peer.ID, *RPC) error) Option {
+// WithSeenMessagesTopicTTL configures when a previously seen message ID in the given topic can be
+// forgotten about, in place of the TTL set with WithSeenMessagesTTL.
+func WithSeenMessagesTopicTTL(topic string, ttl time.Duration) Option {
 	return func(ps *PubSub) error {
-		ps.appSpecificRpcInspector = inspector
+		if ttl <= 0 {
+			return fmt.Errorf("invalid seen messages TTL for topic %s: %s", topic, ttl)
+		}
+		if ps.seenTopicTTLs == nil {
+			ps.seenTopicTTLs = make(map[string]time.Duration)
+		}
+		ps.seenTopicTTLs[topic] = ttl
+		return nil
+	}
+}
+
+// WithSeenMessagesMaxEntries bounds the number of message IDs in the seen messages cache, so that
+// its memory use stays bounded during floods; the least recently seen IDs are evicted first
+// when full, which may let their messages be accepted again as new.
+func WithSeenMessagesMaxEntries(n int) Option {
+	return func(ps *PubSub) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid seen messages cache size: %d", n)
+		}
+		ps.seenMsgMaxEntries = n
 		return nil
 	}
 }
 
+// WithAppSpecificRpcInspector sets a hook that inspect incomings RPCs prior to
+// processing them. If inspector's error is nil, the RPC is handled. Otherwise, it
+// is dropped. The RPC must not be retained, see WithoutPooling.
+//
+// Deprecated: use WithAppSpecificRPCInspector, which this option now calls.
+func WithAppSpecificRpcInspector(inspector func(peer.ID, *RPC) error) Option {
+	return WithAppSpecificRPCInspector(inspector)
+}
+
 // processLoop handles all inputs arriving on the channels
 func (p *PubSub) processLoop(ctx context.Context) {
 	defer func() {
@@ -566,7 +946,17 @@ func (p *PubSub) processLoop(ctx context.Context) {
 		}
 		p.peers = nil
 		p.topics = nil
+		if p.seenSnapshotPath != "" {
+			p.saveSeenMessages()
+		}
 		p.seenMessages.Done()
+		if p.keyResolver != nil {
+			p.keyResolver.failed.Done()
+		}
+		p.timedBlacklist.tc.Done()
+		if f, ok := p.subFilter.(attachableSubscriptionFilter); ok {
+			f.detach(p)
+		}
 	}()
 
 	for {
@@ -574,7 +964,8 @@ func (p *PubSub) processLoop(ctx context.Context) {
 		case <-p.newPeers:
 			p.handlePendingPeers()
 
-		case s := <-p.newPeerStream:
+		case ps := <-p.newPeerStream:
+			s := ps.s
 			pid := s.Conn().RemotePeer()
 
 			ch, ok := p.peers[pid]
@@ -584,18 +975,30 @@ func (p *PubSub) processLoop(ctx context.Context) {
 				continue
 			}
 
-			if p.blacklist.Contains(pid) {
+			if p.isBlacklisted(pid) {
 				log.Warn("closing stream for blacklisted peer: ", pid)
 				close(ch)
 				delete(p.peers, pid)
+				p.dropLanes(pid)
+				p.stats.removePeer(pid)
 				s.Reset()
+				p.notifyPeerDetached(pid, DetachBlacklisted)
 				continue
 			}
 
-			p.rt.AddPeer(pid, s.Protocol())
+			p.rt.AddPeer(pid, routerProtocol(s.Protocol()))
+			p.recordCapabilities(pid, ps)
+			p.notifyPeerAttached(pid, routerProtocol(s.Protocol()))
 
 		case pid := <-p.newPeerError:
+			// the scheduler of the outbound queue stops once it is closed
+			if ch, ok := p.peers[pid]; ok {
+				close(ch)
+			}
 			delete(p.peers, pid)
+			p.dropLanes(pid)
+			p.stats.removePeer(pid)
+			p.notifyPeerDetached(pid, DetachStreamFailed)
 
 		case <-p.peerDead:
 			p.handleDeadPeers()
@@ -618,6 +1021,8 @@ func (p *PubSub) processLoop(ctx context.Context) {
 			p.handleAddRelay(relay)
 		case topic := <-p.rmRelay:
 			p.handleRemoveRelay(topic)
+		case topics := <-p.disallowTopics:
+			p.handleDisallowTopics(topics)
 		case preq := <-p.getPeers:
 			tmap, ok := p.topics[preq.topic]
 			if preq.topic != "" && !ok {
@@ -636,10 +1041,15 @@ func (p *PubSub) processLoop(ctx context.Context) {
 			}
 			preq.resp <- peers
 		case rpc := <-p.incoming:
+			start := p.beginEvent()
 			p.handleIncomingRPC(rpc)
+			p.releaseRPC(rpc)
+			p.endEvent(EventRPC, start)
 
 		case msg := <-p.sendMsg:
+			start := p.beginEvent()
 			p.publishMessage(msg)
+			p.endEvent(EventPublish, start)
 
 		case req := <-p.addVal:
 			p.val.AddValidator(req)
@@ -648,24 +1058,16 @@ func (p *PubSub) processLoop(ctx context.Context) {
 			p.val.RemoveValidator(req)
 
 		case thunk := <-p.eval:
+			start := p.beginEvent()
 			thunk()
+			p.endEvent(EventEval, start)
 
 		case pid := <-p.blacklistPeer:
 			log.Infof("Blacklisting peer %s", pid)
-			p.blacklist.Add(pid)
-
-			ch, ok := p.peers[pid]
-			if ok {
-				close(ch)
-				delete(p.peers, pid)
-				for t, tmap := range p.topics {
-					if _, ok := tmap[pid]; ok {
-						delete(tmap, pid)
-						p.notifyLeave(t, pid)
-					}
-				}
-				p.rt.RemovePeer(pid)
+			if p.blacklist.Add(pid) {
+				p.notifyBlacklistEvent(BlacklistEvent{Type: PeerBlacklisted, Peer: pid, Reason: BlacklistReasonManual})
 			}
+			p.detachBlacklistedPeer(pid)
 
 		case <-ctx.Done():
 			log.Info("pubsub processloop shutting down")
@@ -674,6 +1076,109 @@ func (p *PubSub) processLoop(ctx context.Context) {
 	}
 }
 
+// detachBlacklistedPeer removes a peer that was just blacklisted.
+// Only called from processLoop.
+func (p *PubSub) detachBlacklistedPeer(pid peer.ID) {
+	p.detachPeer(pid, DetachBlacklisted)
+}
+
+// detachPeer removes an attached peer that is no longer accepted.
+// Only called from processLoop.
+func (p *PubSub) detachPeer(pid peer.ID, reason PeerDetachReason) {
+	ch, ok := p.peers[pid]
+	if !ok {
+		return
+	}
+
+	close(ch)
+	delete(p.peers, pid)
+	p.dropLanes(pid)
+	delete(p.capabilities, pid)
+	for t, tmap := range p.topics {
+		if _, ok := tmap[pid]; ok {
+			delete(tmap, pid)
+			p.notifyLeave(t, pid)
+		}
+	}
+	p.rt.RemovePeer(pid)
+	p.subLimits.RemovePeer(pid)
+	p.stats.removePeer(pid)
+	p.notifyPeerDetached(pid, reason)
+}
+
+// handleBlacklistPeerFor blacklists a peer for the given duration, after which the peer is
+// attached again if it is still connected.
+// Only called from processLoop.
+func (p *PubSub) handleBlacklistPeerFor(pid peer.ID, d time.Duration, reason string) {
+	log.Infof("Blacklisting peer %s for %s", pid, d)
+	p.timedBlacklist.AddWithTTL(pid, d)
+	expiry, _ := p.timedBlacklist.tc.Expiry(pid.String())
+	if tb, ok := p.blacklist.(TTLBlacklist); ok {
+		tb.AddWithTTL(pid, expiry.Sub(p.clock.Now()))
+	}
+	p.notifyBlacklistEvent(BlacklistEvent{Type: PeerBlacklisted, Peer: pid, Reason: reason, Expiry: expiry})
+	p.detachBlacklistedPeer(pid)
+
+	go func() {
+		// the entry is still valid at its expiry, so wait until just past it
+		select {
+		case <-p.clock.After(d + time.Nanosecond):
+		case <-p.ctx.Done():
+			return
+		}
+
+		// notice the expiry now rather than on the next background sweep
+		p.timedBlacklist.sweep()
+
+		// the entry may have been extended in the meantime; the pending peer is ignored then
+		(*PubSubNotif)(p).addPendingPeer(pid)
+	}()
+}
+
+// notifyBlacklistExpired is the expiry callback of the time cached blacklists
+func (p *PubSub) notifyBlacklistExpired(pid peer.ID) {
+	p.notifyBlacklistEvent(BlacklistEvent{Type: PeerBlacklistExpired, Peer: pid, Reason: BlacklistReasonExpired})
+}
+
+// handleUnblacklistPeer removes a peer from the blacklists.
+// Only called from processLoop.
+func (p *PubSub) handleUnblacklistPeer(pid peer.ID, opts unblacklistOptions) error {
+	blacklisted := p.isBlacklisted(pid)
+	if p.blacklist.Contains(pid) {
+		rb, ok := p.blacklist.(RemovableBlacklist)
+		if !ok {
+			return ErrBlacklistNotRemovable
+		}
+		rb.Remove(pid)
+	}
+	p.timedBlacklist.Remove(pid)
+
+	if blacklisted {
+		p.notifyBlacklistEvent(BlacklistEvent{Type: PeerUnblacklisted, Peer: pid, Reason: BlacklistReasonRemoved})
+	}
+
+	log.Infof("Unblacklisting peer %s", pid)
+	if opts.clearState {
+		p.subLimits.Ungraylist(pid)
+		if cr, ok := p.rt.(peerStateRouter); ok {
+			cr.clearPeerState(pid)
+		}
+	}
+
+	go (*PubSubNotif)(p).addPendingPeer(pid)
+	return nil
+}
+
+// peerStateRouter is implemented by routers that retain state for disconnected peers
+type peerStateRouter interface {
+	clearPeerState(p peer.ID)
+}
+
+// isBlacklisted returns whether the peer is in the blacklist or the timed blacklist
+func (p *PubSub) isBlacklisted(pid peer.ID) bool {
+	return p.blacklist.Contains(pid) || p.timedBlacklist.Contains(pid)
+}
+
 func (p *PubSub) handlePendingPeers() {
 	p.newPeersPrioLk.Lock()
 
@@ -696,14 +1201,22 @@ func (p *PubSub) handlePendingPeers() {
 			continue
 		}
 
-		if p.blacklist.Contains(pid) {
+		if p.isBlacklisted(pid) {
 			log.Warn("ignoring connection from blacklisted peer: ", pid)
 			continue
 		}
 
+		if p.denyPeer(pid) {
+			continue
+		}
+
+		// a new connection gives the peer a fresh backoff
+		p.deadPeerBackoff.reset(pid)
+
 		messages := make(chan *RPC, p.peerOutboundQueueSize)
-		messages <- p.getHelloPacket()
-		go p.handleNewPeer(p.ctx, pid, messages)
+		p.stats.addPeer(pid)
+		p.sendHelloPackets(pid, messages)
+		go p.handleNewPeer(p.ctx, pid, p.prioritize(pid, messages))
 		p.peers[pid] = messages
 	}
 }
@@ -728,6 +1241,8 @@ func (p *PubSub) handleDeadPeers() {
 
 		close(ch)
 		delete(p.peers, pid)
+		p.dropLanes(pid)
+		delete(p.capabilities, pid)
 
 		for t, tmap := range p.topics {
 			if _, ok := tmap[pid]; ok {
@@ -737,10 +1252,14 @@ func (p *PubSub) handleDeadPeers() {
 		}
 
 		p.rt.RemovePeer(pid)
+		p.subLimits.RemovePeer(pid)
+		p.stats.removePeer(pid)
+		p.notifyPeerDetached(pid, DetachPeerDead)
 
 		if p.host.Network().Connectedness(pid) == network.Connected {
 			backoffDelay, err := p.deadPeerBackoff.updateAndGet(pid)
 			if err != nil {
+				// leave the peer dead until it connects again
 				log.Debug(err)
 				continue
 			}
@@ -749,9 +1268,10 @@ func (p *PubSub) handleDeadPeers() {
 			// we respawn the writer as we need to ensure there is a stream active
 			log.Debugf("peer declared dead but still connected; respawning writer: %s", pid)
 			messages := make(chan *RPC, p.peerOutboundQueueSize)
-			messages <- p.getHelloPacket()
+			p.stats.addPeer(pid)
+			p.sendHelloPackets(pid, messages)
 			p.peers[pid] = messages
-			go p.handleNewPeerWithBackoff(p.ctx, pid, backoffDelay, messages)
+			go p.handleNewPeerWithBackoff(p.ctx, pid, backoffDelay, p.prioritize(pid, messages))
 		}
 	}
 }
@@ -769,6 +1289,31 @@ func (p *PubSub) handleAddTopic(req *addTopicReq) {
 	}
 
 	p.myTopics[topicID] = topic
+	p.stats.topic(topicID)
+	if topic.security != nil {
+		p.setTopicSecurity(topicID, topic.security)
+	}
+	if topic.signPolicy != nil {
+		p.setTopicSignPolicy(topicID, topic.signPolicy)
+	}
+	if topic.replay != nil {
+		p.setTopicReplayFilter(topicID, topic.replay)
+	}
+	if topic.allowList != nil {
+		p.setTopicAllowList(topicID, topic.allowList)
+	}
+	if topic.tracer != (topicTracer{}) {
+		p.tracer.setTopicTracer(topicID, topic.tracer)
+	}
+	if topic.validationDeadline > 0 {
+		p.setTopicValidationDeadline(topicID, topic.validationDeadline)
+	}
+	if topic.bypassFilter {
+		p.bypassFilters++
+	}
+	if topic.autoJoin != nil {
+		p.startAutoJoin(topic)
+	}
 	req.resp <- topic
 }
 
@@ -782,15 +1327,31 @@ func (p *PubSub) handleRemoveTopic(req *rmTopicReq) {
 		return
 	}
 
-	if len(topic.evtHandlers) == 0 &&
+	if topic.eventHandlers() == 0 &&
 		len(p.mySubs[req.topic.topic]) == 0 &&
-		p.myRelays[req.topic.topic] == 0 {
+		p.myRelays[req.topic.topic] == p.autoJoinRelays(req.topic.topic) {
+		if topic.autoJoin != nil {
+			p.stopAutoJoin(topic)
+		}
 		delete(p.myTopics, topic.topic)
+		p.stats.removeTopic(topic.topic)
+		p.throughput.removeTopic(topic.topic)
+		p.setTopicSecurity(topic.topic, nil)
+		p.setTopicSignPolicy(topic.topic, nil)
+		p.setTopicReplayFilter(topic.topic, nil)
+		p.setTopicAllowList(topic.topic, nil)
+		p.setTopicValidationDeadline(topic.topic, 0)
+		if topic.tracer != (topicTracer{}) {
+			p.tracer.setTopicTracer(topic.topic, topicTracer{})
+		}
+		if topic.bypassFilter {
+			p.bypassFilters--
+		}
 		req.resp <- nil
 		return
 	}
 
-	req.resp <- fmt.Errorf("cannot close topic: outstanding event handlers or subscriptions")
+	req.resp <- ErrTopicInUse
 }
 
 // handleRemoveSubscription removes Subscription sub from bookeeping.
@@ -805,11 +1366,12 @@ func (p *PubSub) handleRemoveSubscription(sub *Subscription) {
 	}
 
 	sub.err = ErrSubscriptionCancelled
-	sub.close()
+	p.closeSubscription(sub)
 	delete(subs, sub)
 
 	if len(subs) == 0 {
 		delete(p.mySubs, sub.topic)
+		p.stopDelivery(sub.topic)
 
 		// stop announcing only if there are no more subs and relays
 		if p.myRelays[sub.topic] == 0 {
@@ -843,6 +1405,7 @@ func (p *PubSub) handleAddSubscription(req *addSubReq) {
 	sub.cancelCh = p.cancelCh
 
 	p.mySubs[sub.topic][sub] = struct{}{}
+	p.addDeliverySubscription(sub)
 
 	req.resp <- sub
 }
@@ -854,14 +1417,7 @@ func (p *PubSub) handleAddSubscription(req *addSubReq) {
 func (p *PubSub) handleAddRelay(req *addRelayReq) {
 	topic := req.topic
 
-	p.myRelays[topic]++
-
-	// announce we want this topic if neither relays nor subs exist so far
-	if p.myRelays[topic] == 1 && len(p.mySubs[topic]) == 0 {
-		p.disc.Advertise(topic)
-		p.announce(topic, true)
-		p.rt.Join(topic)
-	}
+	p.addRelayRef(topic)
 
 	// flag used to prevent calling cancel function multiple times
 	isCancelled := false
@@ -881,6 +1437,20 @@ func (p *PubSub) handleAddRelay(req *addRelayReq) {
 	req.resp <- relayCancelFunc
 }
 
+// addRelayRef adds a relay reference to a topic, announcing that this node relays for the topic
+// if it is the first relay and no subscriptions exist.
+// Only called from processLoop.
+func (p *PubSub) addRelayRef(topic string) {
+	p.myRelays[topic]++
+
+	// announce we want this topic if neither relays nor subs exist so far
+	if p.myRelays[topic] == 1 && len(p.mySubs[topic]) == 0 {
+		p.disc.Advertise(topic)
+		p.announce(topic, true)
+		p.rt.Join(topic)
+	}
+}
+
 // handleRemoveRelay removes one relay reference from bookkeeping.
 // If this was the last relay reference and no more subscriptions exist
 // for a given topic, it will also announce that this node is not relaying
@@ -905,38 +1475,143 @@ func (p *PubSub) handleRemoveRelay(topic string) {
 	}
 }
 
+// handleDisallowTopics drops the local and remote subscriptions of topics that the
+// subscription filter no longer allows.
+// Only called from processLoop.
+func (p *PubSub) handleDisallowTopics(topics []string) {
+	for _, topic := range topics {
+		// the topic may have been allowed again in the meantime
+		if p.subFilter == nil || p.subFilter.CanSubscribe(topic) || p.bypassesFilter(topic) {
+			continue
+		}
+
+		subs := p.mySubs[topic]
+		announced := len(subs) > 0 || p.myRelays[topic] > 0
+		for sub := range subs {
+			sub.err = ErrSubscriptionDisallowed
+			p.closeSubscription(sub)
+		}
+		delete(p.mySubs, topic)
+		p.stopDelivery(topic)
+		delete(p.myRelays, topic)
+
+		if announced {
+			p.disc.StopAdvertise(topic)
+			p.announce(topic, false)
+			p.rt.Leave(topic)
+		}
+
+		for pid := range p.topics[topic] {
+			p.subLimits.Unsubscribe(pid)
+			p.notifyLeave(topic, pid)
+		}
+		delete(p.topics, topic)
+	}
+}
+
 // announce announces whether or not this node is interested in a given topic
 // Only called from processLoop.
 func (p *PubSub) announce(topic string, sub bool) {
+	if p.pendingAnnounces == nil {
+		p.pendingAnnounces = make(map[string]int)
+	}
 	subopt := &pb.RPC_SubOpts{
 		Topicid:   &topic,
 		Subscribe: &sub,
 	}
+	// the announcements already reflected in hello packets are kept for the other peers
+	if i, ok := p.pendingAnnounces[topic]; ok && i >= p.greetedMark {
+		p.announcing[i] = subopt
+	} else {
+		p.pendingAnnounces[topic] = len(p.announcing)
+		p.announcing = append(p.announcing, subopt)
+	}
+
+	if p.announceWindow <= 0 {
+		p.flushAnnounces()
+		return
+	}
+	if len(p.announcing) == 1 {
+		flush := p.clock.After(p.announceWindow)
+		go func() {
+			select {
+			case <-flush:
+			case <-p.ctx.Done():
+				return
+			}
+			select {
+			case p.eval <- p.flushAnnounces:
+			case <-p.ctx.Done():
+			}
+		}()
+	}
+}
+
+// flushAnnounces sends the subscription changes announced since the last flush to all peers, in
+// as few RPCs as the message size limit allows.
+// Only called from processLoop.
+func (p *PubSub) flushAnnounces() {
+	subs := p.announcing
+	if len(subs) == 0 {
+		return
+	}
+	// the last announcement of each topic, for the peers not greeted since
+	latest := make([]*pb.RPC_SubOpts, 0, len(p.pendingAnnounces))
+	for i, sub := range subs {
+		if p.pendingAnnounces[sub.GetTopicid()] == i {
+			latest = append(latest, sub)
+		}
+	}
+	p.announcing = nil
+	clear(p.pendingAnnounces)
+	greeted := p.greeted
+	p.greeted = nil
+	p.greetedMark = 0
 
-	out := rpcWithSubs(subopt)
 	for pid, peer := range p.peers {
-		select {
-		case peer <- out:
+		if mark, ok := greeted[pid]; ok {
+			// the greeted peers only miss the changes made since their hello packets
+			if mark < len(subs) {
+				p.sendAnnounces(pid, peer, subs[mark:])
+			}
+			continue
+		}
+		p.sendAnnounces(pid, peer, latest)
+	}
+}
+
+// sendAnnounces sends subscription changes to a peer, scheduling a retry if its queue is full
+func (p *PubSub) sendAnnounces(pid peer.ID, peer chan *RPC, subs []*pb.RPC_SubOpts) {
+	for _, out := range p.subscriptionRPCs(subs) {
+		if p.enqueueRPC(pid, peer, out) {
 			p.tracer.SendRPC(out, pid)
-		default:
+		} else {
 			log.Infof("Can't send announce message to peer %s: queue full; scheduling retry", pid)
+			p.stats.outboundDropped(pid)
 			p.tracer.DropRPC(out, pid)
-			go p.announceRetry(pid, topic, sub)
+			go p.announceRetry(pid, out.Subscriptions)
 		}
 	}
 }
 
-func (p *PubSub) announceRetry(pid peer.ID, topic string, sub bool) {
+func (p *PubSub) announceRetry(pid peer.ID, subs []*pb.RPC_SubOpts) {
 	time.Sleep(time.Duration(1+rand.Intn(1000)) * time.Millisecond)
 
 	retry := func() {
-		_, okSubs := p.mySubs[topic]
-		_, okRelays := p.myRelays[topic]
+		// only retry the announcements that still hold
+		var current []*pb.RPC_SubOpts
+		for _, subopt := range subs {
+			_, okSubs := p.mySubs[subopt.GetTopicid()]
+			_, okRelays := p.myRelays[subopt.GetTopicid()]
 
-		ok := okSubs || okRelays
+			ok := okSubs || okRelays
 
-		if (ok && sub) || (!ok && !sub) {
-			p.doAnnounceRetry(pid, topic, sub)
+			if ok == subopt.GetSubscribe() {
+				current = append(current, subopt)
+			}
+		}
+		if len(current) > 0 {
+			p.doAnnounceRetry(pid, current)
 		}
 	}
 
@@ -946,51 +1621,76 @@ func (p *PubSub) announceRetry(pid peer.ID, topic string, sub bool) {
 	}
 }
 
-func (p *PubSub) doAnnounceRetry(pid peer.ID, topic string, sub bool) {
+func (p *PubSub) doAnnounceRetry(pid peer.ID, subs []*pb.RPC_SubOpts) {
 	peer, ok := p.peers[pid]
 	if !ok {
 		return
 	}
 
-	subopt := &pb.RPC_SubOpts{
-		Topicid:   &topic,
-		Subscribe: &sub,
-	}
-
-	out := rpcWithSubs(subopt)
-	select {
-	case peer <- out:
-		p.tracer.SendRPC(out, pid)
-	default:
-		log.Infof("Can't send announce message to peer %s: queue full; scheduling retry", pid)
-		p.tracer.DropRPC(out, pid)
-		go p.announceRetry(pid, topic, sub)
-	}
+	p.sendAnnounces(pid, peer, subs)
 }
 
 // notifySubs sends a given message to all corresponding subscribers.
 // Only called from processLoop.
 func (p *PubSub) notifySubs(msg *Message) {
 	topic := msg.GetTopic()
+	if td, ok := p.deliveries[topic]; ok {
+		td.deliver(msg)
+		return
+	}
+
 	subs := p.mySubs[topic]
 	for f := range subs {
-		select {
-		case f.ch <- msg:
-		default:
+		if !p.offerMessage(f, msg) {
+			p.stats.subscriptionQueueFull.Add(1)
 			p.tracer.UndeliverableMessage(msg)
 			log.Infof("Can't deliver message to subscription for topic %s; subscriber too slow", topic)
 		}
 	}
 }
 
+// offerMessage hands a message to a subscription without blocking, returning false if it is full;
+// a message overwritten to make room is traced as undeliverable
+func (p *PubSub) offerMessage(sub *Subscription, msg *Message) bool {
+	ok, evicted := sub.offer(msg)
+	if evicted != nil {
+		p.stats.subscriptionQueueFull.Add(1)
+		p.tracer.UndeliverableMessage(evicted)
+		log.Debugf("Overwrote message in subscription for topic %s; subscriber too slow", sub.topic)
+	}
+	return ok
+}
+
 // seenMessage returns whether we already saw this message before
-func (p *PubSub) seenMessage(id string) bool {
+func (p *PubSub) seenMessage(topic, id string) bool {
+	if rf := p.topicReplayFilter(topic); rf != nil && rf.Has(id) {
+		return true
+	}
 	return p.seenMessages.Has(id)
 }
 
 // markSeen marks a message as seen such that seenMessage returns `true' for the given id
 // returns true if the message was freshly marked
-func (p *PubSub) markSeen(id string) bool {
+func (p *PubSub) markSeen(topic, id string) bool {
+	if rf := p.topicReplayFilter(topic); rf != nil {
+		p.addSeen(topic, id)
+		return rf.Add(id)
+	}
+	return p.addSeen(topic, id)
+}
+
+// ttlTimeCache is implemented by seen messages caches supporting per-entry TTLs
+type ttlTimeCache interface {
+	AddWithTTL(id string, ttl time.Duration) bool
+}
+
+// addSeen adds a message ID to the seen messages cache with the TTL of its topic
+func (p *PubSub) addSeen(topic, id string) bool {
+	if ttl, ok := p.seenTopicTTLs[topic]; ok {
+		if tc, ok := p.seenMessages.(ttlTimeCache); ok {
+			return tc.AddWithTTL(id, ttl)
+		}
+	}
 	return p.seenMessages.Add(id)
 }
 
@@ -1020,39 +1720,63 @@ func (p *PubSub) canRelayMsg(msg *pb.Message) bool {
 	return relays > 0
 }
 
+func (p *PubSub) notifyJoin(topic string, pid peer.ID) {
+	if mr, ok := p.rt.(membershipRouter); ok {
+		mr.peerJoined(topic, pid)
+	}
+	if t, ok := p.myTopics[topic]; ok {
+		t.sendNotification(PeerEvent{PeerJoin, pid})
+	}
+}
+
 func (p *PubSub) notifyLeave(topic string, pid peer.ID) {
+	if mr, ok := p.rt.(membershipRouter); ok {
+		mr.peerLeft(topic, pid)
+	}
 	if t, ok := p.myTopics[topic]; ok {
 		t.sendNotification(PeerEvent{PeerLeave, pid})
 	}
 }
 
 func (p *PubSub) handleIncomingRPC(rpc *RPC) {
-	// pass the rpc through app specific validation (if any available).
-	if p.appSpecificRpcInspector != nil {
-		// check if the RPC is allowed by the external inspector
-		if err := p.appSpecificRpcInspector(rpc.from, rpc); err != nil {
-			log.Debugf("application-specific inspection failed, rejecting incoming rpc: %s", err)
-			return // reject the RPC
-		}
+	p.tracer.RecvRPC(rpc)
+
+	if p.denyPeer(rpc.from) {
+		return
 	}
 
-	p.tracer.RecvRPC(rpc)
+	if p.subLimits.Graylisted(rpc.from) {
+		log.Debugf("received RPC from peer %s graylisted for its subscriptions; dropping RPC", rpc.from)
+		return
+	}
 
 	subs := rpc.GetSubscriptions()
 	if len(subs) != 0 && p.subFilter != nil {
 		var err error
-		subs, err = p.subFilter.FilterIncomingSubscriptions(rpc.from, subs)
+		subs, err = p.filterIncomingSubscriptions(rpc.from, subs)
 		if err != nil {
 			log.Debugf("subscription filter error: %s; ignoring RPC", err)
 			return
 		}
 	}
 
+	if !p.subLimits.Announce(rpc.from, len(subs)) {
+		p.graylistForSubscriptions(rpc.from, SubscriptionChurnExceeded)
+		return
+	}
+
 	for _, subopt := range subs {
 		t := subopt.GetTopicid()
 
 		if subopt.GetSubscribe() {
 			tmap, ok := p.topics[t]
+			if _, subscribed := tmap[rpc.from]; !subscribed && !p.subLimits.Subscribe(rpc.from, p.isDirectPeer(rpc.from)) {
+				if p.subscriptionLimitExceeded(rpc.from, t) {
+					continue
+				}
+				return
+			}
+
 			if !ok {
 				tmap = make(map[peer.ID]struct{})
 				p.topics[t] = tmap
@@ -1060,10 +1784,7 @@ func (p *PubSub) handleIncomingRPC(rpc *RPC) {
 
 			if _, ok = tmap[rpc.from]; !ok {
 				tmap[rpc.from] = struct{}{}
-				if topic, ok := p.myTopics[t]; ok {
-					peer := rpc.from
-					topic.sendNotification(PeerEvent{PeerJoin, peer})
-				}
+				p.notifyJoin(t, rpc.from)
 			}
 		} else {
 			tmap, ok := p.topics[t]
@@ -1073,6 +1794,7 @@ func (p *PubSub) handleIncomingRPC(rpc *RPC) {
 
 			if _, ok := tmap[rpc.from]; ok {
 				delete(tmap, rpc.from)
+				p.subLimits.Unsubscribe(rpc.from)
 				p.notifyLeave(t, rpc.from)
 			}
 		}
@@ -1085,25 +1807,90 @@ func (p *PubSub) handleIncomingRPC(rpc *RPC) {
 		return
 
 	case AcceptControl:
-		if len(rpc.GetPublish()) > 0 {
-			log.Debugf("peer %s was throttled by router; ignoring %d payload messages", rpc.from, len(rpc.GetPublish()))
-		}
-		p.tracer.ThrottlePeer(rpc.from)
-
-	case AcceptAll:
-		for _, pmsg := range rpc.GetPublish() {
-			if !(p.subscribedToMsg(pmsg) || p.canRelayMsg(pmsg)) {
-				log.Debug("received message in topic we didn't subscribe to; ignoring message")
+		ignored := 0
+		for i, pmsg := range rpc.GetPublish() {
+			if p.gateExempt(pmsg.GetTopic()) {
+				p.handleIncomingMessage(rpc, pmsg, rpc.rawMessage(i), rpc.ingressCheck(i))
 				continue
 			}
 
-			p.pushMsg(&Message{pmsg, "", rpc.from, nil, false})
+			ignored++
+			if p.gatedMessage(rpc.from) {
+				p.tracer.ThrottlePeerTopic(rpc.from, pmsg.GetTopic())
+			}
+		}
+		if ignored > 0 {
+			log.Debugf("peer %s was throttled by router; ignoring %d payload messages", rpc.from, ignored)
+			p.tracer.ThrottlePeer(rpc.from)
+		}
+
+	case AcceptAll:
+		for i, pmsg := range rpc.GetPublish() {
+			p.handleIncomingMessage(rpc, pmsg, rpc.rawMessage(i), rpc.ingressCheck(i))
 		}
 	}
 
+	p.shedGossip(rpc)
 	p.rt.HandleRPC(rpc)
 }
 
+// handleIncomingMessage pushes an accepted payload message of an RPC into the validation
+// pipeline, with its wire bytes and ingress worker checks if any
+func (p *PubSub) handleIncomingMessage(rpc *RPC, pmsg *pb.Message, raw []byte, check *ingressCheck) {
+	from := rpc.from
+	if !(p.subscribedToMsg(pmsg) || p.canRelayMsg(pmsg)) {
+		log.Debug("received message in topic we didn't subscribe to; ignoring message")
+		return
+	}
+
+	if rpc.listsTopics(pmsg) {
+		log.Debugf("dropping message from %s listing multiple topics", from)
+		p.rejectMessage(&Message{Message: pmsg, ReceivedFrom: from}, RejectMultipleTopics)
+		return
+	}
+
+	if t, ok := p.myTopics[pmsg.GetTopic()]; ok && t.maxMessageSize > 0 && pmsg.Size() > t.maxMessageSize {
+		log.Debugf("dropping message of %d bytes from %s exceeding the limit of topic %s", pmsg.Size(), from, pmsg.GetTopic())
+		p.rejectMessage(&Message{Message: pmsg, ReceivedFrom: from}, RejectMessageTooLarge)
+		return
+	}
+
+	if check != nil {
+		check.msg.raw = raw
+		p.pushCheckedMsg(check.msg, check)
+		return
+	}
+	p.pushMsg(&Message{Message: pmsg, ReceivedFrom: from, raw: raw})
+}
+
+// membershipRouter is implemented by routers that track the peers subscribed to topics
+type membershipRouter interface {
+	// peerJoined is invoked when a peer subscribes to a topic
+	peerJoined(topic string, p peer.ID)
+	// peerLeft is invoked when a peer leaves a topic, by unsubscribing or being removed
+	peerLeft(topic string, p peer.ID)
+}
+
+// gatingRouter is implemented by routers that throttle peers
+type gatingRouter interface {
+	// gateExempt returns whether messages in the topic are accepted from throttled peers
+	gateExempt(topic string) bool
+	// gatedMessage counts a message dropped from a throttled peer, returning whether to trace it
+	gatedMessage(p peer.ID) bool
+}
+
+// gateExempt returns whether messages in the topic are accepted from throttled peers
+func (p *PubSub) gateExempt(topic string) bool {
+	gr, ok := p.rt.(gatingRouter)
+	return ok && gr.gateExempt(topic)
+}
+
+// gatedMessage counts a message dropped from a throttled peer, returning whether to trace it
+func (p *PubSub) gatedMessage(pid peer.ID) bool {
+	gr, ok := p.rt.(gatingRouter)
+	return ok && gr.gatedMessage(pid)
+}
+
 // DefaultMsgIdFn returns a unique ID of the passed Message
 func DefaultMsgIdFn(pmsg *pb.Message) string {
 	return string(pmsg.GetFrom()) + string(pmsg.GetSeqno())
@@ -1116,84 +1903,128 @@ func DefaultPeerFilter(pid peer.ID, topic string) bool {
 
 // pushMsg pushes a message performing validation as necessary
 func (p *PubSub) pushMsg(msg *Message) {
+	p.pushCheckedMsg(msg, nil)
+}
+
+// pushCheckedMsg pushes a message with the checks of the ingress workers, if any
+func (p *PubSub) pushCheckedMsg(msg *Message, check *ingressCheck) {
 	src := msg.ReceivedFrom
 	// reject messages from blacklisted peers
-	if p.blacklist.Contains(src) {
+	if p.isBlacklisted(src) {
 		log.Debugf("dropping message from blacklisted peer %s", src)
-		p.tracer.RejectMessage(msg, RejectBlacklstedPeer)
+		p.rejectMessage(msg, RejectBlacklstedPeer)
 		return
 	}
 
 	// even if they are forwarded by good peers
-	if p.blacklist.Contains(msg.GetFrom()) {
+	if p.isBlacklisted(msg.GetFrom()) {
 		log.Debugf("dropping message from blacklisted source %s", src)
-		p.tracer.RejectMessage(msg, RejectBlacklistedSource)
+		p.rejectMessage(msg, RejectBlacklistedSource)
 		return
 	}
 
-	err := p.checkSigningPolicy(msg)
-	if err != nil {
-		log.Debugf("dropping message from %s: %s", src, err)
+	if check != nil && check.reject != "" {
+		log.Debugf("dropping message from %s: %s", src, check.reject)
+		p.rejectMessage(msg, check.reject)
 		return
+	} else if check == nil {
+		err := p.checkSigningPolicy(msg)
+		if err != nil {
+			log.Debugf("dropping message from %s: %s", src, err)
+			return
+		}
 	}
 
 	// reject messages claiming to be from ourselves but not locally published
 	self := p.host.ID()
 	if peer.ID(msg.GetFrom()) == self && src != self {
 		log.Debugf("dropping message claiming to be from self but forwarded from %s", src)
-		p.tracer.RejectMessage(msg, RejectSelfOrigin)
+		p.rejectMessage(msg, RejectSelfOrigin)
+		return
+	}
+
+	// reject messages from authors that are not allowed in the topic, before they consume
+	// validation resources
+	if !p.checkAuthorAllowed(msg) {
+		log.Debugf("dropping message from unauthorized author %s forwarded from %s", msg.GetFrom(), src)
+		p.rejectMessage(msg, RejectUnauthorizedAuthor)
 		return
 	}
 
 	// have we already seen and validated this message?
 	id := p.idGen.ID(msg)
-	if p.seenMessage(id) {
-		p.tracer.DuplicateMessage(msg)
+	if (check != nil && check.seen) || p.seenMessage(msg.GetTopic(), id) {
+		p.stats.duplicate(msg)
+		p.duplicate(id)
+		p.tracer.duplicateMessage(msg, !p.shedDuplicate(msg))
 		return
 	}
 
-	if !p.val.Push(src, msg) {
+	if !p.val.Push(src, msg, p.relayValidationPolicy(msg.GetTopic())) {
 		return
 	}
 
-	if p.markSeen(id) {
-		p.publishMessage(msg)
+	if p.markSeen(msg.GetTopic(), id) {
+		if !p.ordered(msg, true) {
+			p.publishMessage(msg)
+		}
+	} else {
+		p.ordered(msg, false)
 	}
 }
 
 func (p *PubSub) checkSigningPolicy(msg *Message) error {
+	if reason := p.signingPolicyReject(msg); reason != "" {
+		p.rejectMessage(msg, reason)
+		return ValidationError{Reason: reason}
+	}
+	return nil
+}
+
+// signingPolicyReject returns the reason for rejecting a message under the signature policy of
+// its topic, or "" if accepted; it doesn't touch the event loop state
+func (p *PubSub) signingPolicyReject(msg *Message) string {
+	policy, anonymous := p.signPolicy, p.signID == ""
+	if tp := p.topicSignPolicy(msg.GetTopic()); tp != nil {
+		policy, anonymous = *tp, tp.anonymous()
+	}
+
 	// reject unsigned messages when strict before we even process the id
-	if p.signPolicy.mustVerify() {
-		if p.signPolicy.mustSign() {
+	if policy.mustVerify() {
+		if policy.mustSign() {
 			if msg.Signature == nil {
-				p.tracer.RejectMessage(msg, RejectMissingSignature)
-				return ValidationError{Reason: RejectMissingSignature}
+				return RejectMissingSignature
 			}
 			// Actual signature verification happens in the validation pipeline,
 			// after checking if the message was already seen or not,
 			// to avoid unnecessary signature verification processing-cost.
 		} else {
 			if msg.Signature != nil {
-				p.tracer.RejectMessage(msg, RejectUnexpectedSignature)
-				return ValidationError{Reason: RejectUnexpectedSignature}
+				return RejectUnexpectedSignature
 			}
 			// If we are expecting signed messages, and not authoring messages,
 			// then do no accept seq numbers, from data, or key data.
 			// The default msgID function still relies on Seqno and From,
 			// but is not used if we are not authoring messages ourselves.
-			if p.signID == "" {
+			if anonymous {
 				if msg.Seqno != nil || msg.From != nil || msg.Key != nil {
-					p.tracer.RejectMessage(msg, RejectUnexpectedAuthInfo)
-					return ValidationError{Reason: RejectUnexpectedAuthInfo}
+					return RejectUnexpectedAuthInfo
 				}
 			}
 		}
 	}
 
-	return nil
+	return ""
 }
 
 func (p *PubSub) publishMessage(msg *Message) {
+	self := msg.ReceivedFrom == p.host.ID()
+	p.annotateMessage(msg)
+	p.stats.delivered(msg, self)
+	p.throughput.delivered(msg, p.clock.Now().Unix())
+	if self && !msg.Local {
+		p.autoJoinPublished(msg.GetTopic())
+	}
 	p.tracer.DeliverMessage(msg)
 	p.notifySubs(msg)
 	if !msg.Local {
@@ -1223,6 +2054,39 @@ func WithTopicMessageIdFn(msgId MsgIdFunction) TopicOpt {
 	}
 }
 
+// WithTopicMaxMessageSize sets a message size limit for a Topic, which must not exceed the
+// global limit set with WithMaxMessageSize.
+// Publishing a larger message fails with ErrMessageTooLarge, while larger messages received
+// from peers are dropped individually without affecting the rest of the RPC.
+// Note that RPCs exceeding the global limit are still rejected as a whole by the stream reader.
+func WithTopicMaxMessageSize(maxMessageSize int) TopicOpt {
+	return func(t *Topic) error {
+		if maxMessageSize <= 0 {
+			return fmt.Errorf("invalid topic message size limit: %d", maxMessageSize)
+		}
+		if maxMessageSize > t.p.maxMessageSize {
+			return fmt.Errorf("topic message size limit %d exceeds the global limit %d", maxMessageSize, t.p.maxMessageSize)
+		}
+		t.maxMessageSize = maxMessageSize
+		return nil
+	}
+}
+
+// WithTopicTracer attaches an EventTracer, a RawTracer or both to a Topic, which receives the
+// events of the messages, mesh and membership of the topic in addition to the global tracers.
+// Events without a topic, such as AddPeer or the RPC events, only go to the global tracers.
+func WithTopicTracer(tracer interface{}) TopicOpt {
+	return func(t *Topic) error {
+		evt, isEvent := tracer.(EventTracer)
+		raw, isRaw := tracer.(RawTracer)
+		if !isEvent && !isRaw {
+			return fmt.Errorf("topic tracer %T is neither an EventTracer nor a RawTracer", tracer)
+		}
+		t.tracer = topicTracer{event: evt, raw: raw}
+		return nil
+	}
+}
+
 // Join joins the topic and returns a Topic handle. Only one Topic handle should exist per topic, and Join will error if
 // the Topic handle already exists.
 func (p *PubSub) Join(topic string, opts ...TopicOpt) (*Topic, error) {
@@ -1232,7 +2096,7 @@ func (p *PubSub) Join(topic string, opts ...TopicOpt) (*Topic, error) {
 	}
 
 	if !ok {
-		return nil, fmt.Errorf("topic already exists")
+		return nil, ErrTopicExists
 	}
 
 	return t, nil
@@ -1243,14 +2107,11 @@ func (p *PubSub) Join(topic string, opts ...TopicOpt) (*Topic, error) {
 // Returns true if the topic was newly created, false otherwise
 // Can be removed once pubsub.Publish() and pubsub.Subscribe() are removed
 func (p *PubSub) tryJoin(topic string, opts ...TopicOpt) (*Topic, bool, error) {
-	if p.subFilter != nil && !p.subFilter.CanSubscribe(topic) {
-		return nil, false, fmt.Errorf("topic is not allowed by the subscription filter")
-	}
-
 	t := &Topic{
 		p:           p,
 		topic:       topic,
 		evtHandlers: make(map[*TopicEventHandler]struct{}),
+		done:        make(chan struct{}),
 	}
 
 	for _, opt := range opts {
@@ -1260,6 +2121,10 @@ func (p *PubSub) tryJoin(topic string, opts ...TopicOpt) (*Topic, bool, error) {
 		}
 	}
 
+	if !t.bypassFilter && p.subFilter != nil && !p.subFilter.CanSubscribe(topic) {
+		return nil, false, ErrTopicNotAllowed
+	}
+
 	resp := make(chan *Topic, 1)
 	select {
 	case t.p.addTopic <- &addTopicReq{
@@ -1364,6 +2229,45 @@ func (p *PubSub) ListPeers(topic string) []peer.ID {
 	return <-out
 }
 
+// ErrRawTracerNotFound is returned when removing a raw tracer that isn't registered.
+var ErrRawTracerNotFound = errors.New("raw tracer not found")
+
+// AddRawTracer adds a raw tracer after construction, like WithRawTracer; the events emitted once
+// it returns are delivered to the tracer, including its optional interfaces.
+func (p *PubSub) AddRawTracer(tracer RawTracer) error {
+	done := make(chan struct{})
+	select {
+	case p.eval <- func() {
+		p.tracer.addRaw(tracer)
+		close(done)
+	}:
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+
+	<-done
+	return nil
+}
+
+// RemoveRawTracer removes a raw tracer added with AddRawTracer or WithRawTracer; the tracer must
+// be comparable, e.g. a pointer.
+// Events emitted after it returns never reach the tracer, but callbacks for earlier events that
+// are under way outside the event loop, in the validation workers or the stream handlers, may
+// still arrive briefly.
+func (p *PubSub) RemoveRawTracer(tracer RawTracer) error {
+	out := make(chan bool, 1)
+	select {
+	case p.eval <- func() { out <- p.tracer.removeRaw(tracer) }:
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+
+	if !<-out {
+		return ErrRawTracerNotFound
+	}
+	return nil
+}
+
 // BlacklistPeer blacklists a peer; all messages from this peer will be unconditionally dropped.
 func (p *PubSub) BlacklistPeer(pid peer.ID) {
 	select {
@@ -1372,6 +2276,110 @@ func (p *PubSub) BlacklistPeer(pid peer.ID) {
 	}
 }
 
+// ErrBlacklistNotRemovable is returned when unblacklisting a peer from a blacklist that
+// doesn't implement RemovableBlacklist.
+var ErrBlacklistNotRemovable = errors.New("blacklist does not support removing peers")
+
+// UnblacklistOpt is an option for UnblacklistPeer.
+type UnblacklistOpt func(*unblacklistOptions)
+
+type unblacklistOptions struct {
+	clearState bool
+}
+
+// WithClearPeerState also clears the state retained for the unblacklisted peer, i.e. the
+// subscription limits graylist and the peer score retained by the router, so that the peer
+// starts afresh.
+func WithClearPeerState() UnblacklistOpt {
+	return func(opts *unblacklistOptions) {
+		opts.clearState = true
+	}
+}
+
+// UnblacklistPeer removes a peer from the blacklist, including a blacklisting with
+// BlacklistPeerFor, and accepts the peer again if it is still connected.
+// It returns ErrBlacklistNotRemovable if the peer is in a blacklist that doesn't implement
+// RemovableBlacklist.
+func (p *PubSub) UnblacklistPeer(pid peer.ID, opts ...UnblacklistOpt) error {
+	var options unblacklistOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	out := make(chan error, 1)
+	select {
+	case p.eval <- func() { out <- p.handleUnblacklistPeer(pid, options) }:
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+	return <-out
+}
+
+// BlacklistedPeers returns the peers that are currently blacklisted, including the peers
+// blacklisted with BlacklistPeerFor; the peers in a blacklist that doesn't implement
+// EnumerableBlacklist are omitted.
+func (p *PubSub) BlacklistedPeers() []peer.ID {
+	out := make(chan []peer.ID, 1)
+	select {
+	case p.eval <- func() {
+		peers := p.timedBlacklist.List()
+		if eb, ok := p.blacklist.(EnumerableBlacklist); ok {
+			for _, pid := range eb.List() {
+				if !p.timedBlacklist.Contains(pid) {
+					peers = append(peers, pid)
+				}
+			}
+		}
+		out <- peers
+	}:
+	case <-p.ctx.Done():
+		return nil
+	}
+	return <-out
+}
+
+// BlacklistPeerFor blacklists a peer for the given duration; all messages from this peer will be
+// unconditionally dropped until the blacklisting expires, after which the peer is accepted again.
+func (p *PubSub) BlacklistPeerFor(pid peer.ID, d time.Duration) {
+	p.blacklistPeerFor(pid, d, BlacklistReasonManual)
+}
+
+func (p *PubSub) blacklistPeerFor(pid peer.ID, d time.Duration, reason string) {
+	if d <= 0 {
+		return
+	}
+
+	select {
+	case p.eval <- func() { p.handleBlacklistPeerFor(pid, d, reason) }:
+	case <-p.ctx.Done():
+	}
+}
+
+// BlacklistTimeRemaining returns how long a peer remains blacklisted, and whether it is
+// blacklisted; the remaining time is 0 for a peer blacklisted with BlacklistPeer.
+func (p *PubSub) BlacklistTimeRemaining(pid peer.ID) (time.Duration, bool) {
+	type result struct {
+		remaining   time.Duration
+		blacklisted bool
+	}
+
+	out := make(chan result, 1)
+	select {
+	case p.eval <- func() {
+		if remaining := p.timedBlacklist.Remaining(pid); remaining > 0 {
+			out <- result{remaining, true}
+			return
+		}
+		out <- result{0, p.blacklist.Contains(pid)}
+	}:
+	case <-p.ctx.Done():
+		return 0, false
+	}
+
+	res := <-out
+	return res.remaining, res.blacklisted
+}
+
 // RegisterTopicValidator registers a validator for topic.
 // By default validators are asynchronous, which means they will run in a separate goroutine.
 // The number of active goroutines is controlled by global and per topic validator
@@ -0,0 +1,144 @@
+package pubsub
+
+import (
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// QueueControlTopic is the pseudo-topic the subscriptions and control messages waiting in the
+// outbound queues are attributed to.
+const QueueControlTopic = "$control"
+
+// QueueStats are the data of a topic waiting in the outbound queue of a peer.
+type QueueStats struct {
+	// Messages is the number of queued messages of the topic; for QueueControlTopic, it is the
+	// number of queued RPCs carrying subscriptions or control messages.
+	Messages int `json:"messages"`
+	// Bytes is the size of the queued messages of the topic.
+	Bytes int `json:"bytes"`
+}
+
+// queueLoad is the share of a topic in an RPC
+type queueLoad struct {
+	topic    string
+	messages int
+	bytes    int
+}
+
+// queueLoads returns the breakdown of an RPC by topic, computing it on its first enqueue; the RPC
+// may be shared with other peers, so it is only written from the event loop, before the RPC is
+// handed to any of them.
+func (rpc *RPC) queueLoads() []queueLoad {
+	if rpc.loads != nil {
+		return rpc.loads
+	}
+
+	loads := make([]queueLoad, 0, 1)
+	add := func(topic string, bytes int) {
+		for i := range loads {
+			if loads[i].topic == topic {
+				loads[i].messages++
+				loads[i].bytes += bytes
+				return
+			}
+		}
+		loads = append(loads, queueLoad{topic: topic, messages: 1, bytes: bytes})
+	}
+
+	for _, msg := range rpc.Publish {
+		add(msg.GetTopic(), msg.Size())
+	}
+	if len(rpc.Subscriptions) > 0 || rpc.Control != nil {
+		size := rpc.Control.Size()
+		for _, sub := range rpc.Subscriptions {
+			size += sub.Size()
+		}
+		add(QueueControlTopic, size)
+	}
+
+	rpc.loads = loads
+	return loads
+}
+
+// rpcTopic returns the topic of the messages of an RPC, if they are all of the same topic
+func rpcTopic(rpc *RPC) (string, bool) {
+	if len(rpc.Publish) == 0 {
+		return "", false
+	}
+	topic := rpc.Publish[0].GetTopic()
+	for _, msg := range rpc.Publish[1:] {
+		if msg.GetTopic() != topic {
+			return "", false
+		}
+	}
+	return topic, true
+}
+
+// enqueueRPC adds an RPC to the outbound queue of a peer, attributing its content to the queued
+// data of the peer, and reports whether there was room for it.
+// Only called from processLoop.
+func (p *PubSub) enqueueRPC(pid peer.ID, mch chan *RPC, rpc *RPC) bool {
+	loads := rpc.queueLoads()
+	// counted first, as the writer may take the RPC off the queue at once
+	p.stats.queued(pid, loads, 1)
+	if prio := rpc.priority(); prio != PriorityNormal {
+		mch = p.outboundLane(pid, mch, prio)
+	}
+	select {
+	case mch <- rpc:
+		return true
+	default:
+		p.stats.queued(pid, loads, -1)
+		return false
+	}
+}
+
+// dequeuedRPC releases the data of an RPC taken off the outbound queue of a peer
+func (p *PubSub) dequeuedRPC(pid peer.ID, rpc *RPC) {
+	// the RPCs split off by the writer were never queued
+	if rpc.loads != nil {
+		p.stats.queued(pid, rpc.loads, -1)
+	}
+}
+
+// peerQueue is the data waiting in the outbound queue of a peer, by topic
+type peerQueue struct {
+	mx     sync.Mutex
+	topics map[string]*QueueStats
+}
+
+// add adds, or removes with a negative sign, the loads of an RPC
+func (q *peerQueue) add(loads []queueLoad, sign int) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	for _, l := range loads {
+		qs, ok := q.topics[l.topic]
+		if !ok {
+			qs = new(QueueStats)
+			q.topics[l.topic] = qs
+		}
+		qs.Messages += sign * l.messages
+		qs.Bytes += sign * l.bytes
+		// the writer of a previous connection may still drain its queue
+		if qs.Messages <= 0 {
+			delete(q.topics, l.topic)
+		}
+	}
+}
+
+// stats returns the queued data by topic, nil if the queue is empty
+func (q *peerQueue) stats() map[string]QueueStats {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if len(q.topics) == 0 {
+		return nil
+	}
+	out := make(map[string]QueueStats, len(q.topics))
+	for topic, qs := range q.topics {
+		out[topic] = *qs
+	}
+	return out
+}
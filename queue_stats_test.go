@@ -0,0 +1,189 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestQueueStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	tracer := &collectingEventTracer{}
+	ps := getGossipsub(ctx, hosts[0], WithEventTracer(tracer), WithPeerOutboundQueueSize(8), WithAnnounceWindow(0))
+	gs := ps.rt.(*GossipSubRouter)
+
+	eval := func(f func()) {
+		done := make(chan struct{})
+		ps.eval <- func() {
+			f()
+			close(done)
+		}
+		<-done
+	}
+
+	pid := peer.ID("queued")
+	var mch chan *RPC
+	eval(func() {
+		mch = make(chan *RPC, 8)
+		ps.peers[pid] = mch
+		ps.stats.addPeer(pid)
+		gs.peers[pid] = GossipSubID_v11
+		ps.topics["test"] = map[peer.ID]struct{}{pid: {}}
+		ps.notifyJoin("test", pid)
+	})
+
+	topic, err := ps.Join("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := topic.Subscribe(); err != nil {
+		t.Fatal(err)
+	}
+	// the subscription and the graft, then the messages until the queue is full
+	for i := 0; i < 10; i++ {
+		if err := topic.Publish(ctx, []byte(fmt.Sprintf("message %d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the messages are routed asynchronously
+	for sent := 0; sent < 10; {
+		time.Sleep(10 * time.Millisecond)
+		sent = 0
+		tracer.mx.Lock()
+		for _, evt := range tracer.events {
+			sent += len(evt.GetSendRPC().GetMeta().GetMessages()) + len(evt.GetDropRPC().GetMeta().GetMessages())
+		}
+		tracer.mx.Unlock()
+	}
+
+	var want map[string]QueueStats
+	eval(func() {
+		want = make(map[string]QueueStats)
+		for i := len(mch); i > 0; i-- {
+			rpc := <-mch
+			for _, l := range rpc.queueLoads() {
+				qs := want[l.topic]
+				qs.Messages += l.messages
+				qs.Bytes += l.bytes
+				want[l.topic] = qs
+			}
+			mch <- rpc
+		}
+	})
+
+	queued := ps.Stats().Queued[pid]
+	if len(queued) != 2 || queued["test"] != want["test"] || queued[QueueControlTopic] != want[QueueControlTopic] {
+		t.Fatalf("expected the queued data %v, got %v", want, queued)
+	}
+	if queued["test"].Messages == 0 || queued["test"].Bytes == 0 || queued[QueueControlTopic].Messages == 0 {
+		t.Fatalf("expected queued messages and control, got %v", queued)
+	}
+
+	// the drops of the messages are traced with their topic
+	tracer.mx.Lock()
+	drops := 0
+	for _, evt := range tracer.events {
+		if evt.GetType() != pb.TraceEvent_DROP_RPC {
+			continue
+		}
+		drops++
+		if evt.GetDropRPC().GetTopic() != "test" {
+			t.Fatalf("expected the drop of a message of the topic, got %q", evt.GetDropRPC().GetTopic())
+		}
+	}
+	tracer.mx.Unlock()
+	if drops == 0 {
+		t.Fatal("expected drops")
+	}
+
+	// taking the RPCs off the queue releases their data
+	eval(func() {
+		for len(mch) > 0 {
+			ps.dequeuedRPC(pid, <-mch)
+		}
+	})
+	if queued := ps.Stats().Queued; len(queued) != 0 {
+		t.Fatalf("expected no queued data, got %v", queued)
+	}
+}
+
+func TestQueueStatsDroppedPeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0])
+
+	eval := func(f func()) {
+		done := make(chan struct{})
+		ps.eval <- func() {
+			f()
+			close(done)
+		}
+		<-done
+	}
+
+	topic := "test"
+	rpcOf := func(prio int) *RPC {
+		return &RPC{
+			RPC:     pb.RPC{Publish: []*pb.Message{{Topic: &topic, Data: []byte("data")}}},
+			origins: []*Message{{priority: prio}},
+		}
+	}
+
+	// the lanes are not read, as the peer has no writer
+	pid := peer.ID("dropped")
+	mch := make(chan *RPC, 8)
+	eval(func() {
+		ps.stats.addPeer(pid)
+		ps.lanes[pid] = &outboundLanes{high: make(chan *RPC, 8), low: make(chan *RPC, 8)}
+		ps.enqueueRPC(pid, mch, rpcOf(PriorityHigh))
+		ps.enqueueRPC(pid, mch, rpcOf(PriorityLow))
+	})
+	if queued := ps.Stats().Queued[pid]; queued[topic].Messages != 2 {
+		t.Fatalf("expected 2 queued messages, got %v", queued)
+	}
+
+	// dropping the lanes releases the RPCs left in them
+	eval(func() { ps.dropLanes(pid) })
+	if queued := ps.Stats().Queued; len(queued) != 0 {
+		t.Fatalf("expected no queued data, got %v", queued)
+	}
+
+	// a writer still draining the queue of a removed peer doesn't track it again
+	eval(func() {
+		ps.stats.removePeer(pid)
+		ps.enqueueRPC(pid, mch, rpcOf(PriorityNormal))
+		ps.dequeuedRPC(pid, <-mch)
+		ps.enqueueRPC(pid, mch, rpcOf(PriorityNormal))
+	})
+	ps.stats.mx.RLock()
+	_, ok := ps.stats.peerQueues[pid]
+	ps.stats.mx.RUnlock()
+	if ok {
+		t.Fatal("expected the queue of the removed peer not to be tracked again")
+	}
+}
+
+func TestRPCTopic(t *testing.T) {
+	topicA, topicB := "a", "b"
+	msg := func(topic *string) *pb.Message { return &pb.Message{Topic: topic} }
+
+	if _, ok := rpcTopic(&RPC{RPC: pb.RPC{Control: &pb.ControlMessage{}}}); ok {
+		t.Fatal("expected no topic for a control RPC")
+	}
+	if topic, ok := rpcTopic(&RPC{RPC: pb.RPC{Publish: []*pb.Message{msg(&topicA), msg(&topicA)}}}); !ok || topic != topicA {
+		t.Fatalf("expected topic %q, got %q", topicA, topic)
+	}
+	if _, ok := rpcTopic(&RPC{RPC: pb.RPC{Publish: []*pb.Message{msg(&topicA), msg(&topicB)}}}); ok {
+		t.Fatal("expected no topic for messages of several topics")
+	}
+}
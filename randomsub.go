@@ -142,18 +142,22 @@ func (rs *RandomSubRouter) Publish(msg *Message) {
 		}
 	}
 
-	out := rpcWithMessages(msg.Message)
+	out := rs.p.outgoingRPC(msg)
 	for p := range tosend {
 		mch, ok := rs.p.peers[p]
 		if !ok {
 			continue
 		}
 
-		select {
-		case mch <- out:
+		if rs.p.skipsBestEffort(p, msg.GetTopic()) {
+			continue
+		}
+
+		if rs.p.enqueueRPC(p, mch, out) {
 			rs.tracer.SendRPC(out, p)
-		default:
+		} else {
 			log.Infof("dropping message to peer %s: queue full", p)
+			rs.p.stats.outboundDropped(p)
 			rs.tracer.DropRPC(out, p)
 		}
 	}
@@ -0,0 +1,310 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// DeliveryReceiptTimeout is the default amount of time a delivery receipt waits for
+// confirmation before failing with ErrReceiptTimeout.
+var DeliveryReceiptTimeout = 30 * time.Second
+
+// ErrReceiptTimeout is returned by a delivery receipt that did not complete in time.
+var ErrReceiptTimeout = errors.New("delivery receipt timed out")
+
+// ErrReceiptPending is returned by DeliveryReceipt.Err while the receipt is still outstanding.
+var ErrReceiptPending = errors.New("delivery receipt pending")
+
+// ReceiptMode selects the event that completes a delivery receipt.
+type ReceiptMode int
+
+const (
+	// ReceiptOnDuplicate completes the receipt when the message is seen coming back from a
+	// remote peer, either as a duplicate or announced in gossip. This is a heuristic for
+	// the message having propagated through the network beyond our direct peers.
+	ReceiptOnDuplicate ReceiptMode = iota
+	// ReceiptOnSend completes the receipt once the message has been sent to a number of peers.
+	ReceiptOnSend
+)
+
+// DeliveryReceipt tracks the propagation of a locally published message.
+type DeliveryReceipt struct {
+	id    string
+	mode  ReceiptMode
+	sends int
+
+	// protected by the receiptTracker lock
+	count int
+	// stop is closed once the receipt is no longer outstanding, stopping its timer
+	stop chan struct{}
+
+	done chan struct{}
+	err  error
+}
+
+// ID returns the ID of the tracked message.
+func (r *DeliveryReceipt) ID() string {
+	return r.id
+}
+
+// Done returns a channel that is closed when the receipt completes, either successfully
+// or because it timed out.
+func (r *DeliveryReceipt) Done() <-chan struct{} {
+	return r.done
+}
+
+// Err returns nil if the delivery was confirmed, ErrReceiptTimeout if it timed out or
+// ErrReceiptPending if the receipt has not completed yet.
+func (r *DeliveryReceipt) Err() error {
+	select {
+	case <-r.done:
+		return r.err
+	default:
+		return ErrReceiptPending
+	}
+}
+
+// Wait blocks until the receipt completes or the context is cancelled.
+func (r *DeliveryReceipt) Wait(ctx context.Context) error {
+	select {
+	case <-r.done:
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WithReceiptMode returns a publishing option that selects how a delivery receipt completes.
+// The sends argument is the number of peers the message must be sent to with ReceiptOnSend
+// and is ignored otherwise.
+func WithReceiptMode(mode ReceiptMode, sends int) PubOpt {
+	return func(pub *PublishOptions) error {
+		if mode == ReceiptOnSend && sends < 1 {
+			return errors.New("receipt send count must be positive")
+		}
+		pub.receiptMode = mode
+		pub.receiptSends = sends
+		return nil
+	}
+}
+
+// WithReceiptTimeout returns a publishing option that sets the delivery receipt timeout.
+// Defaults to DeliveryReceiptTimeout.
+func WithReceiptTimeout(timeout time.Duration) PubOpt {
+	return func(pub *PublishOptions) error {
+		if timeout <= 0 {
+			return errors.New("receipt timeout must be positive")
+		}
+		pub.receiptTimeout = timeout
+		return nil
+	}
+}
+
+// receiptTracker is an internal tracer that completes the delivery receipts of locally
+// published messages. It is only hooked to the tracer once a receipt is asked for.
+type receiptTracker struct {
+	idGen *msgIDGenerator
+	clock Clock
+
+	// number of outstanding receipts; lets the tracer hooks bail out cheaply
+	pending int32
+	// installed is set once the tracker is hooked to the tracer
+	installed atomic.Bool
+
+	sync.Mutex
+	// the outstanding receipts by message ID; messages published more than once with the same
+	// ID have a receipt for each publication
+	receipts map[string][]*DeliveryReceipt
+}
+
+var _ RawTracer = (*receiptTracker)(nil)
+
+func newReceiptTracker(idGen *msgIDGenerator, clock Clock) *receiptTracker {
+	return &receiptTracker{
+		idGen:    idGen,
+		clock:    clock,
+		receipts: make(map[string][]*DeliveryReceipt),
+	}
+}
+
+// installReceipts hooks the receipt tracker to the tracer on the first receipt asked for, so
+// that it costs nothing to the applications which never ask for one
+func (p *PubSub) installReceipts() error {
+	return p.installRaw(&p.receipts.installed, p.receipts)
+}
+
+// installRaw hooks an internal tracer to the tracer from the event loop, once
+func (p *PubSub) installRaw(installed *atomic.Bool, tracer RawTracer) error {
+	if installed.Load() {
+		return nil
+	}
+
+	done := make(chan struct{})
+	select {
+	case p.eval <- func() {
+		if installed.CompareAndSwap(false, true) {
+			p.tracer.addRaw(tracer)
+		}
+		close(done)
+	}:
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+func (rt *receiptTracker) track(r *DeliveryReceipt, timeout time.Duration) {
+	r.stop = make(chan struct{})
+
+	rt.Lock()
+	rt.receipts[r.id] = append(rt.receipts[r.id], r)
+	atomic.AddInt32(&rt.pending, 1)
+	rt.Unlock()
+
+	expire := rt.clock.After(timeout)
+	go func() {
+		select {
+		case <-expire:
+			rt.complete(r, ErrReceiptTimeout)
+		case <-r.stop:
+		}
+	}()
+}
+
+// untrack drops a receipt without completing it; used when the publish itself failed.
+func (rt *receiptTracker) untrack(r *DeliveryReceipt) {
+	rt.Lock()
+	defer rt.Unlock()
+
+	rt.remove(r)
+}
+
+// remove drops a receipt from the outstanding ones, stopping its timer; returns false if it
+// isn't outstanding
+func (rt *receiptTracker) remove(r *DeliveryReceipt) bool {
+	rs := rt.receipts[r.id]
+	i := slices.Index(rs, r)
+	if i < 0 {
+		return false
+	}
+	if len(rs) == 1 {
+		delete(rt.receipts, r.id)
+	} else {
+		rt.receipts[r.id] = slices.Delete(rs, i, i+1)
+	}
+	atomic.AddInt32(&rt.pending, -1)
+	close(r.stop)
+	return true
+}
+
+func (rt *receiptTracker) complete(r *DeliveryReceipt, err error) {
+	rt.Lock()
+	defer rt.Unlock()
+
+	rt.completeLocked(r, err)
+}
+
+func (rt *receiptTracker) completeLocked(r *DeliveryReceipt, err error) {
+	if !rt.remove(r) {
+		return
+	}
+
+	r.err = err
+	close(r.done)
+}
+
+func (rt *receiptTracker) active() bool {
+	return atomic.LoadInt32(&rt.pending) > 0
+}
+
+// seen is called when a message with the given ID arrives from a remote peer.
+func (rt *receiptTracker) seen(id string) {
+	rt.Lock()
+	defer rt.Unlock()
+
+	for _, r := range slices.Clone(rt.receipts[id]) {
+		if r.mode == ReceiptOnDuplicate {
+			rt.completeLocked(r, nil)
+		}
+	}
+}
+
+// sent is called when a message with the given ID is sent to a peer.
+func (rt *receiptTracker) sent(id string) {
+	rt.Lock()
+	defer rt.Unlock()
+
+	for _, r := range slices.Clone(rt.receipts[id]) {
+		if r.mode != ReceiptOnSend {
+			continue
+		}
+		r.count++
+		if r.count >= r.sends {
+			rt.completeLocked(r, nil)
+		}
+	}
+}
+
+func (rt *receiptTracker) DuplicateMessage(msg *Message) {
+	if !rt.active() {
+		return
+	}
+	rt.seen(rt.idGen.ID(msg))
+}
+
+func (rt *receiptTracker) RejectMessage(msg *Message, reason string) {
+	if !rt.active() {
+		return
+	}
+	// our own messages relayed back to us are rejected before the seen cache check
+	if reason == RejectSelfOrigin {
+		rt.seen(rt.idGen.ID(msg))
+	}
+}
+
+func (rt *receiptTracker) RecvRPC(rpc *RPC) {
+	if !rt.active() {
+		return
+	}
+	// the mesh never forwards a message back to its author, so gossip is usually
+	// the first sign that a message has propagated.
+	for _, ihave := range rpc.GetControl().GetIhave() {
+		for _, mid := range ihave.GetMessageIDs() {
+			rt.seen(mid)
+		}
+	}
+}
+
+func (rt *receiptTracker) SendRPC(rpc *RPC, p peer.ID) {
+	if !rt.active() {
+		return
+	}
+	for i := range rpc.GetPublish() {
+		rt.sent(rt.idGen.RPCMessageID(rpc, i))
+	}
+}
+
+func (rt *receiptTracker) AddPeer(p peer.ID, proto protocol.ID) {}
+func (rt *receiptTracker) RemovePeer(p peer.ID)                 {}
+func (rt *receiptTracker) Join(topic string)                    {}
+func (rt *receiptTracker) Leave(topic string)                   {}
+func (rt *receiptTracker) Graft(p peer.ID, topic string)        {}
+func (rt *receiptTracker) Prune(p peer.ID, topic string)        {}
+func (rt *receiptTracker) ValidateMessage(msg *Message)         {}
+func (rt *receiptTracker) DeliverMessage(msg *Message)          {}
+func (rt *receiptTracker) ThrottlePeer(p peer.ID)               {}
+func (rt *receiptTracker) DropRPC(rpc *RPC, p peer.ID)          {}
+func (rt *receiptTracker) UndeliverableMessage(msg *Message)    {}
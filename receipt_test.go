@@ -0,0 +1,178 @@
+package pubsub
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDeliveryReceiptOnDuplicate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 20)
+	psubs := getGossipsubs(ctx, hosts)
+	topics := getTopics(psubs, "foobar")
+
+	for _, tp := range topics {
+		if _, err := tp.Subscribe(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	denseConnect(t, hosts)
+
+	// wait for the mesh to form
+	time.Sleep(2 * time.Second)
+
+	r, err := topics[0].PublishWithReceipt(ctx, []byte("hello"), WithReceiptTimeout(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeliveryReceiptOnSend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 4)
+	psubs := getPubsubs(ctx, hosts)
+	topics := getTopics(psubs, "foobar")
+
+	var subs []*Subscription
+	for _, tp := range topics {
+		sub, err := tp.Subscribe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[0], hosts[2])
+	connect(t, hosts[0], hosts[3])
+
+	time.Sleep(100 * time.Millisecond)
+
+	r, err := topics[0].PublishWithReceipt(ctx, []byte("hello"), WithReceiptMode(ReceiptOnSend, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wctx, wcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer wcancel()
+	if err := r.Wait(wctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sub := range subs[1:] {
+		assertReceive(t, sub, []byte("hello"))
+	}
+}
+
+func TestDeliveryReceiptTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	psubs := getPubsubs(ctx, hosts)
+	topic, err := psubs[0].Join("foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := topic.PublishWithReceipt(ctx, []byte("hello"),
+		WithReceiptMode(ReceiptOnSend, 1),
+		WithReceiptTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Err(); err != ErrReceiptPending {
+		t.Fatalf("expected pending receipt, got %v", err)
+	}
+
+	if err := r.Wait(ctx); err != ErrReceiptTimeout {
+		t.Fatalf("expected receipt timeout, got %v", err)
+	}
+
+	if psubs[0].receipts.active() {
+		t.Fatal("expired receipt is still tracked")
+	}
+
+	if _, err := topic.PublishWithReceipt(ctx, []byte("hello"), WithLocalPublication(true)); err == nil {
+		t.Fatal("expected an error for a local publication")
+	}
+}
+
+func TestDeliveryReceiptTracking(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0])
+	installed := func() bool {
+		return slices.Contains(ps.tracer.rawTracers(), RawTracer(ps.receipts))
+	}
+
+	// the tracker is only hooked once a receipt is asked for
+	topic, err := ps.Join("foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := topic.Publish(ctx, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if installed() {
+		t.Fatal("expected the receipt tracker to be hooked on the first receipt only")
+	}
+	if _, err := topic.PublishWithReceipt(ctx, []byte("hello"), WithReceiptTimeout(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if !installed() {
+		t.Fatal("expected the receipt tracker to be hooked")
+	}
+
+	// the receipts of the publications of a message with the same ID are all tracked
+	clk := newMockClock()
+	rt := newReceiptTracker(ps.idGen, clk)
+	receipt := func() *DeliveryReceipt {
+		r := &DeliveryReceipt{id: "mid", mode: ReceiptOnSend, sends: 1, done: make(chan struct{})}
+		rt.track(r, time.Minute)
+		return r
+	}
+	r1, r2, r3 := receipt(), receipt(), receipt()
+	rt.untrack(r2)
+	rt.sent("mid")
+	for _, r := range []*DeliveryReceipt{r1, r3} {
+		if err := r.Err(); err != nil {
+			t.Fatalf("expected the receipts to complete, got %v", err)
+		}
+	}
+	if err := r2.Err(); err != ErrReceiptPending {
+		t.Fatalf("expected the untracked receipt to stay pending, got %v", err)
+	}
+	if rt.active() {
+		t.Fatal("expected no outstanding receipt")
+	}
+
+	// and they time out on the clock
+	r4 := receipt()
+	clk.Add(time.Minute)
+	select {
+	case <-r4.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected the receipt to time out")
+	}
+	if err := r4.Err(); err != ErrReceiptTimeout {
+		t.Fatalf("expected receipt timeout, got %v", err)
+	}
+	if rt.active() {
+		t.Fatal("expected no outstanding receipt")
+	}
+}
@@ -0,0 +1,60 @@
+package pubsub
+
+import (
+	"fmt"
+)
+
+// RelayValidationPolicy is the validation of the messages of a topic we only relay, with relay
+// references but no local subscription.
+type RelayValidationPolicy int
+
+const (
+	// RelayValidationFull validates relayed messages like any other: signature verification and
+	// all the validators. It is the default.
+	RelayValidationFull RelayValidationPolicy = iota
+	// RelayValidationSignatureOnly verifies the signatures of relayed messages, but skips the
+	// validators.
+	RelayValidationSignatureOnly
+	// RelayValidationNone forwards relayed messages without any verification.
+	RelayValidationNone
+)
+
+func (p RelayValidationPolicy) String() string {
+	switch p {
+	case RelayValidationFull:
+		return "Full"
+	case RelayValidationSignatureOnly:
+		return "SignatureOnly"
+	case RelayValidationNone:
+		return "None"
+	default:
+		return fmt.Sprintf("RelayValidationPolicy(%d)", int(p))
+	}
+}
+
+// WithRelayValidationPolicy sets the validation of the messages of a Topic while we relay it
+// without being subscribed to it, to spare the validators on pure relay traffic. The messages
+// passing the reduced validation are accepted: they are forwarded and count for the peer scores
+// like validated messages. Once subscribed, messages are validated fully again.
+func WithRelayValidationPolicy(policy RelayValidationPolicy) TopicOpt {
+	return func(t *Topic) error {
+		switch policy {
+		case RelayValidationFull, RelayValidationSignatureOnly, RelayValidationNone:
+		default:
+			return fmt.Errorf("invalid relay validation policy: %s", policy)
+		}
+		t.relayValidation = policy
+		return nil
+	}
+}
+
+// relayValidationPolicy returns the validation policy of the messages of a topic, which is
+// RelayValidationFull unless the topic is only relayed.
+// Only called from processLoop.
+func (p *PubSub) relayValidationPolicy(topic string) RelayValidationPolicy {
+	t, ok := p.myTopics[topic]
+	if !ok || p.myRelays[topic] == 0 || len(p.mySubs[topic]) > 0 {
+		return RelayValidationFull
+	}
+	return t.relayValidation
+}
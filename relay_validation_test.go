@@ -0,0 +1,83 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestRelayValidationPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy    RelayValidationPolicy
+		subscribe bool
+		forwarded bool
+		validated bool
+	}{
+		{policy: RelayValidationFull, forwarded: false, validated: true},
+		{policy: RelayValidationSignatureOnly, forwarded: true, validated: false},
+		{policy: RelayValidationNone, forwarded: true, validated: false},
+		// subscribed topics are always fully validated
+		{policy: RelayValidationNone, subscribe: true, forwarded: false, validated: true},
+	} {
+		t.Run(fmt.Sprintf("%s/subscribe=%t", tc.policy, tc.subscribe), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			hosts := getNetHosts(t, ctx, 3)
+			psubs := getGossipsubs(ctx, hosts)
+			connect(t, hosts[0], hosts[1])
+			connect(t, hosts[1], hosts[2])
+
+			// the relay rejects every message it validates
+			var validations atomic.Int32
+			err := psubs[1].RegisterTopicValidator("test", func(context.Context, peer.ID, *Message) bool {
+				validations.Add(1)
+				return false
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			relay, err := psubs[1].Join("test", WithRelayValidationPolicy(tc.policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := relay.Relay(); err != nil {
+				t.Fatal(err)
+			}
+			if tc.subscribe {
+				if _, err := relay.Subscribe(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sub := mustSubscribe(t, psubs[2], "test")
+			topic, err := psubs[0].Join("test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(2 * time.Second)
+
+			if err := topic.Publish(ctx, []byte("relayed")); err != nil {
+				t.Fatal(err)
+			}
+			if tc.forwarded {
+				assertReceive(t, sub, []byte("relayed"))
+			} else {
+				assertNeverReceives(t, sub, time.Second)
+			}
+			if validated := validations.Load() > 0; validated != tc.validated {
+				t.Fatalf("expected validated %t, got %t", tc.validated, validated)
+			}
+		})
+	}
+}
+
+func TestRelayValidationPolicyInvalid(t *testing.T) {
+	if err := WithRelayValidationPolicy(RelayValidationPolicy(42))(&Topic{}); err == nil {
+		t.Fatal("expected an invalid policy to be refused")
+	}
+}
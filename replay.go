@@ -0,0 +1,145 @@
+package pubsub
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p-pubsub/timecache"
+)
+
+var (
+	// DefaultReplayFilterSize is the default number of message IDs retained by a replay filter.
+	DefaultReplayFilterSize = 1 << 20
+	// DefaultReplayFilterTTL is the default retention of message IDs in a replay filter.
+	DefaultReplayFilterTTL = 7 * 24 * time.Hour
+)
+
+// ReplayStore persists the message IDs of a replay filter, so that replay protection
+// survives restarts.
+type ReplayStore interface {
+	// Load returns the persisted message IDs with their expiry.
+	Load() (map[string]time.Time, error)
+	// Store persists a newly seen message ID; the store may drop it after expiry.
+	Store(id string, expiry time.Time) error
+}
+
+// ReplayFilterParams configures the replay filter of an anonymous topic.
+type ReplayFilterParams struct {
+	// Size is the maximum number of message IDs retained; the oldest are evicted first.
+	Size int
+	// TTL is the retention of message IDs.
+	TTL time.Duration
+	// Store optionally persists the message IDs; it may be nil.
+	Store ReplayStore
+}
+
+// DefaultReplayFilterParams returns the default replay filter parameters, without persistence.
+func DefaultReplayFilterParams() ReplayFilterParams {
+	return ReplayFilterParams{
+		Size: DefaultReplayFilterSize,
+		TTL:  DefaultReplayFilterTTL,
+	}
+}
+
+// WithAnonymousPublishing makes a Topic anonymous: messages are published without an author,
+// seqno or signature, and received messages carrying them are rejected, as with a topic
+// StrictNoSign signature policy.
+//
+// Without a seqno, message IDs must be derived from an application supplied nonce in the
+// payload, so msgID is mandatory. Message IDs are retained by a replay filter for much longer
+// than the seen messages cache, bounded by the number of entries, and messages replayed
+// within that window are treated as duplicates.
+func WithAnonymousPublishing(msgID MsgIdFunction, params ReplayFilterParams) TopicOpt {
+	return func(t *Topic) error {
+		if msgID == nil {
+			return fmt.Errorf("anonymous publishing requires a message ID function")
+		}
+		if params.Size <= 0 {
+			return fmt.Errorf("invalid replay filter size: %d", params.Size)
+		}
+		if params.TTL <= 0 {
+			return fmt.Errorf("invalid replay filter ttl: %s", params.TTL)
+		}
+
+		rf, err := newReplayFilter(params, t.p.clock)
+		if err != nil {
+			return err
+		}
+
+		if err := WithTopicMessageSignaturePolicy(StrictNoSign)(t); err != nil {
+			return err
+		}
+		t.p.idGen.Set(t.topic, msgID)
+		t.replay = rf
+		return nil
+	}
+}
+
+// replayFilter retains the IDs of messages in an anonymous topic
+type replayFilter struct {
+	cache *timecache.BoundedCache
+	store ReplayStore
+}
+
+func newReplayFilter(params ReplayFilterParams, clock Clock) (*replayFilter, error) {
+	rf := &replayFilter{
+		cache: timecache.NewBoundedCache(params.TTL, params.Size, clock.Now),
+		store: params.Store,
+	}
+
+	if rf.store == nil {
+		return rf, nil
+	}
+
+	ids, err := rf.store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("error loading replay filter: %w", err)
+	}
+
+	// add in expiry order, so that the oldest entries are evicted first
+	entries := make([]string, 0, len(ids))
+	for id := range ids {
+		entries = append(entries, id)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return ids[entries[i]].Before(ids[entries[j]])
+	})
+	for _, id := range entries {
+		rf.cache.AddWithExpiry(id, ids[id])
+	}
+
+	return rf, nil
+}
+
+func (rf *replayFilter) Has(id string) bool {
+	return rf.cache.Has(id)
+}
+
+func (rf *replayFilter) Add(id string) bool {
+	expiry, ok := rf.cache.AddWithExpiry(id, time.Time{})
+	if ok && rf.store != nil {
+		if err := rf.store.Store(id, expiry); err != nil {
+			log.Warnf("error persisting replay filter entry: %s", err)
+		}
+	}
+	return ok
+}
+
+func (p *PubSub) setTopicReplayFilter(topic string, rf *replayFilter) {
+	p.topicOptsMx.Lock()
+	defer p.topicOptsMx.Unlock()
+
+	if rf == nil {
+		delete(p.replayFilters, topic)
+		return
+	}
+	p.replayFilters[topic] = rf
+}
+
+func (p *PubSub) topicReplayFilter(topic string) *replayFilter {
+	p.topicOptsMx.RLock()
+	defer p.topicOptsMx.RUnlock()
+
+	return p.replayFilters[topic]
+}
@@ -0,0 +1,107 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+type memReplayStore struct {
+	mx  sync.Mutex
+	ids map[string]time.Time
+}
+
+func (s *memReplayStore) Load() (map[string]time.Time, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	ids := make(map[string]time.Time, len(s.ids))
+	for id, expiry := range s.ids {
+		ids[id] = expiry
+	}
+	return ids, nil
+}
+
+func (s *memReplayStore) Store(id string, expiry time.Time) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.ids[id] = expiry
+	return nil
+}
+
+func (s *memReplayStore) has(id string) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	_, ok := s.ids[id]
+	return ok
+}
+
+func TestAnonymousPublishing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const topic = "whistleblower"
+
+	// the payload is the nonce
+	nonceID := func(m *pb.Message) string {
+		return string(m.GetData())
+	}
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getGossipsubs(ctx, hosts)
+
+	// the receiver has seen the first nonce before restarting
+	store := &memReplayStore{ids: map[string]time.Time{
+		"nonce-1": time.Now().Add(time.Hour),
+	}}
+
+	if _, err := psubs[0].Join(topic, WithAnonymousPublishing(nil, DefaultReplayFilterParams())); err == nil {
+		t.Fatal("expected an error without a message ID function")
+	}
+
+	pub, err := psubs[0].Join(topic, WithAnonymousPublishing(nonceID, DefaultReplayFilterParams()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := DefaultReplayFilterParams()
+	params.Store = store
+	tp, err := psubs[1].Join(topic, WithAnonymousPublishing(nonceID, params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := tp.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(time.Second)
+
+	if err := pub.Publish(ctx, []byte("nonce-1")); err != nil {
+		t.Fatal(err)
+	}
+	assertNeverReceives(t, sub, time.Second)
+
+	if err := pub.Publish(ctx, []byte("nonce-2")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.From != nil || msg.Seqno != nil || msg.Signature != nil {
+		t.Fatal("expected an anonymous message")
+	}
+	if msg.ReceivedFrom != hosts[0].ID() {
+		t.Fatal("expected the message to be attributed to the relay")
+	}
+	if !store.has("nonce-2") {
+		t.Fatal("expected the nonce to be persisted")
+	}
+}
@@ -0,0 +1,185 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+var (
+	// ErrNotGossipSub is returned by the operations requiring the gossipsub router.
+	ErrNotGossipSub = errors.New("pubsub router is not gossipsub")
+
+	// ErrMessageSeen is returned by RequestMessage for a message seen and no longer cached.
+	ErrMessageSeen = errors.New("message already seen and no longer cached")
+
+	// ErrNoRequestPeers is returned by RequestMessage when no mesh peer of the topic can be asked
+	// for the message, as the mesh is empty or the peers reached their request limits.
+	ErrNoRequestPeers = errors.New("no mesh peer to request the message from")
+)
+
+// RequestMessage asks the mesh peers of a topic we joined for a message by ID, with an IWANT, and
+// waits until the message passes validation, to fill a gap detected by the application. Messages
+// already seen are returned from the message cache if still there, or fail with ErrMessageSeen.
+// Concurrent requests for a message share a single IWANT. The IWANTs count against the IWANT
+// budget of the peers for the heartbeat, and each peer is asked for at most MaxPendingRequests
+// messages at a time. The request lasts until ctx is done.
+func (p *PubSub) RequestMessage(ctx context.Context, topic string, msgID string) (*Message, error) {
+	gs, ok := p.rt.(*GossipSubRouter)
+	if !ok {
+		return nil, ErrNotGossipSub
+	}
+
+	w := make(chan *Message, 1)
+	errc := make(chan error, 1)
+	select {
+	case p.eval <- func() { errc <- gs.requestMessage(topic, msgID, w) }:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.ctx.Done():
+		return nil, p.ctx.Err()
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-w:
+		return msg, nil
+	case <-ctx.Done():
+	case <-p.ctx.Done():
+		return nil, p.ctx.Err()
+	}
+
+	// withdraw the request, unless the message just arrived
+	select {
+	case p.eval <- func() { gs.withdrawRequest(topic, msgID, w) }:
+	case <-p.ctx.Done():
+	}
+	select {
+	case msg := <-w:
+		return msg, nil
+	default:
+		return nil, ctx.Err()
+	}
+}
+
+// messageRequestKey is the topic and ID of a requested message; a message is only handed to the
+// requests for its topic
+type messageRequestKey struct {
+	topic string
+	mid   string
+}
+
+// messageRequest is a pending request of a message by ID
+type messageRequest struct {
+	// peers are the peers asked for the message
+	peers []peer.ID
+	// waiters receive the message once validated
+	waiters []chan<- *Message
+}
+
+// requestMessage sends an IWANT for a message to the mesh peers of a topic, or adds a waiter to
+// the pending request. The waiter is served at once if the message is in the cache.
+// Only called from processLoop.
+func (gs *GossipSubRouter) requestMessage(topic, mid string, w chan<- *Message) error {
+	// the waiters get a copy, as the cached message is forwarded to the peers asking for it
+	if msg, ok := gs.mcache.Get(mid); ok && msg.GetTopic() == topic {
+		w <- copyMessage(msg)
+		return nil
+	}
+	if gs.p.seenMessage(topic, mid) {
+		// another copy would be dropped as a duplicate
+		return ErrMessageSeen
+	}
+
+	key := messageRequestKey{topic: topic, mid: mid}
+	if req, ok := gs.requests[key]; ok {
+		req.waiters = append(req.waiters, w)
+		return nil
+	}
+
+	mesh, ok := gs.mesh[topic]
+	if !ok {
+		return ErrNoRequestPeers
+	}
+
+	req := &messageRequest{waiters: []chan<- *Message{w}}
+	for p := range mesh {
+		if gs.iasked[p] >= gs.params.MaxIHaveLength || gs.pendingRequests[p] >= gs.params.MaxPendingRequests {
+			continue
+		}
+		req.peers = append(req.peers, p)
+	}
+	if len(req.peers) == 0 {
+		return ErrNoRequestPeers
+	}
+
+	if gs.requests == nil {
+		gs.requests = make(map[messageRequestKey]*messageRequest)
+		gs.pendingRequests = make(map[peer.ID]int)
+	}
+	gs.requests[key] = req
+
+	// the peers never advertised the message, so no promise is tracked
+	iwant := []*pb.ControlIWant{{MessageIDs: []string{mid}}}
+	for _, p := range req.peers {
+		gs.iasked[p]++
+		gs.pendingRequests[p]++
+		gs.trackIWants(p, []string{mid})
+		gs.sendRPC(p, rpcWithControl(nil, nil, iwant, nil, nil))
+	}
+	return nil
+}
+
+// withdrawRequest removes a waiter of a message, dropping the request with the last one.
+// Only called from processLoop.
+func (gs *GossipSubRouter) withdrawRequest(topic, mid string, w chan<- *Message) {
+	key := messageRequestKey{topic: topic, mid: mid}
+	req, ok := gs.requests[key]
+	if !ok {
+		return
+	}
+
+	for i, rw := range req.waiters {
+		if rw == w {
+			req.waiters = append(req.waiters[:i], req.waiters[i+1:]...)
+			break
+		}
+	}
+	if len(req.waiters) == 0 {
+		gs.endRequest(key, req)
+	}
+}
+
+// fulfillRequest hands a validated message to the waiters of its pending request, if any.
+// Only called from processLoop.
+func (gs *GossipSubRouter) fulfillRequest(msg *Message) {
+	if len(gs.requests) == 0 {
+		return
+	}
+
+	key := messageRequestKey{topic: msg.GetTopic(), mid: gs.p.idGen.ID(msg)}
+	req, ok := gs.requests[key]
+	if !ok {
+		return
+	}
+
+	for _, w := range req.waiters {
+		w <- copyMessage(msg)
+	}
+	gs.endRequest(key, req)
+}
+
+// endRequest drops a request, releasing the request slots of its peers
+func (gs *GossipSubRouter) endRequest(key messageRequestKey, req *messageRequest) {
+	delete(gs.requests, key)
+	for _, p := range req.peers {
+		if gs.pendingRequests[p]--; gs.pendingRequests[p] <= 0 {
+			delete(gs.pendingRequests, p)
+		}
+	}
+}
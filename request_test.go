@@ -0,0 +1,182 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestRequestMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the receiver misses the first copy of the message, and counts the IWANTs it sends
+	var mx sync.Mutex
+	var missed string
+	iwants := 0
+	params := DefaultGossipSubParams()
+	params.MaxPendingRequests = 2
+	hosts := getNetHosts(t, ctx, 2)
+	sender := getGossipsub(ctx, hosts[0])
+	receiver := getGossipsub(ctx, hosts[1],
+		WithGossipSubParams(params),
+		WithInboundRPCHook(func(pid peer.ID, rpc *RPC) *RPC {
+			mx.Lock()
+			defer mx.Unlock()
+			for _, pmsg := range rpc.Publish {
+				if string(pmsg.Data) == "missed" && missed == "" {
+					missed = DefaultMsgIdFn(pmsg)
+					return nil
+				}
+			}
+			return rpc
+		}),
+		WithOutboundRPCHook(func(pid peer.ID, rpc *RPC) *RPC {
+			mx.Lock()
+			defer mx.Unlock()
+			for _, iwant := range rpc.GetControl().GetIwant() {
+				iwants += len(iwant.MessageIDs)
+			}
+			return rpc
+		}))
+
+	if _, err := receiver.RequestMessage(ctx, "test", "id"); !errors.Is(err, ErrNoRequestPeers) {
+		t.Fatalf("expected ErrNoRequestPeers outside the topic, got %v", err)
+	}
+
+	mustSubscribe(t, sender, "test")
+	sub := mustSubscribe(t, receiver, "test")
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(time.Second)
+
+	if err := sender.Publish("test", []byte("missed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Publish("test", []byte("next")); err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, sub, []byte("next"))
+
+	mx.Lock()
+	mid := missed
+	mx.Unlock()
+
+	// concurrent requests share the IWANT
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rctx, rcancel := context.WithTimeout(ctx, 5*time.Second)
+			defer rcancel()
+			msg, err := receiver.RequestMessage(rctx, "test", mid)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if string(msg.Data) != "missed" {
+				t.Errorf("unexpected message %q", msg.Data)
+			}
+		}()
+	}
+	wg.Wait()
+	assertReceive(t, sub, []byte("missed"))
+
+	// and the message is served from the cache afterwards
+	msg, err := receiver.RequestMessage(ctx, "test", mid)
+	if err != nil || string(msg.Data) != "missed" {
+		t.Fatalf("expected the message from the cache, got %v", err)
+	}
+
+	mx.Lock()
+	if iwants != 1 {
+		t.Fatalf("expected a single IWANT, got %d", iwants)
+	}
+	mx.Unlock()
+
+	// requests of unknown messages time out, holding the request slots of the peer meanwhile
+	results := make(chan error, 2)
+	for _, id := range []string{"unknown1", "unknown2"} {
+		go func(id string) {
+			rctx, rcancel := context.WithTimeout(ctx, 500*time.Millisecond)
+			defer rcancel()
+			_, err := receiver.RequestMessage(rctx, "test", id)
+			results <- err
+		}(id)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := receiver.RequestMessage(ctx, "test", "unknown3"); !errors.Is(err, ErrNoRequestPeers) {
+		t.Fatalf("expected ErrNoRequestPeers past the pending request limit, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-results; !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the request to time out, got %v", err)
+		}
+	}
+
+	// and release them when done
+	done := make(chan int)
+	receiver.eval <- func() { done <- len(receiver.rt.(*GossipSubRouter).pendingRequests) }
+	if n := <-done; n != 0 {
+		t.Fatalf("expected no pending request left, got %d", n)
+	}
+
+	floodsub := getPubsub(ctx, getNetHosts(t, ctx, 1)[0])
+	if _, err := floodsub.RequestMessage(ctx, "test", mid); !errors.Is(err, ErrNotGossipSub) {
+		t.Fatalf("expected ErrNotGossipSub, got %v", err)
+	}
+}
+
+func TestRequestMessageTopics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pid := peer.ID("peer")
+	_, gs, eval := chokeTestRouter(t, ctx, DefaultGossipSubParams(), map[peer.ID]protocol.ID{
+		pid: GossipSubID_v11,
+	})
+
+	topic := "test"
+	msg := &Message{Message: &pb.Message{From: []byte("author"), Seqno: []byte("1"), Topic: &topic, Data: []byte("data")}}
+	forTopic, forOther := make(chan *Message, 1), make(chan *Message, 1)
+	eval(func() {
+		gs.mesh["other"] = map[peer.ID]struct{}{pid: {}}
+		mid := gs.p.idGen.ID(msg)
+		if err := gs.requestMessage("test", mid, forTopic); err != nil {
+			t.Error(err)
+		}
+		if err := gs.requestMessage("other", mid, forOther); err != nil {
+			t.Error(err)
+		}
+		if len(gs.requests) != 2 {
+			t.Errorf("expected a request per topic, got %d", len(gs.requests))
+		}
+		gs.fulfillRequest(msg)
+	})
+
+	// the message is only handed to the request of its topic, as a copy
+	select {
+	case got := <-forTopic:
+		if got == msg || got.Message == msg.Message {
+			t.Fatal("expected a copy of the message")
+		}
+		got.Data[0] = 'x'
+		if string(msg.Data) != "data" {
+			t.Fatal("expected the message to be unaffected by changes to the copy")
+		}
+	default:
+		t.Fatal("expected the request of the topic to be fulfilled")
+	}
+	select {
+	case <-forOther:
+		t.Fatal("expected the request of another topic to be pending")
+	default:
+	}
+}
@@ -0,0 +1,66 @@
+package pubsub
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// RPCHook is an application middleware applied to the RPCs exchanged with a peer, returning the
+// RPC to carry on with, a replacement, or nil to drop it.
+type RPCHook func(pid peer.ID, rpc *RPC) *RPC
+
+// WithOutboundRPCHook adds a hook applied to the RPCs sent to a peer just before they are
+// serialized, in the writer goroutine of the peer. Hooks compose in registration order, and an
+// RPC dropped by a hook is not passed to the next ones.
+// The RPC may be shared by the peers it is sent to, so it must not be modified: a hook altering
+// it returns a copy, with copies of the parts it modifies, which is then marshaled afresh.
+// Hooks run for every RPC and are on the critical path of sending, so they must be fast.
+func WithOutboundRPCHook(hook RPCHook) Option {
+	return func(p *PubSub) error {
+		p.outboundHooks = append(p.outboundHooks, hook)
+		return nil
+	}
+}
+
+// WithInboundRPCHook adds a hook applied to the RPCs received from a peer right after they are
+// decoded and before they are processed, in the reader goroutine of the peer. Hooks compose in
+// registration order, and an RPC dropped by a hook is not passed to the next ones.
+// The hooks may modify the RPC in place or replace it, and must not retain it. As they may alter
+// the payload messages, the received wire bytes are not reused for forwarding while any inbound
+// hook is set. Hooks run for every RPC and hold up the reading of the stream, so they must be fast.
+func WithInboundRPCHook(hook RPCHook) Option {
+	return func(p *PubSub) error {
+		p.inboundHooks = append(p.inboundHooks, hook)
+		return nil
+	}
+}
+
+// applyRPCHooks passes an RPC through hooks, returning nil if one of them dropped it
+func applyRPCHooks(hooks []RPCHook, pid peer.ID, rpc *RPC) *RPC {
+	for _, hook := range hooks {
+		if rpc = hook(pid, rpc); rpc == nil {
+			return nil
+		}
+	}
+	return rpc
+}
+
+// hookOutbound applies the outbound hooks to an RPC about to be sent to a peer, dropping the
+// shared marshaled form of a replacement, whose content may differ
+func (p *PubSub) hookOutbound(pid peer.ID, rpc *RPC) *RPC {
+	res := applyRPCHooks(p.outboundHooks, pid, rpc)
+	if res != nil && res != rpc {
+		res.frame = nil
+		res.extra = nil
+	}
+	return res
+}
+
+// hookInbound applies the inbound hooks to an RPC received from a peer. The RPC is returned to
+// the pool if dropped, but not if replaced, as the replacement may share its parts.
+func (p *PubSub) hookInbound(pid peer.ID, rpc *RPC) *RPC {
+	res := applyRPCHooks(p.inboundHooks, pid, rpc)
+	if res == nil {
+		p.releaseRPC(rpc)
+	}
+	return res
+}
@@ -0,0 +1,102 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+// reverseRPC returns a copy of an RPC with the payloads of its messages reversed
+func reverseRPC(rpc *RPC) *RPC {
+	res := *rpc
+	res.Publish = make([]*pb.Message, len(rpc.Publish))
+	for i, pmsg := range rpc.Publish {
+		cp := *pmsg
+		cp.Data = slices.Clone(pmsg.Data)
+		slices.Reverse(cp.Data)
+		res.Publish[i] = &cp
+	}
+	return &res
+}
+
+func TestRPCHooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mx sync.Mutex
+	var order []string
+	record := func(name string) RPCHook {
+		return func(pid peer.ID, rpc *RPC) *RPC {
+			if len(rpc.Publish) > 0 {
+				mx.Lock()
+				order = append(order, name)
+				mx.Unlock()
+			}
+			return rpc
+		}
+	}
+
+	// the payloads are reversed on the wire, and the drop ones dropped by the sender
+	hosts := getNetHosts(t, ctx, 2)
+	sender := getPubsub(ctx, hosts[0],
+		WithMessageSignaturePolicy(StrictNoSign),
+		WithOutboundRPCHook(record("first")),
+		WithOutboundRPCHook(func(pid peer.ID, rpc *RPC) *RPC {
+			for _, pmsg := range rpc.Publish {
+				if string(pmsg.Data) == "drop" {
+					return nil
+				}
+			}
+			if len(rpc.Publish) == 0 {
+				return rpc
+			}
+			return reverseRPC(rpc)
+		}),
+		WithOutboundRPCHook(record("last")))
+
+	var wire [][]byte
+	receiver := getPubsub(ctx, hosts[1],
+		WithMessageSignaturePolicy(StrictNoSign),
+		WithInboundRPCHook(func(pid peer.ID, rpc *RPC) *RPC {
+			if pid != hosts[0].ID() {
+				t.Errorf("unexpected peer %s", pid)
+			}
+			mx.Lock()
+			for _, pmsg := range rpc.Publish {
+				wire = append(wire, slices.Clone(pmsg.Data))
+			}
+			mx.Unlock()
+			return rpc
+		}),
+		WithInboundRPCHook(func(pid peer.ID, rpc *RPC) *RPC {
+			return reverseRPC(rpc)
+		}))
+
+	sub := mustSubscribe(t, receiver, "test")
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(100 * time.Millisecond)
+
+	for _, data := range []string{"hello", "drop", "world"} {
+		if err := sender.Publish("test", []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertReceive(t, sub, []byte("hello"))
+	assertReceive(t, sub, []byte("world"))
+
+	mx.Lock()
+	defer mx.Unlock()
+	if len(wire) != 2 || !bytes.Equal(wire[0], []byte("olleh")) || !bytes.Equal(wire[1], []byte("dlrow")) {
+		t.Fatalf("expected the reversed payloads on the wire, got %q", wire)
+	}
+	if !slices.Equal(order, []string{"first", "last", "first", "first", "last"}) {
+		t.Fatalf("expected the hooks to run in registration order, got %v", order)
+	}
+}
@@ -0,0 +1,150 @@
+package pubsub
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// reasons for exceeding the inbound RPC limits
+const (
+	RPCRateExceeded     = "rpc rate exceeded"
+	RPCMessagesExceeded = "rpc messages exceeded"
+	RPCSizeExceeded     = "rpc size exceeded"
+)
+
+// RPCLimits bounds the RPCs received from each peer.
+// RPCs exceeding the soft limits are dropped, without closing the stream of the peer.
+type RPCLimits struct {
+	// MaxRPCSize is the hard limit on the size of inbound RPCs; the stream of a peer sending a
+	// larger RPC is reset, unless skipped per MaxOversizedRPCs. 0 applies the maximum message
+	// size set with WithMaxMessageSize.
+	MaxRPCSize int
+	// MaxOversizedRPCs is the number of RPCs larger than MaxRPCSize that are read and discarded
+	// on a stream, keeping the stream alive, before resetting it; 0 resets the stream on the
+	// first oversized RPC.
+	MaxOversizedRPCs int
+	// MaxSkipSize bounds the size of the oversized RPCs that are discarded; the stream of a peer
+	// sending a larger RPC is reset. 0 applies 4 times the maximum RPC size.
+	MaxSkipSize int
+	// BytesPerSecond is the soft limit on the RPC bytes received from a peer per second, allowing
+	// bursts of up to a second worth of bytes; 0 disables the limit.
+	BytesPerSecond int
+	// MaxMessagesPerRPC is the soft limit on the number of messages published in an RPC;
+	// 0 disables the limit.
+	MaxMessagesPerRPC int
+	// BehaviourPenalty is the number of behaviour penalties applied to the score of a peer for
+	// every RPC dropped, with gossipsub peer scoring; 0 disables the penalty.
+	BehaviourPenalty int
+	// ExemptDirectPeers exempts the direct peers of the router (see WithDirectPeers) from the
+	// soft limits.
+	ExemptDirectPeers bool
+}
+
+// WithRPCLimits sets the limits on the RPCs received from peers.
+// Dropped RPCs are reported to raw tracers implementing RPCLimitTracer.
+func WithRPCLimits(limits RPCLimits) Option {
+	return func(p *PubSub) error {
+		if limits.MaxRPCSize < 0 || limits.BytesPerSecond < 0 || limits.MaxMessagesPerRPC < 0 || limits.BehaviourPenalty < 0 ||
+			limits.MaxOversizedRPCs < 0 || limits.MaxSkipSize < 0 {
+			return fmt.Errorf("invalid rpc limits")
+		}
+		p.rpcLimits = limits
+		return nil
+	}
+}
+
+// RPCLimitTracer is an optional interface for RawTracers, which is invoked when an inbound RPC
+// is dropped for exceeding the soft RPC limits, or discarded for exceeding the maximum RPC size.
+// The reason argument is one of RPCRateExceeded, RPCMessagesExceeded or RPCSizeExceeded.
+type RPCLimitTracer interface {
+	RPCLimitExceeded(p peer.ID, size int, reason string)
+}
+
+// penaltyRouter is implemented by routers that penalize the misbehaviour of peers
+type penaltyRouter interface {
+	addBehaviourPenalty(p peer.ID, count int)
+}
+
+// maxRPCSize returns the hard limit on the size of inbound RPCs
+func (p *PubSub) maxRPCSize() int {
+	if p.rpcLimits.MaxRPCSize > 0 {
+		return p.rpcLimits.MaxRPCSize
+	}
+	return p.maxMessageSize
+}
+
+// skipsOversizedRPC returns whether an oversized RPC is discarded rather than resetting the
+// stream, given the number of oversized RPCs already discarded on the stream
+func (p *PubSub) skipsOversizedRPC(size uint64, skipped int) bool {
+	if skipped >= p.rpcLimits.MaxOversizedRPCs {
+		return false
+	}
+	maxSkip := uint64(p.rpcLimits.MaxSkipSize)
+	if maxSkip == 0 {
+		maxSkip = 4 * uint64(p.maxRPCSize())
+	}
+	return size <= maxSkip
+}
+
+// rpcRateLimiter is a token bucket bounding the RPC bytes received from a peer; it is owned by
+// the stream reading goroutine of the peer
+type rpcRateLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+	clock  Clock
+}
+
+// newRPCRateLimiter returns the rate limiter for the RPCs of a peer, or nil if unlimited
+func (p *PubSub) newRPCRateLimiter(pid peer.ID) *rpcRateLimiter {
+	if p.rpcLimits.BytesPerSecond == 0 || (p.rpcLimits.ExemptDirectPeers && p.isDirectPeer(pid)) {
+		return nil
+	}
+	rate := float64(p.rpcLimits.BytesPerSecond)
+	return &rpcRateLimiter{rate: rate, tokens: rate, last: p.clock.Now(), clock: p.clock}
+}
+
+// Allow accounts for an RPC of the given size, returning false if it must be dropped. An RPC is
+// accepted while tokens remain, even if larger than the bucket, so that large RPCs aren't
+// starved; the peer then has to wait for the bucket to refill.
+func (rl *rpcRateLimiter) Allow(size int) bool {
+	if rl == nil {
+		return true
+	}
+
+	now := rl.clock.Now()
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+	if rl.tokens > rl.rate {
+		rl.tokens = rl.rate
+	}
+	rl.last = now
+
+	if rl.tokens <= 0 {
+		return false
+	}
+	rl.tokens -= float64(size)
+	return true
+}
+
+// tooManyMessages returns whether an RPC from a peer exceeds the message count limit
+func (p *PubSub) tooManyMessages(pid peer.ID, rpc *RPC) bool {
+	limit := p.rpcLimits.MaxMessagesPerRPC
+	if limit == 0 || len(rpc.GetPublish()) <= limit {
+		return false
+	}
+	return !(p.rpcLimits.ExemptDirectPeers && p.isDirectPeer(pid))
+}
+
+// rpcLimitExceeded handles an RPC dropped for exceeding the soft limits
+func (p *PubSub) rpcLimitExceeded(pid peer.ID, size int, reason string) {
+	log.Debugf("dropping rpc of %d bytes from %s: %s", size, pid, reason)
+	p.tracer.RPCLimitExceeded(pid, size, reason)
+
+	if p.rpcLimits.BehaviourPenalty > 0 {
+		if pr, ok := p.rt.(penaltyRouter); ok {
+			pr.addBehaviourPenalty(pid, p.rpcLimits.BehaviourPenalty)
+		}
+	}
+}
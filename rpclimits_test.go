@@ -0,0 +1,215 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-varint"
+)
+
+type rpcLimitTracer struct {
+	noopRawTracer
+
+	mx      sync.Mutex
+	dropped map[string]int
+}
+
+func (t *rpcLimitTracer) RPCLimitExceeded(p peer.ID, size int, reason string) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.dropped[reason]++
+}
+
+func (t *rpcLimitTracer) count(reason string) int {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return t.dropped[reason]
+}
+
+func TestRPCRateLimiter(t *testing.T) {
+	clk := newMockClock()
+	rl := &rpcRateLimiter{rate: 100, tokens: 100, last: clk.Now(), clock: clk}
+
+	// a large RPC is accepted while tokens remain, then the peer has to wait
+	if !rl.Allow(150) {
+		t.Fatal("expected the first RPC to be allowed")
+	}
+	if rl.Allow(1) {
+		t.Fatal("expected the RPC to be dropped")
+	}
+	clk.Add(time.Second)
+	if !rl.Allow(1) {
+		t.Fatal("expected the RPC to be allowed after refilling")
+	}
+
+	// the bucket doesn't fill beyond a second worth of bytes
+	clk.Add(time.Minute)
+	if !rl.Allow(100) || rl.Allow(1) {
+		t.Fatal("expected the burst to be bounded")
+	}
+
+	var unlimited *rpcRateLimiter
+	if !unlimited.Allow(1 << 30) {
+		t.Fatal("expected no limit")
+	}
+}
+
+func TestRPCRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := newMockClock()
+	tracer := &rpcLimitTracer{dropped: make(map[string]int)}
+
+	hosts := getNetHosts(t, ctx, 2)
+	limited := getPubsub(ctx, hosts[0], WithClock(clk), WithRawTracer(tracer),
+		WithRPCLimits(RPCLimits{BytesPerSecond: 1024}))
+	sender := getPubsub(ctx, hosts[1])
+
+	sub := mustSubscribe(t, limited, "test")
+	mustSubscribe(t, sender, "test")
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(time.Millisecond * 100)
+
+	data := bytes.Repeat([]byte{'x'}, 600)
+	for i := 0; i < 10; i++ {
+		if err := sender.Publish("test", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	// the bucket is drained by the second message, as the clock doesn't advance
+	received := 0
+	for {
+		rctx, rcancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		_, err := sub.Next(rctx)
+		rcancel()
+		if err != nil {
+			break
+		}
+		received++
+	}
+	if received != 2 || tracer.count(RPCRateExceeded) != 8 {
+		t.Fatalf("expected 2 messages received and 8 dropped, got %d and %d", received, tracer.count(RPCRateExceeded))
+	}
+
+	// the peer can send again once the bucket refills
+	clk.Add(time.Second)
+	if err := sender.Publish("test", data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sub.Next(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRPCMessagesLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	direct := peer.ID("direct")
+	ps := getGossipsub(ctx, hosts[0],
+		WithDirectPeers([]peer.AddrInfo{{ID: direct}}),
+		WithRPCLimits(RPCLimits{MaxMessagesPerRPC: 1, ExemptDirectPeers: true}))
+
+	rpc := &RPC{RPC: pb.RPC{Publish: []*pb.Message{{}, {}}}}
+	if !ps.tooManyMessages(peer.ID("other"), rpc) {
+		t.Fatal("expected the RPC to exceed the limit")
+	}
+	if ps.tooManyMessages(direct, rpc) {
+		t.Fatal("expected the direct peer to be exempt")
+	}
+	rpc.Publish = rpc.Publish[:1]
+	if ps.tooManyMessages(peer.ID("other"), rpc) {
+		t.Fatal("expected the RPC to be within the limit")
+	}
+
+	if _, err := NewFloodSub(ctx, hosts[0], WithRPCLimits(RPCLimits{BytesPerSecond: -1})); err == nil {
+		t.Fatal("expected an error for invalid limits")
+	}
+}
+
+func TestRPCReaderSkip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, size := range []int{10, 100, 0, 20} {
+		buf.Write(varint.ToUvarint(uint64(size)))
+		buf.Write(bytes.Repeat([]byte{byte(size)}, size))
+	}
+
+	r := newRPCReader(&buf, 50, true)
+	msg, err := r.ReadMsg()
+	if err != nil || len(msg) != 10 {
+		t.Fatalf("expected a message of 10 bytes, got %d: %v", len(msg), err)
+	}
+	r.ReleaseMsg(msg)
+
+	_, err = r.ReadMsg()
+	oe, ok := err.(*oversizedRPCError)
+	if !ok || oe.size != 100 {
+		t.Fatalf("expected an oversized rpc error, got %v", err)
+	}
+	if err := r.Skip(oe.size); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg, err := r.ReadMsg(); err != nil || len(msg) != 0 {
+		t.Fatalf("expected an empty message, got %d: %v", len(msg), err)
+	}
+	msg, err = r.ReadMsg()
+	if err != nil || !bytes.Equal(msg, bytes.Repeat([]byte{20}, 20)) {
+		t.Fatalf("expected the message after the skipped one, got %v: %v", msg, err)
+	}
+	r.ReleaseMsg(msg)
+
+	if _, err := r.ReadMsg(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestOversizedRPCs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracer := &rpcLimitTracer{dropped: make(map[string]int)}
+
+	hosts := getNetHosts(t, ctx, 2)
+	limited := getPubsub(ctx, hosts[0], WithRawTracer(tracer),
+		WithRPCLimits(RPCLimits{MaxRPCSize: 2048, MaxOversizedRPCs: 2, MaxSkipSize: 8192}))
+	sender := getPubsub(ctx, hosts[1])
+
+	sub := mustSubscribe(t, limited, "test")
+	mustSubscribe(t, sender, "test")
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(time.Millisecond * 100)
+
+	// an oversized message is discarded, and the stream keeps working
+	if err := sender.Publish("test", bytes.Repeat([]byte{'x'}, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Publish("test", []byte("small")); err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, sub, []byte("small"))
+	if tracer.count(RPCSizeExceeded) != 1 {
+		t.Fatalf("expected an oversized rpc, got %d", tracer.count(RPCSizeExceeded))
+	}
+
+	if !limited.skipsOversizedRPC(8192, 1) {
+		t.Fatal("expected a second oversized rpc to be skipped")
+	}
+	if limited.skipsOversizedRPC(8193, 1) {
+		t.Fatal("expected an rpc over the skip size to reset the stream")
+	}
+	if limited.skipsOversizedRPC(4096, 2) {
+		t.Fatal("expected the stream to be reset after the maximum oversized rpcs")
+	}
+}
@@ -0,0 +1,70 @@
+package pubsub
+
+import (
+	"sync"
+
+	pool "github.com/libp2p/go-buffer-pool"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+// WithoutPooling disables the reuse of received RPCs and of the buffers RPCs are read and
+// marshaled into, which is meant for debugging.
+//
+// With pooling, a received RPC is reused once the event loop has handled it, so the RPCs
+// handed to routers, raw tracers and RPC inspectors are only valid for the duration of the
+// call; retaining one shows up as an RPC changing under its holder, which disappears with
+// this option. The payload messages, subscriptions and control messages of an RPC are never
+// reused, as they are delivered to subscriptions and retained in the message cache.
+func WithoutPooling() Option {
+	return func(p *PubSub) error {
+		p.noPooling = true
+		return nil
+	}
+}
+
+var rpcPool = sync.Pool{
+	New: func() any { return new(RPC) },
+}
+
+// newIncomingRPC returns an RPC to unmarshal a received RPC into
+func (p *PubSub) newIncomingRPC() *RPC {
+	if p.noPooling {
+		return new(RPC)
+	}
+	return rpcPool.Get().(*RPC)
+}
+
+// releaseRPC returns a received RPC to the pool once handled, keeping only the backing arrays
+// of its slices
+func (p *PubSub) releaseRPC(rpc *RPC) {
+	if p.noPooling {
+		return
+	}
+
+	clear(rpc.Subscriptions)
+	clear(rpc.Publish)
+	clear(rpc.checks)
+	*rpc = RPC{
+		RPC: pb.RPC{
+			Subscriptions: rpc.Subscriptions[:0],
+			Publish:       rpc.Publish[:0],
+		},
+		checks: rpc.checks[:0],
+	}
+	rpcPool.Put(rpc)
+}
+
+// getBuffer returns a buffer of n bytes, to be released with putBuffer
+func (p *PubSub) getBuffer(n int) []byte {
+	if p.noPooling {
+		return make([]byte, n)
+	}
+	return pool.Get(n)
+}
+
+func (p *PubSub) putBuffer(buf []byte) {
+	if !p.noPooling && buf != nil {
+		pool.Put(buf)
+	}
+}
@@ -0,0 +1,138 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestRPCPooling(t *testing.T) {
+	topic := "test"
+	subscribe := true
+	first, _ := (&pb.RPC{
+		Subscriptions: []*pb.RPC_SubOpts{{Subscribe: &subscribe, Topicid: &topic}},
+		Publish:       []*pb.Message{{Data: []byte("first"), Topic: &topic}},
+	}).Marshal()
+	second, _ := (&pb.RPC{
+		Publish: []*pb.Message{{Data: []byte("second"), Topic: &topic}},
+	}).Marshal()
+
+	p := &PubSub{}
+	rpc := p.newIncomingRPC()
+	if err := rpc.Unmarshal(first); err != nil {
+		t.Fatal(err)
+	}
+	rpc.scanPublish(first, true)
+	rpc.from = peer.ID("sender")
+	pmsg := rpc.Publish[0]
+	p.releaseRPC(rpc)
+
+	// a released RPC is reset, leaving the retained payload messages intact
+	if rpc.from != "" || rpc.wire != nil || len(rpc.Subscriptions) != 0 || len(rpc.Publish) != 0 {
+		t.Fatalf("expected the released RPC to be reset, got %+v", rpc)
+	}
+	if err := rpc.Unmarshal(second); err != nil {
+		t.Fatal(err)
+	}
+	if len(rpc.Publish) != 1 || string(rpc.Publish[0].Data) != "second" || len(rpc.Subscriptions) != 0 {
+		t.Fatalf("expected the reused RPC to hold the second RPC only, got %+v", rpc)
+	}
+	if string(pmsg.Data) != "first" {
+		t.Fatal("expected the payload message of the released RPC to be left intact")
+	}
+
+	// nothing is reused without pooling
+	p = &PubSub{noPooling: true}
+	rpc = p.newIncomingRPC()
+	rpc.from = peer.ID("sender")
+	p.releaseRPC(rpc)
+	if rpc.from != "sender" {
+		t.Fatal("expected the RPC not to be released")
+	}
+}
+
+func TestWithoutPooling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	psubs := getGossipsubs(ctx, hosts, WithoutPooling())
+
+	var subs []*Subscription
+	for _, ps := range psubs {
+		subs = append(subs, mustSubscribe(t, ps, "test"))
+	}
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[1], hosts[2])
+	time.Sleep(2 * time.Second)
+
+	for i := 0; i < 10; i++ {
+		msg := []byte(fmt.Sprintf("message %d", i))
+		if err := psubs[0].Publish("test", msg); err != nil {
+			t.Fatal(err)
+		}
+		for _, sub := range subs {
+			assertReceive(t, sub, msg)
+		}
+	}
+}
+
+// BenchmarkPooling measures the allocations of the receive and forward path of a forwarding
+// peer, reading RPCs carrying a message and forwarding it to a mesh of D=8 peers, with and
+// without pooling. Run with -benchmem.
+func BenchmarkPooling(b *testing.B) {
+	const D = 8
+
+	topic := "test"
+	msg, _ := (&pb.RPC{Publish: []*pb.Message{{
+		From:      []byte(peer.ID("author")),
+		Data:      bytes.Repeat([]byte{'x'}, 1024),
+		Seqno:     []byte("12345678"),
+		Topic:     &topic,
+		Signature: bytes.Repeat([]byte{'s'}, 64),
+	}}}).Marshal()
+	frame := binary.AppendUvarint(nil, uint64(len(msg)))
+	frame = append(frame, msg...)
+
+	for _, pooled := range []bool{false, true} {
+		b.Run(fmt.Sprintf("Pooled=%t", pooled), func(b *testing.B) {
+			p := &PubSub{noPooling: !pooled}
+			stream := bytes.NewReader(bytes.Repeat(frame, b.N))
+			r := newRPCReader(stream, DefaultMaxMessageSize, pooled)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				data, err := r.ReadMsg()
+				if err != nil {
+					b.Fatal(err)
+				}
+				rpc := p.newIncomingRPC()
+				if err := rpc.Unmarshal(data); err != nil {
+					b.Fatal(err)
+				}
+				rpc.scanPublish(data, true)
+				r.ReleaseMsg(data)
+
+				in := &Message{Message: rpc.Publish[0], raw: rpc.rawMessage(0)}
+				p.releaseRPC(rpc)
+
+				out := p.outgoingRPC(in)
+				for j := 0; j < D; j++ {
+					buf := p.getBuffer(out.wireSize())
+					if err := out.marshalWire(buf); err != nil {
+						b.Fatal(err)
+					}
+					p.putBuffer(buf)
+				}
+			}
+		})
+	}
+}
@@ -78,6 +78,10 @@ type peerScore struct {
 
 	idGen *msgIDGenerator
 	host  host.Host
+	clock Clock
+
+	// penalizeUnauthorized returns whether unauthorized authors are penalized in a topic
+	penalizeUnauthorized func(topic string) bool
 
 	// debugging inspection
 	inspect       PeerScoreInspectFn
@@ -89,6 +93,7 @@ var _ RawTracer = (*peerScore)(nil)
 
 type messageDeliveries struct {
 	seenMsgTTL time.Duration
+	clock      Clock
 
 	records map[string]*deliveryRecord
 
@@ -189,8 +194,9 @@ func newPeerScore(params *PeerScoreParams) *peerScore {
 		params:     params,
 		peerStats:  make(map[peer.ID]*peerStats),
 		peerIPs:    make(map[string]map[peer.ID]struct{}),
-		deliveries: &messageDeliveries{seenMsgTTL: seenMsgTTL, records: make(map[string]*deliveryRecord)},
+		deliveries: &messageDeliveries{seenMsgTTL: seenMsgTTL, clock: realClock{}, records: make(map[string]*deliveryRecord)},
 		idGen:      newMsgIdGenerator(),
+		clock:      realClock{},
 	}
 }
 
@@ -248,6 +254,9 @@ func (ps *peerScore) Start(gs *GossipSubRouter) {
 
 	ps.idGen = gs.p.idGen
 	ps.host = gs.p.host
+	ps.clock = gs.p.clock
+	ps.deliveries.clock = gs.p.clock
+	ps.penalizeUnauthorized = gs.p.penalizeUnauthorizedAuthor
 	go ps.background(gs.p.ctx)
 }
 
@@ -406,33 +415,33 @@ func (ps *peerScore) AddPenalty(p peer.ID, count int) {
 
 // periodic maintenance
 func (ps *peerScore) background(ctx context.Context) {
-	refreshScores := time.NewTicker(ps.params.DecayInterval)
+	refreshScores := ps.clock.NewTicker(ps.params.DecayInterval)
 	defer refreshScores.Stop()
 
-	refreshIPs := time.NewTicker(time.Minute)
+	refreshIPs := ps.clock.NewTicker(time.Minute)
 	defer refreshIPs.Stop()
 
-	gcDeliveryRecords := time.NewTicker(time.Minute)
+	gcDeliveryRecords := ps.clock.NewTicker(time.Minute)
 	defer gcDeliveryRecords.Stop()
 
 	var inspectScores <-chan time.Time
 	if ps.inspect != nil || ps.inspectEx != nil {
-		ticker := time.NewTicker(ps.inspectPeriod)
+		ticker := ps.clock.NewTicker(ps.inspectPeriod)
 		defer ticker.Stop()
 		// also dump at exit for one final sample
 		defer ps.inspectScores()
-		inspectScores = ticker.C
+		inspectScores = ticker.C()
 	}
 
 	for {
 		select {
-		case <-refreshScores.C:
+		case <-refreshScores.C():
 			ps.refreshScores()
 
-		case <-refreshIPs.C:
+		case <-refreshIPs.C():
 			ps.refreshIPs()
 
-		case <-gcDeliveryRecords.C:
+		case <-gcDeliveryRecords.C():
 			ps.gcDeliveryRecords()
 
 		case <-inspectScores:
@@ -473,39 +482,60 @@ func (ps *peerScore) inspectScoresExtended() {
 	ps.Lock()
 	scores := make(map[peer.ID]*PeerScoreSnapshot, len(ps.peerStats))
 	for p, pstats := range ps.peerStats {
-		pss := new(PeerScoreSnapshot)
-		pss.Score = ps.score(p)
-		if len(pstats.topics) > 0 {
-			pss.Topics = make(map[string]*TopicScoreSnapshot, len(pstats.topics))
-			for t, ts := range pstats.topics {
-				tss := &TopicScoreSnapshot{
-					FirstMessageDeliveries:   ts.firstMessageDeliveries,
-					MeshMessageDeliveries:    ts.meshMessageDeliveries,
-					InvalidMessageDeliveries: ts.invalidMessageDeliveries,
-				}
-				if ts.inMesh {
-					tss.TimeInMesh = ts.meshTime
-				}
-				pss.Topics[t] = tss
-			}
-		}
-		pss.AppSpecificScore = ps.params.AppSpecificScore(p)
-		pss.IPColocationFactor = ps.ipColocationFactor(p)
-		pss.BehaviourPenalty = pstats.behaviourPenalty
-		scores[p] = pss
+		scores[p] = ps.snapshot(p, pstats)
 	}
 	ps.Unlock()
 
 	go ps.inspectEx(scores)
 }
 
+// Snapshot returns the score components of a peer, or nil if it has no score record
+func (ps *peerScore) Snapshot(p peer.ID) *PeerScoreSnapshot {
+	if ps == nil {
+		return nil
+	}
+
+	ps.Lock()
+	defer ps.Unlock()
+
+	pstats, ok := ps.peerStats[p]
+	if !ok {
+		return nil
+	}
+	return ps.snapshot(p, pstats)
+}
+
+// snapshot returns the score components of a peer; the caller must hold the lock
+func (ps *peerScore) snapshot(p peer.ID, pstats *peerStats) *PeerScoreSnapshot {
+	pss := new(PeerScoreSnapshot)
+	pss.Score = ps.score(p)
+	if len(pstats.topics) > 0 {
+		pss.Topics = make(map[string]*TopicScoreSnapshot, len(pstats.topics))
+		for t, ts := range pstats.topics {
+			tss := &TopicScoreSnapshot{
+				FirstMessageDeliveries:   ts.firstMessageDeliveries,
+				MeshMessageDeliveries:    ts.meshMessageDeliveries,
+				InvalidMessageDeliveries: ts.invalidMessageDeliveries,
+			}
+			if ts.inMesh {
+				tss.TimeInMesh = ts.meshTime
+			}
+			pss.Topics[t] = tss
+		}
+	}
+	pss.AppSpecificScore = ps.params.AppSpecificScore(p)
+	pss.IPColocationFactor = ps.ipColocationFactor(p)
+	pss.BehaviourPenalty = pstats.behaviourPenalty
+	return pss
+}
+
 // refreshScores decays scores, and purges score records for disconnected peers,
 // once their expiry has elapsed.
 func (ps *peerScore) refreshScores() {
 	ps.Lock()
 	defer ps.Unlock()
 
-	now := time.Now()
+	now := ps.clock.Now()
 	for p, pstats := range ps.peerStats {
 		if !pstats.connected {
 			// has the retention period expired?
@@ -640,7 +670,24 @@ func (ps *peerScore) RemovePeer(p peer.ID) {
 	}
 
 	pstats.connected = false
-	pstats.expire = time.Now().Add(ps.params.RetainScore)
+	pstats.expire = ps.clock.Now().Add(ps.params.RetainScore)
+}
+
+// ClearRetained drops the score retained for a disconnected peer
+func (ps *peerScore) ClearRetained(p peer.ID) {
+	if ps == nil {
+		return
+	}
+
+	ps.Lock()
+	defer ps.Unlock()
+
+	pstats, ok := ps.peerStats[p]
+	if !ok || pstats.connected {
+		return
+	}
+	ps.removeIPs(p, pstats.ips)
+	delete(ps.peerStats, p)
 }
 
 func (ps *peerScore) Join(topic string)  {}
@@ -661,7 +708,7 @@ func (ps *peerScore) Graft(p peer.ID, topic string) {
 	}
 
 	tstats.inMesh = true
-	tstats.graftTime = time.Now()
+	tstats.graftTime = ps.clock.Now()
 	tstats.meshTime = 0
 	tstats.meshMessageDeliveriesActive = false
 }
@@ -709,13 +756,13 @@ func (ps *peerScore) DeliverMessage(msg *Message) {
 
 	// defensive check that this is the first delivery trace -- delivery status should be unknown
 	if drec.status != deliveryUnknown {
-		log.Debugf("unexpected delivery trace: message from %s was first seen %s ago and has delivery status %d", msg.ReceivedFrom, time.Since(drec.firstSeen), drec.status)
+		log.Debugf("unexpected delivery trace: message from %s was first seen %s ago and has delivery status %d", msg.ReceivedFrom, ps.clock.Now().Sub(drec.firstSeen), drec.status)
 		return
 	}
 
 	// mark the message as valid and reward mesh peers that have already forwarded it to us
 	drec.status = deliveryValid
-	drec.validated = time.Now()
+	drec.validated = ps.clock.Now()
 	for p := range drec.peers {
 		// this check is to make sure a peer can't send us a message twice and get a double count
 		// if it is a first delivery.
@@ -740,6 +787,8 @@ func (ps *peerScore) RejectMessage(msg *Message, reason string) {
 	case RejectUnexpectedAuthInfo:
 		fallthrough
 	case RejectSelfOrigin:
+		fallthrough
+	case RejectMessageOpenFailed:
 		ps.markInvalidMessageDelivery(msg.ReceivedFrom, msg)
 		return
 
@@ -747,6 +796,19 @@ func (ps *peerScore) RejectMessage(msg *Message, reason string) {
 	case RejectBlacklstedPeer:
 		fallthrough
 	case RejectBlacklistedSource:
+		fallthrough
+	// the size limit is a local policy the peer may not be aware of
+	case RejectMessageTooLarge:
+		fallthrough
+	// the peer may run a version of the protocol with repeated topics
+	case RejectMultipleTopics:
+		return
+
+	case RejectUnauthorizedAuthor:
+		// the allow list is a local policy, which may or may not penalize the propagating peer
+		if ps.penalizeUnauthorized != nil && ps.penalizeUnauthorized(msg.GetTopic()) {
+			ps.markInvalidMessageDelivery(msg.ReceivedFrom, msg)
+		}
 		return
 
 	case RejectValidationQueueFull:
@@ -760,14 +822,14 @@ func (ps *peerScore) RejectMessage(msg *Message, reason string) {
 
 	// defensive check that this is the first rejection trace -- delivery status should be unknown
 	if drec.status != deliveryUnknown {
-		log.Debugf("unexpected rejection trace: message from %s was first seen %s ago and has delivery status %d", msg.ReceivedFrom, time.Since(drec.firstSeen), drec.status)
+		log.Debugf("unexpected rejection trace: message from %s was first seen %s ago and has delivery status %d", msg.ReceivedFrom, ps.clock.Now().Sub(drec.firstSeen), drec.status)
 		return
 	}
 
 	switch reason {
-	case RejectValidationThrottled:
-		// if we reject with "validation throttled" we don't penalize the peer(s) that forward it
-		// because we don't know if it was valid.
+	case RejectValidationThrottled, RejectValidationDeadline:
+		// if we reject with "validation throttled" or for a missed validation deadline, we don't
+		// penalize the peer(s) that forward it because we don't know if it was valid.
 		drec.status = deliveryThrottled
 		// release the delivery time tracking map to free some memory early
 		drec.peers = nil
@@ -843,7 +905,7 @@ func (d *messageDeliveries) getRecord(id string) *deliveryRecord {
 		return rec
 	}
 
-	now := time.Now()
+	now := d.clock.Now()
 
 	rec = &deliveryRecord{peers: make(map[peer.ID]struct{}), firstSeen: now}
 	d.records[id] = rec
@@ -865,7 +927,7 @@ func (d *messageDeliveries) gc() {
 		return
 	}
 
-	now := time.Now()
+	now := d.clock.Now()
 	for d.head != nil && now.After(d.head.expire) {
 		delete(d.records, d.head.id)
 		d.head = d.head.next
@@ -969,7 +1031,7 @@ func (ps *peerScore) markDuplicateMessageDelivery(p peer.ID, msg *Message, valid
 	// check against the mesh delivery window -- if the validated time is passed as 0, then
 	// the message was received before we finished validation and thus falls within the mesh
 	// delivery window.
-	if !validated.IsZero() && time.Since(validated) > tparams.MeshMessageDeliveriesWindow {
+	if !validated.IsZero() && ps.clock.Now().Sub(validated) > tparams.MeshMessageDeliveriesWindow {
 		return
 	}
 
@@ -32,6 +32,25 @@ type PeerScoreThresholds struct {
 	// OpportunisticGraftThreshold is the median mesh score threshold before triggering opportunistic
 	// grafting; this should have a small positive value.
 	OpportunisticGraftThreshold float64
+
+	// Topics overrides the gossip, publish and accept PX thresholds in some topics. The graylist
+	// threshold, which applies to all the RPCs of a peer, is only global.
+	Topics map[string]*TopicScoreThresholds
+}
+
+// TopicScoreThresholds are the score thresholds overriding the global ones in a topic, with the
+// same constraints; the global GraylistThreshold must be <= PublishThreshold.
+type TopicScoreThresholds struct {
+	// GossipThreshold is the score threshold below which we don't gossip to a peer in the topic.
+	GossipThreshold float64
+
+	// PublishThreshold is the score threshold below which we don't publish to a fanout, floodsub
+	// or flood publishing peer in the topic.
+	PublishThreshold float64
+
+	// AcceptPXThreshold is the score threshold below which the PX of a PRUNE in the topic is
+	// ignored.
+	AcceptPXThreshold float64
 }
 
 func (p *PeerScoreThresholds) validate() error {
@@ -60,6 +79,31 @@ func (p *PeerScoreThresholds) validate() error {
 		}
 	}
 
+	for topic, tp := range p.Topics {
+		if err := tp.validate(p.GraylistThreshold); err != nil {
+			return fmt.Errorf("invalid thresholds for topic %s: %w", topic, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *TopicScoreThresholds) validate(graylist float64) error {
+	if p == nil {
+		return fmt.Errorf("missing thresholds")
+	}
+	if p.GossipThreshold > 0 || isInvalidNumber(p.GossipThreshold) {
+		return fmt.Errorf("invalid gossip threshold; it must be <= 0 and a valid number")
+	}
+	if p.PublishThreshold > 0 || p.PublishThreshold > p.GossipThreshold || isInvalidNumber(p.PublishThreshold) {
+		return fmt.Errorf("invalid publish threshold; it must be <= 0 and <= gossip threshold and a valid number")
+	}
+	if graylist > p.PublishThreshold {
+		return fmt.Errorf("invalid publish threshold; it must be >= graylist threshold")
+	}
+	if p.AcceptPXThreshold < 0 || isInvalidNumber(p.AcceptPXThreshold) {
+		return fmt.Errorf("invalid accept PX threshold; it must be >= 0 and a valid number")
+	}
 	return nil
 }
 
@@ -118,6 +118,42 @@ func testPeerScoreThresholdsValidation(t *testing.T, skipAtomicValidation bool)
 	}
 }
 
+func TestTopicScoreThresholdsValidation(t *testing.T) {
+	thresholds := func(topic TopicScoreThresholds) *PeerScoreThresholds {
+		return &PeerScoreThresholds{
+			GossipThreshold:   -10,
+			PublishThreshold:  -20,
+			GraylistThreshold: -30,
+			Topics:            map[string]*TopicScoreThresholds{"test": &topic},
+		}
+	}
+
+	if thresholds(TopicScoreThresholds{GossipThreshold: -1, PublishThreshold: -2, AcceptPXThreshold: 1}).validate() != nil {
+		t.Fatal("expected validation success")
+	}
+	// the topic thresholds may be looser than the global ones, down to the graylist threshold
+	if thresholds(TopicScoreThresholds{GossipThreshold: -25, PublishThreshold: -30}).validate() != nil {
+		t.Fatal("expected validation success")
+	}
+
+	for _, topic := range []TopicScoreThresholds{
+		{GossipThreshold: 1},
+		{GossipThreshold: -1, PublishThreshold: 0},
+		{GossipThreshold: -1, PublishThreshold: -40},
+		{GossipThreshold: math.NaN(), PublishThreshold: -2},
+		{GossipThreshold: -1, PublishThreshold: -2, AcceptPXThreshold: -1},
+		{GossipThreshold: -1, PublishThreshold: -2, AcceptPXThreshold: math.Inf(0)},
+	} {
+		if thresholds(topic).validate() == nil {
+			t.Fatalf("expected validation error for %+v", topic)
+		}
+	}
+
+	if (&PeerScoreThresholds{Topics: map[string]*TopicScoreThresholds{"test": nil}}).validate() == nil {
+		t.Fatal("expected validation error")
+	}
+}
+
 func TestTopicScoreParamsValidation_InvalidParams_AtomicValidation(t *testing.T) {
 	testTopicScoreParamsValidationWithInvalidParameters(t, false)
 }
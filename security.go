@@ -0,0 +1,88 @@
+package pubsub
+
+import (
+	"fmt"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+// MessageSecurity provides payload confidentiality for a topic.
+//
+// Payloads are sealed before the message is signed, so that the signature covers the sealed
+// payload and relays without access to the keys can still verify and forward messages.
+// Received payloads are opened before validation, and validators and subscribers only ever
+// see the plaintext.
+type MessageSecurity interface {
+	// Seal encrypts a payload for publication.
+	Seal(plaintext []byte) ([]byte, error)
+	// Open decrypts a received payload.
+	Open(ciphertext []byte) ([]byte, error)
+}
+
+// WithMessageSecurity sets the MessageSecurity used to seal and open the payloads of a Topic.
+// Messages that cannot be opened are rejected with RejectMessageOpenFailed and penalized like
+// messages with invalid signatures.
+func WithMessageSecurity(sec MessageSecurity) TopicOpt {
+	return func(t *Topic) error {
+		if sec == nil {
+			return fmt.Errorf("nil message security")
+		}
+		t.security = sec
+		return nil
+	}
+}
+
+func (p *PubSub) setTopicSecurity(topic string, sec MessageSecurity) {
+	p.topicOptsMx.Lock()
+	defer p.topicOptsMx.Unlock()
+
+	if sec == nil {
+		delete(p.security, topic)
+		return
+	}
+	p.security[topic] = sec
+}
+
+func (p *PubSub) topicSecurity(topic string) MessageSecurity {
+	p.topicOptsMx.RLock()
+	defer p.topicOptsMx.RUnlock()
+
+	return p.security[topic]
+}
+
+// openMessage replaces the payload of a received message with its plaintext, retaining the
+// sealed message for forwarding.
+func (p *PubSub) openMessage(msg *Message) error {
+	if msg.wire != nil {
+		// already opened, or locally published
+		return nil
+	}
+
+	sec := p.topicSecurity(msg.GetTopic())
+	if sec == nil {
+		return nil
+	}
+
+	data, err := sec.Open(msg.Data)
+	if err != nil {
+		return err
+	}
+
+	// make sure the ID is computed on the wire format
+	p.idGen.ID(msg)
+
+	msg.wire = msg.Message
+	plain := *msg.Message
+	plain.Data = data
+	msg.Message = &plain
+
+	return nil
+}
+
+// wireMessage returns the message as it must be forwarded to peers.
+func (m *Message) wireMessage() *pb.Message {
+	if m.wire != nil {
+		return m.wire
+	}
+	return m.Message
+}
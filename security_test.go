@@ -0,0 +1,107 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// xorSecurity is a toy MessageSecurity; the key byte is prepended to sealed payloads so that
+// opening with the wrong key fails.
+type xorSecurity byte
+
+func (k xorSecurity) Seal(plaintext []byte) ([]byte, error) {
+	out := make([]byte, 0, len(plaintext)+1)
+	out = append(out, byte(k))
+	for _, b := range plaintext {
+		out = append(out, b^byte(k))
+	}
+	return out, nil
+}
+
+func (k xorSecurity) Open(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) == 0 || ciphertext[0] != byte(k) {
+		return nil, errors.New("wrong key")
+	}
+	out := make([]byte, 0, len(ciphertext)-1)
+	for _, b := range ciphertext[1:] {
+		out = append(out, b^byte(k))
+	}
+	return out, nil
+}
+
+func TestMessageSecurity(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const topic = "secret"
+
+	// 0 and 2 share a key, 1 relays without a key, 3 has the wrong key
+	hosts := getNetHosts(t, ctx, 4)
+	psubs := getPubsubs(ctx, hosts)
+
+	opts := [][]TopicOpt{
+		{WithMessageSecurity(xorSecurity(7))},
+		nil,
+		{WithMessageSecurity(xorSecurity(7))},
+		{WithMessageSecurity(xorSecurity(9))},
+	}
+
+	var topics []*Topic
+	var subs []*Subscription
+	for i, ps := range psubs {
+		tp, err := ps.Join(topic, opts[i]...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		topics = append(topics, tp)
+		sub, err := tp.Subscribe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[1], hosts[2])
+	connect(t, hosts[1], hosts[3])
+
+	time.Sleep(100 * time.Millisecond)
+
+	validated := make(chan []byte, 1)
+	err := psubs[2].RegisterTopicValidator(topic, func(_ context.Context, _ peer.ID, msg *Message) bool {
+		validated <- msg.Data
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("hello")
+	if err := topics[0].Publish(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// the publisher and the peer with the key see the plaintext
+	assertReceive(t, subs[0], data)
+	assertReceive(t, subs[2], data)
+	if v := <-validated; !bytes.Equal(v, data) {
+		t.Fatalf("validator saw %q", v)
+	}
+
+	// the relay sees the sealed payload but forwards it with a valid signature
+	msg, err := subs[1].Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(msg.Data, data) {
+		t.Fatal("relay received the plaintext")
+	}
+
+	// the peer with the wrong key rejects the message
+	assertNeverReceives(t, subs[3], time.Second)
+}
@@ -0,0 +1,76 @@
+package pubsub
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p-pubsub/timecache"
+)
+
+// SeenCache is an external cache of seen message IDs, which can be shared between PubSub
+// instances in a process or, backed by a remote store, between processes.
+// Implementations must be safe for concurrent use.
+type SeenCache interface {
+	// Add adds an id into the cache for ttl, if it is not already there.
+	// Returns true if the id was newly added to the cache.
+	Add(id string, ttl time.Duration) bool
+	// Has checks the cache for the presence of an id.
+	Has(id string) bool
+}
+
+// WithSeenMessagesCache makes the pubsub instance use an external cache for the seen messages,
+// in place of its own in-process cache. The TTLs set with WithSeenMessagesTTL and
+// WithSeenMessagesTopicTTL are passed to the cache as messages are seen; the strategy and the
+// size of the cache are up to the implementation. The cache is not closed by the instance.
+func WithSeenMessagesCache(cache SeenCache) Option {
+	return func(ps *PubSub) error {
+		ps.seenCache = cache
+		return nil
+	}
+}
+
+// TimeSeenCache is an in-process SeenCache, to be shared between PubSub instances.
+type TimeSeenCache struct {
+	tc *timecache.CappedCache
+}
+
+var _ SeenCache = (*TimeSeenCache)(nil)
+
+// NewTimeSeenCache creates a TimeSeenCache with the given strategy, retaining at most
+// maxEntries ids; a maxEntries of 0 doesn't bound the number of ids.
+func NewTimeSeenCache(strategy timecache.Strategy, maxEntries int) *TimeSeenCache {
+	return &TimeSeenCache{tc: timecache.NewCappedCache(strategy, TimeCacheDuration, maxEntries, time.Now)}
+}
+
+func (c *TimeSeenCache) Add(id string, ttl time.Duration) bool {
+	return c.tc.AddWithTTL(id, ttl)
+}
+
+func (c *TimeSeenCache) Has(id string) bool {
+	return c.tc.Has(id)
+}
+
+// Close stops the background expiry of the cache.
+func (c *TimeSeenCache) Close() {
+	c.tc.Done()
+}
+
+// externalSeenCache adapts a SeenCache to the seen messages cache of a pubsub instance
+type externalSeenCache struct {
+	c   SeenCache
+	ttl time.Duration
+}
+
+func (c *externalSeenCache) Add(id string) bool {
+	return c.c.Add(id, c.ttl)
+}
+
+func (c *externalSeenCache) AddWithTTL(id string, ttl time.Duration) bool {
+	return c.c.Add(id, ttl)
+}
+
+func (c *externalSeenCache) Has(id string) bool {
+	return c.c.Has(id)
+}
+
+// Done is a noop, as the cache may be shared.
+func (c *externalSeenCache) Done() {}
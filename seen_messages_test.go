@@ -0,0 +1,204 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-pubsub/timecache"
+)
+
+func TestSeenMessagesTopicTTL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := newMockClock()
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0],
+		WithClock(clk),
+		WithSeenMessagesTTL(time.Minute),
+		WithSeenMessagesTopicTTL("chain", 10*time.Minute),
+		WithSeenMessagesTopicTTL("telemetry", 30*time.Second),
+	)
+
+	for _, topic := range []string{"chain", "telemetry", "other"} {
+		if !ps.markSeen(topic, topic+"-msg") {
+			t.Fatalf("expected the %s message to be freshly marked", topic)
+		}
+		if ps.markSeen(topic, topic+"-msg") {
+			t.Fatalf("expected the %s message to be already seen", topic)
+		}
+	}
+
+	expect := func(topic string, seen bool) {
+		t.Helper()
+		if ps.seenMessage(topic, topic+"-msg") != seen {
+			t.Fatalf("expected the %s message seen to be %v at %s", topic, seen, clk.Now())
+		}
+	}
+
+	clk.Add(45 * time.Second)
+	expect("chain", true)
+	expect("telemetry", false)
+	expect("other", true)
+
+	clk.Add(time.Minute)
+	expect("chain", true)
+	expect("other", false)
+
+	clk.Add(10 * time.Minute)
+	expect("chain", false)
+}
+
+func TestSeenMessagesMaxEntries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0], WithSeenMessagesMaxEntries(10))
+
+	for i := 0; i < 100; i++ {
+		ps.markSeen("test", fmt.Sprintf("msg-%d", i))
+	}
+
+	for i := 0; i < 90; i++ {
+		if ps.seenMessage("test", fmt.Sprintf("msg-%d", i)) {
+			t.Fatalf("expected msg-%d to be evicted", i)
+		}
+	}
+	for i := 90; i < 100; i++ {
+		if !ps.seenMessage("test", fmt.Sprintf("msg-%d", i)) {
+			t.Fatalf("expected msg-%d to be retained", i)
+		}
+	}
+
+	for _, opt := range []Option{WithSeenMessagesMaxEntries(0), WithSeenMessagesTopicTTL("test", 0)} {
+		if _, err := NewFloodSub(ctx, hosts[0], opt); err == nil {
+			t.Fatal("expected an error for an invalid option")
+		}
+	}
+}
+
+func TestSeenMessagesStrategyReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	if _, err := NewFloodSub(ctx, hosts[0], WithSeenMessagesStrategy(timecache.Strategy(42))); err == nil {
+		t.Fatal("expected an error for an unknown strategy")
+	}
+
+	for _, strategy := range []timecache.Strategy{timecache.Strategy_FirstSeen, timecache.Strategy_LastSeen} {
+		clk := newMockClock()
+		ps := getPubsub(ctx, hosts[0], WithClock(clk), WithSeenMessagesTTL(time.Minute), WithSeenMessagesStrategy(strategy))
+
+		// replay the message every 40s for 10 minutes, as the message pipeline would see it
+		accepted := 0
+		for i := 0; i < 15; i++ {
+			if !ps.seenMessage("test", "replayed") && ps.markSeen("test", "replayed") {
+				accepted++
+			}
+			clk.Add(40 * time.Second)
+		}
+
+		switch {
+		case strategy == timecache.Strategy_FirstSeen && accepted != 8:
+			t.Fatalf("expected the replayed message to be accepted 8 times with first seen, got %d", accepted)
+		case strategy == timecache.Strategy_LastSeen && accepted != 1:
+			t.Fatalf("expected the replayed message to be accepted once with last seen, got %d", accepted)
+		}
+	}
+}
+
+func TestSharedSeenMessagesCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewTimeSeenCache(timecache.Strategy_FirstSeen, 0)
+	defer cache.Close()
+
+	// two shards sharing a seen cache, both connected to a publisher
+	hosts := getNetHosts(t, ctx, 3)
+	pub := getPubsub(ctx, hosts[0])
+	shards := []*PubSub{
+		getPubsub(ctx, hosts[1], WithSeenMessagesCache(cache)),
+		getPubsub(ctx, hosts[2], WithSeenMessagesCache(cache)),
+	}
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[0], hosts[2])
+
+	var subs []*Subscription
+	for _, ps := range shards {
+		subs = append(subs, mustSubscribe(t, ps, "test"))
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	if err := pub.Publish("test", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the message is only delivered by the shard that sees it first
+	received := 0
+	for _, sub := range subs {
+		rctx, rcancel := context.WithTimeout(ctx, time.Second)
+		if _, err := sub.Next(rctx); err == nil {
+			received++
+		}
+		rcancel()
+	}
+	if received != 1 {
+		t.Fatalf("expected the message to be delivered once, got %d", received)
+	}
+}
+
+func TestSeenMessagesSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.json")
+	clk := newMockClock()
+
+	// the snapshot is written when the instance shuts down
+	ctx, cancel := context.WithCancel(context.Background())
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0], WithClock(clk), WithSeenMessagesSnapshot(path))
+	ps.markSeen("test", "seen")
+	cancel()
+
+	for i := 0; ; i++ {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if i == 100 {
+			t.Fatal("expected the snapshot to be written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	hosts = getNetHosts(t, ctx, 3)
+
+	// a fresh snapshot is restored
+	clk.Add(5 * time.Second)
+	ps = getPubsub(ctx, hosts[0], WithClock(clk), WithSeenMessagesSnapshot(path))
+	if !ps.seenMessage("test", "seen") {
+		t.Fatal("expected the seen message to be restored")
+	}
+
+	// a stale snapshot is ignored
+	clk.Add(TimeCacheDuration)
+	ps = getPubsub(ctx, hosts[1], WithClock(clk), WithSeenMessagesSnapshot(path))
+	if ps.seenMessage("test", "seen") {
+		t.Fatal("expected the stale snapshot to be ignored")
+	}
+
+	// so is a corrupt one
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ps = getPubsub(ctx, hosts[2], WithSeenMessagesSnapshot(path))
+	if !ps.markSeen("test", "seen") {
+		t.Fatal("expected the message not to be seen with a corrupt snapshot")
+	}
+}
@@ -0,0 +1,104 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/libp2p/go-libp2p-pubsub/timecache"
+)
+
+// seenSnapshotVersion is the version of the seen messages snapshot format
+const seenSnapshotVersion = 1
+
+// seenSnapshot is the seen messages snapshot format; ids are arbitrary bytes
+type seenSnapshot struct {
+	Version int                 `json:"version"`
+	Saved   time.Time           `json:"saved"`
+	Entries []seenSnapshotEntry `json:"entries"`
+}
+
+type seenSnapshotEntry struct {
+	ID     []byte    `json:"id"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// WithSeenMessagesSnapshot saves the seen messages cache to a file at path when the pubsub instance
+// shuts down, and restores it on startup if the snapshot is younger than the seen messages TTL, so
+// that a quickly restarted node doesn't propagate again the messages it had already seen.
+// Missing, corrupt or stale snapshots are ignored. The snapshot is not taken with an external cache
+// set with WithSeenMessagesCache.
+func WithSeenMessagesSnapshot(path string) Option {
+	return func(ps *PubSub) error {
+		if path == "" {
+			return fmt.Errorf("empty seen messages snapshot path")
+		}
+		ps.seenSnapshotPath = path
+		return nil
+	}
+}
+
+// restoreSeenMessages loads the seen messages snapshot into the seen messages cache
+func (p *PubSub) restoreSeenMessages() {
+	sc, ok := p.seenMessages.(timecache.Snapshotter)
+	if !ok {
+		return
+	}
+
+	data, err := os.ReadFile(p.seenSnapshotPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("error reading seen messages snapshot: %s", err)
+		}
+		return
+	}
+
+	var snap seenSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		log.Warnf("ignoring corrupt seen messages snapshot %s: %s", p.seenSnapshotPath, err)
+		return
+	}
+	if snap.Version != seenSnapshotVersion {
+		log.Warnf("ignoring seen messages snapshot %s with unknown version %d", p.seenSnapshotPath, snap.Version)
+		return
+	}
+	if age := p.clock.Now().Sub(snap.Saved); age < 0 || age > p.seenMsgTTL {
+		log.Infof("ignoring stale seen messages snapshot %s saved %s ago", p.seenSnapshotPath, age)
+		return
+	}
+
+	entries := make(map[string]time.Time, len(snap.Entries))
+	for _, e := range snap.Entries {
+		entries[string(e.ID)] = e.Expiry
+	}
+	sc.Restore(entries)
+	log.Debugf("restored %d seen messages from %s", len(entries), p.seenSnapshotPath)
+}
+
+// saveSeenMessages writes the seen messages cache to the snapshot file
+func (p *PubSub) saveSeenMessages() {
+	sc, ok := p.seenMessages.(timecache.Snapshotter)
+	if !ok {
+		return
+	}
+
+	entries := sc.Snapshot()
+	snap := seenSnapshot{
+		Version: seenSnapshotVersion,
+		Saved:   p.clock.Now(),
+		Entries: make([]seenSnapshotEntry, 0, len(entries)),
+	}
+	for id, expiry := range entries {
+		snap.Entries = append(snap.Entries, seenSnapshotEntry{ID: []byte(id), Expiry: expiry})
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		log.Warnf("error encoding seen messages snapshot: %s", err)
+		return
+	}
+	if err := writeFileAtomic(p.seenSnapshotPath, data); err != nil {
+		log.Warnf("error writing seen messages snapshot: %s", err)
+	}
+}
@@ -0,0 +1,163 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ShardedTopic partitions a logical stream across K topics named prefix-0 to prefix-(K-1), with
+// the messages routed to a shard by a consistent hash of their key.
+type ShardedTopic struct {
+	p      *PubSub
+	prefix string
+	shards []*Topic
+}
+
+// JoinSharded joins the K shards of a sharded topic, applying opts to every shard. The shards
+// joined so far are closed if joining one of them fails.
+func JoinSharded(ps *PubSub, prefix string, k int, opts ...TopicOpt) (*ShardedTopic, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("invalid number of shards: %d", k)
+	}
+
+	st := &ShardedTopic{p: ps, prefix: prefix, shards: make([]*Topic, 0, k)}
+	for i := 0; i < k; i++ {
+		t, err := ps.Join(ShardName(prefix, i), opts...)
+		if err != nil {
+			st.Close()
+			return nil, fmt.Errorf("joining shard %d: %w", i, err)
+		}
+		st.shards = append(st.shards, t)
+	}
+	return st, nil
+}
+
+// ShardName returns the topic of a shard of a sharded topic.
+func ShardName(prefix string, shard int) string {
+	return fmt.Sprintf("%s-%d", prefix, shard)
+}
+
+// Shards returns the number of shards.
+func (st *ShardedTopic) Shards() int {
+	return len(st.shards)
+}
+
+// Shard returns the shard of a key. It uses jump consistent hashing, so that only about 1/K of
+// the keys move to another shard when the number of shards grows to K.
+func (st *ShardedTopic) Shard(key []byte) int {
+	h := fnv.New64a()
+	h.Write(key)
+	return jumpHash(h.Sum64(), len(st.shards))
+}
+
+// Topic returns the handle of a shard, or nil if there is no such shard.
+func (st *ShardedTopic) Topic(shard int) *Topic {
+	if shard < 0 || shard >= len(st.shards) {
+		return nil
+	}
+	return st.shards[shard]
+}
+
+// Publish publishes data to the shard of key.
+func (st *ShardedTopic) Publish(ctx context.Context, key []byte, data []byte, opts ...PubOpt) error {
+	return st.shards[st.Shard(key)].Publish(ctx, data, opts...)
+}
+
+// Subscribe subscribes to the given shards, all of them if none is given, returning the
+// subscriptions in the same order. The subscriptions made so far are cancelled if one of them
+// fails.
+func (st *ShardedTopic) Subscribe(shards ...int) ([]*Subscription, error) {
+	if len(shards) == 0 {
+		shards = make([]int, len(st.shards))
+		for i := range shards {
+			shards[i] = i
+		}
+	}
+
+	subs := make([]*Subscription, 0, len(shards))
+	for _, shard := range shards {
+		t := st.Topic(shard)
+		if t == nil {
+			cancelAll(subs)
+			return nil, fmt.Errorf("no shard %d of %d", shard, len(st.shards))
+		}
+		sub, err := t.Subscribe()
+		if err != nil {
+			cancelAll(subs)
+			return nil, fmt.Errorf("subscribing shard %d: %w", shard, err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// ListPeers returns the peers we are connected to in a shard.
+func (st *ShardedTopic) ListPeers(shard int) []peer.ID {
+	t := st.Topic(shard)
+	if t == nil {
+		return nil
+	}
+	return t.ListPeers()
+}
+
+// MeshPeers returns the gossipsub mesh peers of a shard; it is empty with other routers or if we
+// are not subscribed to the shard.
+func (st *ShardedTopic) MeshPeers(shard int) []peer.ID {
+	if st.Topic(shard) == nil {
+		return nil
+	}
+	return st.p.meshPeers(ShardName(st.prefix, shard))
+}
+
+// Close closes the handles of all the shards, which must have no active subscription or event
+// handler; the shards that can't be closed are reported in the error.
+func (st *ShardedTopic) Close() error {
+	var errs []error
+	for i, t := range st.shards {
+		if err := t.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing shard %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// meshPeers returns the gossipsub mesh peers of a topic
+func (p *PubSub) meshPeers(topic string) []peer.ID {
+	out := make(chan []peer.ID, 1)
+	select {
+	case p.eval <- func() {
+		var peers []peer.ID
+		if gs, ok := p.rt.(*GossipSubRouter); ok {
+			for pid := range gs.mesh[topic] {
+				peers = append(peers, pid)
+			}
+		}
+		out <- peers
+	}:
+	case <-p.ctx.Done():
+		return nil
+	}
+	return <-out
+}
+
+// cancelAll cancels subscriptions
+func cancelAll(subs []*Subscription) {
+	for _, sub := range subs {
+		sub.Cancel()
+	}
+}
+
+// jumpHash maps a key to one of n buckets with the jump consistent hash of Lamping and Veach
+func jumpHash(key uint64, n int) int {
+	var b, j int64 = -1, 0
+	for j < int64(n) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,124 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestShardedTopic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getGossipsubs(ctx, hosts)
+
+	var sts []*ShardedTopic
+	for _, ps := range psubs {
+		st, err := JoinSharded(ps, "data", 4, WithTopicMaxMessageSize(1024))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sts = append(sts, st)
+	}
+	if _, err := JoinSharded(psubs[0], "data", 4); !errors.Is(err, ErrTopicExists) {
+		t.Fatalf("expected ErrTopicExists joining the shards twice, got %v", err)
+	}
+
+	subs, err := sts[1].Subscribe(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sts[1].Subscribe(4); err == nil {
+		t.Fatal("expected an error subscribing an unknown shard")
+	}
+	if _, err := sts[0].Subscribe(); err != nil {
+		t.Fatal(err)
+	}
+
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(2 * time.Second)
+
+	for shard := 0; shard < 4; shard++ {
+		subscribed := shard == 1 || shard == 3
+		if n := len(sts[0].ListPeers(shard)); subscribed != (n == 1) {
+			t.Fatalf("shard %d: unexpected peers %d", shard, n)
+		}
+		if n := len(sts[0].MeshPeers(shard)); subscribed != (n == 1) {
+			t.Fatalf("shard %d: unexpected mesh peers %d", shard, n)
+		}
+	}
+
+	// publish keys until both subscribed shards got one
+	published := make(map[int][]byte)
+	for i := 0; len(published) < 2; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		shard := sts[0].Shard(key)
+		if shard != sts[1].Shard(key) {
+			t.Fatal("shards disagree on the shard of a key")
+		}
+		if shard != 1 && shard != 3 {
+			continue
+		}
+		if _, ok := published[shard]; ok {
+			continue
+		}
+		published[shard] = key
+		if err := sts[0].Publish(ctx, key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertReceive(t, subs[0], published[1])
+	assertReceive(t, subs[1], published[3])
+
+	// the option template applies to every shard
+	if err := sts[0].Publish(ctx, []byte("key"), make([]byte, 2048)); !errors.As(err, new(ErrMessageTooLarge)) {
+		t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+	}
+
+	if err := sts[1].Close(); !errors.Is(err, ErrTopicInUse) {
+		t.Fatalf("expected ErrTopicInUse closing subscribed shards, got %v", err)
+	}
+	for _, sub := range subs {
+		sub.Cancel()
+	}
+	for i := 0; ; i++ {
+		err := sts[1].Close()
+		if err == nil {
+			break
+		}
+		if i == 100 {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := JoinSharded(psubs[1], "data", 4); err != nil {
+		t.Fatalf("expected to rejoin the closed shards, got %v", err)
+	}
+}
+
+func TestJumpHash(t *testing.T) {
+	const keys = 10000
+
+	counts := make([]int, 10)
+	moved := 0
+	for k := uint64(0); k < keys; k++ {
+		b := jumpHash(k*0x9e3779b97f4a7c15, 10)
+		counts[b]++
+		if jumpHash(k*0x9e3779b97f4a7c15, 11) != b {
+			moved++
+		}
+	}
+
+	for b, n := range counts {
+		if n < keys/20 || n > keys/5 {
+			t.Fatalf("unbalanced bucket %d: %d keys", b, n)
+		}
+	}
+	// about 1/11 of the keys move to the new bucket
+	if moved < keys/20 || moved > keys/6 {
+		t.Fatalf("unexpected number of moved keys: %d", moved)
+	}
+}
@@ -2,8 +2,10 @@ package pubsub
 
 import (
 	"fmt"
+	"time"
 
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/libp2p/go-libp2p-pubsub/timecache"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -44,10 +46,189 @@ func (policy MessageSignaturePolicy) mustSign() bool {
 	return policy&msgSigning != 0
 }
 
+// anonymous is true for topic policies that omit the author and seqno of messages.
+// This only applies to per topic policies; globally, anonymity is controlled by WithNoAuthor.
+func (policy MessageSignaturePolicy) anonymous() bool {
+	return policy.mustVerify() && !policy.mustSign()
+}
+
+// WithTopicMessageSignaturePolicy overrides the global message signature policy for a Topic,
+// both for publishing and for validating received messages.
+// Topics with the StrictNoSign policy omit the author and seqno of published messages and reject
+// received messages carrying them, as if WithNoAuthor was used for the topic.
+func WithTopicMessageSignaturePolicy(policy MessageSignaturePolicy) TopicOpt {
+	return func(t *Topic) error {
+		if policy.mustSign() {
+			if t.p.signID == "" {
+				return fmt.Errorf("strict signature usage enabled but message author was disabled")
+			}
+			if t.p.signer == nil {
+				t.signKey = t.p.signKey
+				if t.signKey == nil {
+					t.signKey = t.p.host.Peerstore().PrivKey(t.p.signID)
+				}
+				if t.signKey == nil {
+					return fmt.Errorf("can't sign for peer %s: no private key", t.p.signID)
+				}
+			}
+		}
+		t.signPolicy = &policy
+		return nil
+	}
+}
+
+func (p *PubSub) setTopicSignPolicy(topic string, policy *MessageSignaturePolicy) {
+	p.topicOptsMx.Lock()
+	defer p.topicOptsMx.Unlock()
+
+	if policy == nil {
+		delete(p.signPolicies, topic)
+		return
+	}
+	p.signPolicies[topic] = *policy
+}
+
+// topicSignPolicy returns the signature policy of a topic, or nil if the global policy applies
+func (p *PubSub) topicSignPolicy(topic string) *MessageSignaturePolicy {
+	p.topicOptsMx.RLock()
+	defer p.topicOptsMx.RUnlock()
+
+	policy, ok := p.signPolicies[topic]
+	if !ok {
+		return nil
+	}
+	return &policy
+}
+
+// WithForwardKeyStripping strips the embedded public key from forwarded messages, which saves
+// hundreds of bytes per message for authors with RSA keys. The key is still embedded when
+// publishing, and peers store the embedded keys of the messages they verify in the peerstore.
+// Peers with this option look up the key of messages without an embedded key in the peerstore,
+// and then with the resolver set with WithAuthorKeyResolver, before rejecting the message; so
+// this should be set on all the peers of a topic, and only be used when the keys of authors are
+// available to all of them.
+// Note that this is only compatible with message ID functions that don't depend on the key.
+func WithForwardKeyStripping() Option {
+	return func(p *PubSub) error {
+		p.stripForwardedKeys = true
+		return nil
+	}
+}
+
+// outgoingMessage returns a message as it is sent to peers
+func (p *PubSub) outgoingMessage(msg *Message) *pb.Message {
+	m := msg.wireMessage()
+	if !p.stripForwardedKeys || m.Key == nil || msg.ReceivedFrom == p.host.ID() {
+		return m
+	}
+
+	stripped := *m
+	stripped.Key = nil
+	return &stripped
+}
+
+// authorKeyLookup returns the lookup for the keys of authors that are neither embedded in a
+// message nor extractable from the author ID, or nil if such keys are not looked up
+func (p *PubSub) authorKeyLookup() func(peer.ID) (crypto.PubKey, error) {
+	if p.stripForwardedKeys {
+		return p.authorKey
+	}
+	if p.keyResolver != nil {
+		return p.keyResolver.Resolve
+	}
+	return nil
+}
+
+// authorKey looks up the key of an author in the peerstore, and then with the resolver
+func (p *PubSub) authorKey(pid peer.ID) (crypto.PubKey, error) {
+	if pubk := p.host.Peerstore().PubKey(pid); pubk != nil {
+		return pubk, nil
+	}
+	if p.keyResolver != nil {
+		return p.keyResolver.Resolve(pid)
+	}
+	return nil, fmt.Errorf("no key for %s", pid)
+}
+
+// learnAuthorKey stores the embedded key of a verified message in the peerstore, so that
+// messages stripped of their key can be verified
+func (p *PubSub) learnAuthorKey(m *pb.Message) {
+	pid, err := peer.IDFromBytes(m.From)
+	if err != nil || p.host.Peerstore().PubKey(pid) != nil {
+		return
+	}
+
+	pubk, err := crypto.UnmarshalPublicKey(m.Key)
+	if err != nil {
+		return
+	}
+	if err := p.host.Peerstore().AddPubKey(pid, pubk); err != nil {
+		log.Debugf("error storing key of %s: %s", pid, err)
+	}
+}
+
+// AuthorKeyNegativeCacheTTL is how long a failure to resolve the key of an author is cached.
+var AuthorKeyNegativeCacheTTL = 30 * time.Second
+
+// AuthorKeyResolver returns the current public key of a message author.
+type AuthorKeyResolver func(peer.ID) (crypto.PubKey, error)
+
+// WithAuthorKeyResolver sets a resolver for the keys of message authors, which is consulted
+// when a message carries neither an attached key nor an author ID the key can be extracted from.
+// This allows applications to supply keys from an external identity registry, e.g. for
+// authors that rotate their keys. Resolved keys are not required to match the author ID.
+// Failures to resolve a key are cached for AuthorKeyNegativeCacheTTL, and messages whose
+// signature can't be verified are rejected with RejectInvalidSignature.
+func WithAuthorKeyResolver(resolve AuthorKeyResolver) Option {
+	return func(p *PubSub) error {
+		if resolve == nil {
+			return fmt.Errorf("nil author key resolver")
+		}
+		p.resolveAuthorKey = resolve
+		return nil
+	}
+}
+
+// authorKeyResolver wraps an AuthorKeyResolver with a cache of failed resolutions
+type authorKeyResolver struct {
+	resolve AuthorKeyResolver
+	failed  timecache.TimeCache
+}
+
+func newAuthorKeyResolver(resolve AuthorKeyResolver, clock Clock) *authorKeyResolver {
+	return &authorKeyResolver{
+		resolve: resolve,
+		failed:  timecache.NewTimeCacheWithClock(timecache.Strategy_FirstSeen, AuthorKeyNegativeCacheTTL, clock.Now),
+	}
+}
+
+func (r *authorKeyResolver) Resolve(pid peer.ID) (crypto.PubKey, error) {
+	if r.failed.Has(string(pid)) {
+		return nil, fmt.Errorf("recently failed to resolve key for %s", pid)
+	}
+
+	pubk, err := r.resolve(pid)
+	if err == nil && pubk == nil {
+		err = fmt.Errorf("no key for %s", pid)
+	}
+	if err != nil {
+		r.failed.Add(string(pid))
+		return nil, err
+	}
+
+	return pubk, nil
+}
+
 const SignPrefix = "libp2p-pubsub:"
 
 func verifyMessageSignature(m *pb.Message) error {
-	pubk, err := messagePubKey(m)
+	return verifyMessageSignatureWith(m, nil)
+}
+
+// verifyMessageSignatureWith verifies the message signature, using the lookup function (if any)
+// for the key of authors whose key is neither attached nor extractable from their ID.
+func verifyMessageSignatureWith(m *pb.Message, lookup func(peer.ID) (crypto.PubKey, error)) error {
+	pubk, err := messagePubKey(m, lookup)
 	if err != nil {
 		return err
 	}
@@ -74,7 +255,7 @@ func verifyMessageSignature(m *pb.Message) error {
 	return nil
 }
 
-func messagePubKey(m *pb.Message) (crypto.PubKey, error) {
+func messagePubKey(m *pb.Message, lookup func(peer.ID) (crypto.PubKey, error)) (crypto.PubKey, error) {
 	var pubk crypto.PubKey
 
 	pid, err := peer.IDFromBytes(m.From)
@@ -83,8 +264,15 @@ func messagePubKey(m *pb.Message) (crypto.PubKey, error) {
 	}
 
 	if m.Key == nil {
-		// no attached key, it must be extractable from the source ID
+		// no attached key, it must be extractable from the source ID or looked up
 		pubk, err = pid.ExtractPublicKey()
+		if err == peer.ErrNoPublicKey && lookup != nil {
+			pubk, err = lookup(pid)
+			if err != nil {
+				return nil, fmt.Errorf("cannot look up signing key: %s", err.Error())
+			}
+			return pubk, nil
+		}
 		if err != nil {
 			return nil, fmt.Errorf("cannot extract signing key: %s", err.Error())
 		}
@@ -106,7 +294,33 @@ func messagePubKey(m *pb.Message) (crypto.PubKey, error) {
 	return pubk, nil
 }
 
+// MessageSigner produces message signatures on behalf of the message author, for setups where
+// the private key is not directly accessible, e.g. keys held in an HSM or a remote signing service.
+type MessageSigner interface {
+	// Sign returns the signature of data.
+	Sign(data []byte) ([]byte, error)
+	// PublicKey returns the public key that verifies the signatures.
+	PublicKey() crypto.PubKey
+}
+
+// keySigner is a MessageSigner backed by a private key
+type keySigner struct {
+	key crypto.PrivKey
+}
+
+func (s keySigner) Sign(data []byte) ([]byte, error) {
+	return s.key.Sign(data)
+}
+
+func (s keySigner) PublicKey() crypto.PubKey {
+	return s.key.GetPublic()
+}
+
 func signMessage(pid peer.ID, key crypto.PrivKey, m *pb.Message) error {
+	return signMessageWith(pid, keySigner{key}, m)
+}
+
+func signMessageWith(pid peer.ID, signer MessageSigner, m *pb.Message) error {
 	bytes, err := m.Marshal()
 	if err != nil {
 		return err
@@ -114,7 +328,7 @@ func signMessage(pid peer.ID, key crypto.PrivKey, m *pb.Message) error {
 
 	bytes = withSignPrefix(bytes)
 
-	sig, err := key.Sign(bytes)
+	sig, err := signer.Sign(bytes)
 	if err != nil {
 		return err
 	}
@@ -123,7 +337,7 @@ func signMessage(pid peer.ID, key crypto.PrivKey, m *pb.Message) error {
 
 	pk, _ := pid.ExtractPublicKey()
 	if pk == nil {
-		pubk, err := crypto.MarshalPublicKey(key.GetPublic())
+		pubk, err := crypto.MarshalPublicKey(signer.PublicKey())
 		if err != nil {
 			return err
 		}
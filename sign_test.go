@@ -1,12 +1,19 @@
 package pubsub
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
+
+	bhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
 )
 
 func TestSigning(t *testing.T) {
@@ -41,3 +48,301 @@ func testSignVerify(t *testing.T, privk crypto.PrivKey) {
 		t.Fatal(err)
 	}
 }
+
+type testSigner struct {
+	key  crypto.PrivKey
+	fail bool
+}
+
+func (s *testSigner) Sign(data []byte) ([]byte, error) {
+	if s.fail {
+		return nil, errors.New("signer unavailable")
+	}
+	return s.key.Sign(data)
+}
+
+func (s *testSigner) PublicKey() crypto.PubKey {
+	return s.key.GetPublic()
+}
+
+func TestCustomSigner(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// an RSA key can't be derived from the peer ID, so it has to be embedded
+	privk, _, err := crypto.GenerateKeyPair(crypto.RSA, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	author, err := peer.IDFromPublicKey(privk.GetPublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &testSigner{key: privk}
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := []*PubSub{
+		getPubsub(ctx, hosts[0], WithCustomSigner(signer)),
+		getPubsub(ctx, hosts[1]),
+	}
+	connect(t, hosts[0], hosts[1])
+
+	sub, err := psubs[1].Subscribe("foobar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if err := psubs[0].Publish("foobar", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.GetFrom() != author {
+		t.Fatalf("unexpected author %s", msg.GetFrom())
+	}
+	if msg.Key == nil {
+		t.Fatal("expected the signing key to be embedded")
+	}
+
+	signer.fail = true
+	if err := psubs[0].Publish("foobar", []byte("hello")); err == nil {
+		t.Fatal("expected the signing failure to be returned")
+	}
+}
+
+func TestTopicMessageSignaturePolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	psubs := getGossipsubs(ctx, hosts[:2])
+	psubs = append(psubs, getGossipsubs(ctx, hosts[2:], WithMessageSignaturePolicy(StrictNoSign), WithNoAuthor())...)
+
+	// 0 and 1 sign by default but not on the telemetry topic; 2 only signs on the blocks topic,
+	// which it can't as it has no author
+	var telemetry, blocks []*Subscription
+	var telemetryTopics []*Topic
+	for i, ps := range psubs[:2] {
+		tp, err := ps.Join("telemetry", WithTopicMessageSignaturePolicy(StrictNoSign))
+		if err != nil {
+			t.Fatal(err)
+		}
+		telemetryTopics = append(telemetryTopics, tp)
+		sub, err := tp.Subscribe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		telemetry = append(telemetry, sub)
+
+		sub, err = psubs[i].Subscribe("blocks")
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, sub)
+	}
+	if _, err := psubs[2].Join("blocks", WithTopicMessageSignaturePolicy(StrictSign)); err == nil {
+		t.Fatal("expected an error joining a signed topic without an author")
+	}
+
+	// 2 doesn't override the policy of the telemetry topic, but its global policy matches
+	tp, err := psubs[2].Join("telemetry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := tp.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	telemetry = append(telemetry, sub)
+
+	connectAll(t, hosts)
+	time.Sleep(time.Second)
+
+	if err := telemetryTopics[0].Publish(ctx, []byte("telemetry")); err != nil {
+		t.Fatal(err)
+	}
+	for _, sub := range telemetry {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Signature != nil || msg.From != nil || msg.Seqno != nil {
+			t.Fatal("expected an anonymous message")
+		}
+	}
+
+	if err := psubs[0].Publish("blocks", []byte("block")); err != nil {
+		t.Fatal(err)
+	}
+	for _, sub := range blocks {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Signature == nil || msg.GetFrom() != hosts[0].ID() {
+			t.Fatal("expected a signed message")
+		}
+	}
+
+	// signed messages are rejected on the anonymous topic
+	adversary := psubs[1]
+	done := make(chan struct{})
+	adversary.eval <- func() {
+		adversary.myTopics["telemetry"].signPolicy = nil
+		adversary.setTopicSignPolicy("telemetry", nil)
+		close(done)
+	}
+	<-done
+	if err := telemetryTopics[1].Publish(ctx, []byte("signed")); err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, telemetry[1], []byte("signed"))
+	assertNeverReceives(t, telemetry[0], time.Second)
+	assertNeverReceives(t, telemetry[2], time.Second)
+}
+
+func TestAuthorKeyResolver(t *testing.T) {
+	// the author ID is an RSA key hash, so the key can't be extracted from it
+	authorKey, _, err := crypto.GenerateKeyPair(crypto.RSA, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	author, err := peer.IDFromPrivateKey(authorKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotatedKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topic := "foo"
+	m := pb.Message{
+		Data:  []byte("abc"),
+		Topic: &topic,
+		From:  []byte(author),
+		Seqno: []byte("123"),
+	}
+	if err := signMessageWith(author, keySigner{rotatedKey}, &m); err != nil {
+		t.Fatal(err)
+	}
+	m.Key = nil
+
+	if err := verifyMessageSignature(&m); err == nil {
+		t.Fatal("expected verification to fail without a resolver")
+	}
+
+	var calls int
+	resolver := newAuthorKeyResolver(func(pid peer.ID) (crypto.PubKey, error) {
+		calls++
+		if pid != author {
+			return nil, errors.New("unknown author")
+		}
+		return rotatedKey.GetPublic(), nil
+	}, realClock{})
+	defer resolver.failed.Done()
+
+	if err := verifyMessageSignatureWith(&m, resolver.Resolve); err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := m
+	tampered.Data = []byte("xyz")
+	if err := verifyMessageSignatureWith(&tampered, resolver.Resolve); err == nil {
+		t.Fatal("expected verification of a tampered message to fail")
+	}
+
+	// failed resolutions are cached
+	otherKey, _, err := crypto.GenerateKeyPair(crypto.RSA, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := peer.IDFromPrivateKey(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := m
+	unknown.From = []byte(other)
+	calls = 0
+	for i := 0; i < 2; i++ {
+		if err := verifyMessageSignatureWith(&unknown, resolver.Resolve); err == nil {
+			t.Fatal("expected verification to fail for an unknown author")
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected the resolver to be called once, got %d", calls)
+	}
+}
+
+func TestForwardKeyStripping(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// RSA keys can't be extracted from the peer ID, so they are embedded in messages
+	var hosts []host.Host
+	var keys []crypto.PubKey
+	for i := 0; i < 3; i++ {
+		sk, pk, err := crypto.GenerateKeyPair(crypto.RSA, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := bhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptPeerPrivateKey(sk)))
+		t.Cleanup(func() { h.Close() })
+		hosts = append(hosts, h)
+		keys = append(keys, pk)
+	}
+
+	// the relay strips the key of the messages it forwards, and the receiver looks up the keys
+	// of stripped messages in its peerstore
+	psubs := []*PubSub{
+		getPubsub(ctx, hosts[0]),
+		getPubsub(ctx, hosts[1], WithForwardKeyStripping()),
+		getPubsub(ctx, hosts[2], WithForwardKeyStripping()),
+	}
+
+	var subs []*Subscription
+	for _, ps := range psubs {
+		sub, err := ps.Subscribe("foobar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs = append(subs, sub)
+	}
+
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[1], hosts[2])
+	time.Sleep(100 * time.Millisecond)
+
+	if err := psubs[0].Publish("foobar", []byte("unknown key")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := subs[1].Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Key == nil {
+		t.Fatal("expected the key to be embedded by the publisher")
+	}
+
+	// the receiver has no way of verifying the message without the key
+	assertNeverReceives(t, subs[2], time.Second)
+
+	// once the key is in the peerstore, stripped messages are verified
+	if err := hosts[2].Peerstore().AddPubKey(hosts[0].ID(), keys[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := psubs[0].Publish("foobar", []byte("known key")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err = subs[2].Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Data) != "known key" || msg.Key != nil {
+		t.Fatal("expected the message to be received without a key")
+	}
+}
@@ -0,0 +1,114 @@
+package pubsub
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// writeSamples is the number of latest RPC writes to a peer its write times are computed over
+	writeSamples = 128
+	// minSlowSamples is the number of writes to a peer below which it is not deemed slow
+	minSlowSamples = 20
+)
+
+// SlowPeerTracer is an optional interface for RawTracers, which is invoked at the heartbeat for
+// the peers deemed slow, with a 95th percentile of the time spent writing them an RPC over their
+// latest writes of at least SlowPeerThreshold.
+type SlowPeerTracer interface {
+	SlowPeer(p peer.ID, d time.Duration)
+}
+
+// WriteTimeStats is the distribution of the time spent writing RPCs to a peer, blocked until
+// it consumes them, over its latest writes.
+type WriteTimeStats struct {
+	// P50 is the median write time.
+	P50 time.Duration `json:"p50"`
+	// P95 is the 95th percentile of the write times.
+	P95 time.Duration `json:"p95"`
+	// Samples is the number of writes the distribution is computed over.
+	Samples int `json:"samples"`
+}
+
+// writeTimes is the ring of the latest write times to a peer
+type writeTimes struct {
+	mx      sync.Mutex
+	samples []time.Duration
+	next    int
+	// fresh is the number of writes since the last slow peer check
+	fresh int
+}
+
+func (w *writeTimes) add(d time.Duration) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	if len(w.samples) < writeSamples {
+		w.samples = append(w.samples, d)
+	} else {
+		w.samples[w.next] = d
+		w.next = (w.next + 1) % writeSamples
+	}
+	w.fresh++
+}
+
+// stats returns the distribution of the write times, marking them as checked if check is set
+func (w *writeTimes) stats(check bool) WriteTimeStats {
+	w.mx.Lock()
+	sorted := slices.Clone(w.samples)
+	if check {
+		w.fresh = 0
+	}
+	w.mx.Unlock()
+
+	slices.Sort(sorted)
+	return WriteTimeStats{
+		P50:     percentile(sorted, 50),
+		P95:     percentile(sorted, 95),
+		Samples: len(sorted),
+	}
+}
+
+// hasFresh returns whether there were writes since the last slow peer check
+func (w *writeTimes) hasFresh() bool {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	return w.fresh > 0
+}
+
+// percentile returns the nearest rank percentile of sorted samples
+func percentile(sorted []time.Duration, pct int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (pct*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// slowPeers returns the peers written to since the last heartbeat which are slow to consume our
+// RPCs, with the 95th percentile of their write times, tracing them.
+func (gs *GossipSubRouter) slowPeers() map[peer.ID]time.Duration {
+	if gs.params.SlowPeerThreshold <= 0 {
+		return nil
+	}
+
+	var slow map[peer.ID]time.Duration
+	for p, w := range gs.p.stats.peerWriteTimes() {
+		if !w.hasFresh() {
+			continue
+		}
+		st := w.stats(true)
+		if st.Samples < minSlowSamples || st.P95 < gs.params.SlowPeerThreshold {
+			continue
+		}
+		if slow == nil {
+			slow = make(map[peer.ID]time.Duration)
+		}
+		slow[p] = st.P95
+		gs.tracer.SlowPeer(p, st.P95)
+	}
+	return slow
+}
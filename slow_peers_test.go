@@ -0,0 +1,132 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+type slowPeerTracer struct {
+	noopRawTracer
+
+	mx   sync.Mutex
+	slow map[peer.ID]time.Duration
+}
+
+func (st *slowPeerTracer) SlowPeer(p peer.ID, d time.Duration) {
+	st.mx.Lock()
+	defer st.mx.Unlock()
+	st.slow[p] = d
+}
+
+func (st *slowPeerTracer) drain() map[peer.ID]time.Duration {
+	st.mx.Lock()
+	defer st.mx.Unlock()
+	slow := st.slow
+	st.slow = make(map[peer.ID]time.Duration)
+	return slow
+}
+
+func TestWriteTimes(t *testing.T) {
+	var w writeTimes
+	for i := 1; i <= 100; i++ {
+		w.add(time.Duration(i) * time.Millisecond)
+	}
+	st := w.stats(false)
+	if st.P50 != 50*time.Millisecond || st.P95 != 95*time.Millisecond || st.Samples != 100 {
+		t.Fatalf("unexpected write times %+v", st)
+	}
+
+	// only the latest writes count
+	for i := 0; i < writeSamples; i++ {
+		w.add(time.Second)
+	}
+	st = w.stats(true)
+	if st.P50 != time.Second || st.Samples != writeSamples {
+		t.Fatalf("expected the latest write times, got %+v", st)
+	}
+	if w.hasFresh() {
+		t.Fatal("expected the writes to be checked")
+	}
+
+	if p := percentile(nil, 95); p != 0 {
+		t.Fatalf("expected no percentile without samples, got %s", p)
+	}
+}
+
+func TestSlowPeersPruned(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	params := DefaultGossipSubParams()
+	params.Dlo = 2
+	params.SlowPeerThreshold = 10 * time.Millisecond
+	params.PruneSlowPeers = true
+
+	ps, gs, eval := chokeTestRouter(t, ctx, params, map[peer.ID]protocol.ID{
+		"p0":   GossipSubID_v11,
+		"p1":   GossipSubID_v11,
+		"p2":   GossipSubID_v11,
+		"slow": GossipSubID_v11,
+	})
+	tracer := &slowPeerTracer{slow: make(map[peer.ID]time.Duration)}
+	if err := ps.AddRawTracer(tracer); err != nil {
+		t.Fatal(err)
+	}
+
+	// too few writes don't tell a peer is slow
+	for i := 0; i < minSlowSamples-1; i++ {
+		ps.stats.wrote("slow", 50*time.Millisecond)
+	}
+	eval(gs.heartbeat)
+	if slow := tracer.drain(); len(slow) != 0 {
+		t.Fatalf("expected no slow peer, got %v", slow)
+	}
+
+	for _, p := range []peer.ID{"p0", "p1", "p2", "slow"} {
+		d := time.Millisecond
+		if p == "slow" {
+			d = 50 * time.Millisecond
+		}
+		for i := 0; i < minSlowSamples; i++ {
+			ps.stats.wrote(p, d)
+		}
+	}
+
+	st := ps.Stats().WriteTimes
+	if st["slow"].P95 != 50*time.Millisecond || st["p0"].P50 != time.Millisecond {
+		t.Fatalf("unexpected write times %+v", st)
+	}
+
+	eval(func() {
+		gs.heartbeat()
+		if _, ok := gs.mesh["test"]["slow"]; ok {
+			t.Error("expected the slow peer to be pruned")
+		}
+		if len(gs.mesh["test"]) != 3 {
+			t.Errorf("expected the other peers to stay in the mesh, got %d", len(gs.mesh["test"]))
+		}
+		drainRPCs(ps)
+	})
+	if slow := tracer.drain(); len(slow) != 1 || slow["slow"] != 50*time.Millisecond {
+		t.Fatalf("expected the slow peer to be traced, got %v", slow)
+	}
+
+	// the peers are only checked again after new writes
+	eval(gs.heartbeat)
+	if slow := tracer.drain(); len(slow) != 0 {
+		t.Fatalf("expected no new slow peer, got %v", slow)
+	}
+
+	// the write times are dropped with the peer, and not set up again by a writer still
+	// draining its queue
+	ps.stats.removePeer("slow")
+	ps.stats.wrote("slow", 50*time.Millisecond)
+	if _, ok := ps.Stats().WriteTimes["slow"]; ok {
+		t.Fatal("expected the write times of the peer to be dropped")
+	}
+}
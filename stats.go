@@ -0,0 +1,362 @@
+package pubsub
+
+import (
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// PubSubStats are the runtime counters of pubsub, which are kept whether tracing is enabled or
+// not. They are JSON serializable, to be dumped as is by admin endpoints.
+type PubSubStats struct {
+	// Topics are the counters of the topics we are in, keyed by topic.
+	Topics map[string]TopicStats `json:"topics"`
+
+	// RPCsIn is the number of RPCs read from all peers.
+	RPCsIn uint64 `json:"rpcsIn"`
+	// RPCsOut is the number of RPCs written to all peers.
+	RPCsOut uint64 `json:"rpcsOut"`
+	// BytesIn is the size on the wire of the RPCs read from all peers.
+	BytesIn uint64 `json:"bytesIn"`
+	// BytesOut is the size on the wire of the RPCs written to all peers.
+	BytesOut uint64 `json:"bytesOut"`
+
+	// ValidationQueueDepth is the number of messages waiting for signature verification or
+	// validation.
+	ValidationQueueDepth int `json:"validationQueueDepth"`
+
+	// Drops are the counters of the messages and RPCs dropped for lack of resources.
+	Drops DropStats `json:"drops"`
+
+	// WriteTimes are the distributions of the time spent writing RPCs to the connected peers,
+	// keyed by peer.
+	WriteTimes map[peer.ID]WriteTimeStats `json:"writeTimes,omitempty"`
+
+	// Queued is the data waiting in the outbound queues of the connected peers, keyed by peer
+	// and topic, with the subscriptions and control messages under QueueControlTopic.
+	Queued map[peer.ID]map[string]QueueStats `json:"queued,omitempty"`
+
+	// IWants are the outstanding IWANT requests, under the budget set with WithIWantBudget.
+	IWants IWantStats `json:"iwants"`
+
+	// Discovery are the counters of the dials initiated by discovery.
+	Discovery DiscoveryStats `json:"discovery"`
+}
+
+// TopicStats are the counters of a topic.
+type TopicStats struct {
+	// Published is the number of messages we published.
+	Published uint64 `json:"published"`
+	// Delivered is the number of messages received from peers that passed validation.
+	Delivered uint64 `json:"delivered"`
+	// Rejected is the number of messages rejected, for any reason including the drops.
+	Rejected uint64 `json:"rejected"`
+	// Duplicates is the number of messages received again after being seen.
+	Duplicates uint64 `json:"duplicates"`
+	// MeshPeers is the size of the gossipsub mesh of the topic.
+	MeshPeers int `json:"meshPeers"`
+	// BestEffortSkipped is the number of sends of messages to busy peers skipped for the topic
+	// is best effort.
+	BestEffortSkipped uint64 `json:"bestEffortSkipped"`
+}
+
+// DropStats are the counters of the messages and RPCs dropped for lack of resources.
+type DropStats struct {
+	// ValidationQueueFull is the number of messages dropped because the validation queue was full.
+	ValidationQueueFull uint64 `json:"validationQueueFull"`
+	// ValidationThrottled is the number of messages dropped because the asynchronous
+	// validation throttle was full.
+	ValidationThrottled uint64 `json:"validationThrottled"`
+	// OutboundQueueFull is the number of RPCs dropped because the outbound queue of a peer was
+	// full.
+	OutboundQueueFull uint64 `json:"outboundQueueFull"`
+	// OutboundQueueFullByPeer breaks OutboundQueueFull down by connected peer, to spot the
+	// congested ones.
+	OutboundQueueFullByPeer map[peer.ID]uint64 `json:"outboundQueueFullByPeer,omitempty"`
+	// SubscriptionQueueFull is the number of messages not delivered to a subscription because
+	// its buffer was full.
+	SubscriptionQueueFull uint64 `json:"subscriptionQueueFull"`
+}
+
+// StatsOpt is an option for Stats.
+type StatsOpt func(*statsOptions)
+
+type statsOptions struct {
+	reset bool
+}
+
+// WithStatsReset resets the counters as they are read, so that each call to Stats returns the
+// counts since the previous one; the mesh sizes, the validation queue depth, the write times, the
+// queued data and the outstanding IWANT requests are not counters and are unaffected.
+func WithStatsReset() StatsOpt {
+	return func(opts *statsOptions) {
+		opts.reset = true
+	}
+}
+
+// Stats returns the runtime counters of pubsub.
+func (p *PubSub) Stats(opts ...StatsOpt) PubSubStats {
+	var options statsOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	s := p.stats.snapshot(options.reset)
+	s.ValidationQueueDepth = len(p.val.verifyQ) + len(p.val.validateQ)
+	s.Discovery = p.disc.dialer.stats(options.reset)
+
+	gs, ok := p.rt.(*GossipSubRouter)
+	if !ok {
+		return s
+	}
+	s.IWants = gs.iwantBudget.stats(options.reset)
+
+	out := make(chan map[string]int, 1)
+	select {
+	case p.eval <- func() {
+		mesh := make(map[string]int, len(gs.mesh))
+		for topic, peers := range gs.mesh {
+			mesh[topic] = len(peers)
+		}
+		out <- mesh
+	}:
+	case <-p.ctx.Done():
+		return s
+	}
+
+	for topic, n := range <-out {
+		ts := s.Topics[topic]
+		ts.MeshPeers = n
+		s.Topics[topic] = ts
+	}
+	return s
+}
+
+// pubsubStats are the runtime counters, incremented from the event loop, the validation
+// pipeline and the stream goroutines
+type pubsubStats struct {
+	mx         sync.RWMutex
+	topics     map[string]*topicCounters
+	peerDrops  map[peer.ID]*atomic.Uint64
+	peerWrites map[peer.ID]*writeTimes
+	peerQueues map[peer.ID]*peerQueue
+
+	rpcsIn, rpcsOut, bytesIn, bytesOut atomic.Uint64
+
+	validationQueueFull, validationThrottled atomic.Uint64
+	outboundQueueFull, subscriptionQueueFull atomic.Uint64
+}
+
+type topicCounters struct {
+	published, delivered, rejected, duplicates atomic.Uint64
+	bestEffortSkipped                          atomic.Uint64
+}
+
+func newPubSubStats() *pubsubStats {
+	return &pubsubStats{
+		topics:     make(map[string]*topicCounters),
+		peerDrops:  make(map[peer.ID]*atomic.Uint64),
+		peerWrites: make(map[peer.ID]*writeTimes),
+		peerQueues: make(map[peer.ID]*peerQueue),
+	}
+}
+
+// topic returns the counters of a topic, adding them if needed
+func (s *pubsubStats) topic(topic string) *topicCounters {
+	s.mx.RLock()
+	tc, ok := s.topics[topic]
+	s.mx.RUnlock()
+	if ok {
+		return tc
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	tc, ok = s.topics[topic]
+	if !ok {
+		tc = new(topicCounters)
+		s.topics[topic] = tc
+	}
+	return tc
+}
+
+// removeTopic drops the counters of a topic we left
+func (s *pubsubStats) removeTopic(topic string) {
+	s.mx.Lock()
+	delete(s.topics, topic)
+	s.mx.Unlock()
+}
+
+// outboundDropped counts an RPC dropped because the outbound queue of a peer was full
+func (s *pubsubStats) outboundDropped(p peer.ID) {
+	s.outboundQueueFull.Add(1)
+
+	s.mx.RLock()
+	c, ok := s.peerDrops[p]
+	s.mx.RUnlock()
+	if !ok {
+		s.mx.Lock()
+		c, ok = s.peerDrops[p]
+		if !ok {
+			c = new(atomic.Uint64)
+			s.peerDrops[p] = c
+		}
+		s.mx.Unlock()
+	}
+	c.Add(1)
+}
+
+// addPeer sets up the counters of a peer given an outbound queue; the writers of the peers
+// removed since are not accounted for, as they may still drain their queue.
+func (s *pubsubStats) addPeer(p peer.ID) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if _, ok := s.peerWrites[p]; !ok {
+		s.peerWrites[p] = new(writeTimes)
+	}
+	if _, ok := s.peerQueues[p]; !ok {
+		s.peerQueues[p] = &peerQueue{topics: make(map[string]*QueueStats)}
+	}
+}
+
+// wrote records the time spent writing an RPC to a peer
+func (s *pubsubStats) wrote(p peer.ID, d time.Duration) {
+	s.mx.RLock()
+	w, ok := s.peerWrites[p]
+	s.mx.RUnlock()
+	if ok {
+		w.add(d)
+	}
+}
+
+// queued adds, or removes with a negative sign, the loads of an RPC to the outbound queue of a
+// peer
+func (s *pubsubStats) queued(p peer.ID, loads []queueLoad, sign int) {
+	s.mx.RLock()
+	q, ok := s.peerQueues[p]
+	s.mx.RUnlock()
+	if ok {
+		q.add(loads, sign)
+	}
+}
+
+// peerWriteTimes returns the write times of the peers
+func (s *pubsubStats) peerWriteTimes() map[peer.ID]*writeTimes {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	return maps.Clone(s.peerWrites)
+}
+
+// removePeer drops the counters of a peer gone
+func (s *pubsubStats) removePeer(p peer.ID) {
+	s.mx.Lock()
+	delete(s.peerDrops, p)
+	delete(s.peerWrites, p)
+	delete(s.peerQueues, p)
+	s.mx.Unlock()
+}
+
+// rejected counts the rejection of a message, and its drop for the reasons of lack of resources
+func (s *pubsubStats) rejected(msg *Message, reason string) {
+	s.topic(msg.GetTopic()).rejected.Add(1)
+
+	switch reason {
+	case RejectValidationQueueFull:
+		s.validationQueueFull.Add(1)
+	case RejectValidationThrottled:
+		s.validationThrottled.Add(1)
+	}
+}
+
+// duplicate counts the arrival of a message already seen
+func (s *pubsubStats) duplicate(msg *Message) {
+	s.topic(msg.GetTopic()).duplicates.Add(1)
+}
+
+// delivered counts a message passing validation, published by us or received from a peer
+func (s *pubsubStats) delivered(msg *Message, self bool) {
+	tc := s.topic(msg.GetTopic())
+	if self {
+		tc.published.Add(1)
+	} else {
+		tc.delivered.Add(1)
+	}
+}
+
+func (s *pubsubStats) snapshot(reset bool) PubSubStats {
+	load := (*atomic.Uint64).Load
+	if reset {
+		load = func(c *atomic.Uint64) uint64 { return c.Swap(0) }
+	}
+
+	s.mx.RLock()
+	topics := make(map[string]TopicStats, len(s.topics))
+	for topic, tc := range s.topics {
+		topics[topic] = TopicStats{
+			Published:  load(&tc.published),
+			Delivered:  load(&tc.delivered),
+			Rejected:   load(&tc.rejected),
+			Duplicates: load(&tc.duplicates),
+
+			BestEffortSkipped: load(&tc.bestEffortSkipped),
+		}
+	}
+	var peerDrops map[peer.ID]uint64
+	for p, c := range s.peerDrops {
+		if n := load(c); n > 0 {
+			if peerDrops == nil {
+				peerDrops = make(map[peer.ID]uint64)
+			}
+			peerDrops[p] = n
+		}
+	}
+	peerWrites := maps.Clone(s.peerWrites)
+	peerQueues := maps.Clone(s.peerQueues)
+	s.mx.RUnlock()
+
+	var writes map[peer.ID]WriteTimeStats
+	for p, w := range peerWrites {
+		if writes == nil {
+			writes = make(map[peer.ID]WriteTimeStats, len(peerWrites))
+		}
+		writes[p] = w.stats(false)
+	}
+
+	var queued map[peer.ID]map[string]QueueStats
+	for p, q := range peerQueues {
+		if qs := q.stats(); qs != nil {
+			if queued == nil {
+				queued = make(map[peer.ID]map[string]QueueStats)
+			}
+			queued[p] = qs
+		}
+	}
+
+	return PubSubStats{
+		Topics:   topics,
+		RPCsIn:   load(&s.rpcsIn),
+		RPCsOut:  load(&s.rpcsOut),
+		BytesIn:  load(&s.bytesIn),
+		BytesOut: load(&s.bytesOut),
+		Drops: DropStats{
+			ValidationQueueFull:     load(&s.validationQueueFull),
+			ValidationThrottled:     load(&s.validationThrottled),
+			OutboundQueueFull:       load(&s.outboundQueueFull),
+			OutboundQueueFullByPeer: peerDrops,
+			SubscriptionQueueFull:   load(&s.subscriptionQueueFull),
+		},
+		WriteTimes: writes,
+		Queued:     queued,
+	}
+}
+
+// rejectMessage counts and traces the rejection of a message
+func (p *PubSub) rejectMessage(msg *Message, reason string) {
+	p.stats.rejected(msg, reason)
+	p.tracer.RejectMessage(msg, reason)
+	p.ordered(msg, false)
+}
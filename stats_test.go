@@ -0,0 +1,73 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getGossipsubs(ctx, hosts)
+
+	err := psubs[1].RegisterTopicValidator("test", func(_ context.Context, _ peer.ID, msg *Message) bool {
+		return !bytes.Equal(msg.Data, []byte("bad"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var subs []*Subscription
+	for _, ps := range psubs {
+		subs = append(subs, mustSubscribe(t, ps, "test"))
+	}
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(time.Second)
+
+	for i := 0; i < 5; i++ {
+		if err := psubs[0].Publish("test", []byte("message")); err != nil {
+			t.Fatal(err)
+		}
+		assertReceive(t, subs[1], []byte("message"))
+	}
+	if err := psubs[0].Publish("test", []byte("bad")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	sent, received := psubs[0].Stats(), psubs[1].Stats()
+	if ts := sent.Topics["test"]; ts.Published != 6 || ts.Delivered != 0 || ts.MeshPeers != 1 {
+		t.Fatalf("unexpected publisher topic stats %+v", ts)
+	}
+	if ts := received.Topics["test"]; ts.Published != 0 || ts.Delivered != 5 || ts.Rejected != 1 || ts.MeshPeers != 1 {
+		t.Fatalf("unexpected receiver topic stats %+v", ts)
+	}
+	if sent.RPCsOut == 0 || sent.BytesOut == 0 || received.RPCsIn == 0 || received.BytesIn == 0 {
+		t.Fatalf("expected the RPCs to be counted, got %+v and %+v", sent, received)
+	}
+
+	// the stats are dumped as is
+	data, err := json.Marshal(received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded PubSubStats
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Topics["test"] != received.Topics["test"] || decoded.RPCsIn != received.RPCsIn {
+		t.Fatalf("unexpected stats %s", data)
+	}
+
+	// the counters start over once reset, the mesh sizes stay
+	psubs[1].Stats(WithStatsReset())
+	if ts := psubs[1].Stats().Topics["test"]; ts.Delivered != 0 || ts.Rejected != 0 || ts.MeshPeers != 1 {
+		t.Fatalf("unexpected topic stats after reset %+v", ts)
+	}
+}
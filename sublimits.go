@@ -0,0 +1,220 @@
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// reasons for exceeding the subscription limits
+const (
+	SubscriptionChurnExceeded = "subscription churn exceeded"
+	SubscriptionCountExceeded = "subscription count exceeded"
+)
+
+// ErrPeerSubscriptionLimit is the reason reported to SubscriptionFilterTracers for subscriptions
+// dropped because the peer exceeds its subscription count limit.
+var ErrPeerSubscriptionLimit = errors.New("peer subscription limit exceeded")
+
+// SubscriptionLimits bounds the subscriptions announced by each peer.
+// A peer exceeding the limits is graylisted: all its RPCs are ignored for GraylistDuration.
+type SubscriptionLimits struct {
+	// AnnouncementsPerMinute is the maximum number of subscription announcements (subscribe or
+	// unsubscribe) accepted from a peer per minute; 0 disables the limit.
+	AnnouncementsPerMinute int
+	// MaxSubscriptionsPerPeer is the maximum number of topics a peer may be subscribed to;
+	// 0 disables the limit.
+	MaxSubscriptionsPerPeer int
+	// GraylistDuration is how long a peer exceeding the limits is ignored.
+	GraylistDuration time.Duration
+	// DropExcessSubscriptions drops the subscriptions of a peer beyond MaxSubscriptionsPerPeer,
+	// reporting them to SubscriptionFilterTracers with ErrPeerSubscriptionLimit, instead of
+	// graylisting the peer.
+	DropExcessSubscriptions bool
+	// DirectPeerMaxSubscriptions overrides MaxSubscriptionsPerPeer for the direct peers of the
+	// router (see WithDirectPeers), which typically need a larger limit. Note that 0 disables
+	// the limit for direct peers, so limits built from scratch rather than from
+	// DefaultSubscriptionLimits leave direct peers unbounded unless this is set.
+	DirectPeerMaxSubscriptions int
+}
+
+// DefaultSubscriptionLimits returns the default subscription limits, which only bound the number
+// of topics per peer, with a larger bound for direct peers.
+func DefaultSubscriptionLimits() SubscriptionLimits {
+	return SubscriptionLimits{
+		MaxSubscriptionsPerPeer:    4096,
+		GraylistDuration:           10 * time.Minute,
+		DirectPeerMaxSubscriptions: 16384,
+	}
+}
+
+// WithSubscriptionLimits sets the limits on the subscriptions announced by peers.
+// Peers exceeding the limits are reported to raw tracers implementing SubscriptionLimitTracer.
+func WithSubscriptionLimits(limits SubscriptionLimits) Option {
+	return func(p *PubSub) error {
+		if limits.AnnouncementsPerMinute < 0 || limits.MaxSubscriptionsPerPeer < 0 || limits.DirectPeerMaxSubscriptions < 0 {
+			return fmt.Errorf("invalid subscription limits")
+		}
+		if limits.GraylistDuration <= 0 {
+			return fmt.Errorf("invalid subscription graylist duration: %s", limits.GraylistDuration)
+		}
+		p.subLimits.limits = limits
+		return nil
+	}
+}
+
+// SubscriptionLimitTracer is an optional interface for RawTracers, which is invoked when a peer
+// is graylisted for exceeding the subscription limits.
+// The reason argument is one of SubscriptionChurnExceeded or SubscriptionCountExceeded.
+type SubscriptionLimitTracer interface {
+	SubscriptionLimitExceeded(p peer.ID, reason string)
+}
+
+// subscriptionLimiter enforces the subscription limits; only accessed from the processLoop
+type subscriptionLimiter struct {
+	limits SubscriptionLimits
+	clock  Clock
+
+	peers     map[peer.ID]*peerSubscriptions
+	graylist  map[peer.ID]time.Time
+	lastSweep time.Time
+}
+
+type peerSubscriptions struct {
+	topics        int
+	windowStart   time.Time
+	announcements int
+}
+
+func newSubscriptionLimiter() *subscriptionLimiter {
+	return &subscriptionLimiter{
+		limits:   DefaultSubscriptionLimits(),
+		clock:    realClock{},
+		peers:    make(map[peer.ID]*peerSubscriptions),
+		graylist: make(map[peer.ID]time.Time),
+	}
+}
+
+// Graylisted returns whether the peer is graylisted
+func (sl *subscriptionLimiter) Graylisted(p peer.ID) bool {
+	expiry, ok := sl.graylist[p]
+	if !ok {
+		return false
+	}
+	if sl.clock.Now().After(expiry) {
+		delete(sl.graylist, p)
+		return false
+	}
+	return true
+}
+
+// Announce accounts for subscription announcements by a peer, returning false if the peer exceeds
+// the churn limit.
+func (sl *subscriptionLimiter) Announce(p peer.ID, count int) bool {
+	if sl.limits.AnnouncementsPerMinute == 0 || count == 0 {
+		return true
+	}
+
+	ps := sl.getPeer(p)
+	now := sl.clock.Now()
+	if now.Sub(ps.windowStart) >= time.Minute {
+		ps.windowStart = now
+		ps.announcements = 0
+	}
+
+	ps.announcements += count
+	return ps.announcements <= sl.limits.AnnouncementsPerMinute
+}
+
+// Subscribe accounts for a new subscription by a peer, returning false if the peer exceeds
+// the subscription count limit.
+func (sl *subscriptionLimiter) Subscribe(p peer.ID, direct bool) bool {
+	limit := sl.limits.MaxSubscriptionsPerPeer
+	if direct {
+		limit = sl.limits.DirectPeerMaxSubscriptions
+	}
+
+	ps := sl.getPeer(p)
+	if limit > 0 && ps.topics >= limit {
+		return false
+	}
+	ps.topics++
+	return true
+}
+
+// Unsubscribe accounts for a peer leaving a topic
+func (sl *subscriptionLimiter) Unsubscribe(p peer.ID) {
+	ps, ok := sl.peers[p]
+	if ok && ps.topics > 0 {
+		ps.topics--
+	}
+}
+
+// Graylist ignores the peer for the graylist duration
+func (sl *subscriptionLimiter) Graylist(p peer.ID) {
+	now := sl.clock.Now()
+	sl.graylist[p] = now.Add(sl.limits.GraylistDuration)
+
+	// the graylist outlives the peer connections, so expired entries are swept here
+	if now.Sub(sl.lastSweep) > sl.limits.GraylistDuration {
+		sl.lastSweep = now
+		for p, expiry := range sl.graylist {
+			if now.After(expiry) {
+				delete(sl.graylist, p)
+			}
+		}
+	}
+}
+
+// Ungraylist lifts the graylisting of a peer
+func (sl *subscriptionLimiter) Ungraylist(p peer.ID) {
+	delete(sl.graylist, p)
+}
+
+// RemovePeer drops the subscription accounting of a peer that was removed from all topics;
+// the graylist is retained so that reconnecting doesn't lift it.
+func (sl *subscriptionLimiter) RemovePeer(p peer.ID) {
+	delete(sl.peers, p)
+}
+
+func (sl *subscriptionLimiter) getPeer(p peer.ID) *peerSubscriptions {
+	ps, ok := sl.peers[p]
+	if !ok {
+		ps = &peerSubscriptions{windowStart: sl.clock.Now()}
+		sl.peers[p] = ps
+	}
+	return ps
+}
+
+// subscriptionLimitExceeded handles a subscription of a peer beyond the subscription count
+// limit, returning whether the RPC should still be processed.
+func (p *PubSub) subscriptionLimitExceeded(pid peer.ID, topic string) bool {
+	if p.subLimits.limits.DropExcessSubscriptions {
+		p.subsLimitExceeded.Add(1)
+		p.tracer.SubscriptionFiltered(pid, topic, ErrPeerSubscriptionLimit)
+		return true
+	}
+
+	p.graylistForSubscriptions(pid, SubscriptionCountExceeded)
+	return false
+}
+
+// directPeerRouter is implemented by routers with direct peers
+type directPeerRouter interface {
+	isDirectPeer(p peer.ID) bool
+}
+
+// isDirectPeer returns whether the peer is a direct peer of the router
+func (p *PubSub) isDirectPeer(pid peer.ID) bool {
+	dr, ok := p.rt.(directPeerRouter)
+	return ok && dr.isDirectPeer(pid)
+}
+
+// graylistForSubscriptions graylists a peer that exceeded the subscription limits
+func (p *PubSub) graylistForSubscriptions(pid peer.ID, reason string) {
+	log.Debugf("graylisting peer %s: %s", pid, reason)
+	p.subLimits.Graylist(pid)
+	p.tracer.SubscriptionLimitExceeded(pid, reason)
+}
@@ -0,0 +1,200 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// noopRawTracer implements RawTracer with no-ops, for embedding in test tracers
+type noopRawTracer struct{}
+
+func (noopRawTracer) AddPeer(p peer.ID, proto protocol.ID)      {}
+func (noopRawTracer) RemovePeer(p peer.ID)                      {}
+func (noopRawTracer) Join(topic string)                         {}
+func (noopRawTracer) Leave(topic string)                        {}
+func (noopRawTracer) Graft(p peer.ID, topic string)             {}
+func (noopRawTracer) Prune(p peer.ID, topic string)             {}
+func (noopRawTracer) ValidateMessage(msg *Message)              {}
+func (noopRawTracer) DeliverMessage(msg *Message)               {}
+func (noopRawTracer) RejectMessage(msg *Message, reason string) {}
+func (noopRawTracer) DuplicateMessage(msg *Message)             {}
+func (noopRawTracer) ThrottlePeer(p peer.ID)                    {}
+func (noopRawTracer) RecvRPC(rpc *RPC)                          {}
+func (noopRawTracer) SendRPC(rpc *RPC, p peer.ID)               {}
+func (noopRawTracer) DropRPC(rpc *RPC, p peer.ID)               {}
+func (noopRawTracer) UndeliverableMessage(msg *Message)         {}
+
+type subLimitTracer struct {
+	noopRawTracer
+
+	mx      sync.Mutex
+	reasons map[peer.ID]string
+}
+
+func (t *subLimitTracer) SubscriptionLimitExceeded(p peer.ID, reason string) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.reasons[p] = reason
+}
+
+func (t *subLimitTracer) reason(p peer.ID) string {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return t.reasons[p]
+}
+
+func TestSubscriptionCountLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := newMockClock()
+	tracer := &subLimitTracer{reasons: make(map[peer.ID]string)}
+
+	hosts := getNetHosts(t, ctx, 2)
+	limits := DefaultSubscriptionLimits()
+	limits.MaxSubscriptionsPerPeer = 3
+	limits.GraylistDuration = time.Minute
+	ps := getPubsub(ctx, hosts[0], WithSubscriptionLimits(limits), WithClock(clk), WithRawTracer(tracer))
+	spammer := getPubsub(ctx, hosts[1])
+
+	sub, err := ps.Subscribe("t0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := spammer.Subscribe(fmt.Sprintf("t%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(100 * time.Millisecond)
+
+	if reason := tracer.reason(hosts[1].ID()); reason != SubscriptionCountExceeded {
+		t.Fatalf("expected the peer to be graylisted for its subscription count, got %q", reason)
+	}
+
+	// the RPCs of the graylisted peer are ignored
+	if err := spammer.Publish("t0", []byte("graylisted")); err != nil {
+		t.Fatal(err)
+	}
+	assertNeverReceives(t, sub, time.Second)
+
+	clk.Add(2 * time.Minute)
+	if err := spammer.Publish("t0", []byte("forgiven")); err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, sub, []byte("forgiven"))
+}
+
+func TestSubscriptionChurnLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracer := &subLimitTracer{reasons: make(map[peer.ID]string)}
+
+	hosts := getNetHosts(t, ctx, 2)
+	limits := DefaultSubscriptionLimits()
+	limits.AnnouncementsPerMinute = 10
+	getPubsub(ctx, hosts[0], WithSubscriptionLimits(limits), WithRawTracer(tracer))
+	churner := getPubsub(ctx, hosts[1], WithAnnounceWindow(0))
+
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		sub, err := churner.Subscribe("churn")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub.Cancel()
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if reason := tracer.reason(hosts[1].ID()); reason != SubscriptionChurnExceeded {
+		t.Fatalf("expected the peer to be graylisted for its subscription churn, got %q", reason)
+	}
+}
+
+func TestSubscriptionLimitDropExcess(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracer := &subFilterTracer{filtered: make(map[peer.ID]map[string]error)}
+
+	hosts := getNetHosts(t, ctx, 3)
+	limits := DefaultSubscriptionLimits()
+	limits.MaxSubscriptionsPerPeer = 2
+	limits.DropExcessSubscriptions = true
+	ps := getGossipsub(ctx, hosts[0],
+		WithSubscriptionLimits(limits),
+		WithRawTracer(tracer),
+		WithDirectPeers([]peer.AddrInfo{{ID: hosts[2].ID(), Addrs: hosts[2].Addrs()}}))
+	regular := getGossipsub(ctx, hosts[1])
+	direct := getGossipsub(ctx, hosts[2])
+
+	sub0, err := regular.Subscribe("t0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := regular.Subscribe("t1"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := direct.Subscribe(fmt.Sprintf("t%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[0], hosts[2])
+	time.Sleep(100 * time.Millisecond)
+
+	// the excess subscription is dropped without graylisting the peer
+	if _, err := regular.Subscribe("t2"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if reasons := tracer.reasons(hosts[1].ID()); len(reasons) != 1 || reasons["t2"] != ErrPeerSubscriptionLimit {
+		t.Fatalf("expected t2 to be dropped, got %v", reasons)
+	}
+	if stats := ps.SubscriptionStats(); stats.LimitExceeded != 1 {
+		t.Fatalf("expected a single dropped subscription, got %+v", stats)
+	}
+
+	// unsubscribing makes room for another subscription
+	sub0.Cancel()
+	if _, err := regular.Subscribe("t3"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	for topic, expected := range map[string]int{"t0": 1, "t1": 2, "t2": 1, "t3": 2} {
+		if peers := ps.ListPeers(topic); len(peers) != expected {
+			t.Fatalf("expected %d peers in %s, got %v", expected, topic, peers)
+		}
+	}
+}
+
+func TestDirectPeerSubscriptionLimit(t *testing.T) {
+	sl := newSubscriptionLimiter()
+	direct := peer.ID("direct")
+
+	// direct peers are bounded by default, beyond the limit of the other peers
+	limits := DefaultSubscriptionLimits()
+	for i := 0; i < limits.DirectPeerMaxSubscriptions; i++ {
+		if !sl.Subscribe(direct, true) {
+			t.Fatalf("expected subscription %d of a direct peer to be accepted", i)
+		}
+	}
+	if sl.Subscribe(direct, true) {
+		t.Fatal("expected the direct peer to exceed its subscription limit")
+	}
+}
@@ -3,8 +3,29 @@ package pubsub
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 )
 
+// OverflowPolicy selects the message a subscription drops when its buffer is full.
+type OverflowPolicy int
+
+const (
+	// DropNewest drops the incoming message, keeping the buffered ones.
+	DropNewest OverflowPolicy = iota
+	// DropOldest overwrites the oldest buffered message with the incoming one, keeping the
+	// latest messages.
+	DropOldest
+)
+
+// WithOverflowPolicy is a Subscribe option to select the message dropped when the subscribe
+// output buffer is full; the default is DropNewest.
+func WithOverflowPolicy(policy OverflowPolicy) SubOpt {
+	return func(sub *Subscription) error {
+		sub.overflow = policy
+		return nil
+	}
+}
+
 // Subscription handles the details of a particular Topic subscription.
 // There may be many subscriptions for a given Topic.
 type Subscription struct {
@@ -14,6 +35,9 @@ type Subscription struct {
 	ctx      context.Context
 	err      error
 	once     sync.Once
+
+	overflow    OverflowPolicy
+	overwritten atomic.Uint64
 }
 
 // Topic returns the topic string associated with the Subscription
@@ -44,6 +68,37 @@ func (sub *Subscription) Cancel() {
 	}
 }
 
+// Overwritten returns the number of buffered messages overwritten by newer ones with the
+// DropOldest policy.
+func (sub *Subscription) Overwritten() uint64 {
+	return sub.overwritten.Load()
+}
+
+// offer hands a message to the subscription without blocking, returning whether it was
+// buffered and the message it overwrote, if any. Messages are only offered by a single
+// goroutine, so once a message is evicted there is room for the new one.
+func (sub *Subscription) offer(msg *Message) (bool, *Message) {
+	var evicted *Message
+	for {
+		select {
+		case sub.ch <- msg:
+			return true, evicted
+		default:
+		}
+
+		if sub.overflow != DropOldest || cap(sub.ch) == 0 || evicted != nil {
+			return false, evicted
+		}
+
+		select {
+		case evicted = <-sub.ch:
+			sub.overwritten.Add(1)
+		default:
+			// drained by the reader meanwhile
+		}
+	}
+}
+
 func (sub *Subscription) close() {
 	sub.once.Do(func() {
 		close(sub.ch)
@@ -3,6 +3,10 @@ package pubsub
 import (
 	"errors"
 	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 
@@ -13,6 +17,14 @@ import (
 // subscriptions to process.
 var ErrTooManySubscriptions = errors.New("too many subscriptions")
 
+// ErrSubscriptionFiltered is the reason reported to SubscriptionFilterTracers for subscriptions
+// that were rejected by the subscription filter.
+var ErrSubscriptionFiltered = errors.New("subscription rejected by filter")
+
+// ErrSubscriptionDisallowed is returned by a Subscription that was cancelled because its topic
+// is no longer allowed by the subscription filter.
+var ErrSubscriptionDisallowed = errors.New("subscription topic is no longer allowed")
+
 // SubscriptionFilter is a function that tells us whether we are interested in allowing and tracking
 // subscriptions for a given topic.
 //
@@ -36,10 +48,136 @@ type SubscriptionFilter interface {
 func WithSubscriptionFilter(subFilter SubscriptionFilter) Option {
 	return func(ps *PubSub) error {
 		ps.subFilter = subFilter
+		if f, ok := subFilter.(attachableSubscriptionFilter); ok {
+			f.attach(ps)
+		}
+		return nil
+	}
+}
+
+// SubscriptionFilterTracer is an optional interface for RawTracers, which is invoked for each
+// topic of the subscription announcements of a peer that are dropped by the subscription filter
+// or the subscription limits. The reason is ErrSubscriptionFiltered if the filter rejected the
+// topic, the error returned by the filter if it rejected the whole announcement (e.g.
+// ErrTooManySubscriptions), or ErrPeerSubscriptionLimit if the peer exceeded its limit.
+type SubscriptionFilterTracer interface {
+	SubscriptionFiltered(p peer.ID, topic string, reason error)
+}
+
+// SubscriptionStats are the counters of the subscription announcements dropped by the
+// subscription filter and the subscription limits.
+type SubscriptionStats struct {
+	// Filtered is the number of topics rejected by the filter.
+	Filtered uint64
+	// Errors is the number of topics dropped because the filter returned an error for their
+	// announcement, e.g. because of the limit of WrapLimitSubscriptionFilter.
+	Errors uint64
+	// LimitExceeded is the number of topics dropped because the peer exceeded its subscription
+	// count limit, with SubscriptionLimits.DropExcessSubscriptions.
+	LimitExceeded uint64
+}
+
+// SubscriptionStats returns the counters of the subscription announcements dropped by the
+// subscription filter and the subscription limits.
+func (p *PubSub) SubscriptionStats() SubscriptionStats {
+	return SubscriptionStats{
+		Filtered:      p.subsFiltered.Load(),
+		Errors:        p.subsFilterErrors.Load(),
+		LimitExceeded: p.subsLimitExceeded.Load(),
+	}
+}
+
+// filterIncomingSubscriptions applies the subscription filter to the subscription announcements
+// of a peer, tracing the dropped topics.
+func (p *PubSub) filterIncomingSubscriptions(from peer.ID, subs []*pb.RPC_SubOpts) ([]*pb.RPC_SubOpts, error) {
+	var bypassed []*pb.RPC_SubOpts
+	if p.bypassFilters > 0 {
+		filtered := make([]*pb.RPC_SubOpts, 0, len(subs))
+		for _, sub := range subs {
+			if p.bypassesFilter(sub.GetTopicid()) {
+				bypassed = append(bypassed, sub)
+			} else {
+				filtered = append(filtered, sub)
+			}
+		}
+		if len(bypassed) > 0 {
+			bypassed = FilterSubscriptions(bypassed, func(string) bool { return true })
+			subs = filtered
+		}
+	}
+
+	accepted, err := p.subFilter.FilterIncomingSubscriptions(from, subs)
+	if err != nil {
+		for _, topic := range subscriptionTopics(subs, nil) {
+			p.subsFilterErrors.Add(1)
+			p.tracer.SubscriptionFiltered(from, topic, err)
+		}
+		return nil, err
+	}
+
+	// the accepted subscriptions are a deduplicated subset of the announcements
+	if len(accepted) < len(subs) {
+		keep := make(map[string]struct{}, len(accepted))
+		for _, sub := range accepted {
+			keep[sub.GetTopicid()] = struct{}{}
+		}
+		for _, topic := range subscriptionTopics(subs, keep) {
+			p.subsFiltered.Add(1)
+			p.tracer.SubscriptionFiltered(from, topic, ErrSubscriptionFiltered)
+		}
+	}
+
+	return append(accepted, bypassed...), nil
+}
+
+// WithBypassSubscriptionFilter allows joining a Topic that the subscription filter doesn't
+// allow, e.g. a dynamically created local topic. While the Topic is joined, the subscriptions
+// of remote peers to it are tracked without consulting the filter, so that they can take part
+// in the topic; the announcements of all other topics are still filtered. Subscriptions
+// announced before the Topic is joined were filtered, and are only tracked once re-announced.
+//
+// This trades away the guarantee that the filter bounds the topics tracked for remote peers:
+// the application becomes responsible for the topics it joins with this option, which must
+// not be derived from untrusted input.
+func WithBypassSubscriptionFilter() TopicOpt {
+	return func(t *Topic) error {
+		t.bypassFilter = true
 		return nil
 	}
 }
 
+// bypassesFilter returns whether the topic is joined with WithBypassSubscriptionFilter.
+// Only called from processLoop.
+func (p *PubSub) bypassesFilter(topic string) bool {
+	t, ok := p.myTopics[topic]
+	return ok && t.bypassFilter
+}
+
+// subscriptionTopics returns the distinct topics of the subscriptions, except the skipped ones
+func subscriptionTopics(subs []*pb.RPC_SubOpts, skip map[string]struct{}) []string {
+	seen := make(map[string]struct{}, len(subs))
+	var topics []string
+	for _, sub := range subs {
+		topic := sub.GetTopicid()
+		if _, ok := skip[topic]; ok {
+			continue
+		}
+		if _, ok := seen[topic]; ok {
+			continue
+		}
+		seen[topic] = struct{}{}
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// attachableSubscriptionFilter is implemented by subscription filters that need to notify the
+// pubsub instances using them; detach is called when an instance shuts down
+type attachableSubscriptionFilter interface {
+	attach(ps *PubSub)
+	detach(ps *PubSub)
+}
+
 // NewAllowlistSubscriptionFilter creates a subscription filter that only allows explicitly
 // specified topics for local subscriptions and incoming peer subscriptions.
 func NewAllowlistSubscriptionFilter(topics ...string) SubscriptionFilter {
@@ -66,13 +204,30 @@ func (f *allowlistSubscriptionFilter) FilterIncomingSubscriptions(from peer.ID,
 	return FilterSubscriptions(subs, f.CanSubscribe), nil
 }
 
+// MaxFilteredTopicLength bounds the cost of evaluating the regexp and prefix subscription
+// filters: longer topics are rejected without being matched.
+var MaxFilteredTopicLength = 1024
+
 // NewRegexpSubscriptionFilter creates a subscription filter that only allows topics that
-// match a regular expression for local subscriptions and incoming peer subscriptions.
+// match one of the given regular expressions for local subscriptions and incoming peer
+// subscriptions. The expressions are combined into a single precompiled expression, so that
+// each topic is matched in a single pass.
 //
 // Warning: the user should take care to match start/end of string in the supplied regular
 // expression, otherwise the filter might match unwanted topics unexpectedly.
-func NewRegexpSubscriptionFilter(rx *regexp.Regexp) SubscriptionFilter {
-	return &rxSubscriptionFilter{allow: rx}
+func NewRegexpSubscriptionFilter(patterns ...*regexp.Regexp) SubscriptionFilter {
+	switch len(patterns) {
+	case 0:
+		return &rxSubscriptionFilter{}
+	case 1:
+		return &rxSubscriptionFilter{allow: patterns[0]}
+	}
+
+	alternatives := make([]string, 0, len(patterns))
+	for _, rx := range patterns {
+		alternatives = append(alternatives, "(?:"+rx.String()+")")
+	}
+	return &rxSubscriptionFilter{allow: regexp.MustCompile(strings.Join(alternatives, "|"))}
 }
 
 type rxSubscriptionFilter struct {
@@ -82,6 +237,9 @@ type rxSubscriptionFilter struct {
 var _ SubscriptionFilter = (*rxSubscriptionFilter)(nil)
 
 func (f *rxSubscriptionFilter) CanSubscribe(topic string) bool {
+	if f.allow == nil || len(topic) > MaxFilteredTopicLength {
+		return false
+	}
 	return f.allow.MatchString(topic)
 }
 
@@ -89,6 +247,53 @@ func (f *rxSubscriptionFilter) FilterIncomingSubscriptions(from peer.ID, subs []
 	return FilterSubscriptions(subs, f.CanSubscribe), nil
 }
 
+// NewPrefixSubscriptionFilter creates a subscription filter that only allows topics starting
+// with one of the given prefixes for local subscriptions and incoming peer subscriptions.
+// Matching a topic costs a map lookup per distinct prefix length.
+func NewPrefixSubscriptionFilter(prefixes ...string) SubscriptionFilter {
+	f := &prefixSubscriptionFilter{prefixes: make(map[string]struct{})}
+	lengths := make(map[int]struct{})
+	for _, prefix := range prefixes {
+		f.prefixes[prefix] = struct{}{}
+		lengths[len(prefix)] = struct{}{}
+	}
+
+	for l := range lengths {
+		f.lengths = append(f.lengths, l)
+	}
+	sort.Ints(f.lengths)
+
+	return f
+}
+
+type prefixSubscriptionFilter struct {
+	prefixes map[string]struct{}
+	// lengths are the distinct prefix lengths, in increasing order
+	lengths []int
+}
+
+var _ SubscriptionFilter = (*prefixSubscriptionFilter)(nil)
+
+func (f *prefixSubscriptionFilter) CanSubscribe(topic string) bool {
+	if len(topic) > MaxFilteredTopicLength {
+		return false
+	}
+
+	for _, l := range f.lengths {
+		if l > len(topic) {
+			break
+		}
+		if _, ok := f.prefixes[topic[:l]]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *prefixSubscriptionFilter) FilterIncomingSubscriptions(from peer.ID, subs []*pb.RPC_SubOpts) ([]*pb.RPC_SubOpts, error) {
+	return FilterSubscriptions(subs, f.CanSubscribe), nil
+}
+
 // FilterSubscriptions filters (and deduplicates) a list of subscriptions.
 // filter should return true if a topic is of interest.
 func FilterSubscriptions(subs []*pb.RPC_SubOpts, filter func(string) bool) []*pb.RPC_SubOpts {
@@ -147,3 +352,106 @@ func (f *limitSubscriptionFilter) FilterIncomingSubscriptions(from peer.ID, subs
 
 	return f.filter.FilterIncomingSubscriptions(from, subs)
 }
+
+func (f *limitSubscriptionFilter) attach(ps *PubSub) {
+	if af, ok := f.filter.(attachableSubscriptionFilter); ok {
+		af.attach(ps)
+	}
+}
+
+func (f *limitSubscriptionFilter) detach(ps *PubSub) {
+	if af, ok := f.filter.(attachableSubscriptionFilter); ok {
+		af.detach(ps)
+	}
+}
+
+// MutableSubscriptionFilter is a subscription filter whose allowed topics can be changed at
+// runtime. It is safe for concurrent use.
+type MutableSubscriptionFilter struct {
+	base  SubscriptionFilter
+	force bool
+
+	mx        sync.RWMutex
+	overrides map[string]bool
+	attached  []*PubSub
+}
+
+var _ SubscriptionFilter = (*MutableSubscriptionFilter)(nil)
+
+// NewMutableSubscriptionFilter creates a MutableSubscriptionFilter, which allows the topics
+// allowed by base (if not nil) and the topics added with AddAllowed, except for the topics
+// removed with RemoveAllowed.
+//
+// If forceUnsubscribe is false, existing subscriptions to topics that become disallowed are
+// left in place: the filter only applies to new subscriptions, and the subscriptions of remote
+// peers are tracked until they disconnect. If forceUnsubscribe is true, the local subscriptions
+// and relays are cancelled with ErrSubscriptionDisallowed and the remote subscriptions are
+// dropped. To wrap it with WrapLimitSubscriptionFilter, it must be the inner filter.
+func NewMutableSubscriptionFilter(base SubscriptionFilter, forceUnsubscribe bool) *MutableSubscriptionFilter {
+	return &MutableSubscriptionFilter{
+		base:      base,
+		force:     forceUnsubscribe,
+		overrides: make(map[string]bool),
+	}
+}
+
+// AddAllowed allows the given topics.
+func (f *MutableSubscriptionFilter) AddAllowed(topics ...string) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	for _, topic := range topics {
+		f.overrides[topic] = true
+	}
+}
+
+// RemoveAllowed disallows the given topics, cancelling their subscriptions if the filter
+// forces unsubscription. It must not be called from pubsub callbacks, such as validators.
+func (f *MutableSubscriptionFilter) RemoveAllowed(topics ...string) {
+	f.mx.Lock()
+	for _, topic := range topics {
+		f.overrides[topic] = false
+	}
+	attached := f.attached
+	f.mx.Unlock()
+
+	if !f.force {
+		return
+	}
+
+	for _, ps := range attached {
+		select {
+		case ps.disallowTopics <- topics:
+		case <-ps.ctx.Done():
+		}
+	}
+}
+
+func (f *MutableSubscriptionFilter) CanSubscribe(topic string) bool {
+	f.mx.RLock()
+	allowed, ok := f.overrides[topic]
+	f.mx.RUnlock()
+
+	if ok {
+		return allowed
+	}
+	return f.base != nil && f.base.CanSubscribe(topic)
+}
+
+func (f *MutableSubscriptionFilter) FilterIncomingSubscriptions(from peer.ID, subs []*pb.RPC_SubOpts) ([]*pb.RPC_SubOpts, error) {
+	return FilterSubscriptions(subs, f.CanSubscribe), nil
+}
+
+func (f *MutableSubscriptionFilter) attach(ps *PubSub) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.attached = append(f.attached, ps)
+}
+
+func (f *MutableSubscriptionFilter) detach(ps *PubSub) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.attached = slices.DeleteFunc(slices.Clone(f.attached), func(a *PubSub) bool { return a == ps })
+}
@@ -2,10 +2,14 @@ package pubsub
 
 import (
 	"context"
+	"fmt"
 	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/gogo/protobuf/proto"
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -208,3 +212,282 @@ func TestSubscriptionFilterRPC(t *testing.T) {
 		t.Fatal("expected no subscription for test1")
 	}
 }
+
+func TestPatternSubscriptionFilters(t *testing.T) {
+	peerA := peer.ID("A")
+
+	var subs []*pb.RPC_SubOpts
+	for i := 0; i < 5000; i++ {
+		subs = append(subs,
+			&pb.RPC_SubOpts{Topicid: proto.String(fmt.Sprintf("blocks/shard-%d", i)), Subscribe: proto.Bool(true)},
+			&pb.RPC_SubOpts{Topicid: proto.String(fmt.Sprintf("txs/shard-%d", i)), Subscribe: proto.Bool(true)},
+			&pb.RPC_SubOpts{Topicid: proto.String(fmt.Sprintf("misc/%d", i)), Subscribe: proto.Bool(true)},
+		)
+	}
+
+	filters := map[string]SubscriptionFilter{
+		"regexp": NewRegexpSubscriptionFilter(regexp.MustCompile("^blocks/shard-[0-9]+$"), regexp.MustCompile("^txs/")),
+		"prefix": NewPrefixSubscriptionFilter("blocks/shard-", "txs/", "txs/shard-"),
+	}
+	for name, filter := range filters {
+		allowed, err := filter.FilterIncomingSubscriptions(peerA, subs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(allowed) != 10000 {
+			t.Fatalf("%s: expected 10000 allowed subscriptions but got %d", name, len(allowed))
+		}
+		for _, sub := range allowed {
+			if strings.HasPrefix(sub.GetTopicid(), "misc/") {
+				t.Fatalf("%s: unexpected subscription to %s", name, sub.GetTopicid())
+			}
+		}
+
+		if filter.CanSubscribe("blocks/shard-") != (name == "prefix") {
+			t.Fatalf("%s: unexpected match of the bare prefix", name)
+		}
+		if filter.CanSubscribe("blocks/shard-1" + strings.Repeat("1", MaxFilteredTopicLength)) {
+			t.Fatalf("%s: expected overlong topics to be rejected", name)
+		}
+	}
+
+	if NewRegexpSubscriptionFilter().CanSubscribe("blocks/shard-1") || NewPrefixSubscriptionFilter().CanSubscribe("blocks/shard-1") {
+		t.Fatal("expected empty filters to reject all topics")
+	}
+}
+
+func TestPrefixSubscriptionFilterRPC(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	ps1 := getPubsub(ctx, hosts[0], WithSubscriptionFilter(NewPrefixSubscriptionFilter("blocks/")))
+	ps2 := getPubsub(ctx, hosts[1])
+
+	for i := 0; i < 1000; i++ {
+		_ = mustSubscribe(t, ps2, fmt.Sprintf("blocks/shard-%d", i))
+		_ = mustSubscribe(t, ps2, fmt.Sprintf("misc/%d", i))
+	}
+
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(time.Second)
+
+	tracked := make(chan int)
+	ps1.eval <- func() {
+		count := 0
+		for topic, peers := range ps1.topics {
+			if _, ok := peers[hosts[1].ID()]; ok {
+				if !strings.HasPrefix(topic, "blocks/") {
+					t.Errorf("unexpected subscription to %s", topic)
+				}
+				count++
+			}
+		}
+		tracked <- count
+	}
+	if count := <-tracked; count != 1000 {
+		t.Fatalf("expected 1000 tracked subscriptions, got %d", count)
+	}
+}
+
+func TestMutableSubscriptionFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 3)
+	forced := NewMutableSubscriptionFilter(NewAllowlistSubscriptionFilter("a"), true)
+	lenient := NewMutableSubscriptionFilter(nil, false)
+	lenient.AddAllowed("a")
+	ps1 := getPubsub(ctx, hosts[0], WithSubscriptionFilter(WrapLimitSubscriptionFilter(forced, 100)))
+	ps2 := getPubsub(ctx, hosts[1])
+	ps3 := getPubsub(ctx, hosts[2], WithSubscriptionFilter(lenient))
+
+	if _, err := ps1.Join("b"); err == nil {
+		t.Fatal("expected subscription error")
+	}
+	forced.AddAllowed("b")
+
+	sub1a := mustSubscribe(t, ps1, "a")
+	_ = mustSubscribe(t, ps1, "b")
+	_ = mustSubscribe(t, ps2, "a")
+	_ = mustSubscribe(t, ps2, "b")
+	sub3a := mustSubscribe(t, ps3, "a")
+
+	connectAll(t, hosts)
+	time.Sleep(time.Second)
+
+	forced.RemoveAllowed("a")
+	lenient.RemoveAllowed("a")
+
+	if _, err := sub1a.Next(ctx); err != ErrSubscriptionDisallowed {
+		t.Fatalf("expected ErrSubscriptionDisallowed, got %v", err)
+	}
+	if _, err := ps1.Join("a"); err == nil {
+		t.Fatal("expected subscription error")
+	}
+	if peers := ps1.ListPeers("a"); len(peers) != 0 {
+		t.Fatalf("expected the remote subscriptions to be dropped, got %v", peers)
+	}
+	if peers := ps1.ListPeers("b"); len(peers) != 1 {
+		t.Fatalf("expected the remote subscriptions of allowed topics to be kept, got %v", peers)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	peers := ps2.ListPeers("a")
+	if len(peers) != 1 || peers[0] != hosts[2].ID() {
+		t.Fatalf("expected the unsubscription to be announced, got %v", peers)
+	}
+
+	// the subscriptions of the lenient filter are left in place
+	if err := ps2.Publish("a", []byte("still here")); err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, sub3a, []byte("still here"))
+}
+
+func TestMutableSubscriptionFilterDetach(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	filter := NewMutableSubscriptionFilter(nil, true)
+	psCtx, psCancel := context.WithCancel(ctx)
+	_ = getPubsub(psCtx, hosts[0], WithSubscriptionFilter(filter))
+
+	// the filter forgets the instances that shut down, so they can be collected
+	psCancel()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		filter.mx.RLock()
+		attached := len(filter.attached)
+		filter.mx.RUnlock()
+		if attached == 0 {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("expected the filter to be detached on shutdown")
+		}
+	}
+	filter.RemoveAllowed("a")
+}
+
+type subFilterTracer struct {
+	noopRawTracer
+
+	mx       sync.Mutex
+	filtered map[peer.ID]map[string]error
+}
+
+func (t *subFilterTracer) SubscriptionFiltered(p peer.ID, topic string, reason error) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	topics, ok := t.filtered[p]
+	if !ok {
+		topics = make(map[string]error)
+		t.filtered[p] = topics
+	}
+	topics[topic] = reason
+}
+
+func (t *subFilterTracer) reasons(p peer.ID) map[string]error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	reasons := make(map[string]error)
+	for topic, reason := range t.filtered[p] {
+		reasons[topic] = reason
+	}
+	return reasons
+}
+
+func TestSubscriptionFilterTracing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracer := &subFilterTracer{filtered: make(map[peer.ID]map[string]error)}
+
+	hosts := getNetHosts(t, ctx, 3)
+	ps1 := getPubsub(ctx, hosts[0],
+		WithSubscriptionFilter(WrapLimitSubscriptionFilter(NewAllowlistSubscriptionFilter("test1"), 3)),
+		WithRawTracer(tracer))
+	ps2 := getPubsub(ctx, hosts[1])
+	ps3 := getPubsub(ctx, hosts[2])
+
+	_ = mustSubscribe(t, ps2, "test1")
+	_ = mustSubscribe(t, ps2, "test2")
+	for i := 0; i < 4; i++ {
+		_ = mustSubscribe(t, ps3, fmt.Sprintf("test%d", i))
+	}
+
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[0], hosts[2])
+	time.Sleep(time.Second)
+
+	reasons := tracer.reasons(hosts[1].ID())
+	if len(reasons) != 1 || reasons["test2"] != ErrSubscriptionFiltered {
+		t.Fatalf("expected test2 to be filtered, got %v", reasons)
+	}
+
+	reasons = tracer.reasons(hosts[2].ID())
+	if len(reasons) != 4 {
+		t.Fatalf("expected all 4 topics to be dropped, got %v", reasons)
+	}
+	for topic, reason := range reasons {
+		if reason != ErrTooManySubscriptions {
+			t.Fatalf("expected %s to be dropped for too many subscriptions, got %v", topic, reason)
+		}
+	}
+
+	stats := ps1.SubscriptionStats()
+	if stats.Filtered != 1 || stats.Errors != 4 {
+		t.Fatalf("unexpected subscription stats: %+v", stats)
+	}
+}
+
+func TestBypassSubscriptionFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracer := &subFilterTracer{filtered: make(map[peer.ID]map[string]error)}
+
+	hosts := getNetHosts(t, ctx, 2)
+	ps1 := getPubsub(ctx, hosts[0], WithSubscriptionFilter(NewAllowlistSubscriptionFilter("static")), WithRawTracer(tracer))
+	ps2 := getPubsub(ctx, hosts[1])
+
+	if _, err := ps1.Join("dynamic"); err == nil {
+		t.Fatal("expected subscription error")
+	}
+	dynamic, err := ps1.Join("dynamic", WithBypassSubscriptionFilter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub1, err := dynamic.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub2 := mustSubscribe(t, ps2, "dynamic")
+	_ = mustSubscribe(t, ps2, "other")
+
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(time.Second)
+
+	// the remote subscription to the bypassed topic is tracked, the other one is still filtered
+	if peers := ps1.ListPeers("dynamic"); len(peers) != 1 {
+		t.Fatalf("expected the remote subscription to be tracked, got %v", peers)
+	}
+	if reasons := tracer.reasons(hosts[1].ID()); len(reasons) != 1 || reasons["other"] != ErrSubscriptionFiltered {
+		t.Fatalf("expected the other topic to be filtered, got %v", reasons)
+	}
+
+	if err := dynamic.Publish(ctx, []byte("outbound")); err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, sub1, []byte("outbound"))
+	assertReceive(t, sub2, []byte("outbound"))
+
+	if err := ps2.Publish("dynamic", []byte("inbound")); err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, sub1, []byte("inbound"))
+}
@@ -0,0 +1,54 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionOverflowPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0])
+
+	newest, err := ps.Subscribe("test", WithBufferSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldest, err := ps.Subscribe("test", WithBufferSize(4), WithOverflowPolicy(DropOldest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := ps.Publish("test", []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for oldest.Overwritten() < 6 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 6 overwritten messages, got %d", oldest.Overwritten())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the default policy keeps the first messages, the other one the latest
+	for i := 0; i < 4; i++ {
+		assertReceive(t, newest, []byte(fmt.Sprint(i)))
+		assertReceive(t, oldest, []byte(fmt.Sprint(6+i)))
+	}
+	if newest.Overwritten() != 0 || oldest.Overwritten() != 6 {
+		t.Fatalf("unexpected overwritten counts %d and %d", newest.Overwritten(), oldest.Overwritten())
+	}
+
+	// and it keeps delivering once drained
+	if err := ps.Publish("test", []byte("last")); err != nil {
+		t.Fatal(err)
+	}
+	assertReceive(t, oldest, []byte("last"))
+}
@@ -28,19 +28,130 @@ var (
 	// GossipSubConnTagMessageDeliveryCap is the maximum value for the connection manager tags that
 	// track message deliveries.
 	GossipSubConnTagMessageDeliveryCap = 15
+
+	// GossipSubConnTagPrefix is the prefix of the names of the connection manager tags.
+	GossipSubConnTagPrefix = "pubsub"
 )
 
+// ConnTagParams are the parameters of the connection manager tags applied by gossipsub.
+type ConnTagParams struct {
+	// MessageDeliveryBump is the amount added to the delivery tag of a peer each time it is the
+	// first to deliver a message within a topic.
+	MessageDeliveryBump int
+	// MessageDeliveryCap is the maximum value of the delivery tags.
+	MessageDeliveryCap int
+	// DecayInterval is the decay interval of the delivery tags.
+	DecayInterval time.Duration
+	// DecayAmount is subtracted from the delivery tags at every decay interval.
+	DecayAmount int
+
+	// Prefix is the prefix of the names of the tags, GossipSubConnTagPrefix if empty: the mesh
+	// tags are named <Prefix>:<topic>, the delivery tags <Prefix>-deliveries:<topic>, the pinned
+	// peer tags <Prefix>-pinned:<topic> and the direct peer tag <Prefix>:<direct>.
+	Prefix string
+	// DisableMeshTags disables the tags of the mesh peers, leaving their connections to the
+	// application.
+	DisableMeshTags bool
+	// DisableDeliveryTags disables the delivery tags.
+	DisableDeliveryTags bool
+}
+
+// DefaultConnTagParams returns the default connection manager tag parameters.
+func DefaultConnTagParams() ConnTagParams {
+	return ConnTagParams{
+		MessageDeliveryBump: GossipSubConnTagBumpMessageDelivery,
+		MessageDeliveryCap:  GossipSubConnTagMessageDeliveryCap,
+		DecayInterval:       GossipSubConnTagDecayInterval,
+		DecayAmount:         GossipSubConnTagDecayAmount,
+		Prefix:              GossipSubConnTagPrefix,
+	}
+}
+
+// ConnTagWeights are the connection manager tag weights of a topic.
+type ConnTagWeights struct {
+	// MeshPeer is the value of the tag of the mesh peers of the topic; 0 protects them instead,
+	// which is the default.
+	MeshPeer int
+	// MessageDeliveryBump overrides the delivery tag bump of ConnTagParams for the topic, if set.
+	MessageDeliveryBump int
+	// MessageDeliveryCap overrides the delivery tag cap of ConnTagParams for the topic, if set.
+	MessageDeliveryCap int
+}
+
+// WithConnTagParams is a gossipsub router option that sets the parameters of the connection
+// manager tags, instead of the GossipSubConnTag defaults.
+func WithConnTagParams(params ConnTagParams) Option {
+	return func(ps *PubSub) error {
+		gs, ok := ps.rt.(*GossipSubRouter)
+		if !ok {
+			return fmt.Errorf("pubsub router is not gossipsub")
+		}
+		if params.MessageDeliveryBump < 0 || params.MessageDeliveryCap < 0 || params.DecayInterval <= 0 || params.DecayAmount < 0 {
+			return fmt.Errorf("invalid connection manager tag params")
+		}
+
+		if gs.tagTracer != nil {
+			gs.tagTracer.params = params
+		}
+		return nil
+	}
+}
+
+// WithTopicConnTagWeights is a gossipsub router option that sets the connection manager tag
+// weights of a topic.
+func WithTopicConnTagWeights(topic string, weights ConnTagWeights) Option {
+	return func(ps *PubSub) error {
+		gs, ok := ps.rt.(*GossipSubRouter)
+		if !ok {
+			return fmt.Errorf("pubsub router is not gossipsub")
+		}
+		if weights.MeshPeer < 0 || weights.MessageDeliveryBump < 0 || weights.MessageDeliveryCap < 0 {
+			return fmt.Errorf("invalid connection manager tag weights")
+		}
+
+		if gs.tagTracer != nil {
+			gs.tagTracer.weights[topic] = weights
+		}
+		return nil
+	}
+}
+
+// PinPeer protects the connections of a peer for a topic with the connection manager, like the
+// direct peers, until unpinned with UnpinPeer; unlike the mesh peers, pinned peers are protected
+// even when their topic sets a mesh peer tag weight. It requires the gossipsub router.
+func (p *PubSub) PinPeer(topic string, pid peer.ID) error {
+	gs, ok := p.rt.(*GossipSubRouter)
+	if !ok {
+		return fmt.Errorf("pubsub router is not gossipsub")
+	}
+	gs.tagTracer.pin(pid, topic)
+	return nil
+}
+
+// UnpinPeer removes the protection of a peer pinned with PinPeer for a topic.
+func (p *PubSub) UnpinPeer(topic string, pid peer.ID) error {
+	gs, ok := p.rt.(*GossipSubRouter)
+	if !ok {
+		return fmt.Errorf("pubsub router is not gossipsub")
+	}
+	gs.tagTracer.unpin(pid, topic)
+	return nil
+}
+
 // tagTracer is an internal tracer that applies connection manager tags to peer
 // connections based on their behavior.
 //
 // We tag a peer's connections for the following reasons:
-//   - Directly connected peers are tagged with GossipSubConnTagValueDirectPeer (default 1000).
-//   - Mesh peers are tagged with a value of GossipSubConnTagValueMeshPeer (default 20).
+//   - Directly connected peers and pinned peers are protected.
+//   - Mesh peers are protected, or tagged with the MeshPeer weight of their topic if set.
 //     If a peer is in multiple topic meshes, they'll be tagged for each.
 //   - For each message that we receive, we bump a delivery tag for peer that delivered the message
 //     first.
-//     The delivery tags have a maximum value, GossipSubConnTagMessageDeliveryCap, and they decay at
-//     a rate of GossipSubConnTagDecayAmount / GossipSubConnTagDecayInterval.
+//     The delivery tags have a maximum value, MessageDeliveryCap, and they decay at a rate of
+//     DecayAmount / DecayInterval of the ConnTagParams.
+//
+// The mesh and direct peer tags are removed when the peer disconnects, and the delivery tags when
+// we leave their topic.
 type tagTracer struct {
 	sync.RWMutex
 
@@ -49,6 +160,12 @@ type tagTracer struct {
 	decayer  connmgr.Decayer
 	decaying map[string]connmgr.DecayingTag
 	direct   map[peer.ID]struct{}
+	params   ConnTagParams
+	weights  map[string]ConnTagWeights
+	// the topics each pinned peer is pinned for
+	pinned map[peer.ID]map[string]struct{}
+	// the topics each peer is tagged as a mesh peer for
+	mesh map[peer.ID]map[string]struct{}
 
 	// a map of message ids to the set of peers who delivered the message after the first delivery,
 	// but before the message was finished validating
@@ -65,6 +182,10 @@ func newTagTracer(cmgr connmgr.ConnManager) *tagTracer {
 		idGen:     newMsgIdGenerator(),
 		decayer:   decayer,
 		decaying:  make(map[string]connmgr.DecayingTag),
+		params:    DefaultConnTagParams(),
+		weights:   make(map[string]ConnTagWeights),
+		pinned:    make(map[peer.ID]map[string]struct{}),
+		mesh:      make(map[peer.ID]map[string]struct{}),
 		nearFirst: make(map[string]map[peer.ID]struct{}),
 	}
 }
@@ -86,37 +207,171 @@ func (t *tagTracer) tagPeerIfDirect(p peer.ID) {
 	// tag peer if it is a direct peer
 	_, direct := t.direct[p]
 	if direct {
-		t.cmgr.Protect(p, "pubsub:<direct>")
+		t.cmgr.Protect(p, t.directTag())
+	}
+}
+
+func (t *tagTracer) untagPeerIfDirect(p peer.ID) {
+	if _, direct := t.direct[p]; direct {
+		t.cmgr.Unprotect(p, t.directTag())
 	}
 }
 
 func (t *tagTracer) tagMeshPeer(p peer.ID, topic string) {
-	tag := topicTag(topic)
+	if t.params.DisableMeshTags {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	topics, ok := t.mesh[p]
+	if !ok {
+		topics = make(map[string]struct{})
+		t.mesh[p] = topics
+	}
+	topics[topic] = struct{}{}
+
+	tag := t.meshTag(topic)
+	if w := t.weights[topic].MeshPeer; w > 0 {
+		t.cmgr.TagPeer(p, tag, w)
+		return
+	}
 	t.cmgr.Protect(p, tag)
 }
 
 func (t *tagTracer) untagMeshPeer(p peer.ID, topic string) {
-	tag := topicTag(topic)
+	t.Lock()
+	defer t.Unlock()
+
+	topics, ok := t.mesh[p]
+	if !ok {
+		return
+	}
+	if _, ok := topics[topic]; !ok {
+		return
+	}
+	delete(topics, topic)
+	if len(topics) == 0 {
+		delete(t.mesh, p)
+	}
+	t.removeMeshTag(p, topic)
+}
+
+// untagPeer removes the mesh tags of a disconnected peer
+func (t *tagTracer) untagPeer(p peer.ID) {
+	t.Lock()
+	defer t.Unlock()
+
+	for topic := range t.mesh[p] {
+		t.removeMeshTag(p, topic)
+	}
+	delete(t.mesh, p)
+}
+
+func (t *tagTracer) removeMeshTag(p peer.ID, topic string) {
+	tag := t.meshTag(topic)
+	if t.weights[topic].MeshPeer > 0 {
+		t.cmgr.UntagPeer(p, tag)
+		return
+	}
 	t.cmgr.Unprotect(p, tag)
 }
 
-func topicTag(topic string) string {
-	return fmt.Sprintf("pubsub:%s", topic)
+// tagPrefix returns the prefix of the names of the tags
+func (t *tagTracer) tagPrefix() string {
+	if t.params.Prefix != "" {
+		return t.params.Prefix
+	}
+	return GossipSubConnTagPrefix
+}
+
+func (t *tagTracer) directTag() string {
+	return t.tagPrefix() + ":<direct>"
+}
+
+func (t *tagTracer) meshTag(topic string) string {
+	return fmt.Sprintf("%s:%s", t.tagPrefix(), topic)
+}
+
+func (t *tagTracer) pinnedTag(topic string) string {
+	return fmt.Sprintf("%s-pinned:%s", t.tagPrefix(), topic)
+}
+
+func (t *tagTracer) deliveryTag(topic string) string {
+	return fmt.Sprintf("%s-deliveries:%s", t.tagPrefix(), topic)
+}
+
+// pin protects a peer entering the pinned set of a topic
+func (t *tagTracer) pin(p peer.ID, topic string) {
+	if t == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	topics, ok := t.pinned[p]
+	if !ok {
+		topics = make(map[string]struct{})
+		t.pinned[p] = topics
+	}
+	topics[topic] = struct{}{}
+	t.cmgr.Protect(p, t.pinnedTag(topic))
+}
+
+// unpin unprotects a peer leaving the pinned set of a topic
+func (t *tagTracer) unpin(p peer.ID, topic string) {
+	if t == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	topics, ok := t.pinned[p]
+	if !ok {
+		return
+	}
+	if _, ok := topics[topic]; !ok {
+		return
+	}
+	delete(topics, topic)
+	if len(topics) == 0 {
+		delete(t.pinned, p)
+	}
+	t.cmgr.Unprotect(p, t.pinnedTag(topic))
+}
+
+// deliveryBump returns the delivery tag bump of a topic
+func (t *tagTracer) deliveryBump(topic string) int {
+	if b := t.weights[topic].MessageDeliveryBump; b > 0 {
+		return b
+	}
+	return t.params.MessageDeliveryBump
+}
+
+// deliveryCap returns the delivery tag cap of a topic
+func (t *tagTracer) deliveryCap(topic string) int {
+	if c := t.weights[topic].MessageDeliveryCap; c > 0 {
+		return c
+	}
+	return t.params.MessageDeliveryCap
 }
 
 func (t *tagTracer) addDeliveryTag(topic string) {
-	if t.decayer == nil {
+	if t.decayer == nil || t.params.DisableDeliveryTags {
 		return
 	}
 
-	name := fmt.Sprintf("pubsub-deliveries:%s", topic)
+	name := t.deliveryTag(topic)
 	t.Lock()
 	defer t.Unlock()
 	tag, err := t.decayer.RegisterDecayingTag(
 		name,
-		GossipSubConnTagDecayInterval,
-		connmgr.DecayFixed(GossipSubConnTagDecayAmount),
-		connmgr.BumpSumBounded(0, GossipSubConnTagMessageDeliveryCap))
+		t.params.DecayInterval,
+		connmgr.DecayFixed(t.params.DecayAmount),
+		connmgr.BumpSumBounded(0, t.deliveryCap(topic)))
 
 	if err != nil {
 		log.Warnf("unable to create decaying delivery tag: %s", err)
@@ -147,10 +402,14 @@ func (t *tagTracer) bumpDeliveryTag(p peer.ID, topic string) error {
 	if !ok {
 		return fmt.Errorf("no decaying tag registered for topic %s", topic)
 	}
-	return tag.Bump(p, GossipSubConnTagBumpMessageDelivery)
+	return tag.Bump(p, t.deliveryBump(topic))
 }
 
 func (t *tagTracer) bumpTagsForMessage(p peer.ID, msg *Message) {
+	if t.params.DisableDeliveryTags {
+		return
+	}
+
 	topic := msg.GetTopic()
 	err := t.bumpDeliveryTag(p, topic)
 	if err != nil {
@@ -211,6 +470,10 @@ func (t *tagTracer) Prune(p peer.ID, topic string) {
 }
 
 func (t *tagTracer) ValidateMessage(msg *Message) {
+	if t.params.DisableDeliveryTags {
+		return
+	}
+
 	t.Lock()
 	defer t.Unlock()
 
@@ -251,7 +514,11 @@ func (t *tagTracer) RejectMessage(msg *Message, reason string) {
 	}
 }
 
-func (t *tagTracer) RemovePeer(peer.ID)                {}
+func (t *tagTracer) RemovePeer(p peer.ID) {
+	t.untagPeerIfDirect(p)
+	t.untagPeer(p)
+}
+
 func (t *tagTracer) ThrottlePeer(p peer.ID)            {}
 func (t *tagTracer) RecvRPC(rpc *RPC)                  {}
 func (t *tagTracer) SendRPC(rpc *RPC, p peer.ID)       {}
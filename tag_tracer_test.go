@@ -71,6 +71,94 @@ func TestTagTracerDirectPeerTags(t *testing.T) {
 	}
 }
 
+func TestTagTracerTopicWeights(t *testing.T) {
+	clk := clock.NewMock()
+	decayCfg := &connmgr.DecayerCfg{
+		Clock:      clk,
+		Resolution: time.Minute,
+	}
+	cmgr, err := connmgr.NewConnManager(5, 10, connmgr.WithGracePeriod(time.Minute), connmgr.DecayerConfig(decayCfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := newTagTracer(cmgr)
+	tt.params.MessageDeliveryBump = 2
+	tt.weights["weighted"] = ConnTagWeights{MeshPeer: 50, MessageDeliveryCap: 5}
+
+	p := peer.ID("a-peer")
+	for _, topic := range []string{"weighted", "default"} {
+		tt.Join(topic)
+		tt.Graft(p, topic)
+	}
+
+	// the mesh peers of the weighted topic are tagged instead of protected
+	if cmgr.IsProtected(p, "pubsub:weighted") || getTagValue(cmgr, p, "pubsub:weighted") != 50 {
+		t.Fatal("expected the mesh peer of the weighted topic to be tagged")
+	}
+	if !cmgr.IsProtected(p, "pubsub:default") {
+		t.Fatal("expected the mesh peer of the default topic to be protected")
+	}
+
+	for i := 0; i < 10; i++ {
+		for _, topic := range []string{"weighted", "default"} {
+			topic := topic
+			tt.DeliverMessage(&Message{
+				ReceivedFrom: p,
+				Message: &pb.Message{
+					From:  []byte(p),
+					Data:  []byte("hello"),
+					Topic: &topic,
+					Seqno: []byte(fmt.Sprintf("%d", i)),
+				},
+			})
+		}
+	}
+	clk.Add(time.Minute)
+	time.Sleep(100 * time.Millisecond)
+
+	// the delivery tags are bumped by the instance bump, up to the topic cap
+	if val := getTagValue(cmgr, p, "pubsub-deliveries:weighted"); val != 5 {
+		t.Fatalf("expected the delivery tag of the weighted topic to be capped at 5, got %d", val)
+	}
+	if val := getTagValue(cmgr, p, "pubsub-deliveries:default"); val != 15 {
+		t.Fatalf("expected the delivery tag of the default topic to be capped at 15, got %d", val)
+	}
+
+	tt.Prune(p, "weighted")
+	if getTagValue(cmgr, p, "pubsub:weighted") != 0 {
+		t.Fatal("expected the former mesh peer to be untagged")
+	}
+}
+
+func TestTagTracerPinnedPeers(t *testing.T) {
+	cmgr, err := connmgr.NewConnManager(5, 10, connmgr.WithGracePeriod(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := newTagTracer(cmgr)
+	tt.weights["topic"] = ConnTagWeights{MeshPeer: 50}
+
+	p := peer.ID("a-peer")
+	tt.Join("topic")
+	tt.Graft(p, "topic")
+	tt.pin(p, "topic")
+	tt.pin(p, "other")
+
+	// pinned peers are protected even if the mesh peers are only tagged
+	if !cmgr.IsProtected(p, "pubsub-pinned:topic") || !cmgr.IsProtected(p, "pubsub-pinned:other") {
+		t.Fatal("expected the pinned peer to be protected")
+	}
+
+	tt.unpin(p, "topic")
+	if cmgr.IsProtected(p, "pubsub-pinned:topic") || !cmgr.IsProtected(p, "pubsub-pinned:other") {
+		t.Fatal("expected the peer to be unprotected only for the unpinned topic")
+	}
+	tt.unpin(p, "other")
+	if cmgr.IsProtected(p, "") || len(tt.pinned) != 0 {
+		t.Fatal("expected the unpinned peer to be unprotected")
+	}
+}
+
 func TestTagTracerDeliveryTags(t *testing.T) {
 	t.Skip("flaky test temporarily disabled; TODO: fixme")
 	// test decaying delivery tags
@@ -258,3 +346,100 @@ func tagExists(mgr connmgri.ConnManager, p peer.ID, tag string) bool {
 	_, exists := info.Tags[tag]
 	return exists
 }
+
+func TestTagTracerCustomTags(t *testing.T) {
+	cmgr, err := connmgr.NewConnManager(5, 10, connmgr.WithGracePeriod(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := newTagTracer(cmgr)
+	tt.params.Prefix = "app"
+	tt.params.DisableDeliveryTags = true
+	tt.direct = map[peer.ID]struct{}{"direct": {}}
+
+	p := peer.ID("a-peer")
+	tt.Join("topic")
+	tt.AddPeer("direct", GossipSubID_v11)
+	tt.Graft(p, "topic")
+	tt.pin(p, "topic")
+
+	if !cmgr.IsProtected(p, "app:topic") || !cmgr.IsProtected(p, "app-pinned:topic") || !cmgr.IsProtected("direct", "app:<direct>") {
+		t.Fatal("expected the tags to be named with the prefix")
+	}
+	if cmgr.IsProtected(p, "pubsub:topic") {
+		t.Fatal("expected no tags with the default prefix")
+	}
+	if len(tt.decaying) != 0 {
+		t.Fatal("expected no delivery tag")
+	}
+
+	// the delivery tags without the mesh tags
+	cmgr, err = connmgr.NewConnManager(5, 10, connmgr.WithGracePeriod(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt = newTagTracer(cmgr)
+	tt.params.DisableMeshTags = true
+	tt.Join("topic")
+	tt.Graft(p, "topic")
+	if cmgr.IsProtected(p, "") || len(tt.mesh) != 0 {
+		t.Fatal("expected the mesh peer not to be protected")
+	}
+	if _, ok := tt.decaying["topic"]; !ok {
+		t.Fatal("expected the delivery tag of the topic")
+	}
+}
+
+func TestTagTracerChurn(t *testing.T) {
+	cmgr, err := connmgr.NewConnManager(5, 10, connmgr.WithGracePeriod(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := newTagTracer(cmgr)
+	tt.weights["weighted"] = ConnTagWeights{MeshPeer: 20}
+	tt.direct = map[peer.ID]struct{}{"direct": {}}
+
+	var peers []peer.ID
+	for i := 0; i < 10; i++ {
+		peers = append(peers, peer.ID(fmt.Sprintf("peer-%d", i)))
+	}
+	peers = append(peers, "direct")
+
+	for round := 0; round < 3; round++ {
+		tt.Join("protected")
+		tt.Join("weighted")
+		for _, p := range peers {
+			tt.AddPeer(p, GossipSubID_v11)
+			tt.Graft(p, "protected")
+			tt.Graft(p, "weighted")
+		}
+		if !cmgr.IsProtected(peers[0], "pubsub:protected") || getTagValue(cmgr, peers[0], "pubsub:weighted") != 20 {
+			t.Fatal("expected the mesh peers to be tagged")
+		}
+
+		// half of the peers disconnect, and we leave a topic with the others in its mesh
+		for _, p := range peers[:len(peers)/2] {
+			tt.RemovePeer(p)
+		}
+		tt.Leave("weighted")
+		for _, p := range peers[len(peers)/2:] {
+			tt.Prune(p, "weighted")
+		}
+		for _, p := range peers[len(peers)/2:] {
+			tt.RemovePeer(p)
+		}
+		tt.Leave("protected")
+
+		for _, p := range peers {
+			if cmgr.IsProtected(p, "") {
+				t.Fatalf("expected %s to be unprotected after the churn", p)
+			}
+			if info := cmgr.GetTagInfo(p); info != nil && len(info.Tags) != 0 {
+				t.Fatalf("expected no tags left for %s after the churn, got %v", p, info.Tags)
+			}
+		}
+		if len(tt.mesh) != 0 || len(tt.decaying) != 0 {
+			t.Fatal("expected no tag state left after the churn")
+		}
+	}
+}
@@ -0,0 +1,368 @@
+// Package testsupport runs networks of in-memory hosts with pubsub for tests and simulations. It
+// connects them in configurable topologies, publishes workloads and awaits their propagation
+// with deadlines, following the state of the nodes with tracers instead of sleeping.
+package testsupport
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+// RouterFn constructs the pubsub instance of a node, such as pubsub.NewGossipSub.
+type RouterFn func(ctx context.Context, h host.Host, opts ...pubsub.Option) (*pubsub.PubSub, error)
+
+// Option is an option for New.
+type Option func(*config)
+
+type config struct {
+	router RouterFn
+	opts   []pubsub.Option
+	seed   int64
+}
+
+// WithRouter sets the constructor of the pubsub instances; gossipsub by default.
+func WithRouter(router RouterFn) Option {
+	return func(cfg *config) {
+		cfg.router = router
+	}
+}
+
+// WithOptions adds options to the pubsub instances of all the nodes.
+func WithOptions(opts ...pubsub.Option) Option {
+	return func(cfg *config) {
+		cfg.opts = append(cfg.opts, opts...)
+	}
+}
+
+// WithSeed sets the seed of the randomized topologies and workloads, for reproducible runs; 1
+// by default.
+func WithSeed(seed int64) Option {
+	return func(cfg *config) {
+		cfg.seed = seed
+	}
+}
+
+// Network is a set of in-memory hosts running pubsub.
+type Network struct {
+	// Hosts are the hosts of the nodes, by index.
+	Hosts []host.Host
+	// PubSubs are the pubsub instances of the nodes, by index.
+	PubSubs []*pubsub.PubSub
+
+	mn     mocknet.Mocknet
+	rng    *rand.Rand
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// state is the state of the nodes, updated by their tracers and subscriptions
+	state *state
+
+	mx     sync.Mutex
+	topics []map[string]*pubsub.Topic
+}
+
+// New starts a network of n nodes, which are not connected to each other. The nodes run until
+// the network is closed.
+func New(ctx context.Context, n int, opts ...Option) (*Network, error) {
+	cfg := config{router: pubsub.NewGossipSub, seed: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	net := &Network{
+		mn:     mocknet.New(),
+		rng:    rand.New(rand.NewSource(cfg.seed)),
+		ctx:    ctx,
+		cancel: cancel,
+		state:  newState(n),
+		topics: make([]map[string]*pubsub.Topic, n),
+	}
+
+	for i := 0; i < n; i++ {
+		h, err := net.mn.GenPeer()
+		if err != nil {
+			net.Close()
+			return nil, fmt.Errorf("creating host %d: %w", i, err)
+		}
+
+		opts := append([]pubsub.Option{pubsub.WithRawTracer(&tracer{state: net.state, node: i})}, cfg.opts...)
+		ps, err := cfg.router(ctx, h, opts...)
+		if err != nil {
+			net.Close()
+			return nil, fmt.Errorf("creating pubsub %d: %w", i, err)
+		}
+
+		net.Hosts = append(net.Hosts, h)
+		net.PubSubs = append(net.PubSubs, ps)
+		net.topics[i] = make(map[string]*pubsub.Topic)
+		net.state.ids[h.ID()] = i
+	}
+
+	return net, nil
+}
+
+// Close stops the nodes and their hosts.
+func (net *Network) Close() error {
+	net.cancel()
+	return net.mn.Close()
+}
+
+// Connect connects the nodes along the edges of a topology, and waits until pubsub is up between
+// all of them or ctx is done.
+func (net *Network) Connect(ctx context.Context, topo Topology) error {
+	edges := topo(len(net.Hosts), net.rng)
+	for _, e := range edges {
+		a, b := net.Hosts[e[0]].ID(), net.Hosts[e[1]].ID()
+		if _, err := net.mn.LinkPeers(a, b); err != nil {
+			return fmt.Errorf("linking %d and %d: %w", e[0], e[1], err)
+		}
+		if _, err := net.mn.ConnectPeers(a, b); err != nil {
+			return fmt.Errorf("connecting %d and %d: %w", e[0], e[1], err)
+		}
+	}
+
+	return net.state.await(ctx, func() error {
+		for _, e := range edges {
+			if !net.state.hasPeer(e[0], e[1]) || !net.state.hasPeer(e[1], e[0]) {
+				return fmt.Errorf("pubsub is not up between %d and %d", e[0], e[1])
+			}
+		}
+		return nil
+	})
+}
+
+// Subscribe subscribes nodes to a topic, all of them if none is given. The messages are consumed
+// by the network, to be awaited with AwaitPropagation.
+func (net *Network) Subscribe(topic string, nodes ...int) error {
+	for _, i := range net.nodes(nodes) {
+		t, err := net.topic(i, topic)
+		if err != nil {
+			return err
+		}
+		sub, err := t.Subscribe()
+		if err != nil {
+			return fmt.Errorf("subscribing node %d: %w", i, err)
+		}
+
+		// the deliveries are followed by the tracer, as the subscription may drop messages when
+		// the node falls behind
+		net.state.subscribed(i, topic)
+		go func() {
+			for {
+				if _, err := sub.Next(net.ctx); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// Publish publishes a message in a topic from a node. The payloads must be unique across the
+// network for AwaitPropagation to tell the messages apart.
+func (net *Network) Publish(ctx context.Context, node int, topic string, data []byte) error {
+	t, err := net.topic(node, topic)
+	if err != nil {
+		return err
+	}
+	if err := t.Publish(ctx, data); err != nil {
+		return err
+	}
+	// the tracer doesn't see the local deliveries
+	net.state.received(node, topic, data)
+	return nil
+}
+
+// Workload is a set of messages published in a topic.
+type Workload struct {
+	// Topic is the topic the messages are published in.
+	Topic string
+	// Messages is the number of messages.
+	Messages int
+	// Size is the size of the payloads, which are made unique; at least 16 bytes.
+	Size int
+	// Publishers are the nodes publishing the messages in turn; random nodes if empty.
+	Publishers []int
+	// Interval is the delay between messages; none if zero.
+	Interval time.Duration
+}
+
+// PublishWorkload publishes the messages of a workload, returning their payloads.
+func (net *Network) PublishWorkload(ctx context.Context, w Workload) ([][]byte, error) {
+	size := max(w.Size, 16)
+	payloads := make([][]byte, 0, w.Messages)
+	for i := 0; i < w.Messages; i++ {
+		var node int
+		if len(w.Publishers) > 0 {
+			node = w.Publishers[i%len(w.Publishers)]
+		} else {
+			node = net.rng.Intn(len(net.PubSubs))
+		}
+
+		data := make([]byte, size)
+		copy(data, fmt.Sprintf("%d/%d/", node, net.state.nextPayload()))
+		if err := net.Publish(ctx, node, w.Topic, data); err != nil {
+			return payloads, fmt.Errorf("publishing from node %d: %w", node, err)
+		}
+		payloads = append(payloads, data)
+
+		if w.Interval > 0 && i < w.Messages-1 {
+			select {
+			case <-time.After(w.Interval):
+			case <-ctx.Done():
+				return payloads, ctx.Err()
+			}
+		}
+	}
+	return payloads, nil
+}
+
+// AwaitPropagation waits until all the nodes subscribed to a topic received the messages with the
+// given payloads, or ctx is done.
+func (net *Network) AwaitPropagation(ctx context.Context, topic string, payloads ...[]byte) error {
+	return net.state.await(ctx, func() error {
+		for _, i := range net.state.subscribers(topic) {
+			for _, data := range payloads {
+				if !net.state.hasReceived(i, topic, data) {
+					return fmt.Errorf("node %d did not receive %q", i, data)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// AwaitMesh waits until all the nodes subscribed to a topic have at least d gossipsub mesh peers
+// in it, or ctx is done.
+func (net *Network) AwaitMesh(ctx context.Context, topic string, d int) error {
+	return net.state.await(ctx, func() error {
+		for _, i := range net.state.subscribers(topic) {
+			if n := net.state.meshSize(i, topic); n < d {
+				return fmt.Errorf("node %d has %d mesh peers", i, n)
+			}
+		}
+		return nil
+	})
+}
+
+// AwaitSubscriptions waits until the peers of the nodes subscribed to a topic know of their
+// subscriptions, so that messages published by the peers reach them, or ctx is done. As the
+// subscriptions of the peers are not traced, they are polled.
+func (net *Network) AwaitSubscriptions(ctx context.Context, topic string) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		err := net.checkSubscriptions(topic)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		}
+	}
+}
+
+// checkSubscriptions checks that the peers of the subscribers of a topic know of them
+func (net *Network) checkSubscriptions(topic string) error {
+	subscribers, peers := net.state.peersOfSubscribers(topic)
+	for k, i := range subscribers {
+		for _, j := range peers[k] {
+			if !slices.Contains(net.PubSubs[j].ListPeers(topic), net.Hosts[i].ID()) {
+				return fmt.Errorf("node %d does not know node %d is subscribed", j, i)
+			}
+		}
+	}
+	return nil
+}
+
+// AwaitQuiescence waits until the nodes went quiet for the given duration, with no peer, mesh,
+// membership or message traced, or ctx is done. The gossip exchanged at heartbeats does not
+// count as activity.
+func (net *Network) AwaitQuiescence(ctx context.Context, quiet time.Duration) error {
+	for {
+		idle := time.Since(net.state.lastActivity())
+		if idle >= quiet {
+			return nil
+		}
+
+		select {
+		case <-time.After(quiet - idle):
+		case <-ctx.Done():
+			return fmt.Errorf("not quiet for %s: %w", quiet, ctx.Err())
+		}
+	}
+}
+
+// nodes returns the given nodes, all of them if none
+func (net *Network) nodes(nodes []int) []int {
+	if len(nodes) > 0 {
+		return nodes
+	}
+	all := make([]int, len(net.PubSubs))
+	for i := range all {
+		all[i] = i
+	}
+	return all
+}
+
+// topic returns the handle of a topic joined by a node, joining it if needed
+func (net *Network) topic(node int, topic string) (*pubsub.Topic, error) {
+	if node < 0 || node >= len(net.PubSubs) {
+		return nil, fmt.Errorf("no node %d", node)
+	}
+
+	net.mx.Lock()
+	defer net.mx.Unlock()
+
+	if t, ok := net.topics[node][topic]; ok {
+		return t, nil
+	}
+	t, err := net.PubSubs[node].Join(topic)
+	if err != nil {
+		return nil, fmt.Errorf("joining node %d: %w", node, err)
+	}
+	net.topics[node][topic] = t
+	return t, nil
+}
+
+// tracer follows the peers, the mesh, the deliveries and the activity of a node
+type tracer struct {
+	state *state
+	node  int
+}
+
+var _ pubsub.RawTracer = (*tracer)(nil)
+
+func (t *tracer) AddPeer(p peer.ID, proto protocol.ID) { t.state.addPeer(t.node, p) }
+func (t *tracer) RemovePeer(p peer.ID)                 { t.state.removePeer(t.node, p) }
+func (t *tracer) Join(topic string)                    { t.state.touch() }
+func (t *tracer) Leave(topic string)                   { t.state.leave(t.node, topic) }
+func (t *tracer) Graft(p peer.ID, topic string)        { t.state.graft(t.node, topic, p) }
+func (t *tracer) Prune(p peer.ID, topic string)        { t.state.prune(t.node, topic, p) }
+func (t *tracer) ValidateMessage(msg *pubsub.Message)  {}
+func (t *tracer) DeliverMessage(msg *pubsub.Message) {
+	t.state.received(t.node, msg.GetTopic(), msg.GetData())
+}
+func (t *tracer) RejectMessage(msg *pubsub.Message, reason string) { t.state.touch() }
+func (t *tracer) DuplicateMessage(msg *pubsub.Message)             { t.state.touch() }
+func (t *tracer) ThrottlePeer(p peer.ID)                           {}
+func (t *tracer) RecvRPC(rpc *pubsub.RPC)                          {}
+func (t *tracer) SendRPC(rpc *pubsub.RPC, p peer.ID)               {}
+func (t *tracer) DropRPC(rpc *pubsub.RPC, p peer.ID)               {}
+func (t *tracer) UndeliverableMessage(msg *pubsub.Message)         {}
@@ -0,0 +1,85 @@
+package testsupport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+func newNetwork(t *testing.T, n int, opts ...Option) *Network {
+	t.Helper()
+	net, err := New(context.Background(), n, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { net.Close() })
+	return net
+}
+
+func TestGossipSubPropagation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	net := newNetwork(t, 20)
+	if err := net.Connect(ctx, Union(Ring(), Random(3))); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.Subscribe("test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.AwaitMesh(ctx, "test", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	payloads, err := net.PublishWorkload(ctx, Workload{Topic: "test", Messages: 50, Size: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := net.AwaitPropagation(ctx, "test", payloads...); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.AwaitQuiescence(ctx, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFloodSubStar(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	net := newNetwork(t, 10, WithRouter(pubsub.NewFloodSub))
+	if err := net.Connect(ctx, Star(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the leaves only publish, and the center relays what it receives
+	if err := net.Subscribe("test", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.AwaitSubscriptions(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	payloads, err := net.PublishWorkload(ctx, Workload{Topic: "test", Messages: 9, Publishers: []int{1, 2, 3, 4, 5, 6, 7, 8, 9}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := net.AwaitPropagation(ctx, "test", payloads...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAwaitDeadline(t *testing.T) {
+	net := newNetwork(t, 2)
+	if err := net.Subscribe("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the nodes are not connected, so the mesh never forms
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := net.AwaitMesh(ctx, "test", 1); err == nil {
+		t.Fatal("expected the wait for the mesh to time out")
+	}
+}
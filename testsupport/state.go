@@ -0,0 +1,195 @@
+package testsupport
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// state is the state of the nodes of a network, as traced and received, which conditions are
+// awaited on
+type state struct {
+	mx sync.Mutex
+	// changed is closed and replaced as the state changes, to wake up the waiters
+	changed chan struct{}
+
+	ids      map[peer.ID]int
+	peers    []map[int]struct{}
+	mesh     []map[string]map[int]struct{}
+	subs     map[string][]int
+	inbox    []map[string]map[string]struct{}
+	payloads int
+	active   time.Time
+}
+
+func newState(n int) *state {
+	s := &state{
+		changed: make(chan struct{}),
+		ids:     make(map[peer.ID]int, n),
+		peers:   make([]map[int]struct{}, n),
+		mesh:    make([]map[string]map[int]struct{}, n),
+		subs:    make(map[string][]int),
+		inbox:   make([]map[string]map[string]struct{}, n),
+		active:  time.Now(),
+	}
+	for i := 0; i < n; i++ {
+		s.peers[i] = make(map[int]struct{})
+		s.mesh[i] = make(map[string]map[int]struct{})
+		s.inbox[i] = make(map[string]map[string]struct{})
+	}
+	return s
+}
+
+// await waits until cond returns nil or ctx is done, checking it as the state changes. cond is
+// called with the lock held.
+func (s *state) await(ctx context.Context, cond func() error) error {
+	for {
+		s.mx.Lock()
+		err := cond()
+		changed := s.changed
+		s.mx.Unlock()
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		}
+	}
+}
+
+// update applies a change to the state, waking up the waiters
+func (s *state) update(change func()) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	change()
+	s.active = time.Now()
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *state) touch() {
+	s.update(func() {})
+}
+
+func (s *state) addPeer(node int, p peer.ID) {
+	s.update(func() {
+		if i, ok := s.ids[p]; ok {
+			s.peers[node][i] = struct{}{}
+		}
+	})
+}
+
+func (s *state) removePeer(node int, p peer.ID) {
+	s.update(func() {
+		i, ok := s.ids[p]
+		if !ok {
+			return
+		}
+		delete(s.peers[node], i)
+		for _, mesh := range s.mesh[node] {
+			delete(mesh, i)
+		}
+	})
+}
+
+func (s *state) graft(node int, topic string, p peer.ID) {
+	s.update(func() {
+		i, ok := s.ids[p]
+		if !ok {
+			return
+		}
+		mesh, ok := s.mesh[node][topic]
+		if !ok {
+			mesh = make(map[int]struct{})
+			s.mesh[node][topic] = mesh
+		}
+		mesh[i] = struct{}{}
+	})
+}
+
+func (s *state) prune(node int, topic string, p peer.ID) {
+	s.update(func() {
+		if i, ok := s.ids[p]; ok {
+			delete(s.mesh[node][topic], i)
+		}
+	})
+}
+
+func (s *state) leave(node int, topic string) {
+	s.update(func() {
+		delete(s.mesh[node], topic)
+	})
+}
+
+func (s *state) subscribed(node int, topic string) {
+	s.update(func() {
+		s.subs[topic] = append(s.subs[topic], node)
+	})
+}
+
+func (s *state) received(node int, topic string, data []byte) {
+	s.update(func() {
+		msgs, ok := s.inbox[node][topic]
+		if !ok {
+			msgs = make(map[string]struct{})
+			s.inbox[node][topic] = msgs
+		}
+		msgs[string(data)] = struct{}{}
+	})
+}
+
+func (s *state) nextPayload() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.payloads++
+	return s.payloads
+}
+
+func (s *state) lastActivity() time.Time {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.active
+}
+
+// peersOfSubscribers returns the subscribers of a topic and their peers
+func (s *state) peersOfSubscribers(topic string) ([]int, [][]int) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	subscribers := slices.Clone(s.subs[topic])
+	peers := make([][]int, len(subscribers))
+	for k, i := range subscribers {
+		for j := range s.peers[i] {
+			peers[k] = append(peers[k], j)
+		}
+	}
+	return subscribers, peers
+}
+
+// the accessors below are called by the conditions, with the lock held
+
+func (s *state) hasPeer(node, other int) bool {
+	_, ok := s.peers[node][other]
+	return ok
+}
+
+func (s *state) meshSize(node int, topic string) int {
+	return len(s.mesh[node][topic])
+}
+
+func (s *state) subscribers(topic string) []int {
+	return s.subs[topic]
+}
+
+func (s *state) hasReceived(node int, topic string, data []byte) bool {
+	_, ok := s.inbox[node][topic][string(data)]
+	return ok
+}
@@ -0,0 +1,103 @@
+package testsupport
+
+import (
+	"math/rand"
+)
+
+// Edge is a connection between two nodes of a Network, by index.
+type Edge [2]int
+
+// Topology returns the edges connecting n nodes, drawing from rng if it is randomized.
+type Topology func(n int, rng *rand.Rand) []Edge
+
+// Ring connects each node to the next one, and the last one to the first.
+func Ring() Topology {
+	return func(n int, rng *rand.Rand) []Edge {
+		if n < 2 {
+			return nil
+		}
+		if n == 2 {
+			return []Edge{{0, 1}}
+		}
+
+		edges := make([]Edge, 0, n)
+		for i := 0; i < n; i++ {
+			edges = append(edges, Edge{i, (i + 1) % n})
+		}
+		return edges
+	}
+}
+
+// Star connects every node to the node at index center.
+func Star(center int) Topology {
+	return func(n int, rng *rand.Rand) []Edge {
+		edges := make([]Edge, 0, n)
+		for i := 0; i < n; i++ {
+			if i != center {
+				edges = append(edges, Edge{center, i})
+			}
+		}
+		return edges
+	}
+}
+
+// Full connects every node to every other node.
+func Full() Topology {
+	return func(n int, rng *rand.Rand) []Edge {
+		edges := make([]Edge, 0, n*(n-1)/2)
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				edges = append(edges, Edge{i, j})
+			}
+		}
+		return edges
+	}
+}
+
+// Random connects every node to d distinct random nodes, so that nodes end up with d peers or
+// more as the other nodes pick them too. The graph is not guaranteed to be connected for small
+// degrees; combine it with Ring using Union for that.
+func Random(d int) Topology {
+	return func(n int, rng *rand.Rand) []Edge {
+		var edges []Edge
+		for i := 0; i < n; i++ {
+			picked := 0
+			for _, j := range rng.Perm(n) {
+				if picked == d {
+					break
+				}
+				if j != i {
+					edges = append(edges, Edge{i, j})
+					picked++
+				}
+			}
+		}
+		return dedup(edges)
+	}
+}
+
+// Union combines topologies, connecting the nodes once along the edges of any of them.
+func Union(topologies ...Topology) Topology {
+	return func(n int, rng *rand.Rand) []Edge {
+		var edges []Edge
+		for _, topo := range topologies {
+			edges = append(edges, topo(n, rng)...)
+		}
+		return dedup(edges)
+	}
+}
+
+// dedup drops the repeated edges, in either direction
+func dedup(edges []Edge) []Edge {
+	seen := make(map[Edge]struct{}, len(edges))
+	res := edges[:0]
+	for _, e := range edges {
+		key := Edge{min(e[0], e[1]), max(e[0], e[1])}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		res = append(res, e)
+	}
+	return res
+}
@@ -0,0 +1,58 @@
+package testsupport
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func degrees(n int, edges []Edge) []int {
+	deg := make([]int, n)
+	for _, e := range edges {
+		deg[e[0]]++
+		deg[e[1]]++
+	}
+	return deg
+}
+
+func TestTopologies(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for i, d := range degrees(10, Ring()(10, rng)) {
+		if d != 2 {
+			t.Fatalf("expected node %d of the ring to have 2 peers, got %d", i, d)
+		}
+	}
+
+	for i, d := range degrees(10, Star(3)(10, rng)) {
+		if (i == 3 && d != 9) || (i != 3 && d != 1) {
+			t.Fatalf("unexpected degree %d of node %d of the star", d, i)
+		}
+	}
+
+	if edges := Full()(10, rng); len(edges) != 45 {
+		t.Fatalf("expected 45 edges in the full topology, got %d", len(edges))
+	}
+
+	for i, d := range degrees(20, Random(4)(20, rng)) {
+		if d < 4 {
+			t.Fatalf("expected node %d to have at least 4 peers, got %d", i, d)
+		}
+	}
+
+	// the edges of both topologies are merged
+	if edges := Union(Ring(), Full())(10, rng); len(edges) != 45 {
+		t.Fatalf("expected 45 edges in the union, got %d", len(edges))
+	}
+
+	// and the randomized topologies are reproducible
+	a := Random(3)(20, rand.New(rand.NewSource(42)))
+	b := Random(3)(20, rand.New(rand.NewSource(42)))
+	if len(a) != len(b) {
+		t.Fatal("expected the same edges from the same seed")
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatal("expected the same edges from the same seed")
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package pubsub
+
+import (
+	"sync"
+)
+
+// throughputBuckets is the number of per-second buckets of the throughput counters, covering
+// the longest window
+const throughputBuckets = 15 * 60
+
+// Throughput are the rates of the unique messages, counted once at their first delivery like
+// the first message deliveries of the peer scores, so that the duplicates are left out.
+type Throughput struct {
+	// OneMinute is the rate over the last minute.
+	OneMinute Rate `json:"1m"`
+	// FiveMinutes is the rate over the last 5 minutes.
+	FiveMinutes Rate `json:"5m"`
+	// FifteenMinutes is the rate over the last 15 minutes.
+	FifteenMinutes Rate `json:"15m"`
+}
+
+// Rate is a rate of messages averaged over a window, or over the time since the counting
+// started if shorter.
+type Rate struct {
+	// Messages is the number of messages per second.
+	Messages float64 `json:"messagesPerSecond"`
+	// Bytes is the size of the messages on the wire per second.
+	Bytes float64 `json:"bytesPerSecond"`
+}
+
+// Throughput returns the rates of the unique messages of all the topics.
+func (p *PubSub) Throughput() Throughput {
+	return p.throughput.global.rates(p.clock.Now().Unix())
+}
+
+// Throughput returns the rates of the unique messages of the topic; it is zero if we neither
+// subscribe to nor relay the topic.
+func (t *Topic) Throughput() Throughput {
+	c := t.p.throughput.topic(t.topic, false)
+	if c == nil {
+		return Throughput{}
+	}
+	return c.rates(t.p.clock.Now().Unix())
+}
+
+// throughputStats are the throughput counters of all the topics and of each topic
+type throughputStats struct {
+	global *throughputCounter
+
+	mx     sync.RWMutex
+	topics map[string]*throughputCounter
+}
+
+func newThroughputStats() *throughputStats {
+	return &throughputStats{
+		global: new(throughputCounter),
+		topics: make(map[string]*throughputCounter),
+	}
+}
+
+// topic returns the counter of a topic, adding it if needed and asked to
+func (s *throughputStats) topic(topic string, add bool) *throughputCounter {
+	s.mx.RLock()
+	c, ok := s.topics[topic]
+	s.mx.RUnlock()
+	if ok || !add {
+		return c
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	c, ok = s.topics[topic]
+	if !ok {
+		c = new(throughputCounter)
+		s.topics[topic] = c
+	}
+	return c
+}
+
+// removeTopic drops the counter of a topic we left
+func (s *throughputStats) removeTopic(topic string) {
+	s.mx.Lock()
+	delete(s.topics, topic)
+	s.mx.Unlock()
+}
+
+// delivered counts a message at its first delivery, at the given second
+func (s *throughputStats) delivered(msg *Message, now int64) {
+	size := msg.wireMessage().Size()
+	s.global.add(now, size)
+	s.topic(msg.GetTopic(), true).add(now, size)
+}
+
+// throughputBucket counts the messages of a second
+type throughputBucket struct {
+	second          int64
+	messages, bytes uint64
+}
+
+// throughputCounter counts messages in a ring of per-second buckets
+type throughputCounter struct {
+	mx      sync.Mutex
+	started bool
+	start   int64
+	buckets [throughputBuckets]throughputBucket
+}
+
+func (c *throughputCounter) add(now int64, bytes int) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if !c.started {
+		c.started, c.start = true, now
+	}
+	b := &c.buckets[now%throughputBuckets]
+	if b.second != now {
+		*b = throughputBucket{second: now}
+	}
+	b.messages++
+	b.bytes += uint64(bytes)
+}
+
+func (c *throughputCounter) rates(now int64) Throughput {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if !c.started {
+		return Throughput{}
+	}
+	return Throughput{
+		OneMinute:      c.rate(now, 60),
+		FiveMinutes:    c.rate(now, 5*60),
+		FifteenMinutes: c.rate(now, 15*60),
+	}
+}
+
+// rate averages the buckets of a window of seconds ending with the current one
+func (c *throughputCounter) rate(now, window int64) Rate {
+	var messages, bytes uint64
+	for s := max(now-window+1, 0); s <= now; s++ {
+		b := &c.buckets[s%throughputBuckets]
+		if b.second == s {
+			messages += b.messages
+			bytes += b.bytes
+		}
+	}
+
+	if elapsed := now - c.start + 1; elapsed < window {
+		window = elapsed
+	}
+	return Rate{
+		Messages: float64(messages) / float64(window),
+		Bytes:    float64(bytes) / float64(window),
+	}
+}
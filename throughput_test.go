@@ -0,0 +1,108 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestThroughputCounter(t *testing.T) {
+	var c throughputCounter
+	if r := c.rates(100); r != (Throughput{}) {
+		t.Fatalf("expected no throughput before any message, got %+v", r)
+	}
+
+	// 10 messages of 100 bytes per second for 20 minutes
+	start := int64(1000)
+	for now := start; now < start+20*60; now++ {
+		for i := 0; i < 10; i++ {
+			c.add(now, 100)
+		}
+	}
+	now := start + 20*60 - 1
+	for _, r := range []Rate{c.rate(now, 60), c.rate(now, 5*60), c.rate(now, 15*60)} {
+		if r.Messages != 10 || r.Bytes != 1000 {
+			t.Fatalf("expected 10 messages and 1000 bytes per second, got %+v", r)
+		}
+	}
+
+	// the last minute idle halves the 2 minutes rate, and the older buckets are recycled
+	now += 60
+	c.add(now, 100)
+	if r := c.rate(now, 60); r.Messages != 1.0/60 {
+		t.Fatalf("expected 1 message in the last minute, got %+v", r)
+	}
+	if r := c.rate(now, 120); r.Messages != (60*10+1)/120.0 {
+		t.Fatalf("expected a minute of messages in the last 2 minutes, got %+v", r)
+	}
+
+	// the rates are averaged over the time since the counting started if shorter
+	var young throughputCounter
+	young.add(50, 10)
+	young.add(59, 10)
+	if r := young.rate(59, 60); r.Messages != 0.2 || r.Bytes != 2 {
+		t.Fatalf("expected 2 messages over 10s, got %+v", r)
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := newMockClock()
+	clk.Add(time.Hour)
+
+	hosts := getNetHosts(t, ctx, 3)
+	psubs := getPubsubs(ctx, hosts, WithClock(clk), WithAnnounceWindow(0))
+	connectAll(t, hosts)
+
+	var subs []*Subscription
+	var topics []*Topic
+	for _, ps := range psubs {
+		topic, err := ps.Join("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub, err := topic.Subscribe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		topics = append(topics, topic)
+		subs = append(subs, sub)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// each message reaches the last peer twice, directly and forwarded
+	data := []byte("message")
+	for i := 0; i < 5; i++ {
+		if err := topics[0].Publish(ctx, data); err != nil {
+			t.Fatal(err)
+		}
+		for _, sub := range subs {
+			assertReceive(t, sub, data)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	size := float64((&pb.Message{Data: data}).Size())
+	for i, ps := range psubs {
+		tp := topics[i].Throughput()
+		if tp.OneMinute.Messages != 5 || tp.FifteenMinutes.Messages != 5 {
+			t.Fatalf("expected 5 unique messages in the topic at peer %d, got %+v", i, tp)
+		}
+		if tp.OneMinute.Bytes < 5*size {
+			t.Fatalf("expected at least %f bytes at peer %d, got %+v", 5*size, i, tp)
+		}
+		if global := ps.Throughput(); global != tp {
+			t.Fatalf("expected the global throughput of the only topic, got %+v", global)
+		}
+	}
+
+	// the rates decay as the time passes without messages
+	clk.Add(2 * time.Minute)
+	if tp := topics[2].Throughput(); tp.OneMinute.Messages != 0 || tp.FiveMinutes.Messages != 5.0/121 {
+		t.Fatalf("expected the messages out of the last minute, got %+v", tp)
+	}
+}
@@ -0,0 +1,88 @@
+package timecache
+
+import (
+	"sync"
+	"time"
+)
+
+// BoundedCache is a first seen cache that retains at most a fixed number of entries, evicting
+// the oldest entries first when full. It is meant for long retention periods, where the
+// number of entries rather than their expiry bounds the memory use.
+type BoundedCache struct {
+	lk   sync.Mutex
+	m    map[string]time.Time
+	q    []boundedEntry
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+}
+
+type boundedEntry struct {
+	id     string
+	expiry time.Time
+}
+
+var _ TimeCache = (*BoundedCache)(nil)
+
+// NewBoundedCache creates a first seen cache retaining at most size entries for ttl.
+// Expired entries are evicted lazily, so the cache needs no background sweep.
+func NewBoundedCache(ttl time.Duration, size int, now func() time.Time) *BoundedCache {
+	return &BoundedCache{
+		m:    make(map[string]time.Time),
+		ttl:  ttl,
+		size: size,
+		now:  now,
+	}
+}
+
+func (tc *BoundedCache) Done() {}
+
+func (tc *BoundedCache) Has(s string) bool {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+
+	expiry, ok := tc.m[s]
+	return ok && !expiry.Before(tc.now())
+}
+
+func (tc *BoundedCache) Add(s string) bool {
+	_, ok := tc.AddWithExpiry(s, time.Time{})
+	return ok
+}
+
+// AddWithExpiry adds an id with the given expiry, or with the cache ttl if the expiry is zero.
+// Returns the expiry of the entry and whether it was newly added.
+func (tc *BoundedCache) AddWithExpiry(s string, expiry time.Time) (time.Time, bool) {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+
+	now := tc.now()
+	if cur, ok := tc.m[s]; ok && !cur.Before(now) {
+		return cur, false
+	}
+	if expiry.IsZero() {
+		expiry = now.Add(tc.ttl)
+	} else if expiry.Before(now) {
+		return expiry, false
+	}
+
+	tc.evict(now)
+	tc.m[s] = expiry
+	tc.q = append(tc.q, boundedEntry{id: s, expiry: expiry})
+	return expiry, true
+}
+
+// evict drops expired entries and makes room for a new one; entries are queued in the order
+// they were added, which is also their expiry order unless added with an explicit expiry.
+func (tc *BoundedCache) evict(now time.Time) {
+	for len(tc.q) > 0 && (len(tc.m) >= tc.size || tc.q[0].expiry.Before(now)) {
+		e := tc.q[0]
+		tc.q[0] = boundedEntry{}
+		tc.q = tc.q[1:]
+
+		// the entry may have been re-added after expiring
+		if cur, ok := tc.m[e.id]; ok && cur.Equal(e.expiry) {
+			delete(tc.m, e.id)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package timecache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBoundedCacheEvictsOldest(t *testing.T) {
+	tc := NewBoundedCache(time.Hour, 3, time.Now)
+
+	for i := 0; i < 5; i++ {
+		if !tc.Add(fmt.Sprint(i)) {
+			t.Fatalf("expected key %d to be newly added", i)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if tc.Has(fmt.Sprint(i)) {
+			t.Fatalf("should have evicted key %d", i)
+		}
+	}
+	for i := 2; i < 5; i++ {
+		if !tc.Has(fmt.Sprint(i)) {
+			t.Fatalf("should have key %d", i)
+		}
+	}
+	if tc.Add("4") {
+		t.Fatal("key should not be added twice")
+	}
+}
+
+func TestBoundedCacheExpire(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	tc := NewBoundedCache(time.Minute, 10, clock)
+	tc.Add("expired")
+	if _, ok := tc.AddWithExpiry("loaded", now.Add(time.Hour)); !ok {
+		t.Fatal("expected the loaded key to be added")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if tc.Has("expired") {
+		t.Fatal("should have expired the key")
+	}
+	if !tc.Has("loaded") {
+		t.Fatal("should have retained the key with an explicit expiry")
+	}
+
+	// the expired key can be added again and isn't evicted by its stale queue entry
+	if !tc.Add("expired") {
+		t.Fatal("expected the expired key to be added again")
+	}
+	tc.Add("other")
+	if !tc.Has("expired") {
+		t.Fatal("should have the re-added key")
+	}
+}
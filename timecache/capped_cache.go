@@ -0,0 +1,183 @@
+package timecache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// CappedCache is a time cache with per-entry ttls that retains at most a fixed number of
+// entries, evicting the least recently seen entries first when full. The strategy selects
+// whether seeing an entry again with Add or Has extends its expiry.
+type CappedCache struct {
+	lk       sync.Mutex
+	m        map[string]*list.Element
+	l        *list.List // most recently seen first
+	strategy Strategy
+	ttl      time.Duration
+	max      int
+	now      func() time.Time
+
+	done func()
+}
+
+type cappedEntry struct {
+	id     string
+	ttl    time.Duration
+	expiry time.Time
+}
+
+var _ TimeCache = (*CappedCache)(nil)
+
+// NewCappedCache creates a CappedCache retaining entries for ttl, unless added with another
+// ttl, and at most max entries; a max of 0 doesn't bound the number of entries.
+func NewCappedCache(strategy Strategy, ttl time.Duration, max int, now func() time.Time) *CappedCache {
+	tc := &CappedCache{
+		m:        make(map[string]*list.Element),
+		l:        list.New(),
+		strategy: strategy,
+		ttl:      ttl,
+		max:      max,
+		now:      now,
+	}
+
+	ctx, done := context.WithCancel(context.Background())
+	tc.done = done
+	go tc.background(ctx)
+
+	return tc
+}
+
+func (tc *CappedCache) background(ctx context.Context) {
+	ticker := time.NewTicker(backgroundSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			tc.sweep()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (tc *CappedCache) sweep() {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+
+	now := tc.now()
+	for _, e := range tc.m {
+		if e.Value.(*cappedEntry).expiry.Before(now) {
+			tc.remove(e)
+		}
+	}
+}
+
+func (tc *CappedCache) remove(e *list.Element) {
+	tc.l.Remove(e)
+	delete(tc.m, e.Value.(*cappedEntry).id)
+}
+
+func (tc *CappedCache) Done() {
+	tc.done()
+}
+
+func (tc *CappedCache) Has(s string) bool {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+
+	return tc.seen(s, tc.now())
+}
+
+// seen returns whether an entry is present, touching it according to the strategy
+func (tc *CappedCache) seen(s string, now time.Time) bool {
+	e, ok := tc.m[s]
+	if !ok {
+		return false
+	}
+
+	entry := e.Value.(*cappedEntry)
+	if entry.expiry.Before(now) {
+		tc.remove(e)
+		return false
+	}
+
+	tc.l.MoveToFront(e)
+	if tc.strategy == Strategy_LastSeen {
+		entry.expiry = now.Add(entry.ttl)
+	}
+	return true
+}
+
+func (tc *CappedCache) Add(s string) bool {
+	return tc.AddWithTTL(s, tc.ttl)
+}
+
+// AddWithTTL adds an id into the cache with the given ttl in place of the cache ttl.
+// Returns true if the id was newly added to the cache.
+func (tc *CappedCache) AddWithTTL(s string, ttl time.Duration) bool {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+
+	now := tc.now()
+	if tc.seen(s, now) {
+		return false
+	}
+
+	tc.m[s] = tc.l.PushFront(&cappedEntry{id: s, ttl: ttl, expiry: now.Add(ttl)})
+	for tc.max > 0 && len(tc.m) > tc.max {
+		tc.remove(tc.l.Back())
+	}
+	return true
+}
+
+// Len returns the number of entries in the cache, including the expired entries that haven't
+// been swept yet.
+func (tc *CappedCache) Len() int {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+
+	return len(tc.m)
+}
+
+var _ Snapshotter = (*CappedCache)(nil)
+
+func (tc *CappedCache) Snapshot() map[string]time.Time {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+
+	now := tc.now()
+	res := make(map[string]time.Time, len(tc.m))
+	for s, e := range tc.m {
+		if entry := e.Value.(*cappedEntry); !entry.expiry.Before(now) {
+			res[s] = entry.expiry
+		}
+	}
+	return res
+}
+
+// Restore adds ids with their expiry as the least recently seen entries of the cache, so that
+// they are evicted first when the cache is full. Restored entries keep the cache ttl.
+func (tc *CappedCache) Restore(entries map[string]time.Time) {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+
+	now := tc.now()
+	for s, expiry := range entries {
+		if expiry.Before(now) {
+			continue
+		}
+		if tc.max > 0 && len(tc.m) >= tc.max {
+			return
+		}
+		if e, ok := tc.m[s]; ok && !e.Value.(*cappedEntry).expiry.Before(now) {
+			continue
+		} else if ok {
+			tc.remove(e)
+		}
+		tc.m[s] = tc.l.PushBack(&cappedEntry{id: s, ttl: tc.ttl, expiry: expiry})
+	}
+}
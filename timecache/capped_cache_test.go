@@ -0,0 +1,85 @@
+package timecache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCappedCacheEvictsLeastRecentlySeen(t *testing.T) {
+	tc := NewCappedCache(Strategy_FirstSeen, time.Hour, 3, time.Now)
+	defer tc.Done()
+
+	for i := 0; i < 3; i++ {
+		if !tc.Add(fmt.Sprint(i)) {
+			t.Fatalf("expected key %d to be newly added", i)
+		}
+	}
+
+	// seeing the oldest key again protects it from eviction
+	if !tc.Has("0") {
+		t.Fatal("should have key 0")
+	}
+	tc.Add("3")
+
+	if tc.Has("1") {
+		t.Fatal("should have evicted key 1")
+	}
+	for _, k := range []string{"0", "2", "3"} {
+		if !tc.Has(k) {
+			t.Fatalf("should have key %s", k)
+		}
+	}
+	if tc.Len() != 3 {
+		t.Fatalf("expected 3 entries; got %d", tc.Len())
+	}
+}
+
+func TestCappedCacheTTL(t *testing.T) {
+	now := time.Now()
+	tc := NewCappedCache(Strategy_FirstSeen, time.Minute, 0, func() time.Time { return now })
+	defer tc.Done()
+
+	tc.Add("default")
+	tc.AddWithTTL("short", 10*time.Second)
+	tc.AddWithTTL("long", 10*time.Minute)
+
+	now = now.Add(30 * time.Second)
+	if tc.Has("short") || !tc.Has("default") || !tc.Has("long") {
+		t.Fatal("unexpected expiry after 30s")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if tc.Has("default") || !tc.Has("long") {
+		t.Fatal("unexpected expiry after 2m30s")
+	}
+
+	tc.sweep()
+	if tc.Len() != 1 {
+		t.Fatalf("expected the expired entries to be swept; got %d entries", tc.Len())
+	}
+}
+
+func TestCappedCacheLastSeen(t *testing.T) {
+	now := time.Now()
+	tc := NewCappedCache(Strategy_LastSeen, time.Minute, 0, func() time.Time { return now })
+	defer tc.Done()
+
+	tc.AddWithTTL("id", 10*time.Second)
+	for i := 0; i < 10; i++ {
+		now = now.Add(5 * time.Second)
+		if tc.Add("id") {
+			t.Fatal("key should not be added twice")
+		}
+	}
+
+	// the entry is extended by its own ttl on every sighting
+	now = now.Add(9 * time.Second)
+	if !tc.Has("id") {
+		t.Fatal("should still have the key")
+	}
+	now = now.Add(11 * time.Second)
+	if tc.Has("id") {
+		t.Fatal("should have expired the key")
+	}
+}
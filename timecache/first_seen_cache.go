@@ -11,25 +11,82 @@ type FirstSeenCache struct {
 	lk  sync.RWMutex
 	m   map[string]time.Time
 	ttl time.Duration
+	now func() time.Time
+
+	// onExpire are invoked with the ids of the expired entries when they are swept
+	onExpire []func(s string)
 
 	done func()
 }
 
 var _ TimeCache = (*FirstSeenCache)(nil)
 
-func newFirstSeenCache(ttl time.Duration) *FirstSeenCache {
+func newFirstSeenCache(ttl time.Duration, now func() time.Time) *FirstSeenCache {
 	tc := &FirstSeenCache{
 		m:   make(map[string]time.Time),
 		ttl: ttl,
+		now: now,
 	}
 
 	ctx, done := context.WithCancel(context.Background())
 	tc.done = done
-	go background(ctx, &tc.lk, tc.m)
+	go tc.background(ctx)
 
 	return tc
 }
 
+func (tc *FirstSeenCache) background(ctx context.Context) {
+	ticker := time.NewTicker(backgroundSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			tc.Sweep()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// OnExpire registers a callback, which is invoked with the id of every expired entry when it
+// is swept. Callbacks are invoked without holding the cache lock.
+func (tc *FirstSeenCache) OnExpire(fn func(s string)) {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+
+	tc.onExpire = append(tc.onExpire, fn)
+}
+
+// Sweep removes the expired entries, invoking the expiry callbacks. It is invoked periodically
+// in the background, but can be invoked directly to notice an expiry sooner.
+func (tc *FirstSeenCache) Sweep() {
+	tc.lk.Lock()
+	now := tc.now()
+	var expired []string
+	for s, expiry := range tc.m {
+		if expiry.Before(now) {
+			delete(tc.m, s)
+			expired = append(expired, s)
+		}
+	}
+	onExpire := tc.onExpire
+	tc.lk.Unlock()
+
+	for _, s := range expired {
+		for _, fn := range onExpire {
+			fn(s)
+		}
+	}
+}
+
+// NewFirstSeenCache creates a FirstSeenCache, which supports per-entry expiries in addition to
+// the TimeCache interface.
+func NewFirstSeenCache(ttl time.Duration, now func() time.Time) *FirstSeenCache {
+	return newFirstSeenCache(ttl, now)
+}
+
 func (tc *FirstSeenCache) Done() {
 	tc.done()
 }
@@ -38,19 +95,87 @@ func (tc *FirstSeenCache) Has(s string) bool {
 	tc.lk.RLock()
 	defer tc.lk.RUnlock()
 
-	_, ok := tc.m[s]
-	return ok
+	expiry, ok := tc.m[s]
+	return ok && !expiry.Before(tc.now())
 }
 
 func (tc *FirstSeenCache) Add(s string) bool {
 	tc.lk.Lock()
 	defer tc.lk.Unlock()
 
-	_, ok := tc.m[s]
-	if ok {
+	now := tc.now()
+	expiry, ok := tc.m[s]
+	if ok && !expiry.Before(now) {
 		return false
 	}
 
-	tc.m[s] = time.Now().Add(tc.ttl)
+	tc.m[s] = now.Add(tc.ttl)
 	return true
 }
+
+// AddWithTTL adds an id into the cache with the given ttl in place of the cache ttl.
+// The expiry of an existing entry is extended if it expires earlier.
+// Returns true if the id was newly added to the cache.
+func (tc *FirstSeenCache) AddWithTTL(s string, ttl time.Duration) bool {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+
+	now := tc.now()
+	expiry, ok := tc.m[s]
+	added := !ok || expiry.Before(now)
+	if added || expiry.Before(now.Add(ttl)) {
+		tc.m[s] = now.Add(ttl)
+	}
+	return added
+}
+
+// Remove removes an id from the cache.
+func (tc *FirstSeenCache) Remove(s string) {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+
+	delete(tc.m, s)
+}
+
+// Keys returns the ids in the cache that haven't expired.
+func (tc *FirstSeenCache) Keys() []string {
+	tc.lk.RLock()
+	defer tc.lk.RUnlock()
+
+	now := tc.now()
+	keys := make([]string, 0, len(tc.m))
+	for s, expiry := range tc.m {
+		if !expiry.Before(now) {
+			keys = append(keys, s)
+		}
+	}
+	return keys
+}
+
+var _ Snapshotter = (*FirstSeenCache)(nil)
+
+func (tc *FirstSeenCache) Snapshot() map[string]time.Time {
+	tc.lk.RLock()
+	defer tc.lk.RUnlock()
+
+	return snapshot(tc.m, tc.now())
+}
+
+func (tc *FirstSeenCache) Restore(entries map[string]time.Time) {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+
+	restore(tc.m, entries, tc.now())
+}
+
+// Expiry returns the expiry of an id, and whether it is in the cache.
+func (tc *FirstSeenCache) Expiry(s string) (time.Time, bool) {
+	tc.lk.RLock()
+	defer tc.lk.RUnlock()
+
+	expiry, ok := tc.m[s]
+	if !ok || expiry.Before(tc.now()) {
+		return time.Time{}, false
+	}
+	return expiry, true
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func TestFirstSeenCacheFound(t *testing.T) {
-	tc := newFirstSeenCache(time.Minute)
+	tc := newFirstSeenCache(time.Minute, time.Now)
 
 	tc.Add("test")
 
@@ -19,7 +19,7 @@ func TestFirstSeenCacheFound(t *testing.T) {
 func TestFirstSeenCacheExpire(t *testing.T) {
 	backgroundSweepInterval = time.Second
 
-	tc := newFirstSeenCache(time.Second)
+	tc := newFirstSeenCache(time.Second, time.Now)
 	for i := 0; i < 10; i++ {
 		tc.Add(fmt.Sprint(i))
 		time.Sleep(time.Millisecond * 100)
@@ -36,7 +36,7 @@ func TestFirstSeenCacheExpire(t *testing.T) {
 func TestFirstSeenCacheNotFoundAfterExpire(t *testing.T) {
 	backgroundSweepInterval = time.Second
 
-	tc := newFirstSeenCache(time.Second)
+	tc := newFirstSeenCache(time.Second, time.Now)
 	tc.Add(fmt.Sprint(0))
 
 	time.Sleep(2 * time.Second)
@@ -44,3 +44,54 @@ func TestFirstSeenCacheNotFoundAfterExpire(t *testing.T) {
 		t.Fatal("should have dropped this from the cache already")
 	}
 }
+
+func TestFirstSeenCacheAddWithTTL(t *testing.T) {
+	now := time.Now()
+	tc := NewFirstSeenCache(time.Minute, func() time.Time { return now })
+
+	if !tc.AddWithTTL("test", time.Hour) {
+		t.Fatal("should have added this key")
+	}
+	if expiry, ok := tc.Expiry("test"); !ok || !expiry.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected expiry: %s", expiry)
+	}
+
+	// an earlier expiry doesn't shorten the entry
+	if tc.AddWithTTL("test", time.Second) {
+		t.Fatal("should already have this key")
+	}
+	if expiry, _ := tc.Expiry("test"); !expiry.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected expiry: %s", expiry)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, ok := tc.Expiry("test"); ok || tc.Has("test") {
+		t.Fatal("should have expired this key")
+	}
+}
+
+func TestFirstSeenCacheOnExpire(t *testing.T) {
+	now := time.Now()
+	tc := NewFirstSeenCache(time.Minute, func() time.Time { return now })
+	defer tc.Done()
+
+	var expired []string
+	tc.OnExpire(func(s string) { expired = append(expired, s) })
+
+	tc.Add("short")
+	tc.AddWithTTL("long", time.Hour)
+
+	tc.Sweep()
+	if len(expired) != 0 {
+		t.Fatalf("unexpected expired entries: %v", expired)
+	}
+
+	now = now.Add(2 * time.Minute)
+	tc.Sweep()
+	if len(expired) != 1 || expired[0] != "short" {
+		t.Fatalf("expected the short entry to expire, got %v", expired)
+	}
+	if !tc.Has("long") {
+		t.Fatal("should still have the long entry")
+	}
+}
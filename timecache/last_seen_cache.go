@@ -12,21 +12,23 @@ type LastSeenCache struct {
 	lk  sync.Mutex
 	m   map[string]time.Time
 	ttl time.Duration
+	now func() time.Time
 
 	done func()
 }
 
 var _ TimeCache = (*LastSeenCache)(nil)
 
-func newLastSeenCache(ttl time.Duration) *LastSeenCache {
+func newLastSeenCache(ttl time.Duration, now func() time.Time) *LastSeenCache {
 	tc := &LastSeenCache{
 		m:   make(map[string]time.Time),
 		ttl: ttl,
+		now: now,
 	}
 
 	ctx, done := context.WithCancel(context.Background())
 	tc.done = done
-	go background(ctx, &tc.lk, tc.m)
+	go background(ctx, &tc.lk, tc.m, now)
 
 	return tc
 }
@@ -39,20 +41,39 @@ func (tc *LastSeenCache) Add(s string) bool {
 	tc.lk.Lock()
 	defer tc.lk.Unlock()
 
-	_, ok := tc.m[s]
-	tc.m[s] = time.Now().Add(tc.ttl)
+	now := tc.now()
+	expiry, ok := tc.m[s]
+	tc.m[s] = now.Add(tc.ttl)
 
-	return !ok
+	return !ok || expiry.Before(now)
 }
 
 func (tc *LastSeenCache) Has(s string) bool {
 	tc.lk.Lock()
 	defer tc.lk.Unlock()
 
-	_, ok := tc.m[s]
-	if ok {
-		tc.m[s] = time.Now().Add(tc.ttl)
+	now := tc.now()
+	expiry, ok := tc.m[s]
+	if !ok || expiry.Before(now) {
+		return false
 	}
+	tc.m[s] = now.Add(tc.ttl)
 
-	return ok
+	return true
+}
+
+var _ Snapshotter = (*LastSeenCache)(nil)
+
+func (tc *LastSeenCache) Snapshot() map[string]time.Time {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+
+	return snapshot(tc.m, tc.now())
+}
+
+func (tc *LastSeenCache) Restore(entries map[string]time.Time) {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+
+	restore(tc.m, entries, tc.now())
 }
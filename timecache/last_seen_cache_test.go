@@ -7,7 +7,7 @@ import (
 )
 
 func TestLastSeenCacheFound(t *testing.T) {
-	tc := newLastSeenCache(time.Minute)
+	tc := newLastSeenCache(time.Minute, time.Now)
 
 	tc.Add("test")
 
@@ -18,7 +18,7 @@ func TestLastSeenCacheFound(t *testing.T) {
 
 func TestLastSeenCacheExpire(t *testing.T) {
 	backgroundSweepInterval = time.Second
-	tc := newLastSeenCache(time.Second)
+	tc := newLastSeenCache(time.Second, time.Now)
 	for i := 0; i < 11; i++ {
 		tc.Add(fmt.Sprint(i))
 		time.Sleep(time.Millisecond * 100)
@@ -35,7 +35,7 @@ func TestLastSeenCacheExpire(t *testing.T) {
 func TestLastSeenCacheSlideForward(t *testing.T) {
 	t.Skip("timing is too fine grained to run in CI")
 
-	tc := newLastSeenCache(time.Second)
+	tc := newLastSeenCache(time.Second, time.Now)
 	i := 0
 
 	// T0ms: Add 8 entries with a 100ms sleep after each
@@ -82,7 +82,7 @@ func TestLastSeenCacheSlideForward(t *testing.T) {
 func TestLastSeenCacheNotFoundAfterExpire(t *testing.T) {
 	backgroundSweepInterval = time.Second
 
-	tc := newLastSeenCache(time.Second)
+	tc := newLastSeenCache(time.Second, time.Now)
 	tc.Add(fmt.Sprint(0))
 
 	time.Sleep(2 * time.Second)
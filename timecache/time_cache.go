@@ -13,8 +13,12 @@ type Strategy uint8
 
 const (
 	// Strategy_FirstSeen expires an entry from the time it was added.
+	// Memory use is bounded by the rate of distinct ids times the ttl, but an id replayed
+	// periodically is forgotten every ttl and accepted again as new.
 	Strategy_FirstSeen Strategy = iota
 	// Stategy_LastSeen expires an entry from the last time it was touched by an Add or Has.
+	// An id replayed more often than the ttl is never forgotten, so slow replays are suppressed
+	// for as long as they last, at the cost of retaining replayed ids indefinitely.
 	Strategy_LastSeen
 )
 
@@ -34,19 +38,36 @@ type TimeCache interface {
 	Done()
 }
 
+// Snapshotter is implemented by the caches whose entries can be saved and restored, e.g. across
+// restarts.
+type Snapshotter interface {
+	// Snapshot returns the ids in the cache that haven't expired, with their expiry.
+	Snapshot() map[string]time.Time
+	// Restore adds ids with their expiry into the cache, skipping the expired ones and those
+	// already in the cache.
+	Restore(entries map[string]time.Time)
+}
+
 // NewTimeCache defaults to the original ("first seen") cache implementation
 func NewTimeCache(ttl time.Duration) TimeCache {
 	return NewTimeCacheWithStrategy(Strategy_FirstSeen, ttl)
 }
 
 func NewTimeCacheWithStrategy(strategy Strategy, ttl time.Duration) TimeCache {
+	return NewTimeCacheWithClock(strategy, ttl, time.Now)
+}
+
+// NewTimeCacheWithClock creates a cache with the given strategy that takes the current time
+// from the now function, which allows entries to be expired without waiting in tests.
+// Expired entries are treated as absent even before the background sweep removes them.
+func NewTimeCacheWithClock(strategy Strategy, ttl time.Duration, now func() time.Time) TimeCache {
 	switch strategy {
 	case Strategy_FirstSeen:
-		return newFirstSeenCache(ttl)
+		return newFirstSeenCache(ttl, now)
 	case Strategy_LastSeen:
-		return newLastSeenCache(ttl)
+		return newLastSeenCache(ttl, now)
 	default:
 		// Default to the original time cache implementation
-		return newFirstSeenCache(ttl)
+		return newFirstSeenCache(ttl, now)
 	}
 }
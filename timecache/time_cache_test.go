@@ -0,0 +1,96 @@
+package timecache
+
+import (
+	"testing"
+	"time"
+)
+
+// replay adds the same id every interval for the duration and returns how many times it
+// was accepted as new
+func replay(tc TimeCache, now *time.Time, interval, duration time.Duration) int {
+	accepted := 0
+	for elapsed := time.Duration(0); elapsed < duration; elapsed += interval {
+		if !tc.Has("replayed") && tc.Add("replayed") {
+			accepted++
+		}
+		*now = now.Add(interval)
+	}
+	return accepted
+}
+
+func TestStrategyReplay(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		strategy Strategy
+		capped   bool
+		// a replay every 40s is accepted again every other time with a first seen ttl of 1min
+		expected int
+	}{
+		{"FirstSeen", Strategy_FirstSeen, false, 8},
+		{"LastSeen", Strategy_LastSeen, false, 1},
+		{"CappedFirstSeen", Strategy_FirstSeen, true, 8},
+		{"CappedLastSeen", Strategy_LastSeen, true, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Now()
+			clock := func() time.Time { return now }
+
+			var cache TimeCache
+			if tc.capped {
+				cache = NewCappedCache(tc.strategy, time.Minute, 100, clock)
+			} else {
+				cache = NewTimeCacheWithClock(tc.strategy, time.Minute, clock)
+			}
+			defer cache.Done()
+
+			if accepted := replay(cache, &now, 40*time.Second, 10*time.Minute); accepted != tc.expected {
+				t.Fatalf("expected the replayed id to be accepted %d times, got %d", tc.expected, accepted)
+			}
+
+			// once the replays stop, the id is forgotten with either strategy
+			now = now.Add(2 * time.Minute)
+			if cache.Has("replayed") {
+				t.Fatal("expected the replayed id to expire")
+			}
+		})
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	for _, tc := range []struct {
+		name  string
+		cache func() TimeCache
+	}{
+		{"FirstSeen", func() TimeCache { return NewTimeCacheWithClock(Strategy_FirstSeen, time.Minute, clock) }},
+		{"LastSeen", func() TimeCache { return NewTimeCacheWithClock(Strategy_LastSeen, time.Minute, clock) }},
+		{"Capped", func() TimeCache { return NewCappedCache(Strategy_FirstSeen, time.Minute, 2, clock) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := tc.cache()
+			defer src.Done()
+			src.Add("a")
+			src.Add("b")
+
+			snap := src.(Snapshotter).Snapshot()
+			if len(snap) != 2 || !snap["a"].Equal(now.Add(time.Minute)) {
+				t.Fatalf("unexpected snapshot: %v", snap)
+			}
+			snap["expired"] = now.Add(-time.Second)
+
+			dst := tc.cache()
+			defer dst.Done()
+			dst.(Snapshotter).Restore(snap)
+			if !dst.Has("a") || !dst.Has("b") || dst.Has("expired") {
+				t.Fatal("expected the unexpired entries to be restored")
+			}
+
+			now = now.Add(61 * time.Second)
+			if dst.Has("a") {
+				t.Fatal("expected the restored entries to keep their expiry")
+			}
+		})
+	}
+}
@@ -8,14 +8,14 @@ import (
 
 var backgroundSweepInterval = time.Minute
 
-func background(ctx context.Context, lk sync.Locker, m map[string]time.Time) {
+func background(ctx context.Context, lk sync.Locker, m map[string]time.Time, now func() time.Time) {
 	ticker := time.NewTicker(backgroundSweepInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case now := <-ticker.C:
-			sweep(lk, m, now)
+		case <-ticker.C:
+			sweep(lk, m, now())
 
 		case <-ctx.Done():
 			return
@@ -33,3 +33,27 @@ func sweep(lk sync.Locker, m map[string]time.Time, now time.Time) {
 		}
 	}
 }
+
+// snapshot copies the entries of m that haven't expired
+func snapshot(m map[string]time.Time, now time.Time) map[string]time.Time {
+	res := make(map[string]time.Time, len(m))
+	for k, expiry := range m {
+		if !expiry.Before(now) {
+			res[k] = expiry
+		}
+	}
+	return res
+}
+
+// restore adds the entries that haven't expired into m, keeping the existing entries
+func restore(m map[string]time.Time, entries map[string]time.Time, now time.Time) {
+	for k, expiry := range entries {
+		if expiry.Before(now) {
+			continue
+		}
+		if cur, ok := m[k]; ok && !cur.Before(now) {
+			continue
+		}
+		m[k] = expiry
+	}
+}
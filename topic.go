@@ -22,16 +22,107 @@ var ErrNilSignKey = errors.New("nil sign key")
 // ErrEmptyPeerID is returned if an empty peer ID was provided
 var ErrEmptyPeerID = errors.New("empty peer ID")
 
-// Topic is the handle for a pubsub topic
+// ErrMessageTooLarge is returned when a message exceeds the maximum message size of its topic
+type ErrMessageTooLarge struct {
+	Topic string
+	Size  int
+	Limit int
+}
+
+func (e ErrMessageTooLarge) Error() string {
+	return fmt.Sprintf("message of %d bytes exceeds the %d byte limit of topic %s", e.Size, e.Limit, e.Topic)
+}
+
+// ErrNotEnoughPeers is returned by Publish with WithReadiness when the router is not ready by
+// the time the context is done. It wraps the error of the context.
+type ErrNotEnoughPeers struct {
+	Topic string
+	// Needed is the topic size required with MinTopicSize; 0 with other readiness functions.
+	Needed int
+	// Have is the number of peers known in the topic.
+	Have int
+	// Err is the error of the context.
+	Err error
+}
+
+func (e ErrNotEnoughPeers) Error() string {
+	if e.Needed > 0 {
+		return fmt.Sprintf("router is not ready: %s (%d of %d peers in topic %s)", e.Err, e.Have, e.Needed, e.Topic)
+	}
+	return fmt.Sprintf("router is not ready: %s (%d peers in topic %s)", e.Err, e.Have, e.Topic)
+}
+
+func (e ErrNotEnoughPeers) Unwrap() error {
+	return e.Err
+}
+
+// Topic is the handle for a pubsub topic.
+//
+// A Topic is safe for concurrent use by multiple goroutines. Close waits for the calls in
+// progress on the handle, but for the publications waiting for readiness with WithReadiness,
+// which fail with ErrTopicClosed once it succeeds. After a successful Close the topic is closed
+// for good: the methods return ErrTopicClosed, ListPeers returns no peers and GetCachedMessage
+// finds no message.
 type Topic struct {
 	p     *PubSub
 	topic string
 
+	// maxMessageSize is the topic specific message size limit; 0 if only the global limit applies
+	maxMessageSize int
+
+	// security seals and opens message payloads; nil for plaintext topics
+	security MessageSecurity
+
+	// signPolicy overrides the global signature policy; nil if the global policy applies
+	signPolicy *MessageSignaturePolicy
+	// signKey is the key used with a topic policy that signs while the global one does not
+	signKey crypto.PrivKey
+
+	// replay retains message IDs of anonymous topics; nil for other topics
+	replay *replayFilter
+
+	// tracer receives the events of the topic besides the global tracers
+	tracer topicTracer
+
+	// validationDeadline bounds the validation of the messages from their arrival; 0 if unbounded
+	validationDeadline time.Duration
+
+	// allowList restricts the message authors; nil if anyone may publish
+	allowList *topicAllowList
+
+	// discovery parameters; nil if the defaults apply
+	discovery *TopicDiscoveryParams
+	// noDiscovery excludes the topic from advertising and searching
+	noDiscovery bool
+	// bypassFilter allows joining the topic and tracking its remote subscriptions regardless of
+	// the subscription filter
+	bypassFilter bool
+	// graftReplay announces the gossip window to the peers grafting into the mesh
+	graftReplay bool
+
+	// autoJoin joins the topic while we sustain a publish rate; nil if it is not joined
+	// automatically
+	autoJoin *autoJoiner
+
+	// bestEffort skips the sends of the messages to the peers with more than bestEffortWatermark
+	// RPCs queued, and the answers to the IWANTs for them
+	bestEffort          bool
+	bestEffortWatermark int
+
+	// relayValidation is the validation of the messages while the topic is only relayed
+	relayValidation RelayValidationPolicy
+
+	// watchWindow is the time the published messages have to show signs of propagation; 0 if
+	// they are not watched
+	watchWindow time.Duration
+
 	evtHandlerMux sync.RWMutex
 	evtHandlers   map[*TopicEventHandler]struct{}
 
 	mux    sync.RWMutex
 	closed bool
+	// done is closed with the topic, for the publications and bootstraps waiting for peers
+	done chan struct{}
 }
 
 // String returns the topic associated with t
@@ -42,23 +133,23 @@ func (t *Topic) String() string {
 // SetScoreParams sets the topic score parameters if the pubsub router supports peer
 // scoring
 func (t *Topic) SetScoreParams(p *TopicScoreParams) error {
-	err := p.validate()
-	if err != nil {
-		return fmt.Errorf("invalid topic score parameters: %w", err)
-	}
-
-	t.mux.Lock()
-	defer t.mux.Unlock()
+	t.mux.RLock()
+	defer t.mux.RUnlock()
 
 	if t.closed {
 		return ErrTopicClosed
 	}
 
+	err := p.validate()
+	if err != nil {
+		return fmt.Errorf("invalid topic score parameters: %w", err)
+	}
+
 	result := make(chan error, 1)
 	update := func() {
 		gs, ok := t.p.rt.(*GossipSubRouter)
 		if !ok {
-			result <- fmt.Errorf("pubsub router is not gossipsub")
+			result <- ErrNotGossipSub
 			return
 		}
 
@@ -128,6 +219,14 @@ func (t *Topic) EventHandler(opts ...TopicEventHandlerOpt) (*TopicEventHandler,
 	return h, nil
 }
 
+// eventHandlers returns the number of active event handlers of the topic
+func (t *Topic) eventHandlers() int {
+	t.evtHandlerMux.RLock()
+	defer t.evtHandlerMux.RUnlock()
+
+	return len(t.evtHandlers)
+}
+
 func (t *Topic) sendNotification(evt PeerEvent) {
 	t.evtHandlerMux.RLock()
 	defer t.evtHandlerMux.RUnlock()
@@ -166,7 +265,9 @@ func (t *Topic) Subscribe(opts ...SubOpt) (*Subscription, error) {
 
 	out := make(chan *Subscription, 1)
 
-	t.p.disc.Discover(sub.topic)
+	if !t.noDiscovery {
+		t.p.disc.Discover(sub.topic)
+	}
 
 	select {
 	case t.p.addSub <- &addSubReq{
@@ -192,7 +293,9 @@ func (t *Topic) Relay() (RelayCancelFunc, error) {
 
 	out := make(chan RelayCancelFunc, 1)
 
-	t.p.disc.Discover(t.topic)
+	if !t.noDiscovery {
+		t.p.disc.Discover(t.topic)
+	}
 
 	select {
 	case t.p.addRelay <- &addRelayReq{
@@ -216,41 +319,103 @@ type PublishOptions struct {
 	ready     RouterReady
 	customKey ProvideKey
 	local     bool
+
+	receiptMode    ReceiptMode
+	receiptSends   int
+	receiptTimeout time.Duration
+
+	// watch receives the outcome of the publish watch with PublishWithWatch
+	watch chan<- error
+
+	// values are the values of the context of the validators
+	values context.Context
+
+	// priority is the priority of the message in the outbound queues
+	priority int
 }
 
 type PubOpt func(pub *PublishOptions) error
 
 // Publish publishes data to topic.
 func (t *Topic) Publish(ctx context.Context, data []byte, opts ...PubOpt) error {
+	_, err := t.publish(ctx, data, false, opts...)
+	return err
+}
+
+// PublishWithReceipt publishes data to topic and returns a receipt that completes when the
+// delivery of the message is confirmed, as selected by WithReceiptMode, or when the receipt
+// times out. By default the receipt completes when the message is seen coming back from the
+// network.
+func (t *Topic) PublishWithReceipt(ctx context.Context, data []byte, opts ...PubOpt) (*DeliveryReceipt, error) {
+	return t.publish(ctx, data, true, opts...)
+}
+
+func (t *Topic) publish(ctx context.Context, data []byte, withReceipt bool, opts ...PubOpt) (*DeliveryReceipt, error) {
 	t.mux.RLock()
 	defer t.mux.RUnlock()
 	if t.closed {
-		return ErrTopicClosed
+		return nil, ErrTopicClosed
 	}
 
 	pid := t.p.signID
 	key := t.p.signKey
+	signer := t.p.signer
+	policy := t.p.signPolicy
+	if t.signPolicy != nil {
+		policy = *t.signPolicy
+		if t.signKey != nil {
+			key = t.signKey
+		}
+		if policy.anonymous() {
+			pid = ""
+		}
+	}
+	if !policy.mustSign() {
+		key, signer = nil, nil
+	}
 
 	pub := &PublishOptions{}
 	for _, opt := range opts {
 		err := opt(pub)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
+	if pub.priority != PriorityNormal && !t.p.prioritized {
+		return nil, ErrPrioritiesDisabled
+	}
+
+	if withReceipt && pub.local {
+		return nil, fmt.Errorf("cannot track delivery of a local publication")
+	}
+
 	if pub.customKey != nil && !pub.local {
 		key, pid = pub.customKey()
+		signer = nil
 		if key == nil {
-			return ErrNilSignKey
+			return nil, ErrNilSignKey
 		}
 		if len(pid) == 0 {
-			return ErrEmptyPeerID
+			return nil, ErrEmptyPeerID
 		}
 	}
 
+	if t.allowList != nil && !t.allowList.Allowed(pid) {
+		return nil, ValidationError{Reason: RejectUnauthorizedAuthor}
+	}
+
+	wire := data
+	if t.security != nil {
+		sealed, err := t.security.Seal(data)
+		if err != nil {
+			return nil, fmt.Errorf("error sealing message: %w", err)
+		}
+		wire = sealed
+	}
+
 	m := &pb.Message{
-		Data:  data,
+		Data:  wire,
 		Topic: &t.topic,
 		From:  nil,
 		Seqno: nil,
@@ -263,52 +428,140 @@ func (t *Topic) Publish(ctx context.Context, data []byte, opts ...PubOpt) error
 		m.From = []byte(pid)
 		err := signMessage(pid, key, m)
 		if err != nil {
-			return err
+			return nil, err
 		}
+	} else if signer != nil {
+		m.From = []byte(pid)
+		err := signMessageWith(pid, signer, m)
+		if err != nil {
+			return nil, fmt.Errorf("error signing message: %w", err)
+		}
+	}
+
+	if t.maxMessageSize > 0 && m.Size() > t.maxMessageSize {
+		return nil, ErrMessageTooLarge{Topic: t.topic, Size: m.Size(), Limit: t.maxMessageSize}
 	}
 
 	if pub.ready != nil {
-		if t.p.disc.discovery != nil {
-			t.p.disc.Bootstrap(ctx, t.topic, pub.ready)
-		} else {
-			// TODO: we could likely do better than polling every 200ms.
-			// For example, block this goroutine on a channel,
-			// and check again whenever events tell us that the number of
-			// peers has increased.
-			var ticker *time.Ticker
-		readyLoop:
-			for {
-				// Check if ready for publishing.
-				// Similar to what disc.Bootstrap does.
-				res := make(chan bool, 1)
-				select {
-				case t.p.eval <- func() {
-					done, _ := pub.ready(t.p.rt, t.topic)
-					res <- done
-				}:
-					if <-res {
-						break readyLoop
+		// the handle isn't held while waiting, so that it can be closed meanwhile
+		t.mux.RUnlock()
+		err := t.waitReady(ctx, pub.ready)
+		t.mux.RLock()
+		if t.closed {
+			return nil, ErrTopicClosed
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	msg := &Message{Message: m, ReceivedFrom: t.p.host.ID(), Local: pub.local, values: pub.values, priority: pub.priority}
+	if t.security != nil {
+		// the ID and signature cover the sealed message, local validators and subscribers
+		// see the plaintext
+		t.p.idGen.ID(msg)
+		msg.wire = m
+		plain := *m
+		plain.Data = data
+		msg.Message = &plain
+	}
+	// the watch must be armed before the message hits the wire
+	var watch *publishWatch
+	if t.watchWindow > 0 && !pub.local {
+		if err := t.p.installWatches(); err != nil {
+			return nil, err
+		}
+		watch = t.p.watches.watch(msg, t.watchWindow, pub.watch)
+	}
+
+	if !withReceipt {
+		err := t.p.val.PushLocal(msg)
+		if err != nil {
+			t.p.watches.unwatch(watch)
+		}
+		return nil, err
+	}
+
+	timeout := pub.receiptTimeout
+	if timeout == 0 {
+		timeout = DeliveryReceiptTimeout
+	}
+	r := &DeliveryReceipt{
+		id:    t.p.idGen.ID(msg),
+		mode:  pub.receiptMode,
+		sends: pub.receiptSends,
+		done:  make(chan struct{}),
+	}
+
+	// the receipt must be tracked before the message hits the wire
+	if err := t.p.installReceipts(); err != nil {
+		t.p.watches.unwatch(watch)
+		return nil, err
+	}
+	t.p.receipts.track(r, timeout)
+	if err := t.p.val.PushLocal(msg); err != nil {
+		t.p.receipts.untrack(r)
+		t.p.watches.unwatch(watch)
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// waitReady waits until the router is ready to publish in the topic
+func (t *Topic) waitReady(ctx context.Context, ready RouterReady) error {
+	ctx, cancel := t.untilClosed(ctx)
+	defer cancel()
+
+	if t.p.disc.enabled() && !t.noDiscovery {
+		t.p.disc.Bootstrap(ctx, t.topic, ready)
+	} else {
+		// TODO: we could likely do better than polling every 200ms.
+		// For example, block this goroutine on a channel,
+		// and check again whenever events tell us that the number of
+		// peers has increased.
+		var ticker *time.Ticker
+		notReady := ErrNotEnoughPeers{Topic: t.topic}
+	readyLoop:
+		for {
+			// Check if ready for publishing.
+			// Similar to what disc.Bootstrap does.
+			res := make(chan bool, 1)
+			select {
+			case t.p.eval <- func() {
+				done, err := ready(t.p.rt, t.topic)
+				if !done {
+					var nep ErrNotEnoughPeers
+					if errors.As(err, &nep) {
+						notReady.Needed = nep.Needed
 					}
-				case <-t.p.ctx.Done():
-					return t.p.ctx.Err()
-				case <-ctx.Done():
-					return ctx.Err()
+					notReady.Have = len(t.p.topics[t.topic])
 				}
-				if ticker == nil {
-					ticker = time.NewTicker(200 * time.Millisecond)
-					defer ticker.Stop()
+				res <- done
+			}:
+				if <-res {
+					break readyLoop
 				}
+			case <-t.p.ctx.Done():
+				return t.p.ctx.Err()
+			case <-ctx.Done():
+				notReady.Err = ctx.Err()
+				return notReady
+			}
+			if ticker == nil {
+				ticker = time.NewTicker(200 * time.Millisecond)
+				defer ticker.Stop()
+			}
 
-				select {
-				case <-ticker.C:
-				case <-ctx.Done():
-					return fmt.Errorf("router is not ready: %w", ctx.Err())
-				}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				notReady.Err = ctx.Err()
+				return notReady
 			}
 		}
 	}
-
-	return t.p.val.PushLocal(&Message{m, "", t.p.host.ID(), nil, pub.local})
+	return nil
 }
 
 // WithReadiness returns a publishing option for only publishing when the router is ready.
@@ -365,6 +618,7 @@ func (t *Topic) Close() error {
 
 	if err == nil {
 		t.closed = true
+		close(t.done)
 	}
 
 	return err
@@ -381,11 +635,88 @@ func (t *Topic) ListPeers() []peer.ID {
 	return t.p.ListPeers(t.topic)
 }
 
+// GetCachedMessage looks up a message of this topic in the gossipsub message cache; see
+// PubSub.GetCachedMessage.
+func (t *Topic) GetCachedMessage(msgID string) (*Message, bool) {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+	if t.closed {
+		return nil, false
+	}
+
+	return t.p.getCachedMessage(msgID, t.topic)
+}
+
+// ErrNoDiscovery is returned when bootstrapping a Topic without discovery
+var ErrNoDiscovery = errors.New("discovery is not enabled for this topic")
+
+// Bootstrap actively searches for peers in the topic through discovery, until at least minPeers
+// connected peers are subscribed to it or the context expires. It returns the number of
+// subscribed peers reached, with the context error if it expired before reaching minPeers.
+func (t *Topic) Bootstrap(ctx context.Context, minPeers int) (int, error) {
+	t.mux.RLock()
+	closed := t.closed
+	t.mux.RUnlock()
+	if closed {
+		return 0, ErrTopicClosed
+	}
+
+	if minPeers <= 0 {
+		return 0, fmt.Errorf("invalid minimum number of peers: %d", minPeers)
+	}
+	if !t.p.disc.enabled() || t.noDiscovery {
+		return 0, ErrNoDiscovery
+	}
+
+	// the handle isn't held while waiting, so that it can be closed meanwhile
+	bctx, cancel := t.untilClosed(ctx)
+	defer cancel()
+	ready := func(_ PubSubRouter, topic string) (bool, error) {
+		return len(t.p.topics[topic]) >= minPeers, nil
+	}
+	ok := t.p.disc.Bootstrap(bctx, t.topic, ready)
+
+	t.mux.RLock()
+	closed = t.closed
+	t.mux.RUnlock()
+	if closed {
+		return 0, ErrTopicClosed
+	}
+
+	peers := len(t.p.ListPeers(t.topic))
+	if ok {
+		return peers, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return peers, err
+	}
+	return peers, t.p.ctx.Err()
+}
+
+// untilClosed returns a context cancelled when the topic handle is closed
+func (t *Topic) untilClosed(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-t.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
 type EventType int
 
 const (
 	PeerJoin EventType = iota
 	PeerLeave
+	// MeshAutoJoin is the event of a topic joined automatically with WithAutoJoin, with our own
+	// peer ID; only delivered to the handlers created WithMeshAutoEvents.
+	MeshAutoJoin
+	// MeshAutoLeave is the event of a topic joined automatically left after an idle period,
+	// with our own peer ID; only delivered to the handlers created WithMeshAutoEvents.
+	MeshAutoLeave
 )
 
 // TopicEventHandler is used to manage topic specific events. No Subscription is required to receive events.
@@ -396,6 +727,9 @@ type TopicEventHandler struct {
 	evtLogMx sync.Mutex
 	evtLog   map[peer.ID]EventType
 	evtLogCh chan struct{}
+
+	// autoEvents is set to receive the MeshAutoJoin and MeshAutoLeave events
+	autoEvents bool
 }
 
 type TopicEventHandlerOpt func(t *TopicEventHandler) error
@@ -408,11 +742,11 @@ type PeerEvent struct {
 // Cancel closes the topic event handler
 func (t *TopicEventHandler) Cancel() {
 	topic := t.topic
-	t.err = fmt.Errorf("topic event handler cancelled by calling handler.Cancel()")
 
 	topic.evtHandlerMux.Lock()
+	t.err = fmt.Errorf("topic event handler cancelled by calling handler.Cancel()")
 	delete(topic.evtHandlers, t)
-	t.topic.evtHandlerMux.Unlock()
+	topic.evtHandlerMux.Unlock()
 }
 
 func (t *TopicEventHandler) sendNotification(evt PeerEvent) {
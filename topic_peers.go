@@ -0,0 +1,85 @@
+package pubsub
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// peerList is a set of peers backed by a slice, so that the heartbeat iterates it without
+// walking a map or allocating
+type peerList struct {
+	peers []peer.ID
+	index map[peer.ID]int
+}
+
+func newPeerList() *peerList {
+	return &peerList{index: make(map[peer.ID]int)}
+}
+
+func (l *peerList) add(p peer.ID) {
+	if _, ok := l.index[p]; ok {
+		return
+	}
+	l.index[p] = len(l.peers)
+	l.peers = append(l.peers, p)
+}
+
+func (l *peerList) remove(p peer.ID) {
+	i, ok := l.index[p]
+	if !ok {
+		return
+	}
+
+	last := len(l.peers) - 1
+	l.peers[i] = l.peers[last]
+	l.index[l.peers[i]] = i
+	l.peers[last] = ""
+	l.peers = l.peers[:last]
+	delete(l.index, p)
+}
+
+// peerJoined adds a peer to the candidates of a topic, as it subscribes to it
+func (gs *GossipSubRouter) peerJoined(topic string, p peer.ID) {
+	l, ok := gs.topicPeers[topic]
+	if !ok {
+		l = newPeerList()
+		gs.topicPeers[topic] = l
+	}
+	l.add(p)
+	gs.meshChanged(topic)
+}
+
+// peerLeft removes a peer from the candidates of a topic
+func (gs *GossipSubRouter) peerLeft(topic string, p peer.ID) {
+	l, ok := gs.topicPeers[topic]
+	if !ok {
+		return
+	}
+	l.remove(p)
+	if len(l.peers) == 0 {
+		delete(gs.topicPeers, topic)
+	}
+	gs.meshChanged(topic)
+}
+
+// topicCandidates returns the peers subscribed to a topic, which must not be modified
+func (gs *GossipSubRouter) topicCandidates(topic string) []peer.ID {
+	if l, ok := gs.topicPeers[topic]; ok {
+		return l.peers
+	}
+	return nil
+}
+
+// candidateScratch returns a copy of the peers subscribed to a topic, in a scratch slice reused
+// across calls
+func (gs *GossipSubRouter) candidateScratch(topic string) []peer.ID {
+	gs.scratch = append(gs.scratch[:0], gs.topicCandidates(topic)...)
+	return gs.scratch
+}
+
+// appendPeers appends the peers of a map to a slice
+func appendPeers(plst []peer.ID, peers map[peer.ID]struct{}) []peer.ID {
+	for p := range peers {
+		plst = append(plst, p)
+	}
+	return plst
+}
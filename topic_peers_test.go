@@ -0,0 +1,167 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+func TestPeerList(t *testing.T) {
+	l := newPeerList()
+	for _, p := range []peer.ID{"a", "b", "c", "d", "b"} {
+		l.add(p)
+	}
+	l.remove("b")
+	l.remove("e")
+	l.remove("d")
+	l.add("e")
+
+	peers := slices.Clone(l.peers)
+	slices.Sort(peers)
+	if !slices.Equal(peers, []peer.ID{"a", "c", "e"}) {
+		t.Fatalf("unexpected peers %v", peers)
+	}
+	for i, p := range l.peers {
+		if l.index[p] != i {
+			t.Fatalf("peer %s indexed at %d instead of %d", p, l.index[p], i)
+		}
+	}
+}
+
+func TestTopicCandidates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 4)
+	psubs := getGossipsubs(ctx, hosts)
+
+	var subs []*Subscription
+	for _, ps := range psubs {
+		subs = append(subs, mustSubscribe(t, ps, "test"))
+	}
+	connectAll(t, hosts)
+	time.Sleep(time.Second)
+
+	// the candidates follow the subscriptions of the peers
+	checkCandidates := func(expected int) {
+		t.Helper()
+		var candidates, members []peer.ID
+		done := make(chan struct{})
+		psubs[0].eval <- func() {
+			candidates = slices.Clone(psubs[0].rt.(*GossipSubRouter).topicCandidates("test"))
+			for p := range psubs[0].topics["test"] {
+				members = append(members, p)
+			}
+			close(done)
+		}
+		<-done
+
+		slices.Sort(candidates)
+		slices.Sort(members)
+		if len(candidates) != expected || !slices.Equal(candidates, members) {
+			t.Fatalf("expected %d candidates matching the topic members %v, got %v", expected, members, candidates)
+		}
+	}
+	checkCandidates(3)
+
+	subs[1].Cancel()
+	time.Sleep(100 * time.Millisecond)
+	checkCandidates(2)
+
+	hosts[2].Close()
+	time.Sleep(100 * time.Millisecond)
+	checkCandidates(1)
+}
+
+// BenchmarkHeartbeat measures the latency of a gossipsub heartbeat on a synthetic router state
+// of connected peers each subscribed to a few of the topics, all joined.
+func BenchmarkHeartbeat(b *testing.B) {
+	for _, size := range []struct{ peers, topics, perPeer int }{
+		{peers: 1000, topics: 10, perPeer: 2},
+		{peers: 10000, topics: 50, perPeer: 5},
+	} {
+		b.Run(fmt.Sprintf("%dPeers%dTopics", size.peers, size.topics), func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			h, err := libp2p.New(libp2p.NoListenAddrs)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer h.Close()
+			ps := getGossipsub(ctx, h, WithManualHeartbeat())
+			gs := ps.rt.(*GossipSubRouter)
+
+			topics := make([]string, size.topics)
+			for i := range topics {
+				topics[i] = fmt.Sprintf("topic-%d", i)
+			}
+
+			eval := func(f func()) {
+				done := make(chan struct{})
+				ps.eval <- func() {
+					f()
+					close(done)
+				}
+				<-done
+			}
+			drain := func() {
+				for _, ch := range ps.peers {
+					for len(ch) > 0 {
+						<-ch
+					}
+				}
+			}
+
+			eval(func() {
+				rng := rand.New(rand.NewSource(1))
+				for i := 0; i < size.peers; i++ {
+					pid := peer.ID(fmt.Sprintf("peer-%d", i))
+					ps.peers[pid] = make(chan *RPC, 64)
+					gs.peers[pid] = GossipSubID_v11
+					gs.outbound[pid] = rng.Intn(2) == 0
+					for _, j := range rng.Perm(size.topics)[:size.perPeer] {
+						t := topics[j]
+						if ps.topics[t] == nil {
+							ps.topics[t] = make(map[peer.ID]struct{})
+						}
+						ps.topics[t][pid] = struct{}{}
+						ps.notifyJoin(t, pid)
+					}
+				}
+				for _, t := range topics {
+					gs.Join(t)
+					for i := 0; i < 100; i++ {
+						topic := t
+						gs.mcache.Put(&Message{Message: &pb.Message{
+							From:  []byte(fmt.Sprintf("author-%d", i)),
+							Seqno: []byte(fmt.Sprint(i)),
+							Data:  []byte("data"),
+							Topic: &topic,
+						}})
+					}
+				}
+				drain()
+			})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				eval(func() {
+					gs.heartbeat()
+					b.StopTimer()
+					drain()
+					b.StartTimer()
+				})
+			}
+		})
+	}
+}
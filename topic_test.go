@@ -1064,3 +1064,318 @@ func TestWithLocalPublication(t *testing.T) {
 		t.Fatal("wrong message")
 	}
 }
+
+func TestTopicMaxMessageSize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const topic = "test"
+
+	hosts := getNetHosts(t, ctx, 2)
+	pubsubs := getPubsubs(ctx, hosts)
+
+	if _, err := pubsubs[0].Join("other", WithTopicMaxMessageSize(DefaultMaxMessageSize+1)); err == nil {
+		t.Fatal("expected an error for a limit above the global limit")
+	}
+
+	sender, err := pubsubs[0].Join(topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := pubsubs[1].Join(topic, WithTopicMaxMessageSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	connectAll(t, hosts)
+
+	// joining again doesn't replace the limit of the existing handle
+	if _, err := pubsubs[1].Join(topic, WithTopicMaxMessageSize(1024)); !errors.Is(err, ErrTopicExists) {
+		t.Fatalf("expected ErrTopicExists, got %v", err)
+	}
+
+	// subscribing through pubsub uses the existing handle and its limit
+	sub, err := pubsubs[1].Subscribe(topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+
+	// outbound limit
+	err = receiver.Publish(ctx, make([]byte, 512))
+	var tooLarge ErrMessageTooLarge
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+	}
+	if tooLarge.Limit != 256 || tooLarge.Topic != topic {
+		t.Fatalf("unexpected error details: %+v", tooLarge)
+	}
+
+	// inbound limit: the oversized message is dropped, the next one gets through
+	if err := sender.Publish(ctx, make([]byte, 512)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Publish(ctx, []byte("small")); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Data) != "small" {
+		t.Fatalf("received oversized message of %d bytes", len(msg.Data))
+	}
+}
+
+func TestTopicErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0],
+		WithSubscriptionFilter(NewAllowlistSubscriptionFilter("test")),
+		WithMaxMessageSize(1<<10))
+
+	topic, err := ps.Join("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ps.Join("test"); !errors.Is(err, ErrTopicExists) {
+		t.Fatalf("expected ErrTopicExists, got %v", err)
+	}
+	if _, err := ps.Join("other"); !errors.Is(err, ErrTopicNotAllowed) {
+		t.Fatalf("expected ErrTopicNotAllowed, got %v", err)
+	}
+
+	// no peer ever shows up
+	tctx, tcancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	err = topic.Publish(tctx, []byte("message"), WithReadiness(MinTopicSize(2)))
+	tcancel()
+	var notEnough ErrNotEnoughPeers
+	if !errors.As(err, &notEnough) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected ErrNotEnoughPeers wrapping the deadline, got %v", err)
+	}
+	if notEnough.Topic != "test" || notEnough.Needed != 2 || notEnough.Have != 0 {
+		t.Fatalf("unexpected error details: %+v", notEnough)
+	}
+
+	sub, err := topic.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := topic.Close(); !errors.Is(err, ErrTopicInUse) {
+		t.Fatalf("expected ErrTopicInUse, got %v", err)
+	}
+	// the cancellation is processed asynchronously
+	sub.Cancel()
+	for deadline := time.Now().Add(time.Second); ; {
+		err := topic.Close()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := topic.Publish(ctx, []byte("message")); !errors.Is(err, ErrTopicClosed) {
+		t.Fatalf("expected ErrTopicClosed, got %v", err)
+	}
+	if _, err := topic.Subscribe(); !errors.Is(err, ErrTopicClosed) {
+		t.Fatalf("expected ErrTopicClosed, got %v", err)
+	}
+
+	// validators
+	accept := func(context.Context, peer.ID, *Message) bool { return true }
+	if err := ps.RegisterTopicValidator("test", accept); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.RegisterTopicValidator("test", accept); !errors.Is(err, ErrValidatorExists) {
+		t.Fatalf("expected ErrValidatorExists, got %v", err)
+	}
+	if err := ps.RegisterTopicValidator("other", "accept"); !errors.Is(err, ErrInvalidValidator) {
+		t.Fatalf("expected ErrInvalidValidator, got %v", err)
+	}
+	if err := ps.UnregisterTopicValidator("test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.UnregisterTopicValidator("test"); !errors.Is(err, ErrNoValidator) {
+		t.Fatalf("expected ErrNoValidator, got %v", err)
+	}
+}
+
+func TestTopicConcurrentUse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getGossipsubs(ctx, hosts)
+	connect(t, hosts[0], hosts[1])
+
+	// the remote peer churns its subscription, for the event handlers to get notifications
+	go func() {
+		for ctx.Err() == nil {
+			sub, err := psubs[1].Subscribe("test")
+			if err != nil {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+			sub.Cancel()
+		}
+	}()
+
+	// the handle is shared by workers calling all its methods while some of them try to close it
+	stress := func(topic *Topic, deadline time.Time) {
+		var wg sync.WaitGroup
+		var once sync.Once
+		closedAt := make(chan struct{})
+		check := func(err error, after bool) {
+			if after && !errors.Is(err, ErrTopicClosed) {
+				t.Errorf("expected ErrTopicClosed once the topic is closed, got %v", err)
+			}
+		}
+		isClosed := func() bool {
+			select {
+			case <-closedAt:
+				return true
+			default:
+				return false
+			}
+		}
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for n := 0; time.Now().Before(deadline); n++ {
+					after := isClosed()
+					switch (i + n) % 7 {
+					case 0:
+						err := topic.Publish(ctx, []byte("message"))
+						if err != nil && !errors.Is(err, ErrTopicClosed) {
+							t.Errorf("unexpected publish error: %v", err)
+						}
+						check(err, after)
+					case 1:
+						sub, err := topic.Subscribe()
+						check(err, after)
+						if err == nil {
+							sub.Cancel()
+						}
+					case 2:
+						relayCancel, err := topic.Relay()
+						check(err, after)
+						if err == nil {
+							relayCancel()
+						}
+					case 3:
+						h, err := topic.EventHandler()
+						check(err, after)
+						if err == nil {
+							tctx, tcancel := context.WithTimeout(ctx, time.Millisecond)
+							h.NextPeerEvent(tctx)
+							tcancel()
+							h.Cancel()
+							h.Cancel()
+						}
+					case 4:
+						peers := topic.ListPeers()
+						if after && len(peers) != 0 {
+							t.Errorf("expected no peers once the topic is closed, got %v", peers)
+						}
+						topic.GetCachedMessage("missing")
+						_ = topic.String()
+					case 5:
+						err := topic.SetScoreParams(&TopicScoreParams{TimeInMeshQuantum: time.Second})
+						check(err, after)
+					case 6:
+						err := topic.Close()
+						if err != nil && !errors.Is(err, ErrTopicInUse) {
+							t.Errorf("unexpected close error: %v", err)
+						}
+						if err == nil {
+							once.Do(func() { close(closedAt) })
+							// closing is idempotent and final
+							if err := topic.Close(); err != nil {
+								t.Errorf("expected closing again to succeed, got %v", err)
+							}
+							if err := topic.Publish(ctx, []byte("message")); !errors.Is(err, ErrTopicClosed) {
+								t.Errorf("expected ErrTopicClosed right after closing, got %v", err)
+							}
+						}
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if isClosed() {
+			return
+		}
+		// the cancellations are processed asynchronously
+		for until := time.Now().Add(time.Second); ; {
+			err := topic.Close()
+			if err == nil {
+				break
+			}
+			if time.Now().After(until) {
+				t.Fatal(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := topic.Publish(ctx, []byte("message")); !errors.Is(err, ErrTopicClosed) {
+			t.Fatalf("expected ErrTopicClosed after closing, got %v", err)
+		}
+	}
+
+	end := time.Now().Add(3 * time.Second)
+	for time.Now().Before(end) {
+		topic, err := psubs[0].Join("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stress(topic, time.Now().Add(300*time.Millisecond))
+		if t.Failed() {
+			return
+		}
+	}
+}
+
+func TestTopicCloseWhilePublishing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 1)
+	ps := getPubsub(ctx, hosts[0])
+	topic, err := ps.Join("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the publication waits for peers that never show up
+	published := make(chan error, 1)
+	go func() {
+		published <- topic.Publish(ctx, []byte("message"), WithReadiness(MinTopicSize(1)))
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- topic.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the topic to close while a publication waits for readiness")
+	}
+
+	select {
+	case err := <-published:
+		if !errors.Is(err, ErrTopicClosed) {
+			t.Fatalf("expected ErrTopicClosed for the waiting publication, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the waiting publication to end with the topic")
+	}
+}
@@ -1,10 +1,14 @@
 package pubsub
 
 import (
+	"maps"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
 
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 )
@@ -49,6 +53,7 @@ type RawTracer interface {
 	// ThrottlePeer is invoked when a peer is throttled by the peer gater.
 	ThrottlePeer(p peer.ID)
 	// RecvRPC is invoked when an incoming RPC is received.
+	// The RPC is reused once handled, unless pooling is disabled with WithoutPooling.
 	RecvRPC(rpc *RPC)
 	// SendRPC is invoked when a RPC is sent.
 	SendRPC(rpc *RPC, p peer.ID)
@@ -62,9 +67,81 @@ type RawTracer interface {
 // pubsub tracer details
 type pubsubTracer struct {
 	tracer EventTracer
-	raw    []RawTracer
+	raw    atomic.Pointer[[]RawTracer]
+	topics atomic.Pointer[map[string]topicTracer]
 	pid    peer.ID
 	idGen  *msgIDGenerator
+	clock  Clock
+}
+
+// topicTracer is a tracer attached to a topic with WithTopicTracer
+type topicTracer struct {
+	event EventTracer
+	raw   RawTracer
+}
+
+// topicTracer returns the tracer attached to a topic, if any
+func (t *pubsubTracer) topicTracer(topic string) topicTracer {
+	if topics := t.topics.Load(); topics != nil {
+		return (*topics)[topic]
+	}
+	return topicTracer{}
+}
+
+// setTopicTracer attaches a tracer to a topic, or detaches it if zero; it is called from the
+// event loop.
+func (t *pubsubTracer) setTopicTracer(topic string, tt topicTracer) {
+	var topics map[string]topicTracer
+	if cur := t.topics.Load(); cur != nil {
+		topics = maps.Clone(*cur)
+	} else {
+		topics = make(map[string]topicTracer)
+	}
+
+	if tt == (topicTracer{}) {
+		delete(topics, topic)
+	} else {
+		topics[topic] = tt
+	}
+	t.topics.Store(&topics)
+}
+
+// trace delivers an event to the event tracer and to the one attached to its topic
+func (t *pubsubTracer) trace(evt *pb.TraceEvent, tt topicTracer) {
+	if t.tracer != nil {
+		t.tracer.Trace(evt)
+	}
+	if tt.event != nil {
+		tt.event.Trace(evt)
+	}
+}
+
+// rawTracers returns the raw tracers. The slice is replaced rather than modified as tracers are
+// added and removed, so it's safe to iterate from any goroutine.
+func (t *pubsubTracer) rawTracers() []RawTracer {
+	if raw := t.raw.Load(); raw != nil {
+		return *raw
+	}
+	return nil
+}
+
+// addRaw adds raw tracers; it is called during construction and from the event loop.
+func (t *pubsubTracer) addRaw(tracers ...RawTracer) {
+	raw := append(slices.Clip(t.rawTracers()), tracers...)
+	t.raw.Store(&raw)
+}
+
+// removeRaw removes a raw tracer, returning false if it isn't registered; it is called from the
+// event loop.
+func (t *pubsubTracer) removeRaw(tracer RawTracer) bool {
+	cur := t.rawTracers()
+	i := slices.Index(cur, tracer)
+	if i < 0 {
+		return false
+	}
+	raw := slices.Delete(slices.Clone(cur), i, i+1)
+	t.raw.Store(&raw)
+	return true
 }
 
 func (t *pubsubTracer) PublishMessage(msg *Message) {
@@ -72,11 +149,13 @@ func (t *pubsubTracer) PublishMessage(msg *Message) {
 		return
 	}
 
-	if t.tracer == nil {
+	tt := t.topicTracer(msg.GetTopic())
+
+	if t.tracer == nil && tt.event == nil {
 		return
 	}
 
-	now := time.Now().UnixNano()
+	now := t.clock.Now().UnixNano()
 	evt := &pb.TraceEvent{
 		Type:      pb.TraceEvent_PUBLISH_MESSAGE.Enum(),
 		PeerID:    []byte(t.pid),
@@ -87,7 +166,7 @@ func (t *pubsubTracer) PublishMessage(msg *Message) {
 		},
 	}
 
-	t.tracer.Trace(evt)
+	t.trace(evt, tt)
 }
 
 func (t *pubsubTracer) ValidateMessage(msg *Message) {
@@ -95,10 +174,15 @@ func (t *pubsubTracer) ValidateMessage(msg *Message) {
 		return
 	}
 
+	tt := t.topicTracer(msg.GetTopic())
+
 	if msg.ReceivedFrom != t.pid {
-		for _, tr := range t.raw {
+		for _, tr := range t.rawTracers() {
 			tr.ValidateMessage(msg)
 		}
+		if tt.raw != nil {
+			tt.raw.ValidateMessage(msg)
+		}
 	}
 }
 
@@ -107,17 +191,22 @@ func (t *pubsubTracer) RejectMessage(msg *Message, reason string) {
 		return
 	}
 
+	tt := t.topicTracer(msg.GetTopic())
+
 	if msg.ReceivedFrom != t.pid {
-		for _, tr := range t.raw {
+		for _, tr := range t.rawTracers() {
 			tr.RejectMessage(msg, reason)
 		}
+		if tt.raw != nil {
+			tt.raw.RejectMessage(msg, reason)
+		}
 	}
 
-	if t.tracer == nil {
+	if t.tracer == nil && tt.event == nil {
 		return
 	}
 
-	now := time.Now().UnixNano()
+	now := t.clock.Now().UnixNano()
 	evt := &pb.TraceEvent{
 		Type:      pb.TraceEvent_REJECT_MESSAGE.Enum(),
 		PeerID:    []byte(t.pid),
@@ -130,25 +219,36 @@ func (t *pubsubTracer) RejectMessage(msg *Message, reason string) {
 		},
 	}
 
-	t.tracer.Trace(evt)
+	t.trace(evt, tt)
 }
 
 func (t *pubsubTracer) DuplicateMessage(msg *Message) {
+	t.duplicateMessage(msg, true)
+}
+
+// duplicateMessage traces a duplicate message to the raw tracers, and to the event tracers if
+// event is set.
+func (t *pubsubTracer) duplicateMessage(msg *Message, event bool) {
 	if t == nil {
 		return
 	}
 
+	tt := t.topicTracer(msg.GetTopic())
+
 	if msg.ReceivedFrom != t.pid {
-		for _, tr := range t.raw {
+		for _, tr := range t.rawTracers() {
 			tr.DuplicateMessage(msg)
 		}
+		if tt.raw != nil {
+			tt.raw.DuplicateMessage(msg)
+		}
 	}
 
-	if t.tracer == nil {
+	if !event || (t.tracer == nil && tt.event == nil) {
 		return
 	}
 
-	now := time.Now().UnixNano()
+	now := t.clock.Now().UnixNano()
 	evt := &pb.TraceEvent{
 		Type:      pb.TraceEvent_DUPLICATE_MESSAGE.Enum(),
 		PeerID:    []byte(t.pid),
@@ -160,7 +260,7 @@ func (t *pubsubTracer) DuplicateMessage(msg *Message) {
 		},
 	}
 
-	t.tracer.Trace(evt)
+	t.trace(evt, tt)
 }
 
 func (t *pubsubTracer) DeliverMessage(msg *Message) {
@@ -168,17 +268,22 @@ func (t *pubsubTracer) DeliverMessage(msg *Message) {
 		return
 	}
 
+	tt := t.topicTracer(msg.GetTopic())
+
 	if msg.ReceivedFrom != t.pid {
-		for _, tr := range t.raw {
+		for _, tr := range t.rawTracers() {
 			tr.DeliverMessage(msg)
 		}
+		if tt.raw != nil {
+			tt.raw.DeliverMessage(msg)
+		}
 	}
 
-	if t.tracer == nil {
+	if t.tracer == nil && tt.event == nil {
 		return
 	}
 
-	now := time.Now().UnixNano()
+	now := t.clock.Now().UnixNano()
 	evt := &pb.TraceEvent{
 		Type:      pb.TraceEvent_DELIVER_MESSAGE.Enum(),
 		PeerID:    []byte(t.pid),
@@ -190,7 +295,7 @@ func (t *pubsubTracer) DeliverMessage(msg *Message) {
 		},
 	}
 
-	t.tracer.Trace(evt)
+	t.trace(evt, tt)
 }
 
 func (t *pubsubTracer) AddPeer(p peer.ID, proto protocol.ID) {
@@ -198,7 +303,7 @@ func (t *pubsubTracer) AddPeer(p peer.ID, proto protocol.ID) {
 		return
 	}
 
-	for _, tr := range t.raw {
+	for _, tr := range t.rawTracers() {
 		tr.AddPeer(p, proto)
 	}
 
@@ -207,7 +312,7 @@ func (t *pubsubTracer) AddPeer(p peer.ID, proto protocol.ID) {
 	}
 
 	protoStr := string(proto)
-	now := time.Now().UnixNano()
+	now := t.clock.Now().UnixNano()
 	evt := &pb.TraceEvent{
 		Type:      pb.TraceEvent_ADD_PEER.Enum(),
 		PeerID:    []byte(t.pid),
@@ -226,7 +331,7 @@ func (t *pubsubTracer) RemovePeer(p peer.ID) {
 		return
 	}
 
-	for _, tr := range t.raw {
+	for _, tr := range t.rawTracers() {
 		tr.RemovePeer(p)
 	}
 
@@ -234,7 +339,7 @@ func (t *pubsubTracer) RemovePeer(p peer.ID) {
 		return
 	}
 
-	now := time.Now().UnixNano()
+	now := t.clock.Now().UnixNano()
 	evt := &pb.TraceEvent{
 		Type:      pb.TraceEvent_REMOVE_PEER.Enum(),
 		PeerID:    []byte(t.pid),
@@ -252,7 +357,7 @@ func (t *pubsubTracer) RecvRPC(rpc *RPC) {
 		return
 	}
 
-	for _, tr := range t.raw {
+	for _, tr := range t.rawTracers() {
 		tr.RecvRPC(rpc)
 	}
 
@@ -260,7 +365,7 @@ func (t *pubsubTracer) RecvRPC(rpc *RPC) {
 		return
 	}
 
-	now := time.Now().UnixNano()
+	now := t.clock.Now().UnixNano()
 	evt := &pb.TraceEvent{
 		Type:      pb.TraceEvent_RECV_RPC.Enum(),
 		PeerID:    []byte(t.pid),
@@ -279,7 +384,7 @@ func (t *pubsubTracer) SendRPC(rpc *RPC, p peer.ID) {
 		return
 	}
 
-	for _, tr := range t.raw {
+	for _, tr := range t.rawTracers() {
 		tr.SendRPC(rpc, p)
 	}
 
@@ -287,7 +392,7 @@ func (t *pubsubTracer) SendRPC(rpc *RPC, p peer.ID) {
 		return
 	}
 
-	now := time.Now().UnixNano()
+	now := t.clock.Now().UnixNano()
 	evt := &pb.TraceEvent{
 		Type:      pb.TraceEvent_SEND_RPC.Enum(),
 		PeerID:    []byte(t.pid),
@@ -306,7 +411,7 @@ func (t *pubsubTracer) DropRPC(rpc *RPC, p peer.ID) {
 		return
 	}
 
-	for _, tr := range t.raw {
+	for _, tr := range t.rawTracers() {
 		tr.DropRPC(rpc, p)
 	}
 
@@ -314,7 +419,7 @@ func (t *pubsubTracer) DropRPC(rpc *RPC, p peer.ID) {
 		return
 	}
 
-	now := time.Now().UnixNano()
+	now := t.clock.Now().UnixNano()
 	evt := &pb.TraceEvent{
 		Type:      pb.TraceEvent_DROP_RPC.Enum(),
 		PeerID:    []byte(t.pid),
@@ -324,6 +429,9 @@ func (t *pubsubTracer) DropRPC(rpc *RPC, p peer.ID) {
 			Meta:   t.traceRPCMeta(rpc),
 		},
 	}
+	if topic, ok := rpcTopic(rpc); ok {
+		evt.DropRPC.Topic = &topic
+	}
 
 	t.tracer.Trace(evt)
 }
@@ -333,18 +441,23 @@ func (t *pubsubTracer) UndeliverableMessage(msg *Message) {
 		return
 	}
 
-	for _, tr := range t.raw {
+	tt := t.topicTracer(msg.GetTopic())
+
+	for _, tr := range t.rawTracers() {
 		tr.UndeliverableMessage(msg)
 	}
+	if tt.raw != nil {
+		tt.raw.UndeliverableMessage(msg)
+	}
 }
 
 func (t *pubsubTracer) traceRPCMeta(rpc *RPC) *pb.TraceEvent_RPCMeta {
 	rpcMeta := new(pb.TraceEvent_RPCMeta)
 
 	var msgs []*pb.TraceEvent_MessageMeta
-	for _, m := range rpc.Publish {
+	for i, m := range rpc.Publish {
 		msgs = append(msgs, &pb.TraceEvent_MessageMeta{
-			MessageID: []byte(t.idGen.RawID(m)),
+			MessageID: []byte(t.idGen.RPCMessageID(rpc, i)),
 			Topic:     m.Topic,
 		})
 	}
@@ -418,15 +531,20 @@ func (t *pubsubTracer) Join(topic string) {
 		return
 	}
 
-	for _, tr := range t.raw {
+	tt := t.topicTracer(topic)
+
+	for _, tr := range t.rawTracers() {
 		tr.Join(topic)
 	}
+	if tt.raw != nil {
+		tt.raw.Join(topic)
+	}
 
-	if t.tracer == nil {
+	if t.tracer == nil && tt.event == nil {
 		return
 	}
 
-	now := time.Now().UnixNano()
+	now := t.clock.Now().UnixNano()
 	evt := &pb.TraceEvent{
 		Type:      pb.TraceEvent_JOIN.Enum(),
 		PeerID:    []byte(t.pid),
@@ -436,7 +554,7 @@ func (t *pubsubTracer) Join(topic string) {
 		},
 	}
 
-	t.tracer.Trace(evt)
+	t.trace(evt, tt)
 }
 
 func (t *pubsubTracer) Leave(topic string) {
@@ -444,15 +562,20 @@ func (t *pubsubTracer) Leave(topic string) {
 		return
 	}
 
-	for _, tr := range t.raw {
+	tt := t.topicTracer(topic)
+
+	for _, tr := range t.rawTracers() {
 		tr.Leave(topic)
 	}
+	if tt.raw != nil {
+		tt.raw.Leave(topic)
+	}
 
-	if t.tracer == nil {
+	if t.tracer == nil && tt.event == nil {
 		return
 	}
 
-	now := time.Now().UnixNano()
+	now := t.clock.Now().UnixNano()
 	evt := &pb.TraceEvent{
 		Type:      pb.TraceEvent_LEAVE.Enum(),
 		PeerID:    []byte(t.pid),
@@ -462,7 +585,7 @@ func (t *pubsubTracer) Leave(topic string) {
 		},
 	}
 
-	t.tracer.Trace(evt)
+	t.trace(evt, tt)
 }
 
 func (t *pubsubTracer) Graft(p peer.ID, topic string) {
@@ -470,15 +593,20 @@ func (t *pubsubTracer) Graft(p peer.ID, topic string) {
 		return
 	}
 
-	for _, tr := range t.raw {
+	tt := t.topicTracer(topic)
+
+	for _, tr := range t.rawTracers() {
 		tr.Graft(p, topic)
 	}
+	if tt.raw != nil {
+		tt.raw.Graft(p, topic)
+	}
 
-	if t.tracer == nil {
+	if t.tracer == nil && tt.event == nil {
 		return
 	}
 
-	now := time.Now().UnixNano()
+	now := t.clock.Now().UnixNano()
 	evt := &pb.TraceEvent{
 		Type:      pb.TraceEvent_GRAFT.Enum(),
 		PeerID:    []byte(t.pid),
@@ -489,7 +617,7 @@ func (t *pubsubTracer) Graft(p peer.ID, topic string) {
 		},
 	}
 
-	t.tracer.Trace(evt)
+	t.trace(evt, tt)
 }
 
 func (t *pubsubTracer) Prune(p peer.ID, topic string) {
@@ -497,15 +625,20 @@ func (t *pubsubTracer) Prune(p peer.ID, topic string) {
 		return
 	}
 
-	for _, tr := range t.raw {
+	tt := t.topicTracer(topic)
+
+	for _, tr := range t.rawTracers() {
 		tr.Prune(p, topic)
 	}
+	if tt.raw != nil {
+		tt.raw.Prune(p, topic)
+	}
 
-	if t.tracer == nil {
+	if t.tracer == nil && tt.event == nil {
 		return
 	}
 
-	now := time.Now().UnixNano()
+	now := t.clock.Now().UnixNano()
 	evt := &pb.TraceEvent{
 		Type:      pb.TraceEvent_PRUNE.Enum(),
 		PeerID:    []byte(t.pid),
@@ -516,7 +649,151 @@ func (t *pubsubTracer) Prune(p peer.ID, topic string) {
 		},
 	}
 
-	t.tracer.Trace(evt)
+	t.trace(evt, tt)
+}
+
+func (t *pubsubTracer) SubscriptionLimitExceeded(p peer.ID, reason string) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if slt, ok := tr.(SubscriptionLimitTracer); ok {
+			slt.SubscriptionLimitExceeded(p, reason)
+		}
+	}
+}
+
+func (t *pubsubTracer) RPCLimitExceeded(p peer.ID, size int, reason string) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if rlt, ok := tr.(RPCLimitTracer); ok {
+			rlt.RPCLimitExceeded(p, size, reason)
+		}
+	}
+}
+
+func (t *pubsubTracer) RejectRPC(p peer.ID, reason string) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if it, ok := tr.(RPCInspectorTracer); ok {
+			it.RejectRPC(p, reason)
+		}
+	}
+}
+
+func (t *pubsubTracer) RejectGraft(p peer.ID, topic string, reason string) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if gt, ok := tr.(GraftAuthorizerTracer); ok {
+			gt.RejectGraft(p, topic, reason)
+		}
+	}
+}
+
+func (t *pubsubTracer) BandwidthCapExceeded(p peer.ID, skipped []*pb.Message) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if bct, ok := tr.(BandwidthCapTracer); ok {
+			bct.BandwidthCapExceeded(p, skipped)
+		}
+	}
+}
+
+func (t *pubsubTracer) DiscoveryAttempt(topic string) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if dt, ok := tr.(DiscoveryTracer); ok {
+			dt.DiscoveryAttempt(topic)
+		}
+	}
+}
+
+func (t *pubsubTracer) DiscoveryResult(topic string, found int, err error) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if dt, ok := tr.(DiscoveryTracer); ok {
+			dt.DiscoveryResult(topic, found, err)
+		}
+	}
+}
+
+func (t *pubsubTracer) SubscriptionFiltered(p peer.ID, topic string, reason error) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if sft, ok := tr.(SubscriptionFilterTracer); ok {
+			sft.SubscriptionFiltered(p, topic, reason)
+		}
+	}
+}
+
+func (t *pubsubTracer) IPBlocked(p peer.ID, addr ma.Multiaddr) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if ibt, ok := tr.(IPBlockListTracer); ok {
+			ibt.IPBlocked(p, addr)
+		}
+	}
+}
+
+func (t *pubsubTracer) BlacklistChanged(evt BlacklistEvent) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if bt, ok := tr.(BlacklistTracer); ok {
+			bt.BlacklistChanged(evt)
+		}
+	}
+}
+
+func (t *pubsubTracer) AutoBlacklisted(p peer.ID, rule BlacklistRule) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if abt, ok := tr.(AutoBlacklistTracer); ok {
+			abt.AutoBlacklisted(p, rule)
+		}
+	}
+}
+
+func (t *pubsubTracer) DuplicateRatioExceeded(p peer.ID, topic string, ratio float64) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if dst, ok := tr.(DuplicateStatsTracer); ok {
+			dst.DuplicateRatioExceeded(p, topic, ratio)
+		}
+	}
 }
 
 func (t *pubsubTracer) ThrottlePeer(p peer.ID) {
@@ -524,7 +801,96 @@ func (t *pubsubTracer) ThrottlePeer(p peer.ID) {
 		return
 	}
 
-	for _, tr := range t.raw {
+	for _, tr := range t.rawTracers() {
 		tr.ThrottlePeer(p)
 	}
 }
+
+func (t *pubsubTracer) ThrottlePeerTopic(p peer.ID, topic string) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if pgt, ok := tr.(PeerGaterTracer); ok {
+			pgt.ThrottlePeerTopic(p, topic)
+		}
+	}
+
+	if t.tracer == nil {
+		return
+	}
+
+	now := t.clock.Now().UnixNano()
+	evt := &pb.TraceEvent{
+		Type:      pb.TraceEvent_THROTTLE_PEER.Enum(),
+		PeerID:    []byte(t.pid),
+		Timestamp: &now,
+		ThrottlePeer: &pb.TraceEvent_ThrottlePeer{
+			PeerID: []byte(p),
+			Topic:  &topic,
+		},
+	}
+
+	t.tracer.Trace(evt)
+}
+
+func (t *pubsubTracer) EventProcessed(kind EventKind, depth int, took time.Duration) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if elt, ok := tr.(EventLoopTracer); ok {
+			elt.EventProcessed(kind, depth, took)
+		}
+	}
+}
+
+func (t *pubsubTracer) WorkShed(kind ShedKind, from peer.ID, count int) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if elt, ok := tr.(EventLoopTracer); ok {
+			elt.WorkShed(kind, from, count)
+		}
+	}
+}
+
+func (t *pubsubTracer) PeerCongested(p peer.ID, drops int) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if ct, ok := tr.(CongestionTracer); ok {
+			ct.PeerCongested(p, drops)
+		}
+	}
+}
+
+func (t *pubsubTracer) SlowPeer(p peer.ID, d time.Duration) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if st, ok := tr.(SlowPeerTracer); ok {
+			st.SlowPeer(p, d)
+		}
+	}
+}
+
+func (t *pubsubTracer) NotPropagated(msg *Message, window time.Duration) {
+	if t == nil {
+		return
+	}
+
+	for _, tr := range t.rawTracers() {
+		if wt, ok := tr.(PublishWatchTracer); ok {
+			wt.NotPropagated(msg, window)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package pubsub
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// TraceType is the type of a trace event, named as in the protobuf encoding of the traces.
+type TraceType string
+
+const (
+	TracePublishMessage   TraceType = "PUBLISH_MESSAGE"
+	TraceRejectMessage    TraceType = "REJECT_MESSAGE"
+	TraceDuplicateMessage TraceType = "DUPLICATE_MESSAGE"
+	TraceDeliverMessage   TraceType = "DELIVER_MESSAGE"
+	TraceAddPeer          TraceType = "ADD_PEER"
+	TraceRemovePeer       TraceType = "REMOVE_PEER"
+	TraceRecvRPC          TraceType = "RECV_RPC"
+	TraceSendRPC          TraceType = "SEND_RPC"
+	TraceDropRPC          TraceType = "DROP_RPC"
+	TraceJoin             TraceType = "JOIN"
+	TraceLeave            TraceType = "LEAVE"
+	TraceGraft            TraceType = "GRAFT"
+	TracePrune            TraceType = "PRUNE"
+	TraceThrottlePeer     TraceType = "THROTTLE_PEER"
+)
+
+// TraceRecord is a trace event with idiomatic types, which doesn't change with the protobuf
+// encoding of the traces. Only the fields of the events of its Type are set.
+type TraceRecord struct {
+	Type TraceType `json:"type"`
+	// PeerID is the tracing peer.
+	PeerID    peer.ID   `json:"peerID"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// MessageID is the ID of the message of the PUBLISH_MESSAGE, REJECT_MESSAGE,
+	// DUPLICATE_MESSAGE and DELIVER_MESSAGE events. Message IDs are arbitrary bytes, so they
+	// are base64 encoded in JSON.
+	MessageID []byte `json:"messageID,omitempty"`
+	// Topic is the topic of the message, JOIN, LEAVE, GRAFT, PRUNE and THROTTLE_PEER events,
+	// and of the messages of the DROP_RPC events if they are all of the same topic.
+	Topic string `json:"topic,omitempty"`
+	// ReceivedFrom is the peer which sent the message of the REJECT_MESSAGE, DUPLICATE_MESSAGE
+	// and DELIVER_MESSAGE events, and the RPC of the RECV_RPC events.
+	ReceivedFrom peer.ID `json:"receivedFrom,omitempty"`
+	// Reason is the rejection reason of the REJECT_MESSAGE events.
+	Reason string `json:"reason,omitempty"`
+	// Peer is the peer of the ADD_PEER, REMOVE_PEER, GRAFT, PRUNE and THROTTLE_PEER events, and
+	// the recipient of the RPC of the SEND_RPC and DROP_RPC events.
+	Peer peer.ID `json:"peer,omitempty"`
+	// Protocol is the protocol of the ADD_PEER events.
+	Protocol protocol.ID `json:"protocol,omitempty"`
+	// RPC is the RPC of the RECV_RPC, SEND_RPC and DROP_RPC events.
+	RPC *TraceRPC `json:"rpc,omitempty"`
+}
+
+// TraceRPC is the content of a traced RPC, without the message payloads.
+type TraceRPC struct {
+	Messages      []TraceMessageMeta `json:"messages,omitempty"`
+	Subscriptions []TraceSubMeta     `json:"subscriptions,omitempty"`
+	Control       *TraceControlMeta  `json:"control,omitempty"`
+}
+
+// TraceMessageMeta is a message of a traced RPC.
+type TraceMessageMeta struct {
+	MessageID []byte `json:"messageID"`
+	Topic     string `json:"topic"`
+}
+
+// TraceSubMeta is a subscription of a traced RPC.
+type TraceSubMeta struct {
+	Subscribe bool   `json:"subscribe"`
+	Topic     string `json:"topic"`
+}
+
+// TraceControlMeta is the control message of a traced RPC.
+type TraceControlMeta struct {
+	IHave []TraceIHaveMeta `json:"ihave,omitempty"`
+	IWant []TraceIWantMeta `json:"iwant,omitempty"`
+	Graft []TraceGraftMeta `json:"graft,omitempty"`
+	Prune []TracePruneMeta `json:"prune,omitempty"`
+}
+
+// TraceIHaveMeta is an IHAVE of a traced RPC.
+type TraceIHaveMeta struct {
+	Topic      string   `json:"topic"`
+	MessageIDs [][]byte `json:"messageIDs"`
+}
+
+// TraceIWantMeta is an IWANT of a traced RPC.
+type TraceIWantMeta struct {
+	MessageIDs [][]byte `json:"messageIDs"`
+}
+
+// TraceGraftMeta is a GRAFT of a traced RPC.
+type TraceGraftMeta struct {
+	Topic string `json:"topic"`
+}
+
+// TracePruneMeta is a PRUNE of a traced RPC, with the peers it exchanges.
+type TracePruneMeta struct {
+	Topic string    `json:"topic"`
+	Peers []peer.ID `json:"peers,omitempty"`
+}
+
+// FromPB sets the record from a trace event in its protobuf encoding.
+func (r *TraceRecord) FromPB(evt *pb.TraceEvent) error {
+	typ, ok := pb.TraceEvent_Type_name[int32(evt.GetType())]
+	if !ok || evt.Type == nil {
+		return fmt.Errorf("unknown trace event type %d", evt.GetType())
+	}
+
+	*r = TraceRecord{
+		Type:   TraceType(typ),
+		PeerID: peer.ID(evt.GetPeerID()),
+	}
+	if evt.Timestamp != nil {
+		r.Timestamp = time.Unix(0, evt.GetTimestamp()).UTC()
+	}
+
+	switch evt.GetType() {
+	case pb.TraceEvent_PUBLISH_MESSAGE:
+		e := evt.GetPublishMessage()
+		r.MessageID = bytes.Clone(e.GetMessageID())
+		r.Topic = e.GetTopic()
+	case pb.TraceEvent_REJECT_MESSAGE:
+		e := evt.GetRejectMessage()
+		r.MessageID = bytes.Clone(e.GetMessageID())
+		r.ReceivedFrom = peer.ID(e.GetReceivedFrom())
+		r.Reason = e.GetReason()
+		r.Topic = e.GetTopic()
+	case pb.TraceEvent_DUPLICATE_MESSAGE:
+		e := evt.GetDuplicateMessage()
+		r.MessageID = bytes.Clone(e.GetMessageID())
+		r.ReceivedFrom = peer.ID(e.GetReceivedFrom())
+		r.Topic = e.GetTopic()
+	case pb.TraceEvent_DELIVER_MESSAGE:
+		e := evt.GetDeliverMessage()
+		r.MessageID = bytes.Clone(e.GetMessageID())
+		r.Topic = e.GetTopic()
+		r.ReceivedFrom = peer.ID(e.GetReceivedFrom())
+	case pb.TraceEvent_ADD_PEER:
+		e := evt.GetAddPeer()
+		r.Peer = peer.ID(e.GetPeerID())
+		r.Protocol = protocol.ID(e.GetProto())
+	case pb.TraceEvent_REMOVE_PEER:
+		r.Peer = peer.ID(evt.GetRemovePeer().GetPeerID())
+	case pb.TraceEvent_RECV_RPC:
+		e := evt.GetRecvRPC()
+		r.ReceivedFrom = peer.ID(e.GetReceivedFrom())
+		r.RPC = traceRPCFromPB(e.GetMeta())
+	case pb.TraceEvent_SEND_RPC:
+		e := evt.GetSendRPC()
+		r.Peer = peer.ID(e.GetSendTo())
+		r.RPC = traceRPCFromPB(e.GetMeta())
+	case pb.TraceEvent_DROP_RPC:
+		e := evt.GetDropRPC()
+		r.Peer = peer.ID(e.GetSendTo())
+		r.Topic = e.GetTopic()
+		r.RPC = traceRPCFromPB(e.GetMeta())
+	case pb.TraceEvent_JOIN:
+		r.Topic = evt.GetJoin().GetTopic()
+	case pb.TraceEvent_LEAVE:
+		r.Topic = evt.GetLeave().GetTopic()
+	case pb.TraceEvent_GRAFT:
+		e := evt.GetGraft()
+		r.Peer = peer.ID(e.GetPeerID())
+		r.Topic = e.GetTopic()
+	case pb.TraceEvent_PRUNE:
+		e := evt.GetPrune()
+		r.Peer = peer.ID(e.GetPeerID())
+		r.Topic = e.GetTopic()
+	case pb.TraceEvent_THROTTLE_PEER:
+		e := evt.GetThrottlePeer()
+		r.Peer = peer.ID(e.GetPeerID())
+		r.Topic = e.GetTopic()
+	}
+
+	return nil
+}
+
+// ToPB returns the protobuf encoding of the record.
+func (r *TraceRecord) ToPB() (*pb.TraceEvent, error) {
+	typ, ok := pb.TraceEvent_Type_value[string(r.Type)]
+	if !ok {
+		return nil, fmt.Errorf("unknown trace event type %q", r.Type)
+	}
+
+	evt := &pb.TraceEvent{Type: pb.TraceEvent_Type(typ).Enum()}
+	if r.PeerID != "" {
+		evt.PeerID = []byte(r.PeerID)
+	}
+	if !r.Timestamp.IsZero() {
+		ts := r.Timestamp.UnixNano()
+		evt.Timestamp = &ts
+	}
+
+	// the strings are copied, as the event points to them
+	topic, reason, proto := r.Topic, r.Reason, string(r.Protocol)
+
+	switch r.Type {
+	case TracePublishMessage:
+		evt.PublishMessage = &pb.TraceEvent_PublishMessage{
+			MessageID: r.MessageID,
+			Topic:     &topic,
+		}
+	case TraceRejectMessage:
+		evt.RejectMessage = &pb.TraceEvent_RejectMessage{
+			MessageID:    []byte(r.MessageID),
+			ReceivedFrom: []byte(r.ReceivedFrom),
+			Reason:       &reason,
+			Topic:        &topic,
+		}
+	case TraceDuplicateMessage:
+		evt.DuplicateMessage = &pb.TraceEvent_DuplicateMessage{
+			MessageID:    []byte(r.MessageID),
+			ReceivedFrom: []byte(r.ReceivedFrom),
+			Topic:        &topic,
+		}
+	case TraceDeliverMessage:
+		evt.DeliverMessage = &pb.TraceEvent_DeliverMessage{
+			MessageID:    []byte(r.MessageID),
+			Topic:        &topic,
+			ReceivedFrom: []byte(r.ReceivedFrom),
+		}
+	case TraceAddPeer:
+		evt.AddPeer = &pb.TraceEvent_AddPeer{
+			PeerID: []byte(r.Peer),
+			Proto:  &proto,
+		}
+	case TraceRemovePeer:
+		evt.RemovePeer = &pb.TraceEvent_RemovePeer{
+			PeerID: []byte(r.Peer),
+		}
+	case TraceRecvRPC:
+		evt.RecvRPC = &pb.TraceEvent_RecvRPC{
+			ReceivedFrom: []byte(r.ReceivedFrom),
+			Meta:         r.RPC.toPB(),
+		}
+	case TraceSendRPC:
+		evt.SendRPC = &pb.TraceEvent_SendRPC{
+			SendTo: []byte(r.Peer),
+			Meta:   r.RPC.toPB(),
+		}
+	case TraceDropRPC:
+		evt.DropRPC = &pb.TraceEvent_DropRPC{
+			SendTo: []byte(r.Peer),
+			Meta:   r.RPC.toPB(),
+		}
+		if r.Topic != "" {
+			evt.DropRPC.Topic = &topic
+		}
+	case TraceJoin:
+		evt.Join = &pb.TraceEvent_Join{Topic: &topic}
+	case TraceLeave:
+		evt.Leave = &pb.TraceEvent_Leave{Topic: &topic}
+	case TraceGraft:
+		evt.Graft = &pb.TraceEvent_Graft{
+			PeerID: []byte(r.Peer),
+			Topic:  &topic,
+		}
+	case TracePrune:
+		evt.Prune = &pb.TraceEvent_Prune{
+			PeerID: []byte(r.Peer),
+			Topic:  &topic,
+		}
+	case TraceThrottlePeer:
+		evt.ThrottlePeer = &pb.TraceEvent_ThrottlePeer{
+			PeerID: []byte(r.Peer),
+			Topic:  &topic,
+		}
+	}
+
+	return evt, nil
+}
+
+func traceRPCFromPB(meta *pb.TraceEvent_RPCMeta) *TraceRPC {
+	if meta == nil {
+		return nil
+	}
+
+	rpc := new(TraceRPC)
+	for _, m := range meta.GetMessages() {
+		rpc.Messages = append(rpc.Messages, TraceMessageMeta{
+			MessageID: bytes.Clone(m.GetMessageID()),
+			Topic:     m.GetTopic(),
+		})
+	}
+	for _, sub := range meta.GetSubscription() {
+		rpc.Subscriptions = append(rpc.Subscriptions, TraceSubMeta{
+			Subscribe: sub.GetSubscribe(),
+			Topic:     sub.GetTopic(),
+		})
+	}
+
+	ctl := meta.GetControl()
+	if ctl == nil {
+		return rpc
+	}
+	rpc.Control = new(TraceControlMeta)
+	for _, ihave := range ctl.GetIhave() {
+		rpc.Control.IHave = append(rpc.Control.IHave, TraceIHaveMeta{
+			Topic:      ihave.GetTopic(),
+			MessageIDs: cloneIDs(ihave.GetMessageIDs()),
+		})
+	}
+	for _, iwant := range ctl.GetIwant() {
+		rpc.Control.IWant = append(rpc.Control.IWant, TraceIWantMeta{
+			MessageIDs: cloneIDs(iwant.GetMessageIDs()),
+		})
+	}
+	for _, graft := range ctl.GetGraft() {
+		rpc.Control.Graft = append(rpc.Control.Graft, TraceGraftMeta{Topic: graft.GetTopic()})
+	}
+	for _, prune := range ctl.GetPrune() {
+		var peers []peer.ID
+		for _, p := range prune.GetPeers() {
+			peers = append(peers, peer.ID(p))
+		}
+		rpc.Control.Prune = append(rpc.Control.Prune, TracePruneMeta{
+			Topic: prune.GetTopic(),
+			Peers: peers,
+		})
+	}
+	return rpc
+}
+
+func (rpc *TraceRPC) toPB() *pb.TraceEvent_RPCMeta {
+	if rpc == nil {
+		return nil
+	}
+
+	meta := new(pb.TraceEvent_RPCMeta)
+	for _, m := range rpc.Messages {
+		topic := m.Topic
+		meta.Messages = append(meta.Messages, &pb.TraceEvent_MessageMeta{
+			MessageID: m.MessageID,
+			Topic:     &topic,
+		})
+	}
+	for _, sub := range rpc.Subscriptions {
+		subscribe, topic := sub.Subscribe, sub.Topic
+		meta.Subscription = append(meta.Subscription, &pb.TraceEvent_SubMeta{
+			Subscribe: &subscribe,
+			Topic:     &topic,
+		})
+	}
+
+	if rpc.Control == nil {
+		return meta
+	}
+	meta.Control = new(pb.TraceEvent_ControlMeta)
+	for _, ihave := range rpc.Control.IHave {
+		topic := ihave.Topic
+		meta.Control.Ihave = append(meta.Control.Ihave, &pb.TraceEvent_ControlIHaveMeta{
+			Topic:      &topic,
+			MessageIDs: ihave.MessageIDs,
+		})
+	}
+	for _, iwant := range rpc.Control.IWant {
+		meta.Control.Iwant = append(meta.Control.Iwant, &pb.TraceEvent_ControlIWantMeta{
+			MessageIDs: iwant.MessageIDs,
+		})
+	}
+	for _, graft := range rpc.Control.Graft {
+		topic := graft.Topic
+		meta.Control.Graft = append(meta.Control.Graft, &pb.TraceEvent_ControlGraftMeta{Topic: &topic})
+	}
+	for _, prune := range rpc.Control.Prune {
+		topic := prune.Topic
+		var peers [][]byte
+		for _, p := range prune.Peers {
+			peers = append(peers, []byte(p))
+		}
+		meta.Control.Prune = append(meta.Control.Prune, &pb.TraceEvent_ControlPruneMeta{
+			Topic: &topic,
+			Peers: peers,
+		})
+	}
+	return meta
+}
+
+// cloneIDs copies message IDs out of a trace event
+func cloneIDs(ids [][]byte) [][]byte {
+	var out [][]byte
+	for _, id := range ids {
+		out = append(out, bytes.Clone(id))
+	}
+	return out
+}
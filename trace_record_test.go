@@ -0,0 +1,172 @@
+package pubsub
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/test"
+)
+
+// traceRecordEvents returns an event of every type, with all their fields set
+func traceRecordEvents(t *testing.T) []*pb.TraceEvent {
+	self, p1, p2 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	now := time.Now().UnixNano()
+	topic, reason, proto, subscribe := "topic", RejectValidationFailed, "/meshsub/1.1.0", true
+	// the default message IDs are binary, and not valid UTF-8
+	mid := []byte(DefaultMsgIdFn(&pb.Message{From: []byte(p1), Seqno: []byte{0xff, 0xfe, 0x00, 0x80}}))
+
+	meta := &pb.TraceEvent_RPCMeta{
+		Messages:     []*pb.TraceEvent_MessageMeta{{MessageID: mid, Topic: &topic}},
+		Subscription: []*pb.TraceEvent_SubMeta{{Subscribe: &subscribe, Topic: &topic}},
+		Control: &pb.TraceEvent_ControlMeta{
+			Ihave: []*pb.TraceEvent_ControlIHaveMeta{{Topic: &topic, MessageIDs: [][]byte{mid, []byte("other")}}},
+			Iwant: []*pb.TraceEvent_ControlIWantMeta{{MessageIDs: [][]byte{mid}}},
+			Graft: []*pb.TraceEvent_ControlGraftMeta{{Topic: &topic}},
+			Prune: []*pb.TraceEvent_ControlPruneMeta{{Topic: &topic, Peers: [][]byte{[]byte(p2)}}},
+		},
+	}
+
+	events := []*pb.TraceEvent{
+		{PublishMessage: &pb.TraceEvent_PublishMessage{MessageID: mid, Topic: &topic}},
+		{RejectMessage: &pb.TraceEvent_RejectMessage{MessageID: mid, ReceivedFrom: []byte(p1), Reason: &reason, Topic: &topic}},
+		{DuplicateMessage: &pb.TraceEvent_DuplicateMessage{MessageID: mid, ReceivedFrom: []byte(p1), Topic: &topic}},
+		{DeliverMessage: &pb.TraceEvent_DeliverMessage{MessageID: mid, Topic: &topic, ReceivedFrom: []byte(p1)}},
+		{AddPeer: &pb.TraceEvent_AddPeer{PeerID: []byte(p1), Proto: &proto}},
+		{RemovePeer: &pb.TraceEvent_RemovePeer{PeerID: []byte(p1)}},
+		{RecvRPC: &pb.TraceEvent_RecvRPC{ReceivedFrom: []byte(p1), Meta: meta}},
+		{SendRPC: &pb.TraceEvent_SendRPC{SendTo: []byte(p1), Meta: meta}},
+		{DropRPC: &pb.TraceEvent_DropRPC{SendTo: []byte(p1), Meta: &pb.TraceEvent_RPCMeta{}, Topic: &topic}},
+		{Join: &pb.TraceEvent_Join{Topic: &topic}},
+		{Leave: &pb.TraceEvent_Leave{Topic: &topic}},
+		{Graft: &pb.TraceEvent_Graft{PeerID: []byte(p1), Topic: &topic}},
+		{Prune: &pb.TraceEvent_Prune{PeerID: []byte(p1), Topic: &topic}},
+		{ThrottlePeer: &pb.TraceEvent_ThrottlePeer{PeerID: []byte(p1), Topic: &topic}},
+	}
+	if len(events) != len(pb.TraceEvent_Type_name) {
+		t.Fatalf("expected an event of each of the %d types, got %d", len(pb.TraceEvent_Type_name), len(events))
+	}
+	for i, evt := range events {
+		evt.Type = pb.TraceEvent_Type(i).Enum()
+		evt.PeerID = []byte(self)
+		evt.Timestamp = &now
+	}
+	return events
+}
+
+func TestTraceRecordRoundTrip(t *testing.T) {
+	for _, evt := range traceRecordEvents(t) {
+		var r TraceRecord
+		if err := r.FromPB(evt); err != nil {
+			t.Fatal(err)
+		}
+		if string(r.Type) != evt.GetType().String() {
+			t.Fatalf("expected a %s record, got %s", evt.GetType(), r.Type)
+		}
+		if r.Timestamp.UnixNano() != evt.GetTimestamp() {
+			t.Fatalf("expected the timestamp of the event, got %s", r.Timestamp)
+		}
+
+		out, err := r.ToPB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(evt, out) {
+			t.Fatalf("%s event changed through a record:\n%s\n%s", evt.GetType(), evt, out)
+		}
+
+		// the records round-trip through JSON as well
+		data, err := json.Marshal(&r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded TraceRecord
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(r, decoded) {
+			t.Fatalf("%s record changed through JSON:\n%+v\n%+v", r.Type, r, decoded)
+		}
+	}
+
+	var r TraceRecord
+	if err := r.FromPB(&pb.TraceEvent{}); err == nil {
+		t.Fatal("expected an event without type to fail")
+	}
+	if _, err := (&TraceRecord{Type: "UNKNOWN"}).ToPB(); err == nil {
+		t.Fatal("expected a record of unknown type to fail")
+	}
+}
+
+func TestHumanReadableJSONTracer(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "trace.json")
+	tracer, err := NewJSONTracer(file, WithHumanReadableJSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := traceRecordEvents(t)
+	for _, evt := range events {
+		tracer.Trace(evt)
+	}
+	tracer.Close()
+
+	// the file is closed once the events are written
+	var lines []string
+	for start := time.Now(); len(lines) < len(events) && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = lines[:0]
+		for scanner := bufio.NewScanner(f); scanner.Scan(); {
+			lines = append(lines, scanner.Text())
+		}
+		f.Close()
+	}
+	if len(lines) != len(events) {
+		t.Fatalf("expected %d events, got %d", len(events), len(lines))
+	}
+
+	for i, line := range lines {
+		var raw struct {
+			Type      string `json:"type"`
+			PeerID    string `json:"peerID"`
+			Timestamp string `json:"timestamp"`
+		}
+		if err := json.Unmarshal([]byte(line), &raw); err != nil {
+			t.Fatal(err)
+		}
+		if raw.Type != events[i].GetType().String() {
+			t.Fatalf("expected a %s event, got %s", events[i].GetType(), raw.Type)
+		}
+		if raw.PeerID != peer.ID(events[i].GetPeerID()).String() {
+			t.Fatalf("expected a base58 peer ID, got %s", raw.PeerID)
+		}
+		if _, err := time.Parse(time.RFC3339, raw.Timestamp); err != nil {
+			t.Fatalf("expected an RFC 3339 timestamp: %s", err)
+		}
+
+		var r TraceRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatal(err)
+		}
+		out, err := r.ToPB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(events[i], out) {
+			t.Fatalf("%s event changed through the tracer:\n%s\n%s", events[i].GetType(), events[i], out)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -321,3 +322,134 @@ func TestRemoteTracer(t *testing.T) {
 
 	mrt.check(t)
 }
+
+type deliveryCountingTracer struct {
+	noopRawTracer
+	delivered atomic.Int32
+}
+
+func (t *deliveryCountingTracer) DeliverMessage(msg *Message) {
+	t.delivered.Add(1)
+}
+
+func TestAddRemoveRawTracer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getGossipsubs(ctx, hosts)
+	sub := mustSubscribe(t, psubs[1], "test")
+	connect(t, hosts[0], hosts[1])
+	time.Sleep(time.Second)
+
+	publish := func(data string) {
+		t.Helper()
+		if err := psubs[0].Publish("test", []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		assertReceive(t, sub, []byte(data))
+	}
+
+	// the tracer sees the events emitted once it's added
+	publish("before")
+	tracer := &deliveryCountingTracer{}
+	if err := psubs[1].AddRawTracer(tracer); err != nil {
+		t.Fatal(err)
+	}
+	publish("added")
+	if n := tracer.delivered.Load(); n != 1 {
+		t.Fatalf("expected 1 delivery to be traced, got %d", n)
+	}
+
+	// and none once it's removed
+	if err := psubs[1].RemoveRawTracer(tracer); err != nil {
+		t.Fatal(err)
+	}
+	publish("removed")
+	if n := tracer.delivered.Load(); n != 1 {
+		t.Fatalf("expected no delivery to be traced after removal, got %d", n)
+	}
+
+	if err := psubs[1].RemoveRawTracer(tracer); err != ErrRawTracerNotFound {
+		t.Fatalf("expected ErrRawTracerNotFound, got %v", err)
+	}
+}
+
+type topicEventTracer struct {
+	mx     sync.Mutex
+	events []*pb.TraceEvent
+}
+
+func (t *topicEventTracer) Trace(evt *pb.TraceEvent) {
+	t.mx.Lock()
+	t.events = append(t.events, evt)
+	t.mx.Unlock()
+}
+
+func TestTopicTracer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 2)
+	psubs := getGossipsubs(ctx, hosts)
+
+	if _, err := psubs[1].Join("a", WithTopicTracer(struct{}{})); err == nil {
+		t.Fatal("expected an error attaching something that isn't a tracer")
+	}
+
+	events := &topicEventTracer{}
+	a, err := psubs[1].Join("a", WithTopicTracer(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subA, err := a.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := &deliveryCountingTracer{}
+	b, err := psubs[1].Join("b", WithTopicTracer(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subB, err := b.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	connect(t, hosts[0], hosts[1])
+	mustSubscribe(t, psubs[0], "a")
+	mustSubscribe(t, psubs[0], "b")
+	time.Sleep(time.Second)
+
+	for _, sub := range []*Subscription{subA, subB, subB} {
+		if err := psubs[0].Publish(sub.Topic(), []byte("message")); err != nil {
+			t.Fatal(err)
+		}
+		assertReceive(t, sub, []byte("message"))
+	}
+
+	if n := raw.delivered.Load(); n != 2 {
+		t.Fatalf("expected 2 deliveries in b to be traced, got %d", n)
+	}
+
+	events.mx.Lock()
+	defer events.mx.Unlock()
+	kinds := make(map[pb.TraceEvent_Type]int)
+	for _, evt := range events.events {
+		kinds[evt.GetType()]++
+		switch evt.GetType() {
+		case pb.TraceEvent_DELIVER_MESSAGE:
+			if topic := evt.GetDeliverMessage().GetTopic(); topic != "a" {
+				t.Fatalf("expected only the deliveries in a, got one in %s", topic)
+			}
+		case pb.TraceEvent_GRAFT:
+			if topic := evt.GetGraft().GetTopic(); topic != "a" {
+				t.Fatalf("expected only the grafts in a, got one in %s", topic)
+			}
+		case pb.TraceEvent_ADD_PEER, pb.TraceEvent_RECV_RPC, pb.TraceEvent_SEND_RPC:
+			t.Fatalf("expected no event without a topic, got %s", evt.GetType())
+		}
+	}
+	if kinds[pb.TraceEvent_JOIN] != 1 || kinds[pb.TraceEvent_GRAFT] != 1 || kinds[pb.TraceEvent_DELIVER_MESSAGE] != 1 {
+		t.Fatalf("unexpected events traced in a: %v", kinds)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
@@ -36,14 +37,26 @@ const (
 	RejectValidationFailed    = "validation failed"
 	RejectValidationIgnored   = "validation ignored"
 	RejectSelfOrigin          = "self originated message"
+	RejectMessageTooLarge     = "message too large"
+	RejectMessageOpenFailed   = "message open failed"
+	RejectUnauthorizedAuthor  = "unauthorized author"
+	RejectValidationDeadline  = "validation deadline exceeded"
+	RejectMultipleTopics      = "multiple topics"
 )
 
+// LossyTracer is an optional interface for tracers which drop events when they can't keep up,
+// reporting the number of events dropped so far; it is checked by Health.
+type LossyTracer interface {
+	Dropped() uint64
+}
+
 type basicTracer struct {
-	ch     chan struct{}
-	mx     sync.Mutex
-	buf    []*pb.TraceEvent
-	lossy  bool
-	closed bool
+	ch      chan struct{}
+	mx      sync.Mutex
+	buf     []*pb.TraceEvent
+	lossy   bool
+	closed  bool
+	dropped atomic.Uint64
 }
 
 func (t *basicTracer) Trace(evt *pb.TraceEvent) {
@@ -56,6 +69,7 @@ func (t *basicTracer) Trace(evt *pb.TraceEvent) {
 
 	if t.lossy && len(t.buf) > TraceBufferSize {
 		log.Debug("trace buffer overflow; dropping trace event")
+		t.dropped.Add(1)
 	} else {
 		t.buf = append(t.buf, evt)
 	}
@@ -66,6 +80,11 @@ func (t *basicTracer) Trace(evt *pb.TraceEvent) {
 	}
 }
 
+// Dropped returns the number of events dropped on buffer overflow.
+func (t *basicTracer) Dropped() uint64 {
+	return t.dropped.Load()
+}
+
 func (t *basicTracer) Close() {
 	t.mx.Lock()
 	defer t.mx.Unlock()
@@ -79,21 +98,38 @@ func (t *basicTracer) Close() {
 type JSONTracer struct {
 	basicTracer
 	w io.WriteCloser
+
+	// human writes the events as TraceRecords
+	human bool
+}
+
+// JSONTracerOpt is an option of a JSONTracer.
+type JSONTracerOpt func(*JSONTracer)
+
+// WithHumanReadableJSON writes the events as TraceRecords, with base58 peer IDs, RFC 3339
+// timestamps and string message IDs, instead of the JSON encoding of their protobufs.
+func WithHumanReadableJSON() JSONTracerOpt {
+	return func(t *JSONTracer) {
+		t.human = true
+	}
 }
 
 // NewJsonTracer creates a new JSONTracer writing traces to file.
-func NewJSONTracer(file string) (*JSONTracer, error) {
-	return OpenJSONTracer(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+func NewJSONTracer(file string, opts ...JSONTracerOpt) (*JSONTracer, error) {
+	return OpenJSONTracer(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644, opts...)
 }
 
 // OpenJSONTracer creates a new JSONTracer, with explicit control of OpenFile flags and permissions.
-func OpenJSONTracer(file string, flags int, perm os.FileMode) (*JSONTracer, error) {
+func OpenJSONTracer(file string, flags int, perm os.FileMode, opts ...JSONTracerOpt) (*JSONTracer, error) {
 	f, err := os.OpenFile(file, flags, perm)
 	if err != nil {
 		return nil, err
 	}
 
 	tr := &JSONTracer{w: f, basicTracer: basicTracer{ch: make(chan struct{}, 1)}}
+	for _, opt := range opts {
+		opt(tr)
+	}
 	go tr.doWrite()
 
 	return tr, nil
@@ -112,7 +148,7 @@ func (t *JSONTracer) doWrite() {
 		t.mx.Unlock()
 
 		for i, evt := range buf {
-			err := enc.Encode(evt)
+			err := t.encode(enc, evt)
 			if err != nil {
 				log.Warnf("error writing event trace: %s", err.Error())
 			}
@@ -126,6 +162,18 @@ func (t *JSONTracer) doWrite() {
 	}
 }
 
+func (t *JSONTracer) encode(enc *json.Encoder, evt *pb.TraceEvent) error {
+	if !t.human {
+		return enc.Encode(evt)
+	}
+
+	var r TraceRecord
+	if err := r.FromPB(evt); err != nil {
+		return err
+	}
+	return enc.Encode(&r)
+}
+
 var _ EventTracer = (*JSONTracer)(nil)
 
 // PBTracer is a tracer that writes events to a file, as delimited protobufs.
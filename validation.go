@@ -2,20 +2,39 @@ package pubsub
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"runtime"
 	"sync"
 	"time"
 
+	"github.com/libp2p/go-libp2p-pubsub/timecache"
+
 	"github.com/libp2p/go-libp2p/core/peer"
 )
 
+// SignatureFailureCacheSize is the number of recent signature verification failures
+// retained, so that copies of an invalid message arriving from many peers are only verified once.
+var SignatureFailureCacheSize = 4096
+
 const (
 	defaultValidateQueueSize   = 32
 	defaultValidateConcurrency = 1024
 	defaultValidateThrottle    = 8192
 )
 
+var (
+	// ErrValidatorExists is returned when registering a validator for a topic which already has one.
+	ErrValidatorExists = errors.New("duplicate validator")
+
+	// ErrNoValidator is returned when unregistering the validator of a topic which has none.
+	ErrNoValidator = errors.New("no validator")
+
+	// ErrInvalidValidator is returned when registering a validator of an unknown type.
+	ErrInvalidValidator = errors.New("unknown validator type")
+)
+
 // ValidationError is an error that may be signalled from message publication when the message
 // fails validation
 type ValidationError struct {
@@ -48,7 +67,8 @@ const (
 	// ValidationReject, the peer that forwarded the message must not be penalized by peer scoring routers.
 	ValidationIgnore = ValidationResult(2)
 	// internal
-	validationThrottled = ValidationResult(-1)
+	validationThrottled        = ValidationResult(-1)
+	validationDeadlineExceeded = ValidationResult(-2)
 )
 
 // ValidatorOpt is an option for RegisterTopicValidator.
@@ -62,6 +82,8 @@ type ValidatorOpt func(addVal *addValReq) error
 // can also attach inline validators that will be executed
 // synchronously; this may be useful to prevent superfluous
 // context-switching for lightweight tasks.
+// Signatures are verified by a stage of their own ahead of the
+// validators, so that slow validators don't hold up verification.
 type validation struct {
 	p *PubSub
 
@@ -75,7 +97,10 @@ type validation struct {
 	// defaultVals tracks default validators applicable to all topics
 	defaultVals []*validatorImpl
 
-	// validateQ is the front-end to the validation pipeline
+	// verifyQ is the front-end to the signature verification stage
+	verifyQ chan *validateReq
+
+	// validateQ is the front-end to the validation stage
 	validateQ chan *validateReq
 
 	// validateThrottle limits the number of active validation goroutines
@@ -83,6 +108,15 @@ type validation struct {
 
 	// this is the number of synchronous validation workers
 	validateWorkers int
+
+	// this is the number of signature verification workers; with none, signatures are
+	// verified by the validation workers
+	verifyWorkers int
+
+	// badSigs caches recent signature verification failures, and badSigIDs the IDs of the
+	// failed messages
+	badSigs   *timecache.BoundedCache
+	badSigIDs *timecache.BoundedCache
 }
 
 // validation requests
@@ -90,6 +124,9 @@ type validateReq struct {
 	vals []*validatorImpl
 	src  peer.ID
 	msg  *Message
+
+	// whether the signature was verified already
+	verified bool
 }
 
 // representation of topic validators
@@ -121,9 +158,11 @@ type rmValReq struct {
 func newValidation() *validation {
 	return &validation{
 		topicVals:        make(map[string]*validatorImpl),
+		verifyQ:          make(chan *validateReq, defaultValidateQueueSize),
 		validateQ:        make(chan *validateReq, defaultValidateQueueSize),
 		validateThrottle: make(chan struct{}, defaultValidateThrottle),
 		validateWorkers:  runtime.NumCPU(),
+		verifyWorkers:    runtime.NumCPU(),
 	}
 }
 
@@ -132,6 +171,11 @@ func newValidation() *validation {
 func (v *validation) Start(p *PubSub) {
 	v.p = p
 	v.tracer = p.tracer
+	v.badSigs = timecache.NewBoundedCache(TimeCacheDuration, SignatureFailureCacheSize, p.clock.Now)
+	v.badSigIDs = timecache.NewBoundedCache(TimeCacheDuration, SignatureFailureCacheSize, p.clock.Now)
+	for i := 0; i < v.verifyWorkers; i++ {
+		go v.verifyWorker()
+	}
 	for i := 0; i < v.validateWorkers; i++ {
 		go v.validateWorker()
 	}
@@ -152,7 +196,7 @@ func (v *validation) AddValidator(req *addValReq) {
 
 	_, ok := v.topicVals[topic]
 	if ok {
-		req.resp <- fmt.Errorf("duplicate validator for topic %s", topic)
+		req.resp <- fmt.Errorf("%w for topic %s", ErrValidatorExists, topic)
 		return
 	}
 
@@ -188,7 +232,7 @@ func (v *validation) makeValidator(req *addValReq) (*validatorImpl, error) {
 		if req.topic == "" {
 			topic = "(default)"
 		}
-		return nil, fmt.Errorf("unknown validator type for topic %s; must be an instance of Validator or ValidatorEx", topic)
+		return nil, fmt.Errorf("%w for topic %s; must be an instance of Validator or ValidatorEx", ErrInvalidValidator, topic)
 	}
 
 	val := &validatorImpl{
@@ -222,7 +266,7 @@ func (v *validation) RemoveValidator(req *rmValReq) {
 		delete(v.topicVals, topic)
 		req.resp <- nil
 	} else {
-		req.resp <- fmt.Errorf("no validator for topic %s", topic)
+		req.resp <- fmt.Errorf("%w for topic %s", ErrNoValidator, topic)
 	}
 }
 
@@ -230,6 +274,7 @@ func (v *validation) RemoveValidator(req *rmValReq) {
 // validations.
 // Returns an error if validation fails
 func (v *validation) PushLocal(msg *Message) error {
+	msg.arrival = v.p.clock.Now()
 	v.p.tracer.PublishMessage(msg)
 
 	err := v.p.checkSigningPolicy(msg)
@@ -241,24 +286,46 @@ func (v *validation) PushLocal(msg *Message) error {
 	return v.validate(vals, msg.ReceivedFrom, msg, true)
 }
 
-// Push pushes a message into the validation pipeline.
+// Push pushes a message into the validation pipeline, validating it as the policy of its topic
+// requires.
 // It returns true if the message can be forwarded immediately without validation.
-func (v *validation) Push(src peer.ID, msg *Message) bool {
-	vals := v.getValidators(msg)
+func (v *validation) Push(src peer.ID, msg *Message, policy RelayValidationPolicy) bool {
+	msg.arrival = v.p.clock.Now()
+	if v.p.ordering != nil {
+		v.p.ordering.arrived(msg)
+	}
 
-	if len(vals) > 0 || msg.Signature != nil {
-		select {
-		case v.validateQ <- &validateReq{vals, src, msg}:
-		default:
-			log.Debugf("message validation throttled: queue full; dropping message from %s", src)
-			v.tracer.RejectMessage(msg, RejectValidationQueueFull)
-		}
+	var vals []*validatorImpl
+	switch policy {
+	case RelayValidationNone:
+		return true
+	case RelayValidationFull:
+		vals = v.getValidators(msg)
+	}
+
+	if msg.Signature != nil && v.verifyWorkers > 0 {
+		v.enqueue(v.verifyQ, &validateReq{vals: vals, src: src, msg: msg})
+		return false
+	}
+
+	if len(vals) > 0 || msg.Signature != nil || v.p.topicSecurity(msg.GetTopic()) != nil {
+		v.enqueue(v.validateQ, &validateReq{vals: vals, src: src, msg: msg})
 		return false
 	}
 
 	return true
 }
 
+// enqueue queues a request for a stage of the pipeline, dropping the message if the queue is full
+func (v *validation) enqueue(q chan *validateReq, req *validateReq) {
+	select {
+	case q <- req:
+	default:
+		log.Debugf("message validation throttled: queue full; dropping message from %s", req.src)
+		v.p.rejectMessage(req.msg, RejectValidationQueueFull)
+	}
+}
+
 // getValidators returns all validators that apply to a given message
 func (v *validation) getValidators(msg *Message) []*validatorImpl {
 	v.mx.Lock()
@@ -277,40 +344,100 @@ func (v *validation) getValidators(msg *Message) []*validatorImpl {
 	return append(vals, val)
 }
 
+// verifyWorker is an active goroutine verifying signatures, handing the messages with
+// validators over to the validation workers
+func (v *validation) verifyWorker() {
+	for {
+		select {
+		case req := <-v.verifyQ:
+			if v.verify(req.src, req.msg) != nil {
+				continue
+			}
+
+			req.verified = true
+			if len(req.vals) > 0 || v.p.topicSecurity(req.msg.GetTopic()) != nil {
+				v.enqueue(v.validateQ, req)
+				continue
+			}
+			v.validateVerified(req.vals, req.src, req.msg, false)
+		case <-v.p.ctx.Done():
+			return
+		}
+	}
+}
+
 // validateWorker is an active goroutine performing inline validation
 func (v *validation) validateWorker() {
 	for {
 		select {
 		case req := <-v.validateQ:
-			v.validate(req.vals, req.src, req.msg, false)
+			if req.verified {
+				v.validateVerified(req.vals, req.src, req.msg, false)
+			} else {
+				v.validate(req.vals, req.src, req.msg, false)
+			}
 		case <-v.p.ctx.Done():
 			return
 		}
 	}
 }
 
-// validate performs validation and only sends the message if all validators succeed
-func (v *validation) validate(vals []*validatorImpl, src peer.ID, msg *Message, synchronous bool) error {
+// verify verifies the signature of a message, if signed
+func (v *validation) verify(src peer.ID, msg *Message) error {
 	// If signature verification is enabled, but signing is disabled,
 	// the Signature is required to be nil upon receiving the message in PubSub.pushMsg.
-	if msg.Signature != nil {
-		if !v.validateSignature(msg) {
-			log.Debugf("message signature validation failed; dropping message from %s", src)
-			v.tracer.RejectMessage(msg, RejectInvalidSignature)
-			return ValidationError{Reason: RejectInvalidSignature}
+	if msg.Signature == nil {
+		return nil
+	}
+
+	// repeated arrivals of a known bad message are rejected without verifying it again; the
+	// message is only digested when its ID is known to have failed
+	id := v.p.idGen.ID(msg)
+	known := v.badSigIDs.Has(id) && v.badSigs.Has(v.signatureFailureKey(id, msg))
+	if known || !v.validateSignature(msg) {
+		log.Debugf("message signature validation failed; dropping message from %s", src)
+		if !known {
+			v.badSigIDs.Add(id)
+			v.badSigs.Add(v.signatureFailureKey(id, msg))
 		}
+		v.p.rejectMessage(msg, RejectInvalidSignature)
+		return ValidationError{Reason: RejectInvalidSignature}
+	}
+	return nil
+}
+
+// validate performs validation and only sends the message if all validators succeed
+func (v *validation) validate(vals []*validatorImpl, src peer.ID, msg *Message, synchronous bool) error {
+	if err := v.verify(src, msg); err != nil {
+		return err
 	}
+	return v.validateVerified(vals, src, msg, synchronous)
+}
 
+// validateVerified performs validation of a message whose signature is verified
+func (v *validation) validateVerified(vals []*validatorImpl, src peer.ID, msg *Message, synchronous bool) error {
 	// we can mark the message as seen now that we have verified the signature
 	// and avoid invoking user validators more than once
 	id := v.p.idGen.ID(msg)
-	if !v.p.markSeen(id) {
+	if !v.p.markSeen(msg.GetTopic(), id) {
+		v.p.stats.duplicate(msg)
+		v.p.duplicate(id)
 		v.tracer.DuplicateMessage(msg)
+		v.p.ordered(msg, false)
 		return nil
-	} else {
-		v.tracer.ValidateMessage(msg)
 	}
 
+	// validators only get to see the plaintext of sealed messages
+	if err := v.p.openMessage(msg); err != nil {
+		log.Debugf("failed to open message from %s: %s", src, err)
+		v.p.rejectMessage(msg, RejectMessageOpenFailed)
+		return ValidationError{Reason: RejectMessageOpenFailed}
+	}
+
+	v.tracer.ValidateMessage(msg)
+
+	ctx, cancel := v.messageContext(msg)
+
 	var inline, async []*validatorImpl
 	for _, val := range vals {
 		if val.validateInline || synchronous {
@@ -324,7 +451,7 @@ func (v *validation) validate(vals []*validatorImpl, src peer.ID, msg *Message,
 	result := ValidationAccept
 loop:
 	for _, val := range inline {
-		switch val.validateMsg(v.p.ctx, src, msg) {
+		switch val.validateMsg(ctx, src, msg) {
 		case ValidationAccept:
 		case ValidationReject:
 			result = ValidationReject
@@ -335,32 +462,46 @@ loop:
 	}
 
 	if result == ValidationReject {
+		cancel()
 		log.Debugf("message validation failed; dropping message from %s", src)
-		v.tracer.RejectMessage(msg, RejectValidationFailed)
+		v.p.rejectMessage(msg, RejectValidationFailed)
 		return ValidationError{Reason: RejectValidationFailed}
 	}
 
+	if pastDeadline(ctx) {
+		cancel()
+		log.Debugf("message validation deadline exceeded; ignoring message from %s", src)
+		v.p.rejectMessage(msg, RejectValidationDeadline)
+		return ValidationError{Reason: RejectValidationDeadline}
+	}
+
 	// apply async validators
 	if len(async) > 0 {
 		select {
 		case v.validateThrottle <- struct{}{}:
 			go func() {
-				v.doValidateTopic(async, src, msg, result)
+				v.doValidateTopic(ctx, async, src, msg, result)
+				cancel()
 				<-v.validateThrottle
 			}()
 		default:
+			cancel()
 			log.Debugf("message validation throttled; dropping message from %s", src)
-			v.tracer.RejectMessage(msg, RejectValidationThrottled)
+			v.p.rejectMessage(msg, RejectValidationThrottled)
 		}
 		return nil
 	}
+	cancel()
 
 	if result == ValidationIgnore {
-		v.tracer.RejectMessage(msg, RejectValidationIgnored)
+		v.p.rejectMessage(msg, RejectValidationIgnored)
 		return ValidationError{Reason: RejectValidationIgnored}
 	}
 
 	// no async validators, accepted message, send it!
+	if v.p.ordered(msg, true) {
+		return nil
+	}
 	select {
 	case v.p.sendMsg <- msg:
 		return nil
@@ -370,36 +511,60 @@ loop:
 }
 
 func (v *validation) validateSignature(msg *Message) bool {
-	err := verifyMessageSignature(msg.Message)
+	m := msg.wireMessage()
+	err := verifyMessageSignatureWith(m, v.p.authorKeyLookup())
 	if err != nil {
 		log.Debugf("signature verification error: %s", err.Error())
 		return false
 	}
 
+	if m.Key != nil && v.p.stripForwardedKeys {
+		v.p.learnAuthorKey(m)
+	}
+
 	return true
 }
 
-func (v *validation) doValidateTopic(vals []*validatorImpl, src peer.ID, msg *Message, r ValidationResult) {
-	result := v.validateTopic(vals, src, msg)
+// signatureFailureKey keys the signature failure cache by message ID and a digest of the
+// message, so that a forged copy of a message can't get the genuine message rejected.
+func (v *validation) signatureFailureKey(id string, msg *Message) string {
+	b, err := msg.wireMessage().Marshal()
+	if err != nil {
+		return id
+	}
+	digest := sha256.Sum256(b)
+	return id + string(digest[:])
+}
+
+func (v *validation) doValidateTopic(ctx context.Context, vals []*validatorImpl, src peer.ID, msg *Message, r ValidationResult) {
+	result := v.validateTopic(ctx, vals, src, msg)
 
 	if result == ValidationAccept && r != ValidationAccept {
 		result = r
 	}
+	if result != ValidationReject && pastDeadline(ctx) {
+		result = validationDeadlineExceeded
+	}
 
 	switch result {
 	case ValidationAccept:
-		v.p.sendMsg <- msg
+		if !v.p.ordered(msg, true) {
+			v.p.sendMsg <- msg
+		}
 	case ValidationReject:
 		log.Debugf("message validation failed; dropping message from %s", src)
-		v.tracer.RejectMessage(msg, RejectValidationFailed)
+		v.p.rejectMessage(msg, RejectValidationFailed)
 		return
 	case ValidationIgnore:
 		log.Debugf("message validation punted; ignoring message from %s", src)
-		v.tracer.RejectMessage(msg, RejectValidationIgnored)
+		v.p.rejectMessage(msg, RejectValidationIgnored)
 		return
 	case validationThrottled:
 		log.Debugf("message validation throttled; ignoring message from %s", src)
-		v.tracer.RejectMessage(msg, RejectValidationThrottled)
+		v.p.rejectMessage(msg, RejectValidationThrottled)
+	case validationDeadlineExceeded:
+		log.Debugf("message validation deadline exceeded; ignoring message from %s", src)
+		v.p.rejectMessage(msg, RejectValidationDeadline)
 
 	default:
 		// BUG: this would be an internal programming error, so a panic seems appropiate.
@@ -407,12 +572,12 @@ func (v *validation) doValidateTopic(vals []*validatorImpl, src peer.ID, msg *Me
 	}
 }
 
-func (v *validation) validateTopic(vals []*validatorImpl, src peer.ID, msg *Message) ValidationResult {
+func (v *validation) validateTopic(ctx context.Context, vals []*validatorImpl, src peer.ID, msg *Message) ValidationResult {
 	if len(vals) == 1 {
-		return v.validateSingleTopic(vals[0], src, msg)
+		return v.validateSingleTopic(ctx, vals[0], src, msg)
 	}
 
-	ctx, cancel := context.WithCancel(v.p.ctx)
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	rch := make(chan ValidationResult, len(vals))
@@ -437,7 +602,15 @@ func (v *validation) validateTopic(vals []*validatorImpl, src peer.ID, msg *Mess
 	result := ValidationAccept
 loop:
 	for i := 0; i < rcount; i++ {
-		switch <-rch {
+		var r ValidationResult
+		select {
+		case r = <-rch:
+		case <-ctx.Done():
+			// don't wait for the validators past the deadline
+			return validationDeadlineExceeded
+		}
+
+		switch r {
 		case ValidationAccept:
 		case ValidationReject:
 			result = ValidationReject
@@ -457,10 +630,10 @@ loop:
 }
 
 // fast path for single topic validation that avoids the extra goroutine
-func (v *validation) validateSingleTopic(val *validatorImpl, src peer.ID, msg *Message) ValidationResult {
+func (v *validation) validateSingleTopic(ctx context.Context, val *validatorImpl, src peer.ID, msg *Message) ValidationResult {
 	select {
 	case val.validateThrottle <- struct{}{}:
-		res := val.validateMsg(v.p.ctx, src, msg)
+		res := val.validateMsg(ctx, src, msg)
 		<-val.validateThrottle
 		return res
 
@@ -524,11 +697,13 @@ func WithDefaultValidator(val interface{}, opts ...ValidatorOpt) Option {
 	}
 }
 
-// WithValidateQueueSize sets the buffer of validate queue. Defaults to 32.
+// WithValidateQueueSize sets the buffer of validate queue, and of the signature verification
+// queue ahead of it. Defaults to 32.
 // When queue is full, validation is throttled and new messages are dropped.
 func WithValidateQueueSize(n int) Option {
 	return func(ps *PubSub) error {
 		if n > 0 {
+			ps.val.verifyQ = make(chan *validateReq, n)
 			ps.val.validateQ = make(chan *validateReq, n)
 			return nil
 		}
@@ -548,8 +723,8 @@ func WithValidateThrottle(n int) Option {
 // WithValidateWorkers sets the number of synchronous validation worker goroutines.
 // Defaults to NumCPU.
 //
-// The synchronous validation workers perform signature validation, apply inline
-// user validators, and schedule asynchronous user validators.
+// The synchronous validation workers apply inline user validators, and schedule
+// asynchronous user validators.
 // You can adjust this parameter to devote less cpu time to synchronous validation.
 func WithValidateWorkers(n int) Option {
 	return func(ps *PubSub) error {
@@ -561,6 +736,23 @@ func WithValidateWorkers(n int) Option {
 	}
 }
 
+// WithVerifyWorkers sets the number of signature verification worker goroutines.
+// Defaults to NumCPU.
+//
+// The verification workers verify the signatures of messages ahead of the validation
+// workers, so that messages failing verification never reach validators and slow
+// validators don't hold up verification. With 0, the validation workers verify the
+// signatures themselves.
+func WithVerifyWorkers(n int) Option {
+	return func(ps *PubSub) error {
+		if n >= 0 {
+			ps.val.verifyWorkers = n
+			return nil
+		}
+		return fmt.Errorf("number of verification workers must be >= 0")
+	}
+}
+
 // WithValidatorTimeout is an option that sets a timeout for an (asynchronous) topic validator.
 // By default there is no timeout in asynchronous validators.
 func WithValidatorTimeout(timeout time.Duration) ValidatorOpt {
@@ -0,0 +1,234 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+var (
+	// ErrNotPropagated is sent by PublishWithWatch when a published message showed no sign of
+	// propagating within the watch window of its topic.
+	ErrNotPropagated = errors.New("published message did not propagate")
+	// ErrTopicNotWatched is returned by PublishWithWatch for a topic joined without
+	// WithPublishWatch.
+	ErrTopicNotWatched = errors.New("topic is not watched")
+)
+
+// PublishWatchTracer is an optional interface for RawTracers, which is invoked when a message
+// published in a topic joined with WithPublishWatch showed no sign of propagating within the
+// watch window, as its topic may be partitioned from us.
+type PublishWatchTracer interface {
+	NotPropagated(msg *Message, window time.Duration)
+}
+
+// WithPublishWatch watches the messages published in a Topic for a sign that they propagated
+// through the network, a duplicate relayed back to us or a peer announcing or requesting them
+// in gossip. The messages without such a sign within window are reported to the
+// PublishWatchTracers, and to the publisher with PublishWithWatch.
+func WithPublishWatch(window time.Duration) TopicOpt {
+	return func(t *Topic) error {
+		if window <= 0 {
+			return fmt.Errorf("invalid publish watch window: %s", window)
+		}
+		t.watchWindow = window
+		return nil
+	}
+}
+
+// PublishWithWatch publishes data to a topic joined with WithPublishWatch, returning a channel
+// which is closed when the message is seen propagating, or receives ErrNotPropagated if it isn't
+// within the watch window.
+func (t *Topic) PublishWithWatch(ctx context.Context, data []byte, opts ...PubOpt) (<-chan error, error) {
+	if t.watchWindow == 0 {
+		return nil, ErrTopicNotWatched
+	}
+
+	res := make(chan error, 1)
+	opts = append(opts[:len(opts):len(opts)], func(pub *PublishOptions) error {
+		if pub.local {
+			return fmt.Errorf("cannot watch a local publication")
+		}
+		pub.watch = res
+		return nil
+	})
+	if _, err := t.publish(ctx, data, false, opts...); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// publishWatch is a locally published message waiting for a sign of propagation
+type publishWatch struct {
+	msg    *Message
+	window time.Duration
+	// res is the channel of PublishWithWatch; nil with Publish
+	res chan<- error
+	// stop is closed once the watch is no longer outstanding, stopping its timer
+	stop chan struct{}
+}
+
+// watchTracker is an internal tracer that confirms the propagation of the messages published in
+// the watched topics. It is only hooked to the tracer once a message is watched.
+type watchTracker struct {
+	idGen  *msgIDGenerator
+	tracer *pubsubTracer
+	clock  Clock
+
+	// number of outstanding watches; lets the tracer hooks bail out cheaply
+	pending int32
+	// installed is set once the tracker is hooked to the tracer
+	installed atomic.Bool
+
+	sync.Mutex
+	// the outstanding watches by message ID; messages published more than once with the same
+	// ID have a watch for each publication
+	watches map[string][]*publishWatch
+}
+
+var _ RawTracer = (*watchTracker)(nil)
+
+func newWatchTracker(idGen *msgIDGenerator, tracer *pubsubTracer, clock Clock) *watchTracker {
+	return &watchTracker{
+		idGen:   idGen,
+		tracer:  tracer,
+		clock:   clock,
+		watches: make(map[string][]*publishWatch),
+	}
+}
+
+// installWatches hooks the watch tracker to the tracer on the first message watched, so that it
+// costs nothing to the applications which never watch one
+func (p *PubSub) installWatches() error {
+	return p.installRaw(&p.watches.installed, p.watches)
+}
+
+func (wt *watchTracker) watch(msg *Message, window time.Duration, res chan<- error) *publishWatch {
+	w := &publishWatch{msg: msg, window: window, res: res, stop: make(chan struct{})}
+	id := wt.idGen.ID(msg)
+
+	wt.Lock()
+	wt.watches[id] = append(wt.watches[id], w)
+	atomic.AddInt32(&wt.pending, 1)
+	wt.Unlock()
+
+	expire := wt.clock.After(window)
+	go func() {
+		select {
+		case <-expire:
+			if wt.remove(id, w) {
+				wt.expired(w)
+			}
+		case <-w.stop:
+		}
+	}()
+	return w
+}
+
+// unwatch drops a watch without reporting it; used when the publish itself failed.
+func (wt *watchTracker) unwatch(w *publishWatch) {
+	if w == nil {
+		return
+	}
+	wt.remove(wt.idGen.ID(w.msg), w)
+}
+
+// remove drops a watch, returning whether it was outstanding
+func (wt *watchTracker) remove(id string, w *publishWatch) bool {
+	wt.Lock()
+	defer wt.Unlock()
+
+	ws := wt.watches[id]
+	i := slices.Index(ws, w)
+	if i < 0 {
+		return false
+	}
+	if len(ws) == 1 {
+		delete(wt.watches, id)
+	} else {
+		wt.watches[id] = slices.Delete(ws, i, i+1)
+	}
+	atomic.AddInt32(&wt.pending, -1)
+	close(w.stop)
+	return true
+}
+
+func (wt *watchTracker) expired(w *publishWatch) {
+	wt.tracer.NotPropagated(w.msg, w.window)
+	if w.res != nil {
+		w.res <- ErrNotPropagated
+		close(w.res)
+	}
+}
+
+func (wt *watchTracker) active() bool {
+	return atomic.LoadInt32(&wt.pending) > 0
+}
+
+// seen is called when there is a sign of propagation of the messages with the given ID.
+func (wt *watchTracker) seen(id string) {
+	wt.Lock()
+	ws := slices.Clone(wt.watches[id])
+	wt.Unlock()
+
+	for _, w := range ws {
+		if wt.remove(id, w) && w.res != nil {
+			close(w.res)
+		}
+	}
+}
+
+func (wt *watchTracker) DuplicateMessage(msg *Message) {
+	if !wt.active() {
+		return
+	}
+	wt.seen(wt.idGen.ID(msg))
+}
+
+func (wt *watchTracker) RejectMessage(msg *Message, reason string) {
+	if !wt.active() {
+		return
+	}
+	// our own messages relayed back to us are rejected before the seen cache check
+	if reason == RejectSelfOrigin {
+		wt.seen(wt.idGen.ID(msg))
+	}
+}
+
+func (wt *watchTracker) RecvRPC(rpc *RPC) {
+	if !wt.active() {
+		return
+	}
+	// a peer announcing the message got it from elsewhere, and a peer asking for it learnt of
+	// it, from us or from elsewhere
+	for _, ihave := range rpc.GetControl().GetIhave() {
+		for _, mid := range ihave.GetMessageIDs() {
+			wt.seen(mid)
+		}
+	}
+	for _, iwant := range rpc.GetControl().GetIwant() {
+		for _, mid := range iwant.GetMessageIDs() {
+			wt.seen(mid)
+		}
+	}
+}
+
+func (wt *watchTracker) AddPeer(p peer.ID, proto protocol.ID) {}
+func (wt *watchTracker) RemovePeer(p peer.ID)                 {}
+func (wt *watchTracker) Join(topic string)                    {}
+func (wt *watchTracker) Leave(topic string)                   {}
+func (wt *watchTracker) Graft(p peer.ID, topic string)        {}
+func (wt *watchTracker) Prune(p peer.ID, topic string)        {}
+func (wt *watchTracker) ValidateMessage(msg *Message)         {}
+func (wt *watchTracker) DeliverMessage(msg *Message)          {}
+func (wt *watchTracker) ThrottlePeer(p peer.ID)               {}
+func (wt *watchTracker) SendRPC(rpc *RPC, p peer.ID)          {}
+func (wt *watchTracker) DropRPC(rpc *RPC, p peer.ID)          {}
+func (wt *watchTracker) UndeliverableMessage(msg *Message)    {}
@@ -0,0 +1,173 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+)
+
+type watchTestTracer struct {
+	noopRawTracer
+
+	mx     sync.Mutex
+	missed []*Message
+}
+
+func (wt *watchTestTracer) NotPropagated(msg *Message, window time.Duration) {
+	wt.mx.Lock()
+	defer wt.mx.Unlock()
+	wt.missed = append(wt.missed, msg)
+}
+
+func (wt *watchTestTracer) count() int {
+	wt.mx.Lock()
+	defer wt.mx.Unlock()
+	return len(wt.missed)
+}
+
+func TestPublishWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts := getNetHosts(t, ctx, 20)
+	tracer := new(watchTestTracer)
+	psubs := append([]*PubSub{getGossipsub(ctx, hosts[0], WithRawTracer(tracer))}, getGossipsubs(ctx, hosts[1:])...)
+	topics := getTopics(psubs, "foobar", WithPublishWatch(5*time.Second))
+
+	for _, tp := range topics {
+		if _, err := tp.Subscribe(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a lone publisher doesn't propagate its messages
+	lone, err := psubs[0].Join("lone", WithPublishWatch(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := lone.PublishWithWatch(ctx, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-res:
+		if !errors.Is(err, ErrNotPropagated) {
+			t.Fatalf("expected ErrNotPropagated, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the publish watch did not expire")
+	}
+	if n := tracer.count(); n != 1 {
+		t.Fatalf("expected the tracer to report one message, got %d", n)
+	}
+
+	denseConnect(t, hosts)
+
+	// wait for the mesh to form
+	time.Sleep(2 * time.Second)
+
+	res, err = topics[0].PublishWithWatch(ctx, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err, ok := <-res:
+		if ok || err != nil {
+			t.Fatalf("expected the message to propagate, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the publish watch did not complete")
+	}
+	if n := tracer.count(); n != 1 {
+		t.Fatalf("expected no more message reported by the tracer, got %d", n)
+	}
+
+	// the watches are only armed in the watched topics, and not for local publications
+	plain, err := psubs[0].Join("plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.PublishWithWatch(ctx, []byte("hello")); !errors.Is(err, ErrTopicNotWatched) {
+		t.Fatalf("expected ErrTopicNotWatched, got %v", err)
+	}
+	if _, err := topics[0].PublishWithWatch(ctx, []byte("hello"), WithLocalPublication(true)); err == nil {
+		t.Fatal("expected watching a local publication to fail")
+	}
+}
+
+func TestPublishWatchOnIWant(t *testing.T) {
+	wt := newWatchTracker(newMsgIdGenerator(), nil, newMockClock())
+
+	topic := "test"
+	msg := &Message{Message: &pb.Message{From: []byte("author"), Seqno: []byte("1"), Topic: &topic}}
+	res := make(chan error, 1)
+	wt.watch(msg, time.Minute, res)
+
+	// another message doesn't confirm the propagation
+	wt.RecvRPC(&RPC{RPC: pb.RPC{Control: &pb.ControlMessage{
+		Iwant: []*pb.ControlIWant{{MessageIDs: []string{"other"}}},
+	}}})
+	select {
+	case <-res:
+		t.Fatal("expected the watch to be outstanding")
+	default:
+	}
+
+	wt.RecvRPC(&RPC{RPC: pb.RPC{Control: &pb.ControlMessage{
+		Iwant: []*pb.ControlIWant{{MessageIDs: []string{wt.idGen.ID(msg)}}},
+	}}})
+	select {
+	case err, ok := <-res:
+		if ok || err != nil {
+			t.Fatalf("expected the watch to complete, got %v", err)
+		}
+	default:
+		t.Fatal("expected an IWANT to confirm the propagation")
+	}
+	if wt.active() {
+		t.Fatal("expected no outstanding watch")
+	}
+}
+
+func TestPublishWatchSameID(t *testing.T) {
+	clk := newMockClock()
+	wt := newWatchTracker(newMsgIdGenerator(), nil, clk)
+
+	topic := "test"
+	msg := &Message{Message: &pb.Message{From: []byte("author"), Seqno: []byte("1"), Topic: &topic}}
+	first, second := make(chan error, 1), make(chan error, 1)
+	wt.watch(msg, time.Minute, first)
+	wt.watch(msg, 2*time.Minute, second)
+
+	// each publication of the message has its own watch, expiring on the clock
+	time.Sleep(10 * time.Millisecond)
+	clk.Add(time.Minute)
+	select {
+	case err := <-first:
+		if !errors.Is(err, ErrNotPropagated) {
+			t.Fatalf("expected ErrNotPropagated, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the first watch to expire")
+	}
+	if !wt.active() {
+		t.Fatal("expected the second watch to be outstanding")
+	}
+
+	wt.seen(wt.idGen.ID(msg))
+	select {
+	case err, ok := <-second:
+		if ok || err != nil {
+			t.Fatalf("expected the second watch to complete, got %v", err)
+		}
+	default:
+		t.Fatal("expected the second watch to complete")
+	}
+	if wt.active() {
+		t.Fatal("expected no outstanding watch")
+	}
+}